@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 告警规则参数
+var alertRulesPath = &config.AlertRules
+
+// 告警级别
+var alertSeverities = map[string]bool{
+	"info":     true,
+	"warning":  true,
+	"critical": true,
+}
+
+// alertConfig 告警规则文件结构
+type alertConfig struct {
+	Zones      []alertZone `json:"zones"`
+	QuietHours []string    `json:"quiet_hours"` // 静默时段，如 "12:00-13:30"，期间不产生任何告警
+	Rules      []alertRule `json:"rules"`
+}
+
+// alertZone 多边形区域（原图像素坐标）
+type alertZone struct {
+	Name    string       `json:"name"`
+	Polygon [][2]float32 `json:"polygon"`
+}
+
+// alertRule 告警规则
+// 规则按文件中的顺序匹配，第一条满足条件的规则生效；类别或区域为空表示不限制
+type alertRule struct {
+	Name          string   `json:"name"`
+	Classes       []string `json:"classes,omitempty"`
+	Zones         []string `json:"zones,omitempty"`
+	MinConfidence float32  `json:"min_confidence"`
+	TimeWindow    string   `json:"time_window,omitempty"` // 如 "22:00-06:00"，可跨零点；为空表示全天
+	Severity      string   `json:"severity"`
+
+	window *timeWindow
+}
+
+// AlertEvent 告警事件，记录触发的规则和检测目标
+type AlertEvent struct {
+	Time      time.Time       `json:"time"`
+	ImagePath string          `json:"image_path"`
+	Rule      string          `json:"rule"`
+	Severity  string          `json:"severity"`
+	Zones     []string        `json:"zones,omitempty"`
+	Detection DetectionObject `json:"detection"`
+}
+
+// timeWindow 一天中的时间段（分钟），End 小于 Start 表示跨零点
+type timeWindow struct {
+	Start, End int
+}
+
+// parseTimeWindow 解析 "HH:MM-HH:MM" 格式的时间段
+func parseTimeWindow(s string) (*timeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("时间窗口格式错误: %q（期望 HH:MM-HH:MM）", s)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("时间窗口格式错误: %q: %w", s, err)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return &timeWindow{Start: minutes[0], End: minutes[1]}, nil
+}
+
+// contains 判断时间是否落在时间段内（按 -timezone 时区计算）
+func (w *timeWindow) contains(t time.Time) bool {
+	local := t.In(getDisplayLocation())
+	m := local.Hour()*60 + local.Minute()
+	if w.Start <= w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+// containsPoint 射线法判断点是否在多边形内
+func (z *alertZone) containsPoint(x, y float32) bool {
+	inside := false
+	n := len(z.Polygon)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		xi, yi := z.Polygon[i][0], z.Polygon[i][1]
+		xj, yj := z.Polygon[j][0], z.Polygon[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// alertEngine 告警规则引擎，支持运行时重新加载规则（-serve 的 POST /admin/alerts/reload）
+type alertEngine struct {
+	mutex      sync.RWMutex
+	path       string
+	zones      []alertZone
+	quietHours []*timeWindow
+	rules      []alertRule
+}
+
+// 全局告警引擎，未配置 -alert-rules 时为 nil
+var alerts *alertEngine
+
+// newAlertEngine 加载并校验告警规则文件
+func newAlertEngine(path string) (*alertEngine, error) {
+	engine := &alertEngine{path: path}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Reload 重新加载规则文件；校验失败时保留原有规则并返回错误
+func (engine *alertEngine) Reload() error {
+	data, err := os.ReadFile(engine.path)
+	if err != nil {
+		return fmt.Errorf("读取告警规则文件失败: %w", err)
+	}
+	var config alertConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("解析告警规则文件失败: %w", err)
+	}
+
+	quietHours, err := validateAlertConfig(&config)
+	if err != nil {
+		return err
+	}
+
+	engine.mutex.Lock()
+	engine.zones = config.Zones
+	engine.quietHours = quietHours
+	engine.rules = config.Rules
+	engine.mutex.Unlock()
+	return nil
+}
+
+// counts 返回当前生效的区域和规则数量
+func (engine *alertEngine) counts() (zones, rules int) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return len(engine.zones), len(engine.rules)
+}
+
+// validateAlertConfig 校验规则：未知类别、未知区域、无效级别和时间窗口都会被拒绝
+func validateAlertConfig(config *alertConfig) ([]*timeWindow, error) {
+	var problems []string
+
+	zoneNames := make(map[string]bool, len(config.Zones))
+	for _, zone := range config.Zones {
+		if zone.Name == "" || zoneNames[zone.Name] {
+			problems = append(problems, fmt.Sprintf("区域名称为空或重复: %q", zone.Name))
+		}
+		if len(zone.Polygon) < 3 {
+			problems = append(problems, fmt.Sprintf("区域 %q 至少需要 3 个顶点", zone.Name))
+		}
+		zoneNames[zone.Name] = true
+	}
+
+	var quietHours []*timeWindow
+	for _, s := range config.QuietHours {
+		w, err := parseTimeWindow(s)
+		if err != nil {
+			problems = append(problems, "静默时段: "+err.Error())
+			continue
+		}
+		quietHours = append(quietHours, w)
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule_%d", i+1)
+		}
+		for _, class := range rule.Classes {
+			// 规则按检测框的英文标签匹配，这里不接受中文名
+			if id, ok := ClassID(class); !ok || Label(id) != class {
+				problems = append(problems, fmt.Sprintf("规则 %s: 未知类别 %q", rule.Name, class))
+			}
+		}
+		for _, zone := range rule.Zones {
+			if !zoneNames[zone] {
+				problems = append(problems, fmt.Sprintf("规则 %s: 未知区域 %q", rule.Name, zone))
+			}
+		}
+		if !alertSeverities[rule.Severity] {
+			problems = append(problems, fmt.Sprintf("规则 %s: 无效的告警级别 %q（支持 info, warning, critical）", rule.Name, rule.Severity))
+		}
+		if rule.TimeWindow != "" {
+			w, err := parseTimeWindow(rule.TimeWindow)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("规则 %s: %v", rule.Name, err))
+			}
+			rule.window = w
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("告警规则校验失败:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return quietHours, nil
+}
+
+// Evaluate 对一张图像的检测结果逐个匹配规则，返回产生的告警事件
+func (engine *alertEngine) Evaluate(imagePath string, boxes []boundingBox, now time.Time) []AlertEvent {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	for _, w := range engine.quietHours {
+		if w.contains(now) {
+			return nil
+		}
+	}
+
+	var events []AlertEvent
+	for _, box := range boxes {
+		// 区域分配：以检测框中心点判断所在区域
+		cx, cy := (box.x1+box.x2)/2, (box.y1+box.y2)/2
+		var zones []string
+		for i := range engine.zones {
+			if engine.zones[i].containsPoint(cx, cy) {
+				zones = append(zones, engine.zones[i].Name)
+			}
+		}
+
+		for _, rule := range engine.rules {
+			if !rule.matches(box, zones, now) {
+				continue
+			}
+			events = append(events, AlertEvent{
+				Time:      now,
+				ImagePath: imagePath,
+				Rule:      rule.Name,
+				Severity:  rule.Severity,
+				Zones:     zones,
+				Detection: newDetectionObject(box),
+			})
+			break
+		}
+	}
+	return events
+}
+
+// matches 判断检测目标是否满足规则的全部条件
+func (rule *alertRule) matches(box boundingBox, zones []string, now time.Time) bool {
+	if box.confidence < rule.MinConfidence {
+		return false
+	}
+	if len(rule.Classes) > 0 && !checkStrIsInArray(box.label, rule.Classes) {
+		return false
+	}
+	if len(rule.Zones) > 0 {
+		inZone := false
+		for _, zone := range zones {
+			if checkStrIsInArray(zone, rule.Zones) {
+				inZone = true
+				break
+			}
+		}
+		if !inZone {
+			return false
+		}
+	}
+	if rule.window != nil && !rule.window.contains(now) {
+		return false
+	}
+	return true
+}
+
+// reportAlerts 评估告警规则并输出到控制台和日志文件
+func reportAlerts(imagePath string, boxes []boundingBox) []AlertEvent {
+	if alerts == nil {
+		return nil
+	}
+	events := alerts.Evaluate(imagePath, boxes, time.Now())
+	for _, event := range events {
+		payload, _ := json.Marshal(event)
+		fmt.Printf("告警[%s] 规则=%s 图像=%s 对象=%s(%s)\n", event.Severity, event.Rule, event.ImagePath,
+			event.Detection.Label, formatConfidence(event.Detection.Confidence))
+		writeLogFile("ALERT", string(payload))
+	}
+	return events
+}
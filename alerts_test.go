@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAlertRules 把规则写入临时文件，返回文件路径
+func writeAlertRules(t *testing.T, dir string, cfg alertConfig) string {
+	t.Helper()
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "alerts.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// atClock 返回今天（-timezone 时区）的 hh:mm
+func atClock(hour, minute int) time.Time {
+	now := time.Now().In(getDisplayLocation())
+	return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+}
+
+func TestAlertRulePrecedence(t *testing.T) {
+	zoneA := alertZone{Name: "A", Polygon: [][2]float32{{0, 0}, {100, 0}, {100, 100}, {0, 100}}}
+	zoneB := alertZone{Name: "B", Polygon: [][2]float32{{100, 0}, {200, 0}, {200, 100}, {100, 100}}}
+	cfg := alertConfig{
+		Zones:      []alertZone{zoneA, zoneB},
+		QuietHours: []string{"12:00-13:00"},
+		Rules: []alertRule{
+			{Name: "night-person-A", Classes: []string{"person"}, Zones: []string{"A"}, MinConfidence: 0.4, TimeWindow: "22:00-06:00", Severity: "critical"},
+			{Name: "vehicle-B", Classes: []string{"car", "truck"}, Zones: []string{"B"}, MinConfidence: 0.6, Severity: "info"},
+			{Name: "person-any", Classes: []string{"person"}, MinConfidence: 0.7, Severity: "warning"},
+		},
+	}
+	engine, err := newAlertEngine(writeAlertRules(t, t.TempDir(), cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inA := func(label string, conf float32) boundingBox {
+		return boundingBox{label: label, confidence: conf, x1: 40, y1: 40, x2: 60, y2: 60}
+	}
+	inB := func(label string, conf float32) boundingBox {
+		return boundingBox{label: label, confidence: conf, x1: 140, y1: 40, x2: 160, y2: 60}
+	}
+
+	tests := []struct {
+		name string
+		box  boundingBox
+		now  time.Time
+		rule string // 为空表示不告警
+	}{
+		{"夜间区域A的人员命中第一条规则", inA("person", 0.5), atClock(23, 0), "night-person-A"},
+		{"跨零点的时间窗口", inA("person", 0.5), atClock(5, 59), "night-person-A"},
+		{"白天落到后面的规则", inA("person", 0.8), atClock(10, 0), "person-any"},
+		{"两条规则都满足时第一条优先", inA("person", 0.9), atClock(23, 0), "night-person-A"},
+		{"白天置信度不足", inA("person", 0.5), atClock(10, 0), ""},
+		{"区域B的车辆任何时间", inB("car", 0.6), atClock(10, 0), "vehicle-B"},
+		{"区域A的车辆不匹配", inA("car", 0.9), atClock(10, 0), ""},
+		{"未列出的类别", inB("dog", 0.9), atClock(23, 0), ""},
+		{"静默时段不告警", inA("person", 0.9), atClock(12, 30), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := engine.Evaluate("a.jpg", []boundingBox{tt.box}, tt.now)
+			if tt.rule == "" {
+				if len(events) != 0 {
+					t.Errorf("触发了规则 %s，期望不告警", events[0].Rule)
+				}
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("触发了 %d 个告警，期望 1 个（每个检测目标只匹配一条规则）", len(events))
+			}
+			if events[0].Rule != tt.rule {
+				t.Errorf("触发规则 = %s，期望 %s", events[0].Rule, tt.rule)
+			}
+			if events[0].Detection.Label != tt.box.label {
+				t.Errorf("事件中的检测目标 = %s，期望 %s", events[0].Detection.Label, tt.box.label)
+			}
+		})
+	}
+}
+
+func TestAlertConfigValidation(t *testing.T) {
+	zone := alertZone{Name: "A", Polygon: [][2]float32{{0, 0}, {1, 0}, {1, 1}}}
+	tests := []struct {
+		name    string
+		cfg     alertConfig
+		problem string
+	}{
+		{"未知类别", alertConfig{Rules: []alertRule{{Classes: []string{"unicorn"}, Severity: "info"}}}, "未知类别"},
+		{"中文类别名", alertConfig{Rules: []alertRule{{Classes: []string{"人员"}, Severity: "info"}}}, "未知类别"},
+		{"未知区域", alertConfig{Zones: []alertZone{zone}, Rules: []alertRule{{Zones: []string{"B"}, Severity: "info"}}}, "未知区域"},
+		{"无效级别", alertConfig{Rules: []alertRule{{Severity: "urgent"}}}, "无效的告警级别"},
+		{"无效时间窗口", alertConfig{Rules: []alertRule{{TimeWindow: "22:00", Severity: "info"}}}, "时间窗口格式错误"},
+		{"顶点不足的区域", alertConfig{Zones: []alertZone{{Name: "C", Polygon: [][2]float32{{0, 0}, {1, 1}}}}}, "至少需要 3 个顶点"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateAlertConfig(&tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("错误 = %v，期望包含 %q", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestAlertEngineReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeAlertRules(t, dir, alertConfig{Rules: []alertRule{{Name: "old", Classes: []string{"person"}, Severity: "info"}}})
+	engine, err := newAlertEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	person := []boundingBox{{label: "person", confidence: 0.9, x2: 10, y2: 10}}
+	ruleOf := func() string {
+		events := engine.Evaluate("a.jpg", person, atClock(10, 0))
+		if len(events) == 0 {
+			return ""
+		}
+		return events[0].Rule
+	}
+
+	writeAlertRules(t, dir, alertConfig{Rules: []alertRule{{Name: "new", Classes: []string{"person"}, Severity: "critical"}}})
+	if err := engine.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if rule := ruleOf(); rule != "new" {
+		t.Errorf("重新加载后触发规则 = %q，期望 new", rule)
+	}
+
+	// 校验失败时保留原有规则
+	writeAlertRules(t, dir, alertConfig{Rules: []alertRule{{Name: "bad", Classes: []string{"unicorn"}, Severity: "info"}}})
+	if err := engine.Reload(); err == nil {
+		t.Error("未知类别的规则文件应重新加载失败")
+	}
+	if rule := ruleOf(); rule != "new" {
+		t.Errorf("重新加载失败后触发规则 = %q，期望仍为 new", rule)
+	}
+}
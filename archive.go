@@ -0,0 +1,208 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 压缩包输入参数
+var archiveSpillLimitMB = &config.ArchiveSpillMB
+
+// archiveEntrySep 压缩包内条目的虚拟路径分隔符，如 images.zip!/day1/0001.jpg
+const archiveEntrySep = "!/"
+
+// errArchiveSpillLimit tar 包解出的图像超过临时目录容量上限
+var errArchiveSpillLimit = errors.New("超过临时目录容量上限")
+
+var (
+	// 已打开的 zip 文件，按路径缓存，避免每读取一个条目都重新解析中央目录
+	zipReaders     = make(map[string]*zip.ReadCloser)
+	zipReaderMutex sync.Mutex
+
+	// tar 包解出图像使用的临时目录，程序退出前清理
+	archiveSpillDirs  []string
+	archiveSpillMutex sync.Mutex
+)
+
+// isArchivePath 判断输入源是否为支持的压缩包（.zip、.tar、.tar.gz、.tgz）
+func isArchivePath(p string) bool {
+	lower := strings.ToLower(p)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// listArchiveImages 列出压缩包中的图像（包括子目录中的图像）
+// zip 支持随机访问，直接返回虚拟路径，读取时从压缩包中解码而不落盘；
+// tar 只能顺序读取，图像条目解出到临时目录（受 -archive-spill-mb 限制），保留条目的目录结构和文件名
+func listArchiveImages(archivePath string) ([]string, error) {
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		return listZipImages(archivePath)
+	}
+	return spillTarImages(archivePath)
+}
+
+// listZipImages 列出 zip 中的图像条目
+func listZipImages(archivePath string) ([]string, error) {
+	reader, err := openZipReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	var imagePaths []string
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || !supportedImageExts[strings.ToLower(path.Ext(f.Name))] {
+			continue
+		}
+		imagePaths = append(imagePaths, archivePath+archiveEntrySep+f.Name)
+	}
+	return imagePaths, nil
+}
+
+// openZipReader 打开并缓存 zip 文件
+func openZipReader(archivePath string) (*zip.ReadCloser, error) {
+	zipReaderMutex.Lock()
+	defer zipReaderMutex.Unlock()
+	if reader, ok := zipReaders[archivePath]; ok {
+		return reader, nil
+	}
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包失败 (路径: %s): %w", archivePath, err)
+	}
+	zipReaders[archivePath] = reader
+	return reader, nil
+}
+
+// splitArchiveEntry 拆分虚拟路径为压缩包路径和条目名称
+func splitArchiveEntry(p string) (archivePath, entry string, ok bool) {
+	idx := strings.Index(p, archiveEntrySep)
+	if idx < 0 || !isArchivePath(p[:idx]) {
+		return "", "", false
+	}
+	return p[:idx], p[idx+len(archiveEntrySep):], true
+}
+
+// loadArchiveImage 直接从 zip 条目解码图像
+func loadArchiveImage(archivePath, entry string) (image.Image, error) {
+	reader, err := openZipReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := reader.Open(entry)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包条目失败 (%s%s%s): %w", archivePath, archiveEntrySep, entry, err)
+	}
+	defer f.Close()
+	pic, err := decodeImage(f)
+	if err != nil {
+		return nil, fmt.Errorf("解码压缩包条目失败 (%s%s%s): %w", archivePath, archiveEntrySep, entry, err)
+	}
+	return pic, nil
+}
+
+// spillTarImages 顺序读取 tar(.gz)，将图像条目解出到临时目录
+// 单个条目损坏只跳过该条目；tar 流本身损坏时停止读取并返回已解出的图像
+func spillTarImages(archivePath string) ([]string, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("打开压缩包失败 (路径: %s): %w", archivePath, err)
+	}
+	defer file.Close()
+
+	var stream io.Reader = file
+	lower := strings.ToLower(archivePath)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("解压 gzip 失败 (路径: %s): %w", archivePath, err)
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	spillDir, err := os.MkdirTemp("", "yolo-archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	archiveSpillMutex.Lock()
+	archiveSpillDirs = append(archiveSpillDirs, spillDir)
+	archiveSpillMutex.Unlock()
+
+	remaining := int64(*archiveSpillLimitMB) << 20
+	var imagePaths []string
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf("警告：压缩包 %s 读取中断，已解出 %d 个图像: %v\n", archivePath, len(imagePaths), err)
+			break
+		}
+		if header.Typeflag != tar.TypeReg || !supportedImageExts[strings.ToLower(path.Ext(header.Name))] {
+			continue
+		}
+		if header.Size > remaining {
+			fmt.Printf("警告：压缩包 %s 解出的图像%s（%d MB），其余条目已跳过\n", archivePath, errArchiveSpillLimit, *archiveSpillLimitMB)
+			break
+		}
+
+		// path.Clean("/"+name) 去掉 ".."，保证条目只能写入临时目录内部
+		target := filepath.Join(spillDir, filepath.FromSlash(path.Clean("/"+header.Name)))
+		if err := spillTarEntry(reader, target); err != nil {
+			fmt.Printf("警告：压缩包条目 %s 解出失败，已跳过: %v\n", header.Name, err)
+			continue
+		}
+		remaining -= header.Size
+		imagePaths = append(imagePaths, target)
+	}
+	return imagePaths, nil
+}
+
+// spillTarEntry 将当前 tar 条目写入目标文件
+func spillTarEntry(reader io.Reader, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	return out.Close()
+}
+
+// cleanupArchives 关闭缓存的 zip 文件并删除 tar 解出的临时目录
+func cleanupArchives() {
+	zipReaderMutex.Lock()
+	for p, reader := range zipReaders {
+		reader.Close()
+		delete(zipReaders, p)
+	}
+	zipReaderMutex.Unlock()
+
+	archiveSpillMutex.Lock()
+	for _, dir := range archiveSpillDirs {
+		os.RemoveAll(dir)
+	}
+	archiveSpillDirs = nil
+	archiveSpillMutex.Unlock()
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 摄像头输入参数
+var cameraSize = &config.CameraSize
+
+const (
+	cameraPrefix    = "camera:" // -img camera:0 打开第一个摄像头
+	cameraListInput = "camera:list"
+)
+
+var (
+	// ErrCameraNotFound 指定的摄像头不存在
+	ErrCameraNotFound = errors.New("找不到摄像头")
+	// ErrCameraBusy 摄像头正在被其他程序（视频会议、另一个检测进程等）使用
+	ErrCameraBusy = errors.New("摄像头被其他程序占用")
+	// ErrCameraPermission 没有访问摄像头的权限
+	ErrCameraPermission = errors.New("没有访问摄像头的权限")
+)
+
+// isCameraInput 判断输入是否为本地摄像头（camera:<序号或名称>）
+func isCameraInput(input string) bool {
+	return strings.HasPrefix(input, cameraPrefix)
+}
+
+// cameraDevice 一个本地摄像头
+type cameraDevice struct {
+	index int    // 在设备列表中的序号
+	name  string // 设备名称
+	input string // 传给 ffmpeg -i 的设备
+}
+
+// cameraFormat 当前平台 ffmpeg 读取摄像头使用的输入格式
+func cameraFormat() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "avfoundation"
+	case "windows":
+		return "dshow"
+	default:
+		return "v4l2"
+	}
+}
+
+// listCameras 列出本机的摄像头：Linux 读取 /sys/class/video4linux，macOS 和 Windows 通过 ffmpeg -list_devices 获取
+func listCameras() ([]cameraDevice, error) {
+	if cameraFormat() == "v4l2" {
+		return listV4L2Devices("/sys/class/video4linux")
+	}
+	if err := checkFFmpeg(); err != nil {
+		return nil, err
+	}
+	// 列出设备后 ffmpeg 以“无法打开输入”退出，设备列表在错误输出中
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-list_devices", "true", "-f", cameraFormat(), "-i", "dummy")
+	cmd.Env = childProcessEnv()
+	output, _ := cmd.CombinedOutput()
+	if cameraFormat() == "avfoundation" {
+		return parseAVFoundationDevices(string(output)), nil
+	}
+	return parseDShowDevices(string(output)), nil
+}
+
+// listV4L2Devices 按设备号列出 V4L2 设备；同一个摄像头可能有多个节点（如元数据节点），都会列出
+func listV4L2Devices(sysDir string) ([]cameraDevice, error) {
+	entries, err := os.ReadDir(sysDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var devices []cameraDevice
+	for _, entry := range entries {
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "video"))
+		if err != nil || !strings.HasPrefix(entry.Name(), "video") {
+			continue
+		}
+		name, _ := os.ReadFile(filepath.Join(sysDir, entry.Name(), "name"))
+		devices = append(devices, cameraDevice{index: n, name: strings.TrimSpace(string(name)), input: "/dev/" + entry.Name()})
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].index < devices[j].index })
+	return devices, nil
+}
+
+var avFoundationDevice = regexp.MustCompile(`\] \[(\d+)\] (.+)$`)
+
+// parseAVFoundationDevices 解析 ffmpeg -f avfoundation -list_devices true 输出中的视频设备
+func parseAVFoundationDevices(output string) []cameraDevice {
+	var devices []cameraDevice
+	video := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.Contains(line, "AVFoundation video devices"):
+			video = true
+		case strings.Contains(line, "AVFoundation audio devices"):
+			video = false
+		case video:
+			if m := avFoundationDevice.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				devices = append(devices, cameraDevice{index: n, name: m[2], input: m[1]})
+			}
+		}
+	}
+	return devices
+}
+
+var dshowDevice = regexp.MustCompile(`\] +"([^"]+)"(?: \((video|audio|none)\))?`)
+
+// parseDShowDevices 解析 ffmpeg -f dshow -list_devices true 输出中的视频设备
+// 兼容新版（每行以 (video)/(audio) 标注类型）和旧版（分为 video devices、audio devices 两段）的格式
+func parseDShowDevices(output string) []cameraDevice {
+	var devices []cameraDevice
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.Contains(line, "DirectShow video devices"):
+			section = "video"
+			continue
+		case strings.Contains(line, "DirectShow audio devices"):
+			section = "audio"
+			continue
+		case strings.Contains(line, "Alternative name"):
+			continue
+		}
+		m := dshowDevice.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		kind := m[2]
+		if kind == "" {
+			kind = section
+		}
+		if kind == "video" {
+			devices = append(devices, cameraDevice{index: len(devices), name: m[1], input: "video=" + m[1]})
+		}
+	}
+	return devices
+}
+
+// resolveCamera 将 camera: 之后的部分解析为设备：数字为设备序号，其他为设备名称（Linux 上也可以是 /dev/videoN 路径）
+func resolveCamera(spec string) (cameraDevice, error) {
+	n, err := strconv.Atoi(spec)
+	isIndex := err == nil && n >= 0
+	switch cameraFormat() {
+	case "v4l2":
+		if isIndex {
+			device := cameraDevice{index: n, name: "/dev/video" + spec, input: "/dev/video" + spec}
+			if name, err := os.ReadFile(filepath.Join("/sys/class/video4linux", "video"+spec, "name")); err == nil {
+				device.name = fmt.Sprintf("%s（%s）", strings.TrimSpace(string(name)), device.input)
+			}
+			return device, nil
+		}
+		return cameraDevice{index: -1, name: spec, input: spec}, nil
+	case "avfoundation":
+		return cameraDevice{index: n, name: spec, input: spec}, nil
+	}
+	// dshow 只能按名称打开设备，序号需要先列出设备
+	if !isIndex {
+		return cameraDevice{index: -1, name: spec, input: "video=" + spec}, nil
+	}
+	devices, err := listCameras()
+	if err != nil {
+		return cameraDevice{}, err
+	}
+	if n >= len(devices) {
+		return cameraDevice{}, fmt.Errorf("%w: camera:%d（共有 %d 个摄像头）", ErrCameraNotFound, n, len(devices))
+	}
+	return devices[n], nil
+}
+
+// cameraInputArgs 打开摄像头的 ffmpeg 输入参数（-i 之前）
+func cameraInputArgs() []string {
+	args := []string{"-f", cameraFormat()}
+	if *cameraSize != "" {
+		args = append(args, "-video_size", *cameraSize)
+	}
+	if cameraFormat() == "avfoundation" {
+		args = append(args, "-framerate", "30") // avfoundation 的默认帧率 29.97 多数摄像头不支持
+	}
+	return args
+}
+
+// cameraError 将 ffmpeg 打开设备失败的输出转换为易懂的错误
+func cameraError(device cameraDevice, err error) error {
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "busy") || strings.Contains(message, "already in use") || strings.Contains(message, "could not run graph"):
+		return fmt.Errorf("%w: %s，请关闭正在使用摄像头的程序后重试", ErrCameraBusy, device.name)
+	case strings.Contains(message, "permission denied") || strings.Contains(message, "not authorized"):
+		hint := "请检查系统的摄像头访问权限"
+		if cameraFormat() == "v4l2" {
+			hint = "请将当前用户加入 video 组"
+		}
+		return fmt.Errorf("%w: %s，%s", ErrCameraPermission, device.name, hint)
+	case strings.Contains(message, "no such file") || strings.Contains(message, "not found") ||
+		strings.Contains(message, "invalid device index") || strings.Contains(message, "could not find video device"):
+		return fmt.Errorf("%w: %s（用 -img camera:list 列出可用的摄像头）", ErrCameraNotFound, device.name)
+	}
+	return fmt.Errorf("打开摄像头 %s 失败: %w", device.name, err)
+}
+
+// validateCameraSize 校验 -camera-size 的格式（宽x高）
+func validateCameraSize() error {
+	if *cameraSize == "" {
+		return nil
+	}
+	w, h, ok := strings.Cut(*cameraSize, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return fmt.Errorf("-camera-size 格式应为 宽x高（如 1280x720）: %s", *cameraSize)
+	}
+	return nil
+}
+
+// printCameras 输出本机的摄像头列表（-img camera:list）
+func printCameras() error {
+	devices, err := listCameras()
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Printf("没有找到摄像头\n")
+		return nil
+	}
+	fmt.Printf("可用的摄像头（%s）:\n", cameraFormat())
+	for _, d := range devices {
+		fmt.Printf("  camera:%d\t%s\t%s\n", d.index, d.name, d.input)
+	}
+	return nil
+}
+
+// cameraSource 读取摄像头的帧，设备断开或 ffmpeg 退出时结束
+type cameraSource struct {
+	reader *videoFrameReader
+	frames int
+}
+
+func (s *cameraSource) Next() (videoFrame, error) {
+	frame, err := s.reader.Next()
+	if err != nil {
+		return frame, err
+	}
+	frame.index = s.frames
+	frame.timed = false
+	s.frames++
+	return frame, nil
+}
+
+// rollingSummary 摄像头模式下每隔 -progress-interval 输出一次最近一段时间的检测汇总
+type rollingSummary struct {
+	mutex    sync.Mutex
+	start    time.Time
+	frames   int
+	failures int
+	dropped  int // 自适应丢帧丢弃的帧数
+	counts   map[string]int
+}
+
+func newRollingSummary() *rollingSummary {
+	return &rollingSummary{start: time.Now(), counts: make(map[string]int)}
+}
+
+func (r *rollingSummary) add(result DetectionResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.frames++
+	if result.Error != nil {
+		r.failures++
+		return
+	}
+	for _, box := range result.Objects {
+		r.counts[box.label]++
+	}
+}
+
+// drop 记录一帧自适应丢帧丢弃的帧
+func (r *rollingSummary) drop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.dropped++
+}
+
+// flush 返回自上次输出以来的汇总并重新计数
+func (r *rollingSummary) flush(now time.Time) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	elapsed := now.Sub(r.start)
+	line := fmt.Sprintf("最近 %v: %d 帧（%.1f fps）", elapsed.Round(time.Second), r.frames, float64(r.frames)/elapsed.Seconds())
+	if r.failures > 0 {
+		line += fmt.Sprintf("，失败 %d", r.failures)
+	}
+	if r.dropped > 0 {
+		line += fmt.Sprintf("，丢弃旧帧 %d", r.dropped)
+	}
+	if len(r.counts) == 0 {
+		line += "，未检测到对象"
+	} else {
+		parts := make([]string, 0, len(r.counts))
+		for _, label := range sortedLabels(r.counts) {
+			parts = append(parts, fmt.Sprintf("%s×%d", label, r.counts[label]))
+		}
+		line += "，" + strings.Join(parts, " ")
+	}
+	r.start, r.frames, r.failures, r.dropped = now, 0, 0, 0
+	r.counts = make(map[string]int)
+	return line
+}
+
+// ProcessCamera 持续检测本地摄像头的帧（按 -stream-fps 限制帧率），每隔 -progress-interval 输出检测汇总，
+// -save-video 时将标注帧保存为 mp4；收到中断信号后停止采集，处理完已采集的帧后返回
+func ProcessCamera(spec, outputDir string) (err error) {
+	if err := validateStreamOptions(); err != nil {
+		return err
+	}
+	if err := validateCameraSize(); err != nil {
+		return err
+	}
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	device, err := resolveCamera(strings.TrimPrefix(spec, cameraPrefix))
+	if err != nil {
+		return err
+	}
+
+	ctx, release := interruptibleContext()
+	defer release()
+	inputArgs := cameraInputArgs()
+	info, err := probeVideo(ctx, device.input, inputArgs...)
+	if err != nil {
+		return cameraError(device, err)
+	}
+	var outputArgs []string
+	if *streamFPS > 0 {
+		outputArgs = append(outputArgs, "-vf", "fps="+strconv.FormatFloat(*streamFPS, 'f', -1, 64))
+		if info.fps <= 0 || *streamFPS < info.fps {
+			info.fps = *streamFPS
+		}
+	}
+	reader, err := startFrameReader(ctx, device.input, info, inputArgs, outputArgs)
+	if err != nil {
+		return err
+	}
+	reader.stride = max(1, *vidStride)
+	reader.readTimeout = *streamTimeout
+	defer reader.Close()
+	fmt.Printf("已打开摄像头 %s: %dx%d，检测 %.1f fps，按 Ctrl+C 停止\n", device.name, info.width, info.height, info.fps/float64(reader.stride))
+
+	var writer *videoWriter
+	if *saveVideo {
+		if isS3Path(outputDir) {
+			outputDir = "./assets" // 与视频文件输入相同，标注视频只保存在本地
+		}
+		outputPath := filepath.Join(outputDir, sanitizeFileName(fmt.Sprintf("camera%s_%s.mp4", strings.TrimPrefix(spec, cameraPrefix), time.Now().Format("20060102_150405")), *nameReplacement))
+		if writer, err = newVideoWriter(outputPath, "", info, reader.stride, 0, 0); err != nil {
+			return fmt.Errorf("创建标注视频失败: %w", err)
+		}
+		defer func() {
+			if closeErr := writer.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("保存标注视频失败: %w", closeErr))
+			} else {
+				fmt.Printf("标注视频已保存至 %s（%d 帧）\n", outputPath, writer.frames)
+			}
+		}()
+	}
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+
+	// 汇总由单独的协程定时输出，采集和检测不等待终端输出
+	summary := newRollingSummary()
+	done := make(chan struct{})
+	defer close(done)
+	interval := *progressInterval // 在启动协程前读取，ProcessCamera 返回后协程可能还在运行
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				fmt.Printf("%s\n", summary.flush(now))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var frames frameSource = &cameraSource{reader: reader}
+	var latest *latestFrameSource
+	if *adaptiveDrop > 0 {
+		latest = newLatestFrameSource(frames, manager, *adaptiveDrop, summary.drop)
+		frames = latest
+	}
+	start := time.Now()
+	stats, readErr := detectFrames(ctx, manager, "camera:"+device.name, frames, writer, nil, summary.add)
+	wall := time.Since(start)
+	line := fmt.Sprintf("摄像头采集结束: %s，共检测到 %d 个对象", stats.summary(wall), stats.objects)
+	if latest != nil {
+		latest.Close() // 读取协程退出后才能关闭 reader
+		line += fmt.Sprintf("，自适应丢帧 %d 帧", latest.Dropped())
+	}
+	fmt.Printf("%s\n", line)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if readErr != nil {
+		return cameraError(device, readErr)
+	}
+	if closeErr := reader.Close(); closeErr != nil {
+		return cameraError(device, closeErr)
+	}
+	return fmt.Errorf("摄像头 %s 已断开", device.name)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListV4L2Devices(t *testing.T) {
+	dir := t.TempDir()
+	// 同一个 USB 摄像头的视频节点和元数据节点，以及没有 name 文件、不是视频设备的节点
+	nodes := map[string]string{
+		"video2":  "USB Camera: Metadata\n",
+		"video0":  "Integrated Camera\n",
+		"video10": "",
+		"vbi0":    "VBI\n",
+		"videoX":  "",
+	}
+	for node, name := range nodes {
+		if err := os.Mkdir(filepath.Join(dir, node), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if name != "" {
+			if err := os.WriteFile(filepath.Join(dir, node, "name"), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	devices, err := listV4L2Devices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []cameraDevice{
+		{index: 0, name: "Integrated Camera", input: "/dev/video0"},
+		{index: 2, name: "USB Camera: Metadata", input: "/dev/video2"},
+		{index: 10, name: "", input: "/dev/video10"},
+	}
+	if !slices.Equal(devices, want) {
+		t.Errorf("listV4L2Devices() = %+v，期望 %+v", devices, want)
+	}
+
+	// 没有 video4linux 目录（没有摄像头驱动、容器中）时不是错误
+	devices, err = listV4L2Devices(filepath.Join(dir, "missing"))
+	if devices != nil || err != nil {
+		t.Errorf("目录不存在时 listV4L2Devices() = %v, %v，期望 nil, nil", devices, err)
+	}
+}
+
+func TestParseAVFoundationDevices(t *testing.T) {
+	output := strings.Join([]string{
+		"[AVFoundation indev @ 0x7f8b4c004a00] AVFoundation video devices:",
+		"[AVFoundation indev @ 0x7f8b4c004a00] [0] FaceTime HD Camera",
+		"[AVFoundation indev @ 0x7f8b4c004a00] [1] OBS Virtual Camera\r",
+		"[AVFoundation indev @ 0x7f8b4c004a00] [2] Capture screen 0",
+		"[AVFoundation indev @ 0x7f8b4c004a00] AVFoundation audio devices:",
+		"[AVFoundation indev @ 0x7f8b4c004a00] [0] MacBook Pro Microphone",
+		"dummy: Input/output error",
+	}, "\n")
+	want := []cameraDevice{
+		{index: 0, name: "FaceTime HD Camera", input: "0"},
+		{index: 1, name: "OBS Virtual Camera", input: "1"},
+		{index: 2, name: "Capture screen 0", input: "2"},
+	}
+	if got := parseAVFoundationDevices(output); !slices.Equal(got, want) {
+		t.Errorf("parseAVFoundationDevices() = %+v，期望 %+v", got, want)
+	}
+	if got := parseAVFoundationDevices("dummy: Input/output error\n"); got != nil {
+		t.Errorf("没有设备时 parseAVFoundationDevices() = %+v", got)
+	}
+}
+
+func TestParseDShowDevices(t *testing.T) {
+	want := []cameraDevice{
+		{index: 0, name: "Integrated Webcam", input: "video=Integrated Webcam"},
+		{index: 1, name: "OBS Virtual Camera", input: "video=OBS Virtual Camera"},
+	}
+	tests := []struct {
+		name   string
+		output []string
+	}{
+		{"新版格式", []string{
+			`[dshow @ 000001f0c1a2b3c0] "Integrated Webcam" (video)`,
+			`[dshow @ 000001f0c1a2b3c0]   Alternative name "@device_pnp_\\?\usb#vid_0bda&pid_5652"`,
+			`[dshow @ 000001f0c1a2b3c0] "Microphone Array (Realtek Audio)" (audio)`,
+			`[dshow @ 000001f0c1a2b3c0]   Alternative name "@device_cm_{33D9A762-90C8-11D0-BD43-00A0C911CE86}\wave_{6F8B}"`,
+			`[dshow @ 000001f0c1a2b3c0] "OBS Virtual Camera" (video)`,
+			`[dshow @ 000001f0c1a2b3c0]   Alternative name "@device_sw_{860BB310-5D01-11D0-BD3B-00A0C911CE86}\{A3FCE0F5}"`,
+			`dummy: Immediate exit requested`,
+		}},
+		{"旧版格式", []string{
+			`[dshow @ 0000000000d4e5f0] DirectShow video devices (some may be both video and audio devices)`,
+			`[dshow @ 0000000000d4e5f0]  "Integrated Webcam"`,
+			`[dshow @ 0000000000d4e5f0]     Alternative name "@device_pnp_\\?\usb#vid_0bda&pid_5652"`,
+			`[dshow @ 0000000000d4e5f0]  "OBS Virtual Camera"`,
+			`[dshow @ 0000000000d4e5f0] DirectShow audio devices`,
+			`[dshow @ 0000000000d4e5f0]  "Microphone Array (Realtek Audio)"`,
+			`dummy: Immediate exit requested`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Windows 上的 ffmpeg 输出以 \r\n 换行
+			output := strings.Join(tt.output, "\r\n")
+			if got := parseDShowDevices(output); !slices.Equal(got, want) {
+				t.Errorf("parseDShowDevices() = %+v，期望 %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCameraError(t *testing.T) {
+	device := cameraDevice{index: 0, name: "Integrated Camera（/dev/video0）", input: "/dev/video0"}
+	tests := []struct {
+		name   string
+		output string // ffmpeg 打开设备失败时的错误输出
+		want   error
+	}{
+		{"v4l2 设备被占用", "[video4linux2,v4l2 @ 0x55d0] ioctl(VIDIOC_STREAMON): Device or resource busy", ErrCameraBusy},
+		{"avfoundation 设备被占用", "Camera is already in use by another application", ErrCameraBusy},
+		{"dshow 设备被占用", "[dshow @ 000001f0c1a2b3c0] Could not run graph (sometimes caused by a device already in use by other application)", ErrCameraBusy},
+		{"v4l2 没有权限", "/dev/video0: Permission denied", ErrCameraPermission},
+		{"macOS 没有授权", "Failed to create AV capture input device: Not authorized to access camera", ErrCameraPermission},
+		{"v4l2 设备不存在", "/dev/video9: No such file or directory", ErrCameraNotFound},
+		{"avfoundation 序号无效", "Invalid device index", ErrCameraNotFound},
+		{"dshow 名称不存在", `[dshow @ 000001f0c1a2b3c0] Could not find video device with name [Front Camera] among source devices of type video.`, ErrCameraNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cameraError(device, errors.New("ffprobe 执行失败: exit status 1: "+tt.output))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("cameraError() = %v，期望 %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), device.name) {
+				t.Errorf("cameraError() = %v，没有设备名称", err)
+			}
+		})
+	}
+
+	t.Run("其他错误", func(t *testing.T) {
+		cause := errors.New("ffmpeg 执行失败: exit status 1: Invalid argument")
+		err := cameraError(device, cause)
+		if !errors.Is(err, cause) || errors.Is(err, ErrCameraBusy) || errors.Is(err, ErrCameraPermission) || errors.Is(err, ErrCameraNotFound) {
+			t.Errorf("cameraError() = %v，期望原样包装 %v", err, cause)
+		}
+	})
+}
+
+func TestValidateCameraSize(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		size    string
+		wantErr bool
+	}{
+		{"", false},
+		{"1280x720", false},
+		{"640x480", false},
+		{"1280", true},
+		{"1280*720", true},
+		{"0x720", true},
+		{"1280x-1", true},
+		{"widexhigh", true},
+	}
+	for _, tt := range tests {
+		config.CameraSize = tt.size
+		if err := validateCameraSize(); (err != nil) != tt.wantErr {
+			t.Errorf("-camera-size %q: validateCameraSize() = %v，期望出错 %v", tt.size, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProcessCamera(t *testing.T) {
+	if cameraFormat() != "v4l2" {
+		t.Skip("按设备号打开摄像头的测试只适用于 v4l2")
+	}
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeFFmpeg(t)
+	useFakeSessions(t)
+	config.CameraSize = "8x6"
+	config.Workers = 1
+	config.VidStride = 1
+	config.SaveVideo = false
+
+	t.Run("设备被占用", func(t *testing.T) {
+		failures := filepath.Join(t.TempDir(), "failures")
+		if err := os.WriteFile(failures, []byte("1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("FAKE_FFPROBE_FAILURES", failures)
+		t.Setenv("FAKE_FFPROBE_ERROR", "/dev/video7: Device or resource busy")
+		err := ProcessCamera("camera:7", t.TempDir())
+		if !errors.Is(err, ErrCameraBusy) || !strings.Contains(err.Error(), "/dev/video7") {
+			t.Errorf("ProcessCamera() = %v，期望 %v", err, ErrCameraBusy)
+		}
+	})
+
+	t.Run("设备断开", func(t *testing.T) {
+		args := fakeFFmpegArgs(t)
+		err := ProcessCamera("camera:7", t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "已断开") {
+			t.Errorf("ffmpeg 正常退出时 ProcessCamera() = %v，期望摄像头已断开", err)
+		}
+		got := args()
+		want := []string{"-f", "v4l2", "-video_size", "8x6", "-i", "/dev/video7"}
+		if i := slices.Index(got, "-f"); i < 0 || !slices.Equal(got[i:i+len(want)], want) {
+			t.Errorf("ffmpeg 参数 = %q，期望包含 %q", got, want)
+		}
+	})
+
+	t.Run("读取中出错", func(t *testing.T) {
+		t.Setenv("FAKE_FFMPEG_KILL", "1")
+		err := ProcessCamera("camera:7", t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), "Connection reset by peer") {
+			t.Errorf("ffmpeg 出错时 ProcessCamera() = %v，期望包含 ffmpeg 的错误输出", err)
+		}
+	})
+}
+
+func TestCameraSourceRenumbersFrames(t *testing.T) {
+	useFakeFFmpeg(t)
+	reader, err := openVideo(t.Context(), "/dev/video0", 0, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	// 跳帧后帧序号仍从 0 连续编号，摄像头的帧没有时间戳
+	s := &cameraSource{reader: reader}
+	for i := range (fakeVideoFrames + 1) / 2 {
+		frame, err := s.Next()
+		if err != nil {
+			t.Fatalf("第 %d 帧: %v", i, err)
+		}
+		if frame.index != i || frame.timed {
+			t.Errorf("第 %d 帧序号 = %d，有时间戳 %v，期望序号 %d 且没有时间戳", i, frame.index, frame.timed, i)
+		}
+		if want := fakeFramePixel(2 * i); [3]byte(frame.image.Pix[:3]) != want {
+			t.Errorf("第 %d 帧的像素 = %v，期望源第 %d 帧 %v", i, frame.image.Pix[:3], 2*i, want)
+		}
+		PutImageToPool(frame.image)
+	}
+}
+
+func TestRollingSummary(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := newRollingSummary()
+	r.start = start
+
+	var person, car, failed DetectionResult
+	person.Objects = []boundingBox{{label: "person"}, {label: "person"}}
+	car.Objects = []boundingBox{{label: "car"}}
+	failed.Error = errors.New("推理失败")
+	for _, result := range []DetectionResult{person, car, failed, person} {
+		r.add(result)
+	}
+	r.drop()
+	if got, want := r.flush(start.Add(2*time.Second)), "最近 2s: 4 帧（2.0 fps），失败 1，丢弃旧帧 1，car×1 person×4"; got != want {
+		t.Errorf("flush() = %q，期望 %q", got, want)
+	}
+
+	// 输出后重新计数
+	if got, want := r.flush(start.Add(12*time.Second)), "最近 10s: 0 帧（0.0 fps），未检测到对象"; got != want {
+		t.Errorf("再次 flush() = %q，期望 %q", got, want)
+	}
+}
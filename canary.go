@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 金丝雀自检参数：长时间运行时定期用已知图像检查模型输出是否退化
+// 图像和期望结果与 selftest 子命令共用 -selftest-image 和 -selftest-expect
+var (
+	canaryInterval    = &config.CanaryInterval
+	canaryMaxFailures = &config.CanaryFailures
+)
+
+// canaryMonitor 金丝雀自检
+// 结果不进入摘要、告警规则和输出文件，只反映在管理器统计和就绪状态中
+type canaryMonitor struct {
+	manager *VideoDetectorManager
+	pic     image.Image
+	answer  knownAnswer
+
+	runs        int64 // 已执行次数，使用原子操作
+	failures    int64 // 失败次数，使用原子操作
+	skipped     int64 // 因工作繁忙跳过的次数，使用原子操作
+	consecutive int   // 连续失败次数，仅在自检协程中访问
+	ready       atomic.Bool
+
+	mutex     sync.Mutex
+	lastError string
+}
+
+// newCanaryMonitor 加载金丝雀图像和期望结果
+func newCanaryMonitor(manager *VideoDetectorManager) (*canaryMonitor, error) {
+	answer, err := loadKnownAnswer(*selftestExpect)
+	if err != nil {
+		return nil, err
+	}
+	pic, err := loadImageFile(*selftestImage)
+	if err != nil {
+		return nil, fmt.Errorf("加载金丝雀图像失败: %w", err)
+	}
+	canary := &canaryMonitor{manager: manager, pic: pic, answer: answer}
+	canary.ready.Store(true)
+	return canary, nil
+}
+
+// run 按 -canary-interval 周期执行自检，直到管理器关闭
+func (canary *canaryMonitor) run(interval time.Duration) {
+	defer canary.manager.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-canary.manager.shutdown:
+			return
+		case <-ticker.C:
+			canary.check()
+		}
+	}
+}
+
+// check 执行一次自检
+// 优先级最低：任务队列非空或没有空闲会话时跳过，不与正常任务争抢会话
+func (canary *canaryMonitor) check() {
+	pool := canary.manager.sessionPool
+	if _, idle := pool.GetStats(); idle == 0 || canary.manager.queuedTasks() > 0 {
+		atomic.AddInt64(&canary.skipped, 1)
+		return
+	}
+	session, err := pool.GetSession(context.Background())
+	if err != nil {
+		atomic.AddInt64(&canary.skipped, 1)
+		return
+	}
+	problems, err := canary.verify(session)
+	if errors.Is(err, ErrSessionRunFailed) {
+		pool.PutSessionFailed(session)
+	} else {
+		pool.PutSession(session)
+	}
+	canary.record(problems)
+}
+
+// verify 在 session 上检测金丝雀图像并与期望结果比对，返回所有不满足的项；推理失败时 err 同时作为唯一的一项返回
+// 使用 selftestConfig 而不是命令行检测参数，-classes、-max-det 等不影响比对
+func (canary *canaryMonitor) verify(session inferenceSession) ([]string, error) {
+	if err := session.acquire(); err != nil {
+		return []string{err.Error()}, err
+	}
+	defer session.release()
+	boxes, err := inferBoxes(context.Background(), session, canary.pic, selftestConfig())
+	if err != nil {
+		return []string{err.Error()}, err
+	}
+	return checkKnownAnswer(boxes, canary.answer), nil
+}
+
+// record 记录一次自检的结果，连续失败达到 -canary-failures 次时告警并标记为未就绪
+func (canary *canaryMonitor) record(problems []string) {
+	atomic.AddInt64(&canary.runs, 1)
+	if len(problems) == 0 {
+		canary.consecutive = 0
+		if !canary.ready.Swap(true) {
+			fmt.Printf("金丝雀自检恢复正常，检测器重新就绪\n")
+			writeLogFile("INFO", "金丝雀自检恢复正常，检测器重新就绪")
+		}
+		return
+	}
+
+	atomic.AddInt64(&canary.failures, 1)
+	canary.consecutive++
+	canary.mutex.Lock()
+	canary.lastError = strings.Join(problems, "; ")
+	canary.mutex.Unlock()
+	writeLogFile("WARN", "金丝雀自检失败: "+strings.Join(problems, "; "))
+
+	if canary.consecutive >= max(1, *canaryMaxFailures) && canary.ready.Swap(false) {
+		payload, _ := json.Marshal(map[string]any{
+			"time":        time.Now(),
+			"rule":        "canary",
+			"severity":    "critical",
+			"image_path":  *selftestImage,
+			"consecutive": canary.consecutive,
+			"problems":    problems,
+		})
+		fmt.Printf("告警[critical] 金丝雀自检连续失败 %d 次，检测器标记为未就绪: %s\n", canary.consecutive, strings.Join(problems, "; "))
+		writeLogFile("ALERT", string(payload))
+	}
+}
+
+// LastError 返回最近一次自检失败的原因
+func (canary *canaryMonitor) LastError() string {
+	canary.mutex.Lock()
+	defer canary.mutex.Unlock()
+	return canary.lastError
+}
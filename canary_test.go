@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestCanaryIgnoresDetectionFlags(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	// 两个 person 和一个 bus，置信度都低于下面的 -conf
+	output, layout := v8Output(COCOClasses(), []testAnchor{
+		{cx: 100, cy: 300, w: 80, h: 200, class: 0, conf: 0.8},
+		{cx: 300, cy: 300, w: 80, h: 200, class: 0, conf: 0.7},
+		{cx: 400, cy: 200, w: 300, h: 150, class: 5, conf: 0.9},
+	})
+	answer := knownAnswer{
+		MinConfidence: 0.5,
+		BoxTolerance:  2,
+		Classes: []expectedClass{
+			{Label: "person", MinCount: 2, Boxes: [][4]float32{{60, 200, 140, 400}}},
+			{Label: "bus", MinCount: 1, MaxCount: 1},
+		},
+	}
+
+	tests := []struct {
+		name string
+		set  func(c *DetectorConfig)
+	}{
+		{"默认参数", func(c *DetectorConfig) {}},
+		{"-classes car", func(c *DetectorConfig) { c.Classes = "car" }},
+		{"-exclude-classes person", func(c *DetectorConfig) { c.ExcludeClasses = "person" }},
+		{"-max-det 1", func(c *DetectorConfig) { c.MaxDet = 1 }},
+		{"-conf 0.95", func(c *DetectorConfig) { c.ConfThreshold = 0.95 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = DefaultDetectorConfig()
+			config.CanaryFailures = 1
+			tt.set(&config)
+
+			canary := &canaryMonitor{pic: inputImage(), answer: answer}
+			canary.ready.Store(true)
+			for i := 0; i < 3; i++ {
+				problems, err := canary.verify(newFakeSession(output, layout))
+				if err != nil {
+					t.Fatal(err)
+				}
+				canary.record(problems)
+			}
+			if !canary.ready.Load() || canary.failures != 0 {
+				t.Errorf("金丝雀自检失败 %d 次: %s", canary.failures, canary.LastError())
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 正在进行的批量处理的取消函数：第一次收到 SIGINT/SIGTERM 时只取消批量处理，
+// 已完成部分的汇总照常输出，结果输出在正常退出时刷新
+var (
+	interruptMutex  sync.Mutex
+	interruptCancel context.CancelFunc
+)
+
+// interruptibleContext 返回收到中断信号时被取消的上下文，处理结束后调用 release 注销
+func interruptibleContext() (ctx context.Context, release func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	interruptMutex.Lock()
+	interruptCancel = cancel
+	interruptMutex.Unlock()
+	return ctx, func() {
+		interruptMutex.Lock()
+		interruptCancel = nil
+		interruptMutex.Unlock()
+		cancel()
+	}
+}
+
+// cancelInterruptible 取消正在进行的批量处理，没有正在进行的批量处理时返回 false
+func cancelInterruptible() bool {
+	interruptMutex.Lock()
+	defer interruptMutex.Unlock()
+	if interruptCancel == nil {
+		return false
+	}
+	interruptCancel()
+	interruptCancel = nil
+	return true
+}
+
+// canceledSummary 统计取消前已处理和未处理的图像数
+func canceledSummary(results []DetectionResult) string {
+	canceled := 0
+	for _, result := range results {
+		if errors.Is(result.Error, context.Canceled) {
+			canceled++
+		}
+	}
+	return fmt.Sprintf("共 %d 个图像，已处理 %d 个，未处理 %d 个", len(results), len(results)-canceled, canceled)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 类别过滤参数
+var (
+	includeClasses = &config.Classes
+	excludeClasses = &config.ExcludeClasses
+)
+
+// classFilter NMS 之后的类别过滤：只保留 include 中的类别（为空表示全部），再去掉 exclude 中的类别
+type classFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// 已解析的过滤器缓存，参数不变时不重复解析
+var (
+	classFilterMutex  sync.Mutex
+	classFilterKey    string
+	classFilterCached *classFilter
+)
+
+// parseClassFilter 解析 -classes 和 -exclude-classes（逗号分隔的类别名、中文名或类别ID）
+// 两者都为空时返回 nil，表示不过滤
+func parseClassFilter(include, exclude string) (*classFilter, error) {
+	in, err := parseClassList(include)
+	if err != nil {
+		return nil, fmt.Errorf("解析 -classes 失败: %w", err)
+	}
+	ex, err := parseClassList(exclude)
+	if err != nil {
+		return nil, fmt.Errorf("解析 -exclude-classes 失败: %w", err)
+	}
+	if len(in) == 0 && len(ex) == 0 {
+		return nil, nil
+	}
+	return &classFilter{include: in, exclude: ex}, nil
+}
+
+// parseClassList 将类别列表解析为标签集合，类别ID按当前模型的类别名称转换为标签
+func parseClassList(list string) (map[string]bool, error) {
+	labels := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		label, err := resolveClassName(item)
+		if err != nil {
+			return nil, err
+		}
+		labels[label] = true
+	}
+	return labels, nil
+}
+
+// resolveClassName 将类别ID、英文标签或中文标签解析为内部使用的英文标签
+func resolveClassName(name string) (string, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		if id < 0 {
+			return "", fmt.Errorf("无效的类别ID %d", id)
+		}
+		return Label(id), nil
+	}
+	if id, ok := ClassID(name); ok {
+		return Label(id), nil
+	}
+	if lower := strings.ToLower(name); strings.HasPrefix(lower, "class_") {
+		return lower, nil
+	}
+	return "", fmt.Errorf("未知的类别 %q（可使用类别ID或以下名称: %s）", name, strings.Join(ClassNames(), ", "))
+}
+
+// activeClassFilter 返回当前配置对应的过滤器，参数无效时不过滤（命令行程序在启动时已校验）
+func activeClassFilter() *classFilter {
+	// 类别名称随模型变化（自定义模型、热加载）时需要重新解析
+	key := fmt.Sprintf("%s|%s|%d", *includeClasses, *excludeClasses, currentClassNamesVersion())
+	classFilterMutex.Lock()
+	defer classFilterMutex.Unlock()
+	if key != classFilterKey {
+		filter, err := parseClassFilter(*includeClasses, *excludeClasses)
+		if err != nil {
+			writeLogFile("ERROR", err.Error())
+		}
+		classFilterKey, classFilterCached = key, filter
+	}
+	return classFilterCached
+}
+
+// allows 判断该类别是否保留
+func (f *classFilter) allows(label string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.include) > 0 && !f.include[label] {
+		return false
+	}
+	return !f.exclude[label]
+}
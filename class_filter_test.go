@@ -0,0 +1,112 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+// v8Output 按 YOLOv8/11 的 [通道][锚点] 排布生成输出张量，每个锚点为 (cx, cy, w, h, 各类别置信度)
+func v8Output(classNames []string, anchors []testAnchor) ([]float32, outputLayout) {
+	layout := outputLayout{Format: formatV8, NumChannels: 4 + len(classNames), NumAnchors: len(anchors), ClassNames: classNames}
+	output := make([]float32, layout.NumChannels*layout.NumAnchors)
+	for i, a := range anchors {
+		output[0*len(anchors)+i] = a.cx
+		output[1*len(anchors)+i] = a.cy
+		output[2*len(anchors)+i] = a.w
+		output[3*len(anchors)+i] = a.h
+		output[(4+a.class)*len(anchors)+i] = a.conf
+	}
+	return output, layout
+}
+
+type testAnchor struct {
+	cx, cy, w, h float32
+	class        int
+	conf         float32
+}
+
+// identityScale 输入尺寸与原图相同、没有填充
+var identityScale = ScaleInfo{ScaleX: 1, ScaleY: 1}
+
+func TestProcessOutputFiltersClassesBeforeMaxDet(t *testing.T) {
+	classNames := []string{"person", "car"}
+	var anchors []testAnchor
+	// 300 个互不重叠的高置信度 car，排在所有 person 之前
+	for i := 0; i < 300; i++ {
+		anchors = append(anchors, testAnchor{cx: float32(i%20)*50 + 10, cy: float32(i/20)*50 + 10, w: 10, h: 10, class: 1, conf: 0.9})
+	}
+	// 5 个置信度较低的 person
+	for i := 0; i < 5; i++ {
+		anchors = append(anchors, testAnchor{cx: float32(i)*50 + 10, cy: 900, w: 10, h: 10, class: 0, conf: 0.5})
+	}
+	output, layout := v8Output(classNames, anchors)
+	persons, err := parseClassFilter("person", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boxes := processOutput(output, layout, 1000, 1000, 0.25, 0.45, 300, persons, identityScale)
+	if len(boxes) != 5 {
+		t.Fatalf("保留了 %d 个框，期望 5 个 person（被过滤的 car 不应占用 -max-det 名额）", len(boxes))
+	}
+	for _, box := range boxes {
+		if box.label != "person" {
+			t.Errorf("保留了被过滤的类别 %s", box.label)
+		}
+	}
+
+	// 不过滤时仍按 maxDet 截断
+	if all := processOutput(output, layout, 1000, 1000, 0.25, 0.45, 300, nil, identityScale); len(all) != 300 {
+		t.Errorf("不过滤时保留了 %d 个框，期望 300", len(all))
+	}
+}
+
+func TestProcessEndToEndOutputFiltersClasses(t *testing.T) {
+	layout := outputLayout{Format: formatE2E, NumChannels: 6, NumAnchors: 3, ClassNames: []string{"person", "car"}}
+	output := []float32{
+		0, 0, 10, 10, 0.9, 1,
+		20, 20, 30, 30, 0.8, 1,
+		40, 40, 50, 50, 0.7, 0,
+	}
+	persons, err := parseClassFilter("person", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := processEndToEndOutput(output, layout, 100, 100, 0.25, 1, persons, identityScale)
+	if len(boxes) != 1 || boxes[0].label != "person" {
+		t.Errorf("结果 = %+v，期望只保留 1 个 person（maxDet=1 的名额不被 car 占用）", boxes)
+	}
+}
+
+// BenchmarkAnnotateMaxDet 在 conf=0.01 下解码一帧密集输出（8400 个锚点、80 个类别）并绘制，比较不限制与 -max-det 300 的耗时
+func BenchmarkAnnotateMaxDet(b *testing.B) {
+	classNames := COCOClasses()
+	anchors := make([]testAnchor, 8400)
+	for i := range anchors {
+		anchors[i] = testAnchor{
+			cx: float32(i%80)*8 + 4, cy: float32(i/80)*6 + 4, w: 12, h: 12,
+			class: i % len(classNames), conf: 0.02 + float32(i%50)/100,
+		}
+	}
+	output, layout := v8Output(classNames, anchors)
+	img := image.NewRGBA(image.Rect(0, 0, 640, 640))
+
+	benchmarks := []struct {
+		name   string
+		maxDet int
+	}{
+		{"unlimited", 0},
+		{"max-det-300", 300},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			var boxes int
+			for b.Loop() {
+				detections := processOutput(output, layout, 640, 640, 0.01, 0.7, bm.maxDet, nil, identityScale)
+				Annotate(img, detections)
+				boxes = len(detections)
+			}
+			b.ReportMetric(float64(boxes), "boxes")
+		})
+	}
+}
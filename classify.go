@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// 分类模式参数
+var (
+	classifyTopK       = &config.ClassifyTopK
+	classifyOutputPath = &config.ClassifyOut
+)
+
+// ClassPrediction 分类模型的单个预测结果
+type ClassPrediction struct {
+	ClassID     int     `json:"class_id"`
+	Label       string  `json:"label"`
+	Probability float32 `json:"probability"`
+}
+
+// ultralyticsNamesPattern 匹配 Ultralytics 模型元数据中的 names 字典项，如 {0: 'tench', 1: "goldfish"}
+var ultralyticsNamesPattern = regexp.MustCompile(`(\d+)\s*:\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")`)
+
+// parseClassNames 解析模型元数据中的类别名称字典
+func parseClassNames(names string) []string {
+	matches := ultralyticsNamesPattern.FindAllStringSubmatch(names, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	byID := make(map[int]string, len(matches))
+	maxID := -1
+	for _, m := range matches {
+		id, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		byID[id] = m[2] + m[3]
+		maxID = max(maxID, id)
+	}
+	result := make([]string, maxID+1)
+	for i := range result {
+		if name, ok := byID[i]; ok {
+			result[i] = name
+		} else {
+			result[i] = "class_" + strconv.Itoa(i)
+		}
+	}
+	return result
+}
+
+// resizeWithCrop 中心裁剪缩放：按短边缩放到目标尺寸后裁掉长边两侧超出的部分
+// 裁剪在 ScaleInfo 中表示为负的填充偏移，因此坐标映射公式与 letterbox 相同
+func resizeWithCrop(img image.Image, targetSize int) (*image.RGBA, ScaleInfo) {
+	bounds := img.Bounds()
+	originalWidth, originalHeight := bounds.Dx(), bounds.Dy()
+
+	scale := math.Max(float64(targetSize)/float64(originalWidth), float64(targetSize)/float64(originalHeight))
+	newWidth := int(math.Round(float64(originalWidth) * scale))
+	newHeight := int(math.Round(float64(originalHeight) * scale))
+
+	resized := resize.Resize(uint(newWidth), uint(newHeight), img, resize.Bilinear)
+
+	// 从对象池获取指定尺寸的图像（随后整幅覆盖，不需要清零）
+	result := getImageUncleared(targetSize, targetSize)
+
+	offsetX := (targetSize - newWidth) / 2
+	offsetY := (targetSize - newHeight) / 2
+	draw.Draw(result, result.Bounds(), resized, image.Pt(-offsetX, -offsetY), draw.Src)
+
+	return result, ScaleInfo{ScaleX: float32(scale), ScaleY: float32(scale), PadLeft: offsetX, PadTop: offsetY,
+		NewWidth: newWidth, NewHeight: newHeight}
+}
+
+// processClassOutput 解析分类模型输出，返回概率最高的前 k 个类别
+// 输出未经过 softmax（存在负值或总和不为 1）时先做 softmax
+func processClassOutput(output []float32, layout outputLayout, k int) []ClassPrediction {
+	numClasses := min(layout.NumChannels, len(output))
+	probs := make([]float32, numClasses)
+	copy(probs, output[:numClasses])
+
+	var sum float32
+	needSoftmax := false
+	for _, p := range probs {
+		if p < 0 {
+			needSoftmax = true
+		}
+		sum += p
+	}
+	if needSoftmax || math.Abs(float64(sum-1)) > 0.01 {
+		softmax(probs)
+	}
+
+	predictions := make([]ClassPrediction, numClasses)
+	for i, p := range probs {
+		predictions[i] = ClassPrediction{ClassID: i, Label: layout.classLabel(i), Probability: p}
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		return predictions[i].Probability > predictions[j].Probability
+	})
+	if k > 0 && k < len(predictions) {
+		predictions = predictions[:k]
+	}
+	return predictions
+}
+
+// softmax 原地计算 softmax
+func softmax(values []float32) {
+	maxVal := float32(math.Inf(-1))
+	for _, v := range values {
+		if v > maxVal {
+			maxVal = v
+		}
+	}
+	var sum float64
+	for i, v := range values {
+		e := math.Exp(float64(v - maxVal))
+		values[i] = float32(e)
+		sum += e
+	}
+	for i := range values {
+		values[i] = float32(float64(values[i]) / sum)
+	}
+}
+
+// runClassification 使用工作协程池并发分类所有图像，并写入 CSV/JSON 结果文件
+func runClassification(imagePaths []string) error {
+	fmt.Printf("分类模式: %d 个图像，工作协程: %d，输出: %s\n", len(imagePaths), *workerCount, *classifyOutputPath)
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+
+	ctx, release := interruptibleContext()
+	defer release()
+	results := make([]DetectionResult, len(imagePaths))
+	progress := newCLIProgress()
+	start := time.Now()
+	manager.ProcessImageBatchProgress(ctx, imagePaths, progress.Func(), func(i int, result DetectionResult) {
+		results[i] = result
+	})
+	wall := time.Since(start)
+	progress.Finish()
+
+	completed := make([]DetectionResult, 0, len(results))
+	failures := 0
+	for _, result := range results {
+		if errors.Is(result.Error, context.Canceled) {
+			continue // 取消时未处理的图像不写入结果
+		}
+		completed = append(completed, result)
+		outcome.record(result, nil)
+		resultSinks.WriteResult(result)
+		if result.Error != nil {
+			failures++
+			fmt.Printf("处理图像 %s 时出错: %v\n", result.ImagePath, result.Error)
+			continue
+		}
+		fmt.Printf("图像 %s 分类结果: %s\n", result.ImagePath, result.Summary)
+	}
+
+	if err := writeClassificationResults(*classifyOutputPath, completed); err != nil {
+		return err
+	}
+	fmt.Printf("分类结果已保存至: %s\n", *classifyOutputPath)
+	fmt.Printf("分类完成: %s\n", batchSummary(completed, wall, failures))
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("分类已取消: %s", canceledSummary(results))
+	}
+	return nil
+}
+
+// writeClassificationResults 根据扩展名将分类结果写入 CSV 或 JSON 文件
+func writeClassificationResults(path string, results []DetectionResult) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建输出目录失败: %w", err)
+		}
+	}
+	file, err := os.Create(longPath(path))
+	if err != nil {
+		return fmt.Errorf("创建分类结果文件失败: %w", err)
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		records := make([]ResultRecord, len(results))
+		for i, result := range results {
+			records[i] = newResultRecord(result)
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(records); err != nil {
+			return fmt.Errorf("写入分类结果失败: %w", err)
+		}
+		return nil
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"image_path", "rank", "class_id", "label", "probability", "error"})
+	for _, result := range results {
+		if result.Error != nil {
+			writer.Write([]string{result.ImagePath, "", "", "", "", result.Error.Error()})
+			continue
+		}
+		for rank, p := range result.Classifications {
+			writer.Write([]string{result.ImagePath, strconv.Itoa(rank + 1), strconv.Itoa(p.ClassID), p.Label,
+				formatConfidence(p.Probability), ""})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("写入分类结果失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// COCO 结果导出参数
+var (
+	cocoOut         = &config.COCOOut
+	cocoAnnotations = &config.COCOAnnotations
+	cocoCategoryMap = &config.COCOCategoryMap
+)
+
+// coco80To91 COCO 80 类（YOLO 类别顺序）对应的 COCO 官方类别ID（1-90，中间有空缺）
+var coco80To91 = []int{
+	1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 27, 28, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44,
+	46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64, 65,
+	67, 70, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 84, 85, 86, 87, 88, 89, 90,
+}
+
+// COCOResult COCO 结果格式（pycocotools loadRes）中的一条检测
+type COCOResult struct {
+	ImageID    int64      `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"` // x, y, w, h（原图像素坐标，保留两位小数）
+	Score      float64    `json:"score"`
+}
+
+// cocoAnnotationFile 标注文件（instances_*.json）中导出时用到的部分
+type cocoAnnotationFile struct {
+	Images []struct {
+		ID       int64  `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"images"`
+	Categories []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+}
+
+// cocoSink 汇总整次运行的检测结果，关闭时写出一个 COCO 结果格式的 JSON 数组
+// 作为普通的结果输出挂在 resultSinks 上，各工作协程并发写入，收到中断信号时同样会写出已完成的部分
+type cocoSink struct {
+	mutex      sync.Mutex
+	path       string
+	images     map[string]int64        // 标注文件中的 file_name（/ 分隔）到 image_id
+	baseImages map[string]int64        // 文件名（不含目录）到 image_id，重名的文件名为 -1
+	categories map[string]int          // 标注文件或 -coco-category-map 中的类别名称（小写）到类别ID
+	entries    map[string][]COCOResult // 尚未确定 image_id 的图像（文件名不是数字且没有标注文件）
+	results    []COCOResult
+	maxID      int64          // 已确定的最大 image_id（含无检测结果的图像），分配的 image_id 从其后开始
+	skipped    map[string]int // 未写入的检测及原因，关闭时提示
+	closed     bool
+}
+
+func newCOCOSink(outputPath string) (*cocoSink, error) {
+	s := &cocoSink{
+		path:    outputPath,
+		entries: make(map[string][]COCOResult),
+		skipped: make(map[string]int),
+	}
+	if *cocoAnnotations != "" {
+		if err := s.loadAnnotations(*cocoAnnotations); err != nil {
+			return nil, fmt.Errorf("读取标注文件 %s 失败: %w", *cocoAnnotations, err)
+		}
+	}
+	if *cocoCategoryMap != "" {
+		categories, err := loadCOCOCategoryMap(*cocoCategoryMap)
+		if err != nil {
+			return nil, fmt.Errorf("读取类别映射 %s 失败: %w", *cocoCategoryMap, err)
+		}
+		s.categories = categories
+	}
+	return s, nil
+}
+
+// loadAnnotations 读取标注文件中的图像ID和类别ID
+func (s *cocoSink) loadAnnotations(annotationPath string) error {
+	data, err := os.ReadFile(longPath(annotationPath))
+	if err != nil {
+		return err
+	}
+	var file cocoAnnotationFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	if len(file.Images) == 0 {
+		return fmt.Errorf("标注文件中没有 images")
+	}
+	s.images = make(map[string]int64, len(file.Images))
+	s.baseImages = make(map[string]int64, len(file.Images))
+	for _, img := range file.Images {
+		name := filepath.ToSlash(img.FileName)
+		s.images[name] = img.ID
+		base := path.Base(name)
+		if _, dup := s.baseImages[base]; dup {
+			s.baseImages[base] = -1
+		} else {
+			s.baseImages[base] = img.ID
+		}
+	}
+	if len(file.Categories) > 0 {
+		s.categories = make(map[string]int, len(file.Categories))
+		for _, c := range file.Categories {
+			s.categories[strings.ToLower(c.Name)] = c.ID
+		}
+	}
+	return nil
+}
+
+// loadCOCOCategoryMap 读取自定义模型的类别映射：JSON 对象，键为类别名称，值为类别ID，如 {"helmet": 1, "head": 2}
+func loadCOCOCategoryMap(mapPath string) (map[string]int, error) {
+	data, err := os.ReadFile(longPath(mapPath))
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]int
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析 JSON 失败（格式应为 {\"类别名称\": 类别ID}）: %w", err)
+	}
+	categories := make(map[string]int, len(raw))
+	for name, id := range raw {
+		categories[strings.ToLower(name)] = id
+	}
+	return categories, nil
+}
+
+func (s *cocoSink) Name() string { return "coco:" + s.path }
+
+// categoryID 返回标签对应的 COCO 类别ID
+// 优先使用 -coco-category-map，其次是标注文件中的 categories；都没有时 COCO 类别按官方ID，
+// 其他（自定义模型的）类别为类别ID加一
+func (s *cocoSink) categoryID(label string) (int, bool) {
+	if s.categories != nil {
+		id, ok := s.categories[strings.ToLower(label)]
+		return id, ok
+	}
+	for i, name := range yoloClasses {
+		if strings.EqualFold(name, label) {
+			return coco80To91[i], true
+		}
+	}
+	if id, ok := ClassID(label); ok {
+		return id + 1, true
+	}
+	return 0, false
+}
+
+// imageID 返回图像的 image_id：有标注文件时按文件名查找，否则文件名（不含扩展名）为数字时直接使用
+// （如 COCO 的 000000397133.jpg），第二个返回值为 false 表示需要在关闭时分配
+func (s *cocoSink) imageID(imagePath string) (int64, bool, error) {
+	name := filepath.ToSlash(imagePath)
+	if _, entry, ok := splitArchiveEntry(imagePath); ok {
+		name = entry
+	} else if isRemoteInput(imagePath) {
+		name = urlBaseName(imagePath)
+	}
+	base := path.Base(name)
+	if s.images == nil {
+		id, err := strconv.ParseInt(strings.TrimSuffix(base, path.Ext(base)), 10, 64)
+		return id, err == nil, nil
+	}
+	if id, ok := s.baseImages[base]; ok && id >= 0 {
+		return id, true, nil
+	}
+	// 文件名重名时按标注文件中带目录的 file_name 匹配路径结尾
+	for fileName, id := range s.images {
+		if name == fileName || strings.HasSuffix(name, "/"+fileName) {
+			return id, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("标注文件中没有图像 %s", base)
+}
+
+func (s *cocoSink) Write(record ResultRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	if record.Error != "" {
+		return nil
+	}
+	imageID, known, err := s.imageID(record.ImagePath)
+	if err != nil {
+		if len(record.Detections) == 0 {
+			return nil
+		}
+		s.skipped["图像不在标注文件中"] += len(record.Detections)
+		return err
+	}
+	if known && imageID > s.maxID {
+		s.maxID = imageID
+	}
+
+	results := make([]COCOResult, 0, len(record.Detections))
+	for _, d := range record.Detections {
+		categoryID, ok := s.categoryID(d.Label)
+		if !ok {
+			s.skipped["类别 "+d.Label+" 没有对应的类别ID"]++
+			continue
+		}
+		results = append(results, COCOResult{
+			ImageID:    imageID,
+			CategoryID: categoryID,
+			BBox:       [4]float64{roundTo(d.Box[0], 2), roundTo(d.Box[1], 2), roundTo(d.Box[2]-d.Box[0], 2), roundTo(d.Box[3]-d.Box[1], 2)},
+			Score:      roundTo(d.Confidence, 5),
+		})
+	}
+	if known {
+		s.results = append(s.results, results...)
+	} else {
+		s.entries[record.ImagePath] = append(s.entries[record.ImagePath], results...)
+	}
+	return nil
+}
+
+// roundTo 四舍五入到 digits 位小数，使输出的 JSON 不带 float32 转换产生的尾数
+func roundTo(v float32, digits int) float64 {
+	scale := math.Pow10(digits)
+	return math.Round(float64(v)*scale) / scale
+}
+
+// Flush 结果只在关闭时整体写出
+func (s *cocoSink) Flush() error { return nil }
+
+// Close 为文件名不是数字的图像分配 image_id（按路径排序，从已出现的最大ID加一开始），
+// 按 image_id、score 从高到低排序后原子写入结果文件，每条检测一行
+func (s *cocoSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	if len(s.entries) > 0 {
+		next := s.maxID
+		paths := make([]string, 0, len(s.entries))
+		for p := range s.entries {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			next++
+			for _, r := range s.entries[p] {
+				r.ImageID = next
+				s.results = append(s.results, r)
+			}
+		}
+		fmt.Printf("警告: %d 张图像的文件名不是数字，已按路径顺序分配 image_id；与标注对比时请用 -coco-annotations 指定标注文件\n", len(paths))
+	}
+	for reason, n := range s.skipped {
+		fmt.Printf("警告: COCO 结果中跳过 %d 个检测（%s）\n", n, reason)
+	}
+
+	sort.SliceStable(s.results, func(i, j int) bool {
+		a, b := s.results[i], s.results[j]
+		if a.ImageID != b.ImageID {
+			return a.ImageID < b.ImageID
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.CategoryID < b.CategoryID
+	})
+	return writeFileAtomic(s.path, func(f *os.File) error {
+		return writeCOCOResults(f, s.results)
+	})
+}
+
+// writeCOCOResults 写出 JSON 数组，每条检测占一行，便于 diff 和按行查看
+func writeCOCOResults(f *os.File, results []COCOResult) error {
+	w := bufio.NewWriter(f)
+	if len(results) == 0 {
+		w.WriteString("[]\n")
+		return w.Flush()
+	}
+	w.WriteString("[\n")
+	for i, r := range results {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		w.Write(line)
+		if i < len(results)-1 {
+			w.WriteByte(',')
+		}
+		w.WriteByte('\n')
+	}
+	w.WriteString("]\n")
+	return w.Flush()
+}
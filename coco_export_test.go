@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// cocoRecord 构造只含检测框的结果记录
+func cocoRecord(imagePath string, detections ...DetectionObject) ResultRecord {
+	return ResultRecord{SchemaVersion: ResultSchemaVersion, ImagePath: imagePath, Detections: detections}
+}
+
+func cocoDetection(label string, confidence float32, x1, y1, x2, y2 float32) DetectionObject {
+	return DetectionObject{Label: label, Confidence: confidence, Box: [4]float32{x1, y1, x2, y2}}
+}
+
+func TestCOCOSinkGolden(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	defer SetClassNames(nil)
+	dir := t.TempDir()
+
+	annotations := filepath.Join(dir, "instances_val.json")
+	if err := os.WriteFile(annotations, []byte(`{
+		"images": [{"id": 7, "file_name": "cam1/frame.jpg"}, {"id": 8, "file_name": "cam2/frame.jpg"}, {"id": 9, "file_name": "street.jpg"}],
+		"categories": [{"id": 1, "name": "person"}, {"id": 3, "name": "car"}]
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	categoryMap := filepath.Join(dir, "categories.json")
+	if err := os.WriteFile(categoryMap, []byte(`{"Helmet": 11, "head": 12}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		classes     []string // nil 表示 COCO 80 类
+		annotations string
+		categoryMap string
+		records     []ResultRecord
+	}{
+		{"numeric", nil, "", "", []ResultRecord{
+			cocoRecord("val2017/000000397133.jpg",
+				cocoDetection("person", 0.8812345, 10.004, 20.5, 110.25, 220.75),
+				cocoDetection("dining table", 0.91, 0, 300, 640, 480),
+				cocoDetection("person", 0.45, 300, 40, 360, 200)),
+			cocoRecord("val2017/000000000139.jpg", cocoDetection("tv", 0.7, 5, 5, 105, 85)),
+			cocoRecord("val2017/000000000285.jpg"),
+			{ImagePath: "val2017/000000000632.jpg", Error: "解码失败"},
+		}},
+		{"assigned_ids", nil, "", "", []ResultRecord{
+			cocoRecord("frames/000000000010.jpg", cocoDetection("car", 0.6, 1, 2, 3, 4)),
+			cocoRecord("frames/b.jpg", cocoDetection("person", 0.5, 0, 0, 10, 10)),
+			cocoRecord("frames/a.jpg", cocoDetection("dog", 0.9, 0, 0, 20, 20), cocoDetection("class_99", 0.9, 0, 0, 1, 1)),
+			cocoRecord("frames/empty.jpg"),
+		}},
+		{"annotations", nil, annotations, "", []ResultRecord{
+			cocoRecord("/data/cam2/frame.jpg", cocoDetection("car", 0.75, 100, 100, 200, 150)),
+			cocoRecord("/data/cam1/frame.jpg", cocoDetection("person", 0.5, 0, 0, 50, 100), cocoDetection("dog", 0.9, 0, 0, 1, 1)),
+			cocoRecord("frames.zip"+archiveEntrySep+"street.jpg", cocoDetection("Car", 0.95, 1, 1, 11, 21)),
+		}},
+		{"category_map", []string{"helmet", "head", "vest"}, "", categoryMap, []ResultRecord{
+			cocoRecord("site/1.jpg", cocoDetection("helmet", 0.8, 10, 10, 30, 30), cocoDetection("head", 0.6, 10, 10, 30, 35), cocoDetection("vest", 0.7, 0, 0, 5, 5)),
+		}},
+		{"custom_classes", []string{"helmet", "head"}, "", "", []ResultRecord{
+			cocoRecord("site/2.jpg", cocoDetection("head", 0.6, 0, 0, 8, 8), cocoDetection("helmet", 0.8, 0, 0, 9, 9)),
+		}},
+		{"empty", nil, "", "", []ResultRecord{cocoRecord("val2017/000000000001.jpg")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClassNames(tt.classes)
+			config.COCOAnnotations = tt.annotations
+			config.COCOCategoryMap = tt.categoryMap
+			out := filepath.Join(t.TempDir(), "predictions.json")
+			sink, err := newCOCOSink(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range tt.records {
+				sink.Write(record)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "coco", tt.name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("输出与 %s 不一致（确认后用 -update 更新）:\n%s", golden, got)
+			}
+			var results []COCOResult
+			if err := json.Unmarshal(got, &results); err != nil {
+				t.Errorf("输出不是合法的 COCO 结果数组: %v", err)
+			}
+		})
+	}
+}
+
+func TestCOCOSinkConcurrentWrites(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.COCOAnnotations, config.COCOCategoryMap = "", ""
+	out := filepath.Join(t.TempDir(), "predictions.json")
+	sink, err := newCOCOSink(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 各工作协程并发写入，输出按 image_id 排序，与写入顺序无关
+	const workers, images = 8, 25
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range images {
+				id := w*images + i + 1
+				sink.Write(cocoRecord(fmt.Sprintf("%012d.jpg", id), cocoDetection("person", 0.5, 0, 0, float32(id), 1)))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(cocoRecord("000000000001.jpg")); err == nil {
+		t.Error("关闭后写入应返回错误")
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []COCOResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != workers*images {
+		t.Fatalf("写出 %d 条检测，期望 %d 条", len(results), workers*images)
+	}
+	for i, r := range results {
+		if r.ImageID != int64(i+1) || r.BBox[2] != float64(i+1) {
+			t.Fatalf("第 %d 条检测 = %+v", i, r)
+		}
+	}
+}
+
+func TestCOCOSinkRejectsBadConfig(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name        string
+		annotations string
+		categoryMap string
+	}{
+		{"标注文件不存在", filepath.Join(dir, "missing.json"), ""},
+		{"标注文件不是 JSON", write("bad.json", "{"), ""},
+		{"标注文件没有 images", write("no_images.json", `{"categories": []}`), ""},
+		{"类别映射格式错误", "", write("bad_map.json", `["helmet"]`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.COCOAnnotations = tt.annotations
+			config.COCOCategoryMap = tt.categoryMap
+			if _, err := newCOCOSink(filepath.Join(dir, "out.json")); err == nil {
+				t.Error("newCOCOSink() 应返回错误")
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"flag"
+	"runtime"
+	"time"
+)
+
+// DetectorConfig 检测器的全部配置
+// 命令行程序通过 RegisterFlags 将参数绑定到全局配置；作为库嵌入时不注册任何参数，
+// 直接用 SetDetectorConfig 设置配置，避免与宿主程序的命令行参数冲突
+type DetectorConfig struct {
+	// 模型
+	ModelPath string // YOLO模型文件路径
+	Format    string // 模型输出格式：v8（YOLOv8/YOLO11）、v5（YOLOv5/YOLOv7，含 objectness）、e2e（YOLOv10/end2end，无需NMS），auto 根据输出形状自动判断
+	Task      string // 模型任务类型：detect、seg（需要 -seg 模型）、pose（需要 -pose 模型）、classify（需要 -cls 模型）
+
+	// 多模型集成推理（ModelPath 以逗号分隔多个模型时生效）
+	EnsembleFusion string  // 融合方式：nms 或 wbf（加权框融合）
+	EnsembleIOU    float64 // 融合时判断为同一目标的 IOU 阈值
+
+	ModelManifest string // 本地模型清单文件，为空时使用内置清单
+	ModelCache    string // 按名称下载的模型的缓存目录，为空时使用用户缓存目录
+
+	WatchModel time.Duration // 检查模型文件是否被替换的间隔，0 表示不监视
+
+	// 输入输出路径
+	InputPath  string // 输入图像路径、目录、压缩包、视频文件或.txt文件
+	OutputPath string // 输出图像路径（仅在输入单个图像时有效）
+
+	NameReplacement   string // 生成输出文件名时替换无效字符（如摄像头文件名中的冒号）的字符串
+	SaveJSON          bool   // 在标注图像旁保存同名 .json 检测结果
+	SaveTxt           bool   // 在标注图像目录的 labels/ 下保存 YOLO 格式的标签文件
+	SaveConf          bool   // YOLO 标签文件每行末尾附加置信度
+	SaveEmptyTxt      bool   // 没有检测目标的图像也保存（空的）YOLO 标签文件
+	FailOnDetect      bool   // 检测到危险对象时以退出码 3 结束
+	LogMaxSizeMB      int    // 单个日志文件的大小上限（MB），超过后压缩归档，0 表示不限制
+	LogRetentionDays  int    // 日志保留天数，启动时和每天第一次写入时清理更早的日志，0 表示不清理
+	OutputTemplate    string // 生成的标注图像文件名模板（{name} {ext} {model} {hash} {conf} {date} {index} {count}）
+	PreserveStructure bool   // 批量处理时在输出目录中保留输入的子目录结构
+
+	ArchiveSpillMB int // tar(.gz) 输入解出到临时目录的容量上限（MB），zip 直接从压缩包读取不占用临时目录
+	MaxImageDim    int // 解码图像的宽高上限（像素），超过时拒绝解码，0 表示不限制
+
+	// URL 输入
+	DownloadTimeout time.Duration // 下载单张图像的超时时间
+	DownloadMaxMB   int           // 单张图像的最大下载大小（MB），0 表示不限制
+	DownloadDir     string        // 保留下载的原图的目录，为空时下载到临时目录并在退出前删除
+
+	// 视频输入（通过 ffmpeg 解码）
+	VidStride  int           // 每隔多少帧检测一帧，1 表示检测每一帧
+	VideoStart time.Duration // 从视频的该时间点开始检测
+	VideoEnd   time.Duration // 检测到视频的该时间点为止，0 表示到视频结尾
+	SaveVideo  bool          // 将标注后的帧编码为 mp4 保存
+
+	// 视频流输入（rtsp://）
+	StreamFPS     float64       // 每秒最多检测的帧数，0 表示不限制
+	RTSPTransport string        // RTSP 传输方式：tcp 或 udp
+	StreamTimeout time.Duration // 超过该时间没有收到新帧时视为断流并重连
+	AdaptiveDrop  int           // 任务队列中等待的任务超过该数量时只检测最新的帧、丢弃其余的帧，0 表示关闭
+
+	// 本地摄像头输入（camera:N）
+	CameraSize string // 摄像头采集分辨率（宽x高），为空时使用设备默认值
+
+	// S3 输入输出（s3://bucket/key），访问密钥从 AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY 读取
+	S3Endpoint    string // S3 兼容服务的地址（如 MinIO 的 http://localhost:9000），为空时使用 AWS_ENDPOINT_URL 或 AWS 区域终端地址
+	S3Region      string // 签名使用的区域，为空时使用 AWS_REGION，默认 us-east-1
+	S3PathStyle   bool   // 使用路径风格地址（endpoint/bucket/key），否则为虚拟主机风格（bucket.endpoint/key）
+	S3KeyTemplate string // -output 为 s3:// 前缀时标注图像的对象键模板
+	S3UploadJSON  bool   // 标注图像上传到 S3 时同时上传同名 .json 检测结果
+
+	// 检测参数
+	ConfThreshold  float64 // 置信度阈值
+	IOUThreshold   float64 // NMS 的 IOU 阈值
+	MaxDet         int     // 每张图像最多保留的检测框数量（按置信度），0 表示不限制
+	NMS            string  // 抑制策略：hard（标准 NMS）、soft（高斯 Soft-NMS）或 diou（DIoU-NMS）
+	SoftNMSSigma   float64 // Soft-NMS 高斯衰减的 sigma
+	SoftNMSMinConf float64 // Soft-NMS 衰减后保留的最低置信度，0 表示与 ConfThreshold 相同
+	InputSize      int     // 模型输入尺寸
+	RectScaling    bool    // 对较短边做最小填充（可被步长整除）而不是填充为正方形，以提高推理速度
+	ResizeMode     string  // 预处理缩放方式：letterbox、stretch（拉伸）或 crop（中心裁剪）
+	Augment        bool    // 测试时增强 (TTA)，可能提高鲁棒性但会降低推理速度
+	TTAMerge       string  // 测试时增强结果的坐标合并方式：nms 或 wbf（加权框融合）
+	TTADecodeConf  float64 // 测试时增强每次推理的解码阈值，0 表示 -conf 的一半
+	TTAOps         string  // 测试时增强的变换，逗号分隔（flipH, flipV, rot90, rot180, rot270）
+	BatchSize      int     // 推理批处理大小（仅在输入为目录、视频文件或 .txt 文件时有效）
+	WarmupRuns     int     // 会话创建后先用全零输入执行 N 次推理，避免首帧（冷启动）延迟明显高于稳定状态
+	KeypointConf   float64 // 关键点置信度阈值（-task pose）
+	Classes        string  // 只保留的类别（逗号分隔的类别名或ID），为空表示全部类别
+	ExcludeClasses string  // 排除的类别（逗号分隔的类别名或ID）
+	OutputGuard    string  // 模型输出检查：off、log（记录异常）、fail（异常时任务失败）
+	ClassifyTopK   int     // 分类模式输出的前K个类别（-task classify）
+	ClassifyOut    string  // 分类结果输出文件（-task classify）
+	RectDiffOut    string  // rectdiff 子命令的输出目录
+	RectDiffIOU    float64 // rectdiff 子命令匹配两次检测结果的 IoU 阈值
+
+	// 系统显示参数（用于监控系统等应用场景）
+	SystemTextLocation string
+	SystemText         string
+	SystemTextEnabled  bool
+
+	// 并发处理
+	Workers            int
+	QueueSize          int
+	TaskTimeout        time.Duration
+	BatchCollect       int           // 工作协程每次最多从队列收集的任务数（不少于 -batch）
+	BatchFlush         time.Duration // 收到第一个任务后最多再等待多久凑批，超时后立即处理已收集的任务
+	DrainOnStop        bool          // 管理器停止时先处理完队列中的任务
+	SessionMaxFailures int           // 会话连续推理失败达到该次数时销毁并替换，0 表示不替换
+	MaxFPS             float64       // 每秒最多提交的任务数，0 表示不限制
+	RateLimitMode      string        // 超出 MaxFPS 时的处理方式（delay, reject）
+	RetryAttempts      int           // 推理和取得会话的最多尝试次数（含第一次），1 表示不重试
+	RetryBackoff       time.Duration // 第一次重试前的等待时间，之后每次加倍
+	RenderWorkers      int           // 绘制/编码协程数量，与推理工作协程分开
+	PreprocessWorkers  int           // 填充单张图像输入张量的协程数量，0 表示按 GOMAXPROCS 自动选择
+	Progress           bool          // 批量处理时显示进度和剩余时间
+	ProgressInterval   time.Duration // 标准输出不是终端时打印进度的间隔
+
+	// 结果输出
+	Sinks             string        // 结果输出列表，逗号分隔的 类型:路径（ndjson、csv）
+	ResultFormat      string        // 批量处理结果在标准输出上的格式：text、jsonl
+	COCOOut           string        // 整次运行的检测结果汇总为 COCO 结果格式 JSON 的路径，空表示不导出
+	COCOAnnotations   string        // COCO 标注文件，用于按文件名查找 image_id 和按名称查找类别ID
+	COCOCategoryMap   string        // 自定义模型的类别映射 JSON（类别名称到类别ID）
+	CVATOut           string        // 整次运行的检测结果导出为 CVAT for images 1.1 XML 的路径，空表示不导出
+	LabelStudioOut    string        // 整次运行的检测结果导出为 Label Studio 预标注任务 JSON 的路径，空表示不导出
+	LabelStudioFrom   string        // Label Studio 标注配置中 RectangleLabels 的 name（from_name）
+	LabelStudioTo     string        // Label Studio 标注配置中 Image 的 name（to_name，也是任务 data 中图像地址的键）
+	LabelStudioPrefix string        // Label Studio 任务中图像地址的前缀，加在相对于输入目录的图像路径之前
+	ResultDB          string        // 检测结果写入的 SQLite 数据库路径（需要以 -tags sqlite 构建），空表示不写入
+	SinkFlushEvery    int           // 面向行的输出每写入多少条记录刷新一次，1 表示每条记录都立即写入文件
+	Durable           bool          // 文件输出关闭前 fsync，保证掉电后已报告刷新成功的记录不丢失
+	ShutdownTimeout   time.Duration // 退出或收到中断信号时等待所有输出刷新的最长时间
+	SkipExisting      bool          // 批量检测时跳过输出文件已存在的图像（断点续跑）
+	Force             bool          // 与 SkipExisting 同时指定时仍然重新处理所有图像
+	Overwrite         bool          // 生成的输出文件已存在时替换
+	NoClobber         bool          // 生成的输出文件已存在时跳过该图像
+
+	// 监控
+	MetricsAddr string // 监控服务监听地址（/metrics 和 /debug/vars），为空时不启动
+
+	// 性能分析
+	PprofAddr  string // net/http/pprof 监听地址，为空时不启动
+	CPUProfile string // CPU profile 输出路径，退出时写入
+	MemProfile string // 堆 profile 输出路径，退出时写入
+
+	// 推理服务
+	Serve    string // HTTP 推理服务监听地址（POST /detect, GET /healthz），为空时按命令行模式运行
+	GRPCAddr string // gRPC 检测服务监听地址（Detect, DetectStream），为空时不启动
+
+	// 实时推送
+	WSAddr      string // WebSocket 推送服务监听地址（/ws），为空时不启动
+	WSThumbnail int    // 推送消息附带的缩略图长边（像素），0 表示不附带
+
+	// MQTT 发布
+	MQTTBroker   string // MQTT 代理地址，为空时不发布
+	MQTTTopic    string
+	MQTTClientID string
+	MQTTUsername string
+	MQTTPassword string
+	MQTTCA       string // TLS 信任的 CA 证书
+	MQTTCert     string // TLS 客户端证书
+	MQTTKey      string // TLS 客户端私钥
+	MQTTQoS      int
+	MQTTRetain   bool
+	MQTTClasses  string // 只发布这些类别的检测目标，为空时发布全部
+
+	// Kafka 输出
+	KafkaBrokers      string // 逗号分隔的 host:port，为空时不输出
+	KafkaTopic        string
+	KafkaFormat       string // json 或 avro
+	KafkaKey          string // path 或 camera
+	KafkaPositiveOnly bool   // 只输出含检测目标的结果
+	KafkaBatchSize    int
+	KafkaLinger       time.Duration // 批次未满时最长等待时间
+
+	// Redis 队列消费
+	RedisAddr        string // redis://[:密码@]host:port[/db]，与 RedisQueue 同时指定时以队列消费模式运行
+	RedisQueue       string // 任务列表，元素为图像路径或 URL
+	RedisResults     string // 结果写入的键，为空时为 <队列>:results
+	RedisStream      bool   // 结果以 XADD 写入 Stream，否则 LPUSH 到列表
+	RedisDeadLetter  string // 多次失败的任务移入的列表，为空时为 <队列>:dead
+	RedisMaxAttempts int
+
+	// 危险对象通知（Webhook、外部命令）
+	DangerClasses    string        // 危险类别：计入摘要的危险对象数（-fail-on-detect 据此判断）并触发通知，为空时为所有检测到的类别
+	AlertCooldown    time.Duration // 同一摄像头同一类别两次通知的最短间隔
+	WebhookURL       string        // 为空时不通知
+	WebhookRetries   int
+	WebhookThumbnail int // 附带的缩略图长边（像素），0 表示不附带
+	OnDetectCmd      string
+	OnDetectTimeout  time.Duration
+
+	// 报告格式
+	Timezone  string
+	Precision int
+
+	// 会话参数
+	ORTLibPath   string
+	CPUArena     bool
+	MemPattern   bool
+	LowMem       bool
+	IntraThreads int
+	InterThreads int
+	ExecMode     string
+	GraphOpt     string
+
+	// 告警、自检和子进程
+	AlertRules     string
+	SelftestImage  string
+	SelftestExpect string
+	CanaryInterval time.Duration // 金丝雀自检间隔，0 表示关闭
+	ReportInterval time.Duration // 分时段报告间隔，0 表示关闭
+	ReportFile     string        // 分时段报告追加写入的 JSON Lines 文件，为空时不写文件
+	CanaryFailures int           // 金丝雀连续失败多少次后标记为未就绪
+	ChildLocale    string
+
+	Strict bool // 指定了不会生效或互相矛盾的参数时拒绝启动（否则只警告）
+}
+
+// DefaultDetectorConfig 返回默认配置（与命令行参数的默认值一致）
+func DefaultDetectorConfig() DetectorConfig {
+	return DetectorConfig{
+		ModelPath:          "./third_party/yolo11x.onnx",
+		Format:             formatAuto,
+		Task:               taskDetect,
+		EnsembleFusion:     "nms",
+		EnsembleIOU:        0.55,
+		TTAMerge:           ttaMergeNMS,
+		ResizeMode:         resizeLetterbox,
+		TTAOps:             "flipH",
+		InputPath:          "./assets/bus.jpg",
+		OutputPath:         "./assets/bus_11x_false.jpg",
+		NameReplacement:    "_",
+		OutputTemplate:     defaultOutputTemplate,
+		ArchiveSpillMB:     1024,
+		DownloadTimeout:    10 * time.Second,
+		DownloadMaxMB:      20,
+		MaxImageDim:        16384,
+		ResultFormat:       resultFormatText,
+		LabelStudioFrom:    "label",
+		LabelStudioTo:      "image",
+		S3PathStyle:        true,
+		S3KeyTemplate:      defaultOutputTemplate,
+		S3UploadJSON:       true,
+		ConfThreshold:      0.25,
+		IOUThreshold:       0.7,
+		MaxDet:             300,
+		NMS:                nmsHard,
+		SoftNMSSigma:       0.5,
+		InputSize:          640,
+		BatchSize:          1,
+		KeypointConf:       0.5,
+		OutputGuard:        guardLog,
+		ClassifyTopK:       5,
+		ClassifyOut:        "./assets/classify_results.csv",
+		RectDiffOut:        "./assets/rectdiff",
+		RectDiffIOU:        0.5,
+		SystemTextLocation: "bottom-left",
+		SystemText:         "重要设施危险场景监测系统",
+		SystemTextEnabled:  true,
+		Workers:            max(1, runtime.NumCPU()/2),
+		QueueSize:          100,
+		TaskTimeout:        30 * time.Second,
+		BatchCollect:       4,
+		BatchFlush:         100 * time.Millisecond,
+		DrainOnStop:        true,
+		SessionMaxFailures: 3,
+		RateLimitMode:      "delay",
+		RetryAttempts:      1,
+		RetryBackoff:       100 * time.Millisecond,
+		RenderWorkers:      max(1, runtime.NumCPU()/4),
+		VidStride:          1,
+		StreamFPS:          5,
+		RTSPTransport:      "tcp",
+		StreamTimeout:      10 * time.Second,
+		Progress:           true,
+		ProgressInterval:   10 * time.Second,
+		SinkFlushEvery:     1,
+		LogMaxSizeMB:       10,
+		MQTTTopic:          "yolo/detections",
+		KafkaTopic:         "yolo-detections",
+		KafkaFormat:        "json",
+		KafkaKey:           "path",
+		KafkaBatchSize:     100,
+		KafkaLinger:        100 * time.Millisecond,
+		RedisMaxAttempts:   3,
+		DangerClasses:      "person,car,motorcycle,bus,truck",
+		AlertCooldown:      time.Minute,
+		WebhookRetries:     3,
+		WebhookThumbnail:   320,
+		OnDetectTimeout:    10 * time.Second,
+		ShutdownTimeout:    5 * time.Second,
+		Timezone:           "Local",
+		Precision:          6,
+		CPUArena:           true,
+		MemPattern:         true,
+		ExecMode:           "sequential",
+		GraphOpt:           "all",
+		SelftestImage:      "./assets/bus.jpg",
+		CanaryFailures:     3,
+		Strict:             true,
+	}
+}
+
+// config 当前生效的全局配置
+var config = DefaultDetectorConfig()
+
+// SetDetectorConfig 以库方式使用时设置全局配置，需在创建会话之前调用
+func SetDetectorConfig(c DetectorConfig) {
+	config = c
+}
+
+// RegisterFlags 将全部配置注册为命令行参数，只应由命令行程序的 main 调用一次
+func RegisterFlags(fs *flag.FlagSet) {
+	c := &config
+
+	fs.Var(&modelPathsFlag{target: &c.ModelPath}, "model", "YOLO模型文件路径，重复指定或用逗号分隔多个模型时进行集成推理")
+	fs.StringVar(&c.EnsembleFusion, "ensemble-fusion", c.EnsembleFusion, "多模型集成的融合方式 (nms, wbf)")
+	fs.Float64Var(&c.EnsembleIOU, "ensemble-iou", c.EnsembleIOU, "多模型集成融合时的IOU阈值")
+	fs.StringVar(&c.ModelManifest, "model-manifest", c.ModelManifest, "模型清单文件（JSON，格式同内置清单），用于离线环境指向内网地址，为空时使用内置清单")
+	fs.StringVar(&c.ModelCache, "model-cache", c.ModelCache, "按名称（如 -model yolo11n）下载的模型的缓存目录，为空时使用用户缓存目录")
+	fs.DurationVar(&c.WatchModel, "watch-model", c.WatchModel, "工作协程池运行期间检查模型文件是否被替换的间隔（如 30s），变化后自动热加载，0 表示不监视")
+	fs.StringVar(&c.Format, "format", c.Format, "模型输出格式 (v5, v8, e2e, auto)")
+	fs.StringVar(&c.Task, "task", c.Task, "模型任务类型 (detect, seg, pose, classify)")
+
+	fs.StringVar(&c.InputPath, "img", c.InputPath, "输入图像路径、目录、压缩包（.zip/.tar/.tar.gz）、视频文件、.txt文件、- (从标准输入逐行读取路径) 或通配符模式（如 \"./frames/**/cam1_*.jpg\"，需加引号）")
+	fs.StringVar(&c.OutputPath, "output", c.OutputPath, "输出图像路径（仅在输入单个图像时有效），s3://bucket/prefix/ 时所有标注图像上传到该前缀下")
+	fs.BoolVar(&c.SaveJSON, "save-json", c.SaveJSON, "在每张标注图像旁保存同名 .json 检测结果（图像尺寸、模型、阈值和检测目标）")
+	fs.BoolVar(&c.SaveTxt, "save-txt", c.SaveTxt, "在标注图像所在目录的 labels/ 下为每张图像保存 YOLO 格式标签（class_id cx cy w h，按原图尺寸归一化），用于自动标注生成训练数据")
+	fs.BoolVar(&c.SaveConf, "save-conf", c.SaveConf, "YOLO 标签文件每行末尾附加置信度（需要 -save-txt）")
+	fs.BoolVar(&c.SaveEmptyTxt, "save-empty-txt", c.SaveEmptyTxt, "没有检测目标的图像也保存空的 YOLO 标签文件（需要 -save-txt），训练时作为负样本")
+	fs.BoolVar(&c.FailOnDetect, "fail-on-detect", c.FailOnDetect, "检测到危险对象时以退出码 3 结束（全部图像处理成功时），用作自动检查的关卡")
+	fs.IntVar(&c.LogMaxSizeMB, "log-max-size", c.LogMaxSizeMB, "单个日志文件的大小上限（MB），超过后当天的日志压缩为 .gz 归档并重新开始，0 表示不限制")
+	fs.IntVar(&c.LogRetentionDays, "log-retention-days", c.LogRetentionDays, "日志保留天数（含当天），启动时和每天第一次写日志时删除更早的日志及归档，0 表示不清理")
+	fs.StringVar(&c.OutputTemplate, "output-template", c.OutputTemplate, "生成的标注图像文件名模板，占位符 {name} {ext} {model} {hash} {conf} {date} {index} {count}，同一批次内重名时加 -1、-2 后缀")
+	fs.BoolVar(&c.PreserveStructure, "preserve-structure", c.PreserveStructure, "批量处理时在输出目录中保留输入图像相对于输入目录的子目录结构，子目录按需创建")
+	fs.StringVar(&c.NameReplacement, "name-replacement", c.NameReplacement, "生成输出文件名时替换 Windows 不允许的字符（如 <>:\"/\\|?*）所用的字符串")
+	fs.IntVar(&c.ArchiveSpillMB, "archive-spill-mb", c.ArchiveSpillMB, "tar(.gz) 输入解出到临时目录的容量上限（MB）")
+	fs.IntVar(&c.MaxImageDim, "max-image-dim", c.MaxImageDim, "解码图像的宽高上限（像素），超过时该图像失败而不解码，防止解压炸弹；0 表示不限制")
+	fs.DurationVar(&c.DownloadTimeout, "download-timeout", c.DownloadTimeout, "下载 http(s) URL 输入图像的超时时间")
+	fs.IntVar(&c.DownloadMaxMB, "download-max-mb", c.DownloadMaxMB, "单张 URL 输入图像的最大下载大小（MB），0 表示不限制")
+	fs.StringVar(&c.DownloadDir, "download-dir", c.DownloadDir, "保留下载的 URL 输入原图的目录，为空时下载到临时目录并在退出前删除")
+	fs.IntVar(&c.VidStride, "vid-stride", c.VidStride, "视频输入每隔多少帧检测一帧，1 表示检测每一帧")
+	fs.DurationVar(&c.VideoStart, "video-start", c.VideoStart, "视频输入从该时间点开始检测（如 1m30s）")
+	fs.DurationVar(&c.VideoEnd, "video-end", c.VideoEnd, "视频输入检测到该时间点为止（如 2m），0 表示到视频结尾")
+	fs.BoolVar(&c.SaveVideo, "save-video", c.SaveVideo, "将视频输入的标注帧编码为 mp4（H.264，保持源视频的分辨率和帧率）保存到输出目录")
+	fs.Float64Var(&c.StreamFPS, "stream-fps", c.StreamFPS, "视频流（-img rtsp://...）每秒最多检测的帧数，多余的帧由 ffmpeg 丢弃；0 表示检测每一帧")
+	fs.StringVar(&c.RTSPTransport, "rtsp-transport", c.RTSPTransport, "RTSP 传输方式：tcp（穿过防火墙和 NAT 更可靠）或 udp")
+	fs.DurationVar(&c.StreamTimeout, "stream-timeout", c.StreamTimeout, "视频流超过该时间没有新帧时视为断流，终止 ffmpeg 并重连")
+	fs.IntVar(&c.AdaptiveDrop, "adaptive-drop", c.AdaptiveDrop, "视频流和摄像头的自适应丢帧：任务队列中等待的任务超过该数量时暂停提交，期间只保留最新的一帧、丢弃较旧的帧；0 表示关闭（检测跟不上时帧在 ffmpeg 一侧积压，延迟不断增长）")
+	fs.StringVar(&c.CameraSize, "camera-size", c.CameraSize, "摄像头（-img camera:N）的采集分辨率，如 1280x720；为空时使用设备默认分辨率")
+	fs.StringVar(&c.S3Endpoint, "s3-endpoint", c.S3Endpoint, "S3 兼容服务地址（如 MinIO 的 http://localhost:9000），为空时使用环境变量 AWS_ENDPOINT_URL 或 AWS 区域终端地址")
+	fs.StringVar(&c.S3Region, "s3-region", c.S3Region, "S3 签名区域，为空时使用环境变量 AWS_REGION，默认 us-east-1")
+	fs.BoolVar(&c.S3PathStyle, "s3-path-style", c.S3PathStyle, "使用路径风格的 S3 地址（MinIO 需要），false 时使用虚拟主机风格")
+	fs.StringVar(&c.S3KeyTemplate, "s3-key-template", c.S3KeyTemplate, "-output 为 s3:// 前缀时标注图像的对象键模板，占位符与 -output-template 相同")
+	fs.BoolVar(&c.S3UploadJSON, "s3-upload-json", c.S3UploadJSON, "标注图像上传到 S3 时同时上传同名 .json 检测结果")
+
+	fs.Float64Var(&c.ConfThreshold, "conf", c.ConfThreshold, "置信度阈值，过滤低置信度检测结果")
+	fs.Float64Var(&c.IOUThreshold, "iou", c.IOUThreshold, "IOU阈值，用于非极大值抑制(NMS)")
+	fs.IntVar(&c.MaxDet, "max-det", c.MaxDet, "每张图像最多保留的检测框数量（NMS 后按置信度截断），0 表示不限制")
+	fs.StringVar(&c.NMS, "nms", c.NMS, "抑制策略 (hard, soft, diou)：soft 为高斯 Soft-NMS，衰减重叠框的置信度而不是删除，适合人员密集场景；diou 按 DIoU 抑制，适合停车场等相邻目标密集的场景")
+	fs.Float64Var(&c.SoftNMSSigma, "soft-nms-sigma", c.SoftNMSSigma, "Soft-NMS 高斯衰减的 sigma，越小衰减越强")
+	fs.Float64Var(&c.SoftNMSMinConf, "soft-nms-conf", c.SoftNMSMinConf, "Soft-NMS 衰减后保留的最低置信度，0 表示与 -conf 相同")
+	fs.IntVar(&c.InputSize, "size", c.InputSize, "模型输入尺寸，通常为640x640")
+	fs.BoolVar(&c.RectScaling, "rect", c.RectScaling, "是否使用矩形缩放（保持长宽比）")
+	fs.StringVar(&c.ResizeMode, "resize-mode", c.ResizeMode, "预处理缩放方式 (letterbox, stretch, crop)：stretch 拉伸到正方形不填充，crop 按短边缩放后中心裁剪；-rect 只在 letterbox 时生效")
+	fs.BoolVar(&c.Augment, "augment", c.Augment, "是否启用测试时增强 (TTA) 进行预测")
+	fs.StringVar(&c.TTAMerge, "tta-merge", c.TTAMerge, "测试时增强结果的坐标合并方式 (nms, wbf)：nms 取置信度最高的一次结果，wbf 按置信度加权平均；置信度按各次推理合并为 1-Π(1-p)")
+	fs.StringVar(&c.TTAOps, "tta-ops", c.TTAOps, "测试时增强的变换，逗号分隔 (flipH, flipV, rot90, rot180, rot270)")
+	fs.Float64Var(&c.TTADecodeConf, "tta-decode-conf", c.TTADecodeConf, "测试时增强每次推理的解码置信度阈值，融合后再按 -conf 过滤；0 表示使用 -conf 的一半")
+	fs.IntVar(&c.BatchSize, "batch", c.BatchSize, "指定推理的批处理大小")
+	fs.IntVar(&c.WarmupRuns, "warmup", c.WarmupRuns, "会话创建后的预热推理次数")
+	fs.Float64Var(&c.KeypointConf, "kpt-conf", c.KeypointConf, "关键点置信度阈值，低于该值的关键点不绘制（-task pose）")
+	fs.StringVar(&c.Classes, "classes", c.Classes, "只保留的类别，逗号分隔的类别名或类别ID（如 person,car 或 0,2），为空表示全部类别")
+	fs.StringVar(&c.ExcludeClasses, "exclude-classes", c.ExcludeClasses, "排除的类别，逗号分隔的类别名或类别ID")
+	fs.StringVar(&c.OutputGuard, "output-guard", c.OutputGuard, "模型输出检查 (off, log, fail)：检测 NaN/Inf、全零输出和置信度异常，fail 时任务以错误结束而不是输出空结果")
+	fs.IntVar(&c.ClassifyTopK, "topk", c.ClassifyTopK, "分类模式输出的前K个类别（-task classify）")
+	fs.StringVar(&c.ClassifyOut, "cls-output", c.ClassifyOut, "分类结果输出文件，根据扩展名写入 .csv 或 .json（-task classify）")
+	fs.StringVar(&c.RectDiffOut, "rectdiff-out", c.RectDiffOut, "rectdiff 子命令的输出目录（差异报告 rectdiff.csv 和并排标注图）")
+	fs.Float64Var(&c.RectDiffIOU, "rectdiff-iou", c.RectDiffIOU, "rectdiff 子命令中同类别框 IoU 不低于该值时视为同一目标")
+
+	fs.StringVar(&c.SystemTextLocation, "text-location", c.SystemTextLocation, "系统文本位置 (top-left, bottom-left, top-right, bottom-right)")
+	fs.StringVar(&c.SystemText, "system-text", c.SystemText, "系统显示文本")
+	fs.BoolVar(&c.SystemTextEnabled, "enable-system-text", c.SystemTextEnabled, "是否显示系统文本")
+
+	fs.IntVar(&c.Workers, "workers", c.Workers, "并发工作协程数量")
+	fs.IntVar(&c.QueueSize, "queue-size", c.QueueSize, "任务队列大小")
+	fs.DurationVar(&c.TaskTimeout, "timeout", c.TaskTimeout, "单个任务超时时间，超时的推理结果被丢弃、会话被替换")
+	fs.IntVar(&c.BatchCollect, "batch-collect", c.BatchCollect, "工作协程每次最多从队列收集的任务数，实际取该值与 -batch 的较大者")
+	fs.DurationVar(&c.BatchFlush, "batch-flush", c.BatchFlush, "工作协程收到第一个任务后最多等待多久凑批，超时后立即处理已收集的任务")
+	fs.BoolVar(&c.DrainOnStop, "drain-on-stop", c.DrainOnStop, "管理器停止时先处理完队列中的任务；为 false 时只完成正在处理的任务，其余任务返回“管理器已停止”")
+	fs.Float64Var(&c.MaxFPS, "max-fps", c.MaxFPS, "每秒最多提交的检测任务数（令牌桶限速，用于控制边缘设备的推理负载），0 表示不限制")
+	fs.StringVar(&c.RateLimitMode, "rate-limit-mode", c.RateLimitMode, "提交速度超过 -max-fps 时的处理方式 (delay: 等待配额, reject: 立即拒绝)")
+	fs.IntVar(&c.RetryAttempts, "retry-attempts", c.RetryAttempts, "推理失败或暂时取不到会话时的最多尝试次数（含第一次），1 表示不重试")
+	fs.DurationVar(&c.RetryBackoff, "retry-backoff", c.RetryBackoff, "第一次重试前的等待时间，之后每次重试加倍")
+	fs.IntVar(&c.SessionMaxFailures, "session-max-failures", c.SessionMaxFailures, "会话连续推理失败达到该次数时销毁并在后台创建新会话替换，0 表示不替换")
+	fs.IntVar(&c.RenderWorkers, "render-workers", c.RenderWorkers, "批量处理时绘制和编码输出图像的协程数量，与推理工作协程分开，避免编码抢占推理CPU")
+	fs.BoolVar(&c.Progress, "progress", c.Progress, "批量处理时显示进度（已完成/总数、失败数、剩余时间）；标准输出是终端时在同一行刷新，否则每隔 -progress-interval 打印一行")
+	fs.DurationVar(&c.ProgressInterval, "progress-interval", c.ProgressInterval, "标准输出不是终端（重定向到文件或日志）时打印进度的间隔")
+	fs.IntVar(&c.PreprocessWorkers, "preprocess-workers", c.PreprocessWorkers, "填充单张图像输入张量时按行并行的协程数量，0 表示自动（GOMAXPROCS，最多 4），1 表示串行")
+
+	fs.StringVar(&c.Sinks, "sink", c.Sinks, "结果输出，逗号分隔的 类型:路径（如 ndjson:./out.ndjson,csv:./out.csv），以追加方式写入")
+	fs.StringVar(&c.ResultFormat, "result-format", c.ResultFormat, "批量处理结果在标准输出上的格式：text（中文提示）、jsonl（每张图像一行 JSON，提示信息输出到标准错误）")
+	fs.StringVar(&c.COCOOut, "coco-out", c.COCOOut, "将整次运行的检测结果写入一个 COCO 结果格式的 JSON 文件（image_id、category_id、bbox、score），可直接交给 pycocotools 评估")
+	fs.StringVar(&c.COCOAnnotations, "coco-annotations", c.COCOAnnotations, "COCO 标注文件（instances_*.json），按文件名查找 image_id，按名称查找类别ID")
+	fs.StringVar(&c.COCOCategoryMap, "coco-category-map", c.COCOCategoryMap, "自定义模型的类别映射 JSON 文件，如 {\"helmet\": 1, \"head\": 2}")
+	fs.StringVar(&c.CVATOut, "cvat-out", c.CVATOut, "将整次运行的检测结果写入一个 CVAT for images 1.1 格式的 annotations.xml，可导入 CVAT 人工修正")
+	fs.StringVar(&c.LabelStudioOut, "labelstudio-out", c.LabelStudioOut, "将整次运行的检测结果写入 Label Studio 预标注任务 JSON（rectanglelabels，百分比坐标）")
+	fs.StringVar(&c.LabelStudioFrom, "labelstudio-from", c.LabelStudioFrom, "Label Studio 标注配置中 RectangleLabels 的 name（from_name）")
+	fs.StringVar(&c.LabelStudioTo, "labelstudio-to", c.LabelStudioTo, "Label Studio 标注配置中 Image 的 name（to_name）")
+	fs.StringVar(&c.LabelStudioPrefix, "labelstudio-prefix", c.LabelStudioPrefix, "Label Studio 任务中图像地址的前缀（如 /data/local-files/?d=images/），加在相对于输入目录的图像路径之前")
+	fs.StringVar(&c.ResultDB, "db", c.ResultDB, "将检测结果写入 SQLite 数据库（WAL 模式，每个检测目标一行），可用 query 子命令查询；需要以 -tags sqlite 构建")
+	fs.IntVar(&c.SinkFlushEvery, "sink-flush-every", c.SinkFlushEvery, "结果输出每写入多少条记录刷新一次，1 表示每条记录立即写入（进程被强制终止时最多丢失一条）")
+	fs.BoolVar(&c.Durable, "durable", c.Durable, "文件结果输出关闭前 fsync 到磁盘")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "退出或收到中断信号时等待结果输出刷新的最长时间")
+	fs.BoolVar(&c.SkipExisting, "skip-existing", c.SkipExisting, "批量检测时跳过标注输出文件已存在的图像，用于中断后继续处理（输出文件名由输入路径决定，每次运行相同）")
+	fs.BoolVar(&c.Force, "force", c.Force, "与 -skip-existing 同时指定时忽略已有输出，重新处理所有图像")
+	fs.BoolVar(&c.Overwrite, "overwrite", c.Overwrite, "生成的输出文件已存在时直接替换（默认加 -1、-2 后缀另存）")
+	fs.BoolVar(&c.NoClobber, "no-clobber", c.NoClobber, "生成的输出文件已存在时跳过该图像并提示（默认加 -1、-2 后缀另存）")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "监控服务监听地址（如 :9090），提供 Prometheus 格式的 /metrics 和 expvar 的 /debug/vars，为空时不启动")
+	fs.StringVar(&c.PprofAddr, "pprof-addr", c.PprofAddr, "性能分析服务监听地址（如 localhost:6060），提供 /debug/pprof/，为空时不启动")
+	fs.StringVar(&c.CPUProfile, "cpuprofile", c.CPUProfile, "把 CPU profile 写入该文件（运行结束或中断退出时写入）")
+	fs.StringVar(&c.MemProfile, "memprofile", c.MemProfile, "把堆 profile 写入该文件（运行结束或中断退出时写入）")
+	fs.StringVar(&c.Serve, "serve", c.Serve, "以 HTTP 推理服务运行并监听该地址（如 :8080）：POST /detect 检测上传的图像，GET /healthz 检查会话能否推理；指定后忽略 -img")
+	fs.StringVar(&c.GRPCAddr, "grpc-addr", c.GRPCAddr, "以 gRPC 检测服务运行并监听该地址（如 :50051），提供 Detect 和 DetectStream；需以 -tags grpc 构建，指定后忽略 -img")
+	fs.StringVar(&c.WSAddr, "ws-addr", c.WSAddr, "实时推送服务监听地址（如 :8081），在 /ws 以 WebSocket 推送每个检测结果的 JSON，可用 ?classes=person,car 只接收指定类别；为空时不启动")
+	fs.IntVar(&c.WSThumbnail, "ws-thumbnail", c.WSThumbnail, "实时推送消息附带原图缩略图（JPEG base64）的长边像素数，0 表示不附带")
+	fs.StringVar(&c.MQTTBroker, "mqtt-broker", c.MQTTBroker, "MQTT 代理地址（如 tcp://localhost:1883、ssl://broker:8883），含检测目标的结果以 JSON 发布到 -mqtt-topic；为空时不发布")
+	fs.StringVar(&c.MQTTTopic, "mqtt-topic", c.MQTTTopic, "MQTT 发布主题")
+	fs.StringVar(&c.MQTTClientID, "mqtt-client-id", c.MQTTClientID, "MQTT 客户端ID，为空时为 yolo-go-detector-<主机名>-<进程号>")
+	fs.StringVar(&c.MQTTUsername, "mqtt-username", c.MQTTUsername, "MQTT 用户名")
+	fs.StringVar(&c.MQTTPassword, "mqtt-password", c.MQTTPassword, "MQTT 密码，为空时读取环境变量 MQTT_PASSWORD")
+	fs.StringVar(&c.MQTTCA, "mqtt-ca", c.MQTTCA, "ssl:// 连接信任的 CA 证书（PEM），为空时使用系统根证书")
+	fs.StringVar(&c.MQTTCert, "mqtt-cert", c.MQTTCert, "ssl:// 连接的客户端证书（PEM）")
+	fs.StringVar(&c.MQTTKey, "mqtt-key", c.MQTTKey, "ssl:// 连接的客户端私钥（PEM）")
+	fs.IntVar(&c.MQTTQoS, "mqtt-qos", c.MQTTQoS, "MQTT 发布的 QoS（0 或 1）")
+	fs.BoolVar(&c.MQTTRetain, "mqtt-retain", c.MQTTRetain, "以保留消息发布，新订阅者立即收到最近一次检测事件")
+	fs.StringVar(&c.MQTTClasses, "mqtt-classes", c.MQTTClasses, "只发布这些类别的检测目标（格式同 -classes），没有这些类别的结果不发布；为空时发布全部")
+	fs.StringVar(&c.KafkaBrokers, "kafka-brokers", c.KafkaBrokers, "Kafka 代理地址（逗号分隔的 host:port），每个结果作为一条消息写入 -kafka-topic；为空时不输出")
+	fs.StringVar(&c.KafkaTopic, "kafka-topic", c.KafkaTopic, "Kafka 主题")
+	fs.StringVar(&c.KafkaFormat, "kafka-format", c.KafkaFormat, "Kafka 消息格式：json（与 -format json 的记录相同）或 avro（二进制，schema 见 README）")
+	fs.StringVar(&c.KafkaKey, "kafka-key", c.KafkaKey, "Kafka 消息键：path（图像路径）或 camera（图像所在目录名，作为摄像头ID），同一键的消息写入同一分区")
+	fs.BoolVar(&c.KafkaPositiveOnly, "kafka-positive-only", c.KafkaPositiveOnly, "只输出含检测目标的结果，跳过无目标和处理失败的图像")
+	fs.IntVar(&c.KafkaBatchSize, "kafka-batch-size", c.KafkaBatchSize, "Kafka 每批发送的最大消息数")
+	fs.DurationVar(&c.KafkaLinger, "kafka-linger", c.KafkaLinger, "Kafka 批次未满时最长等待时间，到时发送已有消息")
+	fs.StringVar(&c.RedisAddr, "redis-addr", c.RedisAddr, "Redis 地址（host:port 或 redis://[:密码@]host:port[/db]），与 -redis-queue 一起指定时从队列领取任务；密码也可通过环境变量 REDIS_PASSWORD 指定")
+	fs.StringVar(&c.RedisQueue, "redis-queue", c.RedisQueue, "Redis 任务列表，其他服务 LPUSH 图像路径或 URL；指定后以队列消费模式运行，忽略 -img")
+	fs.StringVar(&c.RedisResults, "redis-results", c.RedisResults, "检测结果（JSON 记录）写入的 Redis 键，为空时为 <队列>:results")
+	fs.BoolVar(&c.RedisStream, "redis-stream", c.RedisStream, "结果以 XADD 写入 Redis Stream（字段 job、result），否则 LPUSH 到列表")
+	fs.StringVar(&c.RedisDeadLetter, "redis-dead-letter", c.RedisDeadLetter, "失败达到 -redis-max-attempts 次的任务移入的列表，为空时为 <队列>:dead")
+	fs.IntVar(&c.RedisMaxAttempts, "redis-max-attempts", c.RedisMaxAttempts, "同一任务最多处理的次数，失败未达到该次数时放回队列重试")
+	fs.StringVar(&c.DangerClasses, "danger-classes", c.DangerClasses, "危险类别（格式同 -classes）：摘要中的危险对象数、-fail-on-detect、-webhook-url 和 -on-detect-cmd 都按此判断；为空时所有检测到的对象都是危险对象")
+	fs.DurationVar(&c.AlertCooldown, "alert-cooldown", c.AlertCooldown, "同一目录（摄像头）的同一危险类别两次通知（Webhook 或外部命令）的最短间隔，0 表示每次检测到都通知")
+	fs.StringVar(&c.WebhookURL, "webhook-url", c.WebhookURL, "检测到危险对象时以 JSON POST 通知该地址；为空时不通知")
+	fs.IntVar(&c.WebhookRetries, "webhook-retries", c.WebhookRetries, "通知失败（网络错误或 5xx/429）时的最多重试次数，间隔从 1 秒翻倍")
+	fs.IntVar(&c.WebhookThumbnail, "webhook-thumbnail", c.WebhookThumbnail, "通知附带原图缩略图（JPEG base64）的长边像素数，0 表示不附带")
+	fs.StringVar(&c.OnDetectCmd, "on-detect-cmd", c.OnDetectCmd, "检测到危险对象时执行的命令（经 sh -c 执行，Windows 为 cmd /C），检测信息通过环境变量 DET_SOURCE、DET_COUNT、DET_CLASSES、DET_OUTPUT_PATH 传入；为空时不执行")
+	fs.DurationVar(&c.OnDetectTimeout, "on-detect-timeout", c.OnDetectTimeout, "-on-detect-cmd 单次执行的超时时间，超时后终止命令")
+
+	fs.StringVar(&c.Timezone, "timezone", c.Timezone, "报告和日志中时间戳使用的时区（如 Asia/Shanghai、UTC）")
+	fs.IntVar(&c.Precision, "precision", c.Precision, "报告中置信度保留的小数位数")
+
+	fs.StringVar(&c.ORTLibPath, "ort-lib", c.ORTLibPath, "ONNX Runtime共享库路径（覆盖按平台自动选择的路径，也可通过环境变量 "+ortLibEnv+" 设置）")
+	fs.BoolVar(&c.CPUArena, "cpu-arena", c.CPUArena, "是否启用CPU内存池（arena），关闭后RSS更平稳但分配开销略高")
+	fs.BoolVar(&c.MemPattern, "mem-pattern", c.MemPattern, "是否启用内存模式优化（按首次推理的分配模式预分配内存）")
+	fs.BoolVar(&c.LowMem, "low-mem", c.LowMem, "低内存模式：关闭CPU内存池和内存模式优化")
+	fs.IntVar(&c.IntraThreads, "intra-threads", c.IntraThreads, "单个算子内部的并行线程数，0 表示使用ONNX Runtime默认值（CPU核数）")
+	fs.IntVar(&c.InterThreads, "inter-threads", c.InterThreads, "算子之间的并行线程数（仅 -exec-mode parallel 时生效），0 表示使用默认值")
+	fs.StringVar(&c.ExecMode, "exec-mode", c.ExecMode, "执行模式 (sequential, parallel)")
+	fs.StringVar(&c.GraphOpt, "graph-opt", c.GraphOpt, "图优化级别 (disable, basic, extended, all)")
+
+	fs.StringVar(&c.AlertRules, "alert-rules", c.AlertRules, "告警规则文件（JSON），包含区域、类别、置信度、时间窗口和告警级别")
+	fs.StringVar(&c.SelftestImage, "selftest-image", c.SelftestImage, "自检使用的图像（selftest 子命令）")
+	fs.StringVar(&c.SelftestExpect, "selftest-expect", c.SelftestExpect, "自检期望结果文件（JSON），为空时使用内置的 bus.jpg 期望")
+	fs.DurationVar(&c.ReportInterval, "report-interval", c.ReportInterval, "长时间运行时输出分时段报告的间隔（如 10m）：帧数、各类别数量、告警数、耗时分位数和丢弃数，0 表示关闭")
+	fs.StringVar(&c.ReportFile, "report-file", c.ReportFile, "分时段报告追加写入的 JSON Lines 文件（也会写入 ndjson 输出），为空时只打印和写日志")
+	fs.DurationVar(&c.CanaryInterval, "canary-interval", c.CanaryInterval, "工作协程池运行期间金丝雀自检的间隔（如 5m），0 表示关闭")
+	fs.IntVar(&c.CanaryFailures, "canary-failures", c.CanaryFailures, "金丝雀自检连续失败多少次后发出告警并标记为未就绪")
+	fs.BoolVar(&c.Strict, "strict", c.Strict, "指定了在当前模式下不会生效或互相矛盾的参数时拒绝启动并列出所有问题，false 时只打印警告")
+	fs.StringVar(&c.ChildLocale, "child-locale", c.ChildLocale, "仅对子进程（如 ffmpeg、钩子脚本）设置的 LC_ALL，为空时子进程继承当前环境")
+}
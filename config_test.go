@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestLibraryRegistersNoGlobalFlags(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	// 只导入包（不调用 RegisterFlags）时，flag.CommandLine 中不应出现任何检测参数
+	fs := flag.NewFlagSet("detector", flag.ContinueOnError)
+	RegisterFlags(fs)
+	count := 0
+	fs.VisitAll(func(f *flag.Flag) {
+		count++
+		if flag.CommandLine.Lookup(f.Name) != nil {
+			t.Errorf("参数 -%s 注册到了 flag.CommandLine", f.Name)
+		}
+	})
+	if count == 0 {
+		t.Fatal("RegisterFlags 没有注册任何参数")
+	}
+
+	// 同一个宿主程序中可以有多个独立的参数集合
+	RegisterFlags(flag.NewFlagSet("other", flag.ContinueOnError))
+}
+
+func TestRegisterFlagsUpdatesConfig(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	tests := []struct {
+		name  string
+		args  []string
+		check func(c DetectorConfig) bool
+	}{
+		{"默认值", nil, func(c DetectorConfig) bool {
+			d := DefaultDetectorConfig()
+			return c.ConfThreshold == d.ConfThreshold && c.IOUThreshold == d.IOUThreshold && c.ModelPath == d.ModelPath
+		}},
+		{"-conf", []string{"-conf", "0.5"}, func(c DetectorConfig) bool { return c.ConfThreshold == 0.5 }},
+		{"-classes", []string{"-classes", "person,car"}, func(c DetectorConfig) bool { return c.Classes == "person,car" }},
+		{"多个 -model", []string{"-model", "a.onnx", "-model", "b.onnx"}, func(c DetectorConfig) bool { return c.ModelPath == "a.onnx,b.onnx" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = DefaultDetectorConfig()
+			fs := flag.NewFlagSet("detector", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			RegisterFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(config) {
+				t.Errorf("解析 %v 后配置不正确: %+v", tt.args, config)
+			}
+			// 包内的参数指针指向同一份配置
+			if *confidenceThreshold != config.ConfThreshold {
+				t.Errorf("confidenceThreshold = %v，配置中为 %v", *confidenceThreshold, config.ConfThreshold)
+			}
+		})
+	}
+}
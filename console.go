@@ -0,0 +1,18 @@
+package main
+
+import "os"
+
+// 子进程区域设置参数
+// 程序自身不修改 LC_ALL：Go 的输出始终是 UTF-8，修改进程环境变量会泄漏到所有子进程，
+// 在未生成对应 locale 的系统上导致告警或数字解析异常
+var childLocale = &config.ChildLocale
+
+// childProcessEnv 返回启动子进程时使用的环境变量
+// 配置了 -child-locale 时只在这里覆盖 LC_ALL，不影响当前进程
+func childProcessEnv() []string {
+	env := os.Environ()
+	if *childLocale == "" {
+		return env
+	}
+	return append(env, "LC_ALL="+*childLocale)
+}
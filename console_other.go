@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// setupConsoleUTF8 非 Windows 平台的终端默认使用 UTF-8，无需处理
+func setupConsoleUTF8() {}
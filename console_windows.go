@@ -0,0 +1,14 @@
+package main
+
+import "syscall"
+
+// utf8CodePage Windows UTF-8 代码页
+const utf8CodePage = 65001
+
+// setupConsoleUTF8 将控制台输出代码页切换为 UTF-8，避免中文在 cmd/PowerShell 中显示为乱码
+// 输出未连接到控制台（如重定向到文件）时调用会失败，忽略即可
+func setupConsoleUTF8() {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	kernel32.NewProc("SetConsoleOutputCP").Call(uintptr(utf8CodePage))
+	kernel32.NewProc("SetConsoleCP").Call(uintptr(utf8CodePage))
+}
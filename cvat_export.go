@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cvatOut 整次运行的检测结果导出为 CVAT for images 1.1 XML 的路径
+var cvatOut = &config.CVATOut
+
+// cvatAnnotations CVAT for images 1.1 格式的根元素
+type cvatAnnotations struct {
+	XMLName xml.Name    `xml:"annotations"`
+	Version string      `xml:"version"`
+	Meta    cvatMeta    `xml:"meta"`
+	Images  []cvatImage `xml:"image"`
+}
+
+type cvatMeta struct {
+	Task cvatTask `xml:"task"`
+}
+
+type cvatTask struct {
+	Name   string      `xml:"name"`
+	Size   int         `xml:"size"`
+	Mode   string      `xml:"mode"`
+	Labels []cvatLabel `xml:"labels>label"`
+}
+
+type cvatLabel struct {
+	Name       string `xml:"name"`
+	Attributes string `xml:"attributes"`
+}
+
+type cvatImage struct {
+	ID     int       `xml:"id,attr"`
+	Name   string    `xml:"name,attr"`
+	Width  int       `xml:"width,attr"`
+	Height int       `xml:"height,attr"`
+	Boxes  []cvatBox `xml:"box"`
+}
+
+// cvatBox 坐标为原图像素坐标，保留两位小数
+type cvatBox struct {
+	Label    string `xml:"label,attr"`
+	Occluded int    `xml:"occluded,attr"`
+	XTL      string `xml:"xtl,attr"`
+	YTL      string `xml:"ytl,attr"`
+	XBR      string `xml:"xbr,attr"`
+	YBR      string `xml:"ybr,attr"`
+	ZOrder   int    `xml:"z_order,attr"`
+}
+
+// cvatSink 汇总整次运行的检测结果，关闭时写出一个可导入 CVAT 的 annotations.xml
+// 与 cocoSink 一样挂在 resultSinks 上，各工作协程并发写入
+type cvatSink struct {
+	mutex  sync.Mutex
+	path   string
+	root   string               // 图像名称相对的输入根目录（structureRoot）
+	images map[string]cvatImage // 图像名称到检测结果，失败的图像不导出
+	closed bool
+}
+
+func newCVATSink(outputPath, input string) *cvatSink {
+	return &cvatSink{path: outputPath, root: structureRoot(input), images: make(map[string]cvatImage)}
+}
+
+func (s *cvatSink) Name() string { return "cvat:" + s.path }
+
+func (s *cvatSink) Write(record ResultRecord) error {
+	if record.Error != "" {
+		return nil
+	}
+	f := func(v float32) string { return strconv.FormatFloat(float64(v), 'f', 2, 32) }
+	img := cvatImage{Name: relativeImageName(s.root, record.ImagePath), Width: record.Width, Height: record.Height}
+	for _, d := range record.Detections {
+		img.Boxes = append(img.Boxes, cvatBox{Label: d.Label, XTL: f(d.Box[0]), YTL: f(d.Box[1]), XBR: f(d.Box[2]), YBR: f(d.Box[3])})
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	s.images[img.Name] = img
+	return nil
+}
+
+// Flush 结果只在关闭时整体写出
+func (s *cvatSink) Flush() error { return nil }
+
+// Close 按图像名称排序后从 0 开始编号（同样的输入每次得到相同的 id），标签列表取当前模型的类别表，
+// 原子写入 XML 文件
+func (s *cvatSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	names := make([]string, 0, len(s.images))
+	for name := range s.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	doc := cvatAnnotations{Version: "1.1"}
+	for i, name := range names {
+		img := s.images[name]
+		img.ID = i
+		doc.Images = append(doc.Images, img)
+	}
+	doc.Meta.Task = cvatTask{Name: cvatTaskName(s.root), Size: len(doc.Images), Mode: "annotation"}
+	for _, name := range ClassNames() {
+		doc.Meta.Task.Labels = append(doc.Meta.Task.Labels, cvatLabel{Name: name})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 CVAT XML 失败: %w", err)
+	}
+	return writeFileAtomic(s.path, func(f *os.File) error {
+		if _, err := f.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n"); err != nil {
+			return err
+		}
+		_, err := f.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// cvatTaskName 任务名称取输入根目录的名称
+func cvatTaskName(root string) string {
+	name := path.Base(strings.TrimSuffix(filepath.ToSlash(root), "/"))
+	if name == "." || name == "/" || name == "" {
+		if wd, err := os.Getwd(); err == nil {
+			name = filepath.Base(wd)
+		}
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCVATSinkFixture(t *testing.T) {
+	defer SetClassNames(nil)
+	SetClassNames([]string{"person", "car", "fork & knife"})
+	input := filepath.Join(t.TempDir(), "frames")
+	if err := os.Mkdir(input, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 写入顺序与工作协程完成顺序一致，是乱序的；失败的图像不导出
+	records := []ResultRecord{
+		{ImagePath: filepath.Join(input, "cam1", "0002.jpg"), Width: 1920, Height: 1080},
+		{ImagePath: filepath.Join(input, "broken.jpg"), Error: "解码失败"},
+		{ImagePath: filepath.Join(input, "0001.jpg"), Width: 640, Height: 480, Detections: []DetectionObject{
+			{Label: "person", Confidence: 0.9, Box: [4]float32{10, 20.5, 110.25, 220.75}},
+			{Label: "fork & knife", Confidence: 0.4, Box: [4]float32{0, 0, 5, 5}},
+		}},
+		{ImagePath: filepath.Join(input, "cam1", "0001.jpg"), Width: 1920, Height: 1080, Detections: []DetectionObject{
+			{Label: "car", Confidence: 0.8, Box: [4]float32{100, 200, 300.123, 400}},
+		}},
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "cvat", "annotations.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两次运行的写入顺序不同，输出相同
+	for _, order := range [][]int{{0, 1, 2, 3}, {3, 2, 1, 0}} {
+		out := filepath.Join(t.TempDir(), "annotations.xml")
+		sink := newCVATSink(out, input)
+		for _, i := range order {
+			if err := sink.Write(records[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(records[0]); err == nil {
+			t.Error("关闭后写入应返回错误")
+		}
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("写入顺序 %v 的输出与 testdata/cvat/annotations.xml 不一致:\n%s", order, got)
+		}
+	}
+}
+
+func TestCVATTaskName(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		root string
+		want string
+	}{
+		{"frames", "frames"},
+		{"data/frames/", "frames"},
+		{"s3://bucket/frames/", "frames"},
+		{".", filepath.Base(wd)},
+	}
+	for _, tt := range tests {
+		if got := cvatTaskName(tt.root); got != tt.want {
+			t.Errorf("cvatTaskName(%q) = %q，期望 %q", tt.root, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 危险对象通知的公共参数，-webhook-url 和 -on-detect-cmd 共用
+var (
+	dangerClasses = &config.DangerClasses
+	alertCooldown = &config.AlertCooldown
+)
+
+// parseDangerClasses 解析 -danger-classes，为空时返回 nil（所有类别都是危险类别）
+func parseDangerClasses() (*classFilter, error) {
+	filter, err := parseClassFilter(*dangerClasses, "")
+	if err != nil {
+		return nil, fmt.Errorf("解析 -danger-classes 失败: %w", err)
+	}
+	return filter, nil
+}
+
+// 已解析的危险类别缓存，参数和类别名称不变时不重复解析
+var (
+	dangerFilterMutex  sync.Mutex
+	dangerFilterKey    string
+	dangerFilterCached *classFilter
+)
+
+// activeDangerFilter 返回当前 -danger-classes 对应的过滤器，nil 表示所有类别都是危险类别；
+// 参数无效时同样返回 nil（命令行程序在启动时已校验）
+func activeDangerFilter() *classFilter {
+	key := fmt.Sprintf("%s|%d", *dangerClasses, currentClassNamesVersion())
+	dangerFilterMutex.Lock()
+	defer dangerFilterMutex.Unlock()
+	if key != dangerFilterKey {
+		filter, err := parseDangerClasses()
+		if err != nil {
+			writeLogFile("ERROR", err.Error())
+		}
+		dangerFilterKey, dangerFilterCached = key, filter
+	}
+	return dangerFilterCached
+}
+
+// dangerObjects 返回检测目标中属于危险类别的部分及按类别的计数
+func dangerObjects(filter *classFilter, detections []DetectionObject) ([]DetectionObject, map[string]int) {
+	var matched []DetectionObject
+	counts := make(map[string]int)
+	for _, d := range detections {
+		if filter.allows(d.Label) {
+			matched = append(matched, d)
+			counts[d.Label]++
+		}
+	}
+	return matched, counts
+}
+
+// sortedLabels 按名称排序的类别
+func sortedLabels(counts map[string]int) []string {
+	labels := make([]string, 0, len(counts))
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// alertDebouncer 同一目录（摄像头）的同一类别在 cooldown 内只通知一次，避免停着的车辆每帧都触发
+type alertDebouncer struct {
+	mutex    sync.Mutex
+	cooldown time.Duration
+	lastSent map[string]time.Time // 目录 + 类别 -> 上次通知时间
+}
+
+func newAlertDebouncer(cooldown time.Duration) *alertDebouncer {
+	return &alertDebouncer{cooldown: cooldown, lastSent: make(map[string]time.Time)}
+}
+
+// due 判断图像中是否有类别已过冷却期，有则更新这些类别的通知时间；cooldown 为 0 时总是通知
+func (d *alertDebouncer) due(imagePath string, counts map[string]int, now time.Time) bool {
+	if d.cooldown <= 0 {
+		return true
+	}
+	camera := cameraID(imagePath)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	due := false
+	for _, label := range sortedLabels(counts) {
+		key := camera + "\x00" + label
+		if last, ok := d.lastSent[key]; !ok || now.Sub(last) >= d.cooldown {
+			d.lastSent[key] = now
+			due = true
+		}
+	}
+	return due
+}
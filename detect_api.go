@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内存中图像数据的解码错误，可用 errors.Is 判断
+var (
+	ErrEmptyImage       = errors.New("图像数据为空")
+	ErrUnsupportedImage = errors.New("不支持的图像格式")
+	ErrCorruptImage     = errors.New("图像数据损坏")
+	ErrInvalidBase64    = errors.New("base64 编码无效")
+	ErrImageTooLarge    = errors.New("图像尺寸超过 -max-image-dim 限制")
+)
+
+// maxImageDim 解码前检查的图像宽高上限（像素），0 表示不限制
+var maxImageDim = &config.MaxImageDim
+
+// 内存检测接口共用的会话池，首次调用时按 -model 创建，大小与 -workers 相同
+var (
+	detectPool     *ModelSessionPool
+	detectPoolOnce sync.Once
+)
+
+func detectSessionPool() *ModelSessionPool {
+	detectPoolOnce.Do(func() {
+		detectPool = NewModelSessionPool(max(1, *workerCount), config.ModelPath)
+	})
+	return detectPool
+}
+
+// CloseDetectSessions 销毁内存检测接口创建的会话，之后的调用返回 ErrSessionPoolClosed
+func CloseDetectSessions() {
+	detectSessionPool().Close()
+}
+
+// decodeImage 解码图像数据：无法识别格式时返回 ErrUnsupportedImage，识别了格式但解码失败
+// （截断、数据损坏）时返回 ErrCorruptImage，均包装 image.Decode 的原始错误
+// 先用 image.DecodeConfig 读取文件头中的尺寸，宽或高超过 -max-image-dim 时返回 ErrImageTooLarge 而不解码像素，
+// 避免很小的压缩文件解码后占满内存；读取过的文件头缓存后与剩余数据一起解码，r 只读取一遍
+func decodeImage(r io.Reader) (image.Image, error) {
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, decodeError(format, err)
+	}
+	if limit := *maxImageDim; limit > 0 && (cfg.Width > limit || cfg.Height > limit) {
+		return nil, fmt.Errorf("%w: %dx%d（格式: %s）", ErrImageTooLarge, cfg.Width, cfg.Height, format)
+	}
+	img, format, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, decodeError(format, err)
+	}
+	return img, nil
+}
+
+func decodeError(format string, err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return fmt.Errorf("%w: %w", ErrUnsupportedImage, err)
+	}
+	return fmt.Errorf("%w（格式: %s）: %w", ErrCorruptImage, format, err)
+}
+
+// DetectReader 从 r 读取并检测一张图像（如网络连接、压缩包条目），不写临时文件
+// 与 DetectBytes 相同的解码检查和检测参数，返回与导出记录相同结构的检测目标
+func DetectReader(r io.Reader) ([]DetectionObject, error) {
+	img, err := decodeImage(r)
+	if err != nil {
+		return nil, err
+	}
+	record, err := detectPooled(context.Background(), "", img)
+	if err != nil {
+		return nil, err
+	}
+	detections := make([]DetectionObject, 0, len(record.Objects))
+	for _, box := range record.Objects {
+		detections = append(detections, newDetectionObject(box))
+	}
+	return detections, nil
+}
+
+// DetectImage 检测已解码的图像，返回检测框（原图坐标），不读写任何文件
+// 会话从进程内共用的会话池借用，可并发调用；需要绘制结果时把返回值交给 Annotate
+func DetectImage(img image.Image) ([]boundingBox, error) {
+	record, err := detectPooled(context.Background(), "", img)
+	if err != nil {
+		return nil, err
+	}
+	return record.Objects, nil
+}
+
+// DetectImage 使用调用方持有的会话检测已解码的图像（如视频流水线中每个协程各自的会话）
+// 会话不是并发安全的，被其他协程同时使用时返回 ErrSessionBusy
+func (session *ModelSession) DetectImage(img image.Image) ([]boundingBox, error) {
+	record, err := runDetection(context.Background(), session, "", img, newDetectionConfig())
+	if err != nil {
+		return nil, err
+	}
+	return record.Objects, nil
+}
+
+// DetectBytes 检测内存中的图像数据（JPEG、PNG、GIF），不读写任何文件
+// 与命令行检测使用相同的阈值、类别过滤等参数（newDetectionConfig），会话从进程内共用的会话池借用，可并发调用
+func DetectBytes(data []byte) (DetectionRecord, error) {
+	if len(data) == 0 {
+		return DetectionRecord{}, ErrEmptyImage
+	}
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return DetectionRecord{}, err
+	}
+	return detectPooled(context.Background(), "", img)
+}
+
+// DetectBase64 检测 base64 编码的图像数据，可带 data URL 前缀（如 data:image/jpeg;base64,...）
+func DetectBase64(s string) (DetectionRecord, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "data:") {
+		if _, payload, ok := strings.Cut(s, ","); ok {
+			s = payload
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// 兼容省略填充（=）的编码
+		if raw, rawErr := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "=")); rawErr == nil {
+			data, err = raw, nil
+		}
+	}
+	if err != nil {
+		return DetectionRecord{}, fmt.Errorf("%w: %w", ErrInvalidBase64, err)
+	}
+	return DetectBytes(data)
+}
+
+// detectPooled 从会话池借用会话执行检测，会话的归还方式与工作协程相同：
+// 推理失败时通过 PutSessionFailed 归还，panic 时销毁会话后继续向上抛出
+func detectPooled(ctx context.Context, imagePath string, img image.Image) (record DetectionRecord, err error) {
+	pool := detectSessionPool()
+	defer func(start time.Time) {
+		metrics.recordResult(DetectionResult{DetectionRecord: record, Error: err})
+		metrics.recordLatency(start)
+	}(time.Now())
+	session, err := pool.GetSession(ctx)
+	if err != nil {
+		return DetectionRecord{}, fmt.Errorf("获取模型会话失败: %w", err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			pool.discardSession(session)
+			panic(r)
+		}
+		if errors.Is(err, ErrSessionRunFailed) {
+			pool.PutSessionFailed(session)
+		} else {
+			pool.PutSession(session)
+		}
+	}()
+	return runDetection(ctx, session, imagePath, img, newDetectionConfig())
+}
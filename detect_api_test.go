@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+// encodeTestImage 编码一张 w×h 的随机图像
+func encodeTestImage(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := randomRGBA(image.Rect(0, 0, w, h), 1)
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeImage(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	jpegData := encodeTestImage(t, "jpeg", 64, 48)
+	pngData := encodeTestImage(t, "png", 64, 48)
+
+	tests := []struct {
+		name    string
+		reader  io.Reader
+		limit   int
+		wantErr error // nil 表示解码成功
+	}{
+		{"JPEG 逐字节读取", iotest.OneByteReader(bytes.NewReader(jpegData)), 16384, nil},
+		{"PNG", bytes.NewReader(pngData), 16384, nil},
+		{"尺寸等于上限", bytes.NewReader(pngData), 64, nil},
+		{"不限制尺寸", bytes.NewReader(pngData), 0, nil},
+		{"截断的 JPEG", bytes.NewReader(jpegData[:len(jpegData)/2]), 16384, ErrCorruptImage},
+		{"截断的 PNG", bytes.NewReader(pngData[:len(pngData)/2]), 16384, ErrCorruptImage},
+		{"只有文件头的 PNG", bytes.NewReader(pngData[:8]), 16384, ErrCorruptImage},
+		{"宽度超过上限", bytes.NewReader(pngData), 63, ErrImageTooLarge},
+		{"高度超过上限", bytes.NewReader(encodeTestImage(t, "jpeg", 32, 48)), 40, ErrImageTooLarge},
+		{"无法识别的格式", bytes.NewReader([]byte("not an image")), 16384, ErrUnsupportedImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.MaxImageDim = tt.limit
+			img, err := decodeImage(tt.reader)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("decodeImage() error = %v，期望 %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(64, 48) {
+				t.Errorf("解码后的尺寸 = %v", size)
+			}
+		})
+	}
+}
+
+func TestDetectReaderRejectsBadStreams(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	jpegData := encodeTestImage(t, "jpeg", 64, 48)
+
+	// 解码失败在创建会话之前返回
+	tests := []struct {
+		name    string
+		data    []byte
+		limit   int
+		wantErr error
+	}{
+		{"截断的流", jpegData[:len(jpegData)/3], 16384, ErrCorruptImage},
+		{"解压炸弹", jpegData, 32, ErrImageTooLarge},
+		{"空流", nil, 16384, ErrUnsupportedImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.MaxImageDim = tt.limit
+			if _, err := DetectReader(bytes.NewReader(tt.data)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DetectReader() error = %v，期望 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadImageFileUsesDecodeImage(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	path := filepath.Join(t.TempDir(), "frame.png")
+	if err := os.WriteFile(path, encodeTestImage(t, "png", 64, 48), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config.MaxImageDim = 0
+	if img, err := loadImageFile(path); err != nil || img.Bounds().Dx() != 64 {
+		t.Fatalf("loadImageFile() = %v, %v", img, err)
+	}
+	config.MaxImageDim = 32
+	if _, err := loadImageFile(path); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("loadImageFile() error = %v，期望 ErrImageTooLarge", err)
+	}
+}
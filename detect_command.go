@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 检测到危险对象时执行的外部命令参数
+var (
+	onDetectCmd     = &config.OnDetectCmd
+	onDetectTimeout = &config.OnDetectTimeout
+)
+
+const (
+	detectCommandQueueSize = 16   // 等待执行的事件数上限，命令执行太慢时超出的事件丢弃
+	detectCommandMaxOutput = 1024 // 失败时写入日志的命令输出长度上限（字节）
+)
+
+// detectCommand 未指定 -on-detect-cmd 时为 nil
+var detectCommand *detectCommandHook
+
+// detectEvent 一次触发外部命令的检测结果
+type detectEvent struct {
+	source     string
+	count      int
+	classes    []string
+	outputPath string
+}
+
+// detectCommandHook 检测到 -danger-classes 中的对象时执行 -on-detect-cmd（如本地警报脚本、截图上传）
+// 命令由单独的协程逐个执行（同一时刻最多一个），每次最长 -on-detect-timeout；同一目录的同一类别在 -alert-cooldown 内只触发一次。
+// 命令失败或超时只写日志，不影响检测
+type detectCommandHook struct {
+	mutex    sync.Mutex
+	command  string
+	timeout  time.Duration
+	filter   *classFilter
+	debounce *alertDebouncer
+	queue    chan detectEvent
+	done     chan struct{}
+	closed   bool
+	dropped  atomic.Int64 // 队列已满丢弃的事件数
+	failed   atomic.Int64 // 执行失败或超时的次数
+}
+
+// newDetectCommandHook 按 -on-detect-cmd 等参数创建外部命令钩子
+func newDetectCommandHook() (*detectCommandHook, error) {
+	filter, err := parseDangerClasses()
+	if err != nil {
+		return nil, err
+	}
+	if *onDetectTimeout <= 0 {
+		return nil, fmt.Errorf("-on-detect-timeout 必须大于 0")
+	}
+	h := &detectCommandHook{
+		command:  *onDetectCmd,
+		timeout:  *onDetectTimeout,
+		filter:   filter,
+		debounce: newAlertDebouncer(*alertCooldown),
+		queue:    make(chan detectEvent, detectCommandQueueSize),
+		done:     make(chan struct{}),
+	}
+	go h.loop()
+	return h, nil
+}
+
+// runDetectHook 一张图像处理完成（标注图像已保存时 outputPath 为其路径，否则为空）后调用，未指定 -on-detect-cmd 时不做任何事
+func runDetectHook(result DetectionResult, outputPath string) {
+	if detectCommand == nil || result.Error != nil {
+		return
+	}
+	detectCommand.fire(result, outputPath)
+}
+
+func (h *detectCommandHook) fire(result DetectionResult, outputPath string) {
+	counts := make(map[string]int)
+	count := 0
+	for _, box := range result.Objects {
+		if h.filter.allows(box.label) {
+			counts[box.label]++
+			count++
+		}
+	}
+	if count == 0 || !h.debounce.due(result.ImagePath, counts, time.Now()) {
+		return
+	}
+	event := detectEvent{source: result.ImagePath, count: count, classes: sortedLabels(counts), outputPath: outputPath}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return
+	}
+	select {
+	case h.queue <- event:
+	default:
+		if h.dropped.Add(1) == 1 {
+			writeLogFile("WARN", "-on-detect-cmd 执行太慢，等待队列已满，开始丢弃事件")
+		}
+	}
+}
+
+// loop 逐个执行命令
+func (h *detectCommandHook) loop() {
+	defer close(h.done)
+	for event := range h.queue {
+		if err := h.run(event); err != nil {
+			h.failed.Add(1)
+			writeLogFile("WARN", fmt.Sprintf("-on-detect-cmd 处理 %s 失败: %v", event.source, err))
+		}
+	}
+}
+
+// run 执行一次命令，检测信息通过环境变量传入
+func (h *detectCommandHook) run(event detectEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := shellCommand(ctx, h.command)
+	cmd.Env = append(os.Environ(),
+		"DET_SOURCE="+event.source,
+		"DET_COUNT="+strconv.Itoa(event.count),
+		"DET_CLASSES="+strings.Join(event.classes, ","),
+		"DET_OUTPUT_PATH="+event.outputPath,
+	)
+	cmd.WaitDelay = time.Second // 命令的子进程继承了输出管道时不无限等待
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("超过 %v 未结束，已终止", h.timeout)
+	}
+	if out := strings.TrimSpace(string(output)); out != "" {
+		if len(out) > detectCommandMaxOutput {
+			out = out[:detectCommandMaxOutput] + "..."
+		}
+		err = fmt.Errorf("%w，输出: %s", err, out)
+	}
+	return err
+}
+
+// shellCommand 通过系统 shell 执行命令行（sh -c，Windows 为 cmd /C），命令中可以使用管道和 $DET_* 变量
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// Close 停止接收事件，等待已排队的命令执行完（最多 -shutdown-timeout）
+func (h *detectCommandHook) Close() error {
+	h.mutex.Lock()
+	if h.closed {
+		h.mutex.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mutex.Unlock()
+
+	select {
+	case <-h.done:
+	case <-time.After(*shutdownTimeout):
+		return fmt.Errorf("等待 -on-detect-cmd 执行完成超时")
+	}
+	if dropped, failed := h.dropped.Load(), h.failed.Load(); dropped+failed > 0 {
+		return fmt.Errorf("-on-detect-cmd %d 次执行失败，%d 个事件因队列已满被丢弃（详见日志）", failed, dropped)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// detectStub 写出记录 DET_* 环境变量的 shell 脚本；执行期间存在 lock 文件，用于发现并发执行
+func detectStub(t *testing.T) (command, logPath string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell 脚本桩需要 sh")
+	}
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "calls.log")
+	script := filepath.Join(dir, "siren.sh")
+	stub := `#!/bin/sh
+lock="$(dirname "$0")/lock"
+[ -e "$lock" ] && echo overlap >> "` + logPath + `"
+touch "$lock"
+sleep 0.05
+echo "$DET_SOURCE|$DET_COUNT|$DET_CLASSES|$DET_OUTPUT_PATH" >> "` + logPath + `"
+rm "$lock"
+`
+	if err := os.WriteFile(script, []byte(stub), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script, logPath
+}
+
+// readCalls 返回脚本记录的每次调用
+func readCalls(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func detectResult(imagePath string, labels ...string) DetectionResult {
+	var result DetectionResult
+	result.ImagePath = imagePath
+	for _, label := range labels {
+		result.Objects = append(result.Objects, boundingBox{label: label, confidence: 0.9})
+	}
+	return result
+}
+
+func TestDetectCommandHook(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.DangerClasses = "person,truck"
+	config.OnDetectTimeout = 10 * time.Second
+
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		fire     func(h *detectCommandHook)
+		want     []string
+	}{
+		{"环境变量", 0, func(h *detectCommandHook) {
+			h.fire(detectResult("cam1/0001.jpg", "truck", "dog", "person", "truck"), "out/0001_detected.jpg")
+		}, []string{"cam1/0001.jpg|3|person,truck|out/0001_detected.jpg"}},
+		{"没有标注图像时输出路径为空", 0, func(h *detectCommandHook) {
+			h.fire(detectResult("cam1/0001.jpg", "person"), "")
+		}, []string{"cam1/0001.jpg|1|person|"}},
+		{"没有危险类别时不执行", 0, func(h *detectCommandHook) {
+			h.fire(detectResult("cam1/0001.jpg", "dog", "cat"), "out.jpg")
+			h.fire(detectResult("cam1/0002.jpg"), "out.jpg")
+		}, nil},
+		{"逐个执行", 0, func(h *detectCommandHook) {
+			for _, source := range []string{"cam1/0001.jpg", "cam1/0002.jpg", "cam1/0003.jpg"} {
+				h.fire(detectResult(source, "person"), "")
+			}
+		}, []string{"cam1/0001.jpg|1|person|", "cam1/0002.jpg|1|person|", "cam1/0003.jpg|1|person|"}},
+		{"冷却期内同一摄像头只执行一次", time.Minute, func(h *detectCommandHook) {
+			h.fire(detectResult("cam1/0001.jpg", "truck"), "")
+			h.fire(detectResult("cam1/0002.jpg", "truck"), "")
+			h.fire(detectResult("cam2/0001.jpg", "truck"), "")
+		}, []string{"cam1/0001.jpg|1|truck|", "cam2/0001.jpg|1|truck|"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, logPath := detectStub(t)
+			config.OnDetectCmd = command
+			config.AlertCooldown = tt.cooldown
+			hook, err := newDetectCommandHook()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.fire(hook)
+			if err := hook.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if calls := readCalls(t, logPath); !slices.Equal(calls, tt.want) {
+				t.Errorf("调用 = %q，期望 %q", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDetectHook(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	defer func(saved *detectCommandHook) { detectCommand = saved }(detectCommand)
+	config.DangerClasses = "person"
+	config.AlertCooldown = 0
+	config.OnDetectTimeout = 10 * time.Second
+	command, logPath := detectStub(t)
+	config.OnDetectCmd = command
+
+	// 未指定 -on-detect-cmd 时不执行
+	detectCommand = nil
+	runDetectHook(detectResult("cam1/0001.jpg", "person"), "")
+
+	hook, err := newDetectCommandHook()
+	if err != nil {
+		t.Fatal(err)
+	}
+	detectCommand = hook
+	failed := detectResult("cam1/0002.jpg", "person")
+	failed.Error = os.ErrNotExist
+	runDetectHook(failed, "")
+	runDetectHook(detectResult("cam1/0003.jpg", "person"), "out.jpg")
+	if err := hook.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := readCalls(t, logPath); !slices.Equal(calls, []string{"cam1/0003.jpg|1|person|out.jpg"}) {
+		t.Errorf("调用 = %q，期望只有处理成功的 cam1/0003.jpg", calls)
+	}
+}
+
+func TestDetectCommandFailures(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	if runtime.GOOS == "windows" {
+		t.Skip("命令使用 sh 语法")
+	}
+	config.DangerClasses = "person"
+	config.AlertCooldown = 0
+
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		output  string // 错误中应包含的内容
+	}{
+		{"命令失败", `echo "siren offline: $DET_SOURCE" >&2; exit 3`, 10 * time.Second, "siren offline: cam1/0001.jpg"},
+		{"命令不存在", "/nonexistent/siren", 10 * time.Second, "nonexistent"},
+		{"超时", "sleep 5", 100 * time.Millisecond, "已终止"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.OnDetectCmd, config.OnDetectTimeout = tt.command, tt.timeout
+			hook, err := newDetectCommandHook()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 命令在后台执行，检测流程不等待命令结束
+			start := time.Now()
+			hook.fire(detectResult("cam1/0001.jpg", "person"), "")
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Errorf("fire 耗时 %v", elapsed)
+			}
+			if err := hook.run(detectEvent{source: "cam1/0001.jpg", count: 1, classes: []string{"person"}}); err == nil || !strings.Contains(err.Error(), tt.output) {
+				t.Errorf("run() error = %v，期望包含 %q", err, tt.output)
+			}
+			if elapsed := time.Since(start); elapsed > 4*time.Second {
+				t.Errorf("命令执行了 %v，没有在超时后终止", elapsed)
+			}
+			if err := hook.Close(); err == nil || hook.failed.Load() != 1 {
+				t.Errorf("Close() = %v，失败 %d 次，期望 1 次", err, hook.failed.Load())
+			}
+		})
+	}
+}
+
+func TestNewDetectCommandHookRejectsBadConfig(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		name    string
+		classes string
+		timeout time.Duration
+	}{
+		{"超时为 0", "person", 0},
+		{"未知的危险类别", "siren", time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.OnDetectCmd, config.DangerClasses, config.OnDetectTimeout = "true", tt.classes, tt.timeout
+			if hook, err := newDetectCommandHook(); err == nil {
+				hook.Close()
+				t.Error("newDetectCommandHook() 应返回错误")
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"time"
+)
+
+// DetectionConfig 单张图像检测的参数
+type DetectionConfig struct {
+	ConfThreshold float32      // 置信度阈值
+	IOUThreshold  float32      // NMS 的 IOU 阈值
+	Augment       bool         // 是否启用测试时增强（原图 + TTAOps 中的各种变换）
+	TTAOps        []string     // 测试时增强的变换（flipH, flipV, rot90, rot180, rot270）
+	TTAMerge      string       // 测试时增强结果的合并方式（nms, wbf）
+	DecodeConf    float32      // 每次推理解码时的置信度阈值，为 0 时等于 ConfThreshold
+	TopK          int          // 分类模式输出的前K个类别
+	MaxDet        int          // 每张图像最多保留的检测框数量，0 表示不限制
+	Classes       *classFilter // 类别过滤器，nil 表示不过滤
+	Danger        *classFilter // 危险类别（-danger-classes），决定摘要和 DangerCount，nil 表示所有类别
+}
+
+// decodeThreshold 返回每次推理解码时使用的置信度阈值
+func (cfg DetectionConfig) decodeThreshold() float32 {
+	if cfg.DecodeConf > 0 {
+		return cfg.DecodeConf
+	}
+	return cfg.ConfThreshold
+}
+
+// newDetectionConfig 根据命令行参数生成检测参数
+func newDetectionConfig() DetectionConfig {
+	return DetectionConfig{
+		ConfThreshold: float32(*confidenceThreshold),
+		IOUThreshold:  float32(*iouThreshold),
+		Augment:       *useAugment,
+		TTAOps:        activeTTAOps(),
+		TTAMerge:      *ttaMerge,
+		DecodeConf:    ttaDecodeThreshold(float32(*confidenceThreshold), *useAugment),
+		TopK:          *classifyTopK,
+		MaxDet:        *maxDetections,
+		Classes:       activeClassFilter(),
+		Danger:        activeDangerFilter(),
+	}
+}
+
+// DetectionRecord 单张图像的结构化检测结果
+// 命令行单图路径和工作协程池都通过 runDetection 生成，保证两条路径的行为一致
+type DetectionRecord struct {
+	ImagePath       string
+	Width, Height   int // 原图尺寸
+	Objects         []boundingBox
+	Classifications []ClassPrediction // 分类模式（-task classify）的前K个类别
+	DangerCount     int               // 危险对象个数
+	Summary         string            // 检测结果摘要
+	Alerts          []AlertEvent      // 触发的告警事件
+}
+
+// inferenceSession runDetection 和 inferBoxes 使用的会话操作，由 *ModelSession 实现
+// 测试中替换为不依赖 ONNX Runtime 的实现
+type inferenceSession interface {
+	acquire() error
+	release()
+	input() []float32                                     // 输入张量的数据，预处理直接写入
+	output() []float32                                    // 主输出张量的数据，推理后读取
+	layout() outputLayout                                 // 主输出的排布，inspectOutput 之后可能改变
+	runRetry(ctx context.Context) error                   // 执行推理，失败时按 -retry-attempts 重试
+	inspectOutput(output []float32) error                 // 首次推理后探测输出排布，并按 -output-guard 检查输出
+	attachMasks(boxes []boundingBox, scaleInfo ScaleInfo) // 分割模型为检测框附加掩码
+	// fuseMembers 多模型集成推理时用同一份输入运行其他模型，与 boxes 按 -ensemble-fusion 融合
+	fuseMembers(boxes []boundingBox, width, height int, scaleInfo ScaleInfo, cfg DetectionConfig) ([]boundingBox, error)
+}
+
+// runDetection 在给定会话上执行 预处理→推理→解码 的完整流程，并统一生成摘要和告警
+// 整个流程独占会话，会话正在被其他协程使用时返回 ErrSessionBusy
+// 各阶段之间检查 ctx，已取消时直接返回 ctx.Err()
+func runDetection(ctx context.Context, session inferenceSession, imagePath string, img image.Image, cfg DetectionConfig) (DetectionRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return DetectionRecord{}, err
+	}
+	if err := session.acquire(); err != nil {
+		return DetectionRecord{}, err
+	}
+	defer session.release()
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// 分类模型：输出前K个类别而不是边界框
+	if session.layout().Format == formatCls {
+		start := time.Now()
+		if _, err := fillInputData(img, session.input()); err != nil {
+			return DetectionRecord{}, fmt.Errorf("准备输入失败: %w", err)
+		}
+		observeStage(stagePreprocess, start)
+		if err := ctx.Err(); err != nil {
+			return DetectionRecord{}, err
+		}
+		start = time.Now()
+		if err := session.runRetry(ctx); err != nil {
+			return DetectionRecord{}, err
+		}
+		observeStage(stageInference, start)
+		output := session.output()
+		if err := session.inspectOutput(output); err != nil {
+			return DetectionRecord{}, err
+		}
+		start = time.Now()
+		predictions := processClassOutput(output, session.layout(), cfg.TopK)
+		observeStage(stagePostprocess, start)
+		return newClassificationRecord(imagePath, width, height, predictions), nil
+	}
+
+	boxes, err := inferBoxes(ctx, session, img, cfg)
+	if err != nil {
+		return DetectionRecord{}, err
+	}
+
+	// 测试时增强：按 -tta-ops 对图像做变换后分别推理，结果变换回原图坐标后按 -tta-merge 与原图结果合并
+	if cfg.Augment {
+		passes, err := augmentedPasses(ctx, session, img, cfg)
+		if err != nil {
+			return DetectionRecord{}, err
+		}
+		boxes = mergeTTABoxes(append([][]boundingBox{boxes}, passes...), cfg)
+	}
+
+	return newDetectionRecord(imagePath, width, height, boxes, cfg), nil
+}
+
+// inferBoxes 对单张图像推理并解码边界框（分割模型同时解码掩码）
+// 配置了多个模型时，所有模型使用同一份预处理输入，结果按 -ensemble-fusion 融合
+// 调用方需已通过 acquire 取得会话的使用权；推理前后检查 ctx，已取消时返回 ctx.Err()
+func inferBoxes(ctx context.Context, session inferenceSession, img image.Image, cfg DetectionConfig) ([]boundingBox, error) {
+	start := time.Now()
+	scaleInfo, err := fillInputData(img, session.input())
+	if err != nil {
+		return nil, fmt.Errorf("准备输入失败: %w", err)
+	}
+	observeStage(stagePreprocess, start)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	start = time.Now()
+	if err := session.runRetry(ctx); err != nil {
+		return nil, err
+	}
+	observeStage(stageInference, start)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	output := session.output()
+	if err := session.inspectOutput(output); err != nil {
+		return nil, err
+	}
+	start = time.Now()
+	boxes := processOutput(output, session.layout(), img.Bounds().Dx(), img.Bounds().Dy(),
+		cfg.decodeThreshold(), cfg.IOUThreshold, cfg.MaxDet, cfg.Classes, scaleInfo)
+	session.attachMasks(boxes, scaleInfo)
+	observeStage(stagePostprocess, start)
+	return session.fuseMembers(boxes, img.Bounds().Dx(), img.Bounds().Dy(), scaleInfo, cfg)
+}
+
+// newDetectionRecord 由解码后的边界框生成检测记录：危险对象摘要和告警在这里统一计算
+// 类别过滤已在 processOutput 中（NMS 之前）完成，被过滤的类别不计数、不绘制也不导出；
+// 测试时增强和多模型融合可能合并出超过 cfg.MaxDet 个框，这里按 cfg.MaxDet 截断（单次推理时不会超过，截断不生效）
+func newDetectionRecord(imagePath string, width, height int, boxes []boundingBox, cfg DetectionConfig) DetectionRecord {
+	boxes = capDetections(boxes, cfg.MaxDet)
+	num, summary := summarizeDetections(boxes, cfg.Danger)
+	return DetectionRecord{
+		ImagePath:   imagePath,
+		Width:       width,
+		Height:      height,
+		Objects:     boxes,
+		DangerCount: num,
+		Summary:     summary,
+		Alerts:      reportAlerts(imagePath, boxes),
+	}
+}
+
+// newClassificationRecord 由分类结果生成检测记录，摘要为前K个类别及其概率
+func newClassificationRecord(imagePath string, width, height int, predictions []ClassPrediction) DetectionRecord {
+	parts := make([]string, len(predictions))
+	for i, p := range predictions {
+		parts[i] = fmt.Sprintf("%s(%s)", p.Label, formatConfidence(p.Probability))
+	}
+	return DetectionRecord{
+		ImagePath:       imagePath,
+		Width:           width,
+		Height:          height,
+		Classifications: predictions,
+		Summary:         strings.Join(parts, ", "),
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// saveJSON 在标注图像旁保存同名 .json 检测结果
+var saveJSON = &config.SaveJSON
+
+// DetectionJSON 单张图像的 JSON 检测结果（-save-json）
+// 与 -sink、-format json 等导出的 ResultRecord 结构和版本号（schema_version）相同，另外记录生成结果时的模型和阈值
+type DetectionJSON struct {
+	ResultRecord
+	Model         string  `json:"model"`
+	ConfThreshold float64 `json:"conf_threshold"`
+	IOUThreshold  float64 `json:"iou_threshold"`
+}
+
+// newDetectionJSON 由检测结果生成 JSON 结果，模型和阈值取命令行参数
+func newDetectionJSON(record DetectionRecord) DetectionJSON {
+	return DetectionJSON{
+		ResultRecord:  newResultRecord(DetectionResult{DetectionRecord: record}),
+		Model:         config.ModelPath,
+		ConfThreshold: *confidenceThreshold,
+		IOUThreshold:  *iouThreshold,
+	}
+}
+
+// detectionJSONPath JSON 结果的路径：与标注图像同名，扩展名为 .json
+func detectionJSONPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".json"
+}
+
+// writeDetectionJSON 开启 -save-json（或标注图像上传到 S3 且开启 -s3-upload-json）时，
+// 把检测结果写入标注图像旁的同名 .json 文件，s3:// 输出上传到同名对象
+func writeDetectionJSON(record DetectionRecord, outputPath string) error {
+	if !*saveJSON && !(isS3Path(outputPath) && *s3UploadJSON) {
+		return nil
+	}
+	data, err := json.MarshalIndent(newDetectionJSON(record), "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化检测结果失败: %w", err)
+	}
+	jsonPath := detectionJSONPath(outputPath)
+	if isS3Path(jsonPath) {
+		err = uploadS3(jsonPath, data, "application/json")
+	} else {
+		err = writeFileAtomic(jsonPath, func(f *os.File) error {
+			_, err := f.Write(append(data, '\n'))
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("保存检测结果 JSON 失败: %w", err)
+	}
+	return nil
+}
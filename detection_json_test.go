@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "用当前输出覆盖 testdata 中的 golden 文件")
+
+func TestDetectionJSONGolden(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.ModelPath = "third_party/yolo11x.onnx"
+	config.ConfThreshold = 0.25
+	config.IOUThreshold = 0.7
+
+	tests := []struct {
+		name   string
+		record DetectionRecord
+	}{
+		{"detections", DetectionRecord{
+			ImagePath: "assets/bus.jpg", Width: 810, Height: 1080,
+			Objects: []boundingBox{
+				{label: "bus", confidence: 0.94, x1: 22, y1: 231, x2: 805, y2: 756},
+				{label: "person", confidence: 0.89, x1: 48, y1: 398, x2: 245, y2: 902},
+				{label: "class_99", confidence: 0.3, x1: 1, y1: 2, x2: 3, y2: 4},
+			},
+		}},
+		{"empty", DetectionRecord{ImagePath: "assets/empty.jpg", Width: 640, Height: 480}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := newDetectionJSON(tt.record)
+			doc.Timestamp = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+			got, err := json.MarshalIndent(doc, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "detection_json", tt.name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("输出与 %s 不一致（字段只允许新增，确认后用 -update 更新）:\n%s", golden, got)
+			}
+
+			// 与其他导出共用 ResultRecord：按任意版本的检测记录解析后与原记录一致
+			record, err := decodeResultRecord(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.SchemaVersion != ResultSchemaVersion || len(record.Detections) != len(tt.record.Objects) {
+				t.Errorf("解析出的记录 = %+v", record)
+			}
+		})
+	}
+}
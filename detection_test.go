@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSession 不依赖 ONNX Runtime 的 inferenceSession：runRetry 把 result 复制到输出缓冲
+// 使用权（acquire/release）沿用 ModelSession 的实现
+type fakeSession struct {
+	ModelSession
+	in, out []float32
+	result  []float32
+	lay     outputLayout
+	runErr  error
+	runs    int
+	onRun   func() // 推理时调用（在复制 result 之前），用于让推理停在中途
+}
+
+// newFakeSession 创建输出排布为 layout、每次推理输出 result 的会话，输入缓冲按 -imgsz 分配
+func newFakeSession(result []float32, layout outputLayout) *fakeSession {
+	return &fakeSession{
+		in:     make([]float32, 3**modelInputSize**modelInputSize),
+		out:    make([]float32, len(result)),
+		result: result,
+		lay:    layout,
+	}
+}
+
+func (f *fakeSession) input() []float32                                     { return f.in }
+func (f *fakeSession) output() []float32                                    { return f.out }
+func (f *fakeSession) layout() outputLayout                                 { return f.lay }
+func (f *fakeSession) inspectOutput(output []float32) error                 { return nil }
+func (f *fakeSession) attachMasks(boxes []boundingBox, scaleInfo ScaleInfo) {}
+
+func (f *fakeSession) runRetry(ctx context.Context) error {
+	f.runs++
+	if f.onRun != nil {
+		f.onRun()
+	}
+	if f.runErr != nil {
+		return sessionRunError(f.runErr)
+	}
+	copy(f.out, f.result)
+	return nil
+}
+
+func (f *fakeSession) fuseMembers(boxes []boundingBox, width, height int, scaleInfo ScaleInfo, cfg DetectionConfig) ([]boundingBox, error) {
+	return boxes, nil
+}
+
+// inputImage 与模型输入尺寸相同的图像，预处理不缩放也不填充，输出坐标即原图坐标
+func inputImage() image.Image {
+	return image.NewRGBA(image.Rect(0, 0, *modelInputSize, *modelInputSize))
+}
+
+func TestSummarizeDetections(t *testing.T) {
+	danger, err := parseClassFilter("person,car,motorcycle,bus,truck", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	person := boundingBox{label: "person", confidence: 0.9, x2: 10, y2: 10}
+	dog := boundingBox{label: "dog", confidence: 0.8, x2: 10, y2: 10}
+
+	tests := []struct {
+		name    string
+		boxes   []boundingBox
+		danger  *classFilter
+		count   int
+		summary string
+	}{
+		{"没有检测结果", nil, danger, 0, "未检测到任何对象"},
+		{"只有其他对象", []boundingBox{dog, dog}, danger, 0, "未检测到危险对象（检测到其他对象 2 个）"},
+		{"危险对象和其他对象", []boundingBox{dog, person}, danger, 1, " AI分析到危险对象共有 1 个, 对象1: person(人员)"},
+		{"未设置危险类别", []boundingBox{dog, person}, nil, 2, " AI分析到危险对象共有 2 个, 对象1: dog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, summary := summarizeDetections(tt.boxes, tt.danger)
+			if count != tt.count {
+				t.Errorf("危险对象数 = %d, 期望 %d", count, tt.count)
+			}
+			if !strings.HasPrefix(summary, tt.summary) {
+				t.Errorf("摘要 = %q, 期望以 %q 开头", summary, tt.summary)
+			}
+			if strings.Contains(summary, "dog") && tt.danger != nil {
+				t.Errorf("摘要中出现了非危险类别: %q", summary)
+			}
+		})
+	}
+}
+
+func TestNewDetectionRecordDangerCount(t *testing.T) {
+	danger, err := parseClassFilter("person", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := []boundingBox{
+		{label: "car", confidence: 0.9, x2: 10, y2: 10},
+		{label: "person", confidence: 0.8, x2: 10, y2: 10},
+	}
+	record := newDetectionRecord("a.jpg", 100, 100, boxes, DetectionConfig{Danger: danger})
+	if record.DangerCount != 1 {
+		t.Errorf("DangerCount = %d, 期望 1（只有 person 是危险类别）", record.DangerCount)
+	}
+	if len(record.Objects) != 2 {
+		t.Errorf("Objects = %d 个, 期望 2（危险类别不影响保留的检测框）", len(record.Objects))
+	}
+}
+
+func TestRunDetectionDecodesSessionOutput(t *testing.T) {
+	output, layout := v8Output([]string{"person", "car"}, []testAnchor{
+		{cx: 50, cy: 50, w: 20, h: 40, class: 0, conf: 0.9},
+		{cx: 200, cy: 200, w: 60, h: 30, class: 1, conf: 0.6},
+		{cx: 400, cy: 400, w: 10, h: 10, class: 1, conf: 0.1},
+	})
+	persons, err := parseClassFilter("person", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cfg    DetectionConfig
+		labels []string
+	}{
+		{"低于阈值的框被丢弃", DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45}, []string{"person", "car"}},
+		{"提高阈值", DetectionConfig{ConfThreshold: 0.7, IOUThreshold: 0.45}, []string{"person"}},
+		{"类别过滤", DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45, Classes: persons}, []string{"person"}},
+		{"数量上限", DetectionConfig{ConfThreshold: 0.05, IOUThreshold: 0.45, MaxDet: 2}, []string{"person", "car"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newFakeSession(output, layout)
+			record, err := runDetection(context.Background(), session, "a.jpg", inputImage(), tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.runs != 1 {
+				t.Errorf("推理 %d 次，期望 1 次", session.runs)
+			}
+			if record.Width != *modelInputSize || record.Height != *modelInputSize {
+				t.Errorf("尺寸 = %dx%d", record.Width, record.Height)
+			}
+			var labels []string
+			for _, box := range record.Objects {
+				labels = append(labels, box.label)
+			}
+			if strings.Join(labels, ",") != strings.Join(tt.labels, ",") {
+				t.Errorf("检测结果 = %v，期望 %v", labels, tt.labels)
+			}
+		})
+	}
+
+	session := newFakeSession(output, layout)
+	boxes, err := inferBoxes(context.Background(), session, inputImage(), DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if box := boxes[0]; box.x1 != 40 || box.y1 != 30 || box.x2 != 60 || box.y2 != 70 {
+		t.Errorf("person 框 = [%v %v %v %v]，期望 [40 30 60 70]", box.x1, box.y1, box.x2, box.y2)
+	}
+}
+
+func TestRunDetectionErrors(t *testing.T) {
+	output, layout := v8Output([]string{"person"}, []testAnchor{{cx: 50, cy: 50, w: 20, h: 40, conf: 0.9}})
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	runFailure := errors.New("显存不足")
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		runErr error
+		want   error
+		runs   int
+	}{
+		{"已取消时不推理", cancelled, nil, context.Canceled, 0},
+		{"推理失败", context.Background(), runFailure, ErrSessionRunFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newFakeSession(output, layout)
+			session.runErr = tt.runErr
+			_, err := runDetection(tt.ctx, session, "a.jpg", inputImage(), DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("错误 = %v，期望 %v", err, tt.want)
+			}
+			if tt.runErr != nil && !errors.Is(err, tt.runErr) {
+				t.Errorf("错误 = %v，期望包含推理返回的错误", err)
+			}
+			if session.runs != tt.runs {
+				t.Errorf("推理 %d 次，期望 %d 次", session.runs, tt.runs)
+			}
+			if err := session.acquire(); err != nil {
+				t.Errorf("失败后会话仍被占用: %v", err)
+			}
+		})
+	}
+}
+
+// recordingSink 记录写入的检测记录
+type recordingSink struct {
+	mutex   sync.Mutex
+	records []ResultRecord
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+func (s *recordingSink) Flush() error { return nil }
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) Write(record ResultRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestCLIAndWorkerDetectionParity(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	defer func(saved *sinkSet) { resultSinks = saved }(resultSinks)
+
+	// 800x600 的图像：letterbox 缩放 0.8，上下各填充 80，检测框需要映射回原图坐标
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "frame.png")
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 800, 600))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	output, layout := v8Output(COCOClasses(), []testAnchor{
+		{cx: 100, cy: 200, w: 40, h: 80, class: 0, conf: 0.9},
+		{cx: 300, cy: 300, w: 120, h: 60, class: 2, conf: 0.6},
+		{cx: 500, cy: 400, w: 30, h: 30, class: 16, conf: 0.4},
+	})
+
+	tests := []struct {
+		name string
+		set  func(c *DetectorConfig)
+	}{
+		{"默认参数", func(c *DetectorConfig) {}},
+		{"-conf 0.5", func(c *DetectorConfig) { c.ConfThreshold = 0.5 }},
+		{"-classes person,dog", func(c *DetectorConfig) { c.Classes = "person,dog" }},
+		{"-max-det 1", func(c *DetectorConfig) { c.MaxDet = 1 }},
+		{"-danger-classes car", func(c *DetectorConfig) { c.DangerClasses = "car" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = DefaultDetectorConfig()
+			tt.set(&config)
+			sink := &recordingSink{}
+			resultSinks = &sinkSet{sinks: []ResultSink{sink}}
+
+			// 命令行入口
+			dangerCount, summary, err := detectImageWithSession(newFakeSession(output, layout), imagePath, filepath.Join(dir, "frame_detected.jpg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sink.records) != 1 {
+				t.Fatalf("命令行入口写出 %d 条记录，期望 1 条", len(sink.records))
+			}
+			cli := sink.records[0]
+
+			// 工作协程入口
+			task := &DetectionTask{ImagePath: imagePath}
+			cfg, err := newDetectionConfig().withParams(task.Params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record, _, err := detectTask(context.Background(), newFakeSession(output, layout), task, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			worker := newResultRecord(DetectionResult{DetectionRecord: record})
+
+			cli.Timestamp, worker.Timestamp = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(cli, worker) {
+				t.Errorf("两个入口的检测记录不同\n命令行:   %+v\n工作协程: %+v", cli, worker)
+			}
+			if dangerCount != record.DangerCount || summary != record.Summary {
+				t.Errorf("摘要不同: 命令行 %d %q，工作协程 %d %q", dangerCount, summary, record.DangerCount, record.Summary)
+			}
+			if len(worker.Detections) == 0 {
+				t.Error("没有检测结果，用例没有覆盖检测框的解码")
+			}
+		})
+	}
+}
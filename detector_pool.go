@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"math"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -10,44 +14,119 @@ import (
 
 // DetectionResult 检测结果
 type DetectionResult struct {
-	ImagePath string
-	Objects   []boundingBox
-	Error     error
-	Metadata  map[string]interface{} // 额外元数据
+	DetectionRecord
+	TaskID   uint64 // 对应任务的 TaskID，未经 SubmitTask 提交的结果为 0
+	Error    error
+	Metadata map[string]interface{} // 额外元数据
+	Elapsed  time.Duration          // 推理阶段耗时（含图像加载和后处理，批次推理时为组内平均值）
+
+	thumbnail string // -ws-thumbnail 的缩略图（JPEG base64），由工作协程在图像仍在内存中时生成
+}
+
+// failedResult 生成处理失败的检测结果
+func failedResult(imagePath string, err error) DetectionResult {
+	return DetectionResult{DetectionRecord: DetectionRecord{ImagePath: imagePath}, Error: err}
+}
+
+// mergeTaskMetadata 将任务的附加元数据写入结果元数据，结果元数据为 nil 时新建
+func mergeTaskMetadata(metadata, extra map[string]interface{}) map[string]interface{} {
+	if len(extra) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{}, len(extra))
+	}
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	return metadata
 }
 
 // DetectionTask 检测任务
 type DetectionTask struct {
-	ImagePath string
-	Callback  chan<- DetectionResult
-	Timeout   time.Duration
+	TaskID      uint64 // 由 SubmitTask/SubmitTaskWait 分配，从 1 开始单调递增，提交成功后调用方可读取
+	ImagePath   string
+	Image       image.Image      // 已解码的图像（如 HTTP 上传的数据），设置时不再读取 ImagePath，ImagePath 只用于结果和日志
+	Priority    TaskPriority     // 默认 PriorityNormal；PriorityHigh 的任务进入单独的队列，工作协程先领取
+	Params      *DetectionParams // 覆盖命令行检测参数（-conf, -iou, -classes, -max-det），为 nil 时全部沿用命令行参数
+	Ctx         context.Context  // 取消后工作协程在预处理、推理、后处理之间停止并返回 Ctx.Err()，为 nil 时不可取消
+	Callback    chan<- DetectionResult
+	Timeout     time.Duration          // 处理时限（含获取会话和推理），超过时以 ErrTaskTimeout 失败，为 0 时使用 -timeout
+	SubmittedAt time.Time              // 提交（入队）时间，由 SubmitTask 设置
+	StartedAt   time.Time              // 开始处理时间，由工作协程设置
+	Metadata    map[string]interface{} // 附加到结果 Metadata 的字段（如视频帧序号），与工作协程写入的字段同名时覆盖
 }
 
+// context 返回任务的上下文，未设置时为 context.Background()
+func (task *DetectionTask) context() context.Context {
+	if task.Ctx == nil {
+		return context.Background()
+	}
+	return task.Ctx
+}
+
+// load 返回任务的图像：优先使用已解码的 Image，否则读取 ImagePath
+func (task *DetectionTask) load() (image.Image, error) {
+	if task.Image != nil {
+		return task.Image, nil
+	}
+	return loadImageFile(task.ImagePath)
+}
+
+// ErrQueueFull 任务队列已满，SubmitTask 不等待空位时返回
+var ErrQueueFull = errors.New("任务队列已满")
+
+// ErrSessionAcquireTimeout 会话池已满且在等待时间内没有会话被归还
+var ErrSessionAcquireTimeout = errors.New("等待可用会话超时")
+
+// ErrManagerStopped 管理器已停止，不再接收任务；不排空队列时，队列中尚未处理的任务也返回该错误
+var ErrManagerStopped = errors.New("管理器已停止")
+
+// ErrSessionPoolClosed 会话池已关闭
+var ErrSessionPoolClosed = errors.New("会话池已关闭")
+
 // ModelSessionPool ONNX Runtime会话池
 type ModelSessionPool struct {
 	sessions       chan *ModelSession
 	maxSize        int
 	activeSessions int32 // 活跃会话计数，使用原子操作
 	mutex          sync.Mutex
-	modelPath      string
+	modelPath      string         // 当前模型路径（逗号分隔的列表），由 mutex 保护
+	closed         bool           // 已关闭：归还的会话直接销毁，由 mutex 保护
+	generation     int64          // 模型代数，每次热加载递增，使用原子操作
+	acquireTimeout time.Duration  // 池已满时等待会话归还的最长时间
+	maxFailures    int            // 会话连续推理失败达到该次数时销毁并替换，0 表示不替换
+	replacing      sync.WaitGroup // 后台创建中的替换会话，Close 时等待其完成
+
+	// 会话获取统计，使用原子操作
+	acquireWaits    int64 // 因池已满而等待的次数
+	acquireTimeouts int64 // 等待超时的次数
+	createFailures  int64 // 创建会话失败的次数
+
+	// 会话生命周期统计，使用原子操作
+	sessionsCreated   int64
+	sessionsDestroyed int64
+	sessionsReplaced  int64 // 因连续推理失败被替换的会话数量
 }
 
 // NewModelSessionPool 创建新的会话池
 func NewModelSessionPool(maxSize int, modelPath string) *ModelSessionPool {
 	pool := &ModelSessionPool{
-		sessions:  make(chan *ModelSession, maxSize),
-		maxSize:   maxSize,
-		modelPath: modelPath,
+		sessions:       make(chan *ModelSession, maxSize),
+		maxSize:        maxSize,
+		modelPath:      modelPath,
+		acquireTimeout: *taskTimeout,
+		maxFailures:    *sessionMaxFailures,
 	}
 
 	// 预创建一些会话，提高初始处理速度
 	preCreateCount := max(1, min(maxSize/2, runtime.NumCPU()))
 	for i := 0; i < preCreateCount; i++ {
-		if session, err := initSession(); err == nil {
+		if session, err := pool.newSession(); err == nil {
 			select {
 			case pool.sessions <- session:
 			default:
-				session.Destroy()
+				pool.destroy(session)
 			}
 		}
 	}
@@ -56,60 +135,138 @@ func NewModelSessionPool(maxSize int, modelPath string) *ModelSessionPool {
 }
 
 // GetSession 从池中获取会话，如果池为空则创建新会话
-func (pool *ModelSessionPool) GetSession() (*ModelSession, error) {
+// 池已满时等待会话归还，ctx 结束时停止等待并返回 ctx.Err()
+func (pool *ModelSessionPool) GetSession(ctx context.Context) (*ModelSession, error) {
+	pool.mutex.Lock()
+	closed := pool.closed
+	pool.mutex.Unlock()
+	if closed {
+		return nil, ErrSessionPoolClosed
+	}
+
 	// 首先尝试从池中获取会话
 	select {
 	case session := <-pool.sessions:
-		// 健康检查：验证会话是否有效
-		if session != nil && session.Session != nil {
+		// 健康检查：验证会话是否有效且属于当前模型
+		if pool.usable(session) {
 			atomic.AddInt32(&pool.activeSessions, 1)
 			return session, nil
 		}
 		// 会话无效，销毁并继续尝试
 		if session != nil {
-			session.Destroy()
+			pool.destroy(session)
 		}
 	default:
 	}
 
 	// 池为空或会话无效，尝试创建新会话
-	return pool.createSession()
+	return pool.createSession(ctx)
 }
 
-// PutSession 将会话放回池中
+// PutSession 将会话放回池中，会话的连续推理失败次数清零
 func (pool *ModelSessionPool) PutSession(session *ModelSession) {
+	if session != nil {
+		session.failures = 0
+	}
+	pool.putSession(session)
+}
+
+// putSession 将会话放回池中，不改变连续推理失败次数
+func (pool *ModelSessionPool) putSession(session *ModelSession) {
 	// 减少活跃会话计数
 	atomic.AddInt32(&pool.activeSessions, -1)
 
-	// 检查会话是否有效
-	if session == nil || session.Session == nil {
+	// 检查会话是否有效；热加载前创建的旧模型会话在任务完成后直接销毁
+	if !pool.usable(session) {
+		if session != nil {
+			pool.destroy(session)
+		}
 		return
 	}
 
-	// 将会话放回池中
+	// 将会话放回池中；与 Close 互斥，关闭后归还的会话直接销毁，不会留在池中
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		pool.destroy(session)
+		return
+	}
 	select {
 	case pool.sessions <- session:
 		// 成功放回池中
 	default:
 		// 池已满，销毁会话
-		session.Destroy()
+		pool.destroy(session)
+	}
+}
+
+// discardSession 销毁借出的会话而不放回池中，用于状态不可信的会话（如任务 panic 时正在使用的会话）
+func (pool *ModelSessionPool) discardSession(session *ModelSession) {
+	atomic.AddInt32(&pool.activeSessions, -1)
+	if session != nil {
+		pool.destroy(session)
 	}
 }
 
-// createSession 创建新的会话
-func (pool *ModelSessionPool) createSession() (*ModelSession, error) {
+// Close 关闭会话池并销毁所有空闲会话，重复调用无副作用；后台创建中的替换会话完成后同样被销毁
+// 会话通道不关闭：之后归还的会话由 PutSession 直接销毁，不会因向已关闭的通道发送而 panic
+func (pool *ModelSessionPool) Close() {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return
+	}
+	pool.closed = true
+	pool.mutex.Unlock()
+	pool.replacing.Wait()
+
+	for {
+		select {
+		case session := <-pool.sessions:
+			if session != nil {
+				pool.destroy(session)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// SetAcquireTimeout 设置池已满时等待会话归还的最长时间
+func (pool *ModelSessionPool) SetAcquireTimeout(timeout time.Duration) {
+	pool.acquireTimeout = timeout
+}
+
+// createSession 创建新的会话，池已满时等待会话归还直到超时或 ctx 结束
+func (pool *ModelSessionPool) createSession(ctx context.Context) (*ModelSession, error) {
 	// 检查当前活跃会话数量，避免资源耗尽
 	if atomic.LoadInt32(&pool.activeSessions) >= int32(pool.maxSize) {
-		// 等待一段时间，看是否有会话被释放
-		time.Sleep(10 * time.Millisecond)
-		if atomic.LoadInt32(&pool.activeSessions) >= int32(pool.maxSize) {
-			return nil, fmt.Errorf("活跃会话数量已达到最大容量: %d", pool.maxSize)
+		// 池已满：等待其他任务归还会话，而不是立即失败
+		atomic.AddInt64(&pool.acquireWaits, 1)
+		timer := time.NewTimer(pool.acquireTimeout)
+		defer timer.Stop()
+		select {
+		case session := <-pool.sessions:
+			if pool.usable(session) {
+				atomic.AddInt32(&pool.activeSessions, 1)
+				return session, nil
+			}
+			// 会话无效，销毁后创建新会话
+			if session != nil {
+				pool.destroy(session)
+			}
+		case <-timer.C:
+			atomic.AddInt64(&pool.acquireTimeouts, 1)
+			return nil, fmt.Errorf("%w (%v)，活跃会话数量已达到最大容量: %d", ErrSessionAcquireTimeout, pool.acquireTimeout, pool.maxSize)
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
 
 	// 创建新会话
-	session, err := initSession()
+	session, err := pool.newSession()
 	if err != nil {
+		atomic.AddInt64(&pool.createFailures, 1)
 		return nil, err
 	}
 
@@ -118,6 +275,69 @@ func (pool *ModelSessionPool) createSession() (*ModelSession, error) {
 	return session, nil
 }
 
+// newModelSession 为模型列表创建会话，测试中替换为不加载 ONNX Runtime 的实现
+var newModelSession = initSessionForModels
+
+// newSession 按会话池当前的模型创建会话，并记录模型代数
+func (pool *ModelSessionPool) newSession() (*ModelSession, error) {
+	pool.mutex.Lock()
+	modelPath, generation := pool.modelPath, atomic.LoadInt64(&pool.generation)
+	pool.mutex.Unlock()
+
+	session, err := newModelSession(splitModelPaths(modelPath))
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&pool.sessionsCreated, 1)
+	session.generation = generation
+	return session, nil
+}
+
+// usable 判断会话是否有效且由当前模型创建
+func (pool *ModelSessionPool) usable(session *ModelSession) bool {
+	return session != nil && session.Session != nil && session.generation == atomic.LoadInt64(&pool.generation)
+}
+
+// ReloadModel 热加载新模型（可以是逗号分隔的多个模型，也可以是被原地替换的同一文件）
+// 先用新模型创建一个会话验证可用，失败时保留原有会话并返回错误；
+// 成功后递增模型代数并销毁空闲的旧会话，正在执行的任务继续使用旧会话，归还时销毁
+func (pool *ModelSessionPool) ReloadModel(modelPath string) error {
+	paths := splitModelPaths(modelPath)
+	for _, path := range paths {
+		invalidateLayoutCache(path)
+		invalidateFloat16Cache(path)
+	}
+	session, err := newModelSession(paths)
+	if err != nil {
+		atomic.AddInt64(&pool.createFailures, 1)
+		return fmt.Errorf("加载新模型失败，继续使用原模型: %w", err)
+	}
+	atomic.AddInt64(&pool.sessionsCreated, 1)
+
+	pool.mutex.Lock()
+	pool.modelPath = modelPath
+	session.generation = atomic.AddInt64(&pool.generation, 1)
+	pool.mutex.Unlock()
+
+	// 清空空闲的旧会话，再放入新会话
+	for drained := false; !drained; {
+		select {
+		case old := <-pool.sessions:
+			if old != nil {
+				pool.destroy(old)
+			}
+		default:
+			drained = true
+		}
+	}
+	select {
+	case pool.sessions <- session:
+	default:
+		pool.destroy(session)
+	}
+	return nil
+}
+
 // GetStats 获取会话池统计信息
 func (pool *ModelSessionPool) GetStats() (active, idle int) {
 	active = int(atomic.LoadInt32(&pool.activeSessions))
@@ -125,23 +345,81 @@ func (pool *ModelSessionPool) GetStats() (active, idle int) {
 	return
 }
 
+// GetAcquireStats 获取会话获取统计：等待次数、等待超时次数、创建失败次数
+func (pool *ModelSessionPool) GetAcquireStats() (waits, timeouts, failures int64) {
+	return atomic.LoadInt64(&pool.acquireWaits),
+		atomic.LoadInt64(&pool.acquireTimeouts),
+		atomic.LoadInt64(&pool.createFailures)
+}
+
 // VideoDetectorManager 视频检测管理器
 type VideoDetectorManager struct {
-	taskQueue   chan *DetectionTask
+	taskQueue   chan *DetectionTask // 普通优先级任务
+	highQueue   chan *DetectionTask // 高优先级任务
 	resultQueue chan DetectionResult
 	sessionPool *ModelSessionPool
 	workers     []*Worker
 	workerCount int
-	shutdown    chan struct{}
-	wg          sync.WaitGroup
+	shutdown    chan struct{}  // 停止时关闭，通知热加载、时段报告、金丝雀等后台协程退出
+	wg          sync.WaitGroup // 后台协程
+	workerWG    sync.WaitGroup // 工作协程
 	timeout     time.Duration
+
+	// 停止：stopped 为 true 后 SubmitTask 不再入队，submitMutex 保证 Stop 关闭任务队列时没有正在进行的提交
+	// stopping 在 Stop 开始时关闭，唤醒正在 SubmitTaskWait 中等待队列空位的提交
+	submitMutex sync.RWMutex
+	stopped     bool
+	stopping    chan struct{}
+	stopOnce    sync.Once
+	drainOnStop bool // Stop 时先处理完队列中的任务，为 false 时队列中的任务返回 ErrManagerStopped
+
+	// 提交限速（-max-fps），未开启时 limiter 为 nil
+	limiter         *tokenBucket
+	rejectOverLimit bool // 超出限速时立即拒绝，否则等待
+
+	// 工作协程凑批参数，创建后不再修改
+	collectSize   int           // 每次最多收集的任务数
+	flushInterval time.Duration // 收到第一个任务后最多等待的时间
+
+	nextTaskID uint64 // 最近分配的 TaskID，使用原子操作
+
+	// 队列等待统计（纳秒），使用原子操作
+	queueWaitTotal int64
+	tasksProcessed int64
+
+	canary *canaryMonitor // 金丝雀自检，未开启时为 nil
+	window *windowStats   // 分时段统计（-report-interval），未开启时为 nil
 }
 
 // Worker 工作协程
 type Worker struct {
-	id       int
-	manager  *VideoDetectorManager
-	shutdown chan struct{}
+	id        int
+	manager   *VideoDetectorManager
+	shutdown  chan struct{}
+	startedAt time.Time
+	busyNanos int64 // 处理任务累计耗时（纳秒），使用原子操作
+}
+
+// ManagerStats 管理器运行统计，用于指导 -workers 调优
+type ManagerStats struct {
+	Workers           int
+	TasksProcessed    int64
+	AvgQueueWait      time.Duration // 任务从入队到开始处理的平均等待时间
+	Utilization       float64       // 所有工作协程的平均忙碌百分比
+	WorkerUtilization []float64     // 每个工作协程的忙碌百分比
+	ActiveSessions    int
+	IdleSessions      int
+	AcquireWaits      int64 // 因会话池已满而等待的次数
+	AcquireTimeouts   int64 // 等待会话超时的次数
+	SessionFailures   int64 // 创建会话失败的次数
+	SessionsCreated   int64 // 创建的会话数量
+	SessionsDestroyed int64 // 销毁的会话数量
+	SessionsReplaced  int64 // 因连续推理失败被替换的会话数量
+	Ready             bool  // 金丝雀自检是否正常（未开启时始终为 true）
+	CanaryRuns        int64 // 金丝雀自检执行次数
+	CanaryFailures    int64 // 金丝雀自检失败次数
+	CanaryLastError   string
+	OutputAnomalies   map[string]int64 // 按 提供程序/异常类型 统计的模型输出异常次数（-output-guard）
 }
 
 // NewVideoDetectorManager 创建新的视频检测管理器
@@ -168,41 +446,190 @@ func NewVideoDetectorManager(workerCount, queueSize int, timeout time.Duration)
 		queueSize = maxQueueSize
 	}
 
+	sessionPool := NewModelSessionPool(maxSessions, config.ModelPath)
+	sessionPool.SetAcquireTimeout(timeout)
+
 	manager := &VideoDetectorManager{
 		taskQueue:   make(chan *DetectionTask, queueSize),
+		highQueue:   make(chan *DetectionTask, queueSize),
 		resultQueue: make(chan DetectionResult, queueSize),
-		sessionPool: NewModelSessionPool(maxSessions, modelPath),
+		sessionPool: sessionPool,
 		workers:     make([]*Worker, workerCount),
 		workerCount: workerCount,
 		shutdown:    make(chan struct{}),
+		stopping:    make(chan struct{}),
 		timeout:     timeout,
+
+		collectSize:   max(1, max(*batchCollect, *batchSize)),
+		flushInterval: *batchFlush,
+		drainOnStop:   *drainOnStop,
+	}
+	if *maxFPS > 0 {
+		manager.limiter = newTokenBucket(*maxFPS, 1, time.Now())
+		manager.rejectOverLimit = *rateLimitMode == rateLimitReject
+	}
+
+	// 队列长度和会话数量指标从最近创建的管理器读取
+	metrics.manager.Store(manager)
+
+	// -ws-addr：结果队列中的结果推送给 WebSocket 客户端，结果队列在 Stop 时关闭
+	if liveHub != nil {
+		go liveHub.follow(manager.resultQueue)
 	}
 
 	// 创建工作协程
 	for i := 0; i < workerCount; i++ {
 		worker := &Worker{
-			id:       i,
-			manager:  manager,
-			shutdown: make(chan struct{}),
+			id:        i,
+			manager:   manager,
+			shutdown:  make(chan struct{}),
+			startedAt: time.Now(),
 		}
 		manager.workers[i] = worker
-		manager.wg.Add(1)
+		manager.workerWG.Add(1)
 		go worker.run()
 	}
 
+	// 监视模型文件，变化后自动热加载
+	if *watchModelInterval > 0 {
+		manager.wg.Add(1)
+		go manager.watchModel(*watchModelInterval)
+	}
+
+	// 长时间运行时每隔 -report-interval 输出一次时段报告
+	if *reportInterval > 0 {
+		manager.window = newWindowStats(time.Now())
+		manager.wg.Add(1)
+		go manager.runWindowReports(*reportInterval)
+	}
+
+	// 金丝雀自检：加载失败只影响自检本身，不影响正常检测
+	if *canaryInterval > 0 {
+		canary, err := newCanaryMonitor(manager)
+		if err != nil {
+			fmt.Printf("警告: 金丝雀自检未启动: %v\n", err)
+		} else {
+			manager.canary = canary
+			manager.wg.Add(1)
+			go canary.run(*canaryInterval)
+		}
+	}
+
 	return manager
 }
 
-// SubmitTask 提交检测任务
+// Ready 检测器是否就绪：金丝雀自检连续失败达到 -canary-failures 次后返回 false，恢复后重新返回 true
+func (manager *VideoDetectorManager) Ready() bool {
+	return manager.canary == nil || manager.canary.ready.Load()
+}
+
+// SubmitTask 提交检测任务，队列已满时立即返回 ErrQueueFull，管理器停止后返回 ErrManagerStopped
+// 提交时为任务分配 TaskID，结果（回调和 GetResult）中的 TaskID 与之相同，可据此按提交顺序重排结果
+// 设置了 -max-fps 时先按 -rate-limit-mode 限速（delay 模式下会等待配额）
 func (manager *VideoDetectorManager) SubmitTask(task *DetectionTask) error {
+	if err := manager.throttle(context.Background()); err != nil {
+		return err
+	}
+	manager.submitMutex.RLock()
+	defer manager.submitMutex.RUnlock()
+	if manager.stopped {
+		return ErrManagerStopped
+	}
+
+	task.TaskID = atomic.AddUint64(&manager.nextTaskID, 1)
+	task.SubmittedAt = time.Now()
+	select {
+	case manager.queueFor(task) <- task:
+		return nil
+	default:
+		if manager.window != nil {
+			manager.window.Drop()
+		}
+		return ErrQueueFull
+	}
+}
+
+// SubmitTaskWait 提交检测任务，队列已满时等待空位（背压），直到 ctx 结束或管理器停止
+// 与 SubmitTask 不同，系统繁忙不会导致提交失败；需要立即失败的调用方使用 SubmitTask
+func (manager *VideoDetectorManager) SubmitTaskWait(ctx context.Context, task *DetectionTask) error {
+	if err := manager.throttle(ctx); err != nil {
+		return err
+	}
+	manager.submitMutex.RLock()
+	defer manager.submitMutex.RUnlock()
+	if manager.stopped {
+		return ErrManagerStopped
+	}
+
+	task.TaskID = atomic.AddUint64(&manager.nextTaskID, 1)
+	task.SubmittedAt = time.Now()
 	select {
-	case manager.taskQueue <- task:
+	case manager.queueFor(task) <- task:
 		return nil
-	case <-manager.shutdown:
-		return fmt.Errorf("管理器已关闭")
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-manager.stopping:
+		return ErrManagerStopped
+	}
+}
+
+// GetStats 获取管理器统计信息，包括工作协程利用率和队列等待时间
+func (manager *VideoDetectorManager) GetStats() ManagerStats {
+	stats := ManagerStats{
+		Workers:           manager.workerCount,
+		TasksProcessed:    atomic.LoadInt64(&manager.tasksProcessed),
+		WorkerUtilization: make([]float64, len(manager.workers)),
+	}
+	if stats.TasksProcessed > 0 {
+		stats.AvgQueueWait = time.Duration(atomic.LoadInt64(&manager.queueWaitTotal) / stats.TasksProcessed)
+	}
+
+	var total float64
+	for i, worker := range manager.workers {
+		stats.WorkerUtilization[i] = worker.utilization()
+		total += stats.WorkerUtilization[i]
+	}
+	if len(manager.workers) > 0 {
+		stats.Utilization = total / float64(len(manager.workers))
+	}
+
+	stats.ActiveSessions, stats.IdleSessions = manager.sessionPool.GetStats()
+	stats.AcquireWaits, stats.AcquireTimeouts, stats.SessionFailures = manager.sessionPool.GetAcquireStats()
+	stats.SessionsCreated, stats.SessionsDestroyed, stats.SessionsReplaced = manager.sessionPool.GetSessionStats()
+
+	stats.Ready = manager.Ready()
+	if manager.canary != nil {
+		stats.CanaryRuns = atomic.LoadInt64(&manager.canary.runs)
+		stats.CanaryFailures = atomic.LoadInt64(&manager.canary.failures)
+		stats.CanaryLastError = manager.canary.LastError()
+	}
+	stats.OutputAnomalies = outputAnomalyCounts()
+	return stats
+}
+
+// Recommendation 根据利用率和队列等待时间给出 -workers 调优建议
+func (stats ManagerStats) Recommendation() string {
+	summary := fmt.Sprintf("工作协程平均忙碌 %.0f%%，队列平均等待 %.1fs", stats.Utilization, stats.AvgQueueWait.Seconds())
+	switch {
+	case stats.TasksProcessed == 0:
+		return "尚未处理任何任务，无法给出建议"
+	case stats.Utilization >= 90 && stats.AvgQueueWait > time.Second:
+		return summary + " — 建议增加工作协程数量 (-workers)"
+	case stats.Utilization < 50:
+		return summary + " — 工作协程较空闲，可以减少工作协程数量 (-workers) 以节省内存"
 	default:
-		return fmt.Errorf("任务队列已满")
+		return summary + " — 当前工作协程数量较为合适"
+	}
+}
+
+// utilization 返回工作协程自启动以来的忙碌百分比
+func (worker *Worker) utilization() float64 {
+	elapsed := time.Since(worker.startedAt)
+	if elapsed <= 0 {
+		return 0
 	}
+	busy := time.Duration(atomic.LoadInt64(&worker.busyNanos))
+	return math.Min(100, float64(busy)/float64(elapsed)*100)
 }
 
 // GetResult 获取检测结果
@@ -210,182 +637,535 @@ func (manager *VideoDetectorManager) GetResult() <-chan DetectionResult {
 	return manager.resultQueue
 }
 
-// Stop 停止管理器
+// Stop 分两个阶段停止管理器，重复调用无副作用：
+//  1. 停止接收新任务（之后的 SubmitTask 返回 ErrManagerStopped）
+//  2. -drain-on-stop 时等待工作协程处理完队列中的任务；否则工作协程完成手头的任务后退出，
+//     队列中剩余的任务向回调返回 ErrManagerStopped
+//
+// 之后通知后台协程退出（时段报告输出最后一个时段），关闭结果队列，销毁会话池中的会话
 func (manager *VideoDetectorManager) Stop() {
-	close(manager.shutdown)
+	manager.stopOnce.Do(manager.stop)
+}
+
+func (manager *VideoDetectorManager) stop() {
+	close(manager.stopping)
+	manager.submitMutex.Lock()
+	manager.stopped = true
+	manager.submitMutex.Unlock()
 
-	// 关闭所有工作协程
-	for _, worker := range manager.workers {
-		close(worker.shutdown)
+	// 此后没有协程会向任务队列发送，可以安全关闭
+	if !manager.drainOnStop {
+		for _, worker := range manager.workers {
+			close(worker.shutdown)
+		}
 	}
+	close(manager.highQueue)
+	close(manager.taskQueue)
+	manager.workerWG.Wait()
 
-	// 等待所有工作协程结束
+	// 未排空时队列中剩余的任务
+	for _, queue := range []chan *DetectionTask{manager.highQueue, manager.taskQueue} {
+		for task := range queue {
+			result := failedResult(task.ImagePath, ErrManagerStopped)
+			result.TaskID = task.TaskID
+			result.Metadata = mergeTaskMetadata(result.Metadata, task.Metadata)
+			metrics.recordResult(result)
+			if task.Callback != nil {
+				select {
+				case task.Callback <- result:
+				default:
+				}
+			}
+		}
+	}
+
+	// 通知后台协程退出并等待
+	close(manager.shutdown)
 	manager.wg.Wait()
 
-	// 关闭通道
-	close(manager.taskQueue)
 	close(manager.resultQueue)
-
-	// 销毁会话池中的所有会话
-	close(manager.sessionPool.sessions)
-	for session := range manager.sessionPool.sessions {
-		session.Destroy()
-	}
+	manager.sessionPool.Close()
 }
 
 // run 启动工作协程
 func (worker *Worker) run() {
-	defer worker.manager.wg.Done()
+	defer worker.manager.workerWG.Done()
 
 	// 批量处理任务，减少上下文切换开销
-	const batchSize = 4
-	taskBatch := make([]*DetectionTask, 0, batchSize)
+	// 收集数量不少于推理批次大小，以便一次 Run() 填满批次张量
+	collectSize := worker.manager.collectSize
+	taskBatch := make([]*DetectionTask, 0, collectSize)
+	source := taskSource{high: worker.manager.highQueue, normal: worker.manager.taskQueue}
 
 	for {
-		// 尝试批量获取任务
+		// 停止（不排空队列）时不再领取新任务
+		select {
+		case <-worker.shutdown:
+			return
+		default:
+		}
+
+		// 阻塞等待第一个任务，两个队列都已关闭时退出
 		taskBatch = taskBatch[:0]
-		batchTimeout := time.NewTimer(100 * time.Millisecond)
+		first := source.next(nil, worker.shutdown)
+		if first == nil {
+			return
+		}
+		taskBatch = append(taskBatch, first)
+		urgent := first.Priority == PriorityHigh
 
-		// 最多等待100ms或直到收集到batchSize个任务
-		for len(taskBatch) < batchSize {
-			select {
-			case task, ok := <-worker.manager.taskQueue:
-				if !ok {
-					batchTimeout.Stop()
-					return
-				}
-				taskBatch = append(taskBatch, task)
-			case <-batchTimeout.C:
+		// 之后最多等待 flushInterval 或直到收集到 collectSize 个任务；
+		// 批次中有高优先级任务时不再等待，只带上队列中已有的任务
+		// 队列已关闭或停止时先处理已收集的任务，下一轮再退出
+		batchTimeout := time.NewTimer(worker.manager.flushInterval)
+		for len(taskBatch) < collectSize {
+			var task *DetectionTask
+			if urgent {
+				task = source.tryNext()
+			} else {
+				task = source.next(batchTimeout.C, worker.shutdown)
+			}
+			if task == nil {
 				break
-			case <-worker.shutdown:
-				batchTimeout.Stop()
-				return
 			}
+			taskBatch = append(taskBatch, task)
+			urgent = urgent || task.Priority == PriorityHigh
 		}
-
-		// 停止定时器
 		batchTimeout.Stop()
 
-		// 如果收集到了任务，批量处理
-		if len(taskBatch) > 0 {
-			for _, task := range taskBatch {
-				// 执行检测任务
-				result := worker.processTask(task)
-
-				// 发送结果
-				if task.Callback != nil {
-					select {
-					case task.Callback <- result:
-						// 通过回调发送结果
-					case <-time.After(500 * time.Millisecond): // 减少超时时间，提高响应速度
-						// 记录超时日志，但不阻塞工作协程
-					}
-				}
+		// 如果收集到了任务，按推理批次大小分组处理
+		inferBatch := max(1, *batchSize)
+		for start := 0; start < len(taskBatch); start += inferBatch {
+			end := min(start+inferBatch, len(taskBatch))
+			group := taskBatch[start:end]
 
-				select {
-				case worker.manager.resultQueue <- result:
-					// 也发送到全局结果队列
-				case <-time.After(500 * time.Millisecond): // 减少超时时间，提高响应速度
-					// 记录超时日志，但不阻塞工作协程
+			// 记录队列等待时间
+			groupStart := time.Now()
+			for _, task := range group {
+				task.StartedAt = groupStart
+				if !task.SubmittedAt.IsZero() {
+					atomic.AddInt64(&worker.manager.queueWaitTotal, int64(groupStart.Sub(task.SubmittedAt)))
 				}
+				atomic.AddInt64(&worker.manager.tasksProcessed, 1)
+			}
+
+			results := worker.processGroup(group)
+
+			elapsed := time.Since(groupStart)
+			atomic.AddInt64(&worker.busyNanos, int64(elapsed))
+
+			for i, task := range group {
+				results[i].Elapsed = elapsed / time.Duration(len(group))
+				worker.sendResult(task, results[i])
 			}
 		}
 	}
 }
 
-// processTask 处理单个检测任务
-func (worker *Worker) processTask(task *DetectionTask) DetectionResult {
-	// 从池中获取会话
-	session, err := worker.manager.sessionPool.GetSession()
-	if err != nil {
-		return DetectionResult{
-			ImagePath: task.ImagePath,
-			Error:     fmt.Errorf("获取会话失败: %w", err),
+// sendResult 将结果发送到任务回调和全局结果队列
+func (worker *Worker) sendResult(task *DetectionTask, result DetectionResult) {
+	result.TaskID = task.TaskID
+	result.Metadata = mergeTaskMetadata(result.Metadata, task.Metadata)
+	metrics.recordResult(result)
+	metrics.recordLatency(task.SubmittedAt)
+	if worker.manager.window != nil {
+		worker.manager.window.Record(result)
+	}
+
+	delivered := false
+	if task.Callback != nil {
+		select {
+		case task.Callback <- result:
+			// 通过回调发送结果
+			delivered = true
+		case <-time.After(500 * time.Millisecond): // 减少超时时间，提高响应速度
+			// 记录超时日志，但不阻塞工作协程
 		}
 	}
-	defer worker.manager.sessionPool.PutSession(session)
 
-	// 加载图像
-	originalPic, err := loadImageFile(task.ImagePath)
-	if err != nil {
-		return DetectionResult{
-			ImagePath: task.ImagePath,
-			Error:     fmt.Errorf("加载图像失败: %w", err),
+	// 结果已通过回调送达时不等待全局结果队列（批量处理时通常没有协程读取它）
+	if delivered {
+		select {
+		case worker.manager.resultQueue <- result:
+		default:
 		}
+		return
 	}
 
-	// 准备输入并运行推理
-	scaleInfo, err := prepareInput(originalPic, session.Input)
-	if err != nil {
-		return DetectionResult{
-			ImagePath: task.ImagePath,
-			Error:     fmt.Errorf("准备输入失败: %w", err),
+	select {
+	case worker.manager.resultQueue <- result:
+		// 也发送到全局结果队列
+	case <-time.After(500 * time.Millisecond): // 减少超时时间，提高响应速度
+		// 记录超时日志，但不阻塞工作协程
+		if worker.manager.window != nil {
+			worker.manager.window.Drop()
+		}
+	}
+}
+
+// processTaskBatch 将一组任务填入同一个批次张量，只执行一次推理
+// 返回的结果与 tasks 一一对应；各任务按自己的时限超时，推理在所有待处理任务都超时后被放弃
+func (worker *Worker) processTaskBatch(tasks []*DetectionTask) []DetectionResult {
+	results := make([]DetectionResult, len(tasks))
+
+	// 已取消或参数无效的任务直接返回，全部如此时不再获取会话
+	cfgs := make([]DetectionConfig, len(tasks))
+	base := newDetectionConfig()
+	pending := 0
+	for i, task := range tasks {
+		if err := task.context().Err(); err != nil {
+			results[i] = failedResult(task.ImagePath, err)
+			continue
 		}
+		cfg, err := base.withParams(task.Params)
+		if err != nil {
+			results[i] = failedResult(task.ImagePath, err)
+			continue
+		}
+		cfgs[i] = cfg
+		pending++
+	}
+	if pending == 0 {
+		return results
 	}
 
-	err = session.Session.Run()
+	// 从池中获取会话；重试等待在批次中所有待处理任务都取消或超时后结束
+	taskCtxs := make([]context.Context, len(tasks))
+	live := make([]context.Context, 0, pending)
+	for i, task := range tasks {
+		if results[i].Error == nil {
+			taskCtx, cancel := worker.taskContext(task)
+			defer cancel()
+			taskCtxs[i] = taskCtx
+			live = append(live, taskCtx)
+		}
+	}
+	ctx, stop := batchContext(live)
+	defer stop()
+	// taskErr 返回第 i 个任务自己的错误：超时的任务为 ErrTaskTimeout，仍在时限内的任务为 err
+	taskErr := func(i int, err error) error {
+		if ctxErr := taskCtxs[i].Err(); ctxErr != nil {
+			return taskError(taskCtxs[i], ctxErr)
+		}
+		return err
+	}
+	session, sessionAttempts, err := worker.getSession(ctx)
 	if err != nil {
-		return DetectionResult{
-			ImagePath: task.ImagePath,
-			Error:     fmt.Errorf("运行推理失败: %w", err),
+		for i, task := range tasks {
+			if results[i].Error == nil {
+				results[i] = failedResult(task.ImagePath, fmt.Errorf("获取会话失败: %w", taskErr(i, err)))
+			}
 		}
+		return results
 	}
+	lease := &sessionLease{session: session}
+	defer worker.putSession(lease)
+	if err := session.acquire(); err != nil {
+		for i, task := range tasks {
+			if results[i].Error == nil {
+				results[i] = failedResult(task.ImagePath, err)
+			}
+		}
+		return results
+	}
+	defer session.release()
 
-	// 处理输出
-	originalWidth := originalPic.Bounds().Dx()
-	originalHeight := originalPic.Bounds().Dy()
-	allBoxes := processOutput(session.Output.GetData(), originalWidth, originalHeight,
-		float32(*confidenceThreshold), float32(*iouThreshold), scaleInfo)
+	// 加载图像，加载失败或已取消的任务单独返回错误，不占用批次槽位
+	pics := make([]image.Image, 0, len(tasks))
+	sizes := make([]image.Point, 0, len(tasks))
+	slotCfgs := make([]DetectionConfig, 0, len(tasks))
+	slots := make([]int, 0, len(tasks))
+	for i, task := range tasks {
+		if results[i].Error != nil {
+			continue
+		}
+		start := time.Now()
+		pic, err := task.load()
+		if err != nil {
+			results[i] = failedResult(task.ImagePath, fmt.Errorf("加载图像失败: %w", err))
+			continue
+		}
+		observeStage(stageLoad, start)
+		if err := taskCtxs[i].Err(); err != nil {
+			results[i] = failedResult(task.ImagePath, taskErr(i, err))
+			continue
+		}
+		pics = append(pics, pic)
+		sizes = append(sizes, image.Pt(pic.Bounds().Dx(), pic.Bounds().Dy()))
+		slotCfgs = append(slotCfgs, cfgs[i])
+		slots = append(slots, i)
+	}
+	if len(pics) == 0 {
+		return results
+	}
+
+	failAll := func(err error) []DetectionResult {
+		for _, i := range slots {
+			results[i] = failedResult(tasks[i].ImagePath, taskErr(i, err))
+		}
+		return results
+	}
+
+	// 准备批量输入并运行一次推理，各阶段耗时按整个批次记录
+	var scaleInfos []ScaleInfo
+	started := time.Now()
+	lease.err, lease.abandoned = worker.runAbandonable(ctx, func() error {
+		start := time.Now()
+		var err error
+		scaleInfos, err = prepareBatchInput(pics, session.Input)
+		if err != nil {
+			return fmt.Errorf("准备输入失败: %w", err)
+		}
+		observeStage(stagePreprocess, start)
+		start = time.Now()
+		session.runAttempts = 0
+		if err := session.runRetry(ctx); err != nil {
+			return err
+		}
+		observeStage(stageInference, start)
+		return nil
+	}, func() {
+		worker.manager.sessionPool.retireAbandoned(session, time.Since(started))
+	})
+	if lease.err != nil {
+		return failAll(lease.err)
+	}
+
+	start := time.Now()
+	defer observeStage(stagePostprocess, start)
+	output := session.Output.GetData()
+	probeSessionLayout(session, output)
+	var batchBoxes [][]boundingBox
+	if session.Layout.Format != formatCls {
+		batchBoxes = processBatchOutput(output, session.Layout, sizes, slotCfgs, scaleInfos)
+	}
+	slotSize := session.Layout.slotSize()
+	for slot, i := range slots {
+		// 推理期间被取消或超时的任务不再后处理
+		if err := taskCtxs[i].Err(); err != nil {
+			results[i] = failedResult(tasks[i].ImagePath, taskErr(i, err))
+			continue
+		}
+		if err := checkSessionOutput(session, output[slot*slotSize:(slot+1)*slotSize]); err != nil {
+			results[i] = failedResult(tasks[i].ImagePath, err)
+			continue
+		}
+		var record DetectionRecord
+		if session.Layout.Format == formatCls {
+			// 分类模型：按槽位解析前K个类别
+			predictions := processClassOutput(output[slot*slotSize:(slot+1)*slotSize], session.Layout, slotCfgs[slot].TopK)
+			record = newClassificationRecord(tasks[i].ImagePath, sizes[slot].X, sizes[slot].Y, predictions)
+		} else {
+			attachSessionMasks(session, slot, batchBoxes[slot], scaleInfos[slot])
+			record = newDetectionRecord(tasks[i].ImagePath, sizes[slot].X, sizes[slot].Y, batchBoxes[slot], slotCfgs[slot])
+		}
+		results[i] = DetectionResult{
+			DetectionRecord: record,
+			Metadata: map[string]interface{}{
+				"timestamp":        time.Now(),
+				"worker_id":        worker.id,
+				"batch_size":       len(pics),
+				"attempts":         session.runAttempts,
+				"session_attempts": sessionAttempts,
+			},
+		}
+		if session.probe != "" {
+			results[i].Metadata["layout_probe"] = session.probe
+		}
+		results[i].thumbnail = liveThumbnail(pics[slot])
+	}
+	return results
+}
+
+// processTask 处理单个检测任务
+// 超过任务时限（taskContext）时立即返回 ErrTaskTimeout，不等待卡住的推理
+func (worker *Worker) processTask(task *DetectionTask) DetectionResult {
+	if err := task.context().Err(); err != nil {
+		return failedResult(task.ImagePath, err)
+	}
+	cfg, err := newDetectionConfig().withParams(task.Params)
+	if err != nil {
+		return failedResult(task.ImagePath, err)
+	}
+	ctx, cancel := worker.taskContext(task)
+	defer cancel()
+
+	// 从池中获取会话
+	session, sessionAttempts, err := worker.getSession(ctx)
+	if err != nil {
+		return failedResult(task.ImagePath, fmt.Errorf("获取会话失败: %w", taskError(ctx, err)))
+	}
+	lease := &sessionLease{session: session}
+	defer worker.putSession(lease)
+
+	// 加载图像并推理
+	var record DetectionRecord
+	var thumbnail string
+	started := time.Now()
+	lease.err, lease.abandoned = worker.runAbandonable(ctx, func() error {
+		session.runAttempts = 0
+		var err error
+		record, thumbnail, err = detectTask(ctx, session, task, cfg)
+		return err
+	}, func() {
+		worker.manager.sessionPool.retireAbandoned(session, time.Since(started))
+	})
+	if lease.err != nil {
+		return failedResult(task.ImagePath, lease.err)
+	}
 
-	return DetectionResult{
-		ImagePath: task.ImagePath,
-		Objects:   allBoxes,
-		Error:     nil,
+	result := DetectionResult{
+		DetectionRecord: record,
 		Metadata: map[string]interface{}{
-			"timestamp": time.Now(),
-			"worker_id": worker.id,
+			"timestamp":        time.Now(),
+			"worker_id":        worker.id,
+			"attempts":         session.runAttempts,
+			"session_attempts": sessionAttempts,
 		},
 	}
+	if session.probe != "" {
+		result.Metadata["layout_probe"] = session.probe
+	}
+	result.thumbnail = thumbnail
+	return result
+}
+
+// detectTask 加载任务的图像并检测，与命令行的 detectImageWithSession 使用同一个 runDetection
+// 检测成功时另外返回实时推送的缩略图（见 liveThumbnail）
+func detectTask(ctx context.Context, session inferenceSession, task *DetectionTask, cfg DetectionConfig) (DetectionRecord, string, error) {
+	start := time.Now()
+	originalPic, err := task.load()
+	if err != nil {
+		return DetectionRecord{}, "", fmt.Errorf("加载图像失败: %w", err)
+	}
+	observeStage(stageLoad, start)
+
+	record, err := runDetection(ctx, session, task.ImagePath, originalPic, cfg)
+	if err = taskError(ctx, err); err != nil {
+		return record, "", err
+	}
+	return record, liveThumbnail(originalPic), nil
 }
 
 // ProcessImageBatch 批量处理图像的便捷方法
-func (manager *VideoDetectorManager) ProcessImageBatch(imagePaths []string) []DetectionResult {
-	results := make([]DetectionResult, len(imagePaths))
-	callbacks := make([]chan DetectionResult, len(imagePaths))
+func (manager *VideoDetectorManager) ProcessImageBatch(ctx context.Context, imagePaths []string) []DetectionResult {
+	return manager.ProcessImageBatchWithParams(ctx, imagePaths, nil)
+}
 
-	// 创建回调通道
-	for i := range callbacks {
-		callbacks[i] = make(chan DetectionResult, 1)
+// ProcessImageBatchWithParams 与 ProcessImageBatch 相同，但本批图像按 params 覆盖命令行检测参数
+// params 无效时不提交任何任务，所有图像的结果均为该错误；模型输入尺寸仍由会话池决定
+func (manager *VideoDetectorManager) ProcessImageBatchWithParams(ctx context.Context, imagePaths []string, params *DetectionParams) []DetectionResult {
+	results := make([]DetectionResult, len(imagePaths))
+	if _, err := newDetectionConfig().withParams(params); err != nil {
+		for i, imagePath := range imagePaths {
+			results[i] = failedResult(imagePath, err)
+		}
+		return results
 	}
+	manager.processImageBatchFunc(ctx, imagePaths, params, nil, func(i int, result DetectionResult) {
+		results[i] = result
+	})
+	return results
+}
+
+// ProcessImageBatchFunc 提交所有图像后按输入顺序逐个回调结果
+// 回调在调用方协程中执行，前面的结果未返回时后面已完成的结果在回调通道中等待，不阻塞工作协程
+// 队列已满时等待空位（SubmitTaskWait），图像数量超过队列大小不会导致提交失败
+// ctx 取消后不再等待：已完成的结果照常回调，其余图像的结果为 ctx.Err()，队列中的任务由工作协程直接丢弃
+func (manager *VideoDetectorManager) ProcessImageBatchFunc(ctx context.Context, imagePaths []string, handle func(i int, result DetectionResult)) {
+	manager.processImageBatchFunc(ctx, imagePaths, nil, nil, handle)
+}
+
+// ProcessImageBatchProgress 与 ProcessImageBatchFunc 相同，另外每完成一张图像（按完成顺序，不等待前面的图像）调用一次 progress
+// 提交失败和等待超时的图像计为失败；ctx 取消后未完成的图像不计入进度
+func (manager *VideoDetectorManager) ProcessImageBatchProgress(ctx context.Context, imagePaths []string, progress ProgressFunc, handle func(i int, result DetectionResult)) {
+	manager.processImageBatchFunc(ctx, imagePaths, nil, progress, handle)
+}
+
+// processImageBatchFunc ProcessImageBatchFunc 的实现，每个任务带上同一份 params，progress 可以为 nil
+// 所有任务共用一个回调通道，结果按 TaskID 对应回输入位置，同一路径提交多次也不会混淆
+func (manager *VideoDetectorManager) processImageBatchFunc(ctx context.Context, imagePaths []string, params *DetectionParams, progress ProgressFunc, handle func(i int, result DetectionResult)) {
+	tracker := newProgressTracker(len(imagePaths), progress)
+	n := len(imagePaths)
+	callback := make(chan DetectionResult, n) // 容量足够时工作协程发送结果不会阻塞
+	submitErrs := make([]error, n)
+	positions := make(map[uint64]int, n)
 
 	// 提交所有任务
 	for i, imagePath := range imagePaths {
 		task := &DetectionTask{
 			ImagePath: imagePath,
-			Callback:  callbacks[i],
+			Ctx:       ctx,
+			Params:    params,
+			Callback:  callback,
 		}
+		if submitErrs[i] = manager.SubmitTaskWait(ctx, task); submitErrs[i] == nil {
+			positions[task.TaskID] = i
+		} else if ctx.Err() == nil {
+			tracker.add(true)
+		}
+	}
 
-		err := manager.SubmitTask(task)
-		if err != nil {
-			results[i] = DetectionResult{
-				ImagePath: imagePath,
-				Error:     fmt.Errorf("提交任务失败: %w", err),
+	// 先到的结果暂存，按输入顺序回调
+	results := make([]DetectionResult, n)
+	ready := make([]bool, n)
+	next := 0
+	flush := func() {
+		for ; next < n; next++ {
+			if submitErrs[next] != nil {
+				handle(next, failedResult(imagePaths[next], fmt.Errorf("提交任务失败: %w", submitErrs[next])))
+			} else if ready[next] {
+				handle(next, results[next])
+			} else {
+				return
+			}
+		}
+	}
+	receive := func(result DetectionResult) {
+		// 已按超时处理过的位置不再回调
+		if i, ok := positions[result.TaskID]; ok && i >= next {
+			results[i], ready[i] = result, true
+			if ctx.Err() == nil || !errors.Is(result.Error, ctx.Err()) {
+				tracker.add(result.Error != nil)
 			}
 		}
 	}
 
-	// 等待所有结果
-	for i, callback := range callbacks {
+	flush()
+	timer := time.NewTimer(manager.timeout)
+	defer timer.Stop()
+	for next < n {
+		waiting := next
 		select {
 		case result := <-callback:
-			results[i] = result
-		case <-time.After(manager.timeout):
-			results[i] = DetectionResult{
-				ImagePath: imagePaths[i],
-				Error:     fmt.Errorf("处理超时"),
+			receive(result)
+			flush()
+		case <-ctx.Done():
+			// 取消时已完成的结果仍然保留
+			for drained := false; !drained; {
+				select {
+				case result := <-callback:
+					receive(result)
+				default:
+					drained = true
+				}
+			}
+			for i := next; i < n; i++ {
+				if !ready[i] {
+					results[i], ready[i] = failedResult(imagePaths[i], ctx.Err()), true
+				}
 			}
+			flush()
+			return
+		case <-timer.C:
+			// 当前位置等待超过 manager.timeout
+			results[next], ready[next] = failedResult(imagePaths[next], fmt.Errorf("处理超时")), true
+			tracker.add(true)
+			flush()
+		}
+		if next != waiting {
+			// 每个位置的等待时间单独计算
+			timer.Reset(manager.timeout)
 		}
 	}
-
-	return results
 }
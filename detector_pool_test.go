@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// useFakeSessions 测试期间会话池创建不加载 ONNX Runtime 的会话：会话只有空的 AdvancedSession，
+// 可以借出、归还和销毁，但不能推理（工作协程处理不存在的图像时在加载阶段就失败，不会用到会话）
+func useFakeSessions(t *testing.T) {
+	t.Helper()
+	saved := newModelSession
+	t.Cleanup(func() { newModelSession = saved })
+	newModelSession = func(paths []string) (*ModelSession, error) {
+		return &ModelSession{Session: &ort.AdvancedSession{}, path: paths[0]}, nil
+	}
+}
+
+// fakeSessionPool 创建使用 useFakeSessions 会话的会话池
+func fakeSessionPool(t *testing.T, size int) *ModelSessionPool {
+	t.Helper()
+	useFakeSessions(t)
+	pool := NewModelSessionPool(size, "fake.onnx")
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestGetSessionStopsWhenContextDone(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.RetryAttempts = 3
+	config.RetryBackoff = time.Millisecond
+
+	pool := fakeSessionPool(t, 1)
+	pool.SetAcquireTimeout(time.Hour)
+	held, err := pool.GetSession(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.PutSession(held)
+	worker := &Worker{manager: &VideoDetectorManager{sessionPool: pool}}
+
+	tests := []struct {
+		name string
+		ctx  func() (context.Context, context.CancelFunc)
+		want error
+	}{
+		{"取消", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}, context.Canceled},
+		{"任务时限", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if _, err := pool.GetSession(ctx); !errors.Is(err, tt.want) {
+				t.Errorf("GetSession() = %v，期望 %v", err, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("上下文结束后仍等待了 %v", elapsed)
+			}
+
+			// 工作协程取会话时，上下文结束后不再按 -retry-attempts 重试
+			ctx, cancel = tt.ctx()
+			defer cancel()
+			_, attempts, err := worker.getSession(ctx)
+			if !errors.Is(err, tt.want) || attempts != 1 {
+				t.Errorf("getSession() 尝试 %d 次，错误 %v，期望只尝试 1 次并返回 %v", attempts, err, tt.want)
+			}
+		})
+	}
+	if _, timeouts, _ := pool.GetAcquireStats(); timeouts != 0 {
+		t.Errorf("上下文结束被计为 %d 次等待超时", timeouts)
+	}
+}
+
+func TestProcessImageBatchCanceledMidBatch(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+	// -max-fps 4：第 i 个任务约在 i×250ms 提交，取消时间落在两次提交之间
+	config.MaxFPS = 4
+	config.RateLimitMode = "delay"
+
+	tests := []struct {
+		name      string
+		cancel    time.Duration
+		completed int // 取消前已完成的任务数
+	}{
+		{"第一个任务完成后取消", 125 * time.Millisecond, 1},
+		{"两个任务完成后取消", 375 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+			manager := NewVideoDetectorManager(2, 8, time.Minute)
+			paths := make([]string, 6)
+			for i := range paths {
+				paths[i] = missingImage(i)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			time.AfterFunc(tt.cancel, cancel)
+			start := time.Now()
+			results := manager.ProcessImageBatch(ctx, paths)
+			if elapsed := time.Since(start); elapsed > tt.cancel+time.Second {
+				t.Errorf("取消后 ProcessImageBatch 又等待了 %v", elapsed-tt.cancel)
+			}
+
+			for i, result := range results {
+				if result.ImagePath != paths[i] {
+					t.Errorf("第 %d 个结果的路径 = %q，期望 %q", i, result.ImagePath, paths[i])
+				}
+				canceled := errors.Is(result.Error, context.Canceled)
+				if i < tt.completed && (canceled || !strings.Contains(fmt.Sprint(result.Error), "加载图像失败")) {
+					t.Errorf("第 %d 个任务在取消前已完成，结果被替换为 %v", i, result.Error)
+				}
+				if i >= tt.completed && !canceled {
+					t.Errorf("第 %d 个任务的错误 = %v，期望 context.Canceled", i, result.Error)
+				}
+			}
+
+			manager.Stop()
+			deadline := time.Now().Add(2 * time.Second)
+			for runtime.NumGoroutine() > baseline {
+				if time.Now().After(deadline) {
+					t.Fatalf("Stop() 后还有 %d 个协程，开始时 %d 个", runtime.NumGoroutine(), baseline)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestSessionPoolExhaustion(t *testing.T) {
+	tests := []struct {
+		name     string
+		returnIn time.Duration // 借出的会话多久后归还，0 表示不归还
+		timeouts int64
+		wantErr  error
+	}{
+		{"等待期间有会话归还", 20 * time.Millisecond, 0, nil},
+		{"等待超时", 0, 1, ErrSessionAcquireTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := fakeSessionPool(t, 2)
+			pool.SetAcquireTimeout(200 * time.Millisecond)
+			held := make([]*ModelSession, 2)
+			for i := range held {
+				session, err := pool.GetSession(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				held[i] = session
+			}
+			if tt.returnIn > 0 {
+				time.AfterFunc(tt.returnIn, func() { pool.PutSession(held[0]) })
+			}
+
+			session, err := pool.GetSession(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetSession() = %v，期望 %v", err, tt.wantErr)
+			}
+			if err == nil && session != held[0] {
+				t.Error("应取得刚归还的会话，而不是创建新会话")
+			}
+			waits, timeouts, failures := pool.GetAcquireStats()
+			if waits != 1 || timeouts != tt.timeouts || failures != 0 {
+				t.Errorf("等待 %d 次、超时 %d 次、创建失败 %d 次，期望 1、%d、0", waits, timeouts, failures, tt.timeouts)
+			}
+			if active, _ := pool.GetStats(); active != 2 {
+				t.Errorf("活跃会话 = %d，期望 2", active)
+			}
+		})
+	}
+}
+
+func TestSessionPoolCloseWithSessionsCheckedOut(t *testing.T) {
+	pool := fakeSessionPool(t, 4)
+	held := make([]*ModelSession, 3)
+	for i := range held {
+		session, err := pool.GetSession(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		held[i] = session
+	}
+	pool.Close()
+	if _, idle := pool.GetStats(); idle != 0 {
+		t.Errorf("关闭后仍有 %d 个空闲会话", idle)
+	}
+	if _, err := pool.GetSession(context.Background()); !errors.Is(err, ErrSessionPoolClosed) {
+		t.Errorf("关闭后 GetSession() = %v，期望 ErrSessionPoolClosed", err)
+	}
+
+	// 关闭后归还的会话（正常、推理失败、panic）直接销毁，不会留在池中
+	_, destroyedBefore, _ := pool.GetSessionStats()
+	pool.PutSession(held[0])
+	pool.PutSessionFailed(held[1])
+	pool.discardSession(held[2])
+	active, idle := pool.GetStats()
+	if active != 0 || idle != 0 {
+		t.Errorf("全部归还后活跃 %d 个、空闲 %d 个，期望都为 0", active, idle)
+	}
+	if _, destroyed, _ := pool.GetSessionStats(); destroyed-destroyedBefore != 3 {
+		t.Errorf("关闭后归还时销毁了 %d 个会话，期望 3 个", destroyed-destroyedBefore)
+	}
+	pool.Close() // 重复关闭无副作用
+}
+
+func TestSessionPoolConcurrentUse(t *testing.T) {
+	pool := fakeSessionPool(t, 3)
+	pool.SetAcquireTimeout(5 * time.Second)
+	var wg sync.WaitGroup
+	errs := make(chan error, 16*20)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				session, err := pool.GetSession(context.Background())
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := session.acquire(); err != nil {
+					errs <- err // 同一会话被借给了两个协程
+				} else {
+					session.release()
+				}
+				pool.PutSession(session)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	active, idle := pool.GetStats()
+	if active != 0 || idle > 3 {
+		t.Errorf("全部归还后活跃 %d 个、空闲 %d 个，期望 0 个和不超过 3 个", active, idle)
+	}
+}
+
+// missingImage 不存在的图像路径：工作协程在加载阶段失败，不会用到（不能推理的）假会话
+func missingImage(i int) string {
+	return fmt.Sprintf("testdata/missing/%04d.jpg", i)
+}
+
+func TestManagerStopWithConcurrentSubmits(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	for _, drain := range []bool{true, false} {
+		t.Run(fmt.Sprintf("drain-on-stop=%v", drain), func(t *testing.T) {
+			config.DrainOnStop = drain
+			manager := NewVideoDetectorManager(2, 8, time.Second)
+
+			// 提交协程在 Stop 前后不断提交；每个提交成功的任务都必须恰好收到一个结果
+			const submitters, perSubmitter = 8, 50
+			var wg sync.WaitGroup
+			var accepted sync.Map // TaskID -> 回调通道
+			for g := 0; g < submitters; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perSubmitter; i++ {
+						callback := make(chan DetectionResult, 1)
+						task := &DetectionTask{ImagePath: missingImage(g*perSubmitter + i), Callback: callback}
+						var err error
+						if i%2 == 0 {
+							err = manager.SubmitTask(task)
+						} else {
+							err = manager.SubmitTaskWait(context.Background(), task)
+						}
+						switch {
+						case err == nil:
+							accepted.Store(task.TaskID, callback)
+						case errors.Is(err, ErrManagerStopped), errors.Is(err, ErrQueueFull):
+						default:
+							t.Errorf("提交失败: %v", err)
+						}
+					}
+				}()
+			}
+			time.Sleep(5 * time.Millisecond)
+			manager.Stop()
+			manager.Stop() // 重复调用无副作用
+			wg.Wait()
+
+			accepted.Range(func(key, value any) bool {
+				select {
+				case result := <-value.(chan DetectionResult):
+					if result.TaskID != key.(uint64) || result.Error == nil {
+						t.Errorf("任务 %d 的结果 = %+v", key, result)
+					}
+					if drain && errors.Is(result.Error, ErrManagerStopped) {
+						t.Errorf("排空队列时任务 %d 不应返回 ErrManagerStopped", key)
+					}
+				default:
+					t.Errorf("任务 %d 提交成功但没有收到结果", key)
+				}
+				return true
+			})
+			if err := manager.SubmitTask(&DetectionTask{ImagePath: missingImage(0)}); !errors.Is(err, ErrManagerStopped) {
+				t.Errorf("Stop 后 SubmitTask() = %v，期望 ErrManagerStopped", err)
+			}
+			if active, idle := manager.sessionPool.GetStats(); active != 0 || idle != 0 {
+				t.Errorf("Stop 后活跃会话 %d 个、空闲会话 %d 个，期望都为 0", active, idle)
+			}
+		})
+	}
+}
+
+func TestProcessImageBatchBackpressure(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	const queueSize = 4
+	tests := []struct {
+		name     string
+		priority TaskPriority
+	}{
+		{"普通优先级", PriorityNormal},
+		{"高优先级", PriorityHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewVideoDetectorManager(2, queueSize, time.Second)
+			defer manager.Stop()
+
+			// 借出全部会话，工作协程等待会话期间队列很快填满；稍后归还
+			var held []*ModelSession
+			for i := 0; i < 2; i++ {
+				session, err := manager.sessionPool.GetSession(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				held = append(held, session)
+			}
+			time.AfterFunc(100*time.Millisecond, func() {
+				for _, session := range held {
+					manager.sessionPool.PutSession(session)
+				}
+			})
+
+			// 提交 10 倍于队列容量的任务：SubmitTaskWait 等待空位，不应出现“队列已满”
+			paths := make([]string, 10*queueSize)
+			for i := range paths {
+				paths[i] = missingImage(i)
+			}
+			var results []DetectionResult
+			if tt.priority == PriorityNormal {
+				results = manager.ProcessImageBatch(context.Background(), paths)
+			} else {
+				callbacks := make(chan DetectionResult, len(paths))
+				for _, path := range paths {
+					task := &DetectionTask{ImagePath: path, Priority: tt.priority, Callback: callbacks}
+					if err := manager.SubmitTaskWait(context.Background(), task); err != nil {
+						t.Fatalf("SubmitTaskWait() = %v", err)
+					}
+				}
+				for range paths {
+					results = append(results, <-callbacks)
+				}
+			}
+			if len(results) != len(paths) {
+				t.Fatalf("得到 %d 个结果，期望 %d 个", len(results), len(paths))
+			}
+			if waits, _, _ := manager.sessionPool.GetAcquireStats(); waits == 0 {
+				t.Error("工作协程没有等待会话，队列未被填满")
+			}
+			for _, result := range results {
+				if errors.Is(result.Error, ErrQueueFull) || !strings.Contains(fmt.Sprint(result.Error), "加载图像失败") {
+					t.Errorf("%s 的错误 = %v，期望只有图像加载失败", result.ImagePath, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectTaskConcurrentResultsNotAliased(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config = DefaultDetectorConfig()
+	config.InputSize = 640
+
+	imagePath := filepath.Join(t.TempDir(), "frame.png")
+	f, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 640, 640))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	cfg, err := newDetectionConfig().withParams(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const workers = 4
+	sessions := make([]*fakeSession, workers)
+	want := make([][]boundingBox, workers)
+	for i := range sessions {
+		sessions[i] = newFakeSession(crowdedOutput(i * 7))
+		record, _, err := detectTask(context.Background(), sessions[i], &DetectionTask{ImagePath: imagePath}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want[i] = record.Objects; len(want[i]) == 0 {
+			t.Fatal("串行检测结果为空")
+		}
+	}
+
+	// 每个工作协程使用自己的会话并发检测（-race 下运行），结果与串行检测一致且互不影响
+	var wg sync.WaitGroup
+	errs := make(chan string, workers*3)
+	for i := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for iter := 0; iter < 3; iter++ {
+				record, _, err := detectTask(context.Background(), sessions[i], &DetectionTask{ImagePath: imagePath}, cfg)
+				if err != nil {
+					errs <- err.Error()
+					continue
+				}
+				if !reflect.DeepEqual(record.Objects, want[i]) {
+					errs <- fmt.Sprintf("工作协程 %d 的结果与串行检测不同", i)
+				}
+				scribble(record.Objects)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for msg := range errs {
+		t.Error(msg)
+	}
+}
+
+func TestWorkerFlushesPartialBatch(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	tests := []struct {
+		name    string
+		collect int
+		flush   time.Duration
+		tasks   int
+		within  time.Duration // 所有结果最迟到达的时间
+	}{
+		{"单个任务在 -batch-flush 后处理", 4, 100 * time.Millisecond, 1, 300 * time.Millisecond},
+		{"不足一批时同样在 -batch-flush 后处理", 4, 50 * time.Millisecond, 3, 250 * time.Millisecond},
+		// 凑满一批后立即处理，不等待 -batch-flush
+		{"凑满一批", 2, time.Hour, 2, 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.BatchSize, config.BatchCollect, config.BatchFlush = 1, tt.collect, tt.flush
+			manager := NewVideoDetectorManager(1, 8, time.Second)
+			defer manager.Stop()
+
+			callbacks := make([]chan DetectionResult, tt.tasks)
+			start := time.Now()
+			for i := range callbacks {
+				callbacks[i] = make(chan DetectionResult, 1)
+				// 可用内存较少时管理器会缩小队列，等待队列空位而不是直接失败
+				if err := manager.SubmitTaskWait(context.Background(), &DetectionTask{ImagePath: missingImage(i), Callback: callbacks[i]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			deadline := time.After(tt.within)
+			for i, callback := range callbacks {
+				select {
+				case <-callback:
+				case <-deadline:
+					t.Fatalf("%v 内没有收到第 %d 个任务的结果", tt.within, i+1)
+				}
+			}
+			if elapsed := time.Since(start); tt.flush < time.Hour && elapsed < tt.flush*9/10 {
+				t.Errorf("%v 后就收到结果，未等待 -batch-flush %v 凑批", elapsed, tt.flush)
+			}
+		})
+	}
+}
+
+func TestManagerCollectSize(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	tests := []struct {
+		batch, collect, want int
+	}{
+		{1, 4, 4},
+		{8, 4, 8}, // 不少于 -batch，一次 Run() 填满批次张量
+		{1, 0, 1},
+	}
+	for _, tt := range tests {
+		config.BatchSize, config.BatchCollect = tt.batch, tt.collect
+		manager := NewVideoDetectorManager(1, 1, time.Second)
+		if manager.collectSize != tt.want {
+			t.Errorf("-batch %d -batch-collect %d: collectSize = %d，期望 %d", tt.batch, tt.collect, manager.collectSize, tt.want)
+		}
+		manager.Stop()
+	}
+}
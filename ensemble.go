@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 多模型集成推理参数：-model 可以重复指定或用逗号分隔多个模型
+var (
+	ensembleFusion = &config.EnsembleFusion
+	ensembleIOU    = &config.EnsembleIOU
+)
+
+// modelPathsFlag -model 参数：第一次出现时替换默认模型，之后每次出现都追加一个模型
+type modelPathsFlag struct {
+	target *string
+	set    bool
+}
+
+func (f *modelPathsFlag) String() string {
+	if f.target == nil {
+		return ""
+	}
+	return *f.target
+}
+
+func (f *modelPathsFlag) Set(value string) error {
+	if !f.set {
+		*f.target = value
+		f.set = true
+		return nil
+	}
+	*f.target += "," + value
+	return nil
+}
+
+// modelPaths 返回配置的全部模型路径，第一个为主模型
+func modelPaths() []string {
+	return splitModelPaths(config.ModelPath)
+}
+
+// splitModelPaths 拆分逗号分隔的模型路径列表
+func splitModelPaths(list string) []string {
+	var paths []string
+	for _, path := range strings.Split(list, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return []string{DefaultDetectorConfig().ModelPath}
+	}
+	return paths
+}
+
+// ensembleEnabled 是否配置了多个模型
+func ensembleEnabled() bool {
+	return len(modelPaths()) > 1
+}
+
+// inferEnsembleBoxes 在集成推理的成员会话上复用主会话已准备好的输入，收集所有模型的检测框并融合
+// primaryBoxes 为主会话的检测结果
+func inferEnsembleBoxes(session *ModelSession, primaryBoxes []boundingBox, width, height int, scaleInfo ScaleInfo, cfg DetectionConfig) ([]boundingBox, error) {
+	allBoxes := tagBoxesWithModel(primaryBoxes, session.Name)
+	for _, member := range session.Members {
+		copy(member.Input.GetData(), session.Input.GetData())
+		if err := member.run(); err != nil {
+			return nil, fmt.Errorf("集成模型 %s: %w", member.Name, sessionRunError(err))
+		}
+		probeSessionLayout(member, member.Output.GetData())
+		if err := checkSessionOutput(member, member.Output.GetData()); err != nil {
+			return nil, err
+		}
+		boxes := processOutput(member.Output.GetData(), member.Layout, width, height,
+			cfg.decodeThreshold(), cfg.IOUThreshold, cfg.MaxDet, cfg.Classes, scaleInfo)
+		attachSessionMasks(member, 0, boxes, scaleInfo)
+		allBoxes = append(allBoxes, tagBoxesWithModel(boxes, member.Name)...)
+	}
+	if len(allBoxes) == 0 {
+		return allBoxes, nil
+	}
+
+	iou := float32(*ensembleIOU)
+	switch *ensembleFusion {
+	case "wbf":
+		return weightedBoxFusion(allBoxes, iou, len(session.Members)+1), nil
+	case "nms":
+		return nonMaxSuppression(allBoxes, iou), nil
+	default:
+		return nil, fmt.Errorf("不支持的集成融合方式: %s（支持 nms, wbf）", *ensembleFusion)
+	}
+}
+
+// tagBoxesWithModel 标注检测框来自哪个模型
+func tagBoxesWithModel(boxes []boundingBox, model string) []boundingBox {
+	for i := range boxes {
+		boxes[i].model = model
+	}
+	return boxes
+}
+
+// weightedBoxFusion 加权框融合（WBF）
+// 同类别且 IOU 超过阈值的框归为一簇，坐标按置信度加权平均；
+// 融合后的置信度为簇内平均置信度乘以 min(簇大小, 模型数)/模型数，只有少数模型检测到的目标会被降权
+func weightedBoxFusion(boxes []boundingBox, iouThreshold float32, numModels int) []boundingBox {
+	sorted := make([]boundingBox, len(boxes))
+	copy(sorted, boxes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].confidence > sorted[j].confidence
+	})
+
+	type cluster struct {
+		fused   boundingBox // 当前融合结果，用于与后续框计算 IOU
+		members []boundingBox
+	}
+	var clusters []*cluster
+	for _, box := range sorted {
+		var target *cluster
+		for _, c := range clusters {
+			if c.fused.label == box.label && c.fused.iou(&box) > iouThreshold {
+				target = c
+				break
+			}
+		}
+		if target == nil {
+			clusters = append(clusters, &cluster{fused: box, members: []boundingBox{box}})
+			continue
+		}
+		target.members = append(target.members, box)
+		target.fused = fuseCluster(target.members, numModels)
+	}
+
+	// 只有一个框的簇同样经过 fuseCluster 按 1/模型数 降权，只有一个模型检测到的框不会排在所有模型都检测到的框之前
+	result := make([]boundingBox, len(clusters))
+	for i, c := range clusters {
+		result[i] = fuseCluster(c.members, numModels)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].confidence > result[j].confidence
+	})
+	return result
+}
+
+// fuseCluster 融合一簇检测框；掩码和关键点沿用置信度最高的框，来源模型合并记录
+func fuseCluster(members []boundingBox, numModels int) boundingBox {
+	fused := members[0] // 已按置信度降序排列
+	var sumConf, x1, y1, x2, y2 float32
+	var models []string
+	for _, box := range members {
+		sumConf += box.confidence
+		x1 += box.x1 * box.confidence
+		y1 += box.y1 * box.confidence
+		x2 += box.x2 * box.confidence
+		y2 += box.y2 * box.confidence
+		if !checkStrIsInArray(box.model, models) {
+			models = append(models, box.model)
+		}
+	}
+	fused.x1, fused.y1, fused.x2, fused.y2 = x1/sumConf, y1/sumConf, x2/sumConf, y2/sumConf
+	fused.confidence = sumConf / float32(len(members)) * float32(min(len(members), numModels)) / float32(numModels)
+	fused.model = strings.Join(models, "+")
+	return fused
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestWeightedBoxFusionAveragesOverlappingBoxes(t *testing.T) {
+	boxes := []boundingBox{
+		{label: "car", confidence: 0.8, x1: 10, y1: 10, x2: 110, y2: 110, model: "a"},
+		{label: "car", confidence: 0.4, x1: 14, y1: 14, x2: 114, y2: 114, model: "b"},
+	}
+	fused := weightedBoxFusion(boxes, 0.55, 2)
+	if len(fused) != 1 {
+		t.Fatalf("融合结果 %d 个框，期望 1 个", len(fused))
+	}
+	got := fused[0]
+	// 坐标按置信度加权：(10*0.8 + 14*0.4) / 1.2
+	want := float32((10*0.8 + 14*0.4) / 1.2)
+	if !approxEqual(got.x1, want) || !approxEqual(got.y1, want) || !approxEqual(got.x2, want+100) || !approxEqual(got.y2, want+100) {
+		t.Errorf("融合框 = (%v, %v, %v, %v)，期望左上角 %v", got.x1, got.y1, got.x2, got.y2, want)
+	}
+	if !approxEqual(got.confidence, 0.6) {
+		t.Errorf("融合置信度 = %v，期望 0.6（两个模型都检测到，平均置信度不降权）", got.confidence)
+	}
+	if got.model != "a+b" {
+		t.Errorf("来源模型 = %q，期望 a+b", got.model)
+	}
+}
+
+func TestWeightedBoxFusionDownweightsSingleModelBoxes(t *testing.T) {
+	boxes := []boundingBox{
+		// 只有模型 a 检测到
+		{label: "person", confidence: 0.9, x1: 0, y1: 0, x2: 50, y2: 50, model: "a"},
+		// 两个模型都检测到
+		{label: "person", confidence: 0.6, x1: 200, y1: 200, x2: 250, y2: 250, model: "a"},
+		{label: "person", confidence: 0.6, x1: 201, y1: 201, x2: 251, y2: 251, model: "b"},
+	}
+	fused := weightedBoxFusion(boxes, 0.55, 2)
+	if len(fused) != 2 {
+		t.Fatalf("融合结果 %d 个框，期望 2 个", len(fused))
+	}
+	if fused[0].x1 < 100 {
+		t.Errorf("排在第一的是只有一个模型检测到的框 %+v，期望两个模型都检测到的框", fused[0])
+	}
+	if !approxEqual(fused[1].confidence, 0.45) {
+		t.Errorf("单模型框的置信度 = %v，期望 0.9 × 1/2 = 0.45", fused[1].confidence)
+	}
+}
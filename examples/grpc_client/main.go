@@ -0,0 +1,105 @@
+//go:build grpc
+
+// grpc_client 调用 -grpc-addr 检测服务的示例：检测一张图像，或以 DetectStream 依次发送多张图像（帧序列）
+//
+//	go run -tags grpc ./examples/grpc_client -addr localhost:50051 ./assets/bus.jpg
+//	go run -tags grpc ./examples/grpc_client -addr localhost:50051 -stream -classes person ./frames/*.jpg
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"yolo-go-detector/proto/detectorpb"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "gRPC 检测服务地址")
+	stream := flag.Bool("stream", false, "以 DetectStream 发送所有图像")
+	conf := flag.Float64("conf", 0, "置信度阈值，0 表示使用服务端参数")
+	classes := flag.String("classes", "", "只保留的类别，逗号分隔")
+	timeout := flag.Duration("timeout", 30*time.Second, "整个调用的超时时间")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("用法: grpc_client [-addr host:port] [-stream] 图像...")
+	}
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("连接 %s 失败: %v", *addr, err)
+	}
+	defer conn.Close()
+	client := detectorpb.NewDetectorClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	params := &detectorpb.DetectionParams{Conf: float32(*conf)}
+	if *classes != "" {
+		params.Classes = strings.Split(*classes, ",")
+	}
+	request := func(i int, path string) *detectorpb.ImageRequest {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("读取图像失败: %v", err)
+		}
+		return &detectorpb.ImageRequest{Image: data, Source: path, FrameId: uint64(i), Params: params}
+	}
+
+	if !*stream {
+		for i, path := range flag.Args() {
+			resp, err := client.Detect(ctx, request(i, path))
+			if err != nil {
+				log.Fatalf("检测 %s 失败: %v", path, err)
+			}
+			printResponse(resp)
+		}
+		return
+	}
+
+	s, err := client.DetectStream(ctx)
+	if err != nil {
+		log.Fatalf("打开检测流失败: %v", err)
+	}
+	go func() {
+		for i, path := range flag.Args() {
+			if err := s.Send(request(i, path)); err != nil {
+				log.Printf("发送 %s 失败: %v", path, err)
+				break
+			}
+		}
+		s.CloseSend()
+	}()
+	for {
+		resp, err := s.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatalf("接收检测结果失败: %v", err)
+		}
+		printResponse(resp)
+	}
+}
+
+func printResponse(resp *detectorpb.DetectionResponse) {
+	if resp.GetError() != "" {
+		fmt.Printf("#%d %s: 失败: %s\n", resp.GetFrameId(), resp.GetSource(), resp.GetError())
+		return
+	}
+	t := resp.GetTiming()
+	fmt.Printf("#%d %s: %dx%d，%d 个目标（排队 %dµs，推理 %dµs，总计 %dµs）\n", resp.GetFrameId(), resp.GetSource(),
+		resp.GetWidth(), resp.GetHeight(), len(resp.GetDetections()), t.GetQueueUs(), t.GetInferenceUs(), t.GetTotalUs())
+	for _, d := range resp.GetDetections() {
+		b := d.GetBox()
+		fmt.Printf("  %s(%d) %.2f [%.0f, %.0f, %.0f, %.0f]\n", d.GetLabel(), d.GetClassId(), d.GetConfidence(), b.GetX1(), b.GetY1(), b.GetX2(), b.GetY2())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// 进程退出码，便于在脚本、cron 和 CI 中判断结果
+const (
+	exitOK          = 0   // 全部图像处理成功
+	exitSetup       = 1   // 启动失败（参数无效、模型文件或 ONNX Runtime 库缺失、没有找到图像等），未处理任何图像
+	exitFailed      = 2   // 有图像处理失败（检测、绘制或保存出错）
+	exitDetected    = 3   // 开启 -fail-on-detect 且检测到危险对象（全部图像处理成功时）
+	exitInterrupted = 130 // 收到中断信号后取消了批量处理
+)
+
+// failOnDetect 检测到危险对象时以退出码 3 结束，用作自动检查的关卡
+var failOnDetect = &config.FailOnDetect
+
+// runOutcome 本次运行的处理结果汇总，决定进程退出码；各处理路径在图像处理结束（含保存）后记录
+type runOutcome struct {
+	failed      atomic.Int64 // 处理失败的图像数
+	danger      atomic.Int64 // 检测到危险对象的图像数
+	interrupted atomic.Bool  // 收到中断信号取消了批量处理
+}
+
+var outcome runOutcome
+
+// record 记录一张图像的最终结果，err 为检测之后的绘制或保存错误；取消而未处理的图像不应记录
+func (o *runOutcome) record(result DetectionResult, err error) {
+	switch {
+	case result.Error != nil || err != nil:
+		o.failed.Add(1)
+	case result.DangerCount > 0:
+		o.danger.Add(1)
+	}
+}
+
+// fail 记录不属于单张图像的处理失败（如批量处理中途出错）
+func (o *runOutcome) fail() {
+	o.failed.Add(1)
+}
+
+// exitCode 按优先级返回退出码：中断 > 图像失败 > 检测到危险对象
+func (o *runOutcome) exitCode() int {
+	switch {
+	case o.interrupted.Load():
+		return exitInterrupted
+	case o.failed.Load() > 0:
+		return exitFailed
+	case *failOnDetect && o.danger.Load() > 0:
+		return exitDetected
+	}
+	return exitOK
+}
+
+// checkModelFiles 在处理图像之前确认模型文件存在且 ONNX Runtime 库可以加载，
+// 缺失时作为启动失败（退出码 1）报告，而不是让每张图像各自失败
+func checkModelFiles() error {
+	for _, path := range modelPaths() {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("模型文件不可用: %w", err)
+		}
+	}
+	if err := initializeORTEnvironment(); err != nil {
+		return fmt.Errorf("加载 ONNX Runtime 失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runMain 在子进程中以 args（换行分隔）为命令行参数执行 main，以其退出码结束
+func runMain(args string) {
+	os.Args = append([]string{"yolo-go-detector"}, strings.Split(args, "\n")...)
+	main()
+	os.Exit(exitOK)
+}
+
+// execMain 以 args 为命令行参数在子进程中执行 main，返回退出码和输出
+func execMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "YOLO_MAIN_ARGS="+strings.Join(args, "\n"))
+	cmd.Dir = t.TempDir()
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return exitOK, string(output)
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), string(output)
+	}
+	t.Fatal(err)
+	return 0, ""
+}
+
+func TestExitCodeEndToEnd(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "frame.png")
+	if err := os.WriteFile(img, encodeTestImage(t, "png", 32, 32), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missingModel := filepath.Join(dir, "missing.onnx")
+
+	tests := []struct {
+		name   string
+		args   []string
+		want   int
+		output string // 输出中应包含的内容
+	}{
+		{"模型文件不存在", []string{"-model", missingModel, "-img", img}, exitSetup, "模型文件不可用"},
+		{"模型文件不存在时不处理目录中的图像", []string{"-model", missingModel, "-img", dir}, exitSetup, "模型文件不可用"},
+		{"未知参数", []string{"-no-such-flag"}, exitSetup, "no-such-flag"},
+		{"参数值无效", []string{"-workers", "many"}, exitSetup, "workers"},
+		{"帮助", []string{"-h"}, exitOK, "-fail-on-detect"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, output := execMain(t, tt.args...)
+			if code != tt.want {
+				t.Errorf("退出码 = %d，期望 %d\n%s", code, tt.want, output)
+			}
+			if !strings.Contains(output, tt.output) {
+				t.Errorf("输出中没有 %q:\n%s", tt.output, output)
+			}
+		})
+	}
+}
+
+func TestRunOutcomeExitCode(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	ok := DetectionResult{}
+	var danger DetectionResult
+	danger.DangerCount = 1
+	failed := DetectionResult{Error: errors.New("推理失败")}
+
+	tests := []struct {
+		name         string
+		results      []DetectionResult
+		saveErr      error // 最后一张图像的保存错误
+		interrupted  bool
+		failOnDetect bool
+		want         int
+	}{
+		{"没有图像", nil, nil, false, false, exitOK},
+		{"全部成功", []DetectionResult{ok, ok}, nil, false, false, exitOK},
+		{"检测到危险对象但未开启 -fail-on-detect", []DetectionResult{ok, danger}, nil, false, false, exitOK},
+		{"-fail-on-detect", []DetectionResult{ok, danger}, nil, false, true, exitDetected},
+		{"有图像检测失败", []DetectionResult{ok, failed}, nil, false, false, exitFailed},
+		{"有图像保存失败", []DetectionResult{ok, ok}, errors.New("磁盘已满"), false, false, exitFailed},
+		{"图像失败优先于危险对象", []DetectionResult{danger, failed}, nil, false, true, exitFailed},
+		{"保存失败的危险图像不计为危险", []DetectionResult{danger}, errors.New("磁盘已满"), false, true, exitFailed},
+		{"中断优先", []DetectionResult{failed, danger}, nil, true, true, exitInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.FailOnDetect = tt.failOnDetect
+			var o runOutcome
+			for i, result := range tt.results {
+				var err error
+				if i == len(tt.results)-1 {
+					err = tt.saveErr
+				}
+				o.record(result, err)
+			}
+			o.interrupted.Store(tt.interrupted)
+			if got := o.exitCode(); got != tt.want {
+				t.Errorf("exitCode() = %d，期望 %d", got, tt.want)
+			}
+		})
+	}
+}
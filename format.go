@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 报告格式化参数
+var (
+	displayTimezone     = &config.Timezone
+	confidencePrecision = &config.Precision
+)
+
+var (
+	displayLocation     *time.Location
+	displayLocationOnce sync.Once
+)
+
+// getDisplayLocation 返回 -timezone 对应的时区，无效时回退到本地时区
+func getDisplayLocation() *time.Location {
+	displayLocationOnce.Do(func() {
+		loc, err := time.LoadLocation(*displayTimezone)
+		if err != nil {
+			fmt.Printf("警告: 无效的时区 %q，使用本地时区: %v\n", *displayTimezone, err)
+			loc = time.Local
+		}
+		displayLocation = loc
+	})
+	return displayLocation
+}
+
+// formatTimestamp 将时间格式化为带时区偏移的 ISO-8601 字符串（用于控制台、日志和报告）
+// JSON 导出直接使用 time.Time 的 RFC3339 编码，不受显示设置影响
+func formatTimestamp(t time.Time) string {
+	return t.In(getDisplayLocation()).Format(time.RFC3339)
+}
+
+// formatDate 返回配置时区下的日期（用于按日期命名的文件）
+func formatDate(t time.Time) string {
+	return t.In(getDisplayLocation()).Format("2006-01-02")
+}
+
+// formatConfidence 按 -precision 格式化置信度
+func formatConfidence(conf float32) string {
+	return formatConfidenceN(conf, *confidencePrecision)
+}
+
+// formatConfidenceN 按指定小数位数格式化置信度
+// 采用向下截断而不是四舍五入，避免 0.49999 显示为 0.50 而被误认为达到告警阈值
+func formatConfidenceN(conf float32, precision int) string {
+	precision = max(0, min(precision, 9))
+	scale := math.Pow10(precision)
+	// 先在 float32 精度上修正，避免 0.7 这类值因二进制表示被截断为 0.69
+	value, _ := strconv.ParseFloat(strconv.FormatFloat(float64(conf), 'g', -1, 32), 64)
+	truncated := math.Floor(value*scale+1e-9) / scale
+	return strconv.FormatFloat(truncated, 'f', precision, 64)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// setDisplayTimezone 测试期间把 -timezone 设为 tz，并让 getDisplayLocation 重新解析
+func setDisplayTimezone(t *testing.T, tz string) {
+	t.Helper()
+	saved := config.Timezone
+	t.Cleanup(func() {
+		config.Timezone = saved
+		displayLocationOnce = sync.Once{}
+	})
+	config.Timezone = tz
+	displayLocationOnce = sync.Once{}
+}
+
+func TestFormatTimestampDST(t *testing.T) {
+	tests := []struct {
+		name string
+		tz   string
+		at   time.Time
+		want string
+		date string
+	}{
+		{"夏令时开始前", "America/New_York", time.Date(2024, 3, 10, 6, 59, 59, 0, time.UTC), "2024-03-10T01:59:59-05:00", "2024-03-10"},
+		{"夏令时开始后", "America/New_York", time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), "2024-03-10T03:00:00-04:00", "2024-03-10"},
+		{"夏令时结束前的 01:30", "America/New_York", time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), "2024-11-03T01:30:00-04:00", "2024-11-03"},
+		{"夏令时结束后的 01:30", "America/New_York", time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC), "2024-11-03T01:30:00-05:00", "2024-11-03"},
+		{"UTC 跨日", "Asia/Shanghai", time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC), "2024-05-02T00:30:00+08:00", "2024-05-02"},
+		{"UTC", "UTC", time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC), "2024-05-01T16:30:00Z", "2024-05-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDisplayTimezone(t, tt.tz)
+			if got := formatTimestamp(tt.at); got != tt.want {
+				t.Errorf("formatTimestamp() = %s，期望 %s", got, tt.want)
+			}
+			if got := formatDate(tt.at); got != tt.date {
+				t.Errorf("formatDate() = %s，期望 %s", got, tt.date)
+			}
+
+			// JSON 导出始终为 RFC3339，不受 -timezone 影响
+			data, err := json.Marshal(ResultRecord{Timestamp: tt.at})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.at.Format(time.RFC3339); !strings.Contains(string(data), `"timestamp":"`+want+`"`) {
+				t.Errorf("JSON = %s，期望时间戳 %s", data, want)
+			}
+		})
+	}
+}
+
+func TestFormatConfidencePrecision(t *testing.T) {
+	tests := []struct {
+		conf      float32
+		precision int
+		want      string
+	}{
+		{0.49999, 2, "0.49"}, // 不能显示为告警阈值 0.50
+		{0.5, 2, "0.50"},
+		{0.7, 2, "0.70"}, // float32 的 0.7 略小于 0.7，不应截断为 0.69
+		{0.29, 2, "0.29"},
+		{0.123456, 4, "0.1234"},
+		{0.999999, 3, "0.999"},
+		{1, 2, "1.00"},
+		{0.87, 0, "0"},
+		{0.87, -1, "0"},
+		{0.123456789, 12, "0.123456790"}, // 最多 9 位
+	}
+	for _, tt := range tests {
+		if got := formatConfidenceN(tt.conf, tt.precision); got != tt.want {
+			t.Errorf("formatConfidenceN(%v, %d) = %s，期望 %s", tt.conf, tt.precision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// 模型是否使用 float16 输入输出的缓存（按模型路径）
+var (
+	float16Cache      = make(map[string]bool)
+	float16CacheMutex sync.Mutex
+)
+
+// modelUsesFloat16 根据模型元数据判断输入张量是否为 float16（half=True 导出）
+// 需要在 ORT 环境初始化之后调用，读取失败时按 float32 处理
+func modelUsesFloat16(path string) bool {
+	float16CacheMutex.Lock()
+	defer float16CacheMutex.Unlock()
+	if half, ok := float16Cache[path]; ok {
+		return half
+	}
+	inputs, _, err := ort.GetInputOutputInfo(path)
+	half := err == nil && len(inputs) > 0 && inputs[0].DataType == ort.TensorElementDataTypeFloat16
+	float16Cache[path] = half
+	return half
+}
+
+// invalidateFloat16Cache 清除某个模型路径的精度缓存（模型文件被原地替换后调用）
+func invalidateFloat16Cache(path string) {
+	float16CacheMutex.Lock()
+	defer float16CacheMutex.Unlock()
+	delete(float16Cache, path)
+}
+
+// newFloat16Tensor 创建指定形状的 float16 张量（底层为字节切片）
+func newFloat16Tensor(shape ort.Shape) (*ort.CustomDataTensor, error) {
+	return ort.NewCustomDataTensor(shape, make([]byte, 2*shape.FlattenedSize()), ort.TensorElementDataTypeFloat16)
+}
+
+// encodeFloat16 将 float32 数据转换为小端 float16 字节
+func encodeFloat16(dst []byte, src []float32) {
+	n := min(len(src), len(dst)/2)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(dst[2*i:], float32ToFloat16(src[i]))
+	}
+}
+
+// decodeFloat16 将小端 float16 字节扩展为 float32
+func decodeFloat16(dst []float32, src []byte) {
+	n := min(len(dst), len(src)/2)
+	for i := 0; i < n; i++ {
+		dst[i] = float16ToFloat32(binary.LittleEndian.Uint16(src[2*i:]))
+	}
+}
+
+// float32ToFloat16 IEEE 754 单精度转半精度（就近舍入到偶数）
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign // ±0
+	case bits>>23&0xff == 0xff:
+		if mant != 0 {
+			return sign | 0x7e00 // NaN
+		}
+		return sign | 0x7c00 // ±Inf
+	case exp >= 0x1f:
+		return sign | 0x7c00 // 上溢为 Inf
+	case exp <= 0:
+		// 非规格化数或下溢为 0
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint32(14 - exp)
+		half := uint16(mant >> shift)
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := sign | uint16(exp)<<10 | uint16(mant>>13)
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // 进位可能溢出到指数位，结果仍然正确（最大值进位为 Inf）
+	}
+	return half
+}
+
+// float16ToFloat32 IEEE 754 半精度转单精度
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// 非规格化数：规格化后再转换
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	case 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
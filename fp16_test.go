@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat32ToFloat16(t *testing.T) {
+	tests := []struct {
+		name string
+		f    float32
+		want uint16
+	}{
+		{"1", 1, 0x3c00},
+		{"-2", -2, 0xc000},
+		{"0", 0, 0x0000},
+		{"-0", float32(math.Copysign(0, -1)), 0x8000},
+		{"0.1 就近舍入", 0.1, 0x2e66},
+		{"最大有限值", 65504, 0x7bff},
+		{"上溢为 Inf", 65520, 0x7c00},
+		{"Inf", float32(math.Inf(1)), 0x7c00},
+		{"-Inf", float32(math.Inf(-1)), 0xfc00},
+		{"NaN", float32(math.NaN()), 0x7e00},
+		{"最小非规格化数", float32(math.Ldexp(1, -24)), 0x0001},
+		{"下溢为 0", float32(math.Ldexp(1, -26)), 0x0000},
+		{"恰好一半时舍入到偶数（向下）", 1 + float32(math.Ldexp(1, -11)), 0x3c00},
+		{"恰好一半时舍入到偶数（向上）", 1 + 3*float32(math.Ldexp(1, -11)), 0x3c02},
+		{"尾数进位到指数", 2 - float32(math.Ldexp(1, -12)), 0x4000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := float32ToFloat16(tt.f); got != tt.want {
+				t.Errorf("float32ToFloat16(%v) = %#04x，期望 %#04x", tt.f, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFloat16RoundTrip(t *testing.T) {
+	// 每个半精度值（NaN 除外）扩展为 float32 后再转换回来不变
+	for h := 0; h <= 0xffff; h++ {
+		if h&0x7c00 == 0x7c00 && h&0x3ff != 0 {
+			continue
+		}
+		if got := float32ToFloat16(float16ToFloat32(uint16(h))); got != uint16(h) {
+			t.Fatalf("%#04x 往返后为 %#04x", h, got)
+		}
+	}
+
+	// 归一化后的像素值经 float16 张量写入、读出，误差不超过半精度的舍入误差
+	src := make([]float32, 256)
+	for i := range src {
+		src[i] = float32(i) / 255
+	}
+	buf := make([]byte, 2*len(src))
+	encodeFloat16(buf, src)
+	dst := make([]float32, len(src))
+	decodeFloat16(dst, buf)
+	for i := range src {
+		if diff := math.Abs(float64(dst[i] - src[i])); diff > math.Ldexp(1, -12) {
+			t.Errorf("像素值 %d/255: %v 往返后为 %v", i, src[i], dst[i])
+		}
+	}
+}
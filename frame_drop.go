@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 自适应丢帧参数
+var adaptiveDrop = &config.AdaptiveDrop
+
+// adaptiveDropPoll 任务队列超过阈值时重新检查队列深度的间隔
+const adaptiveDropPoll = 10 * time.Millisecond
+
+// latestFrameSource 自适应丢帧（-adaptive-drop）：由单独的协程不停读取 source，只保留最新的一帧；
+// 任务队列中等待处理的任务超过 threshold 时暂不提交，期间读到的新帧替换未提交的旧帧
+// 检测跟不上时丢弃的总是较旧的帧，ffmpeg 和摄像头一侧不积压，检测结果的延迟保持在队列深度以内
+// 丢帧只在读取端决定，工作协程照常处理已提交的帧；帧序号（frame_index）为帧在流中的实际序号，丢弃的帧留下间隔
+type latestFrameSource struct {
+	source    frameSource
+	manager   *VideoDetectorManager
+	threshold int
+	onDrop    func() // 每丢弃一帧调用一次，可以为 nil
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	frame   videoFrame
+	ready   bool  // frame 为尚未提交的最新帧
+	err     error // source 返回的错误，设置后读取协程退出
+	dropped int64 // 丢弃的帧数，使用原子操作
+	done    chan struct{}
+}
+
+// newLatestFrameSource 启动读取协程；source 出错（读完、断开或 ctx 取消）后协程退出
+func newLatestFrameSource(source frameSource, manager *VideoDetectorManager, threshold int, onDrop func()) *latestFrameSource {
+	s := &latestFrameSource{source: source, manager: manager, threshold: threshold, onDrop: onDrop, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mutex)
+	go s.read()
+	return s
+}
+
+func (s *latestFrameSource) read() {
+	defer close(s.done)
+	for {
+		frame, err := s.source.Next()
+		s.mutex.Lock()
+		if err != nil {
+			s.err = err
+			s.mutex.Unlock()
+			s.cond.Broadcast()
+			return
+		}
+		if s.ready {
+			s.drop(s.frame)
+		}
+		s.frame, s.ready = frame, true
+		s.mutex.Unlock()
+		s.cond.Broadcast()
+	}
+}
+
+// drop 丢弃一帧未提交的帧，调用方持有 mutex
+func (s *latestFrameSource) drop(frame videoFrame) {
+	PutImageToPool(frame.image)
+	atomic.AddInt64(&s.dropped, 1)
+	atomic.AddInt64(&metrics.streamDropped, 1)
+	if s.manager.window != nil {
+		s.manager.window.DropFrame()
+	}
+	if s.onDrop != nil {
+		s.onDrop()
+	}
+}
+
+// Next 等待任务队列降到阈值以内，返回此时最新的一帧；source 出错后先返回最后读到的帧，再返回错误
+func (s *latestFrameSource) Next() (videoFrame, error) {
+	for {
+		s.mutex.Lock()
+		for !s.ready && s.err == nil {
+			s.cond.Wait()
+		}
+		if !s.ready {
+			err := s.err
+			s.mutex.Unlock()
+			return videoFrame{}, err
+		}
+		if s.err != nil || s.manager.queuedTasks() <= s.threshold {
+			frame := s.frame
+			s.frame, s.ready = videoFrame{}, false
+			s.mutex.Unlock()
+			return frame, nil
+		}
+		s.mutex.Unlock()
+		time.Sleep(adaptiveDropPoll)
+	}
+}
+
+// Dropped 返回丢弃的帧数
+func (s *latestFrameSource) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close 等待读取协程退出（source 须已经或即将出错，如 ctx 已取消），放回未提交的帧
+// 之后才能关闭 source，避免与读取协程同时使用
+func (s *latestFrameSource) Close() {
+	<-s.done
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ready {
+		PutImageToPool(s.frame.image)
+		s.frame, s.ready = videoFrame{}, false
+	}
+}
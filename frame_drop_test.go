@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"io"
+	"runtime/debug"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeFrameSource 由测试逐帧推送的帧来源，close 后 Next 返回 err
+type fakeFrameSource struct {
+	frames chan videoFrame
+	err    error
+}
+
+func (s *fakeFrameSource) Next() (videoFrame, error) {
+	frame, ok := <-s.frames
+	if !ok {
+		return videoFrame{}, s.err
+	}
+	return frame, nil
+}
+
+// push 推送第 index 帧，返回帧的图像
+// 图像新分配而不取自图像池，丢弃后放回图像池的图像不会被后面的帧复用，可以从图像池中找回
+func (s *fakeFrameSource) push(index int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	s.frames <- videoFrame{index: index, image: img}
+	return img
+}
+
+// close 之后 Next 返回 err
+func (s *fakeFrameSource) close(err error) {
+	s.err = err
+	close(s.frames)
+}
+
+// fakeQueueManager 只有任务队列的管理器，测试直接放入或取出任务来控制队列深度
+func fakeQueueManager() *VideoDetectorManager {
+	return &VideoDetectorManager{taskQueue: make(chan *DetectionTask, 8), highQueue: make(chan *DetectionTask, 8)}
+}
+
+// nextFrame 在 1 秒内从 s 读取一帧
+func nextFrame(t *testing.T, s *latestFrameSource) (videoFrame, error) {
+	t.Helper()
+	type next struct {
+		frame videoFrame
+		err   error
+	}
+	got := make(chan next, 1)
+	go func() {
+		frame, err := s.Next()
+		got <- next{frame, err}
+	}()
+	select {
+	case n := <-got:
+		return n.frame, n.err
+	case <-time.After(time.Second):
+		t.Fatal("Next() 没有返回")
+		return videoFrame{}, nil
+	}
+}
+
+// expectPooled 检查 images 已放回 4x4 的图像池：依次取出的正好是这些图像，且没有新分配
+// -race 时 sync.Pool 会随机丢弃归还的对象，不检查
+func expectPooled(t *testing.T, allocated *atomic.Int64, images ...*image.RGBA) {
+	t.Helper()
+	if raceEnabled {
+		return
+	}
+	before := allocated.Load()
+	got := make([]*image.RGBA, len(images))
+	for i := range got {
+		got[i] = getImageUncleared(4, 4)
+	}
+	for _, img := range images {
+		if !slices.Contains(got, img) {
+			t.Errorf("图像 %p 没有放回图像池", img)
+		}
+	}
+	if n := allocated.Load() - before; n > 0 {
+		t.Errorf("从图像池取出 %d 个图像时新分配了 %d 个", len(images), n)
+	}
+	for _, img := range got {
+		PutImageToPool(img)
+	}
+}
+
+func TestLatestFrameSource(t *testing.T) {
+	defer func(saved *detectorMetrics) { metrics = saved }(metrics)
+	metrics = newDetectorMetrics()
+	defer debug.SetGCPercent(debug.SetGCPercent(-1)) // GC 会清空图像池
+	allocated := countingImagePool(t, 4, 4)
+
+	manager := fakeQueueManager()
+	source := &fakeFrameSource{frames: make(chan videoFrame)}
+	var dropped atomic.Int64
+	s := newLatestFrameSource(source, manager, 1, func() { dropped.Add(1) })
+
+	// 队列未超过阈值：读到的帧直接返回
+	source.push(0)
+	if frame, err := nextFrame(t, s); err != nil || frame.index != 0 {
+		t.Fatalf("Next() = 第 %d 帧, %v，期望第 0 帧", frame.index, err)
+	}
+
+	// 队列中等待的任务超过阈值：暂不返回，期间读到的新帧替换未提交的旧帧
+	manager.taskQueue <- &DetectionTask{}
+	manager.highQueue <- &DetectionTask{}
+	got := make(chan videoFrame, 1)
+	go func() {
+		frame, _ := s.Next()
+		got <- frame
+	}()
+	var stale []*image.RGBA
+	for i := 1; i <= 5; i++ {
+		img := source.push(i)
+		if i < 5 {
+			stale = append(stale, img)
+		}
+	}
+	waitUntil(t, "丢弃 4 帧", func() bool { return s.Dropped() == 4 })
+	select {
+	case frame := <-got:
+		t.Fatalf("队列超过阈值时返回了第 %d 帧", frame.index)
+	case <-time.After(5 * adaptiveDropPoll):
+	}
+	<-manager.highQueue
+	select {
+	case frame := <-got:
+		if frame.index != 5 {
+			t.Errorf("队列降到阈值后返回第 %d 帧，期望最新的第 5 帧", frame.index)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("队列降到阈值后 Next() 没有返回")
+	}
+	if s.Dropped() != 4 || atomic.LoadInt64(&metrics.streamDropped) != 4 || dropped.Load() != 4 {
+		t.Errorf("丢帧数 Dropped() = %d，指标 %d，回调 %d 次，期望都为 4", s.Dropped(), atomic.LoadInt64(&metrics.streamDropped), dropped.Load())
+	}
+	expectPooled(t, allocated, stale...)
+
+	// Close 等待读取协程在 source 出错后退出，放回未提交的帧
+	pending := source.push(6)
+	waitUntil(t, "读到第 6 帧", func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.ready && s.frame.index == 6
+	})
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("source 出错前 Close() 就返回了")
+	case <-time.After(50 * time.Millisecond):
+	}
+	source.close(io.EOF)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("source 出错后 Close() 没有返回")
+	}
+	if _, err := nextFrame(t, s); err != io.EOF {
+		t.Errorf("Close() 后 Next() 的错误 = %v，期望 io.EOF", err)
+	}
+	expectPooled(t, allocated, append(stale, pending)...) // 上面检查时取出的图像已放回
+}
+
+func TestLatestFrameSourceSourceError(t *testing.T) {
+	defer func(saved *detectorMetrics) { metrics = saved }(metrics)
+	metrics = newDetectorMetrics()
+	lost := errors.New("流已断开")
+
+	tests := []struct {
+		name   string
+		queued int // 队列中等待的任务数，阈值为 1
+	}{
+		{"队列未超过阈值", 0},
+		// source 出错后不再有新帧，最后一帧不等待队列
+		{"队列超过阈值", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := fakeQueueManager()
+			for range tt.queued {
+				manager.taskQueue <- &DetectionTask{}
+			}
+			source := &fakeFrameSource{frames: make(chan videoFrame)}
+			s := newLatestFrameSource(source, manager, 1, nil)
+			source.push(7)
+			source.close(lost)
+			<-s.done
+
+			if frame, err := nextFrame(t, s); err != nil || frame.index != 7 {
+				t.Errorf("Next() = 第 %d 帧, %v，期望先返回最后读到的第 7 帧", frame.index, err)
+			}
+			if _, err := nextFrame(t, s); err != lost {
+				t.Errorf("Next() 的错误 = %v，期望 %v", err, lost)
+			}
+			s.Close()
+			if s.Dropped() != 0 {
+				t.Errorf("丢弃了 %d 帧，期望 0", s.Dropped())
+			}
+		})
+	}
+}
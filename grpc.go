@@ -0,0 +1,13 @@
+package main
+
+import "errors"
+
+// grpcAddr gRPC 检测服务监听地址，为空时不启动
+var grpcAddr = &config.GRPCAddr
+
+// runGRPCServer 启动 gRPC 检测服务，直到收到中断信号，返回进程退出码
+// 默认构建不包含 gRPC（避免引入 grpc 和 protobuf 依赖），以 -tags grpc 构建时由 grpc_server.go 设置
+var runGRPCServer func(addr string) int
+
+// ErrNoGRPC 当前构建未包含 gRPC 服务
+var ErrNoGRPC = errors.New("当前构建未包含 gRPC 服务，请以 -tags grpc 重新构建")
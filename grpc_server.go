@@ -0,0 +1,256 @@
+//go:build grpc
+
+package main
+
+// 以 -tags grpc 构建时提供 -grpc-addr 的 gRPC 检测服务，消息和服务定义见 proto/detector.proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"yolo-go-detector/proto/detectorpb"
+)
+
+func init() {
+	runGRPCServer = serveGRPC
+}
+
+// grpcDetector Detector 服务的实现，任务提交到工作协程池，与 -serve 的 HTTP 服务相同
+type grpcDetector struct {
+	detectorpb.UnimplementedDetectorServer
+	manager *VideoDetectorManager
+}
+
+// serveGRPC 启动 gRPC 服务，第一次中断时停止接收新的调用，等待进行中的调用完成（最多 -shutdown-timeout）后停止工作协程池
+func serveGRPC(addr string) int {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("监听 gRPC 地址 %s 失败: %v\n", addr, err)
+		return exitSetup
+	}
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+
+	server := newGRPCServer(manager)
+
+	ctx, release := interruptibleContext()
+	defer release()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	fmt.Printf("gRPC 检测服务已在 %s 启动，工作协程数量: %d, 队列大小: %d\n", listener.Addr(), *workerCount, *queueSize)
+	writeLogFile("INFO", fmt.Sprintf("gRPC 检测服务已在 %s 启动", listener.Addr()))
+
+	select {
+	case err := <-serveErr:
+		fmt.Printf("gRPC 检测服务退出: %v\n", err)
+		return exitFailed
+	case <-ctx.Done():
+	}
+
+	fmt.Printf("正在停止 gRPC 检测服务，等待进行中的调用完成（最多 %v）\n", *shutdownTimeout)
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(*shutdownTimeout):
+		fmt.Printf("等待进行中的调用超时，强制停止\n")
+		server.Stop()
+	}
+	fmt.Printf("gRPC 检测服务已停止\n")
+	writeLogFile("INFO", "gRPC 检测服务已停止")
+	return exitOK
+}
+
+// newGRPCServer 创建提供 Detector 服务的 gRPC 服务器，任务提交到 manager
+func newGRPCServer(manager *VideoDetectorManager) *grpc.Server {
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(serveMaxUpload))
+	detectorpb.RegisterDetectorServer(server, &grpcDetector{manager: manager})
+	return server
+}
+
+// grpcFrame 一个已提交（或提交失败）的检测请求
+type grpcFrame struct {
+	req      *detectorpb.ImageRequest
+	received time.Time
+	task     *DetectionTask
+	callback chan DetectionResult
+	err      error // 解码、参数或提交失败
+}
+
+// submit 解码图像并提交任务；wait 为 true 时队列已满等待空位（流式调用的背压），否则立即返回 ErrQueueFull
+func (d *grpcDetector) submit(ctx context.Context, req *detectorpb.ImageRequest, wait bool) *grpcFrame {
+	frame := &grpcFrame{req: req, received: time.Now()}
+	if len(req.GetImage()) == 0 {
+		frame.err = ErrEmptyImage
+		return frame
+	}
+	params := grpcParams(req.GetParams())
+	if _, err := newDetectionConfig().withParams(params); err != nil {
+		frame.err = err
+		return frame
+	}
+	img, err := decodeImage(bytes.NewReader(req.GetImage()))
+	if err != nil {
+		frame.err = err
+		return frame
+	}
+	name := req.GetSource()
+	if name == "" {
+		name = "grpc"
+	}
+	frame.callback = make(chan DetectionResult, 1)
+	frame.task = &DetectionTask{ImagePath: name, Image: img, Params: params, Ctx: ctx, Callback: frame.callback}
+	if wait {
+		frame.err = d.manager.SubmitTaskWait(ctx, frame.task)
+	} else {
+		frame.err = d.manager.SubmitTask(frame.task)
+	}
+	return frame
+}
+
+// wait 等待任务结果，返回结果和 gRPC 状态错误（提交失败、检测失败或 ctx 结束）
+func (frame *grpcFrame) wait(ctx context.Context) (DetectionResult, error) {
+	if frame.err != nil {
+		return DetectionResult{}, grpcStatus(frame.err)
+	}
+	select {
+	case result := <-frame.callback:
+		if !errors.Is(result.Error, context.Canceled) {
+			resultSinks.WriteResult(result)
+			runDetectHook(result, "")
+		}
+		if result.Error != nil {
+			return result, grpcStatus(result.Error)
+		}
+		return result, nil
+	case <-ctx.Done():
+		return DetectionResult{}, grpcStatus(ctx.Err())
+	}
+}
+
+// response 转换为响应消息；err 不为 nil 时只填写 error
+func (frame *grpcFrame) response(result DetectionResult, err error) *detectorpb.DetectionResponse {
+	resp := &detectorpb.DetectionResponse{
+		Source:  frame.req.GetSource(),
+		FrameId: frame.req.GetFrameId(),
+		Timing:  &detectorpb.Timing{TotalUs: time.Since(frame.received).Microseconds()},
+	}
+	if frame.task != nil {
+		resp.TaskId = frame.task.TaskID
+	}
+	if err != nil {
+		resp.Error = status.Convert(err).Message()
+		return resp
+	}
+	resp.Width, resp.Height = int32(result.Width), int32(result.Height)
+	resp.Timing.QueueUs = frame.task.StartedAt.Sub(frame.task.SubmittedAt).Microseconds()
+	resp.Timing.InferenceUs = result.Elapsed.Microseconds()
+	resp.Detections = make([]*detectorpb.Detection, 0, len(result.Objects))
+	for _, box := range result.Objects {
+		classID, _ := ClassID(box.label)
+		resp.Detections = append(resp.Detections, &detectorpb.Detection{
+			Label:      box.label,
+			LabelZh:    ChineseLabel(box.label),
+			ClassId:    int32(classID),
+			Confidence: box.confidence,
+			Box:        &detectorpb.Box{X1: box.x1, Y1: box.y1, X2: box.x2, Y2: box.y2},
+		})
+	}
+	return resp
+}
+
+// Detect 检测一张图像，队列已满或超出限速时返回 ResourceExhausted
+func (d *grpcDetector) Detect(ctx context.Context, req *detectorpb.ImageRequest) (*detectorpb.DetectionResponse, error) {
+	frame := d.submit(ctx, req, false)
+	result, err := frame.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return frame.response(result, nil), nil
+}
+
+// DetectStream 接收协程按顺序提交帧（队列已满时等待，形成背压），发送协程按相同顺序等待结果并返回
+// 最多 2 倍工作协程数的帧同时在处理中；单帧失败时在响应的 error 中返回
+func (d *grpcDetector) DetectStream(stream detectorpb.Detector_DetectStreamServer) error {
+	ctx := stream.Context()
+	pending := make(chan *grpcFrame, max(1, d.manager.workerCount)*2)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					recvErr <- err
+				}
+				return
+			}
+			select {
+			case pending <- d.submit(ctx, req, true):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for frame := range pending {
+		result, err := frame.wait(ctx)
+		if ctx.Err() != nil {
+			return grpcStatus(ctx.Err())
+		}
+		if err := stream.Send(frame.response(result, err)); err != nil {
+			return err
+		}
+	}
+	select {
+	case err := <-recvErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// grpcParams 转换请求中的检测参数，未设置时返回 nil（全部沿用命令行参数）
+func grpcParams(p *detectorpb.DetectionParams) *DetectionParams {
+	if p == nil {
+		return nil
+	}
+	return &DetectionParams{
+		Conf:           p.GetConf(),
+		IOU:            p.GetIou(),
+		Classes:        p.GetClasses(),
+		ExcludeClasses: p.GetExcludeClasses(),
+		MaxDet:         int(p.GetMaxDet()),
+	}
+}
+
+// grpcStatus 把检测错误转换为 gRPC 状态码
+func grpcStatus(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrTaskTimeout):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrRateLimited):
+		code = codes.ResourceExhausted
+	case errors.Is(err, ErrManagerStopped):
+		code = codes.Unavailable
+	case errors.Is(err, ErrEmptyImage), errors.Is(err, ErrUnsupportedImage), errors.Is(err, ErrCorruptImage),
+		errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrInvalidTaskParams):
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
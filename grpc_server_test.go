@@ -0,0 +1,108 @@
+//go:build grpc
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"yolo-go-detector/proto/detectorpb"
+)
+
+// testModelEnv 集成测试使用的模型路径（如 yolo11n.onnx），未设置或 ONNX Runtime 不可用时跳过需要推理的测试
+const testModelEnv = "YOLO_TEST_MODEL"
+
+// startGRPCServer 在内存监听器上启动 Detector 服务，返回连接到该服务的客户端
+func startGRPCServer(t *testing.T, manager *VideoDetectorManager) detectorpb.DetectorClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(manager)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return detectorpb.NewDetectorClient(conn)
+}
+
+func TestGRPCDetectRejectsInvalidImage(t *testing.T) {
+	manager := NewVideoDetectorManager(1, 4, time.Second)
+	defer manager.Stop()
+	client := startGRPCServer(t, manager)
+
+	tests := []struct {
+		name  string
+		image []byte
+	}{
+		{"空图像", nil},
+		{"不是图像", []byte("not an image")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := client.Detect(ctx, &detectorpb.ImageRequest{Image: tt.image, Source: "test"})
+			if code := status.Code(err); code != codes.InvalidArgument {
+				t.Errorf("状态码 = %v (%v)，期望 InvalidArgument", code, err)
+			}
+		})
+	}
+}
+
+func TestGRPCDetect(t *testing.T) {
+	model := os.Getenv(testModelEnv)
+	if model == "" {
+		t.Skipf("未设置 %s，跳过需要推理的集成测试", testModelEnv)
+	}
+	if err := initializeORTEnvironment(); err != nil {
+		t.Skipf("ONNX Runtime 不可用: %v", err)
+	}
+	defer func(path string) { config.ModelPath = path }(config.ModelPath)
+	config.ModelPath = model
+
+	manager := NewVideoDetectorManager(1, 4, 30*time.Second)
+	defer manager.Stop()
+	client := startGRPCServer(t, manager)
+
+	image, err := os.ReadFile("assets/bus.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := client.Detect(ctx, &detectorpb.ImageRequest{Image: image, Source: "bus.jpg", FrameId: 7})
+	if err != nil {
+		t.Fatalf("Detect 失败: %v", err)
+	}
+	if resp.GetSource() != "bus.jpg" || resp.GetFrameId() != 7 {
+		t.Errorf("来源和帧序号 = %q, %d，期望原样返回 bus.jpg, 7", resp.GetSource(), resp.GetFrameId())
+	}
+	if resp.GetWidth() != 810 || resp.GetHeight() != 1080 {
+		t.Errorf("图像尺寸 = %dx%d，期望 810x1080", resp.GetWidth(), resp.GetHeight())
+	}
+	if len(resp.GetDetections()) == 0 {
+		t.Fatal("没有检测结果")
+	}
+	for _, d := range resp.GetDetections() {
+		if d.GetLabel() == "" || d.GetClassId() < 0 || d.GetBox() == nil {
+			t.Errorf("检测结果不完整: %v", d)
+		}
+	}
+	if resp.GetTiming().GetTotalUs() <= 0 {
+		t.Errorf("总耗时 = %d，期望大于 0", resp.GetTiming().GetTotalUs())
+	}
+}
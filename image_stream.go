@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// streamWindow 流式处理时最多同时未回调的图像数量：足够填满任务队列和所有工作协程，
+// 回调通道按这个容量创建，工作协程发送结果时不会阻塞
+func (manager *VideoDetectorManager) streamWindow() int {
+	return 2*cap(manager.taskQueue) + manager.workerCount*max(1, manager.collectSize)
+}
+
+// streamSubmission 流式处理中一张已读取的图像
+type streamSubmission struct {
+	index    int
+	path     string
+	taskID   uint64
+	metadata map[string]interface{} // 任务的附加元数据，失败结果同样带上
+	err      error                  // 提交失败的原因
+}
+
+// ProcessImageStream 从 paths 逐个读取图像路径并立即提交，按读取顺序逐个回调结果，返回读取的图像数量
+// 与 ProcessImageBatchFunc 不同，不需要事先知道图像总数：同时未回调的图像不超过 streamWindow 个，
+// 超出时暂停读取，路径列表再长内存占用也保持不变。paths 关闭且所有结果回调后返回
+// 每完成一张图像调用一次 progress（Total 为 0，表示总数未知）；ctx 取消后停止读取，
+// 已完成的结果照常回调，其余已读取图像的结果为 ctx.Err()
+func (manager *VideoDetectorManager) ProcessImageStream(ctx context.Context, paths <-chan string, progress ProgressFunc, handle func(i int, result DetectionResult)) int {
+	next := func() (*DetectionTask, bool) {
+		select {
+		case path, ok := <-paths:
+			return &DetectionTask{ImagePath: path}, ok
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	return manager.processTaskStream(ctx, manager.streamWindow(), next, progress, handle)
+}
+
+// processTaskStream 逐个调用 next 取得任务并提交（next 返回 false 时停止读取），按读取顺序逐个回调结果
+// 同时未回调的任务不超过 window 个；任务的 Ctx 和 Callback 由这里设置
+func (manager *VideoDetectorManager) processTaskStream(ctx context.Context, window int, next func() (*DetectionTask, bool), progress ProgressFunc, handle func(i int, result DetectionResult)) int {
+	tracker := newProgressTracker(0, progress)
+	callback := make(chan DetectionResult, window)
+	slots := make(chan struct{}, window) // 每个已读取、尚未回调的任务占一个
+
+	// 读取并提交，队列已满时 SubmitTaskWait 等待空位
+	submissions := make(chan streamSubmission, window)
+	go func() {
+		defer close(submissions)
+		for index := 0; ; index++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			task, ok := next()
+			if !ok {
+				return
+			}
+			task.Ctx = ctx
+			task.Callback = callback
+			err := manager.SubmitTaskWait(ctx, task)
+			submissions <- streamSubmission{index: index, path: task.ImagePath, taskID: task.TaskID, metadata: task.Metadata, err: err}
+		}
+	}()
+
+	var queue []streamSubmission                // 已读取、尚未回调的图像，按读取顺序
+	arrived := make(map[uint64]DetectionResult) // 先到的结果
+	live := make(map[uint64]bool)               // 仍在等待结果的任务，超时后删除，迟到的结果不再回调
+	count := 0
+
+	receive := func(s streamSubmission) {
+		count++
+		queue = append(queue, s)
+		if s.err == nil {
+			live[s.taskID] = true
+		} else if ctx.Err() == nil {
+			tracker.add(true)
+		}
+	}
+	flush := func() {
+		for len(queue) > 0 {
+			head := queue[0]
+			if head.err != nil {
+				handle(head.index, head.failed(fmt.Errorf("提交任务失败: %w", head.err)))
+			} else if result, ok := arrived[head.taskID]; ok {
+				delete(arrived, head.taskID)
+				handle(head.index, result)
+			} else {
+				return
+			}
+			queue = queue[1:]
+			<-slots
+		}
+	}
+
+	// 队首图像等待超过 manager.timeout 时按超时处理，与 ProcessImageBatchFunc 相同
+	timer := time.NewTimer(manager.timeout)
+	defer timer.Stop()
+	waiting := -1
+	pending := submissions
+	for pending != nil || len(queue) > 0 {
+		var timeout <-chan time.Time
+		if len(queue) > 0 {
+			if queue[0].index != waiting {
+				waiting = queue[0].index
+				timer.Reset(manager.timeout)
+			}
+			timeout = timer.C
+		}
+
+		select {
+		case s, ok := <-pending:
+			if !ok {
+				pending = nil
+				continue
+			}
+			receive(s)
+		case result := <-callback:
+			if live[result.TaskID] {
+				delete(live, result.TaskID)
+				arrived[result.TaskID] = result
+				if ctx.Err() == nil || !errors.Is(result.Error, ctx.Err()) {
+					tracker.add(result.Error != nil)
+				}
+			}
+		case <-timeout:
+			head := queue[0]
+			delete(live, head.taskID)
+			arrived[head.taskID] = head.failed(fmt.Errorf("处理超时"))
+			tracker.add(true)
+		case <-ctx.Done():
+			// 等待提交协程退出，已完成的结果仍然保留，其余图像的结果为 ctx.Err()
+			if pending != nil {
+				for s := range pending {
+					receive(s)
+				}
+			}
+			for drained := false; !drained; {
+				select {
+				case result := <-callback:
+					if live[result.TaskID] {
+						delete(live, result.TaskID)
+						arrived[result.TaskID] = result
+					}
+				default:
+					drained = true
+				}
+			}
+			for _, s := range queue {
+				if _, ok := arrived[s.taskID]; s.err == nil && !ok {
+					arrived[s.taskID] = s.failed(ctx.Err())
+				}
+			}
+			flush()
+			return count
+		}
+		flush()
+	}
+	return count
+}
+
+// failed 返回该任务的失败结果，带上任务的元数据
+func (s streamSubmission) failed(err error) DetectionResult {
+	result := failedResult(s.path, err)
+	result.Metadata = mergeTaskMetadata(result.Metadata, s.metadata)
+	return result
+}
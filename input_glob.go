@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isGlobPattern 判断输入是否为通配符模式（含 * ? [）
+// 调用方只在同名文件不存在时按模式展开，文件名中本身带这些字符的输入不受影响
+func isGlobPattern(input string) bool {
+	return strings.ContainsAny(input, "*?[")
+}
+
+// expandImageGlob 展开 -img 的通配符模式，返回按路径排序的图像文件
+// 支持 filepath.Glob 的语法，另外 ** 匹配任意层（含零层）子目录，如 ./frames/**/cam1_*.jpg；
+// 匹配到的视频文件一并返回，其他扩展名和目录忽略。没有匹配或匹配中没有图像和视频时返回错误
+func expandImageGlob(pattern string) ([]string, error) {
+	var matches []string
+	var err error
+	if strings.Contains(pattern, "**") {
+		matches, err = globRecursive(pattern)
+	} else {
+		matches, err = filepath.Glob(pattern)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("通配符模式 %s 无效: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("没有文件匹配通配符模式: %s", pattern)
+	}
+	sort.Strings(matches)
+
+	var imagePaths []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err != nil || info.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(match))
+		if supportedImageExts[ext] || supportedVideoExts[ext] {
+			imagePaths = append(imagePaths, match)
+		}
+	}
+	if len(imagePaths) == 0 {
+		return nil, fmt.Errorf("通配符模式 %s 匹配了 %d 个文件，其中没有支持的图像或视频（仅支持%v和%v）", pattern, len(matches), getKeys(supportedImageExts), getKeys(supportedVideoExts))
+	}
+	return imagePaths, nil
+}
+
+// globRecursive 展开含 ** 的模式：从第一个含通配符的目录层开始遍历，逐层匹配相对路径
+func globRecursive(pattern string) ([]string, error) {
+	root, rest := splitGlobRoot(pattern)
+	for _, segment := range rest {
+		if segment != "**" {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // 起点不存在时视为没有匹配，无法读取的子目录跳过
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if matchSegments(rest, strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// splitGlobRoot 拆分通配符模式：不含通配符的前缀目录（遍历起点）和其余各层的模式
+func splitGlobRoot(pattern string) (root string, rest []string) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	fixed := 0
+	for fixed < len(segments)-1 && !isGlobPattern(segments[fixed]) {
+		fixed++
+	}
+	root = filepath.FromSlash(strings.Join(segments[:fixed], "/"))
+	switch {
+	case fixed == 0:
+		root = "."
+	case root == "":
+		root = string(filepath.Separator) // 以 / 开头的绝对路径
+	case strings.HasSuffix(root, ":"):
+		root += string(filepath.Separator) // Windows 盘符根目录，如 C:/**/*.jpg
+	}
+	return root, segments[fixed:]
+}
+
+// matchSegments 按路径层逐层匹配，** 匹配零层或任意多层
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
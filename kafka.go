@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Kafka 输出参数
+var (
+	kafkaBrokers      = &config.KafkaBrokers
+	kafkaTopic        = &config.KafkaTopic
+	kafkaFormat       = &config.KafkaFormat
+	kafkaKey          = &config.KafkaKey
+	kafkaPositiveOnly = &config.KafkaPositiveOnly
+	kafkaBatchSize    = &config.KafkaBatchSize
+	kafkaLinger       = &config.KafkaLinger
+)
+
+const kafkaQueueSize = 4096 // 等待发送的消息数上限，超出的消息丢弃
+
+// kafkaAvroSchema -kafka-format avro 时消息值的 Avro schema；消息值是单条记录的 Avro 二进制编码，不含 schema 和 schema registry 前缀
+const kafkaAvroSchema = `{
+  "type": "record", "name": "DetectionResult", "namespace": "yolo_go_detector",
+  "fields": [
+    {"name": "schema_version", "type": "int"},
+    {"name": "image_path", "type": "string"},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "task_id", "type": "long"},
+    {"name": "width", "type": "int"},
+    {"name": "height", "type": "int"},
+    {"name": "error", "type": ["null", "string"], "default": null},
+    {"name": "detections", "type": {"type": "array", "items": {
+      "type": "record", "name": "Detection",
+      "fields": [
+        {"name": "label", "type": "string"},
+        {"name": "confidence", "type": "float"},
+        {"name": "box", "type": {"type": "array", "items": "float"}}
+      ]}}}
+  ]
+}`
+
+// kafkaMessage 一条待发送的消息
+type kafkaMessage struct {
+	Key   []byte
+	Value []byte
+	Time  time.Time
+}
+
+// kafkaProducer 把一批消息写入主题，返回写入失败的消息数；kafkaSink 只在发送协程中调用，不需要并发安全
+// 测试时可以替换为不连接网络的实现
+type kafkaProducer interface {
+	Produce(topic string, messages []kafkaMessage) (failed int, err error)
+	Close() error
+}
+
+// kafkaSink 把结果写入 Kafka 主题
+// Write 只把消息放入队列，发送协程凑满 -kafka-batch-size 条或等待 -kafka-linger 后批量发送，检测不会因 Kafka 不可用而阻塞；
+// 发送失败的消息记入 yolo_kafka_messages_total{status="failed"} 并写日志，不重试
+type kafkaSink struct {
+	mutex        sync.Mutex
+	name         string
+	topic        string
+	encode       func(ResultRecord) ([]byte, error)
+	key          func(ResultRecord) []byte
+	positiveOnly bool
+	batchSize    int
+	linger       time.Duration
+	producer     kafkaProducer
+	queue        chan kafkaMessage
+	done         chan struct{}
+	closed       bool
+	dropped      atomic.Int64 // 队列已满丢弃的消息数
+	failed       atomic.Int64 // 发送失败的消息数
+}
+
+// newKafkaSink 按 -kafka-* 参数创建输出；参数无效时返回错误，连接在第一次发送时建立
+func newKafkaSink() (*kafkaSink, error) {
+	var brokers []string
+	for _, broker := range strings.Split(*kafkaBrokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("-kafka-brokers 没有有效的代理地址")
+	}
+	producer := newKafkaClient(brokers, kafkaClientID())
+	return newKafkaSinkWithProducer(producer)
+}
+
+// newKafkaSinkWithProducer 使用指定的 producer 创建输出，其余参数来自 -kafka-*
+func newKafkaSinkWithProducer(producer kafkaProducer) (*kafkaSink, error) {
+	if *kafkaTopic == "" {
+		return nil, fmt.Errorf("-kafka-topic 不能为空")
+	}
+	if *kafkaBatchSize <= 0 {
+		return nil, fmt.Errorf("-kafka-batch-size 必须大于 0")
+	}
+	s := &kafkaSink{
+		name:         "kafka:" + *kafkaTopic,
+		topic:        *kafkaTopic,
+		positiveOnly: *kafkaPositiveOnly,
+		batchSize:    *kafkaBatchSize,
+		linger:       *kafkaLinger,
+		producer:     producer,
+		queue:        make(chan kafkaMessage, kafkaQueueSize),
+		done:         make(chan struct{}),
+	}
+	switch *kafkaFormat {
+	case "json":
+		s.encode = func(record ResultRecord) ([]byte, error) { return json.Marshal(record) }
+	case "avro":
+		s.encode = encodeAvroRecord
+	default:
+		return nil, fmt.Errorf("不支持的 Kafka 消息格式 %q（支持 json、avro）", *kafkaFormat)
+	}
+	switch *kafkaKey {
+	case "path":
+		s.key = func(record ResultRecord) []byte { return []byte(record.ImagePath) }
+	case "camera":
+		s.key = func(record ResultRecord) []byte { return []byte(cameraID(record.ImagePath)) }
+	default:
+		return nil, fmt.Errorf("不支持的 Kafka 消息键 %q（支持 path、camera）", *kafkaKey)
+	}
+	go s.loop()
+	return s, nil
+}
+
+// cameraID 图像所在目录名，如 cam1/0001.jpg 为 cam1；没有目录时为空（消息轮流写入各分区）
+func cameraID(path string) string {
+	dir := filepath.Base(filepath.Dir(path))
+	if dir == "." || dir == string(filepath.Separator) {
+		return ""
+	}
+	return dir
+}
+
+func (s *kafkaSink) Name() string { return s.name }
+
+func (s *kafkaSink) Write(record ResultRecord) error {
+	if s.positiveOnly && (record.Error != "" || len(record.Detections) == 0) {
+		return nil
+	}
+	value, err := s.encode(record)
+	if err != nil {
+		return err
+	}
+	message := kafkaMessage{Key: s.key(record), Value: value, Time: record.Timestamp}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	select {
+	case s.queue <- message:
+	default:
+		atomic.AddInt64(&metrics.kafkaDropped, 1)
+		if s.dropped.Add(1) == 1 {
+			writeLogFile("WARN", fmt.Sprintf("%s 发送队列已满，开始丢弃消息", s.name))
+		}
+	}
+	return nil
+}
+
+// loop 发送协程：凑满一批或等待 linger 后发送，队列关闭时发送剩余消息后退出
+func (s *kafkaSink) loop() {
+	defer close(s.done)
+	batch := make([]kafkaMessage, 0, s.batchSize)
+	timer := time.NewTimer(s.linger)
+	timer.Stop()
+	for {
+		select {
+		case message, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			if batch = append(batch, message); len(batch) == 1 {
+				timer.Reset(s.linger)
+			}
+			if len(batch) < s.batchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+		s.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send 发送一批消息，失败的消息计数并写日志
+func (s *kafkaSink) send(batch []kafkaMessage) {
+	if len(batch) == 0 {
+		return
+	}
+	failed, err := s.producer.Produce(s.topic, batch)
+	failed = max(0, min(failed, len(batch)))
+	atomic.AddInt64(&metrics.kafkaDelivered, int64(len(batch)-failed))
+	if failed > 0 {
+		atomic.AddInt64(&metrics.kafkaFailed, int64(failed))
+		s.failed.Add(int64(failed))
+		writeLogFile("WARN", fmt.Sprintf("%s %d/%d 条消息发送失败: %v", s.name, failed, len(batch), err))
+	}
+}
+
+// Flush 发送协程按批次发送，不等待未满的批次
+func (s *kafkaSink) Flush() error { return nil }
+
+// Close 发送队列中剩余的消息后关闭连接
+func (s *kafkaSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mutex.Unlock()
+	<-s.done
+	s.producer.Close()
+
+	if dropped, failed := s.dropped.Load(), s.failed.Load(); dropped+failed > 0 {
+		return fmt.Errorf("%d 条消息因队列已满被丢弃，%d 条消息发送失败（详见日志）", dropped, failed)
+	}
+	return nil
+}
+
+// encodeAvroRecord 按 kafkaAvroSchema 编码一条记录
+func encodeAvroRecord(record ResultRecord) ([]byte, error) {
+	buf := make([]byte, 0, 128+len(record.Detections)*48)
+	buf = binary.AppendVarint(buf, int64(record.SchemaVersion))
+	buf = appendAvroString(buf, record.ImagePath)
+	buf = binary.AppendVarint(buf, record.Timestamp.UnixMilli())
+	buf = binary.AppendVarint(buf, int64(record.TaskID))
+	buf = binary.AppendVarint(buf, int64(record.Width))
+	buf = binary.AppendVarint(buf, int64(record.Height))
+	if record.Error == "" {
+		buf = binary.AppendVarint(buf, 0) // union 分支 null
+	} else {
+		buf = binary.AppendVarint(buf, 1)
+		buf = appendAvroString(buf, record.Error)
+	}
+	if n := len(record.Detections); n > 0 {
+		buf = binary.AppendVarint(buf, int64(n))
+		for _, d := range record.Detections {
+			buf = appendAvroString(buf, d.Label)
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(d.Confidence))
+			buf = binary.AppendVarint(buf, int64(len(d.Box)))
+			for _, v := range d.Box {
+				buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+			}
+			buf = binary.AppendVarint(buf, 0)
+		}
+	}
+	buf = binary.AppendVarint(buf, 0) // 数组结束
+	return buf, nil
+}
+
+// appendAvroString Avro 字符串：zigzag 长度加 UTF-8 字节
+func appendAvroString(buf []byte, s string) []byte {
+	buf = binary.AppendVarint(buf, int64(len(s)))
+	return append(buf, s...)
+}
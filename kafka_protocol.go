@@ -0,0 +1,485 @@
+package main
+
+// 最小的 Kafka 生产者客户端：Metadata v1 查询分区领导者，Produce v3 按领导者批量写入 RecordBatch v2（不压缩、acks=1）
+// 只实现了 kafkaSink 需要的部分，不支持 SASL/TLS、事务和幂等生产
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	kafkaAPIProduce     = 0
+	kafkaAPIMetadata    = 3
+	kafkaIOTimeout      = 10 * time.Second
+	kafkaMetadataMaxAge = 5 * time.Minute // 元数据超过该时间后重新查询，发现新增分区
+	kafkaMaxResponse    = 64 << 20
+)
+
+// ErrKafkaResponse Kafka 响应无法解析
+var ErrKafkaResponse = errors.New("无效的 Kafka 响应")
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaClientID 请求头中的客户端ID
+func kafkaClientID() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("yolo-go-detector-%s-%d", hostname, os.Getpid())
+}
+
+// kafkaClient 实现 kafkaProducer；连接按需建立，出错时关闭并在下一批重新建立
+type kafkaClient struct {
+	seeds       []string
+	clientID    string
+	correlation int32
+	conns       map[string]*kafkaConn // 代理地址 -> 连接
+
+	// 主题元数据
+	topic      string
+	fetched    time.Time
+	brokers    map[int32]string // 节点ID -> host:port
+	leaders    []int32          // 分区 -> 领导者节点ID，-1 表示暂无领导者
+	roundRobin int
+}
+
+func newKafkaClient(seeds []string, clientID string) *kafkaClient {
+	return &kafkaClient{seeds: seeds, clientID: clientID, conns: make(map[string]*kafkaConn)}
+}
+
+// Produce 按消息键的 murmur2 哈希选择分区（与 Java 客户端的默认分区器相同，空键轮流写入），
+// 每个领导者发送一个请求；写入失败的分区（领导者变更、连接断开等）刷新元数据后重试一次
+func (c *kafkaClient) Produce(topic string, messages []kafkaMessage) (int, error) {
+	if err := c.ensureMetadata(topic); err != nil {
+		return len(messages), err
+	}
+	partitions := make(map[int32][]kafkaMessage)
+	for _, m := range messages {
+		p := c.partition(m.Key)
+		partitions[p] = append(partitions[p], m)
+	}
+
+	pending, err := c.producePartitions(topic, partitions)
+	if len(pending) > 0 {
+		c.fetched = time.Time{}
+		if metaErr := c.ensureMetadata(topic); metaErr != nil {
+			err = metaErr
+		} else {
+			pending, err = c.producePartitions(topic, pending)
+		}
+	}
+	failed := 0
+	for _, batch := range pending {
+		failed += len(batch)
+	}
+	return failed, err
+}
+
+// producePartitions 按领导者分组发送，返回未能写入的分区及最后一个错误
+func (c *kafkaClient) producePartitions(topic string, partitions map[int32][]kafkaMessage) (map[int32][]kafkaMessage, error) {
+	byLeader := make(map[string]map[int32][]kafkaMessage)
+	failed := make(map[int32][]kafkaMessage)
+	var lastErr error
+	for p, batch := range partitions {
+		addr, ok := c.leader(p)
+		if !ok {
+			failed[p] = batch
+			lastErr = fmt.Errorf("主题 %s 分区 %d 暂无领导者", topic, p)
+			continue
+		}
+		if byLeader[addr] == nil {
+			byLeader[addr] = make(map[int32][]kafkaMessage)
+		}
+		byLeader[addr][p] = batch
+	}
+	for addr, group := range byLeader {
+		errs, err := c.produceTo(addr, topic, group)
+		if err != nil {
+			c.closeConn(addr)
+			for p, batch := range group {
+				failed[p] = batch
+			}
+			lastErr = fmt.Errorf("写入代理 %s 失败: %w", addr, err)
+			continue
+		}
+		for p, code := range errs {
+			failed[p] = group[p]
+			lastErr = fmt.Errorf("主题 %s 分区 %d 写入失败，错误码 %d", topic, p, code)
+		}
+	}
+	return failed, lastErr
+}
+
+// produceTo 向一个代理发送 Produce v3 请求，返回出错的分区及其错误码
+func (c *kafkaClient) produceTo(addr, topic string, partitions map[int32][]kafkaMessage) (map[int32]int16, error) {
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, 0xffff) // transactional_id: null
+	body = binary.BigEndian.AppendUint16(body, 1)      // acks
+	body = binary.BigEndian.AppendUint32(body, uint32(kafkaIOTimeout/time.Millisecond))
+	body = binary.BigEndian.AppendUint32(body, 1)
+	body = appendKafkaString(body, topic)
+	body = binary.BigEndian.AppendUint32(body, uint32(len(partitions)))
+	for p, batch := range partitions {
+		records := encodeRecordBatch(batch)
+		body = binary.BigEndian.AppendUint32(body, uint32(p))
+		body = binary.BigEndian.AppendUint32(body, uint32(len(records)))
+		body = append(body, records...)
+	}
+	resp, err := c.roundTrip(addr, kafkaAPIProduce, 3, body)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make(map[int32]int16)
+	acked := make(map[int32]bool, len(partitions))
+	r := &kafkaReader{buf: resp}
+	for range r.arrayLen() {
+		r.string()
+		for range r.arrayLen() {
+			p, code := r.int32(), r.int16()
+			r.int64() // base_offset
+			r.int64() // log_append_time
+			if code != 0 {
+				errs[p] = code
+			}
+			acked[p] = true
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for p := range partitions {
+		if !acked[p] {
+			errs[p] = -1 // 响应中没有该分区
+		}
+	}
+	return errs, nil
+}
+
+// ensureMetadata 元数据不存在或已过期时依次向各代理查询 topic 的分区领导者
+func (c *kafkaClient) ensureMetadata(topic string) error {
+	if c.topic == topic && time.Since(c.fetched) < kafkaMetadataMaxAge {
+		return nil
+	}
+	var lastErr error
+	for _, addr := range c.seeds {
+		if lastErr = c.fetchMetadata(addr, topic); lastErr == nil {
+			return nil
+		}
+		c.closeConn(addr)
+	}
+	return fmt.Errorf("查询主题 %s 元数据失败: %w", topic, lastErr)
+}
+
+// fetchMetadata 发送 Metadata v1 请求
+func (c *kafkaClient) fetchMetadata(addr, topic string) error {
+	var body []byte
+	body = binary.BigEndian.AppendUint32(body, 1)
+	body = appendKafkaString(body, topic)
+	resp, err := c.roundTrip(addr, kafkaAPIMetadata, 1, body)
+	if err != nil {
+		return err
+	}
+
+	r := &kafkaReader{buf: resp}
+	brokers := make(map[int32]string)
+	for range r.arrayLen() {
+		id, host, port := r.int32(), r.string(), r.int32()
+		r.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.int32() // controller_id
+	var leaders []int32
+	var topicErr int16
+	for range r.arrayLen() {
+		code, name := r.int16(), r.string()
+		r.int8() // is_internal
+		for range r.arrayLen() {
+			r.int16()
+			p, leader := r.int32(), r.int32()
+			r.skipInt32Array() // replica_nodes
+			r.skipInt32Array() // isr_nodes
+			if name != topic || p < 0 || p > 1<<16 {
+				continue
+			}
+			for int(p) >= len(leaders) {
+				leaders = append(leaders, -1)
+			}
+			leaders[p] = leader
+		}
+		if name == topic {
+			topicErr = code
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if topicErr != 0 {
+		return fmt.Errorf("主题 %s 错误码 %d", topic, topicErr)
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("主题 %s 没有分区", topic)
+	}
+	c.topic, c.fetched, c.brokers, c.leaders = topic, time.Now(), brokers, leaders
+	return nil
+}
+
+// partition 消息键的 murmur2 哈希对分区数取模，空键轮流选择分区
+func (c *kafkaClient) partition(key []byte) int32 {
+	n := len(c.leaders)
+	if len(key) == 0 {
+		c.roundRobin = (c.roundRobin + 1) % n
+		return int32(c.roundRobin)
+	}
+	return int32(int(murmur2(key)&0x7fffffff) % n)
+}
+
+func (c *kafkaClient) leader(p int32) (string, bool) {
+	if int(p) >= len(c.leaders) {
+		return "", false
+	}
+	addr, ok := c.brokers[c.leaders[p]]
+	return addr, ok
+}
+
+// roundTrip 发送一个请求并读取响应（不含响应头）
+func (c *kafkaClient) roundTrip(addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	conn, err := c.conn(addr)
+	if err != nil {
+		return nil, err
+	}
+	c.correlation++
+	correlation := c.correlation
+
+	req := make([]byte, 4, 14+len(c.clientID)+len(body))
+	req = binary.BigEndian.AppendUint16(req, uint16(apiKey))
+	req = binary.BigEndian.AppendUint16(req, uint16(apiVersion))
+	req = binary.BigEndian.AppendUint32(req, uint32(correlation))
+	req = appendKafkaString(req, c.clientID)
+	req = append(req, body...)
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	conn.SetDeadline(time.Now().Add(kafkaIOTimeout))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(conn.r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	if size < 4 || size > kafkaMaxResponse {
+		return nil, fmt.Errorf("%w: 长度 %d", ErrKafkaResponse, size)
+	}
+	if got := int32(binary.BigEndian.Uint32(header[4:])); got != correlation {
+		return nil, fmt.Errorf("%w: correlation_id %d，期望 %d", ErrKafkaResponse, got, correlation)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(conn.r, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// kafkaConn 到一个代理的连接
+type kafkaConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *kafkaClient) conn(addr string) (*kafkaConn, error) {
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	nc, err := net.DialTimeout("tcp", addr, kafkaIOTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &kafkaConn{Conn: nc, r: bufio.NewReader(nc)}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+func (c *kafkaClient) closeConn(addr string) {
+	if conn, ok := c.conns[addr]; ok {
+		conn.Close()
+		delete(c.conns, addr)
+	}
+}
+
+func (c *kafkaClient) Close() error {
+	for addr := range c.conns {
+		c.closeConn(addr)
+	}
+	return nil
+}
+
+// encodeRecordBatch 编码 RecordBatch v2（magic 2，不压缩，非幂等）
+func encodeRecordBatch(messages []kafkaMessage) []byte {
+	now := time.Now()
+	timestamp := func(m kafkaMessage) int64 {
+		if m.Time.IsZero() {
+			return now.UnixMilli()
+		}
+		return m.Time.UnixMilli()
+	}
+	base := timestamp(messages[0])
+	maxTimestamp := base
+
+	var records, record []byte
+	for i, m := range messages {
+		ts := timestamp(m)
+		if ts > maxTimestamp {
+			maxTimestamp = ts
+		}
+		record = append(record[:0], 0) // attributes
+		record = binary.AppendVarint(record, ts-base)
+		record = binary.AppendVarint(record, int64(i))
+		if m.Key == nil {
+			record = binary.AppendVarint(record, -1)
+		} else {
+			record = binary.AppendVarint(record, int64(len(m.Key)))
+			record = append(record, m.Key...)
+		}
+		record = binary.AppendVarint(record, int64(len(m.Value)))
+		record = append(record, m.Value...)
+		record = binary.AppendVarint(record, 0) // headers
+		records = binary.AppendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	batch := make([]byte, 0, 61+len(records))
+	batch = binary.BigEndian.AppendUint64(batch, 0) // base_offset
+	batch = binary.BigEndian.AppendUint32(batch, 0) // batch_length，稍后填写
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff)
+	batch = append(batch, 2)                        // magic
+	batch = binary.BigEndian.AppendUint32(batch, 0) // crc，稍后填写
+	crcStart := len(batch)
+	batch = binary.BigEndian.AppendUint16(batch, 0) // attributes
+	batch = binary.BigEndian.AppendUint32(batch, uint32(len(messages)-1))
+	batch = binary.BigEndian.AppendUint64(batch, uint64(base))
+	batch = binary.BigEndian.AppendUint64(batch, uint64(maxTimestamp))
+	batch = binary.BigEndian.AppendUint64(batch, 0xffffffffffffffff) // producer_id
+	batch = binary.BigEndian.AppendUint16(batch, 0xffff)             // producer_epoch
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff)         // base_sequence
+	batch = binary.BigEndian.AppendUint32(batch, uint32(len(messages)))
+	batch = append(batch, records...)
+	binary.BigEndian.PutUint32(batch[8:], uint32(len(batch)-12))
+	binary.BigEndian.PutUint32(batch[crcStart-4:], crc32.Checksum(batch[crcStart:], crc32c))
+	return batch
+}
+
+// murmur2 Kafka 默认分区器使用的哈希
+func murmur2(data []byte) int32 {
+	const seed, m, r = 0x9747b28c, 0x5bd1e995, 24
+	n := len(data)
+	h := uint32(seed) ^ uint32(n)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+func appendKafkaString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// kafkaReader 按顺序解析响应字段，越界时记录错误并返回零值
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.buf) {
+		if r.err == nil {
+			r.err = fmt.Errorf("%w: 数据不完整", ErrKafkaResponse)
+		}
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *kafkaReader) int8() int8 {
+	if b := r.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string 读取 STRING/NULLABLE_STRING，null 返回空字符串
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+// arrayLen 读取数组长度，null 或出错时为 0
+func (r *kafkaReader) arrayLen() int {
+	n := r.int32()
+	if r.err != nil || n < 0 {
+		return 0
+	}
+	if int(n) > len(r.buf) {
+		r.err = fmt.Errorf("%w: 数组长度 %d", ErrKafkaResponse, n)
+		return 0
+	}
+	return int(n)
+}
+
+func (r *kafkaReader) skipInt32Array() {
+	r.take(4 * r.arrayLen())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeProducer 记录写入的消息，不连接 Kafka；前 fail 条消息发送失败
+type fakeProducer struct {
+	messages []kafkaMessage
+	fail     int
+	closed   bool
+}
+
+func (p *fakeProducer) Produce(topic string, messages []kafkaMessage) (int, error) {
+	failed := min(p.fail, len(messages))
+	p.fail -= failed
+	p.messages = append(p.messages, messages[failed:]...)
+	if failed > 0 {
+		return failed, errors.New("broker 不可用")
+	}
+	return 0, nil
+}
+
+func (p *fakeProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestKafkaSinkProducesRecords(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.KafkaTopic = "detections"
+	config.KafkaBatchSize = 2
+	config.KafkaLinger = time.Hour
+
+	person := []DetectionObject{{Label: "person", Confidence: 0.9, Box: [4]float32{1, 2, 3, 4}}}
+	records := []ResultRecord{
+		{SchemaVersion: ResultSchemaVersion, ImagePath: "cam1/0001.jpg", Detections: person},
+		{SchemaVersion: ResultSchemaVersion, ImagePath: "cam1/0002.jpg", Detections: []DetectionObject{}},
+		{SchemaVersion: ResultSchemaVersion, ImagePath: "cam2/0001.jpg", Error: "加载图像失败"},
+	}
+
+	tests := []struct {
+		name         string
+		key          string
+		positiveOnly bool
+		fail         int
+		keys         []string
+		closeErr     bool
+	}{
+		{"按路径", "path", false, 0, []string{"cam1/0001.jpg", "cam1/0002.jpg", "cam2/0001.jpg"}, false},
+		{"按摄像头", "camera", false, 0, []string{"cam1", "cam1", "cam2"}, false},
+		{"只发送有检测结果的记录", "path", true, 0, []string{"cam1/0001.jpg"}, false},
+		{"发送失败只计数", "path", false, 1, []string{"cam1/0002.jpg", "cam2/0001.jpg"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.KafkaKey = tt.key
+			config.KafkaPositiveOnly = tt.positiveOnly
+			producer := &fakeProducer{fail: tt.fail}
+			sink, err := newKafkaSinkWithProducer(producer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range records {
+				if err := sink.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 未满一批的消息在 Close 时发送
+			if err := sink.Close(); (err != nil) != tt.closeErr {
+				t.Errorf("Close() = %v, 期望出错: %v", err, tt.closeErr)
+			}
+			if !producer.closed {
+				t.Error("Close 后 producer 未关闭")
+			}
+			if len(producer.messages) != len(tt.keys) {
+				t.Fatalf("发送了 %d 条消息，期望 %d 条", len(producer.messages), len(tt.keys))
+			}
+			for i, message := range producer.messages {
+				if string(message.Key) != tt.keys[i] {
+					t.Errorf("第 %d 条消息的键 = %q，期望 %q", i, message.Key, tt.keys[i])
+				}
+				var decoded ResultRecord
+				if err := json.Unmarshal(message.Value, &decoded); err != nil || decoded.SchemaVersion != ResultSchemaVersion {
+					t.Errorf("第 %d 条消息不是当前版本的检测记录: %s (%v)", i, message.Value, err)
+				}
+			}
+			if err := sink.Write(records[0]); err == nil {
+				t.Error("Close 后 Write 应返回错误")
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 当前模型的类别名称：模型元数据中带有 names 时使用模型自己的类别，否则为 COCO 类别
+// 类别过滤、告警规则校验和导出的 ClassID/Label 都基于这份名称
+var (
+	classNamesMutex   sync.RWMutex
+	classNames        = yoloClasses
+	classNamesVersion int // 每次 SetClassNames 加一，依赖类别名称的缓存据此失效
+)
+
+// COCOClasses 返回 COCO 数据集的 80 个类别（YOLO 官方检测模型的类别顺序），返回副本
+func COCOClasses() []string {
+	return append([]string(nil), yoloClasses...)
+}
+
+// ChineseLabels 返回英文标签到中文标签的映射，返回副本
+func ChineseLabels() map[string]string {
+	labels := make(map[string]string, len(detectLabelMap))
+	for en, zh := range detectLabelMap {
+		labels[en] = zh
+	}
+	return labels
+}
+
+// ClassNames 返回当前模型的类别名称（按类别ID排列），返回副本
+func ClassNames() []string {
+	classNamesMutex.RLock()
+	defer classNamesMutex.RUnlock()
+	return append([]string(nil), classNames...)
+}
+
+// SetClassNames 设置当前模型的类别名称，names 为空时恢复为 COCO 类别
+// 会话创建时会用模型元数据中的类别名称自动调用，以库方式使用自定义类别时也可以直接设置
+func SetClassNames(names []string) {
+	classNamesMutex.Lock()
+	defer classNamesMutex.Unlock()
+	if len(names) == 0 {
+		classNames = yoloClasses
+	} else {
+		classNames = append([]string(nil), names...)
+	}
+	classNamesVersion++
+}
+
+// currentClassNamesVersion 返回类别名称的版本号
+func currentClassNamesVersion() int {
+	classNamesMutex.RLock()
+	defer classNamesMutex.RUnlock()
+	return classNamesVersion
+}
+
+// ClassID 返回类别名称对应的类别ID，name 可以是英文标签（不区分大小写）或中文标签
+func ClassID(name string) (int, bool) {
+	classNamesMutex.RLock()
+	defer classNamesMutex.RUnlock()
+	for id, label := range classNames {
+		if strings.EqualFold(label, name) {
+			return id, true
+		}
+	}
+	for id, label := range classNames {
+		if zh, ok := detectLabelMap[label]; ok && zh == name {
+			return id, true
+		}
+	}
+	return -1, false
+}
+
+// Label 返回类别ID对应的英文标签，超出当前类别范围时返回 class_N
+func Label(id int) string {
+	classNamesMutex.RLock()
+	defer classNamesMutex.RUnlock()
+	if id >= 0 && id < len(classNames) {
+		return classNames[id]
+	}
+	return "class_" + strconv.Itoa(id)
+}
+
+// ChineseLabel 返回英文标签对应的中文标签，没有中文名称（如自定义类别）时原样返回
+func ChineseLabel(label string) string {
+	if chinese, exists := detectLabelMap[label]; exists {
+		return chinese
+	}
+	return label
+}
+
+// loadActiveClassNames 启动时读取主模型的类别名称，使命令行参数校验（-classes、告警规则）能识别自定义类别
+// 读取失败时保持 COCO 类别，具体错误在创建会话时报告
+func loadActiveClassNames() {
+	paths := modelPaths()
+	if len(paths) == 0 || initializeORTEnvironment() != nil {
+		return
+	}
+	if layout, err := resolveOutputLayout(paths[0], *modelFormat, *taskType, *modelInputSize); err == nil {
+		SetClassNames(layout.ClassNames)
+	}
+}
+
+// YOLO类别标签（英文原始标签）[1,2](@ref)
+// YOLOv8模型支持的80个类别
+var yoloClasses = []string{
+	"person", "bicycle", "car", "motorcycle", "airplane", "bus", "train", "truck", "boat",
+	"traffic light", "fire hydrant", "stop sign", "parking meter", "bench", "bird", "cat", "dog", "horse",
+	"sheep", "cow", "elephant", "bear", "zebra", "giraffe", "backpack", "umbrella", "handbag", "tie",
+	"suitcase", "frisbee", "skis", "snowboard", "sports ball", "kite", "baseball bat", "baseball glove",
+	"skateboard", "surfboard", "tennis racket", "bottle", "wine glass", "cup", "fork", "knife", "spoon",
+	"bowl", "banana", "apple", "sandwich", "orange", "broccoli", "carrot", "hot dog", "pizza", "donut",
+	"cake", "chair", "couch", "potted plant", "bed", "dining table", "toilet", "tv", "laptop", "mouse",
+	"remote", "keyboard", "cell phone", "microwave", "oven", "toaster", "sink", "refrigerator", "book",
+	"clock", "vase", "scissors", "teddy bear", "hair drier", "toothbrush",
+}
+
+// 中英标签映射
+// 将YOLO英文标签映射为中文标签
+var detectLabelMap = map[string]string{
+	"person":         "人员",
+	"bicycle":        "自行车",
+	"car":            "汽车",
+	"motorcycle":     "摩托车",
+	"airplane":       "飞机",
+	"bus":            "巴士",
+	"train":          "火车",
+	"truck":          "卡车",
+	"boat":           "船",
+	"traffic light":  "红绿灯",
+	"fire hydrant":   "消防栓",
+	"stop sign":      "停车标志",
+	"parking meter":  "停车计时器",
+	"bench":          "长凳",
+	"bird":           "鸟",
+	"cat":            "猫",
+	"dog":            "狗",
+	"horse":          "马",
+	"sheep":          "羊",
+	"cow":            "牛",
+	"elephant":       "大象",
+	"bear":           "熊",
+	"zebra":          "斑马",
+	"giraffe":        "长颈鹿",
+	"backpack":       "背包",
+	"umbrella":       "雨伞",
+	"handbag":        "手提包",
+	"tie":            "领带",
+	"suitcase":       "行李箱",
+	"frisbee":        "飞盘",
+	"skis":           "滑雪板",
+	"snowboard":      "雪板",
+	"sports ball":    "运动球",
+	"kite":           "风筝",
+	"baseball bat":   "棒球棍",
+	"baseball glove": "棒球手套",
+	"skateboard":     "滑板",
+	"surfboard":      "冲浪板",
+	"tennis racket":  "网球拍",
+	"bottle":         "瓶子",
+	"wine glass":     "酒杯",
+	"cup":            "杯子",
+	"fork":           "叉子",
+	"knife":          "刀",
+	"spoon":          "勺子",
+	"bowl":           "碗",
+	"banana":         "香蕉",
+	"apple":          "苹果",
+	"sandwich":       "三明治",
+	"orange":         "橙子",
+	"broccoli":       "西兰花",
+	"carrot":         "胡萝卜",
+	"hot dog":        "热狗",
+	"pizza":          "披萨",
+	"donut":          "甜甜圈",
+	"cake":           "蛋糕",
+	"chair":          "椅子",
+	"couch":          "沙发",
+	"potted plant":   "盆栽",
+	"bed":            "床",
+	"dining table":   "餐桌",
+	"toilet":         "厕所",
+	"tv":             "电视",
+	"laptop":         "笔记本电脑",
+	"mouse":          "鼠标",
+	"remote":         "遥控器",
+	"keyboard":       "键盘",
+	"cell phone":     "手机",
+	"microwave":      "微波炉",
+	"oven":           "烤箱",
+	"toaster":        "烤面包机",
+	"sink":           "水槽",
+	"refrigerator":   "冰箱",
+	"book":           "书",
+	"clock":          "钟",
+	"vase":           "花瓶",
+	"scissors":       "剪刀",
+	"teddy bear":     "泰迪熊",
+	"hair drier":     "吹风机",
+	"toothbrush":     "牙刷",
+}
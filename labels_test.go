@@ -0,0 +1,122 @@
+package main
+
+import "testing"
+
+func TestClassIDAndLabel(t *testing.T) {
+	defer SetClassNames(nil)
+
+	custom := []string{"helmet", "person", "Forklift"}
+	tests := []struct {
+		name    string
+		classes []string // nil 表示 COCO 类别
+		lookup  string
+		id      int
+		ok      bool
+		label   string // Label(id) 的结果
+	}{
+		{"COCO 英文标签", nil, "person", 0, true, "person"},
+		{"COCO 不区分大小写", nil, "Traffic Light", 9, true, "traffic light"},
+		{"COCO 中文标签", nil, "汽车", 2, true, "car"},
+		{"COCO 未知名称", nil, "helmet", -1, false, ""},
+		{"COCO 空名称", nil, "", -1, false, ""},
+		{"自定义类别", custom, "helmet", 0, true, "helmet"},
+		{"自定义类别中的 COCO 名称", custom, "person", 1, true, "person"},
+		{"自定义类别用中文标签查找", custom, "人员", 1, true, "person"},
+		{"自定义类别不区分大小写", custom, "forklift", 2, true, "Forklift"},
+		{"自定义类别中没有的 COCO 名称", custom, "car", -1, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClassNames(tt.classes)
+			id, ok := ClassID(tt.lookup)
+			if id != tt.id || ok != tt.ok {
+				t.Fatalf("ClassID(%q) = %d, %v，期望 %d, %v", tt.lookup, id, ok, tt.id, tt.ok)
+			}
+			if ok && Label(id) != tt.label {
+				t.Errorf("Label(%d) = %q，期望 %q", id, Label(id), tt.label)
+			}
+		})
+	}
+}
+
+func TestLabelOutOfRange(t *testing.T) {
+	defer SetClassNames(nil)
+	SetClassNames([]string{"helmet"})
+
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{0, "helmet"},
+		{1, "class_1"},
+		{79, "class_79"}, // 自定义类别生效后不再回退到 COCO 名称
+		{-1, "class_-1"},
+	}
+	for _, tt := range tests {
+		if got := Label(tt.id); got != tt.want {
+			t.Errorf("Label(%d) = %q，期望 %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestSetClassNames(t *testing.T) {
+	defer SetClassNames(nil)
+
+	version := currentClassNamesVersion()
+	names := []string{"a", "b"}
+	SetClassNames(names)
+	names[0] = "changed"
+	if got := ClassNames(); len(got) != 2 || got[0] != "a" {
+		t.Errorf("ClassNames() = %v，修改传入的切片不应影响已设置的类别", got)
+	}
+	if currentClassNamesVersion() == version {
+		t.Error("SetClassNames 后版本号未变化，依赖类别名称的缓存不会失效")
+	}
+
+	ClassNames()[0] = "changed"
+	if Label(0) != "a" {
+		t.Error("修改 ClassNames() 的返回值不应影响当前类别")
+	}
+
+	SetClassNames(nil)
+	if got := ClassNames(); len(got) != 80 || got[0] != "person" {
+		t.Errorf("names 为空时应恢复 COCO 类别，得到 %d 个类别", len(got))
+	}
+}
+
+func TestExportedLabelTablesAreCopies(t *testing.T) {
+	COCOClasses()[0] = "changed"
+	if COCOClasses()[0] != "person" {
+		t.Error("修改 COCOClasses() 的返回值不应影响内置类别")
+	}
+	ChineseLabels()["person"] = "changed"
+	if ChineseLabel("person") != "人员" {
+		t.Error("修改 ChineseLabels() 的返回值不应影响内置映射")
+	}
+	if got := ChineseLabel("helmet"); got != "helmet" {
+		t.Errorf("ChineseLabel(helmet) = %q，没有中文名称时应原样返回", got)
+	}
+}
+
+func TestResolveClassNameUsesCurrentNames(t *testing.T) {
+	defer SetClassNames(nil)
+	SetClassNames([]string{"helmet", "vest"})
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"1", "vest", false},
+		{"Helmet", "helmet", false},
+		{"class_5", "class_5", false},
+		{"person", "", true},
+		{"-1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveClassName(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("resolveClassName(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
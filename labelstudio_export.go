@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Label Studio 预标注导出参数
+var (
+	labelStudioOut    = &config.LabelStudioOut
+	labelStudioFrom   = &config.LabelStudioFrom
+	labelStudioTo     = &config.LabelStudioTo
+	labelStudioPrefix = &config.LabelStudioPrefix
+)
+
+// LabelStudioTask Label Studio 导入格式中的一个任务（一张图像）及其预测结果
+type LabelStudioTask struct {
+	Data        map[string]string       `json:"data"` // 键为 -labelstudio-to，值为图像地址
+	Predictions []LabelStudioPrediction `json:"predictions"`
+}
+
+// LabelStudioPrediction 一个模型对任务的预测
+type LabelStudioPrediction struct {
+	ModelVersion string              `json:"model_version"`
+	Score        float64             `json:"score"` // 各检测目标置信度的平均值，无检测目标时为 0
+	Result       []LabelStudioResult `json:"result"`
+}
+
+// LabelStudioResult 一个矩形框（rectanglelabels）
+type LabelStudioResult struct {
+	ID             string           `json:"id"`
+	FromName       string           `json:"from_name"`
+	ToName         string           `json:"to_name"`
+	Type           string           `json:"type"`
+	OriginalWidth  int              `json:"original_width"`
+	OriginalHeight int              `json:"original_height"`
+	ImageRotation  int              `json:"image_rotation"`
+	Value          LabelStudioValue `json:"value"`
+	Score          float64          `json:"score"`
+}
+
+// LabelStudioValue 矩形框的位置，x、y 为左上角，均为相对原图宽高的百分比（0-100）
+type LabelStudioValue struct {
+	X               float64  `json:"x"`
+	Y               float64  `json:"y"`
+	Width           float64  `json:"width"`
+	Height          float64  `json:"height"`
+	Rotation        float64  `json:"rotation"`
+	RectangleLabels []string `json:"rectanglelabels"`
+}
+
+// newLabelStudioTask 由导出记录生成任务，坐标按记录中的原图尺寸换算为百分比
+// 图像地址为 -labelstudio-prefix 加上图像名称（relativeImageName）
+func newLabelStudioTask(record ResultRecord, name, modelVersion string) LabelStudioTask {
+	percent := func(v float32, size int) float64 {
+		return math.Round(float64(v)/float64(size)*100*1e6) / 1e6
+	}
+	prediction := LabelStudioPrediction{ModelVersion: modelVersion, Result: make([]LabelStudioResult, 0, len(record.Detections))}
+	var sumScore float64
+	for i, d := range record.Detections {
+		score := roundTo(d.Confidence, 5)
+		sumScore += score
+		prediction.Result = append(prediction.Result, LabelStudioResult{
+			ID:             "r" + strconv.Itoa(i),
+			FromName:       *labelStudioFrom,
+			ToName:         *labelStudioTo,
+			Type:           "rectanglelabels",
+			OriginalWidth:  record.Width,
+			OriginalHeight: record.Height,
+			Value: LabelStudioValue{
+				X:               percent(d.Box[0], record.Width),
+				Y:               percent(d.Box[1], record.Height),
+				Width:           percent(d.Box[2]-d.Box[0], record.Width),
+				Height:          percent(d.Box[3]-d.Box[1], record.Height),
+				RectangleLabels: []string{d.Label},
+			},
+			Score: score,
+		})
+	}
+	if n := len(prediction.Result); n > 0 {
+		prediction.Score = roundTo(float32(sumScore/float64(n)), 5)
+	}
+	return LabelStudioTask{
+		Data:        map[string]string{*labelStudioTo: *labelStudioPrefix + name},
+		Predictions: []LabelStudioPrediction{prediction},
+	}
+}
+
+// labelStudioSink 汇总整次运行的检测结果，关闭时写出 Label Studio 可导入的任务列表（JSON 数组）
+// 与 cocoSink 一样挂在 resultSinks 上，各工作协程并发写入
+type labelStudioSink struct {
+	mutex  sync.Mutex
+	path   string
+	root   string                     // 图像名称相对的输入根目录（structureRoot）
+	tasks  map[string]LabelStudioTask // 图像名称到任务，失败的图像不导出
+	closed bool
+}
+
+func newLabelStudioSink(outputPath, input string) *labelStudioSink {
+	return &labelStudioSink{path: outputPath, root: structureRoot(input), tasks: make(map[string]LabelStudioTask)}
+}
+
+func (s *labelStudioSink) Name() string { return "labelstudio:" + s.path }
+
+func (s *labelStudioSink) Write(record ResultRecord) error {
+	if record.Error != "" {
+		return nil
+	}
+	if record.Width <= 0 || record.Height <= 0 {
+		return fmt.Errorf("图像 %s 缺少原图尺寸，无法换算百分比坐标", record.ImagePath)
+	}
+	name := relativeImageName(s.root, record.ImagePath)
+	task := newLabelStudioTask(record, name, getModelIdentifier(config.ModelPath))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	s.tasks[name] = task
+	return nil
+}
+
+// Flush 结果只在关闭时整体写出
+func (s *labelStudioSink) Flush() error { return nil }
+
+// Close 按图像名称排序后原子写入任务列表
+func (s *labelStudioSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	names := make([]string, 0, len(s.tasks))
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tasks := make([]LabelStudioTask, 0, len(names))
+	for _, name := range names {
+		tasks = append(tasks, s.tasks[name])
+	}
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 Label Studio 任务失败: %w", err)
+	}
+	return writeFileAtomic(s.path, func(f *os.File) error {
+		_, err := f.Write(append(data, '\n'))
+		return err
+	})
+}
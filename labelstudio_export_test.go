@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// validateSchema 按 JSON Schema 的 type、enum、required、properties、items、minimum、maximum 校验 v，
+// 返回第一处不符合的位置
+func validateSchema(schema map[string]any, v any, at string) error {
+	if want, ok := schema["type"].(string); ok {
+		var match bool
+		switch want {
+		case "object":
+			_, match = v.(map[string]any)
+		case "array":
+			_, match = v.([]any)
+		case "string":
+			_, match = v.(string)
+		case "number":
+			_, match = v.(float64)
+		case "integer":
+			n, isNumber := v.(float64)
+			match = isNumber && n == math.Trunc(n)
+		}
+		if !match {
+			return fmt.Errorf("%s: 类型应为 %s，得到 %v", at, want, v)
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		return fmt.Errorf("%s: %v 不在 %v 中", at, v, enum)
+	}
+	if n, ok := v.(float64); ok {
+		if minimum, ok := schema["minimum"].(float64); ok && n < minimum {
+			return fmt.Errorf("%s: %v 小于 %v", at, n, minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && n > maximum {
+			return fmt.Errorf("%s: %v 大于 %v", at, n, maximum)
+		}
+	}
+	if obj, ok := v.(map[string]any); ok {
+		for _, key := range schema["required"].([]any) {
+			if _, ok := obj[key.(string)]; !ok {
+				return fmt.Errorf("%s: 缺少 %s", at, key)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for key, sub := range properties {
+			if value, ok := obj[key]; ok {
+				if err := validateSchema(sub.(map[string]any), value, at+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if arr, ok := v.([]any); ok {
+		for i, item := range arr {
+			if err := validateSchema(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestLabelStudioSinkMatchesSchema(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.ModelPath = "third_party/yolo11x.onnx"
+	config.LabelStudioFrom, config.LabelStudioTo = "label", "image"
+	config.LabelStudioPrefix = "/data/local-files/?d=frames/"
+	data, err := os.ReadFile(filepath.Join("testdata", "labelstudio", "schema.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	input := t.TempDir()
+	out := filepath.Join(t.TempDir(), "tasks.json")
+	sink := newLabelStudioSink(out, input)
+	records := []ResultRecord{
+		{ImagePath: filepath.Join(input, "cam1", "0002.jpg"), Width: 1920, Height: 1080},
+		{ImagePath: filepath.Join(input, "broken.jpg"), Error: "解码失败"},
+		{ImagePath: filepath.Join(input, "cam1", "0001.jpg"), Width: 640, Height: 480, Detections: []DetectionObject{
+			{Label: "person", Confidence: 0.9, Box: [4]float32{64, 48, 320, 480}},
+			{Label: "car", Confidence: 0.5, Box: [4]float32{0, 0, 640, 120}},
+		}},
+	}
+	for _, record := range records {
+		if err := sink.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Write(ResultRecord{ImagePath: "no_size.jpg"}); err == nil {
+		t.Error("缺少原图尺寸的记录应返回错误")
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSchema(schema, doc, "tasks"); err != nil {
+		t.Errorf("输出不符合 Label Studio 导入格式: %v\n%s", err, data)
+	}
+
+	var tasks []LabelStudioTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].Data["image"] != "/data/local-files/?d=frames/cam1/0001.jpg" || tasks[1].Data["image"] != "/data/local-files/?d=frames/cam1/0002.jpg" {
+		t.Fatalf("任务 = %+v，期望按图像名称排序的两个任务", tasks)
+	}
+	if got := tasks[1].Predictions[0]; len(got.Result) != 0 || got.Score != 0 {
+		t.Errorf("无检测目标的任务预测 = %+v", got)
+	}
+}
+
+func TestNewLabelStudioTaskPercentages(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.LabelStudioFrom, config.LabelStudioTo, config.LabelStudioPrefix = "bbox", "photo", ""
+
+	tests := []struct {
+		name          string
+		width, height int
+		box           [4]float32
+		want          LabelStudioValue
+	}{
+		{"整张图像", 640, 480, [4]float32{0, 0, 640, 480}, LabelStudioValue{X: 0, Y: 0, Width: 100, Height: 100}},
+		{"中心区域", 640, 480, [4]float32{160, 120, 480, 360}, LabelStudioValue{X: 25, Y: 25, Width: 50, Height: 50}},
+		{"按各自的边长换算", 1920, 1080, [4]float32{192, 108, 384, 540}, LabelStudioValue{X: 10, Y: 10, Width: 10, Height: 40}},
+		{"保留六位小数", 3, 3, [4]float32{1, 0, 2, 3}, LabelStudioValue{X: 33.333333, Y: 0, Width: 33.333333, Height: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := ResultRecord{Width: tt.width, Height: tt.height, Detections: []DetectionObject{{Label: "person", Confidence: 0.8, Box: tt.box}}}
+			task := newLabelStudioTask(record, "a.jpg", "yolo11x")
+			result := task.Predictions[0].Result[0]
+			tt.want.RectangleLabels = []string{"person"}
+			got := result.Value
+			if got.X != tt.want.X || got.Y != tt.want.Y || got.Width != tt.want.Width || got.Height != tt.want.Height || !slices.Equal(got.RectangleLabels, tt.want.RectangleLabels) {
+				t.Errorf("value = %+v，期望 %+v", got, tt.want)
+			}
+			if result.FromName != "bbox" || result.ToName != "photo" || task.Data["photo"] != "a.jpg" {
+				t.Errorf("from_name/to_name = %s/%s，data = %v", result.FromName, result.ToName, task.Data)
+			}
+			if result.OriginalWidth != tt.width || result.OriginalHeight != tt.height || result.Score != 0.8 {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+}
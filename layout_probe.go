@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// 每个候选排布最多抽样的锚点数，首次推理时的探测开销与锚点总数无关
+const probeSampleAnchors = 2000
+
+// 探测结果与当前排布得分相差超过该值时才认为排布不匹配，避免全零等无信息输出导致误判
+const probeMismatchMargin = 0.2
+
+// layoutProbe 首次推理后对输出排布的探测结果
+type layoutProbe struct {
+	Configured string             // 当前使用的排布（-format 或 auto 按形状推断的结果）
+	Detected   string             // 按输出数值统计判断最可能的排布
+	Scores     map[string]float64 // 各候选排布的得分（0-1）
+	Switched   bool               // 是否已自动切换到探测出的排布
+	Mismatch   bool               // 探测结果与当前排布不一致
+}
+
+// String 返回适合写入日志和元数据的探测结论
+func (p layoutProbe) String() string {
+	parts := make([]string, 0, len(p.Scores))
+	for _, format := range []string{formatV8, formatV5, formatE2E} {
+		if score, ok := p.Scores[format]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%.2f", format, score))
+		}
+	}
+	decision := "一致"
+	switch {
+	case p.Switched:
+		decision = "已自动切换为 " + p.Detected
+	case p.Mismatch:
+		decision = "不一致，可能检测不到任何目标，请检查 -format"
+	}
+	return fmt.Sprintf("排布探测: 当前 %s，判断为 %s（%s），%s", p.Configured, p.Detected, strings.Join(parts, ", "), decision)
+}
+
+// probeSessionLayout 在会话首次推理后探测输出排布，每个会话只执行一次
+// -format auto 时排布不一致则自动切换（仅检测任务，分割/姿态模型的附加通道无法可靠重排，只给出警告）；
+// 手动指定 -format 时只给出醒目警告。结论写入日志，并通过 session.probe 附加到结果元数据
+func probeSessionLayout(session *ModelSession, output []float32) {
+	if session.probed || session.Layout.Format == formatCls {
+		return
+	}
+	session.probed = true
+
+	dims := session.Layout.shape(1)
+	probe := probeOutputLayout(output, dims, session.Layout.Format, *modelInputSize)
+	canSwitch := *modelFormat == formatAuto && session.Layout.NumMaskCoeffs == 0 && session.Layout.NumKeypoints == 0
+	if probe.Mismatch && canSwitch {
+		if layout, err := layoutFromShape(dims, probe.Detected, *modelInputSize); err == nil {
+			session.Layout = layout
+			overrideLayoutCache(session.path, layout)
+			probe.Switched = true
+		}
+	}
+	session.probe = probe.String()
+
+	level := "INFO"
+	if probe.Mismatch {
+		level = "WARN"
+		fmt.Printf("警告: 模型 %s %s\n", session.Name, session.probe)
+	}
+	writeLogFile(level, fmt.Sprintf("模型 %s %s", session.Name, session.probe))
+}
+
+// probeCandidate 一种候选排布：通道数、锚点数以及按该排布读取数值的方式
+type probeCandidate struct {
+	format            string
+	channels, anchors int
+	at                func(ch, a int) float32
+}
+
+// probeOutputLayout 根据输出数值的统计特征为每种候选排布打分：
+// 坐标通道应落在输入尺寸附近，类别/置信度（含 v5 的 objectness）通道应在 [0, 1] 内，端到端格式的类别列应为非负整数
+func probeOutputLayout(output []float32, dims ort.Shape, configured string, inputSize int) layoutProbe {
+	probe := layoutProbe{Configured: configured, Detected: configured, Scores: make(map[string]float64)}
+	d1, d2 := int(dims[1]), int(dims[2])
+	if len(output) < d1*d2 {
+		return probe
+	}
+	candidates := []probeCandidate{
+		{formatV8, d1, d2, func(ch, a int) float32 { return output[ch*d2+a] }},
+		{formatV5, d2, d1, func(ch, a int) float32 { return output[a*d2+ch] }},
+	}
+	if d2 == e2eChannels {
+		candidates = append(candidates, probeCandidate{formatE2E, d2, d1, func(ch, a int) float32 { return output[a*d2+ch] }})
+	}
+
+	lo, hi := -0.5*float64(inputSize), 1.5*float64(inputSize)
+	best := -1.0
+	for _, c := range candidates {
+		// v8/v5 的锚点数远多于通道数，反过来几乎不可能是真实排布
+		if c.channels <= 4 || c.anchors <= 0 || (c.format != formatE2E && c.anchors < c.channels) {
+			probe.Scores[c.format] = 0
+			continue
+		}
+		step := max(1, c.anchors/probeSampleAnchors)
+		var coordOK, coordN, probOK, probN, intOK, intN float64
+		for a := 0; a < c.anchors; a += step {
+			for ch := 0; ch < 4; ch++ {
+				v := float64(c.at(ch, a))
+				coordN++
+				if v >= lo && v <= hi {
+					coordOK++
+				}
+			}
+			lastProb := c.channels
+			if c.format == formatE2E {
+				lastProb = 5
+				v := float64(c.at(5, a))
+				intN++
+				if v == math.Trunc(v) && v >= 0 {
+					intOK++
+				}
+			}
+			for ch := 4; ch < lastProb; ch++ {
+				v := float64(c.at(ch, a))
+				probN++
+				if v >= 0 && v <= 1 {
+					probOK++
+				}
+			}
+		}
+		score := (coordOK / coordN) * (probOK / probN)
+		if intN > 0 {
+			score *= intOK / intN
+		}
+		probe.Scores[c.format] = score
+		if score > best {
+			best, probe.Detected = score, c.format
+		}
+	}
+	probe.Mismatch = probe.Detected != configured && best-probe.Scores[configured] > probeMismatchMargin
+	if !probe.Mismatch {
+		probe.Detected = configured
+	}
+	return probe
+}
+
+// overrideLayoutCache 探测后自动切换排布时更新缓存，之后创建的会话直接使用新排布
+func overrideLayoutCache(path string, layout outputLayout) {
+	key := fmt.Sprintf("%s|%s|%s|%d", path, *modelFormat, *taskType, *modelInputSize)
+	layoutCacheMutex.Lock()
+	defer layoutCacheMutex.Unlock()
+	layoutCache[key] = layout
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+// 实时推送参数
+var (
+	wsAddr      = &config.WSAddr
+	wsThumbnail = &config.WSThumbnail
+)
+
+const (
+	wsClientBuffer   = 64               // 每个客户端待发送的消息数上限，超过时断开该客户端
+	wsWriteTimeout   = 10 * time.Second // 单条消息的写超时
+	wsPingInterval   = 30 * time.Second // 心跳间隔，发现已断开的连接
+	wsMaxReadFrame   = 4096             // 客户端帧的大小上限（客户端只应发送控制帧）
+	wsAcceptGUID     = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsOpText         = 0x1
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+	wsThumbQuality   = 75
+	wsCloseNormal    = 1000
+	wsClosePolicy    = 1008 // 客户端接收太慢被断开
+	wsCloseGoingAway = 1001
+)
+
+// liveHub -ws-addr 的客户端集合，为 nil 时不推送
+var liveHub *wsHub
+
+// LiveMessage 推送给 WebSocket 客户端的一条检测结果
+type LiveMessage struct {
+	Source     string            `json:"source"`
+	Timestamp  time.Time         `json:"timestamp"`
+	TaskID     uint64            `json:"task_id,omitempty"`
+	Width      int               `json:"width,omitempty"`
+	Height     int               `json:"height,omitempty"`
+	Detections []DetectionObject `json:"detections"`
+	Error      string            `json:"error,omitempty"`
+	Thumbnail  string            `json:"thumbnail,omitempty"` // -ws-thumbnail 时为原图缩略图的 JPEG base64
+}
+
+// wsHub 把管理器结果队列中的每个结果广播给所有已连接的客户端
+// 每个客户端有自己的发送缓冲，缓冲满（客户端接收太慢）时断开该客户端，不影响其他客户端和检测
+type wsHub struct {
+	mutex   sync.Mutex
+	clients map[*wsClient]bool
+	closed  bool
+}
+
+// wsClient 一个 WebSocket 连接
+type wsClient struct {
+	conn       net.Conn
+	send       chan []byte
+	filter     *classFilter // ?classes= 指定的类别，为 nil 时接收全部
+	writeMutex sync.Mutex   // 数据帧和控制帧（pong、close）可能来自不同协程
+	closed     bool         // 已发送关闭帧，由 writeMutex 保护
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{clients: make(map[*wsClient]bool)}
+}
+
+// startLiveServer 在 addr 上提供 /ws，返回的服务器和 hub 由调用方在退出前关闭
+func startLiveServer(addr string) (*wsHub, *http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("监听实时推送地址 %s 失败: %w", addr, err)
+	}
+	hub := newWSHub()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.handle)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			writeLogFile("ERROR", fmt.Sprintf("实时推送服务退出: %v", err))
+		}
+	}()
+	return hub, server, nil
+}
+
+// follow 读取管理器的结果队列直到其关闭（管理器停止），每个结果广播一次
+// 结果队列是工作协程的非阻塞副本，推送跟不上时部分结果会被丢弃，不影响任务回调
+func (hub *wsHub) follow(results <-chan DetectionResult) {
+	for result := range results {
+		hub.broadcast(result)
+	}
+}
+
+// broadcast 把结果发送给所有客户端；带类别过滤的客户端只收到保留的检测目标，没有保留的目标时不发送
+func (hub *wsHub) broadcast(result DetectionResult) {
+	hub.mutex.Lock()
+	clients := make([]*wsClient, 0, len(hub.clients))
+	for client := range hub.clients {
+		clients = append(clients, client)
+	}
+	hub.mutex.Unlock()
+	if len(clients) == 0 || errors.Is(result.Error, context.Canceled) {
+		return
+	}
+
+	record := newResultRecord(result)
+	msg := LiveMessage{
+		Source:     record.ImagePath,
+		Timestamp:  record.Timestamp,
+		TaskID:     record.TaskID,
+		Width:      record.Width,
+		Height:     record.Height,
+		Detections: record.Detections,
+		Error:      record.Error,
+	}
+	if result.Error == nil {
+		msg.Thumbnail = result.thumbnail
+	}
+	all, err := json.Marshal(msg)
+	if err != nil {
+		writeLogFile("ERROR", fmt.Sprintf("编码实时推送消息失败: %v", err))
+		return
+	}
+
+	for _, client := range clients {
+		payload := all
+		if client.filter != nil {
+			filtered := msg
+			filtered.Detections = make([]DetectionObject, 0, len(msg.Detections))
+			for _, d := range msg.Detections {
+				if client.filter.allows(d.Label) {
+					filtered.Detections = append(filtered.Detections, d)
+				}
+			}
+			if len(filtered.Detections) == 0 {
+				continue
+			}
+			if payload, err = json.Marshal(filtered); err != nil {
+				continue
+			}
+		}
+		hub.deliver(client, payload)
+	}
+}
+
+// deliver 非阻塞地放入客户端的发送缓冲，缓冲已满时断开该客户端
+func (hub *wsHub) deliver(client *wsClient, payload []byte) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if !hub.clients[client] {
+		return
+	}
+	select {
+	case client.send <- payload:
+	default:
+		writeLogFile("WARN", fmt.Sprintf("实时推送客户端 %s 接收太慢，已断开", client.conn.RemoteAddr()))
+		hub.removeLocked(client, wsClosePolicy)
+	}
+}
+
+// remove 断开客户端，可重复调用
+func (hub *wsHub) remove(client *wsClient, code int) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.removeLocked(client, code)
+}
+
+func (hub *wsHub) removeLocked(client *wsClient, code int) {
+	if !hub.clients[client] {
+		return
+	}
+	delete(hub.clients, client)
+	close(client.send)
+	// 写关闭帧可能要等待正在进行的写入（最多 wsWriteTimeout），不在持有 hub 锁时等待
+	go client.shutdown(code)
+}
+
+// shutdown 发送关闭帧后关闭连接，之后的写入返回 net.ErrClosed，读协程和发送协程随之结束
+func (client *wsClient) shutdown(code int) {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	if client.closed {
+		return
+	}
+	client.closed = true
+	client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	client.conn.Write(append([]byte{0x80 | wsOpClose, 2}, wsClosePayload(code)...))
+	client.conn.Close()
+}
+
+// close 断开所有客户端，之后的连接请求返回 503
+func (hub *wsHub) close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.closed = true
+	for client := range hub.clients {
+		hub.removeLocked(client, wsCloseGoingAway)
+	}
+}
+
+// handle GET /ws[?classes=person,car]：完成 WebSocket 握手后持续推送检测结果
+func (hub *wsHub) handle(w http.ResponseWriter, r *http.Request) {
+	var filter *classFilter
+	if classes := strings.Join(r.URL.Query()["classes"], ","); classes != "" {
+		var err error
+		if filter, err = parseClassFilter(classes, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "需要 WebSocket 连接", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "不支持的 WebSocket 版本", http.StatusUpgradeRequired)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "连接不支持升级", http.StatusInternalServerError)
+		return
+	}
+
+	hub.mutex.Lock()
+	closed := hub.closed
+	hub.mutex.Unlock()
+	if closed {
+		http.Error(w, "实时推送已停止", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	client := &wsClient{conn: conn, send: make(chan []byte, wsClientBuffer), filter: filter}
+	hub.mutex.Lock()
+	if hub.closed {
+		hub.mutex.Unlock()
+		conn.Close()
+		return
+	}
+	hub.clients[client] = true
+	hub.mutex.Unlock()
+
+	go client.writeLoop(hub)
+	client.readLoop(hub, rw.Reader)
+}
+
+// writeLoop 发送缓冲中的消息并定期发送心跳，写失败时断开
+func (client *wsClient) writeLoop(hub *wsHub) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case payload, ok := <-client.send:
+			if !ok {
+				return
+			}
+			if err := client.writeFrame(wsOpText, payload); err != nil {
+				hub.remove(client, wsCloseNormal)
+				return
+			}
+		case <-ticker.C:
+			if err := client.writeFrame(wsOpPing, nil); err != nil {
+				hub.remove(client, wsCloseNormal)
+				return
+			}
+		}
+	}
+}
+
+// readLoop 读取客户端的帧：回复 ping，收到 close 或读失败时断开；数据帧忽略
+func (client *wsClient) readLoop(hub *wsHub, r *bufio.Reader) {
+	defer hub.remove(client, wsCloseNormal)
+	for {
+		op, payload, err := readWSFrame(r)
+		if err != nil {
+			return
+		}
+		switch op {
+		case wsOpClose:
+			return
+		case wsOpPing:
+			if client.writeFrame(wsOpPong, payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeFrame 写入一个不分片、不加掩码的帧（服务端发出的帧不加掩码）
+func (client *wsClient) writeFrame(op byte, payload []byte) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	if client.closed {
+		return net.ErrClosed
+	}
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	client.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := client.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readWSFrame 读取一个客户端帧并去掉掩码；客户端帧必须加掩码且不超过 wsMaxReadFrame
+func readWSFrame(r io.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("客户端帧未加掩码")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxReadFrame {
+		return 0, nil, fmt.Errorf("客户端帧过大: %d 字节", n)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
+
+func wsClosePayload(code int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
+
+// headerHasToken 判断逗号分隔的请求头中是否包含 token（不区分大小写）
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wantsThumbnails 判断是否需要为推送消息生成缩略图：指定了 -ws-thumbnail 且有客户端连接
+func (hub *wsHub) wantsThumbnails() bool {
+	if hub == nil || *wsThumbnail <= 0 {
+		return false
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	return len(hub.clients) > 0
+}
+
+// liveThumbnail 工作协程在结果发出前用内存中的图像生成推送消息的缩略图，不需要缩略图时返回空
+// 视频帧在回调后放回图像池，摄像头和 RTSP 流、上传的图像没有可重新读取的文件，因此不能在推送时再读取原图
+func liveThumbnail(img image.Image) string {
+	if !liveHub.wantsThumbnails() {
+		return ""
+	}
+	return encodeThumbnail(img, uint(*wsThumbnail))
+}
+
+// fileThumbnail 重新读取原图生成缩略图，读取失败（如 -serve 上传的图像）时返回空
+func fileThumbnail(imagePath string, size uint) string {
+	img, err := loadImageFile(imagePath)
+	if err != nil {
+		return ""
+	}
+	return encodeThumbnail(img, size)
+}
+
+// encodeThumbnail 生成长边不超过 size 的 JPEG 缩略图（base64），编码失败时返回空
+func encodeThumbnail(img image.Image, size uint) string {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize.Thumbnail(size, size, img, resize.Bilinear), &jpeg.Options{Quality: wsThumbQuality}); err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestKey RFC 6455 第 1.3 节示例中的 Sec-WebSocket-Key 及其应答
+const (
+	wsTestKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	wsTestAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// wsTestClient 测试用的最小 WebSocket 客户端
+type wsTestClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWS 向 server 发起握手请求，header 覆盖默认的握手请求头（值为空时删除），返回响应和握手成功时的客户端
+func dialWS(t *testing.T, server *httptest.Server, query string, header map[string]string) (*http.Response, *wsTestClient) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	headers := map[string]string{
+		"Upgrade":               "websocket",
+		"Connection":            "keep-alive, Upgrade",
+		"Sec-WebSocket-Key":     wsTestKey,
+		"Sec-WebSocket-Version": "13",
+	}
+	for name, value := range header {
+		headers[name] = value
+	}
+	request := fmt.Sprintf("GET /ws%s HTTP/1.1\r\nHost: %s\r\n", query, server.Listener.Addr())
+	for name, value := range headers {
+		if value != "" {
+			request += name + ": " + value + "\r\n"
+		}
+	}
+	if _, err := io.WriteString(conn, request+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+	return resp, &wsTestClient{conn: conn, r: r}
+}
+
+// readFrame 读取一个服务端帧（不加掩码）
+func (c *wsTestClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		t.Fatalf("读取帧失败: %v", err)
+	}
+	if head[1]&0x80 != 0 {
+		t.Fatal("服务端帧不应加掩码")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.r, ext[:])
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("读取帧内容失败: %v", err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+// readMessage 读取下一条推送消息
+func (c *wsTestClient) readMessage(t *testing.T) LiveMessage {
+	t.Helper()
+	op, payload := c.readFrame(t)
+	if op != wsOpText {
+		t.Fatalf("帧类型 = %#x，期望文本帧", op)
+	}
+	var msg LiveMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("消息不是 JSON: %v", err)
+	}
+	return msg
+}
+
+// writeFrame 写入一个加掩码的客户端帧
+func (c *wsTestClient) writeFrame(t *testing.T, op byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestHub 启动提供 hub.handle 的测试服务器
+func newTestHub(t *testing.T) (*wsHub, *httptest.Server) {
+	t.Helper()
+	hub := newWSHub()
+	server := httptest.NewServer(http.HandlerFunc(hub.handle))
+	t.Cleanup(func() {
+		hub.close()
+		server.Close()
+	})
+	return hub, server
+}
+
+// waitClients 等待 hub 中的客户端数变为 n
+func waitClients(t *testing.T, hub *wsHub, n int) {
+	t.Helper()
+	waitUntil(t, fmt.Sprintf(" %d 个客户端", n), func() bool {
+		hub.mutex.Lock()
+		defer hub.mutex.Unlock()
+		return len(hub.clients) == n
+	})
+}
+
+// liveResult 含指定类别检测目标的结果
+func liveResult(source string, labels ...string) DetectionResult {
+	var result DetectionResult
+	result.ImagePath = source
+	result.Width, result.Height = 640, 480
+	for i, label := range labels {
+		result.Objects = append(result.Objects, boundingBox{label: label, confidence: 0.9, x1: float32(i * 10), y1: 0, x2: float32(i*10 + 5), y2: 5})
+	}
+	return result
+}
+
+func TestWSHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header map[string]string
+		closed bool
+		want   int
+	}{
+		{"握手成功", "", nil, false, http.StatusSwitchingProtocols},
+		{"带类别过滤", "?classes=person,car", nil, false, http.StatusSwitchingProtocols},
+		{"未知类别", "?classes=unicorn", nil, false, http.StatusBadRequest},
+		{"不是升级请求", "", map[string]string{"Upgrade": "", "Connection": "keep-alive"}, false, http.StatusBadRequest},
+		{"缺少 Sec-WebSocket-Key", "", map[string]string{"Sec-WebSocket-Key": ""}, false, http.StatusBadRequest},
+		{"不支持的版本", "", map[string]string{"Sec-WebSocket-Version": "8"}, false, http.StatusUpgradeRequired},
+		{"推送已停止", "", nil, true, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, server := newTestHub(t)
+			if tt.closed {
+				hub.close()
+			}
+			resp, _ := dialWS(t, server, tt.query, tt.header)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("状态码 = %d，期望 %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusSwitchingProtocols {
+				if got := resp.Header.Get("Sec-WebSocket-Accept"); got != wsTestAccept {
+					t.Errorf("Sec-WebSocket-Accept = %q，期望 %q", got, wsTestAccept)
+				}
+				waitClients(t, hub, 1)
+			}
+			if tt.want == http.StatusUpgradeRequired && resp.Header.Get("Sec-WebSocket-Version") != "13" {
+				t.Error("426 响应没有给出支持的版本")
+			}
+		})
+	}
+}
+
+func TestWSBroadcastFilter(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.WSThumbnail = 0
+	hub, server := newTestHub(t)
+	_, all := dialWS(t, server, "", nil)
+	_, persons := dialWS(t, server, "?classes=person", nil)
+	waitClients(t, hub, 2)
+
+	hub.broadcast(liveResult("rtsp://cam/1", "person", "car"))
+	hub.broadcast(liveResult("rtsp://cam/2", "car"))
+	hub.broadcast(liveResult("rtsp://cam/3", "person"))
+
+	tests := []struct {
+		name   string
+		client *wsTestClient
+		want   []string // 依次收到的消息：来源/检测目标
+	}{
+		{"全部类别", all, []string{"rtsp://cam/1/person,car", "rtsp://cam/2/car", "rtsp://cam/3/person"}},
+		// 只有 car 的结果不推送给只订阅 person 的客户端
+		{"只订阅 person", persons, []string{"rtsp://cam/1/person", "rtsp://cam/3/person"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range tt.want {
+				msg := tt.client.readMessage(t)
+				labels := make([]string, len(msg.Detections))
+				for i, d := range msg.Detections {
+					labels[i] = d.Label
+				}
+				if got := msg.Source + "/" + strings.Join(labels, ","); got != want {
+					t.Errorf("消息 = %s，期望 %s", got, want)
+				}
+				if msg.Width != 640 || msg.Height != 480 || msg.Timestamp.IsZero() {
+					t.Errorf("消息缺少尺寸或时间: %+v", msg)
+				}
+			}
+		})
+	}
+
+	// 取消的结果不推送，失败的结果推送给不过滤类别的客户端
+	hub.broadcast(failedResult("rtsp://cam/4", context.Canceled))
+	hub.broadcast(failedResult("rtsp://cam/5", fmt.Errorf("加载图像失败")))
+	if msg := all.readMessage(t); msg.Source != "rtsp://cam/5" || msg.Error == "" {
+		t.Errorf("收到 %s（错误 %q），期望跳过已取消的结果并推送失败的结果", msg.Source, msg.Error)
+	}
+
+	// 客户端的 ping 得到相同内容的 pong，close 后客户端被移除
+	all.writeFrame(t, wsOpPing, []byte("hi"))
+	if op, payload := all.readFrame(t); op != wsOpPong || string(payload) != "hi" {
+		t.Errorf("ping 的回复 = %#x %q，期望 pong \"hi\"", op, payload)
+	}
+	all.writeFrame(t, wsOpClose, wsClosePayload(wsCloseNormal))
+	waitClients(t, hub, 1)
+	if op, payload := all.readFrame(t); op != wsOpClose || !bytes.Equal(payload, wsClosePayload(wsCloseNormal)) {
+		t.Errorf("收到 %#x %v，期望关闭码 %d 的关闭帧", op, payload, wsCloseNormal)
+	}
+
+}
+
+func TestWSSlowClientEvicted(t *testing.T) {
+	hub, server := newTestHub(t)
+	_, slow := dialWS(t, server, "", nil)
+	waitClients(t, hub, 1)
+
+	// 不读取的客户端：套接字缓冲写满后发送缓冲也写满，被断开
+	result := liveResult("rtsp://cam/1", "person")
+	result.thumbnail = strings.Repeat("A", 256<<10)
+	for i := 0; i < 4*wsClientBuffer; i++ {
+		hub.broadcast(result)
+	}
+	waitClients(t, hub, 0)
+	slow.conn.Close()
+
+	// 断开慢客户端不影响之后连接的客户端
+	_, fast := dialWS(t, server, "", nil)
+	waitClients(t, hub, 1)
+	hub.broadcast(liveResult("rtsp://cam/2", "person"))
+	if msg := fast.readMessage(t); msg.Source != "rtsp://cam/2" {
+		t.Errorf("新客户端收到 %s，期望 rtsp://cam/2", msg.Source)
+	}
+}
+
+func TestLiveThumbnailFromFrame(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	defer func(saved *wsHub) { liveHub = saved }(liveHub)
+	config.WSThumbnail = 32
+	hub, server := newTestHub(t)
+	liveHub = hub
+
+	// 流、摄像头和视频帧没有可以重新读取的文件，缩略图只能由内存中的图像生成
+	frame := randomRGBA(image.Rect(0, 0, 128, 64), 3)
+	task := &DetectionTask{ImagePath: "rtsp://cam/stream", Image: frame}
+	layout := outputLayout{Format: formatE2E, NumChannels: 6, NumAnchors: 1}
+	cfg, err := newDetectionConfig().withParams(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		clients int
+		want    image.Point // 缩略图尺寸，零值表示没有缩略图
+	}{
+		{"没有客户端时不生成", 0, image.Point{}},
+		{"有客户端时按长边缩放", 1, image.Pt(32, 16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.clients > 0 {
+				dialWS(t, server, "", nil)
+			}
+			waitClients(t, hub, tt.clients)
+			_, thumbnail, err := detectTask(context.Background(), newFakeSession(make([]float32, 6), layout), task, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == (image.Point{}) {
+				if thumbnail != "" {
+					t.Errorf("缩略图 = %.20q…，期望为空", thumbnail)
+				}
+				return
+			}
+			data, err := base64.StdEncoding.DecodeString(thumbnail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("缩略图不是 JPEG: %v", err)
+			}
+			if got := image.Pt(img.Width, img.Height); got != tt.want {
+				t.Errorf("缩略图尺寸 = %v，期望 %v", got, tt.want)
+			}
+
+			// 推送消息使用工作协程生成的缩略图，不再按来源重新读取
+			var result DetectionResult
+			result.ImagePath, result.thumbnail = task.ImagePath, thumbnail
+			_, client := dialWS(t, server, "", nil)
+			waitClients(t, hub, tt.clients+1)
+			hub.broadcast(result)
+			if msg := client.readMessage(t); msg.Thumbnail != thumbnail {
+				t.Error("推送消息中的缩略图与工作协程生成的不同")
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 日志轮转参数
+var (
+	logMaxSizeMB     = &config.LogMaxSizeMB
+	logRetentionDays = &config.LogRetentionDays
+)
+
+// logDir 日志目录，每天一个 log_YYYY-MM-DD.txt，超过 -log-max-size 时轮转为 log_YYYY-MM-DD.N.txt.gz
+const logDir = "./logs"
+
+// logWriter 按天写入日志文件，当天文件超过大小上限时压缩归档后重新开始，
+// 打开新一天的文件时（包括启动后的第一次写入）清理超过保留天数的日志
+// 命令行和服务模式共用同一个 logWriter，可并发调用
+type logWriter struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize func() int64 // 单个文件的大小上限（字节），0 表示不限制
+	keep    func() int   // 保留天数，0 表示不清理
+	now     func() time.Time
+	day     string   // 当前文件的日期
+	file    *os.File // 当前日志文件
+	size    int64    // 当前文件大小
+}
+
+// defaultLogWriter writeLogFile 使用的日志
+var defaultLogWriter = &logWriter{
+	dir:     logDir,
+	maxSize: func() int64 { return int64(*logMaxSizeMB) << 20 },
+	keep:    func() int { return *logRetentionDays },
+	now:     time.Now,
+}
+
+// writeLogFile 写入日志文件
+// 记录程序运行过程中的重要事件和错误信息，写入失败只打印提示
+func writeLogFile(level, message string) {
+	if err := defaultLogWriter.write(level, message); err != nil {
+		fmt.Printf("写入日志失败: %v\n", err)
+	}
+}
+
+func (w *logWriter) write(level, message string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.now()
+	entry := fmt.Sprintf("%s %s %s\n", formatTimestamp(now), level, message)
+	if day := formatDate(now); day != w.day || w.file == nil {
+		if err := w.open(day); err != nil {
+			return err
+		}
+	}
+	if limit := w.maxSize(); limit > 0 && w.size > 0 && w.size+int64(len(entry)) > limit {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.WriteString(entry)
+	w.size += int64(n)
+	return err
+}
+
+// open 打开（追加）指定日期的日志文件，并清理过期日志
+func (w *logWriter) open(day string) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(w.dir, "log_"+day+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	w.file, w.day, w.size = file, day, info.Size()
+	w.purge(day)
+	return nil
+}
+
+// purgeLogs 启动时清理过期日志，之后在每天第一次写日志时清理
+func purgeLogs() {
+	w := defaultLogWriter
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.purge(formatDate(w.now()))
+}
+
+// rotate 将当天已写满的日志压缩为 log_YYYY-MM-DD.N.txt.gz（N 从 1 递增），再重新打开空文件
+func (w *logWriter) rotate() error {
+	current := w.file.Name()
+	w.file.Close()
+	w.file = nil
+
+	archive := filepath.Join(w.dir, fmt.Sprintf("log_%s.%d.txt.gz", w.day, w.nextIndex()))
+	if err := gzipFile(current, archive); err != nil {
+		// 压缩失败时保留原文件继续追加，不丢失日志
+		if openErr := w.open(w.day); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("压缩日志 %s 失败: %w", current, err)
+	}
+	if err := os.Remove(current); err != nil {
+		return fmt.Errorf("删除已压缩的日志 %s 失败: %w", current, err)
+	}
+	return w.open(w.day)
+}
+
+// nextIndex 返回当天下一个归档序号
+func (w *logWriter) nextIndex() int {
+	matches, _ := filepath.Glob(filepath.Join(w.dir, "log_"+w.day+".*.txt.gz"))
+	next := 1
+	for _, m := range matches {
+		index := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "log_"+w.day+"."), ".txt.gz")
+		if n, err := strconv.Atoi(index); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return next
+}
+
+// purge 删除日期早于保留天数（以 day 为今天）的日志（log_YYYY-MM-DD.txt 和归档 log_YYYY-MM-DD.N.txt.gz），
+// 只处理文件名可解析出日期的文件；未设置 -log-retention-days 时不做任何事
+func (w *logWriter) purge(day string) {
+	keep := w.keep()
+	if keep <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return
+	}
+	today, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return
+	}
+	cutoff := today.AddDate(0, 0, -(keep - 1)) // 保留今天在内的 keep 天
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "log_") || len(name) < len("log_2006-01-02") {
+			continue
+		}
+		fileDay, err := time.Parse("2006-01-02", name[len("log_"):len("log_2006-01-02")])
+		if err != nil || !fileDay.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.dir, name)); err == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		fmt.Printf("已清理 %d 个超过 %d 天的日志文件\n", removed, keep)
+	}
+}
+
+// gzipFile 把 src 压缩写入 dst（先写临时文件再改名，中途失败不留下不完整的归档）
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFileAtomic(dst, func(f *os.File) error {
+		zw := gzip.NewWriter(f)
+		zw.Name = filepath.Base(src)
+		if _, err := io.Copy(zw, in); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogWriter 创建写入临时目录的 logWriter，时钟由 clock 控制
+func testLogWriter(t *testing.T, maxSize int64, keep int, clock *time.Time) *logWriter {
+	t.Helper()
+	w := &logWriter{
+		dir:     t.TempDir(),
+		maxSize: func() int64 { return maxSize },
+		keep:    func() int { return keep },
+		now:     func() time.Time { return *clock },
+	}
+	t.Cleanup(func() {
+		if w.file != nil {
+			w.file.Close()
+		}
+	})
+	return w
+}
+
+// readLogs 按归档序号顺序读出某天的全部日志（归档在前，当前文件在后）
+func readLogs(t *testing.T, dir, day string) (archives []string, content string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, "log_"+day+".*.txt.gz"))
+	for i := range matches {
+		name := fmt.Sprintf("log_%s.%d.txt.gz", day, i+1)
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("归档序号不连续: %v (%v)", err, matches)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, name)
+		content += string(data)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "log_"+day+".txt"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return archives, content + string(data)
+}
+
+func TestLogWriterRotation(t *testing.T) {
+	clock := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	entry := len(fmt.Sprintf("%s INFO message-00\n", formatTimestamp(clock)))
+
+	tests := []struct {
+		name     string
+		maxSize  int64
+		writes   int
+		archives int
+	}{
+		{"不限制大小", 0, 10, 0},
+		{"未达到上限", int64(entry * 10), 10, 0},
+		{"每个文件两条", int64(entry * 2), 7, 3},
+		{"上限小于一条日志时每条一个文件", 10, 4, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testLogWriter(t, tt.maxSize, 0, &clock)
+			var want strings.Builder
+			for i := range tt.writes {
+				message := fmt.Sprintf("message-%02d", i)
+				if err := w.write("INFO", message); err != nil {
+					t.Fatal(err)
+				}
+				fmt.Fprintf(&want, "%s INFO %s\n", formatTimestamp(clock), message)
+			}
+
+			archives, content := readLogs(t, w.dir, "2024-05-01")
+			if len(archives) != tt.archives {
+				t.Errorf("归档 %v，期望 %d 个", archives, tt.archives)
+			}
+			if content != want.String() {
+				t.Errorf("归档和当前文件中的日志 =\n%s期望\n%s", content, want.String())
+			}
+			if info, err := os.Stat(filepath.Join(w.dir, "log_2024-05-01.txt")); err != nil || (tt.maxSize > int64(entry) && info.Size() > tt.maxSize) {
+				t.Errorf("当前文件大小超过上限: %v (%v)", info.Size(), err)
+			}
+		})
+	}
+}
+
+func TestLogWriterRotationContinuesIndex(t *testing.T) {
+	clock := time.Date(2024, 5, 1, 8, 0, 0, 0, time.Local)
+	w := testLogWriter(t, 10, 0, &clock)
+	for i := range 3 {
+		if err := w.write("INFO", fmt.Sprintf("first-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新启动后在已有归档之后继续编号，当天文件追加写入
+	w.file.Close()
+	restarted := &logWriter{dir: w.dir, maxSize: w.maxSize, keep: w.keep, now: w.now}
+	t.Cleanup(func() { restarted.file.Close() })
+	for i := range 2 {
+		if err := restarted.write("INFO", fmt.Sprintf("second-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archives, content := readLogs(t, w.dir, "2024-05-01")
+	if len(archives) != 4 {
+		t.Errorf("归档 = %v，期望 4 个", archives)
+	}
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		messages = append(messages, line[strings.LastIndex(line, " ")+1:])
+	}
+	if want := []string{"first-0", "first-1", "first-2", "second-0", "second-1"}; !slices.Equal(messages, want) {
+		t.Errorf("日志顺序 = %v，期望 %v", messages, want)
+	}
+}
+
+func TestLogWriterRetention(t *testing.T) {
+	clock := time.Date(2024, 5, 10, 23, 59, 0, 0, time.Local)
+	w := testLogWriter(t, 0, 3, &clock)
+
+	old := []string{
+		"log_2024-05-01.txt", "log_2024-05-07.txt", "log_2024-05-07.1.txt.gz",
+		"log_2024-05-08.txt", "log_2024-05-08.2.txt.gz", "log_2024-05-09.txt",
+		"log_notes.txt", "other_2024-01-01.txt",
+	}
+	for _, name := range old {
+		if err := os.WriteFile(filepath.Join(w.dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remaining := func() []string {
+		entries, err := os.ReadDir(w.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	// 第一次写入时清理：保留今天在内的 3 天（05-08 至 05-10），文件名不含日期的不处理
+	if err := w.write("INFO", "start"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"log_2024-05-08.2.txt.gz", "log_2024-05-08.txt", "log_2024-05-09.txt", "log_2024-05-10.txt", "log_notes.txt", "other_2024-01-01.txt"}
+	if got := remaining(); !slices.Equal(got, want) {
+		t.Errorf("清理后 = %v，期望 %v", got, want)
+	}
+
+	// 跨天后的第一次写入再次清理
+	clock = clock.Add(2 * time.Minute)
+	if err := w.write("INFO", "next day"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"log_2024-05-09.txt", "log_2024-05-10.txt", "log_2024-05-11.txt", "log_notes.txt", "other_2024-01-01.txt"}
+	if got := remaining(); !slices.Equal(got, want) {
+		t.Errorf("跨天后 = %v，期望 %v", got, want)
+	}
+}
@@ -3,7 +3,8 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -17,15 +18,13 @@ import (
 	"math"
 	"os"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"math/rand/v2"
-
 	"github.com/flopp/go-findfont" // 添加字体查找库
 	"github.com/nfnt/resize"
 	ort "github.com/yalue/onnxruntime_go"
@@ -36,39 +35,48 @@ import (
 )
 
 // 全局配置参数
+// 命令行参数由 RegisterFlags 绑定到 config，这里的指针仅作为各处读取配置的简写
 var (
-	// 模型路径配置
-	modelPath = "./third_party/yolo11x.onnx" // YOLO模型文件路径
-	useCoreML = false                        // 是否使用CoreML加速（仅限iOS/macOS）
+	// 模型配置
+	useCoreML   = false // 是否使用CoreML加速（仅限iOS/macOS）
+	modelFormat = &config.Format
+	taskType    = &config.Task
 
 	// 输入输出路径参数
-	inputImagePath = flag.String("img", "./assets/bus.jpg", "输入图像路径、目录、视频文件或.txt文件")
-	//inputImagePath  = flag.String("img", "../yolo/camera", "输入图像路径、目录、视频文件或.txt文件")
-	outputImagePath = flag.String("output", "./assets/bus_11x_false.jpg", "输出图像路径（仅在输入单个图像时有效）")
+	inputImagePath  = &config.InputPath
+	outputImagePath = &config.OutputPath
 
 	// 检测参数配置
-	confidenceThreshold = flag.Float64("conf", 0.25, "置信度阈值，过滤低置信度检测结果")
-	iouThreshold        = flag.Float64("iou", 0.7, "IOU阈值，用于非极大值抑制(NMS)")
-	modelInputSize      = flag.Int("size", 640, "模型输入尺寸，通常为640x640")
-	// rect	bool	True	如果启用，则对图像较短的一边进行最小填充，直到可以被步长整除，以提高推理速度。如果禁用，则在推理期间将图像填充为正方形。
-	useRectScaling = flag.Bool("rect", false, "是否使用矩形缩放（保持长宽比）")
-	// augment	bool	False	启用测试时增强 (TTA) 进行预测，可能会提高检测的鲁棒性，但会降低推理速度。
-	useAugment = flag.Bool("augment", false, "是否启用测试时增强 (TTA) 进行预测")
-	// batch	int	1	指定推理的批处理大小（仅在源为以下情况时有效： 一个目录、视频文件，或 .txt 文件)。
-	batchSize = flag.Int("batch", 1, "指定推理的批处理大小")
+	confidenceThreshold = &config.ConfThreshold
+	iouThreshold        = &config.IOUThreshold
+	modelInputSize      = &config.InputSize
+	useRectScaling      = &config.RectScaling
+	useAugment          = &config.Augment
+	batchSize           = &config.BatchSize
+	warmupRuns          = &config.WarmupRuns
+	maxDetections       = &config.MaxDet
 
 	// 系统显示参数（用于监控系统等应用场景）
-	systemTextLocation = flag.String("text-location", "bottom-left", "系统文本位置 (top-left, bottom-left, top-right, bottom-right)")
-	systemTextContent  = flag.String("system-text", "重要设施危险场景监测系统", "系统显示文本")
-	systemTextEnabled  = flag.Bool("enable-system-text", true, "是否显示系统文本")
+	systemTextLocation = &config.SystemTextLocation
+	systemTextContent  = &config.SystemText
+	systemTextEnabled  = &config.SystemTextEnabled
 
 	// 并发处理相关参数
-	workerCount = flag.Int("workers", max(1, runtime.NumCPU()/2), "并发工作协程数量")
-	queueSize   = flag.Int("queue-size", 100, "任务队列大小")
-	taskTimeout = flag.Duration("timeout", 30*time.Second, "单个任务超时时间")
+	workerCount  = &config.Workers
+	queueSize    = &config.QueueSize
+	taskTimeout  = &config.TaskTimeout
+	batchCollect = &config.BatchCollect
+	batchFlush   = &config.BatchFlush
+	drainOnStop  = &config.DrainOnStop
 
 	// 中文字体变量
-	chineseFont font.Face
+	chineseFont     font.Face
+	chineseFontOnce sync.Once
+	chineseFontErr  error
+
+	// detectImage 共享的模型会话，避免每张图像重复加载模型
+	sharedSession      *ModelSession
+	sharedSessionMutex sync.Mutex
 
 	// ONNX Runtime 初始化状态控制（线程安全）
 	ortInitialized bool
@@ -77,16 +85,9 @@ var (
 	//步长
 	stride = 32
 
-	// 内存池优化
-	boundingBoxPool = sync.Pool{
-		New: func() interface{} {
-			return &boundingBox{}
-		},
-	}
-
 	// 图像对象池，用于重用RGBA图像
 	// 使用map存储不同尺寸的图像池，提高内存使用效率
-	imagePools     map[imageSizeKey]*sync.Pool
+	imagePools     = make(map[imageSizeKey]*sync.Pool)
 	imagePoolMutex sync.RWMutex
 )
 
@@ -125,8 +126,44 @@ type ScaleInfo struct {
 	NewHeight int     // 缩放后高度
 }
 
-// GetImageFromPool 从图像池中获取指定尺寸的图像
+// Validate 检查缩放信息与目标尺寸、stride 是否一致：缩放比例为正，
+// 每个方向上缩放后的图像要么居中放在画布内（letterbox/stretch 填充到 targetSize，-rect 只填充到 stride 的整数倍），
+// 要么居中覆盖整个画布（crop 时填充偏移为负）。不一致说明预处理配置有误，检测框会整体偏移
+func (s ScaleInfo) Validate(targetSize, stride int) error {
+	if !(s.ScaleX > 0) || !(s.ScaleY > 0) || math.IsInf(float64(s.ScaleX), 0) || math.IsInf(float64(s.ScaleY), 0) {
+		return fmt.Errorf("缩放比例无效: %g x %g", s.ScaleX, s.ScaleY)
+	}
+	if err := validateScaleAxis("宽", s.PadLeft, s.NewWidth, targetSize, stride); err != nil {
+		return err
+	}
+	return validateScaleAxis("高", s.PadTop, s.NewHeight, targetSize, stride)
+}
+
+// validateScaleAxis 检查一个方向上的填充偏移 pad 与缩放后尺寸 n
+func validateScaleAxis(axis string, pad, n, targetSize, stride int) error {
+	switch {
+	case n <= 0:
+		return fmt.Errorf("缩放后%s度无效: %d", axis, n)
+	case pad < 0 && n >= targetSize && pad == (targetSize-n)/2:
+		return nil // 中心裁剪
+	case pad >= 0 && n <= targetSize && pad == (targetSize-n)/2:
+		return nil // 填充到完整的正方形
+	case pad >= 0 && n <= targetSize && stride > 0 && pad == (targetSize-n)%stride/2:
+		return nil // -rect 最小矩形填充
+	}
+	return fmt.Errorf("缩放信息与输入尺寸 %d 不一致: 缩放后%s度 %d, 填充偏移 %d", targetSize, axis, n, pad)
+}
+
+// GetImageFromPool 从图像池中获取指定尺寸的图像，像素已清零
 func GetImageFromPool(width, height int) *image.RGBA {
+	img := getImageUncleared(width, height)
+	clear(img.Pix)
+	return img
+}
+
+// getImageUncleared 从图像池中获取指定尺寸的图像，不清零像素（内容为上次使用留下的数据）
+// 只用于随后会覆盖全部像素的场景（填充底色后绘制、整幅 draw.Src、逐像素 Set），省去一次整幅清零
+func getImageUncleared(width, height int) *image.RGBA {
 	key := imageSizeKey{width: width, height: height}
 
 	// 先尝试读取现有池
@@ -149,13 +186,7 @@ func GetImageFromPool(width, height int) *image.RGBA {
 		imagePoolMutex.Unlock()
 	}
 
-	// 从池中获取图像
-	img := pool.Get().(*image.RGBA)
-	// 清空图像数据
-	for i := range img.Pix {
-		img.Pix[i] = 0
-	}
-	return img
+	return pool.Get().(*image.RGBA)
 }
 
 // PutImageToPool 将图像归还到对应的尺寸池中
@@ -180,15 +211,278 @@ func PutImageToPool(img *image.RGBA) {
 // 主函数：程序入口点
 // 解析命令行参数，初始化配置，根据输入类型决定处理方式
 func main() {
-	// 设置环境变量确保UTF-8编码支持
-	os.Setenv("LC_ALL", "zh_CN.UTF-8")
+	// Windows 终端切换到 UTF-8 代码页，保证中文输出正常显示（其他平台无需处理）
+	setupConsoleUTF8()
+
+	// 命令行参数只在 main 中注册和解析一次，作为库使用时不会污染宿主程序的 flag.CommandLine
+	RegisterFlags(flag.CommandLine)
+	flag.CommandLine.Usage = printUsage(flag.CommandLine)
+
+	// 子命令：models list 列出内置（或 -model-manifest 指定的）模型清单及本地缓存状态
+	if len(os.Args) > 1 && os.Args[1] == "models" {
+		subcommand := ""
+		if len(os.Args) > 2 {
+			subcommand = os.Args[2]
+			flag.CommandLine.Parse(os.Args[3:])
+		}
+		if !runModelsCommand(subcommand) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 子命令：selftest 在内置图像上执行已知结果自检
+	if len(os.Args) > 1 && os.Args[1] == "selftest" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if err := resolveConfiguredModels(); err != nil {
+			fmt.Printf("FAIL: %v\n", err)
+			os.Exit(1)
+		}
+		if !runSelfTest() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 子命令：rectdiff 对比 letterbox 与 rect 预处理在同一会话上的检测差异
+	if len(os.Args) > 1 && os.Args[1] == "rectdiff" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if err := resolveConfiguredModels(); err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if !runRectDiff() {
+			os.Exit(1)
+		}
+		return
+	}
 
-	// 初始化图像池映射
-	imagePools = make(map[imageSizeKey]*sync.Pool)
+	// 子命令：query 在 -db 结果数据库上执行 SQL 查询
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		if !runQueryCommand(os.Args[2:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	os.Exit(run())
+}
 
-	flag.Parse()
+// run 解析参数并按输入类型处理，返回进程退出码（见 exit_codes.go）
+// 与 main 分开，保证 os.Exit 之前所有 defer（刷新结果输出、清理临时文件等）都已执行
+func run() int {
+	if !flag.Parsed() {
+		// 参数错误按启动失败返回退出码 1（flag 包默认以 2 退出，与“有图像处理失败”冲突）
+		flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+		if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitSetup
+		}
+	}
+	if err := setupResultFormat(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	purgeLogs()
+
+	// -cpuprofile/-memprofile 在 run 返回前（所有图像处理完成后）或中断退出前写入
+	if err := startProfiling(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	defer stopProfiling()
+
+	// -model 为模型名称（如 yolo11n）时按模型清单解析为本地缓存路径，必要时自动下载
+	if err := resolveConfiguredModels(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	if err := checkModelFiles(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	// 自定义模型的类别名称需要在校验 -classes 和告警规则之前读取
+	loadActiveClassNames()
 	fmt.Printf("使用参数: conf=%.2f, iou=%.2f, size=%d, rect=%t, augment=%t, batch=%d, workers=%d\n",
 		*confidenceThreshold, *iouThreshold, *modelInputSize, *useRectScaling, *useAugment, *batchSize, *workerCount)
+	fmt.Printf("%s\n", sessionOptionsSummary())
+
+	// 加载告警规则，规则无效时拒绝启动
+	if *alertRulesPath != "" {
+		engine, err := newAlertEngine(*alertRulesPath)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		alerts = engine
+	}
+
+	if err := validateNMSMethod(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	if err := validateResizeMode(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	if err := validateTTAOptions(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	if err := validateRateLimit(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+
+	switch *outputGuardMode {
+	case guardOff, guardLog, guardFail:
+	default:
+		fmt.Printf("不支持的输出检查模式: %s（支持 off, log, fail）\n", *outputGuardMode)
+		return exitSetup
+	}
+
+	// 类别过滤参数无效时拒绝启动
+	if _, err := parseClassFilter(*includeClasses, *excludeClasses); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	if _, err := parseDangerClasses(); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+
+	// 打开结果输出，中断信号到来时在截止时间内刷新并关闭
+	if *sinkSpecs != "" {
+		sinks, err := openSinks(*sinkSpecs)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		resultSinks = sinks
+	}
+	if *cocoOut != "" {
+		sink, err := newCOCOSink(*cocoOut)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		resultSinks.sinks = append(resultSinks.sinks, sink)
+	}
+	if *cvatOut != "" {
+		resultSinks.sinks = append(resultSinks.sinks, newCVATSink(*cvatOut, *inputImagePath))
+	}
+	if *labelStudioOut != "" {
+		resultSinks.sinks = append(resultSinks.sinks, newLabelStudioSink(*labelStudioOut, *inputImagePath))
+	}
+	if *resultDBPath != "" {
+		sink, err := newDBSink(*resultDBPath)
+		if err != nil {
+			fmt.Printf("打开结果数据库 %s 失败: %v\n", *resultDBPath, err)
+			return exitSetup
+		}
+		resultSinks.sinks = append(resultSinks.sinks, sink)
+	}
+	if *mqttBroker != "" {
+		sink, err := newMQTTSink()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		resultSinks.sinks = append(resultSinks.sinks, sink)
+	}
+	if *kafkaBrokers != "" {
+		sink, err := newKafkaSink()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		resultSinks.sinks = append(resultSinks.sinks, sink)
+	}
+	if *webhookURL != "" {
+		sink, err := newWebhookSink()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		resultSinks.sinks = append(resultSinks.sinks, sink)
+	}
+	if *onDetectCmd != "" {
+		hook, err := newDetectCommandHook()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		detectCommand = hook
+		defer func() {
+			if err := hook.Close(); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}()
+	}
+	handleShutdownSignals()
+	defer closeResultSinks()
+
+	// 监控服务：/metrics 和 /debug/vars
+	if *metricsAddr != "" {
+		server, err := startMetricsServer(*metricsAddr)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		defer server.Close()
+		fmt.Printf("监控服务已在 %s 启动（/metrics, /debug/vars）\n", *metricsAddr)
+	}
+	if *pprofAddr != "" {
+		server, err := startPprofServer(*pprofAddr)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		defer server.Close()
+		fmt.Printf("性能分析服务已在 %s 启动（/debug/pprof/）\n", *pprofAddr)
+	}
+	if *wsAddr != "" {
+		hub, server, err := startLiveServer(*wsAddr)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		liveHub = hub
+		defer hub.close()
+		defer server.Close()
+		fmt.Printf("实时推送服务已在 %s 启动（/ws）\n", *wsAddr)
+	}
+
+	// -serve / -grpc-addr / -redis-queue：作为 HTTP、gRPC 检测服务或 Redis 队列消费者运行，直到收到中断信号
+	if *redisQueue != "" && *redisAddr == "" {
+		fmt.Printf("-redis-queue 需要同时指定 -redis-addr\n")
+		return exitSetup
+	}
+	modes := 0
+	for _, set := range []bool{*serveAddr != "", *grpcAddr != "", *redisQueue != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		fmt.Printf("-serve、-grpc-addr 和 -redis-queue 只能指定一个\n")
+		return exitSetup
+	}
+	if *serveAddr != "" {
+		return runServer(*serveAddr)
+	}
+	if *grpcAddr != "" {
+		if runGRPCServer == nil {
+			fmt.Printf("%v\n", ErrNoGRPC)
+			return exitSetup
+		}
+		return runGRPCServer(*grpcAddr)
+	}
+	if *redisQueue != "" {
+		return runRedisConsumer()
+	}
 
 	// 创建默认输出目录
 	defaultOutputDir := "./assets"
@@ -196,20 +490,142 @@ func main() {
 		err = os.Mkdir(defaultOutputDir, 0755)
 		if err != nil {
 			fmt.Printf("创建输出目录失败: %v\n", err)
-			return
+			return exitSetup
 		}
 	}
 
-	// 获取所有图像路径
+	defer cleanupDownloads()
+
+	// -output 为 s3:// 路径时，批量处理的标注图像按 -s3-key-template 上传到该前缀下
+	if isS3Path(*outputImagePath) {
+		defaultOutputDir = *outputImagePath
+	}
+
+	// -img -：从标准输入读取图像路径。检测时边读边处理，分类需要写出完整的结果文件，先读完整个列表
+	if *inputImagePath == stdinInput {
+		if err := validateOptionScopes(runContext{set: explicitFlags(flag.CommandLine)}); err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		if *taskType == taskClassify {
+			imagePaths, err := readStdinImagePaths()
+			if err == nil {
+				err = runClassification(imagePaths)
+			}
+			if err != nil {
+				fmt.Printf("分类处理出错: %v\n", err)
+				outcome.fail()
+			}
+			return outcome.exitCode()
+		}
+		defer cleanupFont()
+		if err := ConcurrentStreamProcessImages(defaultOutputDir); err != nil {
+			fmt.Printf("批量处理出错: %v\n", err)
+			outcome.fail()
+		}
+		fmt.Printf("所有图像处理完成\n")
+		return outcome.exitCode()
+	}
+
+	// -img rtsp://...：持续检测视频流，断流时自动重连，直到收到中断信号
+	if isStreamInput(*inputImagePath) {
+		if err := validateOptionScopes(runContext{set: explicitFlags(flag.CommandLine), stream: true}); err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		if *taskType == taskClassify {
+			fmt.Printf("视频流输入不支持 -task classify\n")
+			return exitSetup
+		}
+		if err := ProcessStream(*inputImagePath); err != nil {
+			fmt.Printf("视频流处理出错: %v\n", err)
+			outcome.fail()
+		}
+		return outcome.exitCode()
+	}
+
+	// -img camera:N：持续检测本地摄像头，-img camera:list 列出可用的摄像头
+	if isCameraInput(*inputImagePath) {
+		if *inputImagePath == cameraListInput {
+			if err := printCameras(); err != nil {
+				fmt.Printf("列出摄像头失败: %v\n", err)
+				return exitSetup
+			}
+			return exitOK
+		}
+		if err := validateOptionScopes(runContext{set: explicitFlags(flag.CommandLine), camera: true}); err != nil {
+			fmt.Printf("%v\n", err)
+			return exitSetup
+		}
+		if *taskType == taskClassify {
+			fmt.Printf("摄像头输入不支持 -task classify\n")
+			return exitSetup
+		}
+		if err := ProcessCamera(*inputImagePath, defaultOutputDir); err != nil {
+			fmt.Printf("摄像头处理出错: %v\n", err)
+			outcome.fail()
+		}
+		return outcome.exitCode()
+	}
+
+	// 获取所有图像路径（压缩包输入在退出前关闭并清理临时文件）
+	defer cleanupArchives()
 	imagePaths, err := getImagePaths(*inputImagePath)
 	if err != nil {
 		fmt.Printf("获取图像路径失败: %v\n", err)
-		return
+		return exitSetup
 	}
 
-	if len(imagePaths) == 0 {
+	// 视频文件逐帧解码检测，与图像分开处理
+	imagePaths, videoPaths := splitVideoPaths(imagePaths)
+	if len(imagePaths) == 0 && len(videoPaths) == 0 {
 		fmt.Printf("未找到任何图像文件\n")
-		return
+		return exitSetup
+	}
+
+	// 交叉校验：指定了在当前模式下不会生效或互相矛盾的参数时，-strict 拒绝启动，否则只警告
+	if err := validateOptionScopes(runContext{
+		set:         explicitFlags(flag.CommandLine),
+		singleImage: inputIsSingleImage(imagePaths) && len(videoPaths) == 0,
+		video:       len(videoPaths) > 0,
+	}); err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+
+	// 分类模式：并发分类所有图像，结果写入 CSV/JSON 而不是标注图像
+	if *taskType == taskClassify {
+		if len(videoPaths) > 0 {
+			fmt.Printf("提示：分类模式不处理视频文件，已跳过 %d 个\n", len(videoPaths))
+		}
+		if len(imagePaths) == 0 {
+			fmt.Printf("未找到任何图像文件\n")
+			return exitSetup
+		}
+		if err := runClassification(imagePaths); err != nil {
+			fmt.Printf("分类处理出错: %v\n", err)
+			outcome.fail()
+		}
+		return outcome.exitCode()
+	}
+
+	// 中文字体和单图检测会话在进程内只初始化一次，退出前统一释放
+	if err := ensureChineseFont(); err != nil {
+		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
+	} else {
+		defer cleanupFont()
+	}
+	defer destroySharedSession()
+
+	if len(videoPaths) > 0 {
+		if err := ProcessVideoFiles(videoPaths, defaultOutputDir); err != nil {
+			fmt.Printf("视频处理出错: %v\n", err)
+			outcome.fail()
+		}
+		if len(imagePaths) == 0 || outcome.interrupted.Load() {
+			fmt.Printf("所有视频处理完成\n")
+			return outcome.exitCode()
+		}
 	}
 
 	// 检查输入是否是目录
@@ -224,16 +640,22 @@ func main() {
 
 		// 如果输出路径为空，则自动生成带模型标识的路径
 		outputPath := *outputImagePath
-		if outputPath == "" || outputPath == "../yolo/camera/3_11x_false.jpg" {
-			modelIdentifier := getModelIdentifier(modelPath)
-			imgName := filepath.Base(imagePaths[0])
-			ext := filepath.Ext(imgName)
-			fileNameWithoutExt := imgName[:len(imgName)-len(ext)]
-			outputPath = filepath.Join("./assets", fileNameWithoutExt+"_"+modelIdentifier+"_"+strconv.Itoa(rand.IntN(10000))+ext)
+		// 以 / 结尾的 s3:// 路径是前缀，对象键按 -s3-key-template 生成；生成的路径已存在时按 -overwrite / -no-clobber 处理
+		generated := outputPath == "" || outputPath == "../yolo/camera/3_11x_false.jpg" || isS3Path(outputPath) && strings.HasSuffix(outputPath, "/")
+		if generated {
+			outputDir := "./assets"
+			if isS3Path(outputPath) {
+				outputDir = outputPath
+			}
+			outputPath = outputPathsFor(outputDir, "", imagePaths[:1], getModelIdentifier(modelPaths()[0]))[0]
+			if outputCollisionMode() == collisionNoClobber && skipOutput(imagePaths[0], outputPath) {
+				return exitOK
+			}
 		}
 
 		// 执行检测
 		num, desc, err := detectImage(imagePaths[0], outputPath)
+		outcome.record(DetectionResult{DetectionRecord: DetectionRecord{DangerCount: num}}, err)
 		if err != nil {
 			fmt.Printf("处理图像 %s 时出错: %v\n", imagePaths[0], err)
 		} else {
@@ -245,6 +667,7 @@ func main() {
 		err := ProcessImageDirectory(*inputImagePath, defaultOutputDir)
 		if err != nil {
 			fmt.Printf("处理目录时出错: %v\n", err)
+			outcome.fail()
 		} else {
 			fmt.Printf("目录处理完成\n")
 		}
@@ -253,23 +676,19 @@ func main() {
 		fmt.Printf("找到 %d 个图像文件，将使用并发处理（工作协程: %d）\n", len(imagePaths), *workerCount)
 
 		// 生成输出路径列表，添加模型标识
-		modelIdentifier := getModelIdentifier(modelPath)
-		outputPaths := make([]string, len(imagePaths))
-		for i, imagePath := range imagePaths {
-			imgName := filepath.Base(imagePath)
-			ext := filepath.Ext(imgName)
-			fileNameWithoutExt := imgName[:len(imgName)-len(ext)]
-			outputPaths[i] = filepath.Join(defaultOutputDir, fileNameWithoutExt+"_"+modelIdentifier+"_"+strconv.Itoa(rand.IntN(10000))+ext)
-		}
+		modelIdentifier := getModelIdentifier(modelPaths()[0])
+		outputPaths := outputPathsFor(defaultOutputDir, structureRoot(*inputImagePath), imagePaths, modelIdentifier)
 
 		// 使用并发处理图像
 		err := ConcurrentBatchProcessImages(imagePaths, outputPaths)
 		if err != nil {
 			fmt.Printf("批量处理出错: %v\n", err)
+			outcome.fail()
 		}
 	}
 
 	fmt.Printf("所有图像处理完成\n")
+	return outcome.exitCode()
 }
 
 // 多协程批量处理图片的函数
@@ -278,11 +697,19 @@ func ConcurrentBatchProcessImages(sourceImagePaths []string, outputImagePaths []
 		return fmt.Errorf("输入图片路径数量(%d)与输出图片路径数量(%d)不匹配", len(sourceImagePaths), len(outputImagePaths))
 	}
 
+	// -skip-existing：跳过上次运行已保存输出的图像
+	sourceImagePaths, outputImagePaths, skipped := pendingOutputs(sourceImagePaths, outputImagePaths)
+	if skipped > 0 {
+		fmt.Printf("跳过 %d 个已有输出的图像（-skip-existing），剩余 %d 个待处理\n", skipped, len(sourceImagePaths))
+	}
+	if len(sourceImagePaths) == 0 {
+		fmt.Printf("批量处理完成: 跳过 %d，处理 0\n", skipped)
+		return nil
+	}
+
 	// 初始化中文字体
-	if err := initChineseFont(); err != nil {
+	if err := ensureChineseFont(); err != nil {
 		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
-	} else {
-		defer cleanupFont()
 	}
 
 	fmt.Printf("启动并发处理，工作协程数量: %d, 队列大小: %d\n", *workerCount, *queueSize)
@@ -291,82 +718,146 @@ func ConcurrentBatchProcessImages(sourceImagePaths []string, outputImagePaths []
 	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
 	defer manager.Stop()
 
-	// 创建任务列表
-	imagePaths := make([]string, len(sourceImagePaths))
-	copy(imagePaths, sourceImagePaths)
-
-	// 提交所有任务
-	results := manager.ProcessImageBatch(imagePaths)
+	// 收到中断信号时取消批量处理，已完成的图像照常绘制保存并输出汇总
+	ctx, release := interruptibleContext()
+	defer release()
 
-	// 处理结果并保存检测结果
+	// 推理结果按输入顺序交给独立的绘制/编码协程，推理工作协程不等待编码
+	// -result-format jsonl 时每张图像保存完成（或检测失败）后立即输出一行，按完成顺序
+	renders := newRenderPool(*renderWorkers, len(sourceImagePaths), func(job renderJob, err error, elapsed time.Duration) {
+		emitJSONL(job.result, job.outputPath, err, elapsed)
+		if err == nil {
+			runDetectHook(job.result, job.outputPath)
+		}
+	})
+	results := make([]DetectionResult, len(sourceImagePaths))
+	progress := newCLIProgress()
+	start := time.Now()
+	manager.ProcessImageBatchProgress(ctx, sourceImagePaths, progress.Func(), func(i int, result DetectionResult) {
+		results[i] = result
+		if errors.Is(result.Error, context.Canceled) {
+			return // 未处理的图像不写入结果输出，重新运行时可以补上
+		}
+		resultSinks.WriteResult(result)
+		if result.Error != nil {
+			emitJSONL(result, "", nil, 0)
+			return
+		}
+		renders.Submit(renderJob{index: i, result: result, outputPath: outputImagePaths[i]})
+	})
+	renders.Wait()
+	wall := time.Since(start)
+	progress.Finish()
+
+	// 按输入顺序输出处理结果
+	timings := newStageTimings("推理", "绘制保存")
+	completed := make([]DetectionResult, 0, len(results))
+	failures, renderFailures := 0, 0
 	for i, result := range results {
+		if errors.Is(result.Error, context.Canceled) {
+			continue
+		}
+		completed = append(completed, result)
+		outcome.record(result, renders.errs[i])
+		timings.Add("推理", result.Elapsed)
 		if result.Error != nil {
+			failures++
 			fmt.Printf("处理图像 %s 时出错: %v\n", result.ImagePath, result.Error)
-		} else {
-			outputPath := outputImagePaths[i]
-
-			// 将检测结果绘制到图像
-			originalPic, err := loadImageFile(result.ImagePath)
-			if err != nil {
-				fmt.Printf("加载原图失败 %s: %v\n", result.ImagePath, err)
-				continue
-			}
-
-			err = drawBoundingBoxesWithLabels(originalPic, result.Objects, outputPath)
-			if err != nil {
-				fmt.Printf("绘制边界框失败 %s: %v\n", result.ImagePath, err)
-				continue
-			}
-
-			fmt.Printf("图像 %s 检测完成: %d 个对象，已保存至 %s\n", result.ImagePath, len(result.Objects), outputPath)
+			continue
+		}
+		timings.Add("绘制保存", renders.elapsed[i])
+		if err := renders.errs[i]; err != nil {
+			failures++
+			renderFailures++
+			fmt.Printf("保存图像 %s 失败: %v\n", result.ImagePath, err)
+			continue
 		}
+		fmt.Printf("图像 %s 检测完成: %d 个对象 - %s，已保存至 %s\n", result.ImagePath, len(result.Objects), result.Summary, outputImagePaths[i])
+	}
+
+	// 输出汇总、各阶段耗时、工作协程利用率和调优建议
+	fmt.Printf("批量处理完成: %s\n", batchSummary(completed, wall, failures))
+	if skipped > 0 {
+		fmt.Printf("跳过 %d，处理 %d\n", skipped, len(completed))
 	}
+	fmt.Printf("%s\n", timings)
+	printManagerStats(manager)
 
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("批量处理已取消: %s", canceledSummary(results))
+	}
+	if renderFailures > 0 {
+		return fmt.Errorf("%d 个图像绘制或保存失败", renderFailures)
+	}
 	return nil
 }
 
+// printManagerStats 输出工作协程利用率和调优建议、模型输出异常和会话替换情况
+func printManagerStats(manager *VideoDetectorManager) {
+	stats := manager.GetStats()
+	fmt.Printf("%s\n", stats.Recommendation())
+	if len(stats.OutputAnomalies) > 0 {
+		fmt.Printf("模型输出异常: %s\n", formatAnomalyCounts(stats.OutputAnomalies))
+	}
+	if stats.SessionsReplaced > 0 {
+		fmt.Printf("替换了 %d 个故障会话（连续推理失败达到 -session-max-failures %d 次或任务超时）\n", stats.SessionsReplaced, *sessionMaxFailures)
+	}
+}
+
 // 获取输入源的所有图像路径
-// 支持多种输入类型：单个图像、目录（一级）、文本文件列表
-// inputSource: 输入源路径（文件/目录/.txt文件）
+// 支持多种输入类型：单个图像、目录（一级）、文本文件列表、通配符模式（见 expandImageGlob）、http(s) URL；
+// 单个文件、目录和通配符中的视频文件同样返回
+// inputSource: 输入源路径（文件/目录/.txt文件/通配符模式）
 // return: 图像路径列表 + 错误信息
 func getImagePaths(inputSource string) ([]string, error) {
 	var imagePaths []string
 
 	// 优先判断是否是.txt文件（解决os.Stat失败后仍尝试读取的问题）
 	if strings.HasSuffix(strings.ToLower(inputSource), ".txt") {
-		// 使用bufio.Scanner读取行，兼容不同系统换行符（\n/\r\n）
 		file, err := os.Open(inputSource)
 		if err != nil {
 			return nil, fmt.Errorf("打开文本文件失败: %v", err)
 		}
 		defer file.Close() // 确保文件句柄关闭
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" {
-				// 可选：验证文本文件中的路径是否存在
-				if _, err := os.Stat(line); err != nil {
-					fmt.Printf("警告：文本文件中的路径 %s 不存在，已跳过\n", line)
-					continue
-				}
-				imagePaths = append(imagePaths, line)
-			}
+		err = scanImageList(file, "文本文件", func(path string) bool {
+			imagePaths = append(imagePaths, path)
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("读取文本文件内容失败: %v", err)
 		}
+		return imagePaths, nil
+	}
 
-		// 检查scanner是否出错
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("读取文本文件内容失败: %v", err)
+	// http(s) URL 在处理时下载
+	if isURLInput(inputSource) {
+		return []string{inputSource}, nil
+	}
+
+	// s3:// 路径：单个对象或按前缀列出的图像，同样在处理时下载
+	if isS3Path(inputSource) {
+		imagePaths, err := listS3Images(inputSource)
+		if err != nil {
+			return nil, fmt.Errorf("列出 S3 图像失败: %w", err)
 		}
 		return imagePaths, nil
 	}
 
-	// 检查输入源是否存在（非.txt文件）
+	// 检查输入源是否存在（非.txt文件），不存在且含通配符时按模式展开
 	fileInfo, err := os.Stat(inputSource)
+	if err != nil && isGlobPattern(inputSource) {
+		return expandImageGlob(inputSource)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("输入源不存在: %v", err)
 	}
 
+	if !fileInfo.IsDir() && isArchivePath(inputSource) {
+		// 输入源是压缩包（zip/tar/tar.gz），包括子目录中的图像
+		return listArchiveImages(inputSource)
+	}
+
 	if fileInfo.IsDir() {
 		// 输入源是目录，遍历一级目录中的图像文件
 		entries, err := os.ReadDir(inputSource)
@@ -382,22 +873,17 @@ func getImagePaths(inputSource string) ([]string, error) {
 			filePath := filepath.Join(inputSource, entry.Name())
 			ext := strings.ToLower(filepath.Ext(entry.Name()))
 
-			if supportedImageExts[ext] {
+			// 视频文件一并返回，由调用方用 splitVideoPaths 分出后逐帧检测
+			if supportedImageExts[ext] || supportedVideoExts[ext] {
 				imagePaths = append(imagePaths, filePath)
-			} else if supportedVideoExts[ext] {
-				// 视频文件提示并跳过，明确告知调用方
-				fmt.Printf("提示：视频文件 %s 暂不支持，已跳过（功能待实现）\n", filePath)
 			}
 		}
 	} else {
 		// 输入源是单个文件
 		ext := strings.ToLower(filepath.Ext(inputSource))
 
-		if supportedImageExts[ext] {
+		if supportedImageExts[ext] || supportedVideoExts[ext] {
 			imagePaths = append(imagePaths, inputSource)
-		} else if supportedVideoExts[ext] {
-			// 视频文件明确返回警告（非错误），避免调用方误解
-			fmt.Printf("提示：视频文件 %s 暂不支持（功能待实现）\n", inputSource)
 		} else {
 			return nil, fmt.Errorf("不支持的文件类型: %s（仅支持%v图像格式和%v视频格式）",
 				ext, getKeys(supportedImageExts), getKeys(supportedVideoExts))
@@ -486,8 +972,8 @@ func ProcessImageDirectory(inputDir, outputDir string) error {
 		return fmt.Errorf("输入目录不存在: %v", err)
 	}
 
-	// 创建输出目录
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
+	// 创建输出目录（s3:// 前缀不需要创建）
+	if _, err := os.Stat(outputDir); os.IsNotExist(err) && !isS3Path(outputDir) {
 		err = os.MkdirAll(outputDir, 0755)
 		if err != nil {
 			return fmt.Errorf("创建输出目录失败: %v", err)
@@ -499,54 +985,16 @@ func ProcessImageDirectory(inputDir, outputDir string) error {
 	if err != nil {
 		return fmt.Errorf("获取目录中图像路径失败: %v", err)
 	}
+	imagePaths, _ = splitVideoPaths(imagePaths) // 目录中的视频文件由 ProcessVideoFiles 处理
 
-	// 生成输出路径列表，保留原始图片名称并加上模型标识和随机数以区分并发处理
-	modelIdentifier := getModelIdentifier(modelPath)
-	outputPaths := make([]string, len(imagePaths))
-	for i, imagePath := range imagePaths {
-		imgName := filepath.Base(imagePath)
-		ext := filepath.Ext(imgName)
-		fileNameWithoutExt := imgName[:len(imgName)-len(ext)]
-		outputPaths[i] = filepath.Join(outputDir, fileNameWithoutExt+"_"+modelIdentifier+"_"+strconv.Itoa(rand.IntN(10000))+"_"+strconv.Itoa(i)+ext)
-	}
+	// 按 -output-template 生成输出路径列表，默认保留原始图片名称并加上模型标识和输入路径的哈希，重新运行时输出路径不变
+	modelIdentifier := getModelIdentifier(modelPaths()[0])
+	outputPaths := outputPathsFor(outputDir, inputDir, imagePaths, modelIdentifier)
 
 	// 使用并发处理图像
 	return ConcurrentBatchProcessImages(imagePaths, outputPaths)
 }
 
-// 写入日志文件
-// 记录程序运行过程中的重要事件和错误信息
-func writeLogFile(level, message string) {
-	// 创建logs目录
-	logDir := "./logs"
-	if _, err := os.Stat(logDir); os.IsNotExist(err) {
-		err = os.Mkdir(logDir, 0755)
-		if err != nil {
-			fmt.Printf("创建日志目录失败: %v\n", err)
-			return
-		}
-	}
-
-	// 生成日志文件名（按日期）
-	logFileName := fmt.Sprintf("%s/log_%s.txt", logDir, time.Now().Format("2006-01-02"))
-
-	// 打开或创建日志文件
-	logFile, err := os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		fmt.Printf("打开日志文件失败: %v\n", err)
-		return
-	}
-	defer logFile.Close()
-
-	// 写入日志内容
-	logEntry := fmt.Sprintf("%s %s %s\n", time.Now().Format("2006-01-02 15:04:05"), level, message)
-	_, err = logFile.WriteString(logEntry)
-	if err != nil {
-		fmt.Printf("写入日志失败: %v\n", err)
-		return
-	}
-}
-
 // 获取区域平均颜色（用于系统文本背景）
 // 用于在不同背景上显示系统文本时提供合适的背景色
 func getAreaAverageColor(img *image.RGBA, rect image.Rectangle) color.RGBA {
@@ -661,6 +1109,14 @@ func drawSystemText(img *image.RGBA, location string) {
 	drawText(img, textX, textY, text, textColor)
 }
 
+// ensureChineseFont 初始化中文字体（进程内只执行一次），由 main 在退出时调用 cleanupFont 释放
+func ensureChineseFont() error {
+	chineseFontOnce.Do(func() {
+		chineseFontErr = initChineseFont()
+	})
+	return chineseFontErr
+}
+
 // initChineseFont 初始化中文字体
 // 查找系统中可用的中文字体文件并加载
 func initChineseFont() error {
@@ -725,102 +1181,110 @@ func cleanupFont() {
 	}
 }
 
-// getChineseLabel 获取中文标签
-// 将英文标签转换为对应的中文标签
-func getChineseLabel(englishLabel string) string {
-	if chinese, exists := detectLabelMap[englishLabel]; exists {
-		return chinese
-	}
-	return englishLabel
-}
-
 // 图片检测输出结果 输入图片地址 输出检测结果中的对象描述:对象个数;描述:对象1是*,置信度;错误信息
 // 核心检测函数，执行完整的检测流程
+// 保留原有签名：使用进程内共享的会话，首次调用时创建，多次调用不再重复加载模型
 func detectImage(inputImagePath, outputImagePath string) (int, string, error) {
-	os.Setenv("LC_ALL", "zh_CN.UTF-8")
-	if err := initChineseFont(); err != nil {
-		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
-	} else {
-		defer cleanupFont()
+	sharedSessionMutex.Lock()
+	defer sharedSessionMutex.Unlock()
+	if sharedSession == nil {
+		session, err := initSession()
+		if err != nil {
+			return 0, "", err
+		}
+		sharedSession = session
+	}
+	return detectImageWithSession(sharedSession, inputImagePath, outputImagePath)
+}
+
+// destroySharedSession 销毁 detectImage 使用的共享会话，在程序退出前调用
+func destroySharedSession() {
+	sharedSessionMutex.Lock()
+	defer sharedSessionMutex.Unlock()
+	if sharedSession != nil {
+		sharedSession.Destroy()
+		sharedSession = nil
 	}
+}
 
+// detectImageWithSession 使用调用方提供的会话检测单张图像并保存标注结果
+// 会话不是并发安全的，同一会话被同时使用时返回 ErrSessionBusy
+func detectImageWithSession(modelSession inferenceSession, inputImagePath, outputImagePath string) (int, string, error) {
 	originalPic, e := loadImageFile(inputImagePath)
 	if e != nil {
+		resultSinks.WriteResult(failedResult(inputImagePath, e))
 		return 0, "", e
 	}
-	originalWidth := originalPic.Bounds().Dx()
-	originalHeight := originalPic.Bounds().Dy()
 
-	modelSession, e := initSession()
+	detectStart := time.Now()
+	record, e := runDetection(context.Background(), modelSession, inputImagePath, originalPic, newDetectionConfig())
 	if e != nil {
+		resultSinks.WriteResult(failedResult(inputImagePath, e))
 		return 0, "", e
 	}
-	defer modelSession.Destroy()
-
-	var allBoxes []boundingBox
-
-	if *useAugment {
-		// 原图
-		scaleInfo, e := prepareInput(originalPic, modelSession.Input)
-		if e != nil {
-			return 0, "", e
-		}
-		modelSession.Session.Run()
-		originalBoxes := processOutput(modelSession.Output.GetData(), originalWidth, originalHeight,
-			float32(*confidenceThreshold), float32(*iouThreshold), scaleInfo)
-		allBoxes = append(allBoxes, originalBoxes...)
-
-		// 水平翻转图像
-		flippedPic := flipHorizontal(originalPic)
-		scaleInfo, e = prepareInput(flippedPic, modelSession.Input)
-		if e == nil {
-			modelSession.Session.Run()
-			flippedBoxes := processOutput(modelSession.Output.GetData(), originalWidth, originalHeight,
-				float32(*confidenceThreshold), float32(*iouThreshold), scaleInfo)
-			for i := range flippedBoxes {
-				flippedBoxes[i] = flipBoundingBox(flippedBoxes[i], originalWidth)
-			}
-			allBoxes = append(allBoxes, flippedBoxes...)
-		}
+	resultSinks.WriteResult(DetectionResult{DetectionRecord: record})
+	writeLogFile("INFO", fmt.Sprintf("图像 %s 检测耗时 %v", inputImagePath, time.Since(detectStart)))
 
-		// 合并框并 NMS
-		if len(allBoxes) > 0 {
-			allBoxes = nonMaxSuppression(allBoxes, float32(*iouThreshold))
-		}
-	} else {
-		scaleInfo, e := prepareInput(originalPic, modelSession.Input)
-		if e != nil {
-			return 0, "", e
-		}
-		modelSession.Session.Run()
-		allBoxes = processOutput(modelSession.Output.GetData(), originalWidth, originalHeight,
-			float32(*confidenceThreshold), float32(*iouThreshold), scaleInfo)
+	annotated := Annotate(originalPic, record.Objects)
+	e = saveJPEG(annotated, outputImagePath)
+	PutImageToPool(annotated)
+	if e == nil {
+		e = writeDetectionJSON(record, outputImagePath)
 	}
+	if e == nil {
+		e = writeYOLOLabels(record, outputImagePath)
+	}
+	if e != nil {
+		return record.DangerCount, record.Summary, e
+	}
+	runDetectHook(DetectionResult{DetectionRecord: record}, outputImagePath)
+
+	return record.DangerCount, record.Summary, nil
+}
 
+// 生成检测结果摘要：危险对象个数及描述
+// 危险类别由 -danger-classes 决定（danger 为 nil 时所有类别都是危险类别），传入的 boxes 已经过 -classes 过滤；
+// 区分"没有任何检测结果"和"有检测结果但不含危险对象"两种情况
+func summarizeDetections(boxes []boundingBox, danger *classFilter) (int, string) {
+	if len(boxes) == 0 {
+		return 0, "未检测到任何对象"
+	}
 	var outObjectStr string
-	var num int
-	for _, box := range allBoxes {
-		if checkStrIsInArray(box.label, []string{"person", "car", "motorcycle", "bus", "truck"}) {
-			num++
-			chineseLabel := getChineseLabel(box.label)
-			//confStr := fmt.Sprintf("%.2f", float32(math.Round(float64(box.confidence*100))/100))
-			confStr := fmt.Sprintf("%.6f", box.confidence)
-			boxXYStr := fmt.Sprintf("%.6f %.6f %.6f %.6f", box.x1, box.y1, box.x2, box.y2)
-			outObjectStr += "对象" + strconv.Itoa(num) + ": " + box.label + "(" + chineseLabel + ")" + ", 置信度: " + confStr + " ,框：[" + boxXYStr + "] ; "
-		}
-	}
-	if num > 0 {
-		outObjectStr = " AI分析到危险对象共有 " + strconv.Itoa(num) + " 个, " + outObjectStr
-	} else {
-		outObjectStr = "未检测到危险对象"
+	num := 0
+	for _, box := range boxes {
+		if !danger.allows(box.label) {
+			continue
+		}
+		num++
+		chineseLabel := ChineseLabel(box.label)
+		confStr := formatConfidence(box.confidence)
+		boxXYStr := fmt.Sprintf("%.6f %.6f %.6f %.6f", box.x1, box.y1, box.x2, box.y2)
+		outObjectStr += "对象" + strconv.Itoa(num) + ": " + box.label + "(" + chineseLabel + ")" + ", 置信度: " + confStr + " ,框：[" + boxXYStr + "]"
+		if len(box.keypoints) > 0 {
+			kpStrs := make([]string, len(box.keypoints))
+			for k, kp := range box.keypoints {
+				kpStrs[k] = fmt.Sprintf("%.1f %.1f %s", kp.x, kp.y, formatConfidence(kp.conf))
+			}
+			outObjectStr += " ,关键点：[" + strings.Join(kpStrs, "; ") + "]"
+		}
+		outObjectStr += " ; "
 	}
-
-	e = drawBoundingBoxesWithLabels(originalPic, allBoxes, outputImagePath)
-	if e != nil {
-		return num, outObjectStr, e
+	if num == 0 {
+		return 0, "未检测到危险对象（检测到其他对象 " + strconv.Itoa(len(boxes)) + " 个）"
 	}
+	return num, " AI分析到危险对象共有 " + strconv.Itoa(num) + " 个, " + outObjectStr
+}
 
-	return num, outObjectStr, nil
+// capDetections 按置信度只保留前 maxDet 个检测框（默认为 -max-det），0 表示不限制
+// 在绘制、掩码解码和摘要之前截断，避免低阈值时成千上万个框拖慢后续处理
+func capDetections(boxes []boundingBox, maxDet int) []boundingBox {
+	if maxDet <= 0 || len(boxes) <= maxDet {
+		return boxes
+	}
+	sort.SliceStable(boxes, func(i, j int) bool {
+		return boxes[i].confidence > boxes[j].confidence
+	})
+	return boxes[:maxDet]
 }
 
 // 安全的ONNX Runtime环境初始化函数
@@ -832,9 +1296,9 @@ func initializeORTEnvironment() error {
 	if ortInitialized {
 		return nil
 	}
-	libPath := getSharedLibPath()
-	if libPath == "" {
-		return errors.New("未找到ONNX Runtime库，请确保已安装ONNX Runtime或在third_party目录中放置了相应的库文件")
+	libPath, err := getSharedLibPath()
+	if err != nil {
+		return err
 	}
 	ort.SetSharedLibraryPath(libPath)
 	if err := ort.InitializeEnvironment(); err != nil {
@@ -847,14 +1311,127 @@ func initializeORTEnvironment() error {
 type ModelSession struct {
 	Session *ort.AdvancedSession
 	Input   *ort.Tensor[float32]
-	Output  *ort.Tensor[float32]
+	Output  *ort.Tensor[float32]   // 主输出（output0），等同于 Outputs[0]
+	Outputs []*ort.Tensor[float32] // 全部输出张量（分割模型的 output1 为原型掩码）
+	Layout  outputLayout           // 输出张量排布
+	Name    string                 // 模型标识（文件名），用于标注集成推理中各检测框的来源
+
+	// 多模型集成推理（-model 指定多个模型）时的其他模型会话，与主会话使用相同的预处理输入
+	Members []*ModelSession
+
+	generation int64 // 创建会话时会话池的模型代数，热加载后旧代会话归还时直接销毁
+	failures   int   // 连续推理失败次数，由会话池在归还时更新（见 PutSessionFailed）
+	// 推理尝试次数（含重试），由 runRetry 累加，工作协程在每个任务开始前清零
+	runAttempts int
+
+	path   string // 模型文件路径
+	probed bool   // 是否已在首次推理后探测过输出排布
+	probe  string // 输出排布探测结论，附加到结果元数据
+
+	busy atomic.Bool // 是否正在被某个协程使用，见 acquire
+
+	// float16 模型绑定到会话的半精度张量；非空时 Input/Outputs 仅作为 float32 中转缓冲
+	halfInput   *ort.CustomDataTensor
+	halfOutputs []*ort.CustomDataTensor
+}
+
+// Run 执行推理；float16 模型在推理前后自动完成 float32 与 float16 之间的转换
+// 会话不是并发安全的：另一个协程正在使用该会话时返回 ErrSessionBusy
+func (m *ModelSession) Run() error {
+	if err := m.acquire(); err != nil {
+		return err
+	}
+	defer m.release()
+	return m.run()
+}
+
+// run 执行推理，调用方需已通过 acquire 取得会话的使用权
+func (m *ModelSession) run() error {
+	if m.halfInput == nil {
+		return m.Session.Run()
+	}
+	encodeFloat16(m.halfInput.GetData(), m.Input.GetData())
+	if err := m.Session.Run(); err != nil {
+		return err
+	}
+	for i, half := range m.halfOutputs {
+		decodeFloat16(m.Outputs[i].GetData(), half.GetData())
+	}
+	return nil
+}
+
+// input 返回输入张量的数据（float16 模型为 float32 中转缓冲）
+func (m *ModelSession) input() []float32 {
+	return m.Input.GetData()
+}
+
+// output 返回主输出张量的数据
+func (m *ModelSession) output() []float32 {
+	return m.Output.GetData()
+}
+
+// layout 返回主输出的排布
+func (m *ModelSession) layout() outputLayout {
+	return m.Layout
+}
+
+// inspectOutput 首次推理后探测输出排布，并按 -output-guard 检查输出
+func (m *ModelSession) inspectOutput(output []float32) error {
+	probeSessionLayout(m, output)
+	return checkSessionOutput(m, output)
+}
+
+// attachMasks 分割模型根据原型掩码为检测框附加掩码
+func (m *ModelSession) attachMasks(boxes []boundingBox, scaleInfo ScaleInfo) {
+	attachSessionMasks(m, 0, boxes, scaleInfo)
+}
+
+// fuseMembers 配置了多个模型时在成员会话上推理并融合结果，否则原样返回 boxes
+func (m *ModelSession) fuseMembers(boxes []boundingBox, width, height int, scaleInfo ScaleInfo, cfg DetectionConfig) ([]boundingBox, error) {
+	if len(m.Members) == 0 {
+		return boxes, nil
+	}
+	return inferEnsembleBoxes(m, boxes, width, height, scaleInfo, cfg)
+}
+
+// Warmup 使用全零输入执行 n 次推理预热会话（包括集成推理的其他模型），返回预热耗时
+func (m *ModelSession) Warmup(n int) (time.Duration, error) {
+	if err := m.acquire(); err != nil {
+		return 0, err
+	}
+	defer m.release()
+
+	start := time.Now()
+	for _, session := range append([]*ModelSession{m}, m.Members...) {
+		clear(session.Input.GetData())
+		for i := 0; i < n; i++ {
+			if err := session.run(); err != nil {
+				return time.Since(start), fmt.Errorf("%s 第 %d 次预热推理失败: %w", session.Name, i+1, err)
+			}
+		}
+	}
+	return time.Since(start), nil
 }
 
 func (m *ModelSession) Destroy() {
+	for _, member := range m.Members {
+		member.Destroy()
+	}
 	if m.Input != nil {
 		m.Input.Destroy()
 	}
-	if m.Output != nil {
+	if m.halfInput != nil {
+		m.halfInput.Destroy()
+	}
+	for _, output := range m.halfOutputs {
+		output.Destroy()
+	}
+	for _, output := range m.Outputs {
+		if output != nil {
+			output.Destroy()
+		}
+	}
+	if len(m.Outputs) == 0 && m.Output != nil {
 		m.Output.Destroy()
 	}
 	if m.Session != nil {
@@ -869,10 +1446,18 @@ type boundingBox struct {
 	confidence float32 // 检测置信度（0-1之间）
 	x1, y1     float32 // 边界框左上角坐标
 	x2, y2     float32 // 边界框右下角坐标
+	model      string  // 产生该检测框的模型（仅多模型集成推理时设置）
+
+	// 实例分割（-task seg）时使用
+	maskCoeffs []float32    // 掩码系数
+	mask       *image.Alpha // 二值实例掩码，范围为边界框区域（原图坐标）
+
+	// 姿态估计（-task pose）时使用
+	keypoints []keypoint // 关键点（原图坐标）
 }
 
 func (b *boundingBox) String() string {
-	chineseLabel := getChineseLabel(b.label)
+	chineseLabel := ChineseLabel(b.label)
 	return fmt.Sprintf("对象 %s (置信度 %.4f): (%.1f, %.1f, %.1f, %.1f)",
 		chineseLabel, b.confidence, b.x1, b.y1, b.x2, b.y2)
 }
@@ -904,9 +1489,52 @@ func (b *boundingBox) iou(other *boundingBox) float32 {
 	return b.intersection(other) / b.union(other)
 }
 
+// center 返回边界框中心点
+func (b *boundingBox) center() (float32, float32) {
+	return (b.x1 + b.x2) / 2, (b.y1 + b.y2) / 2
+}
+
+// enclosingDiagonalSq 返回同时包含两个框的最小外接矩形对角线长度的平方
+func (b *boundingBox) enclosingDiagonalSq(other *boundingBox) float32 {
+	w := max32(b.x2, other.x2) - min32(b.x1, other.x1)
+	h := max32(b.y2, other.y2) - min32(b.y1, other.y1)
+	return w*w + h*h
+}
+
+// diou Distance-IoU：IoU 减去中心点距离平方与外接矩形对角线平方之比
+// 重叠相同但中心相距较远的两个框（如相邻车位的车辆）得分更低，不容易被互相抑制
+func (b *boundingBox) diou(other *boundingBox) float32 {
+	diag := b.enclosingDiagonalSq(other)
+	if diag <= 0 {
+		return b.iou(other)
+	}
+	cx1, cy1 := b.center()
+	cx2, cy2 := other.center()
+	dist := (cx1-cx2)*(cx1-cx2) + (cy1-cy2)*(cy1-cy2)
+	return b.iou(other) - dist/diag
+}
+
 // 加载图像文件
-// 支持多种图像格式（JPEG、PNG、GIF等）
+// 支持多种图像格式（JPEG、PNG、GIF等），解码和尺寸检查与 DetectReader 相同（decodeImage）
 func loadImageFile(filePath string) (image.Image, error) {
+	// 压缩包内的条目（虚拟路径）直接从压缩包解码
+	if archivePath, entry, ok := splitArchiveEntry(filePath); ok {
+		return loadArchiveImage(archivePath, entry)
+	}
+
+	// http(s) URL 和 s3:// 对象先下载到本地（同一 URL 只下载一次）
+	if isRemoteInput(filePath) {
+		localPath, err := downloadImage(filePath)
+		if err != nil {
+			return nil, err
+		}
+		pic, err := loadImageFile(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		return pic, nil
+	}
+
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("图像文件不存在: %s", filePath)
@@ -917,15 +1545,15 @@ func loadImageFile(filePath string) (image.Image, error) {
 		return nil, fmt.Errorf("打开图像文件失败 (路径: %s): %w", filePath, e)
 	}
 	defer f.Close()
-	pic, format, e := image.Decode(f)
+	pic, e := decodeImage(f)
 	if e != nil {
-		return nil, fmt.Errorf("解码图像文件失败 (路径: %s, 格式: %v): %w", filePath, format, e)
+		return nil, fmt.Errorf("解码图像文件失败 (路径: %s): %w", filePath, e)
 	}
 	return pic, nil
 }
 
 // 标准 Letterbox (对应 auto=False) 此模式将图像缩放到 imgsz（如 640），并填充到完整的正方形。 	官方版本
-func resizeWithLetterbox(img image.Image, targetSize int) (image.Image, ScaleInfo) {
+func resizeWithLetterbox(img image.Image, targetSize int) (*image.RGBA, ScaleInfo) {
 	bounds := img.Bounds()
 	originalWidth, originalHeight := bounds.Dx(), bounds.Dy()
 
@@ -936,8 +1564,8 @@ func resizeWithLetterbox(img image.Image, targetSize int) (image.Image, ScaleInf
 
 	resized := resize.Resize(uint(newWidth), uint(newHeight), img, resize.Bilinear)
 
-	// 从对象池获取指定尺寸的图像
-	result := GetImageFromPool(targetSize, targetSize)
+	// 从对象池获取指定尺寸的图像（随后整幅填充灰色，不需要清零）
+	result := getImageUncleared(targetSize, targetSize)
 
 	// 填充 114 灰色
 	draw.Draw(result, result.Bounds(), &image.Uniform{color.RGBA{114, 114, 114, 255}}, image.Point{}, draw.Src)
@@ -947,11 +1575,12 @@ func resizeWithLetterbox(img image.Image, targetSize int) (image.Image, ScaleInf
 	offsetY := (targetSize - newHeight) / 2
 	draw.Draw(result, image.Rect(offsetX, offsetY, offsetX+newWidth, offsetY+newHeight), resized, image.Point{}, draw.Src)
 
-	return result, ScaleInfo{ScaleX: float32(scale), ScaleY: float32(scale), PadLeft: offsetX, PadTop: offsetY}
+	return result, ScaleInfo{ScaleX: float32(scale), ScaleY: float32(scale), PadLeft: offsetX, PadTop: offsetY,
+		NewWidth: newWidth, NewHeight: newHeight}
 }
 
 // Rect 缩放 (对应 auto=True) 官方版本：这是 dynamic=True 的精髓：不再填充到 640x640，而是填充到能被 stride（通常为 32）整除的最小矩形，从而大幅提升推理速度。
-func resizeWithRectScaling(img image.Image, targetSize int, stride int) (image.Image, ScaleInfo) {
+func resizeWithRectScaling(img image.Image, targetSize int, stride int) (*image.RGBA, ScaleInfo) {
 	bounds := img.Bounds()
 	originalWidth, originalHeight := bounds.Dx(), bounds.Dy()
 
@@ -972,89 +1601,176 @@ func resizeWithRectScaling(img image.Image, targetSize int, stride int) (image.I
 
 	resized := resize.Resize(uint(unpadWidth), uint(unpadHeight), img, resize.Bilinear)
 
-	// 从对象池获取指定尺寸的图像
-	result := GetImageFromPool(finalWidth, finalHeight)
+	// 从对象池获取指定尺寸的图像（随后整幅填充灰色，不需要清零）
+	result := getImageUncleared(finalWidth, finalHeight)
 
 	draw.Draw(result, result.Bounds(), &image.Uniform{color.RGBA{114, 114, 114, 255}}, image.Point{}, draw.Src)
 
 	offsetX, offsetY := dw/2, dh/2
 	draw.Draw(result, image.Rect(offsetX, offsetY, offsetX+unpadWidth, offsetY+unpadHeight), resized, image.Point{}, draw.Src)
 
-	return result, ScaleInfo{ScaleX: float32(scale), ScaleY: float32(scale), PadLeft: offsetX, PadTop: offsetY}
+	return result, ScaleInfo{ScaleX: float32(scale), ScaleY: float32(scale), PadLeft: offsetX, PadTop: offsetY,
+		NewWidth: unpadWidth, NewHeight: unpadHeight}
 }
 
-// 获取ONNX Runtime共享库路径
-// 根据不同的操作系统和架构返回相应的动态库文件路径
-func getSharedLibPath() string {
-	if runtime.GOOS == "windows" {
-		if runtime.GOARCH == "amd64" {
-			return "./third_party/onnxruntime.dll"
-		}
+// 初始化ONNX Runtime会话
+// 为 -model 指定的每个模型创建会话：第一个为主会话，其余作为集成推理的成员会话
+func initSession() (*ModelSession, error) {
+	return initSessionForModels(modelPaths())
+}
+
+// initSessionForModels 为指定的模型列表创建会话（会话池热加载新模型时使用）
+func initSessionForModels(paths []string) (*ModelSession, error) {
+	if err := initializeORTEnvironment(); err != nil {
+		return nil, err
 	}
-	if runtime.GOOS == "darwin" {
-		if runtime.GOARCH == "arm64" {
-			return "./third_party/onnxruntime_arm64.dylib"
-		}
-		if runtime.GOARCH == "amd64" {
-			return "./third_party/onnxruntime_amd64.dylib"
+	modelSession, err := initModelSession(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	SetClassNames(modelSession.Layout.ClassNames)
+	for _, path := range paths[1:] {
+		member, err := initModelSession(path)
+		if err != nil {
+			modelSession.Destroy()
+			return nil, fmt.Errorf("加载集成模型 %s 失败: %w", path, err)
 		}
+		modelSession.Members = append(modelSession.Members, member)
 	}
-	if runtime.GOOS == "linux" {
-		if runtime.GOARCH == "arm64" {
-			return "./third_party/onnxruntime_arm64.so"
+
+	// 预热：会话池预创建和按需创建的会话都经过这里，预热耗时单独记录，不计入检测耗时
+	if *warmupRuns > 0 {
+		elapsed, err := modelSession.Warmup(*warmupRuns)
+		if err != nil {
+			modelSession.Destroy()
+			return nil, fmt.Errorf("会话预热失败: %w", err)
 		}
-		return "./third_party/onnxruntime.so"
+		writeLogFile("INFO", fmt.Sprintf("会话预热完成: %d 次推理，耗时 %v", *warmupRuns, elapsed))
 	}
-	return ""
+	return modelSession, nil
 }
 
-// 初始化ONNX Runtime会话
-// 创建模型推理所需的会话和张量
-func initSession() (*ModelSession, error) {
-	if err := initializeORTEnvironment(); err != nil {
-		return nil, err
-	}
+// initModelSession 创建单个模型的会话和张量
+func initModelSession(modelPath string) (*ModelSession, error) {
 	size := *modelInputSize
 	inputShape := ort.NewShape(int64(*batchSize), 3, int64(size), int64(size))
 	inputTensor, err := ort.NewEmptyTensor[float32](inputShape)
 	if err != nil {
 		return nil, fmt.Errorf("创建输入张量失败 (形状: %v): %w", inputShape, err)
 	}
-	outputShape := ort.NewShape(int64(*batchSize), 84, 8400) // YOLO 输出
-	outputTensor, err := ort.NewEmptyTensor[float32](outputShape)
+	layout, err := resolveOutputLayout(modelPath, *modelFormat, *taskType, size)
 	if err != nil {
 		inputTensor.Destroy()
-		return nil, fmt.Errorf("创建输出张量失败 (形状: %v): %w", outputShape, err)
+		return nil, fmt.Errorf("解析模型输出格式失败: %w", err)
+	}
+	outputShapes := []ort.Shape{layout.shape(*batchSize)} // YOLO 输出
+	if layout.NumMaskCoeffs > 0 {
+		outputShapes = append(outputShapes, layout.maskShape(*batchSize)) // 原型掩码
 	}
+	outputTensors := make([]*ort.Tensor[float32], 0, len(outputShapes))
+	destroyAll := func() {
+		inputTensor.Destroy()
+		for _, t := range outputTensors {
+			t.Destroy()
+		}
+	}
+	for _, outputShape := range outputShapes {
+		outputTensor, err := ort.NewEmptyTensor[float32](outputShape)
+		if err != nil {
+			destroyAll()
+			return nil, fmt.Errorf("创建输出张量失败 (形状: %v): %w", outputShape, err)
+		}
+		outputTensors = append(outputTensors, outputTensor)
+	}
+
+	// float16 模型（half=True 导出）：会话绑定半精度张量，float32 张量作为中转缓冲，
+	// 预处理和后处理代码无需区分精度
+	var halfInput *ort.CustomDataTensor
+	var halfOutputs []*ort.CustomDataTensor
+	destroyHalf := func() {
+		if halfInput != nil {
+			halfInput.Destroy()
+		}
+		for _, t := range halfOutputs {
+			t.Destroy()
+		}
+	}
+	inputs := []ort.ArbitraryTensor{inputTensor}
+	outputs := make([]ort.ArbitraryTensor, len(outputTensors))
+	for i, t := range outputTensors {
+		outputs[i] = t
+	}
+	if modelUsesFloat16(modelPath) {
+		if halfInput, err = newFloat16Tensor(inputShape); err != nil {
+			destroyAll()
+			return nil, fmt.Errorf("创建float16输入张量失败 (形状: %v): %w", inputShape, err)
+		}
+		inputs[0] = halfInput
+		for i, outputShape := range outputShapes {
+			halfOutput, err := newFloat16Tensor(outputShape)
+			if err != nil {
+				destroyHalf()
+				destroyAll()
+				return nil, fmt.Errorf("创建float16输出张量失败 (形状: %v): %w", outputShape, err)
+			}
+			halfOutputs = append(halfOutputs, halfOutput)
+			outputs[i] = halfOutput
+		}
+	}
+
 	options, err := ort.NewSessionOptions()
 	if err != nil {
-		inputTensor.Destroy()
-		outputTensor.Destroy()
+		destroyHalf()
+		destroyAll()
 		return nil, fmt.Errorf("创建SessionOptions失败: %w", err)
 	}
 	defer options.Destroy()
+	if err := configureSessionOptions(options); err != nil {
+		destroyHalf()
+		destroyAll()
+		return nil, err
+	}
 	session, err := ort.NewAdvancedSession(modelPath,
-		[]string{"images"}, []string{"output0"},
-		[]ort.ArbitraryTensor{inputTensor}, []ort.ArbitraryTensor{outputTensor}, options)
+		[]string{"images"}, layout.outputNames(),
+		inputs, outputs, options)
 	if err != nil {
-		inputTensor.Destroy()
-		outputTensor.Destroy()
+		destroyHalf()
+		destroyAll()
 		return nil, fmt.Errorf("创建ORT会话失败 (模型路径: %s, 输入尺寸: %d): %w", modelPath, size, err)
 	}
 	return &ModelSession{
-		Session: session,
-		Input:   inputTensor,
-		Output:  outputTensor,
+		Session:     session,
+		Input:       inputTensor,
+		Output:      outputTensors[0],
+		Outputs:     outputTensors,
+		Layout:      layout,
+		Name:        strings.TrimSuffix(filepath.Base(modelPath), filepath.Ext(modelPath)),
+		path:        modelPath,
+		halfInput:   halfInput,
+		halfOutputs: halfOutputs,
 	}, nil
 }
 
 // 处理模型输出
 // 解析模型输出的原始数据，提取边界框、类别和置信度信息
-func processOutput(output []float32, originalWidth, originalHeight int, confThreshold, iouThresh float32, scaleInfo ScaleInfo) []boundingBox {
-	boundingBoxes := make([]*boundingBox, 0, 100) // 使用指针切片，减少内存拷贝
+// confThreshold 为解码阈值：测试时增强时低于用户指定的 -conf，融合后再按 -conf 过滤（见 DetectionConfig.decodeThreshold）
+// iouThresh、maxDet、classes 与 confThreshold 一样来自 DetectionConfig，任务设置了 Params 时为覆盖后的值
+// 类别过滤（classes 为 nil 时不过滤）在 NMS 和 maxDet 截断之前进行，被过滤的类别不占用 maxDet 的名额
+func processOutput(output []float32, layout outputLayout, originalWidth, originalHeight int, confThreshold, iouThresh float32, maxDet int, classes *classFilter, scaleInfo ScaleInfo) []boundingBox {
+	// 端到端模型已在图内完成NMS，单独解析
+	if layout.Format == formatE2E {
+		return processEndToEndOutput(output, layout, originalWidth, originalHeight, confThreshold, maxDet, classes, scaleInfo)
+	}
+
+	// 候选框按值存放在本次调用的切片中，抑制后直接返回其中保留的框，不与其他调用共享
+	candidates := make([]boundingBox, 0, 100)
 
-	numAnchors := 8400
-	numClasses := 80
+	numAnchors := layout.NumAnchors
+	numClasses := layout.numClasses()
+
+	// v5 格式在 box 之后多一个 objectness 通道
+	classOffset := layout.classOffset()
+	maskOffset := layout.maskOffset()
 
 	scaleX := scaleInfo.ScaleX
 	scaleY := scaleInfo.ScaleY
@@ -1062,25 +1778,38 @@ func processOutput(output []float32, originalWidth, originalHeight int, confThre
 	for idx := 0; idx < numAnchors; idx++ {
 
 		// YOLO11: 前4维是 box (cx, cy, w, h)，后80维是类别置信度
-		xc := output[0*numAnchors+idx]
-		yc := output[1*numAnchors+idx]
-		w := output[2*numAnchors+idx]
-		h := output[3*numAnchors+idx]
+		// YOLOv5: box 之后是 objectness，最终置信度 = objectness * 类别概率
+		objectness := float32(1)
+		if layout.Format == formatV5 {
+			objectness = layout.at(output, 4, idx)
+			if objectness < confThreshold {
+				continue
+			}
+		}
+
+		xc := layout.at(output, 0, idx)
+		yc := layout.at(output, 1, idx)
+		w := layout.at(output, 2, idx)
+		h := layout.at(output, 3, idx)
 
 		maxClsProb := float32(0)
 		classID := 0
 		for classIdx := 0; classIdx < numClasses; classIdx++ {
-			clsProb := output[(4+classIdx)*numAnchors+idx]
+			clsProb := layout.at(output, classOffset+classIdx, idx)
 			if clsProb > maxClsProb {
 				maxClsProb = clsProb
 				classID = classIdx
 			}
 		}
 
-		finalConf := maxClsProb
+		finalConf := maxClsProb * objectness
 		if finalConf < confThreshold {
 			continue
 		}
+		label := layout.classLabel(classID)
+		if !classes.allows(label) {
+			continue
+		}
 
 		// 映射回原图坐标
 		origCenterX := (xc - float32(scaleInfo.PadLeft)) / scaleX
@@ -1102,55 +1831,128 @@ func processOutput(output []float32, originalWidth, originalHeight int, confThre
 			continue
 		}
 
-		// 从对象池获取boundingBox
-		box := boundingBoxPool.Get().(*boundingBox)
-		box.label = yoloClasses[classID]
-		box.confidence = finalConf
-		box.x1 = x1
-		box.y1 = y1
-		box.x2 = x2
-		box.y2 = y2
-		boundingBoxes = append(boundingBoxes, box)
+		box := boundingBox{
+			label:      label,
+			confidence: finalConf,
+			x1:         x1,
+			y1:         y1,
+			x2:         x2,
+			y2:         y2,
+		}
+		if layout.NumKeypoints > 0 {
+			box.keypoints = parseKeypoints(output, layout, idx, scaleInfo)
+		}
+		if layout.NumMaskCoeffs > 0 {
+			box.maskCoeffs = make([]float32, layout.NumMaskCoeffs)
+			for k := range box.maskCoeffs {
+				box.maskCoeffs[k] = layout.at(output, maskOffset+k, idx)
+			}
+		}
+		candidates = append(candidates, box)
 	}
 
-	sort.Slice(boundingBoxes, func(i, j int) bool {
-		return boundingBoxes[i].confidence > boundingBoxes[j].confidence
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].confidence > candidates[j].confidence
 	})
 
-	result := nonMaxSuppressionP(boundingBoxes, iouThresh)
-	return result
+	result := suppressBoxes(candidates, iouThresh, confThreshold)
+	return capDetections(result, maxDet)
 }
 
-// 准备输入数据
-// 将图像数据转换为模型输入所需的格式（归一化RGB张量）
-func prepareInput(pic image.Image, dst *ort.Tensor[float32]) (ScaleInfo, error) {
+// 处理端到端模型输出（YOLOv10 / end2end 导出）
+// 每行为 [x1, y1, x2, y2, score, class]，已完成NMS，只需映射坐标并过滤置信度
+func processEndToEndOutput(output []float32, layout outputLayout, originalWidth, originalHeight int, confThreshold float32, maxDet int, classes *classFilter, scaleInfo ScaleInfo) []boundingBox {
+	boxes := make([]boundingBox, 0, 32)
+	for idx := 0; idx < layout.NumAnchors; idx++ {
+		score := layout.at(output, 4, idx)
+		if score < confThreshold {
+			continue
+		}
+		label := layout.classLabel(int(layout.at(output, 5, idx)))
+		if !classes.allows(label) {
+			continue
+		}
+
+		// 映射回原图坐标
+		x1 := clamp((layout.at(output, 0, idx)-float32(scaleInfo.PadLeft))/scaleInfo.ScaleX, 0, float32(originalWidth))
+		y1 := clamp((layout.at(output, 1, idx)-float32(scaleInfo.PadTop))/scaleInfo.ScaleY, 0, float32(originalHeight))
+		x2 := clamp((layout.at(output, 2, idx)-float32(scaleInfo.PadLeft))/scaleInfo.ScaleX, 0, float32(originalWidth))
+		y2 := clamp((layout.at(output, 3, idx)-float32(scaleInfo.PadTop))/scaleInfo.ScaleY, 0, float32(originalHeight))
+		if x2 <= x1 || y2 <= y1 {
+			continue
+		}
+
+		boxes = append(boxes, boundingBox{
+			label:      label,
+			confidence: score,
+			x1:         x1,
+			y1:         y1,
+			x2:         x2,
+			y2:         y2,
+		})
+	}
+
+	sort.Slice(boxes, func(i, j int) bool {
+		return boxes[i].confidence > boxes[j].confidence
+	})
+	return capDetections(boxes, maxDet)
+}
+
+// 处理批量模型输出
+// 按批次槽位切分输出张量，分别解析每张图像的检测结果
+// sizes 为每张图像的原始尺寸，与 cfgs、scaleInfos 一一对应；每个槽位按各自任务的检测参数解码
+func processBatchOutput(output []float32, layout outputLayout, sizes []image.Point, cfgs []DetectionConfig, scaleInfos []ScaleInfo) [][]boundingBox {
+	slotSize := layout.slotSize()
+	results := make([][]boundingBox, len(sizes))
+	for i, size := range sizes {
+		if (i+1)*slotSize > len(output) {
+			break
+		}
+		results[i] = processOutput(output[i*slotSize:(i+1)*slotSize], layout, size.X, size.Y,
+			cfgs[i].ConfThreshold, cfgs[i].IOUThreshold, cfgs[i].MaxDet, cfgs[i].Classes, scaleInfos[i])
+	}
+	return results
+}
+
+// 准备批量输入数据
+// 将多张图像依次写入批次张量的连续槽位，返回每张图像的缩放信息
+func prepareBatchInput(pics []image.Image, dst *ort.Tensor[float32]) ([]ScaleInfo, error) {
 	inputSize := *modelInputSize
-	channelSize := inputSize * inputSize
+	slotSize := 3 * inputSize * inputSize
 	data := dst.GetData()
+	if len(pics)*slotSize > len(data) {
+		return nil, fmt.Errorf("批次图像数量 %d 超过输入张量容量 %d", len(pics), len(data)/slotSize)
+	}
+
+	scaleInfos := make([]ScaleInfo, len(pics))
+	for i, pic := range pics {
+		scaleInfo, err := fillInputData(pic, data[i*slotSize:(i+1)*slotSize])
+		if err != nil {
+			return nil, err
+		}
+		scaleInfos[i] = scaleInfo
+	}
+	return scaleInfos, nil
+}
+
+// 将单张图像归一化后写入一个批次槽位（CHW排列）
+func fillInputData(pic image.Image, data []float32) (ScaleInfo, error) {
+	inputSize := *modelInputSize
+	channelSize := inputSize * inputSize
 	if len(data) < 3*channelSize {
 		return ScaleInfo{}, errors.New("输入张量长度不足")
 	}
-	var resizedImg image.Image
-	var scaleInfo ScaleInfo
-	if *useRectScaling {
-		resizedImg, scaleInfo = resizeWithRectScaling(pic, inputSize, stride)
-	} else {
-		resizedImg, scaleInfo = resizeWithLetterbox(pic, inputSize)
+	resizedImg, scaleInfo := resizeForInput(pic, inputSize)
+	defer PutImageToPool(resizedImg)
+	if err := scaleInfo.Validate(inputSize, stride); err != nil {
+		return ScaleInfo{}, fmt.Errorf("预处理失败（-resize-mode %s）: %w", *resizeMode, err)
 	}
 	// TTA 修正: 对齐框和对象
 	red := data[:channelSize]
 	green := data[channelSize : 2*channelSize]
 	blue := data[2*channelSize : 3*channelSize]
 
-	for y := 0; y < inputSize; y++ {
-		for x := 0; x < inputSize; x++ {
-			r, g, b, _ := resizedImg.At(x, y).RGBA()
-			idx := y*inputSize + x
-			red[idx] = float32(r>>8) / 255.0
-			green[idx] = float32(g>>8) / 255.0
-			blue[idx] = float32(b>>8) / 255.0
-		}
-	}
+	fillPlanes(resizedImg, red, green, blue, inputSize)
 	return scaleInfo, nil
 }
 
@@ -1181,14 +1983,29 @@ func max(a, b int) int {
 	return b
 }
 
+// float32 版本的 min/max（包内的 min/max 只接受 int）
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // 水平翻转图像
-// 用于测试时增强(TTA)，提高检测精度
+// 用于测试时增强(TTA)，提高检测精度；返回的图像来自对象池，推理后需归还
 func flipHorizontal(img image.Image) image.Image {
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 
-	// 从对象池获取指定尺寸的图像
-	result := GetImageFromPool(w, h)
+	// 从对象池获取指定尺寸的图像（随后逐像素覆盖，不需要清零）
+	result := getImageUncleared(w, h)
 
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
@@ -1199,7 +2016,8 @@ func flipHorizontal(img image.Image) image.Image {
 }
 
 // 旋转图像（简单实现，仅支持90度倍数旋转）
-// 预留功能，可用于更多数据增强方法
+// 用于测试时增强（-tta-ops rot90/rot180/rot270），检测框由 rotateBoundingBox 变换回原图坐标
+// 旋转后的图像来自对象池，推理后需归还（角度无效时原样返回输入图像）
 func rotateImage(img image.Image, degrees int) image.Image {
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
@@ -1207,7 +2025,7 @@ func rotateImage(img image.Image, degrees int) image.Image {
 	switch degrees {
 	case 90:
 		// 从对象池获取指定尺寸的图像
-		result := GetImageFromPool(h, w)
+		result := getImageUncleared(h, w)
 		for y := 0; y < h; y++ {
 			for x := 0; x < w; x++ {
 				result.Set(y, w-x-1, img.At(x, y))
@@ -1216,7 +2034,7 @@ func rotateImage(img image.Image, degrees int) image.Image {
 		return result
 	case 180:
 		// 从对象池获取指定尺寸的图像
-		result := GetImageFromPool(w, h)
+		result := getImageUncleared(w, h)
 		for y := 0; y < h; y++ {
 			for x := 0; x < w; x++ {
 				result.Set(w-x-1, h-y-1, img.At(x, y))
@@ -1225,7 +2043,7 @@ func rotateImage(img image.Image, degrees int) image.Image {
 		return result
 	case 270:
 		// 从对象池获取指定尺寸的图像
-		result := GetImageFromPool(h, w)
+		result := getImageUncleared(h, w)
 		for y := 0; y < h; y++ {
 			for x := 0; x < w; x++ {
 				result.Set(h-y-1, x, img.At(x, y))
@@ -1246,58 +2064,16 @@ func flipBoundingBox(box boundingBox, imageWidth int) boundingBox {
 	originalX2 := box.x2
 	box.x1 = float32(imageWidth) - originalX2
 	box.x2 = float32(imageWidth) - originalX1
-	return box
-}
-
-// 非极大值抑制(NMS) - 指针版本
-// 去除重复的检测框，保留置信度最高的框
-func nonMaxSuppressionP(boxes []*boundingBox, iouThreshold float32) []boundingBox {
-	if len(boxes) == 0 {
-		return []boundingBox{}
+	if box.mask != nil {
+		box.mask = flipMask(box.mask, imageWidth)
 	}
-
-	selected := make([]boundingBox, 0, len(boxes))
-	picked := make([]bool, len(boxes))
-
-	// 按类别分组进行NMS抑制 - 仿照官方Python的batched_nms实现
-	for i := 0; i < len(boxes); i++ {
-		if picked[i] {
-			// 释放未选中的对象
-			boundingBoxPool.Put(boxes[i])
-			continue
-		}
-
-		// 保留选中的对象
-		selected = append(selected, *boxes[i])
-		picked[i] = true
-
-		// 只对相同类别的框进行NMS抑制
-		for j := i + 1; j < len(boxes); j++ {
-			if picked[j] || boxes[i].label != boxes[j].label {
-				continue
-			}
-
-			// 计算IoU
-			iou := boxes[i].iou(boxes[j])
-			if iou >= iouThreshold { // 使用 >= 与官方Python代码保持一致
-				picked[j] = true
-				// 释放被抑制的对象
-				boundingBoxPool.Put(boxes[j])
-			}
-		}
+	if box.keypoints != nil {
+		box.keypoints = flipKeypoints(box.keypoints, imageWidth)
 	}
-
-	// 释放所有未处理的对象
-	for i := 0; i < len(boxes); i++ {
-		if !picked[i] {
-			boundingBoxPool.Put(boxes[i])
-		}
-	}
-
-	return selected
+	return box
 }
 
-// 非极大值抑制(NMS) - 兼容旧版本
+// 非极大值抑制(NMS)
 // 去除重复的检测框，保留置信度最高的框
 func nonMaxSuppression(boxes []boundingBox, iouThreshold float32) []boundingBox {
 	if len(boxes) == 0 {
@@ -1308,6 +2084,14 @@ func nonMaxSuppression(boxes []boundingBox, iouThreshold float32) []boundingBox
 	sort.Slice(boxes, func(i, j int) bool {
 		return boxes[i].confidence > boxes[j].confidence
 	})
+	return nonMaxSuppressionSorted(boxes, iouThreshold)
+}
+
+// nonMaxSuppressionSorted 对已按置信度降序排列的框做 NMS，不再重新排序（避免置信度相同的框顺序变化）
+func nonMaxSuppressionSorted(boxes []boundingBox, iouThreshold float32) []boundingBox {
+	if len(boxes) == 0 {
+		return []boundingBox{}
+	}
 
 	selected := make([]boundingBox, 0)
 	picked := make([]bool, len(boxes))
@@ -1327,8 +2111,8 @@ func nonMaxSuppression(boxes []boundingBox, iouThreshold float32) []boundingBox
 				continue
 			}
 
-			// 计算IoU
-			iou := boxes[i].iou(&boxes[j])
+			// 计算IoU（-nms diou 时为 DIoU）
+			iou := suppressionOverlap(&boxes[i], &boxes[j])
 			if iou >= iouThreshold { // 使用 >= 与官方Python代码保持一致
 				picked[j] = true
 			}
@@ -1337,9 +2121,9 @@ func nonMaxSuppression(boxes []boundingBox, iouThreshold float32) []boundingBox
 	return selected
 }
 
-// 绘制边界框和标签
-// 在原图上绘制检测结果，包括边界框、标签和置信度
-func drawBoundingBoxesWithLabels(img image.Image, boxes []boundingBox, outputPath string) error {
+// Annotate 在原图的副本上绘制检测框、标签和系统文本并返回，不写任何文件，原图不变
+// 返回的图像取自对象池，使用完后调用 PutImageToPool 归还可以复用内存（不归还也不影响正确性）
+func Annotate(img image.Image, boxes []boundingBox) *image.RGBA {
 	bounds := img.Bounds()
 	w, h := bounds.Dx(), bounds.Dy()
 
@@ -1440,6 +2224,11 @@ func drawBoundingBoxesWithLabels(img image.Image, boxes []boundingBox, outputPat
 			boxColor = colors["default"]
 		}
 
+		// 分割模型：先叠加半透明实例掩码
+		if box.mask != nil {
+			drawMask(rgba, box.mask, boxColor)
+		}
+
 		// 绘制边界框
 		for y := int(box.y1); y <= int(box.y2); y++ {
 			if y < 0 || y >= bounds.Dy() {
@@ -1466,6 +2255,11 @@ func drawBoundingBoxesWithLabels(img image.Image, boxes []boundingBox, outputPat
 			}
 		}
 
+		// 姿态模型：绘制关键点和骨架
+		if box.keypoints != nil {
+			drawKeypoints(rgba, box.keypoints)
+		}
+
 		// 使用改进的drawLabel函数，使用框颜色作为背景色，确保文本与背景对比度
 		drawLabel(rgba, box, boxColor)
 	}
@@ -1473,22 +2267,24 @@ func drawBoundingBoxesWithLabels(img image.Image, boxes []boundingBox, outputPat
 	// 绘制系统文本
 	drawSystemText(rgba, *systemTextLocation)
 
-	// 保存图像
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("创建输出文件失败: %w", err)
-	}
-	defer outFile.Close()
+	return rgba
+}
 
-	err = jpeg.Encode(outFile, rgba, &jpeg.Options{Quality: 90})
-	if err != nil {
-		return fmt.Errorf("编码输出图像失败: %w", err)
+// saveJPEG 将图像编码为 JPEG 并保存，s3:// 路径编码后上传
+func saveJPEG(img image.Image, outputPath string) error {
+	if isS3Path(outputPath) {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return fmt.Errorf("编码输出图像失败: %w", err)
+		}
+		return uploadS3(outputPath, buf.Bytes(), "image/jpeg")
 	}
-
-	// 将图像对象归还到池中
-	PutImageToPool(rgba)
-
-	return nil
+	return writeFileAtomic(outputPath, func(outFile *os.File) error {
+		if err := jpeg.Encode(outFile, img, &jpeg.Options{Quality: 90}); err != nil {
+			return fmt.Errorf("编码输出图像失败: %w", err)
+		}
+		return nil
+	})
 }
 
 // 测量文本宽度和高度的辅助函数
@@ -1511,8 +2307,8 @@ func measureText(text string, face font.Face) (width, height int) {
 // 修改后的drawLabel函数，支持中文标签
 // 在边界框旁边绘制类别标签和置信度
 func drawLabel(img *image.RGBA, box boundingBox, boxColor color.RGBA) {
-	chineseLabel := getChineseLabel(box.label)
-	labelText := fmt.Sprintf("%s/%s(%.2f)", box.label, chineseLabel, box.confidence) // 显示英文标签/中文标签和置信度
+	chineseLabel := ChineseLabel(box.label)
+	labelText := fmt.Sprintf("%s/%s(%s)", box.label, chineseLabel, formatConfidenceN(box.confidence, 2)) // 显示英文标签/中文标签和置信度
 	rect := box.toRect()
 
 	textWidth, textHeight := measureText(labelText, chineseFont)
@@ -1628,105 +2424,6 @@ func drawText(img *image.RGBA, x, y int, text string, textColor color.RGBA) {
 	d.DrawString(text)
 }
 
-// YOLO类别标签（英文原始标签）[1,2](@ref)
-// YOLOv8模型支持的80个类别
-var yoloClasses = []string{
-	"person", "bicycle", "car", "motorcycle", "airplane", "bus", "train", "truck", "boat",
-	"traffic light", "fire hydrant", "stop sign", "parking meter", "bench", "bird", "cat", "dog", "horse",
-	"sheep", "cow", "elephant", "bear", "zebra", "giraffe", "backpack", "umbrella", "handbag", "tie",
-	"suitcase", "frisbee", "skis", "snowboard", "sports ball", "kite", "baseball bat", "baseball glove",
-	"skateboard", "surfboard", "tennis racket", "bottle", "wine glass", "cup", "fork", "knife", "spoon",
-	"bowl", "banana", "apple", "sandwich", "orange", "broccoli", "carrot", "hot dog", "pizza", "donut",
-	"cake", "chair", "couch", "potted plant", "bed", "dining table", "toilet", "tv", "laptop", "mouse",
-	"remote", "keyboard", "cell phone", "microwave", "oven", "toaster", "sink", "refrigerator", "book",
-	"clock", "vase", "scissors", "teddy bear", "hair drier", "toothbrush",
-}
-
-// 中英标签映射
-// 将YOLO英文标签映射为中文标签
-var detectLabelMap = map[string]string{
-	"person":         "人员",
-	"bicycle":        "自行车",
-	"car":            "汽车",
-	"motorcycle":     "摩托车",
-	"airplane":       "飞机",
-	"bus":            "巴士",
-	"train":          "火车",
-	"truck":          "卡车",
-	"boat":           "船",
-	"traffic light":  "红绿灯",
-	"fire hydrant":   "消防栓",
-	"stop sign":      "停车标志",
-	"parking meter":  "停车计时器",
-	"bench":          "长凳",
-	"bird":           "鸟",
-	"cat":            "猫",
-	"dog":            "狗",
-	"horse":          "马",
-	"sheep":          "羊",
-	"cow":            "牛",
-	"elephant":       "大象",
-	"bear":           "熊",
-	"zebra":          "斑马",
-	"giraffe":        "长颈鹿",
-	"backpack":       "背包",
-	"umbrella":       "雨伞",
-	"handbag":        "手提包",
-	"tie":            "领带",
-	"suitcase":       "行李箱",
-	"frisbee":        "飞盘",
-	"skis":           "滑雪板",
-	"snowboard":      "雪板",
-	"sports ball":    "运动球",
-	"kite":           "风筝",
-	"baseball bat":   "棒球棍",
-	"baseball glove": "棒球手套",
-	"skateboard":     "滑板",
-	"surfboard":      "冲浪板",
-	"tennis racket":  "网球拍",
-	"bottle":         "瓶子",
-	"wine glass":     "酒杯",
-	"cup":            "杯子",
-	"fork":           "叉子",
-	"knife":          "刀",
-	"spoon":          "勺子",
-	"bowl":           "碗",
-	"banana":         "香蕉",
-	"apple":          "苹果",
-	"sandwich":       "三明治",
-	"orange":         "橙子",
-	"broccoli":       "西兰花",
-	"carrot":         "胡萝卜",
-	"hot dog":        "热狗",
-	"pizza":          "披萨",
-	"donut":          "甜甜圈",
-	"cake":           "蛋糕",
-	"chair":          "椅子",
-	"couch":          "沙发",
-	"potted plant":   "盆栽",
-	"bed":            "床",
-	"dining table":   "餐桌",
-	"toilet":         "厕所",
-	"tv":             "电视",
-	"laptop":         "笔记本电脑",
-	"mouse":          "鼠标",
-	"remote":         "遥控器",
-	"keyboard":       "键盘",
-	"cell phone":     "手机",
-	"microwave":      "微波炉",
-	"oven":           "烤箱",
-	"toaster":        "烤面包机",
-	"sink":           "水槽",
-	"refrigerator":   "冰箱",
-	"book":           "书",
-	"clock":          "钟",
-	"vase":           "花瓶",
-	"scissors":       "剪刀",
-	"teddy bear":     "泰迪熊",
-	"hair drier":     "吹风机",
-	"toothbrush":     "牙刷",
-}
-
 // 根据原始颜色计算高对比度背景颜色
 // 如果原始颜色太亮，则使用深色背景；如果太暗，则使用浅色背景
 func getHighContrastBackgroundColor(originalColor color.RGBA) color.RGBA {
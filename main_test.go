@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// crowdedOutput 生成一帧密集的 v8 输出：每组锚点互相重叠、置信度相同，seed 让各帧的坐标不同
+func crowdedOutput(seed int) ([]float32, outputLayout) {
+	var anchors []testAnchor
+	for group := 0; group < 12; group++ {
+		for i := 0; i < 5; i++ {
+			anchors = append(anchors, testAnchor{
+				cx: float32(group*50 + i*3 + seed), cy: float32(100 + i*2 + seed), w: 40, h: 40,
+				class: group % 3, conf: 0.5 + float32(group%4)/10,
+			})
+		}
+	}
+	return v8Output([]string{"person", "car", "dog"}, anchors)
+}
+
+// scribble 覆盖检测框的内容；结果与其他调用共享内存时，另一方会读到被覆盖的值
+func scribble(boxes []boundingBox) {
+	for i := range boxes {
+		boxes[i] = boundingBox{label: "scribbled", confidence: -1}
+	}
+}
+
+func TestProcessOutputResultsNotAliased(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	const frames = 8
+	for _, method := range []string{nmsHard, nmsSoft, nmsDIoU} {
+		t.Run(method, func(t *testing.T) {
+			config.NMS = method
+			outputs := make([][]float32, frames)
+			want := make([][]boundingBox, frames)
+			var layout outputLayout
+			for i := range outputs {
+				outputs[i], layout = crowdedOutput(i * 7)
+				want[i] = processOutput(outputs[i], layout, 1000, 1000, 0.25, 0.45, 300, nil, identityScale)
+				if len(want[i]) == 0 {
+					t.Fatal("参考结果为空")
+				}
+			}
+
+			// 连续调用：覆盖后一次的结果不影响前一次
+			first := processOutput(outputs[0], layout, 1000, 1000, 0.25, 0.45, 300, nil, identityScale)
+			scribble(processOutput(outputs[1], layout, 1000, 1000, 0.25, 0.45, 300, nil, identityScale))
+			if !reflect.DeepEqual(first, want[0]) {
+				t.Fatal("后一次调用的结果与前一次共用内存")
+			}
+
+			// 并发调用（-race 下运行）：每个结果与串行参考一致，覆盖自己的结果不影响其他协程
+			var wg sync.WaitGroup
+			errs := make(chan int, frames*20)
+			for g := 0; g < frames; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for iter := 0; iter < 20; iter++ {
+						i := (g + iter) % frames
+						boxes := processOutput(outputs[i], layout, 1000, 1000, 0.25, 0.45, 300, nil, identityScale)
+						if !reflect.DeepEqual(boxes, want[i]) {
+							errs <- i
+						}
+						scribble(boxes)
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for i := range errs {
+				t.Errorf("并发解码第 %d 帧的结果与串行结果不同", i)
+			}
+		})
+	}
+}
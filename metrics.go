@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 监控指标参数
+var metricsAddr = &config.MetricsAddr
+
+// 处理阶段，每个阶段一个耗时直方图
+const (
+	stageLoad        = "load"        // 读取并解码图像
+	stagePreprocess  = "preprocess"  // 缩放并填充输入张量
+	stageInference   = "inference"   // session.Run
+	stagePostprocess = "postprocess" // 解码输出、NMS、掩码
+)
+
+var metricStages = []string{stageLoad, stagePreprocess, stageInference, stagePostprocess}
+
+// 失败任务按原因分类
+var metricErrorKinds = []string{"timeout", "inference", "panic", "canceled", "stopped", "session", "other"}
+
+// 耗时直方图的桶上界（秒）
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// durationHistogram 累积分布的耗时直方图，桶的含义与 Prometheus 相同（counts[i] 为不超过 durationBuckets[i] 的次数）
+type durationHistogram struct {
+	mutex  sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64 // 秒
+}
+
+func newDurationHistogram() *durationHistogram {
+	return &durationHistogram{counts: make([]uint64, len(durationBuckets))}
+}
+
+func (h *durationHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// HistogramSnapshot 直方图某一时刻的值
+type HistogramSnapshot struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum_seconds"`
+	Buckets map[string]uint64 `json:"buckets"` // 上界（秒）-> 累计次数
+}
+
+func (h *durationHistogram) snapshot() HistogramSnapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	snap := HistogramSnapshot{Count: h.count, Sum: h.sum, Buckets: make(map[string]uint64, len(durationBuckets))}
+	for i, bound := range durationBuckets {
+		snap.Buckets[formatBound(bound)] = h.counts[i]
+	}
+	return snap
+}
+
+// detectorMetrics 进程内的监控指标：计数器和直方图在各执行路径中更新，
+// 队列和会话的当前值在读取时从最近创建的管理器获取
+type detectorMetrics struct {
+	tasks int64
+	// 提交限速（-max-fps）
+	rateDelayed  int64
+	rateRejected int64
+	rateWait     int64 // 等待配额的累计时间（纳秒）
+	// Kafka 输出（-kafka-brokers）
+	kafkaDelivered int64
+	kafkaFailed    int64 // 发送失败的消息数
+	kafkaDropped   int64 // 发送队列已满丢弃的消息数
+	// 视频流输入（-img rtsp://...）
+	streamReconnects int64 // 断流或连接失败后的重连次数
+	streamDropped    int64 // 自适应丢帧（-adaptive-drop）丢弃的帧数
+	errors           map[string]*int64
+	stages           map[string]*durationHistogram
+	latency          *durationHistogram // 从提交到得到结果的端到端耗时（含排队）
+	manager          atomic.Pointer[VideoDetectorManager]
+
+	detectionsMutex sync.RWMutex
+	detections      map[string]*int64 // 按类别统计的检测目标数，类别数受模型类别表限制
+}
+
+var metrics = newDetectorMetrics()
+
+func newDetectorMetrics() *detectorMetrics {
+	m := &detectorMetrics{
+		errors:     make(map[string]*int64, len(metricErrorKinds)),
+		stages:     make(map[string]*durationHistogram, len(metricStages)),
+		latency:    newDurationHistogram(),
+		detections: make(map[string]*int64),
+	}
+	for _, kind := range metricErrorKinds {
+		m.errors[kind] = new(int64)
+	}
+	for _, stage := range metricStages {
+		m.stages[stage] = newDurationHistogram()
+	}
+	return m
+}
+
+func init() {
+	expvar.Publish("detector", expvar.Func(func() interface{} { return metrics.Snapshot() }))
+}
+
+// observeStage 记录一个处理阶段从 start 到现在的耗时
+func observeStage(stage string, start time.Time) {
+	metrics.stages[stage].observe(time.Since(start))
+}
+
+// recordResult 记录一个处理完成的任务，失败时按原因计数，成功时按类别累计检测目标数
+func (m *detectorMetrics) recordResult(result DetectionResult) {
+	atomic.AddInt64(&m.tasks, 1)
+	if result.Error != nil {
+		atomic.AddInt64(m.errors[metricErrorKind(result.Error)], 1)
+		return
+	}
+	for _, box := range result.Objects {
+		atomic.AddInt64(m.detectionCounter(box.label), 1)
+	}
+}
+
+// recordLatency 记录一个任务从提交到得到结果的耗时，submitted 为零值（未记录提交时间）时忽略
+func (m *detectorMetrics) recordLatency(submitted time.Time) {
+	if !submitted.IsZero() {
+		m.latency.observe(time.Since(submitted))
+	}
+}
+
+// detectionCounter 返回类别的计数器，首次出现时创建
+func (m *detectorMetrics) detectionCounter(label string) *int64 {
+	m.detectionsMutex.RLock()
+	counter, ok := m.detections[label]
+	m.detectionsMutex.RUnlock()
+	if ok {
+		return counter
+	}
+	m.detectionsMutex.Lock()
+	defer m.detectionsMutex.Unlock()
+	if counter, ok = m.detections[label]; !ok {
+		counter = new(int64)
+		m.detections[label] = counter
+	}
+	return counter
+}
+
+// recordRateLimit 记录一次超出限速的提交：delayed 为 true 时等待了 wait，否则被拒绝
+func (m *detectorMetrics) recordRateLimit(delayed bool, wait time.Duration) {
+	if delayed {
+		atomic.AddInt64(&m.rateDelayed, 1)
+		atomic.AddInt64(&m.rateWait, int64(wait))
+		return
+	}
+	atomic.AddInt64(&m.rateRejected, 1)
+}
+
+// metricErrorKind 将任务错误归入 metricErrorKinds 中的一类
+func metricErrorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrTaskTimeout):
+		return "timeout"
+	case errors.Is(err, ErrSessionRunFailed):
+		return "inference"
+	case errors.Is(err, ErrTaskPanic):
+		return "panic"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.Is(err, ErrManagerStopped):
+		return "stopped"
+	case errors.Is(err, ErrSessionAcquireTimeout), errors.Is(err, ErrSessionPoolClosed):
+		return "session"
+	default:
+		return "other"
+	}
+}
+
+// MetricsSnapshot 监控指标某一时刻的值，通过 expvar（/debug/vars 中的 detector）以 JSON 导出
+type MetricsSnapshot struct {
+	Tasks             int64                        `json:"tasks"`  // 处理完成的任务数（含失败）
+	Errors            map[string]int64             `json:"errors"` // 按原因统计的失败任务数
+	QueueLength       int                          `json:"queue_length"`
+	ActiveSessions    int                          `json:"active_sessions"`
+	IdleSessions      int                          `json:"idle_sessions"`
+	SessionsCreated   int64                        `json:"sessions_created"`
+	SessionsDestroyed int64                        `json:"sessions_destroyed"`
+	SessionsReplaced  int64                        `json:"sessions_replaced"`
+	RateLimitDelayed  int64                        `json:"rate_limit_delayed"`  // 因 -max-fps 等待后提交的次数
+	RateLimitRejected int64                        `json:"rate_limit_rejected"` // 因 -max-fps 被拒绝的提交次数
+	RateLimitWait     float64                      `json:"rate_limit_wait_seconds"`
+	Stages            map[string]HistogramSnapshot `json:"stages"`     // 各处理阶段的耗时
+	Latency           HistogramSnapshot            `json:"latency"`    // 从提交到得到结果的端到端耗时
+	Detections        map[string]int64             `json:"detections"` // 按类别统计的检测目标数
+	ResidentMemory    int64                        `json:"resident_memory_bytes,omitempty"`
+	KafkaDelivered    int64                        `json:"kafka_delivered,omitempty"`
+	KafkaFailed       int64                        `json:"kafka_failed,omitempty"`
+	KafkaDropped      int64                        `json:"kafka_dropped,omitempty"`
+	StreamReconnects  int64                        `json:"stream_reconnects,omitempty"`
+	StreamDropped     int64                        `json:"stream_frames_dropped,omitempty"`
+}
+
+// Snapshot 返回当前所有指标的值
+func (m *detectorMetrics) Snapshot() MetricsSnapshot {
+	snap := MetricsSnapshot{
+		Tasks:             atomic.LoadInt64(&m.tasks),
+		RateLimitDelayed:  atomic.LoadInt64(&m.rateDelayed),
+		RateLimitRejected: atomic.LoadInt64(&m.rateRejected),
+		RateLimitWait:     time.Duration(atomic.LoadInt64(&m.rateWait)).Seconds(),
+		KafkaDelivered:    atomic.LoadInt64(&m.kafkaDelivered),
+		KafkaFailed:       atomic.LoadInt64(&m.kafkaFailed),
+		KafkaDropped:      atomic.LoadInt64(&m.kafkaDropped),
+		StreamReconnects:  atomic.LoadInt64(&m.streamReconnects),
+		StreamDropped:     atomic.LoadInt64(&m.streamDropped),
+		Errors:            make(map[string]int64, len(m.errors)),
+		Stages:            make(map[string]HistogramSnapshot, len(m.stages)),
+	}
+	for kind, n := range m.errors {
+		snap.Errors[kind] = atomic.LoadInt64(n)
+	}
+	for stage, h := range m.stages {
+		snap.Stages[stage] = h.snapshot()
+	}
+	snap.Latency = m.latency.snapshot()
+	m.detectionsMutex.RLock()
+	snap.Detections = make(map[string]int64, len(m.detections))
+	for label, n := range m.detections {
+		snap.Detections[label] = atomic.LoadInt64(n)
+	}
+	m.detectionsMutex.RUnlock()
+	snap.ResidentMemory, _ = residentMemory()
+	if manager := m.manager.Load(); manager != nil {
+		snap.QueueLength = manager.queuedTasks()
+		snap.ActiveSessions, snap.IdleSessions = manager.sessionPool.GetStats()
+		snap.SessionsCreated, snap.SessionsDestroyed, snap.SessionsReplaced = manager.sessionPool.GetSessionStats()
+	}
+	return snap
+}
+
+// WritePrometheus 以 Prometheus 文本格式写出所有指标
+func (m *detectorMetrics) WritePrometheus(w io.Writer) {
+	snap := m.Snapshot()
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("yolo_tasks_total", "counter", "Tasks completed, including failures.")
+	fmt.Fprintf(w, "yolo_tasks_total %d\n", snap.Tasks)
+
+	metric("yolo_detections_total", "counter", "Detected objects by class.")
+	labels := make([]string, 0, len(snap.Detections))
+	for label := range snap.Detections {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "yolo_detections_total{class=%s} %d\n", quoteLabelValue(label), snap.Detections[label])
+	}
+
+	metric("yolo_task_errors_total", "counter", "Failed tasks by reason.")
+	for _, kind := range metricErrorKinds {
+		fmt.Fprintf(w, "yolo_task_errors_total{kind=%q} %d\n", kind, snap.Errors[kind])
+	}
+
+	metric("yolo_queue_length", "gauge", "Tasks waiting in the worker queues.")
+	fmt.Fprintf(w, "yolo_queue_length %d\n", snap.QueueLength)
+
+	metric("yolo_sessions", "gauge", "Model sessions in the pool by state.")
+	fmt.Fprintf(w, "yolo_sessions{state=\"active\"} %d\n", snap.ActiveSessions)
+	fmt.Fprintf(w, "yolo_sessions{state=\"idle\"} %d\n", snap.IdleSessions)
+
+	metric("yolo_sessions_created_total", "counter", "Model sessions created by the pool.")
+	fmt.Fprintf(w, "yolo_sessions_created_total %d\n", snap.SessionsCreated)
+	metric("yolo_sessions_destroyed_total", "counter", "Model sessions destroyed by the pool.")
+	fmt.Fprintf(w, "yolo_sessions_destroyed_total %d\n", snap.SessionsDestroyed)
+	metric("yolo_sessions_replaced_total", "counter", "Model sessions replaced after repeated Run failures.")
+	fmt.Fprintf(w, "yolo_sessions_replaced_total %d\n", snap.SessionsReplaced)
+
+	metric("yolo_rate_limited_total", "counter", "Submissions over -max-fps by action.")
+	fmt.Fprintf(w, "yolo_rate_limited_total{action=\"delayed\"} %d\n", snap.RateLimitDelayed)
+	fmt.Fprintf(w, "yolo_rate_limited_total{action=\"rejected\"} %d\n", snap.RateLimitRejected)
+	metric("yolo_rate_limit_wait_seconds_total", "counter", "Time submitters spent waiting for the rate limiter.")
+	fmt.Fprintf(w, "yolo_rate_limit_wait_seconds_total %g\n", snap.RateLimitWait)
+
+	metric("yolo_stage_duration_seconds", "histogram", "Time spent in each processing stage.")
+	for _, stage := range metricStages {
+		h := snap.Stages[stage]
+		for _, bound := range durationBuckets {
+			le := formatBound(bound)
+			fmt.Fprintf(w, "yolo_stage_duration_seconds_bucket{stage=%q,le=%q} %d\n", stage, le, h.Buckets[le])
+		}
+		fmt.Fprintf(w, "yolo_stage_duration_seconds_bucket{stage=%q,le=\"+Inf\"} %d\n", stage, h.Count)
+		fmt.Fprintf(w, "yolo_stage_duration_seconds_sum{stage=%q} %g\n", stage, h.Sum)
+		fmt.Fprintf(w, "yolo_stage_duration_seconds_count{stage=%q} %d\n", stage, h.Count)
+	}
+
+	metric("yolo_task_latency_seconds", "histogram", "End-to-end time from submission to result, including queueing.")
+	for _, bound := range durationBuckets {
+		le := formatBound(bound)
+		fmt.Fprintf(w, "yolo_task_latency_seconds_bucket{le=%q} %d\n", le, snap.Latency.Buckets[le])
+	}
+	fmt.Fprintf(w, "yolo_task_latency_seconds_bucket{le=\"+Inf\"} %d\n", snap.Latency.Count)
+	fmt.Fprintf(w, "yolo_task_latency_seconds_sum %g\n", snap.Latency.Sum)
+	fmt.Fprintf(w, "yolo_task_latency_seconds_count %d\n", snap.Latency.Count)
+
+	if *kafkaBrokers != "" {
+		metric("yolo_kafka_messages_total", "counter", "Kafka sink messages by outcome.")
+		fmt.Fprintf(w, "yolo_kafka_messages_total{status=\"delivered\"} %d\n", snap.KafkaDelivered)
+		fmt.Fprintf(w, "yolo_kafka_messages_total{status=\"failed\"} %d\n", snap.KafkaFailed)
+		fmt.Fprintf(w, "yolo_kafka_messages_total{status=\"dropped\"} %d\n", snap.KafkaDropped)
+	}
+
+	if isStreamInput(*inputImagePath) {
+		metric("yolo_stream_reconnects_total", "counter", "Video stream reconnects after stream loss or connection failure.")
+		fmt.Fprintf(w, "yolo_stream_reconnects_total %d\n", snap.StreamReconnects)
+	}
+	if *adaptiveDrop > 0 && (isStreamInput(*inputImagePath) || isCameraInput(*inputImagePath)) {
+		metric("yolo_stream_frames_dropped_total", "counter", "Video frames dropped by adaptive frame dropping to keep up with the stream.")
+		fmt.Fprintf(w, "yolo_stream_frames_dropped_total %d\n", snap.StreamDropped)
+	}
+
+	if snap.ResidentMemory > 0 {
+		metric("process_resident_memory_bytes", "gauge", "Resident memory size in bytes.")
+		fmt.Fprintf(w, "process_resident_memory_bytes %d\n", snap.ResidentMemory)
+	}
+}
+
+// quoteLabelValue 按 Prometheus 文本格式转义标签值（反斜杠、双引号、换行），
+// 与 %q 不同，非 ASCII 字符（如中文类别名）原样输出
+func quoteLabelValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// residentMemory 返回进程的常驻内存（RSS），从 /proc/self/statm 读取；不支持的平台返回错误，不输出该指标
+func residentMemory() (int64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("无法解析 /proc/self/statm: %q", data)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+// startMetricsServer 在 addr 上提供 /metrics（Prometheus 文本格式）和 /debug/vars（expvar JSON）
+// 监听失败时立即返回错误；返回的服务器由调用方在退出前关闭
+func startMetricsServer(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听监控地址 %s 失败: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.WritePrometheus(w)
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			writeLogFile("ERROR", fmt.Sprintf("监控服务退出: %v", err))
+		}
+	}()
+	return server, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 一行样本：指标名、可选的标签集合、值
+var sampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(?:\{(.*)\})? (\S+)$`)
+
+// 标签集合中的一个标签，值按 Prometheus 文本格式转义
+var labelPair = regexp.MustCompile(`([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\]|\\.)*)",?`)
+
+// scrapedMetrics 解析后的抓取结果：指标名+标签名集合 -> 各样本的标签值与值
+type scrapedMetrics struct {
+	types   map[string]string            // # TYPE 声明的指标族类型
+	samples map[string]map[string]string // "name{label,...}" -> 标签值（以 , 连接）-> 值
+}
+
+// scrapeMetrics 从 /metrics 抓取并解析 Prometheus 文本格式，格式不合法时测试失败
+func scrapeMetrics(t *testing.T, url string) scrapedMetrics {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return parseMetrics(t, resp.Body)
+}
+
+func parseMetrics(t *testing.T, r io.Reader) scrapedMetrics {
+	t.Helper()
+	scraped := scrapedMetrics{types: make(map[string]string), samples: make(map[string]map[string]string)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			scraped.types[fields[2]] = fields[3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := sampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("不合法的样本行: %q", line)
+			continue
+		}
+		name, value := m[1], m[3]
+		family := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, "_bucket"), "_sum"), "_count")
+		if _, ok := scraped.types[name]; !ok {
+			if _, ok := scraped.types[family]; !ok {
+				t.Errorf("样本 %s 之前没有 # TYPE 声明", name)
+			}
+		}
+		var names, values []string
+		for _, pair := range labelPair.FindAllStringSubmatch(m[2], -1) {
+			names = append(names, pair[1])
+			values = append(values, pair[2])
+		}
+		key := name + "{" + strings.Join(names, ",") + "}"
+		if scraped.samples[key] == nil {
+			scraped.samples[key] = make(map[string]string)
+		}
+		scraped.samples[key][strings.Join(values, ",")] = value
+	}
+	return scraped
+}
+
+// freeAddr 返回一个当前可用的本地监听地址
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestMetricsScrape(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	defer func(saved *detectorMetrics) { metrics = saved }(metrics)
+	metrics = newDetectorMetrics()
+	useFakeSessions(t)
+	config.BatchSize, config.BatchCollect = 1, 1
+
+	// 经过工作协程的任务更新阶段耗时、端到端耗时和失败计数
+	manager := NewVideoDetectorManager(2, 4, time.Hour)
+	defer manager.Stop()
+	for i := range 3 {
+		callback := make(chan DetectionResult, 1)
+		if err := manager.SubmitTaskWait(context.Background(), &DetectionTask{ImagePath: missingImage(i), Callback: callback}); err != nil {
+			t.Fatal(err)
+		}
+		<-callback
+	}
+	// 检测成功的任务按类别计数（假会话无法推理，直接记录结果）
+	var result DetectionResult
+	result.Objects = []boundingBox{{label: "person"}, {label: "person"}, {label: `a "quoted" \ label`}, {label: "安全帽"}}
+	metrics.recordResult(result)
+	metrics.recordResult(DetectionResult{Error: fmt.Errorf("推理: %w", ErrSessionRunFailed)})
+
+	addr := freeAddr(t)
+	server, err := startMetricsServer(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	scraped := scrapeMetrics(t, "http://"+addr+"/metrics")
+
+	// 指标名和标签集合
+	for name, kind := range map[string]string{
+		"yolo_tasks_total":            "counter",
+		"yolo_detections_total":       "counter",
+		"yolo_task_errors_total":      "counter",
+		"yolo_queue_length":           "gauge",
+		"yolo_sessions":               "gauge",
+		"yolo_stage_duration_seconds": "histogram",
+		"yolo_task_latency_seconds":   "histogram",
+	} {
+		if scraped.types[name] != kind {
+			t.Errorf("%s 的类型 = %q，期望 %s", name, scraped.types[name], kind)
+		}
+	}
+	tests := []struct {
+		series string   // 指标名{标签名,...}
+		values []string // 应出现的标签值组合（以 , 连接），nil 表示不带标签
+	}{
+		{"yolo_tasks_total{}", []string{""}},
+		{"yolo_detections_total{class}", []string{"person", `a \"quoted\" \\ label`, "安全帽"}},
+		{"yolo_task_errors_total{kind}", metricErrorKinds},
+		{"yolo_queue_length{}", []string{""}},
+		{"yolo_sessions{state}", []string{"active", "idle"}},
+		{"yolo_sessions_created_total{}", []string{""}},
+		{"yolo_stage_duration_seconds_bucket{stage,le}", []string{"load,0.001", "load,+Inf", "inference,10", "postprocess,+Inf"}},
+		{"yolo_stage_duration_seconds_sum{stage}", metricStages},
+		{"yolo_stage_duration_seconds_count{stage}", metricStages},
+		{"yolo_task_latency_seconds_bucket{le}", []string{"0.001", "10", "+Inf"}},
+		{"yolo_task_latency_seconds_sum{}", []string{""}},
+		{"yolo_task_latency_seconds_count{}", []string{""}},
+		{"process_resident_memory_bytes{}", []string{""}},
+	}
+	for _, tt := range tests {
+		samples, ok := scraped.samples[tt.series]
+		if !ok {
+			t.Errorf("缺少 %s", tt.series)
+			continue
+		}
+		for _, values := range tt.values {
+			if _, ok := samples[values]; !ok {
+				t.Errorf("%s 缺少标签值 %q，得到 %v", tt.series, values, samples)
+			}
+		}
+	}
+
+	// 计数与提交的任务一致
+	want := map[string]string{
+		"yolo_tasks_total{}":                     "5",
+		"yolo_task_latency_seconds_count{}":      "3",
+		"yolo_task_errors_total{kind}/other":     "3",
+		"yolo_task_errors_total{kind}/inference": "1",
+		"yolo_detections_total{class}/person":    "2",
+		"yolo_detections_total{class}/安全帽":       "1",
+	}
+	for key, value := range want {
+		series, labels, _ := strings.Cut(key, "/")
+		if got := scraped.samples[series][labels]; got != value {
+			t.Errorf("%s = %q，期望 %s", key, got, value)
+		}
+	}
+}
+
+func TestMetricErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w（50ms）", ErrTaskTimeout), "timeout"},
+		{fmt.Errorf("%w: %w", ErrTaskTimeout, ErrSessionRunFailed), "timeout"},
+		{fmt.Errorf("推理: %w", ErrSessionRunFailed), "inference"},
+		{ErrTaskPanic, "panic"},
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "canceled"},
+		{ErrManagerStopped, "stopped"},
+		{ErrSessionAcquireTimeout, "session"},
+		{ErrSessionPoolClosed, "session"},
+		{errors.New("加载图像失败"), "other"},
+	}
+	for _, tt := range tests {
+		if got := metricErrorKind(tt.err); got != tt.want || !slices.Contains(metricErrorKinds, got) {
+			t.Errorf("metricErrorKind(%v) = %s，期望 %s", tt.err, got, tt.want)
+		}
+	}
+}
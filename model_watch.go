@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// 模型热加载参数：按间隔检查模型文件的修改时间，变化后自动热加载
+var watchModelInterval = &config.WatchModel
+
+// ReloadModel 热加载新模型，正在执行的任务在旧会话上完成
+// 加载失败时原有会话不受影响
+func (manager *VideoDetectorManager) ReloadModel(modelPath string) error {
+	start := time.Now()
+	if err := manager.sessionPool.ReloadModel(modelPath); err != nil {
+		writeLogFile("ERROR", fmt.Sprintf("模型热加载失败 (%s): %v", modelPath, err))
+		return err
+	}
+	message := fmt.Sprintf("模型热加载完成: %s，耗时 %v", modelPath, time.Since(start))
+	fmt.Printf("%s\n", message)
+	writeLogFile("INFO", message)
+	return nil
+}
+
+// watchModel 轮询模型文件的修改时间，任一模型文件变化后热加载全部模型
+// 新文件可能仍在写入中：加载失败时不更新记录的修改时间，下一个周期自动重试
+func (manager *VideoDetectorManager) watchModel(interval time.Duration) {
+	defer manager.wg.Done()
+
+	manager.sessionPool.mutex.Lock()
+	modelPath := manager.sessionPool.modelPath
+	manager.sessionPool.mutex.Unlock()
+
+	paths := splitModelPaths(modelPath)
+	lastMod := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			lastMod[path] = info.ModTime()
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-manager.shutdown:
+			return
+		case <-ticker.C:
+		}
+
+		changed := make(map[string]time.Time)
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // 替换过程中文件可能暂时不存在
+			}
+			if !info.ModTime().Equal(lastMod[path]) {
+				changed[path] = info.ModTime()
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if err := manager.ReloadModel(modelPath); err != nil {
+			fmt.Printf("警告: %v\n", err)
+			continue
+		}
+		for path, mod := range changed {
+			lastMod[path] = mod
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 模型清单参数
+var (
+	modelManifestPath = &config.ModelManifest
+	modelCacheDir     = &config.ModelCache
+)
+
+// modelManifestSchema 当前支持的模型清单格式版本
+const modelManifestSchema = 1
+
+// embeddedModelManifest 随程序发布的默认模型清单
+//
+//go:embed models.json
+var embeddedModelManifest []byte
+
+// modelManifest 模型名称到下载地址、校验值和输入参数的映射
+type modelManifest struct {
+	SchemaVersion int           `json:"schema_version"`
+	BaseURL       string        `json:"base_url"` // 条目未给出 url 时，下载地址为 base_url + file
+	Models        []modelRecord `json:"models"`
+}
+
+// modelRecord 清单中的单个模型
+type modelRecord struct {
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	URL       string `json:"url,omitempty"`
+	SHA256    string `json:"sha256,omitempty"` // 为空时下载后不校验（会给出警告）
+	Size      int64  `json:"size,omitempty"`
+	InputSize int    `json:"input_size"`
+	Classes   int    `json:"classes"`
+}
+
+// downloadURL 返回模型的下载地址
+func (m modelRecord) downloadURL(base string) string {
+	if m.URL != "" {
+		return m.URL
+	}
+	return base + m.File
+}
+
+// loadModelManifest 读取模型清单：-model-manifest 指定时使用本地文件（离线环境可指向内网地址），否则使用内置清单
+func loadModelManifest() (modelManifest, string, error) {
+	data, source := embeddedModelManifest, "内置清单"
+	if *modelManifestPath != "" {
+		var err error
+		if data, err = os.ReadFile(*modelManifestPath); err != nil {
+			return modelManifest{}, "", fmt.Errorf("读取模型清单失败: %w", err)
+		}
+		source = *modelManifestPath
+	}
+	var manifest modelManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return modelManifest{}, "", fmt.Errorf("解析模型清单 %s 失败: %w", source, err)
+	}
+	if manifest.SchemaVersion > modelManifestSchema {
+		return modelManifest{}, "", fmt.Errorf("模型清单 %s 的格式版本 %d 高于当前支持的版本 %d，请升级程序",
+			source, manifest.SchemaVersion, modelManifestSchema)
+	}
+	return manifest, source, nil
+}
+
+// lookup 按名称查找模型（忽略大小写和 .onnx 后缀）
+func (m modelManifest) lookup(name string) (modelRecord, bool) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".onnx")
+	for _, model := range m.Models {
+		if strings.ToLower(model.Name) == name {
+			return model, true
+		}
+	}
+	return modelRecord{}, false
+}
+
+// names 返回清单中的全部模型名称
+func (m modelManifest) names() []string {
+	names := make([]string, len(m.Models))
+	for i, model := range m.Models {
+		names[i] = model.Name
+	}
+	return names
+}
+
+// modelCacheRoot 返回模型缓存目录，-model-cache 为空时使用用户缓存目录
+func modelCacheRoot() (string, error) {
+	if *modelCacheDir != "" {
+		return *modelCacheDir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("无法确定用户缓存目录，请使用 -model-cache 指定: %w", err)
+	}
+	return filepath.Join(dir, "yolo-go-detector", "models"), nil
+}
+
+// isModelName 判断 -model 的值是模型名称（如 yolo11n）而不是文件路径
+func isModelName(value string) bool {
+	return !strings.ContainsAny(value, `/\`) && filepath.Ext(value) == ""
+}
+
+// resolveModelPaths 将 -model 中的模型名称解析为本地缓存路径，缓存中不存在时按清单下载
+// 已存在的文件和带路径/扩展名的值保持不变
+func resolveModelPaths(list string) (string, error) {
+	paths := splitModelPaths(list)
+	var manifest *modelManifest
+	for i, path := range paths {
+		if _, err := os.Stat(path); err == nil || !isModelName(path) {
+			continue
+		}
+		if manifest == nil {
+			m, _, err := loadModelManifest()
+			if err != nil {
+				return "", err
+			}
+			manifest = &m
+		}
+		model, ok := manifest.lookup(path)
+		if !ok {
+			return "", fmt.Errorf("未知的模型 %q，可用的模型: %s（也可以直接指定 .onnx 文件路径）",
+				path, strings.Join(manifest.names(), ", "))
+		}
+		resolved, err := ensureModelCached(model, manifest.BaseURL)
+		if err != nil {
+			return "", err
+		}
+		paths[i] = resolved
+	}
+	return strings.Join(paths, ","), nil
+}
+
+// resolveConfiguredModels 解析全局配置中的模型名称
+func resolveConfiguredModels() error {
+	resolved, err := resolveModelPaths(config.ModelPath)
+	if err != nil {
+		return err
+	}
+	config.ModelPath = resolved
+	return nil
+}
+
+// cachedModelPath 返回模型在缓存目录中的路径
+func cachedModelPath(model modelRecord) (string, error) {
+	root, err := modelCacheRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, model.File), nil
+}
+
+// ensureModelCached 确保模型已在缓存目录中，不存在时下载并校验 sha256
+func ensureModelCached(model modelRecord, baseURL string) (string, error) {
+	path, err := cachedModelPath(model)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("创建模型缓存目录失败: %w", err)
+	}
+
+	url := model.downloadURL(baseURL)
+	fmt.Printf("下载模型 %s: %s -> %s\n", model.Name, url, path)
+	if err := downloadModel(url, path, model); err != nil {
+		return "", fmt.Errorf("下载模型 %s 失败: %w", model.Name, err)
+	}
+	if model.SHA256 == "" {
+		fmt.Printf("警告: 模型清单未提供 %s 的 sha256，已跳过校验\n", model.Name)
+	}
+	return path, nil
+}
+
+// downloadModel 下载到临时文件，校验大小和 sha256 后再重命名，避免中断留下不完整的模型
+func downloadModel(url, path string, model modelRecord) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("服务器返回 %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), model.File+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if model.Size > 0 && written != model.Size {
+		return fmt.Errorf("文件大小 %d 与清单中的 %d 不一致", written, model.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); model.SHA256 != "" && !strings.EqualFold(sum, model.SHA256) {
+		return fmt.Errorf("sha256 校验失败: 期望 %s，实际 %s", model.SHA256, sum)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runModelsCommand models 子命令：list 列出清单中的模型及本地缓存状态
+func runModelsCommand(subcommand string) bool {
+	if subcommand != "list" {
+		fmt.Printf("用法: yolo-go-detector models list [-model-manifest 清单文件] [-model-cache 缓存目录]\n")
+		return false
+	}
+	manifest, source, err := loadModelManifest()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return false
+	}
+	fmt.Printf("模型清单: %s\n", source)
+	fmt.Printf("%-10s %-6s %-6s %s\n", "名称", "输入", "类别", "本地缓存")
+	for _, model := range manifest.Models {
+		status := "未下载"
+		if path, err := cachedModelPath(model); err == nil {
+			if _, err := os.Stat(path); err == nil {
+				status = path
+			}
+		}
+		fmt.Printf("%-10s %-6d %-6d %s\n", model.Name, model.InputSize, model.Classes, status)
+	}
+	return true
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MQTT 发布参数
+var (
+	mqttBroker   = &config.MQTTBroker
+	mqttTopic    = &config.MQTTTopic
+	mqttClientID = &config.MQTTClientID
+	mqttUsername = &config.MQTTUsername
+	mqttPassword = &config.MQTTPassword
+	mqttCA       = &config.MQTTCA
+	mqttCert     = &config.MQTTCert
+	mqttKey      = &config.MQTTKey
+	mqttQoS      = &config.MQTTQoS
+	mqttRetain   = &config.MQTTRetain
+	mqttClasses  = &config.MQTTClasses
+)
+
+const (
+	mqttQueueSize    = 1024             // 等待发布的消息数上限，断线期间超出的消息丢弃
+	mqttKeepAlive    = 60 * time.Second // CONNECT 中声明的保活时间，空闲一半时间后发送 PINGREQ
+	mqttIOTimeout    = 10 * time.Second // 连接、发布和等待确认的超时时间
+	mqttMaxBackoff   = 30 * time.Second // 重连间隔上限，从 1 秒开始翻倍
+	mqttPasswordEnv  = "MQTT_PASSWORD"  // 未指定 -mqtt-password 时从该环境变量读取密码
+	mqttProtocolName = "MQTT"
+	mqttProtocolV311 = 4
+)
+
+// ErrMQTTRefused 代理拒绝连接（CONNACK 返回码不为 0）
+var ErrMQTTRefused = errors.New("MQTT 代理拒绝连接")
+
+// MQTTEvent 发布到 -mqtt-topic 的检测事件
+type MQTTEvent struct {
+	Source     string            `json:"source"`
+	Timestamp  time.Time         `json:"timestamp"`
+	TaskID     uint64            `json:"task_id,omitempty"`
+	Width      int               `json:"width,omitempty"`
+	Height     int               `json:"height,omitempty"`
+	Count      int               `json:"count"`
+	Counts     map[string]int    `json:"counts"` // 按类别统计的检测数
+	Detections []DetectionObject `json:"detections"`
+}
+
+// mqttConn 已连接的 MQTT 会话；mqttSink 只在发布协程中使用，不需要并发安全
+// 测试时可以替换为不连接网络的实现
+type mqttConn interface {
+	Publish(topic string, qos byte, retain bool, payload []byte) error
+	Ping() error
+	Close() error
+}
+
+// mqttSink 把含检测目标的结果发布到 MQTT 代理
+// Write 只把消息放入队列，由发布协程连接、发布和断线重连（间隔从 1 秒翻倍到 30 秒），检测不会因代理不可用而阻塞；
+// 断线期间队列写满后的消息丢弃并计数，Close 时汇总
+type mqttSink struct {
+	mutex    sync.Mutex
+	name     string
+	topic    string
+	qos      byte
+	retain   bool
+	filter   *classFilter // -mqtt-classes，为 nil 时发布所有检测目标
+	dial     func() (mqttConn, error)
+	queue    chan []byte
+	stopping chan struct{} // Close 开始时关闭，中止重连等待
+	done     chan struct{}
+	closed   bool
+	dropped  atomic.Int64 // 队列已满丢弃的消息数
+	failed   atomic.Int64 // 关闭时仍未能发布的消息数
+}
+
+// newMQTTSink 按 -mqtt-* 参数创建发布输出；代理地址、TLS 证书或 QoS 无效时返回错误，连接在发布协程中建立
+func newMQTTSink() (*mqttSink, error) {
+	if *mqttQoS != 0 && *mqttQoS != 1 {
+		return nil, fmt.Errorf("不支持的 MQTT QoS %d（支持 0、1）", *mqttQoS)
+	}
+	if *mqttTopic == "" {
+		return nil, fmt.Errorf("-mqtt-topic 不能为空")
+	}
+	filter, err := parseClassFilter(*mqttClasses, "")
+	if err != nil {
+		return nil, fmt.Errorf("解析 -mqtt-classes 失败: %w", err)
+	}
+	dial, err := mqttDialer()
+	if err != nil {
+		return nil, err
+	}
+	s := &mqttSink{
+		name:     "mqtt:" + *mqttBroker + "/" + *mqttTopic,
+		topic:    *mqttTopic,
+		qos:      byte(*mqttQoS),
+		retain:   *mqttRetain,
+		filter:   filter,
+		dial:     dial,
+		queue:    make(chan []byte, mqttQueueSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+func (s *mqttSink) Name() string { return s.name }
+
+// Write 没有（经 -mqtt-classes 过滤后）检测目标或处理失败的结果不发布
+func (s *mqttSink) Write(record ResultRecord) error {
+	if record.Error != "" {
+		return nil
+	}
+	event := MQTTEvent{
+		Source:     record.ImagePath,
+		Timestamp:  record.Timestamp,
+		TaskID:     record.TaskID,
+		Width:      record.Width,
+		Height:     record.Height,
+		Counts:     make(map[string]int),
+		Detections: make([]DetectionObject, 0, len(record.Detections)),
+	}
+	for _, d := range record.Detections {
+		if s.filter.allows(d.Label) {
+			event.Detections = append(event.Detections, d)
+			event.Counts[d.Label]++
+		}
+	}
+	if event.Count = len(event.Detections); event.Count == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	select {
+	case s.queue <- payload:
+	default:
+		if s.dropped.Add(1) == 1 {
+			writeLogFile("WARN", fmt.Sprintf("%s 发布队列已满，开始丢弃消息", s.name))
+		}
+	}
+	return nil
+}
+
+// loop 发布协程：按顺序发布队列中的消息，空闲时发送心跳
+func (s *mqttSink) loop() {
+	defer close(s.done)
+	var conn mqttConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case payload, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			conn = s.publish(conn, payload)
+		case <-ticker.C:
+			if conn != nil {
+				if err := conn.Ping(); err != nil {
+					writeLogFile("WARN", fmt.Sprintf("%s 连接已断开: %v", s.name, err))
+					conn.Close()
+					conn = nil
+				}
+			}
+		}
+	}
+}
+
+// publish 发布一条消息，未连接或发布失败时重连后重试，直到成功或 Close 开始；返回当前连接
+func (s *mqttSink) publish(conn mqttConn, payload []byte) mqttConn {
+	backoff := time.Second
+	for {
+		if conn == nil {
+			var err error
+			if conn, err = s.dial(); err != nil {
+				writeLogFile("WARN", fmt.Sprintf("%s 连接失败，%v 后重试: %v", s.name, backoff, err))
+				select {
+				case <-time.After(backoff):
+				case <-s.stopping:
+					s.failed.Add(1)
+					return nil
+				}
+				if backoff *= 2; backoff > mqttMaxBackoff {
+					backoff = mqttMaxBackoff
+				}
+				continue
+			}
+			writeLogFile("INFO", fmt.Sprintf("%s 已连接", s.name))
+		}
+		err := conn.Publish(s.topic, s.qos, s.retain, payload)
+		if err == nil {
+			return conn
+		}
+		writeLogFile("WARN", fmt.Sprintf("%s 发布失败，重新连接: %v", s.name, err))
+		conn.Close()
+		conn = nil
+		select {
+		case <-s.stopping:
+			s.failed.Add(1)
+			return nil
+		default:
+		}
+	}
+}
+
+// Flush 发布协程逐条发布，没有需要额外刷新的缓冲
+func (s *mqttSink) Flush() error { return nil }
+
+// Close 发布队列中剩余的消息后断开连接；此时代理不可用则不再重连，剩余消息计为失败
+func (s *mqttSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.stopping)
+	close(s.queue)
+	s.mutex.Unlock()
+	<-s.done
+
+	if dropped, failed := s.dropped.Load(), s.failed.Load(); dropped+failed > 0 {
+		return fmt.Errorf("%d 条消息因队列已满被丢弃，%d 条消息未能发布（详见日志）", dropped, failed)
+	}
+	return nil
+}
+
+// mqttDialer 解析 -mqtt-broker（tcp://、mqtt://、ssl://、tls://、mqtts://，省略协议时为 tcp）和 TLS、认证参数
+func mqttDialer() (func() (mqttConn, error), error) {
+	broker := *mqttBroker
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的 MQTT 代理地址 %q", *mqttBroker)
+	}
+	var tlsConfig *tls.Config
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		port = "8883"
+		if tlsConfig, err = mqttTLSConfig(u.Hostname()); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 MQTT 代理协议 %q（支持 tcp、ssl、tls、mqtts）", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	clientID := *mqttClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = fmt.Sprintf("yolo-go-detector-%s-%d", hostname, os.Getpid())
+	}
+	password := *mqttPassword
+	if password == "" {
+		password = os.Getenv(mqttPasswordEnv)
+	}
+	return func() (mqttConn, error) {
+		c, err := dialMQTT(addr, tlsConfig, clientID, *mqttUsername, password)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}, nil
+}
+
+// mqttTLSConfig -mqtt-ca 指定信任的 CA（默认使用系统根证书），-mqtt-cert/-mqtt-key 指定客户端证书
+func mqttTLSConfig(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if *mqttCA != "" {
+		pem, err := os.ReadFile(*mqttCA)
+		if err != nil {
+			return nil, fmt.Errorf("读取 MQTT CA 证书失败: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MQTT CA 证书 %s 中没有有效的证书", *mqttCA)
+		}
+	}
+	if *mqttCert != "" || *mqttKey != "" {
+		cert, err := tls.LoadX509KeyPair(*mqttCert, *mqttKey)
+		if err != nil {
+			return nil, fmt.Errorf("加载 MQTT 客户端证书失败: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// mqttClient MQTT 3.1.1 客户端，只实现发布所需的报文（CONNECT、PUBLISH QoS 0/1、PINGREQ、DISCONNECT）
+type mqttClient struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+}
+
+// MQTT 报文类型（固定报头高 4 位）
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPingreq    = 12
+	mqttPingresp   = 13
+	mqttDisconnect = 14
+)
+
+// dialMQTT 建立连接并完成 CONNECT/CONNACK（清除会话）
+func dialMQTT(addr string, tlsConfig *tls.Config, clientID, username, password string) (*mqttClient, error) {
+	dialer := &net.Dialer{Timeout: mqttIOTimeout}
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	flags := byte(0x02) // 清除会话
+	body := mqttString(nil, mqttProtocolName)
+	payload := mqttString(nil, clientID)
+	if username != "" {
+		flags |= 0x80
+		payload = mqttString(payload, username)
+		if password != "" {
+			flags |= 0x40
+			payload = mqttString(payload, password)
+		}
+	}
+	body = append(body, mqttProtocolV311, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(mqttKeepAlive/time.Second))
+	if err := c.write(mqttConnect<<4, append(body, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	kind, resp, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("等待 CONNACK 失败: %w", err)
+	}
+	if kind != mqttConnack || len(resp) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT 代理返回了意外的报文（类型 %d）", kind)
+	}
+	if code := resp[1]; code != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrMQTTRefused, mqttConnackReason(code))
+	}
+	return c, nil
+}
+
+// Publish QoS 1 时等待代理的 PUBACK
+func (c *mqttClient) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := mqttString(nil, topic)
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		body = binary.BigEndian.AppendUint16(body, c.packetID)
+	}
+	if err := c.write(header, append(body, payload...)); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	for {
+		kind, resp, err := c.read()
+		if err != nil {
+			return fmt.Errorf("等待 PUBACK 失败: %w", err)
+		}
+		if kind == mqttPuback && len(resp) >= 2 && binary.BigEndian.Uint16(resp) == c.packetID {
+			return nil
+		}
+	}
+}
+
+// Ping 发送 PINGREQ 并等待 PINGRESP
+func (c *mqttClient) Ping() error {
+	if err := c.write(mqttPingreq<<4, nil); err != nil {
+		return err
+	}
+	for {
+		kind, _, err := c.read()
+		if err != nil {
+			return err
+		}
+		if kind == mqttPingresp {
+			return nil
+		}
+	}
+}
+
+// Close 发送 DISCONNECT 后关闭连接
+func (c *mqttClient) Close() error {
+	c.write(mqttDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+func (c *mqttClient) write(header byte, body []byte) error {
+	packet := append([]byte{header}, mqttRemainingLength(len(body))...)
+	c.conn.SetWriteDeadline(time.Now().Add(mqttIOTimeout))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read 读取一个报文，返回报文类型和剩余部分
+func (c *mqttClient) read() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(mqttIOTimeout))
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, fmt.Errorf("MQTT 报文长度无效")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// mqttRemainingLength 按 MQTT 变长编码剩余长度
+func mqttRemainingLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+// mqttString 追加带 2 字节长度前缀的 UTF-8 字符串
+func mqttString(dst []byte, s string) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(s)))
+	return append(dst, s...)
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "不支持的协议版本"
+	case 2:
+		return "客户端ID被拒绝"
+	case 3:
+		return "服务不可用"
+	case 4:
+		return "用户名或密码错误"
+	case 5:
+		return "未授权"
+	}
+	return fmt.Sprintf("返回码 %d", code)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mqttPacket 测试代理收到的一个报文
+type mqttPacket struct {
+	kind  byte // 报文类型
+	flags byte // 固定报头低 4 位（PUBLISH 的 QoS 和保留标志）
+	body  []byte
+}
+
+// fakeBroker 进程内的 MQTT 代理：接受 CONNECT，QoS 1 的 PUBLISH 回复 PUBACK，收到的报文依次送入 packets
+type fakeBroker struct {
+	listener net.Listener
+	packets  chan mqttPacket
+	refuse   byte // CONNACK 返回码
+}
+
+func newFakeBroker(t *testing.T, refuse byte) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: listener, packets: make(chan mqttPacket, 64), refuse: refuse}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	client := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+	for {
+		header, err := client.reader.Peek(1)
+		if err != nil {
+			return
+		}
+		flags := header[0] & 0x0F
+		kind, body, err := client.read()
+		if err != nil {
+			return
+		}
+		b.packets <- mqttPacket{kind: kind, flags: flags, body: body}
+		switch {
+		case kind == mqttConnect:
+			client.write(mqttConnack<<4, []byte{0, b.refuse})
+		case kind == mqttPublish && flags&0x06 != 0:
+			_, rest := readMQTTString(body)
+			client.write(mqttPuback<<4, rest[:2]) // 报文标识符
+		case kind == mqttPingreq:
+			client.write(mqttPingresp<<4, nil)
+		case kind == mqttDisconnect:
+			return
+		}
+	}
+}
+
+// next 等待下一个报文
+func (b *fakeBroker) next(t *testing.T) mqttPacket {
+	t.Helper()
+	select {
+	case p := <-b.packets:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("代理没有收到报文")
+		return mqttPacket{}
+	}
+}
+
+// readMQTTString 读取带 2 字节长度前缀的字符串
+func readMQTTString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func TestMQTTSinkPublishesToBroker(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.MQTTTopic, config.MQTTClientID = "site/cam1", "detector-1"
+	config.MQTTUsername, config.MQTTPassword = "edge", "secret"
+	config.MQTTClasses = "person,dog"
+
+	tests := []struct {
+		name   string
+		qos    int
+		retain bool
+	}{
+		{"QoS 0", 0, false},
+		{"QoS 1 保留消息", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeBroker(t, 0)
+			config.MQTTBroker = "tcp://" + broker.listener.Addr().String()
+			config.MQTTQoS, config.MQTTRetain = tt.qos, tt.retain
+			sink, err := newMQTTSink()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 处理失败、没有检测目标、检测目标都被 -mqtt-classes 过滤的结果不发布
+			sink.Write(ResultRecord{ImagePath: "bad.jpg", Error: "解码失败", Detections: []DetectionObject{{Label: "person"}}})
+			sink.Write(ResultRecord{ImagePath: "empty.jpg"})
+			sink.Write(ResultRecord{ImagePath: "car.jpg", Detections: []DetectionObject{{Label: "car"}}})
+			record := ResultRecord{ImagePath: "frame.jpg", TaskID: 7, Width: 640, Height: 480, Detections: []DetectionObject{
+				{Label: "person", Confidence: 0.9}, {Label: "car", Confidence: 0.8}, {Label: "person", Confidence: 0.7}, {Label: "dog", Confidence: 0.6},
+			}}
+			if err := sink.Write(record); err != nil {
+				t.Fatal(err)
+			}
+
+			connect := broker.next(t)
+			if connect.kind != mqttConnect {
+				t.Fatalf("第一个报文类型 = %d，期望 CONNECT", connect.kind)
+			}
+			protocol, rest := readMQTTString(connect.body)
+			flags := rest[1]
+			clientID, rest := readMQTTString(rest[4:])
+			username, rest := readMQTTString(rest)
+			password, _ := readMQTTString(rest)
+			// 0xC2：用户名、密码、清除会话
+			if protocol != "MQTT" || flags != 0xC2 || clientID != "detector-1" || username != "edge" || password != "secret" {
+				t.Errorf("CONNECT = %s flags=%#x client=%s user=%s password=%s", protocol, flags, clientID, username, password)
+			}
+
+			publish := broker.next(t)
+			if publish.kind != mqttPublish {
+				t.Fatalf("第二个报文类型 = %d，期望 PUBLISH", publish.kind)
+			}
+			if qos, retain := int(publish.flags>>1&0x03), publish.flags&0x01 != 0; qos != tt.qos || retain != tt.retain {
+				t.Errorf("PUBLISH QoS = %d，保留 = %v，期望 %d、%v", qos, retain, tt.qos, tt.retain)
+			}
+			topic, payload := readMQTTString(publish.body)
+			if tt.qos > 0 {
+				payload = payload[2:] // 报文标识符
+			}
+			if topic != "site/cam1" {
+				t.Errorf("主题 = %s", topic)
+			}
+			var event MQTTEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Fatal(err)
+			}
+			labels := make([]string, 0, len(event.Detections))
+			for _, d := range event.Detections {
+				labels = append(labels, d.Label)
+			}
+			if event.Source != "frame.jpg" || event.TaskID != 7 || event.Width != 640 || event.Count != 3 ||
+				event.Counts["person"] != 2 || event.Counts["dog"] != 1 || !slices.Equal(labels, []string{"person", "person", "dog"}) {
+				t.Errorf("事件 = %+v", event)
+			}
+
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if p := broker.next(t); p.kind != mqttDisconnect {
+				t.Errorf("关闭时的报文类型 = %d，期望 DISCONNECT", p.kind)
+			}
+		})
+	}
+}
+
+// fakeMQTTConn 记录发布的消息，failPublish 次发布失败后成功
+type fakeMQTTConn struct {
+	mutex       *sync.Mutex
+	published   *[]string
+	failPublish *int
+}
+
+func (c fakeMQTTConn) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if *c.failPublish > 0 {
+		*c.failPublish--
+		return io.ErrUnexpectedEOF
+	}
+	var event MQTTEvent
+	json.Unmarshal(payload, &event)
+	*c.published = append(*c.published, event.Source)
+	return nil
+}
+
+func (c fakeMQTTConn) Ping() error  { return nil }
+func (c fakeMQTTConn) Close() error { return nil }
+
+// newTestMQTTSink 创建使用 dial 连接的发布输出
+func newTestMQTTSink(dial func() (mqttConn, error)) *mqttSink {
+	s := &mqttSink{
+		name:     "mqtt:test",
+		topic:    "test",
+		dial:     dial,
+		queue:    make(chan []byte, mqttQueueSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func TestMQTTSinkReconnects(t *testing.T) {
+	var mutex sync.Mutex
+	var published []string
+	var dials int
+	failDials, failPublish := 1, 1
+	conn := fakeMQTTConn{mutex: &mutex, published: &published, failPublish: &failPublish}
+	sink := newTestMQTTSink(func() (mqttConn, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		dials++
+		if failDials > 0 {
+			failDials--
+			return nil, errors.New("connection refused")
+		}
+		return conn, nil
+	})
+
+	// 代理不可用时写入不阻塞
+	start := time.Now()
+	for _, source := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		if err := sink.Write(ResultRecord{ImagePath: source, Detections: []DetectionObject{{Label: "person"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("代理不可用时写入耗时 %v", elapsed)
+	}
+
+	// 连接失败后等待 1 秒重连，发布失败后重新连接并重发同一条消息，消息顺序不变
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mutex.Lock()
+		n := len(published)
+		mutex.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("重连后没有发布全部消息")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(published, []string{"a.jpg", "b.jpg", "c.jpg"}) || dials != 3 {
+		t.Errorf("发布 = %v，连接 %d 次，期望按顺序发布且连接 3 次", published, dials)
+	}
+}
+
+func TestMQTTSinkCloseWhileBrokerDown(t *testing.T) {
+	sink := newTestMQTTSink(func() (mqttConn, error) { return nil, errors.New("connection refused") })
+	for range 3 {
+		sink.Write(ResultRecord{ImagePath: "a.jpg", Detections: []DetectionObject{{Label: "person"}}})
+	}
+
+	// Close 不等待重连，剩余消息计为失败
+	done := make(chan error, 1)
+	go func() { done <- sink.Close() }()
+	select {
+	case err := <-done:
+		if err == nil || sink.failed.Load() != 3 {
+			t.Errorf("Close() = %v，失败 %d 条，期望 3 条", err, sink.failed.Load())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("代理不可用时 Close 没有返回")
+	}
+	if err := sink.Write(ResultRecord{ImagePath: "b.jpg", Detections: []DetectionObject{{Label: "person"}}}); err == nil {
+		t.Error("关闭后写入应返回错误")
+	}
+}
+
+func TestDialMQTTRefused(t *testing.T) {
+	broker := newFakeBroker(t, 4)
+	_, err := dialMQTT(broker.listener.Addr().String(), nil, "detector", "edge", "wrong")
+	if !errors.Is(err, ErrMQTTRefused) {
+		t.Errorf("dialMQTT() error = %v，期望 ErrMQTTRefused", err)
+	}
+}
+
+func TestNewMQTTSinkRejectsBadConfig(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		name   string
+		broker string
+		topic  string
+		qos    int
+	}{
+		{"QoS 2", "tcp://localhost:1883", "yolo", 2},
+		{"空主题", "tcp://localhost:1883", "", 0},
+		{"不支持的协议", "ws://localhost:1883", "yolo", 0},
+		{"缺少主机", "tcp://", "yolo", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.MQTTBroker, config.MQTTTopic, config.MQTTQoS = tt.broker, tt.topic, tt.qos
+			if sink, err := newMQTTSink(); err == nil {
+				sink.Close()
+				t.Error("newMQTTSink() 应返回错误")
+			}
+		})
+	}
+}
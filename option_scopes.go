@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 参数校验模式
+var strictOptions = &config.Strict
+
+// runContext 本次运行的参数和输入情况，用于判断各参数是否生效
+type runContext struct {
+	set         map[string]bool // 命令行中显式指定的参数
+	singleImage bool            // 输入为单张图像（不经过工作协程池）
+	video       bool            // 输入中包含视频文件
+	stream      bool            // 输入为视频流（rtsp://）
+	camera      bool            // 输入为本地摄像头（camera:N）
+}
+
+// optionScope 一组只在特定条件下生效的参数
+// 同一张表既用于解析后的交叉校验，也用于用法说明中的“参数生效条件”
+type optionScope struct {
+	flags  []string
+	scope  string                    // 生效条件
+	active func(ctx runContext) bool // 本次运行是否满足生效条件
+}
+
+// optionScopes 各参数的生效条件；不在表中的参数在所有检测模式下都生效
+var optionScopes = []optionScope{
+	{[]string{"output"}, "检测单张图像或 -output 为 s3:// 路径时（目录、列表和压缩包输入的结果保存在 ./assets）",
+		func(ctx runContext) bool {
+			return (ctx.singleImage || isS3Path(*outputImagePath)) && *taskType != taskClassify
+		}},
+	{[]string{"s3-key-template", "s3-upload-json"}, "-output 为 s3:// 路径时",
+		func(ctx runContext) bool { return isS3Path(*outputImagePath) }},
+	{[]string{"workers", "queue-size", "timeout", "batch", "batch-collect", "batch-flush", "drain-on-stop", "session-max-failures", "max-fps", "rate-limit-mode", "render-workers", "report-interval", "canary-interval", "progress", "progress-interval"},
+		"输入为目录、列表或压缩包，或 -task classify 时（单张图像检测不经过工作协程池）",
+		func(ctx runContext) bool { return !ctx.singleImage || *taskType == taskClassify }},
+	{[]string{"vid-stride"}, "输入中包含视频文件，或输入为视频流、摄像头时（-task 不为 classify）",
+		func(ctx runContext) bool { return (ctx.video || ctx.stream || ctx.camera) && *taskType != taskClassify }},
+	{[]string{"video-start", "video-end"}, "输入中包含视频文件时（-task 不为 classify）",
+		func(ctx runContext) bool { return ctx.video && *taskType != taskClassify }},
+	{[]string{"save-video"}, "输入中包含视频文件或输入为摄像头时（-task 不为 classify）",
+		func(ctx runContext) bool { return (ctx.video || ctx.camera) && *taskType != taskClassify }},
+	{[]string{"stream-fps", "stream-timeout", "adaptive-drop"}, "输入为视频流（-img rtsp://...）或摄像头（-img camera:N）时",
+		func(ctx runContext) bool { return ctx.stream || ctx.camera }},
+	{[]string{"rtsp-transport"}, "输入为视频流（-img rtsp://...）时",
+		func(ctx runContext) bool { return ctx.stream }},
+	{[]string{"camera-size"}, "输入为摄像头（-img camera:N）时",
+		func(ctx runContext) bool { return ctx.camera }},
+	{[]string{"retry-backoff"}, "-retry-attempts 大于 1 时",
+		func(ctx runContext) bool { return *retryAttempts > 1 }},
+	{[]string{"rate-limit-mode"}, "-max-fps 大于 0 时",
+		func(ctx runContext) bool { return *maxFPS > 0 }},
+	{[]string{"batch"}, "未开启 -augment 且未集成多个模型时（测试时增强和集成推理逐张推理）",
+		func(ctx runContext) bool { return !*useAugment && !ensembleEnabled() }},
+	{[]string{"tta-merge", "tta-ops", "tta-decode-conf"}, "-augment 时",
+		func(ctx runContext) bool { return *useAugment }},
+	{[]string{"rect"}, "-resize-mode letterbox 的检测任务",
+		func(ctx runContext) bool { return *resizeMode == resizeLetterbox && *taskType != taskClassify }},
+	{[]string{"resize-mode", "conf", "iou", "max-det", "nms", "classes", "exclude-classes", "augment", "output-template", "save-json", "save-txt", "fail-on-detect"}, "检测类任务（-task 不为 classify）",
+		func(ctx runContext) bool { return *taskType != taskClassify }},
+	{[]string{"soft-nms-sigma", "soft-nms-conf"}, "-nms soft 时",
+		func(ctx runContext) bool { return *nmsMethod == nmsSoft }},
+	{[]string{"topk", "cls-output"}, "-task classify 时",
+		func(ctx runContext) bool { return *taskType == taskClassify }},
+	{[]string{"kpt-conf"}, "-task pose 时",
+		func(ctx runContext) bool { return *taskType == taskPose }},
+	{[]string{"ensemble-fusion", "ensemble-iou"}, "-model 指定多个模型时",
+		func(ctx runContext) bool { return ensembleEnabled() }},
+	{[]string{"sink-flush-every", "durable"}, "配置了 -sink 时",
+		func(ctx runContext) bool { return *sinkSpecs != "" }},
+	{[]string{"save-conf", "save-empty-txt"}, "-save-txt 为 true 时",
+		func(ctx runContext) bool { return *saveTxt }},
+	{[]string{"coco-annotations", "coco-category-map"}, "指定了 -coco-out 时",
+		func(ctx runContext) bool { return *cocoOut != "" }},
+	{[]string{"labelstudio-from", "labelstudio-to", "labelstudio-prefix"}, "指定了 -labelstudio-out 时",
+		func(ctx runContext) bool { return *labelStudioOut != "" }},
+	{[]string{"coco-out", "cvat-out", "labelstudio-out"}, "检测类任务（-task 不为 classify）",
+		func(ctx runContext) bool { return *taskType != taskClassify }},
+	{[]string{"skip-existing", "preserve-structure", "result-format"}, "批量检测（输入为目录、列表或压缩包，-task 不为 classify）",
+		func(ctx runContext) bool { return !ctx.singleImage && *taskType != taskClassify }},
+	{[]string{"overwrite", "no-clobber"}, "输出路径自动生成时（未指定 -output 或 -output 为 s3:// 前缀，-task 不为 classify）",
+		func(ctx runContext) bool {
+			return (!ctx.singleImage || !ctx.set["output"] || isS3Path(*outputImagePath)) && *taskType != taskClassify
+		}},
+	{[]string{"force"}, "-skip-existing 为 true 时",
+		func(ctx runContext) bool { return *skipExisting }},
+	{[]string{"progress-interval"}, "-progress 为 true 时",
+		func(ctx runContext) bool { return *showProgress }},
+	{[]string{"report-file"}, "-report-interval 大于 0 时",
+		func(ctx runContext) bool { return *reportInterval > 0 }},
+	{[]string{"canary-failures"}, "-canary-interval 大于 0 时",
+		func(ctx runContext) bool { return *canaryInterval > 0 }},
+	{[]string{"system-text", "text-location"}, "-enable-system-text 为 true 时",
+		func(ctx runContext) bool { return *systemTextEnabled }},
+	{[]string{"cpu-arena", "mem-pattern"}, "未开启 -low-mem 时（-low-mem 会关闭这两项）",
+		func(ctx runContext) bool { return !*lowMemMode }},
+	{[]string{"inter-threads"}, "-exec-mode parallel 时",
+		func(ctx runContext) bool { return *execMode == "parallel" }},
+	{[]string{"redis-addr", "redis-results", "redis-stream", "redis-dead-letter", "redis-max-attempts"}, "指定了 -redis-queue 时（队列消费模式）",
+		func(ctx runContext) bool { return *redisQueue != "" }},
+	{[]string{"webhook-retries", "webhook-thumbnail"}, "指定了 -webhook-url 时",
+		func(ctx runContext) bool { return *webhookURL != "" }},
+	{[]string{"on-detect-timeout"}, "指定了 -on-detect-cmd 时",
+		func(ctx runContext) bool { return *onDetectCmd != "" }},
+	{[]string{"alert-cooldown"}, "指定了 -webhook-url 或 -on-detect-cmd 时",
+		func(ctx runContext) bool { return *webhookURL != "" || *onDetectCmd != "" }},
+	{[]string{"rectdiff-out", "rectdiff-iou"}, "rectdiff 子命令",
+		func(ctx runContext) bool { return false }},
+	{[]string{"selftest-image", "selftest-expect"}, "selftest 子命令或 -canary-interval 大于 0 时",
+		func(ctx runContext) bool { return *canaryInterval > 0 }},
+}
+
+// explicitFlags 返回命令行中显式指定的参数
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// ineffectiveOptions 返回本次运行中显式指定但不会生效或互相矛盾的参数
+func ineffectiveOptions(ctx runContext) []string {
+	var problems []string
+	reported := make(map[string]bool)
+	for _, scope := range optionScopes {
+		if scope.active(ctx) {
+			continue
+		}
+		for _, name := range scope.flags {
+			if ctx.set[name] && !reported[name] {
+				reported[name] = true
+				problems = append(problems, fmt.Sprintf("-%s 本次运行不会生效（生效条件: %s）", name, scope.scope))
+			}
+		}
+	}
+
+	// 互相矛盾的设置
+	if ctx.set["classes"] || ctx.set["exclude-classes"] {
+		if filter, err := parseClassFilter(*includeClasses, *excludeClasses); err != nil {
+			problems = append(problems, err.Error())
+		} else if filter != nil {
+			for label := range filter.include {
+				if filter.exclude[label] {
+					problems = append(problems, fmt.Sprintf("类别 %s 同时出现在 -classes 和 -exclude-classes 中，不会保留任何该类别的检测框", label))
+				}
+			}
+		}
+	}
+	if *overwriteOutputs && *noClobber {
+		problems = append(problems, "-overwrite 和 -no-clobber 不能同时指定")
+	}
+	if ctx.set["soft-nms-conf"] && *softNMSMinConf > *confidenceThreshold {
+		problems = append(problems, "-soft-nms-conf 高于 -conf，Soft-NMS 衰减后的框会全部被丢弃")
+	}
+	if ctx.set["tta-decode-conf"] && *ttaDecodeConf > *confidenceThreshold {
+		problems = append(problems, "-tta-decode-conf 高于 -conf，实际按 -conf 解码")
+	}
+	return problems
+}
+
+// validateOptionScopes 检查显式指定却不会生效或互相矛盾的参数
+// -strict（默认）时列出所有问题并返回错误，否则只打印警告并写入日志
+func validateOptionScopes(ctx runContext) error {
+	problems := ineffectiveOptions(ctx)
+	if len(problems) == 0 {
+		return nil
+	}
+	if *strictOptions {
+		return fmt.Errorf("以下参数不会生效或互相矛盾（使用 -strict=false 改为只警告）:\n  %s", strings.Join(problems, "\n  "))
+	}
+	for _, problem := range problems {
+		fmt.Printf("警告: %s\n", problem)
+		writeLogFile("WARN", problem)
+	}
+	return nil
+}
+
+// inputIsSingleImage 判断输入是否为单张图像（与 main 中的处理方式判断一致）
+func inputIsSingleImage(imagePaths []string) bool {
+	if info, err := os.Stat(*inputImagePath); err == nil && info.IsDir() {
+		return false
+	}
+	return len(imagePaths) == 1
+}
+
+// printUsage 在默认的参数说明之后列出只在特定条件下生效的参数
+func printUsage(fs *flag.FlagSet) func() {
+	return func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "用法: %s [参数]\n", os.Args[0])
+		fmt.Fprintf(out, "      %s models list | selftest | rectdiff | query [参数]\n\n", os.Args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(out, "\n参数生效条件（-strict 时指定了不生效的参数会拒绝启动）:\n")
+		for _, scope := range optionScopes {
+			names := make([]string, len(scope.flags))
+			for i, name := range scope.flags {
+				names[i] = "-" + name
+			}
+			fmt.Fprintf(out, "  %s: %s\n", strings.Join(names, ", "), scope.scope)
+		}
+	}
+}
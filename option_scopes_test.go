@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+// parseTestFlags 用默认配置解析 args，返回显式指定的参数
+func parseTestFlags(t *testing.T, args ...string) map[string]bool {
+	t.Helper()
+	config = DefaultDetectorConfig()
+	fs := flag.NewFlagSet("detector", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return explicitFlags(fs)
+}
+
+func TestIneffectiveOptions(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	single := runContext{singleImage: true}
+	batch := runContext{}
+	tests := []struct {
+		name string
+		args []string
+		ctx  runContext
+		want []string // 每条期望的问题中包含的文字，为空表示没有问题
+	}{
+		{"单张图像的常用参数", []string{"-conf", "0.4", "-output", "out.jpg"}, single, nil},
+		{"批量检测的常用参数", []string{"-workers", "8", "-batch", "4", "-save-txt", "-save-conf"}, batch, nil},
+		{"目录输入指定 -output", []string{"-output", "out.jpg"}, batch, []string{"-output"}},
+		{"单张图像指定 -workers", []string{"-workers", "8"}, single, []string{"-workers"}},
+		{"-augment 与 -batch", []string{"-augment", "-batch", "4"}, batch, []string{"-batch"}},
+		{"未开启 -augment 时的 -tta-ops", []string{"-tta-ops", "flipV"}, single, []string{"-tta-ops"}},
+		{"-resize-mode stretch 与 -rect", []string{"-resize-mode", "stretch", "-rect"}, single, []string{"-rect"}},
+		{"分类任务的检测参数", []string{"-task", "classify", "-conf", "0.4", "-classes", "person"}, batch, []string{"-conf", "-classes"}},
+		{"检测任务的 -topk", []string{"-topk", "3"}, single, []string{"-topk"}},
+		{"未知类别", []string{"-classes", "unicorn"}, single, []string{"unicorn"}},
+		{"同一类别既保留又排除", []string{"-classes", "person,car", "-exclude-classes", "car"}, single, []string{"类别 car"}},
+		{"-overwrite 与 -no-clobber", []string{"-overwrite", "-no-clobber"}, batch, []string{"不能同时指定"}},
+		{"hard NMS 的 -soft-nms-sigma", []string{"-soft-nms-sigma", "0.3"}, single, []string{"-soft-nms-sigma"}},
+		{"-soft-nms-conf 高于 -conf", []string{"-nms", "soft", "-soft-nms-conf", "0.5", "-conf", "0.3"}, single, []string{"Soft-NMS"}},
+		{"未配置 -sink 时的 -durable", []string{"-durable"}, batch, []string{"-durable"}},
+		{"图片输入的视频流参数", []string{"-rtsp-transport", "udp", "-vid-stride", "2"}, batch, []string{"-vid-stride", "-rtsp-transport"}},
+		{"视频流参数", []string{"-rtsp-transport", "udp", "-vid-stride", "2"}, runContext{stream: true}, nil},
+		{"同一参数只报告一次", []string{"-rate-limit-mode", "reject"}, single, []string{"-rate-limit-mode"}}, // 同时属于工作协程池和 -max-fps 两组
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.ctx.set = parseTestFlags(t, tt.args...)
+			problems := ineffectiveOptions(tt.ctx)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("得到 %d 个问题，期望 %d 个:\n  %s", len(problems), len(tt.want), strings.Join(problems, "\n  "))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("第 %d 个问题 %q 应包含 %q", i+1, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateOptionScopesStrict(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	for _, strict := range []bool{true, false} {
+		set := parseTestFlags(t, "-strict="+map[bool]string{true: "true", false: "false"}[strict], "-topk", "3", "-overwrite", "-no-clobber")
+		err := validateOptionScopes(runContext{set: set})
+		if strict {
+			// 一次列出所有问题
+			if err == nil || !strings.Contains(err.Error(), "-topk") || !strings.Contains(err.Error(), "-no-clobber") {
+				t.Errorf("-strict 时 validateOptionScopes() = %v，期望列出所有问题", err)
+			}
+		} else if err != nil {
+			t.Errorf("-strict=false 时只警告，validateOptionScopes() = %v", err)
+		}
+	}
+}
+
+func TestOptionScopesNameRegisteredFlags(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	fs := flag.NewFlagSet("detector", flag.ContinueOnError)
+	RegisterFlags(fs)
+	for _, scope := range optionScopes {
+		for _, name := range scope.flags {
+			if fs.Lookup(name) == nil {
+				t.Errorf("生效条件表中的 -%s 不是已注册的参数", name)
+			}
+		}
+	}
+
+	// 用法说明列出同一张表
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+	printUsage(fs)()
+	for _, scope := range optionScopes {
+		if !strings.Contains(out.String(), scope.scope) {
+			t.Errorf("用法说明中缺少生效条件 %q", scope.scope)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 输出检查参数
+var outputGuardMode = &config.OutputGuard
+
+// 输出检查模式
+const (
+	guardOff  = "off"  // 不检查
+	guardLog  = "log"  // 记录日志和计数，照常输出结果
+	guardFail = "fail" // 记录日志和计数，并以 OutputAnomalyError 使任务失败
+)
+
+// 输出异常类型
+const (
+	anomalyNaN       = "nan"
+	anomalyInf       = "inf"
+	anomalyZeroBlock = "zero-block"       // 整个输出或某个坐标通道全为 0
+	anomalyConfRange = "conf-range"       // 置信度超出 [0, 1]
+	anomalyConfDrift = "confidence-drift" // 最高置信度与近期统计相差过大
+)
+
+// 置信度滚动统计的窗口大小、开始判断所需的最少样本数和判定阈值
+const (
+	confWindowSize   = 64
+	confMinSamples   = 16
+	confDriftSigma   = 6
+	confMinDeviation = 0.1 // 标准差下限，避免近期结果非常稳定时误报
+)
+
+// OutputAnomalyError 模型输出未通过检查（-output-guard fail）
+type OutputAnomalyError struct {
+	Model    string
+	Provider string
+	Kinds    []string
+	Detail   string
+}
+
+func (e *OutputAnomalyError) Error() string {
+	return fmt.Sprintf("模型 %s 输出异常 (%s, %s): %s", e.Model, e.Provider, strings.Join(e.Kinds, ","), e.Detail)
+}
+
+// outputAnomaly 一次检查发现的一类异常
+type outputAnomaly struct {
+	kind   string
+	detail string
+}
+
+// confidenceWindow 某个模型最近若干次推理的最高置信度
+type confidenceWindow struct {
+	values []float64
+	next   int
+}
+
+// 输出检查的全局状态：按 提供程序/异常类型 的计数和按模型的置信度窗口
+var (
+	outputGuardMutex  sync.Mutex
+	outputAnomalies   = make(map[string]int64)
+	confidenceWindows = make(map[string]*confidenceWindow)
+)
+
+// sessionProvider 返回会话的执行提供程序及精度，用于按提供程序统计异常
+// 目前只使用 CPU 执行提供程序，float16 模型单独统计
+func sessionProvider(session *ModelSession) string {
+	if session.halfInput != nil {
+		return "CPU-fp16"
+	}
+	return "CPU"
+}
+
+// checkSessionOutput 检查会话输出中单张图像的部分（output 为该图像的切片）
+// 发现异常时记录日志和计数；-output-guard fail 时返回 *OutputAnomalyError
+func checkSessionOutput(session *ModelSession, output []float32) error {
+	if *outputGuardMode == guardOff {
+		return nil
+	}
+	anomalies, maxConf := inspectOutput(output, session.Layout)
+
+	provider := sessionProvider(session)
+	outputGuardMutex.Lock()
+	if len(anomalies) == 0 {
+		// 只有正常的输出才进入滚动统计，避免异常值拉偏基线
+		if a, ok := confidenceWindows[session.Name].drift(maxConf); ok {
+			anomalies = append(anomalies, a)
+		} else {
+			confidenceWindows[session.Name] = confidenceWindows[session.Name].add(maxConf)
+		}
+	}
+	for _, a := range anomalies {
+		outputAnomalies[provider+"/"+a.kind]++
+	}
+	outputGuardMutex.Unlock()
+
+	if len(anomalies) == 0 {
+		return nil
+	}
+	kinds := make([]string, len(anomalies))
+	details := make([]string, len(anomalies))
+	for i, a := range anomalies {
+		kinds[i] = a.kind
+		details[i] = a.detail
+	}
+	err := &OutputAnomalyError{Model: session.Name, Provider: provider, Kinds: kinds, Detail: strings.Join(details, "; ")}
+	writeLogFile("WARN", err.Error())
+	if *outputGuardMode == guardFail {
+		return err
+	}
+	return nil
+}
+
+// inspectOutput 单次遍历输出，统计 NaN/Inf、全零块和置信度范围，并返回最高置信度
+func inspectOutput(output []float32, layout outputLayout) ([]outputAnomaly, float64) {
+	var anomalies []outputAnomaly
+	nan, inf, nonZero := 0, 0, 0
+	for _, v := range output {
+		switch {
+		case v != v:
+			nan++
+		case math.IsInf(float64(v), 0):
+			inf++
+		case v != 0:
+			nonZero++
+		}
+	}
+	if nan > 0 {
+		anomalies = append(anomalies, outputAnomaly{anomalyNaN, fmt.Sprintf("%d 个 NaN（共 %d 个值）", nan, len(output))})
+	}
+	if inf > 0 {
+		anomalies = append(anomalies, outputAnomaly{anomalyInf, fmt.Sprintf("%d 个 Inf（共 %d 个值）", inf, len(output))})
+	}
+	if len(output) > 0 && nonZero == 0 && nan == 0 && inf == 0 {
+		return append(anomalies, outputAnomaly{anomalyZeroBlock, "输出全为 0"}), 0
+	}
+	if layout.Format != formatCls && layout.NumAnchors > 0 && len(output) >= layout.slotSize() {
+		// 坐标通道（x, y, w, h 或 x1, y1, x2, y2）在所有锚点上全为 0 说明输出已损坏
+		for ch := 0; ch < 4; ch++ {
+			zero := true
+			for a := 0; a < layout.NumAnchors && zero; a++ {
+				zero = layout.at(output, ch, a) == 0
+			}
+			if zero {
+				anomalies = append(anomalies, outputAnomaly{anomalyZeroBlock, fmt.Sprintf("坐标通道 %d 全为 0", ch)})
+				break
+			}
+		}
+	}
+
+	maxConf := maxOutputConfidence(output, layout)
+	if !math.IsNaN(maxConf) && (maxConf < -1e-3 || maxConf > 1+1e-3) {
+		anomalies = append(anomalies, outputAnomaly{anomalyConfRange, fmt.Sprintf("最高置信度 %.4f 超出 [0, 1]", maxConf)})
+	}
+	return anomalies, maxConf
+}
+
+// maxOutputConfidence 返回输出中的最高类别置信度（v5 格式乘以 objectness）
+func maxOutputConfidence(output []float32, layout outputLayout) float64 {
+	best := math.Inf(-1)
+	switch layout.Format {
+	case formatCls:
+		for _, v := range output {
+			best = math.Max(best, float64(v))
+		}
+	case formatE2E:
+		for a := 0; a < layout.NumAnchors && (a+1)*layout.NumChannels <= len(output); a++ {
+			best = math.Max(best, float64(layout.at(output, 4, a)))
+		}
+	default:
+		if len(output) < layout.slotSize() {
+			return math.NaN()
+		}
+		offset, classes := layout.classOffset(), layout.numClasses()
+		for a := 0; a < layout.NumAnchors; a++ {
+			scale := float32(1)
+			if layout.Format == formatV5 {
+				scale = layout.at(output, 4, a)
+			}
+			for c := 0; c < classes; c++ {
+				best = math.Max(best, float64(layout.at(output, offset+c, a)*scale))
+			}
+		}
+	}
+	if math.IsInf(best, -1) {
+		return math.NaN()
+	}
+	return best
+}
+
+// drift 判断最高置信度是否明显偏离近期统计，样本不足时不判断
+func (w *confidenceWindow) drift(value float64) (outputAnomaly, bool) {
+	if w == nil || len(w.values) < confMinSamples || math.IsNaN(value) {
+		return outputAnomaly{}, false
+	}
+	var mean float64
+	for _, v := range w.values {
+		mean += v
+	}
+	mean /= float64(len(w.values))
+	var variance float64
+	for _, v := range w.values {
+		variance += (v - mean) * (v - mean)
+	}
+	std := math.Max(math.Sqrt(variance/float64(len(w.values))), confMinDeviation)
+	if math.Abs(value-mean) <= confDriftSigma*std {
+		return outputAnomaly{}, false
+	}
+	return outputAnomaly{anomalyConfDrift, fmt.Sprintf("最高置信度 %.4f 偏离近期均值 %.4f 超过 %d 倍标准差 (%.4f)",
+		value, mean, confDriftSigma, std)}, true
+}
+
+// add 加入一个样本，窗口满后覆盖最旧的样本
+func (w *confidenceWindow) add(value float64) *confidenceWindow {
+	if w == nil {
+		w = &confidenceWindow{}
+	}
+	if math.IsNaN(value) {
+		return w
+	}
+	if len(w.values) < confWindowSize {
+		w.values = append(w.values, value)
+		return w
+	}
+	w.values[w.next] = value
+	w.next = (w.next + 1) % confWindowSize
+	return w
+}
+
+// outputAnomalyCounts 返回按 提供程序/异常类型 统计的异常次数快照
+func outputAnomalyCounts() map[string]int64 {
+	outputGuardMutex.Lock()
+	defer outputGuardMutex.Unlock()
+	counts := make(map[string]int64, len(outputAnomalies))
+	for k, v := range outputAnomalies {
+		counts[k] = v
+	}
+	return counts
+}
+
+// formatAnomalyCounts 将异常计数格式化为一行文本，没有异常时返回空字符串
+func formatAnomalyCounts(counts map[string]int64) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestInspectOutputAnomalies(t *testing.T) {
+	output, layout := v8Output([]string{"person", "car"}, []testAnchor{
+		{cx: 50, cy: 50, w: 20, h: 40, class: 0, conf: 0.9},
+		{cx: 200, cy: 200, w: 60, h: 30, class: 1, conf: 0.6},
+	})
+	corrupt := func(change func(out []float32)) []float32 {
+		out := slices.Clone(output)
+		change(out)
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		output []float32
+		kinds  []string
+	}{
+		{"正常输出", output, nil},
+		{"NaN", corrupt(func(out []float32) { out[5] = float32(math.NaN()) }), []string{anomalyNaN}},
+		{"Inf", corrupt(func(out []float32) { out[0] = float32(math.Inf(1)) }), []string{anomalyInf}},
+		{"NaN 和 Inf", corrupt(func(out []float32) { out[0], out[1] = float32(math.NaN()), float32(math.Inf(-1)) }), []string{anomalyNaN, anomalyInf}},
+		{"全为 0", make([]float32, len(output)), []string{anomalyZeroBlock}},
+		{"坐标通道全为 0", corrupt(func(out []float32) { out[2*layout.NumAnchors], out[2*layout.NumAnchors+1] = 0, 0 }), []string{anomalyZeroBlock}},
+		{"置信度大于 1", corrupt(func(out []float32) { out[4*layout.NumAnchors] = 3.5 }), []string{anomalyConfRange}},
+		{"置信度为负", corrupt(func(out []float32) {
+			for i := 4 * layout.NumAnchors; i < len(out); i++ {
+				out[i] = -0.5
+			}
+		}), []string{anomalyConfRange}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies, _ := inspectOutput(tt.output, layout)
+			var kinds []string
+			for _, a := range anomalies {
+				kinds = append(kinds, a.kind)
+			}
+			if !slices.Equal(kinds, tt.kinds) {
+				t.Errorf("异常类型 = %v，期望 %v", kinds, tt.kinds)
+			}
+		})
+	}
+
+	if _, maxConf := inspectOutput(output, layout); math.Abs(maxConf-0.9) > 1e-6 {
+		t.Errorf("最高置信度 = %v，期望 0.9", maxConf)
+	}
+	v5, v5Layout := v5Output([]string{"person"}, []testAnchor{{cx: 50, cy: 50, w: 20, h: 40, conf: 0.9}}, []float32{0.5})
+	if _, maxConf := inspectOutput(v5, v5Layout); math.Abs(maxConf-0.45) > 1e-6 {
+		t.Errorf("v5 最高置信度 = %v，期望 objectness * 类别概率 = 0.45", maxConf)
+	}
+}
+
+func TestConfidenceWindowDrift(t *testing.T) {
+	var stable *confidenceWindow
+	for i := 0; i < confMinSamples; i++ {
+		stable = stable.add(0.8 + 0.01*float64(i%3))
+	}
+	var few *confidenceWindow
+	for i := 0; i < confMinSamples-1; i++ {
+		few = few.add(0.8)
+	}
+
+	tests := []struct {
+		name   string
+		window *confidenceWindow
+		value  float64
+		drift  bool
+	}{
+		{"与近期一致", stable, 0.78, false},
+		{"标准差下限内的波动", stable, 0.5, false},
+		{"远低于近期（全部为 0 的结果）", stable, 0.01, true},
+		{"远高于近期", stable, 1.5, true},
+		{"样本不足不判断", few, 0.0, false},
+		{"没有样本", nil, 0.0, false},
+		{"NaN 不判断", stable, math.NaN(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, drift := tt.window.drift(tt.value)
+			if drift != tt.drift {
+				t.Errorf("drift(%v) = %v (%s)，期望 %v", tt.value, drift, a.detail, tt.drift)
+			}
+			if drift && a.kind != anomalyConfDrift {
+				t.Errorf("异常类型 = %s", a.kind)
+			}
+		})
+	}
+
+	// 窗口满后覆盖最旧的样本
+	var w *confidenceWindow
+	for i := 0; i < confWindowSize+10; i++ {
+		w = w.add(float64(i))
+	}
+	if len(w.values) != confWindowSize || slices.Contains(w.values, 9) || !slices.Contains(w.values, 10) {
+		t.Errorf("窗口 = %v", w.values)
+	}
+}
+
+func TestCheckSessionOutputModes(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	output, layout := v8Output([]string{"person"}, []testAnchor{{cx: 50, cy: 50, w: 20, h: 40, conf: 0.9}})
+	corrupted := slices.Clone(output)
+	corrupted[0] = float32(math.NaN())
+	session := &ModelSession{Layout: layout, Name: "guard-test.onnx"}
+
+	tests := []struct {
+		mode    string
+		output  []float32
+		fail    bool
+		counted int64
+	}{
+		{guardOff, corrupted, false, 0},
+		{guardLog, corrupted, false, 1},
+		{guardFail, corrupted, true, 1},
+		{guardFail, output, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config.OutputGuard = tt.mode
+			before := outputAnomalyCounts()["CPU/"+anomalyNaN]
+			err := checkSessionOutput(session, tt.output)
+			var anomaly *OutputAnomalyError
+			if errors.As(err, &anomaly) != tt.fail {
+				t.Fatalf("checkSessionOutput() = %v，期望失败: %v", err, tt.fail)
+			}
+			if tt.fail && (anomaly.Provider != "CPU" || anomaly.Model != session.Name || !slices.Contains(anomaly.Kinds, anomalyNaN)) {
+				t.Errorf("错误 = %+v", anomaly)
+			}
+			if counted := outputAnomalyCounts()["CPU/"+anomalyNaN] - before; counted != tt.counted {
+				t.Errorf("CPU/nan 计数增加 %d，期望 %d", counted, tt.counted)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// 模型输出格式
+const (
+	formatAuto = "auto"
+	formatV8   = "v8"  // YOLOv8/YOLO11: (B, 4+nc, anchors)，无 objectness
+	formatV5   = "v5"  // YOLOv5/YOLOv7: (B, anchors, 5+nc)，含 objectness
+	formatE2E  = "e2e" // YOLOv10/end2end: (B, N, 6)，每行 [x1,y1,x2,y2,score,class]，已完成 NMS
+	formatCls  = "cls" // 分类模型: (B, nc)，由 -task classify 选择
+)
+
+// 分类模型无法读取元数据时的默认类别数（ImageNet）
+const defaultClassifyClasses = 1000
+
+// 端到端模型每行的通道数及默认最大检测数
+const (
+	e2eChannels   = 6
+	e2eDefaultMax = 300
+)
+
+// 模型任务类型
+const (
+	taskDetect   = "detect"
+	taskSeg      = "seg"      // 实例分割：output0 附带掩码系数，output1 为原型掩码
+	taskPose     = "pose"     // 姿态估计：output0 附带关键点 (x, y, conf)
+	taskClassify = "classify" // 图像分类：输出 (B, nc) 的类别概率
+)
+
+// COCO 人体关键点默认形状
+const (
+	defaultNumKeypoints = 17
+	defaultKeypointDims = 3
+)
+
+// outputLayout 描述模型输出张量的排布方式
+type outputLayout struct {
+	Format      string // formatV8、formatV5 或 formatE2E
+	NumChannels int    // 每个锚点的通道数（v8: 4+nc[+nm], v5: 5+nc[+nm]）
+	NumAnchors  int    // 锚点（候选框）数量
+
+	// 实例分割模型的原型掩码（output1）形状，NumMaskCoeffs 为 0 表示非分割模型
+	NumMaskCoeffs int // 掩码系数数量（通常为 32）
+	MaskHeight    int // 原型掩码高度（通常为输入尺寸的 1/4）
+	MaskWidth     int // 原型掩码宽度
+
+	// 姿态估计模型的关键点信息，NumKeypoints 为 0 表示非姿态模型
+	NumKeypoints int // 关键点数量（COCO 为 17）
+	KeypointDims int // 每个关键点的通道数（2: x,y；3: x,y,conf）
+
+	// 模型元数据中的类别名称，为空时使用 COCO 类别
+	ClassNames []string
+}
+
+// 已解析的输出排布缓存（按模型路径+格式）
+var (
+	layoutCache      = make(map[string]outputLayout)
+	layoutCacheMutex sync.Mutex
+)
+
+// numClasses 返回类别数量（端到端格式的类别索引直接写在输出中，返回 COCO 类别数）
+func (l outputLayout) numClasses() int {
+	extra := l.NumMaskCoeffs + l.NumKeypoints*l.KeypointDims
+	switch l.Format {
+	case formatV5:
+		return l.NumChannels - 5 - extra
+	case formatE2E:
+		if len(l.ClassNames) > 0 {
+			return len(l.ClassNames)
+		}
+		return len(yoloClasses)
+	case formatCls:
+		return l.NumChannels
+	}
+	return l.NumChannels - 4 - extra
+}
+
+// classLabel 根据类别索引获取标签，优先使用该模型元数据中的类别名称（集成推理的各模型可能不同）
+func (l outputLayout) classLabel(classID int) string {
+	if classID >= 0 && classID < len(l.ClassNames) {
+		return l.ClassNames[classID]
+	}
+	return Label(classID)
+}
+
+// classOffset 返回第一个类别通道的索引（v5 格式在 box 之后多一个 objectness 通道）
+func (l outputLayout) classOffset() int {
+	if l.Format == formatV5 {
+		return 5
+	}
+	return 4
+}
+
+// maskOffset 返回第一个掩码系数通道的索引
+func (l outputLayout) maskOffset() int {
+	return l.classOffset() + l.numClasses()
+}
+
+// keypointOffset 返回第一个关键点通道的索引
+func (l outputLayout) keypointOffset() int {
+	return l.classOffset() + l.numClasses()
+}
+
+// maskShape 返回指定批次大小的原型掩码张量形状
+func (l outputLayout) maskShape(batch int) ort.Shape {
+	return ort.NewShape(int64(batch), int64(l.NumMaskCoeffs), int64(l.MaskHeight), int64(l.MaskWidth))
+}
+
+// outputNames 返回会话需要绑定的输出名称
+func (l outputLayout) outputNames() []string {
+	if l.NumMaskCoeffs > 0 {
+		return []string{"output0", "output1"}
+	}
+	return []string{"output0"}
+}
+
+// slotSize 返回单张图像在输出张量中占用的元素数量
+func (l outputLayout) slotSize() int {
+	return l.NumChannels * l.NumAnchors
+}
+
+// shape 返回指定批次大小的输出张量形状
+func (l outputLayout) shape(batch int) ort.Shape {
+	if l.Format == formatCls {
+		return ort.NewShape(int64(batch), int64(l.NumChannels))
+	}
+	if l.Format == formatV5 || l.Format == formatE2E {
+		return ort.NewShape(int64(batch), int64(l.NumAnchors), int64(l.NumChannels))
+	}
+	return ort.NewShape(int64(batch), int64(l.NumChannels), int64(l.NumAnchors))
+}
+
+// at 读取指定锚点的指定通道值，屏蔽不同格式的轴顺序差异
+func (l outputLayout) at(output []float32, channel, anchor int) float32 {
+	if l.Format == formatV5 || l.Format == formatE2E {
+		return output[anchor*l.NumChannels+channel]
+	}
+	return output[channel*l.NumAnchors+anchor]
+}
+
+// defaultOutputLayout 在无法读取模型元数据时，根据输入尺寸推算默认排布
+func defaultOutputLayout(format string, inputSize int) outputLayout {
+	// 三个检测头的步长分别为 8、16、32
+	gridCells := 0
+	for _, s := range []int{8, 16, 32} {
+		gridCells += (inputSize / s) * (inputSize / s)
+	}
+	numClasses := len(yoloClasses)
+	if format == formatE2E {
+		return outputLayout{Format: formatE2E, NumChannels: e2eChannels, NumAnchors: e2eDefaultMax}
+	}
+	if format == formatV5 {
+		// YOLOv5 每个网格有 3 个 anchor
+		return outputLayout{Format: formatV5, NumChannels: 5 + numClasses, NumAnchors: 3 * gridCells}
+	}
+	return outputLayout{Format: formatV8, NumChannels: 4 + numClasses, NumAnchors: gridCells}
+}
+
+// layoutFromShape 根据模型声明的输出形状推断排布
+// format 为 auto 时：最后一维为 6 视为端到端输出，最后一维大于第二维视为 v8（通道在前），
+// 否则视为 v5（锚点在前）
+func layoutFromShape(dims ort.Shape, format string, inputSize int) (outputLayout, error) {
+	if len(dims) != 3 {
+		return outputLayout{}, fmt.Errorf("不支持的输出维度 %v（期望 3 维）", dims)
+	}
+	d1, d2 := int(dims[1]), int(dims[2])
+	if d1 <= 0 || d2 <= 0 {
+		// 动态维度无法从元数据得知，回退到按输入尺寸推算
+		if format == formatAuto {
+			format = formatV8
+		}
+		return defaultOutputLayout(format, inputSize), nil
+	}
+
+	if format == formatAuto {
+		if d2 == e2eChannels {
+			format = formatE2E
+		} else if d2 > d1 {
+			format = formatV8
+		} else {
+			format = formatV5
+		}
+	}
+
+	var layout outputLayout
+	switch format {
+	case formatV8:
+		layout = outputLayout{Format: formatV8, NumChannels: d1, NumAnchors: d2}
+	case formatV5:
+		layout = outputLayout{Format: formatV5, NumChannels: d2, NumAnchors: d1}
+	case formatE2E:
+		if d2 != e2eChannels {
+			return outputLayout{}, fmt.Errorf("输出形状 %v 与格式 %s 不匹配（期望最后一维为 %d）", dims, format, e2eChannels)
+		}
+		layout = outputLayout{Format: formatE2E, NumChannels: d2, NumAnchors: d1}
+	default:
+		return outputLayout{}, fmt.Errorf("未知的模型格式: %s（支持 v5, v8, e2e, auto）", format)
+	}
+	if layout.numClasses() <= 0 {
+		return outputLayout{}, fmt.Errorf("输出形状 %v 与格式 %s 不匹配", dims, format)
+	}
+	return layout, nil
+}
+
+// withMasks 为分割模型补充原型掩码信息
+// protoDims 为 output1 的形状 (B, nm, mh, mw)，动态维度时按输入尺寸的 1/4 推算
+func (l outputLayout) withMasks(protoDims ort.Shape, inputSize int) (outputLayout, error) {
+	if l.Format == formatE2E {
+		return l, errors.New("端到端格式暂不支持实例分割")
+	}
+	l.NumMaskCoeffs, l.MaskHeight, l.MaskWidth = 32, inputSize/4, inputSize/4
+	if len(protoDims) == 4 {
+		if protoDims[1] > 0 {
+			l.NumMaskCoeffs = int(protoDims[1])
+		}
+		if protoDims[2] > 0 && protoDims[3] > 0 {
+			l.MaskHeight, l.MaskWidth = int(protoDims[2]), int(protoDims[3])
+		}
+	}
+	if l.numClasses() <= 0 {
+		return l, fmt.Errorf("输出通道数 %d 不足以容纳 %d 个掩码系数", l.NumChannels, l.NumMaskCoeffs)
+	}
+	return l, nil
+}
+
+// withKeypoints 为姿态估计模型补充关键点信息
+// kptShape 来自模型元数据中的 kpt_shape（如 "[17, 3]"），为空时使用 COCO 默认值
+func (l outputLayout) withKeypoints(kptShape string) (outputLayout, error) {
+	if l.Format == formatE2E {
+		return l, errors.New("端到端格式暂不支持姿态估计")
+	}
+	l.NumKeypoints, l.KeypointDims = defaultNumKeypoints, defaultKeypointDims
+	var n, d int
+	if _, err := fmt.Sscanf(strings.ReplaceAll(kptShape, " ", ""), "[%d,%d]", &n, &d); err == nil && n > 0 && d >= 2 {
+		l.NumKeypoints, l.KeypointDims = n, d
+	}
+	if l.numClasses() <= 0 {
+		return l, fmt.Errorf("输出通道数 %d 不足以容纳 %d 个关键点", l.NumChannels, l.NumKeypoints)
+	}
+	return l, nil
+}
+
+// lookupModelMetadata 读取模型自定义元数据中的指定键，读取失败时返回空字符串
+func lookupModelMetadata(path, key string) string {
+	metadata, err := ort.GetModelMetadata(path)
+	if err != nil {
+		return ""
+	}
+	defer metadata.Destroy()
+	value, ok, err := metadata.LookupCustomMetadataMap(key)
+	if err != nil || !ok {
+		return ""
+	}
+	return value
+}
+
+// invalidateLayoutCache 清除某个模型路径的输出排布缓存（模型文件被原地替换后调用）
+func invalidateLayoutCache(path string) {
+	layoutCacheMutex.Lock()
+	defer layoutCacheMutex.Unlock()
+	for key := range layoutCache {
+		if strings.HasPrefix(key, path+"|") {
+			delete(layoutCache, key)
+		}
+	}
+}
+
+// resolveOutputLayout 解析当前模型的输出排布，结果按模型路径缓存
+// 需要在 ORT 环境初始化之后调用
+func resolveOutputLayout(path, format, task string, inputSize int) (outputLayout, error) {
+	key := fmt.Sprintf("%s|%s|%s|%d", path, format, task, inputSize)
+	layoutCacheMutex.Lock()
+	defer layoutCacheMutex.Unlock()
+	if layout, ok := layoutCache[key]; ok {
+		return layout, nil
+	}
+
+	var layout outputLayout
+	_, outputs, err := ort.GetInputOutputInfo(path)
+	if task == taskClassify {
+		// 分类模型输出 (B, nc)，类别名称来自模型元数据
+		layout = outputLayout{Format: formatCls, NumChannels: defaultClassifyClasses, NumAnchors: 1}
+		if err == nil && len(outputs) > 0 {
+			dims := outputs[0].Dimensions
+			if len(dims) != 2 {
+				return outputLayout{}, fmt.Errorf("分类模型输出维度 %v 不正确（期望 2 维）", dims)
+			}
+			if dims[1] > 0 {
+				layout.NumChannels = int(dims[1])
+			}
+		}
+		layout.ClassNames = parseClassNames(lookupModelMetadata(path, "names"))
+		layoutCache[key] = layout
+		return layout, nil
+	}
+	if err != nil || len(outputs) == 0 {
+		if format == formatAuto {
+			format = formatV8
+		}
+		layout = defaultOutputLayout(format, inputSize)
+		switch task {
+		case taskSeg:
+			// 无法读取元数据时按 COCO 分割模型推算：通道数 = 4+80+32
+			layout.NumChannels += 32
+		case taskPose:
+			// 无法读取元数据时按 COCO 姿态模型推算：通道数 = 4+1+17*3
+			layout.NumChannels = layout.classOffset() + 1 + defaultNumKeypoints*defaultKeypointDims
+		}
+	} else {
+		layout, err = layoutFromShape(outputs[0].Dimensions, format, inputSize)
+		if err != nil {
+			return outputLayout{}, err
+		}
+	}
+
+	if task == taskSeg {
+		var protoDims ort.Shape
+		if len(outputs) > 1 {
+			protoDims = outputs[1].Dimensions
+		}
+		if layout, err = layout.withMasks(protoDims, inputSize); err != nil {
+			return outputLayout{}, err
+		}
+	}
+	if task == taskPose {
+		if layout, err = layout.withKeypoints(lookupModelMetadata(path, "kpt_shape")); err != nil {
+			return outputLayout{}, err
+		}
+	}
+	layout.ClassNames = parseClassNames(lookupModelMetadata(path, "names"))
+	layoutCache[key] = layout
+	return layout, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// v5Output 按 YOLOv5/YOLOv7 的 [锚点][通道] 排布生成输出张量，每个锚点为 (cx, cy, w, h, objectness, 各类别概率)
+func v5Output(classNames []string, anchors []testAnchor, objectness []float32) ([]float32, outputLayout) {
+	layout := outputLayout{Format: formatV5, NumChannels: 5 + len(classNames), NumAnchors: len(anchors), ClassNames: classNames}
+	output := make([]float32, layout.NumChannels*layout.NumAnchors)
+	for i, a := range anchors {
+		row := output[i*layout.NumChannels:]
+		row[0], row[1], row[2], row[3], row[4] = a.cx, a.cy, a.w, a.h, objectness[i]
+		row[5+a.class] = a.conf
+	}
+	return output, layout
+}
+
+func TestLayoutFromShape(t *testing.T) {
+	tests := []struct {
+		name     string
+		dims     ort.Shape
+		format   string
+		want     string // 为空表示应返回错误
+		anchors  int
+		channels int
+	}{
+		{"v8 自动识别", ort.NewShape(1, 84, 8400), formatAuto, formatV8, 8400, 84},
+		{"v5 自动识别", ort.NewShape(1, 25200, 85), formatAuto, formatV5, 25200, 85},
+		{"端到端自动识别", ort.NewShape(1, 300, 6), formatAuto, formatE2E, 300, 6},
+		{"指定 v5", ort.NewShape(1, 25200, 85), formatV5, formatV5, 25200, 85},
+		{"动态维度按输入尺寸推算", ort.NewShape(1, -1, -1), formatAuto, formatV8, 8400, 84},
+		{"动态维度指定 v5", ort.NewShape(1, -1, -1), formatV5, formatV5, 25200, 85},
+		{"端到端格式的最后一维不是 6", ort.NewShape(1, 84, 8400), formatE2E, "", 0, 0},
+		{"通道数不足", ort.NewShape(1, 25200, 5), formatV5, "", 0, 0},
+		{"未知格式", ort.NewShape(1, 84, 8400), "v9", "", 0, 0},
+		{"二维输出", ort.NewShape(1, 84), formatAuto, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := layoutFromShape(tt.dims, tt.format, 640)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("layoutFromShape(%v, %s) 应返回错误，得到 %+v", tt.dims, tt.format, layout)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout.Format != tt.want || layout.NumAnchors != tt.anchors || layout.NumChannels != tt.channels {
+				t.Errorf("排布 = %s %d 锚点 %d 通道，期望 %s %d 锚点 %d 通道",
+					layout.Format, layout.NumAnchors, layout.NumChannels, tt.want, tt.anchors, tt.channels)
+			}
+			if tt.want != formatE2E && layout.numClasses() != 80 {
+				t.Errorf("类别数 = %d，期望 80", layout.numClasses())
+			}
+		})
+	}
+}
+
+func TestProcessOutputV5(t *testing.T) {
+	classNames := []string{"person", "car"}
+	anchors := []testAnchor{
+		{cx: 50, cy: 50, w: 20, h: 40, class: 0, conf: 0.9},
+		{cx: 200, cy: 200, w: 60, h: 30, class: 1, conf: 0.8},
+		{cx: 400, cy: 400, w: 10, h: 10, class: 1, conf: 0.9},
+	}
+	output, layout := v5Output(classNames, anchors, []float32{0.9, 0.5, 0.2})
+
+	// 最终置信度 = objectness * 类别概率：0.81、0.4、0.18
+	tests := []struct {
+		name  string
+		conf  float32
+		boxes []boundingBox
+	}{
+		{"低阈值", 0.1, []boundingBox{
+			{label: "person", confidence: 0.81, x1: 40, y1: 30, x2: 60, y2: 70},
+			{label: "car", confidence: 0.4, x1: 170, y1: 185, x2: 230, y2: 215},
+			{label: "car", confidence: 0.18, x1: 395, y1: 395, x2: 405, y2: 405},
+		}},
+		{"objectness 低于阈值的锚点被跳过", 0.25, []boundingBox{
+			{label: "person", confidence: 0.81, x1: 40, y1: 30, x2: 60, y2: 70},
+			{label: "car", confidence: 0.4, x1: 170, y1: 185, x2: 230, y2: 215},
+		}},
+		{"类别概率高但乘积低于阈值", 0.5, []boundingBox{
+			{label: "person", confidence: 0.81, x1: 40, y1: 30, x2: 60, y2: 70},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boxes := processOutput(output, layout, 640, 640, tt.conf, 0.45, 300, nil, identityScale)
+			if len(boxes) != len(tt.boxes) {
+				t.Fatalf("得到 %d 个框，期望 %d 个: %+v", len(boxes), len(tt.boxes), boxes)
+			}
+			for i, want := range tt.boxes {
+				got := boxes[i]
+				if got.label != want.label || math.Abs(float64(got.confidence-want.confidence)) > 1e-5 ||
+					got.x1 != want.x1 || got.y1 != want.y1 || got.x2 != want.x2 || got.y2 != want.y2 {
+					t.Errorf("第 %d 个框 = %s %.3f [%v %v %v %v]，期望 %s %.3f [%v %v %v %v]", i,
+						got.label, got.confidence, got.x1, got.y1, got.x2, got.y2,
+						want.label, want.confidence, want.x1, want.y1, want.x2, want.y2)
+				}
+			}
+		})
+	}
+
+	// objectness 为 1 时与 v8 排布的结果相同
+	v5, v5Layout := v5Output(classNames, anchors, []float32{1, 1, 1})
+	v8, v8Layout := v8Output(classNames, anchors)
+	a := processOutput(v5, v5Layout, 640, 640, 0.25, 0.45, 300, nil, identityScale)
+	b := processOutput(v8, v8Layout, 640, 640, 0.25, 0.45, 300, nil, identityScale)
+	if len(a) != len(b) {
+		t.Fatalf("v5 得到 %d 个框，v8 得到 %d 个", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].label != b[i].label || a[i].confidence != b[i].confidence || a[i].x1 != b[i].x1 || a[i].y2 != b[i].y2 {
+			t.Errorf("第 %d 个框 v5 = %+v，v8 = %+v", i, a[i], b[i])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// 输出文件名参数
+var nameReplacement = &config.NameReplacement
+
+// maxFileNameBytes 单个文件名的最大长度（NTFS、ext4、APFS 均为 255）
+const maxFileNameBytes = 255
+
+// windowsMaxPath 不使用 \\?\ 前缀时 Windows 路径的最大长度（MAX_PATH，含结尾的 NUL）
+const windowsMaxPath = 260
+
+// windowsReservedNames Windows 上不能用作文件名的设备名（不区分大小写，带扩展名同样不可用）
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeFileName 将文件名中在 Windows（及其他常见文件系统）上无效的字符替换为 replacement
+// 处理的情况：<>:"/\|?* 和控制字符、结尾的点和空格、设备保留名（CON、NUL 等）
+// 无论当前是什么平台都按 Windows 规则处理，保证输出目录可以直接拷贝到 Windows 上
+func sanitizeFileName(name, replacement string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			b.WriteString(replacement)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	sanitized := strings.TrimRight(b.String(), ". ")
+	if sanitized == "" {
+		sanitized = "image"
+	}
+	stem := sanitized
+	if i := strings.IndexByte(stem, '.'); i >= 0 {
+		stem = stem[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(stem)] {
+		sanitized = replacement + sanitized
+	}
+	return sanitized
+}
+
+// truncateUTF8 将字符串截断到不超过 maxBytes 字节，不截断多字节字符
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
+
+// generatedOutputPath 由单张输入图像的路径按 -output-template 生成输出路径，默认为 <原文件名>_<模型标识>_<路径哈希>[_<suffix>]<扩展名>
+// 路径哈希见 outputNameHash，同一输入多次运行得到相同的输出路径；文件名先做字符清理，过长时截断原文件名部分，保证整个文件名不超过 255 字节
+// 批量输入使用 outputPathsFor / outputNamer，{index}、{count} 按输入列表取值并处理重名
+func generatedOutputPath(outputDir, imagePath, modelIdentifier string, suffix ...string) string {
+	return outputPathAt(outputDir, imagePath, modelIdentifier, 1, 1, suffix...)
+}
+
+// longPath 在 Windows 上为超过 MAX_PATH 的路径加上 \\?\ 前缀，其他平台原样返回
+func longPath(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return withLongPathPrefix(abs)
+}
+
+// withLongPathPrefix 为 Windows 绝对路径加上长路径前缀（纯字符串处理，可在任何平台验证）
+// 本地路径 C:\a\b → \\?\C:\a\b，UNC 路径 \\server\share\a → \\?\UNC\server\share\a
+// 不超过 MAX_PATH 或已有前缀的路径原样返回
+func withLongPathPrefix(abs string) string {
+	if len(abs) < windowsMaxPath || strings.HasPrefix(abs, `\\?\`) {
+		return abs
+	}
+	abs = strings.ReplaceAll(abs, "/", `\`)
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name, replacement, want string
+	}{
+		{"cam01:2024-06-01T12:00:00.jpg", "_", "cam01_2024-06-01T12_00_00.jpg"},
+		{"cam01:2024-06-01T12:00:00.jpg", "-", "cam01-2024-06-01T12-00-00.jpg"},
+		{`a<b>c"d/e\f|g?h*i.png`, "_", "a_b_c_d_e_f_g_h_i.png"},
+		{"tab\there\x7f.jpg", "", "tabhere.jpg"},
+		{"trailing. . ", "_", "trailing"},
+		{"...", "_", "image"},
+		{"CON", "_", "_CON"},
+		{"nul.txt", "_", "_nul.txt"},
+		{"com1.tar.gz", "_", "_com1.tar.gz"},
+		{"CONSOLE.jpg", "_", "CONSOLE.jpg"},
+		{"行人_检测.jpg", "_", "行人_检测.jpg"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFileName(tt.name, tt.replacement); got != tt.want {
+			t.Errorf("sanitizeFileName(%q, %q) = %q，期望 %q", tt.name, tt.replacement, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		want     string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc"},
+		{"行人检测", 7, "行人"}, // 每个汉字 3 字节，不截断在字符中间
+		{"行人检测", 6, "行人"},
+		{"行", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.maxBytes); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q，期望 %q", tt.s, tt.maxBytes, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedOutputPathSanitized(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.NameReplacement = "_"
+
+	tests := []struct {
+		name      string
+		imagePath string
+		suffix    []string
+		prefix    string // 生成的文件名应以此开头
+	}{
+		{"摄像头时间戳", "cam/cam01:2024-06-01T12:00:00.jpg", nil, "cam01_2024-06-01T12_00_00_yolo11x_"},
+		{"250 字符的文件名", strings.Repeat("a", 250) + ".jpg", nil, strings.Repeat("a", 200)},
+		{"250 字符的文件名带序号", strings.Repeat("a", 250) + ".jpg", []string{"12"}, strings.Repeat("a", 200)},
+		{"多字节字符的长文件名", strings.Repeat("行", 100) + ".jpg", nil, strings.Repeat("行", 60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := generatedOutputPath("out", tt.imagePath, "yolo11x", tt.suffix...)
+			if dir := filepath.Dir(outputPath); dir != "out" {
+				t.Errorf("输出目录 = %q，期望 out", dir)
+			}
+			name := filepath.Base(outputPath)
+			if len(name) > maxFileNameBytes || !utf8.ValidString(name) {
+				t.Errorf("文件名 %d 字节（上限 %d），有效 UTF-8: %v", len(name), maxFileNameBytes, utf8.ValidString(name))
+			}
+			if strings.ContainsAny(name, `<>:"/\|?*`) {
+				t.Errorf("文件名 %q 包含无效字符", name)
+			}
+			if !strings.HasPrefix(name, tt.prefix) || filepath.Ext(name) != ".jpg" {
+				t.Errorf("文件名 = %q，期望以 %q 开头、.jpg 结尾", name, tt.prefix)
+			}
+			for _, s := range tt.suffix {
+				if !strings.HasSuffix(name, "_"+s+".jpg") {
+					t.Errorf("截断原文件名时丢失了后缀 %q: %q", s, name)
+				}
+			}
+			if again := generatedOutputPath("out", tt.imagePath, "yolo11x", tt.suffix...); again != outputPath {
+				t.Errorf("同一输入两次生成的路径不同: %q / %q", outputPath, again)
+			}
+		})
+	}
+}
+
+func TestWithLongPathPrefix(t *testing.T) {
+	long := strings.Repeat(`d\`, 140)
+	tests := []struct {
+		name, abs, want string
+	}{
+		{"短路径不变", `C:\out\a.jpg`, `C:\out\a.jpg`},
+		{"本地长路径", `C:\` + long + "a.jpg", `\\?\C:\` + long + "a.jpg"},
+		{"正斜杠转换为反斜杠", `C:/` + strings.ReplaceAll(long, `\`, "/") + "a.jpg", `\\?\C:\` + long + "a.jpg"},
+		{"UNC 长路径", `\\server\share\` + long + "a.jpg", `\\?\UNC\server\share\` + long + "a.jpg"},
+		{"已有前缀", `\\?\C:\` + long + "a.jpg", `\\?\C:\` + long + "a.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withLongPathPrefix(tt.abs); got != tt.want {
+				t.Errorf("withLongPathPrefix() = %q\n期望 %q", got, tt.want)
+			}
+		})
+	}
+}
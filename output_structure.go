@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// preserveStructure 批量处理时在输出目录中保留输入的子目录结构
+var preserveStructure = &config.PreserveStructure
+
+// structureRoot 返回 -preserve-structure 计算相对路径的起点：
+// 目录输入为该目录，通配符模式为不含通配符的前缀目录，s3:// 前缀为该前缀，其他输入（.txt 列表、标准输入）为当前目录
+// 压缩包中的图像总是相对于压缩包根目录（见 relativeOutputDir）
+func structureRoot(input string) string {
+	if isS3Path(input) {
+		return input
+	}
+	if info, err := os.Stat(input); err == nil && info.IsDir() {
+		return input
+	}
+	if isGlobPattern(input) {
+		root, _ := splitGlobRoot(input)
+		return root
+	}
+	return "."
+}
+
+// relativeOutputDir 返回图像所在目录相对于 root 的路径，用于在输出目录中创建同样的子目录
+// 不在 root 之下的图像（.. 开头、不同盘符）、http(s) URL 以及位于 root 本身的图像返回 ""，直接保存在输出目录中；
+// 压缩包条目相对于压缩包根目录，tar 包解出的图像相对于解出的临时目录。返回值只含清理过的子目录名，不会跳出输出目录
+func relativeOutputDir(root, imagePath string) string {
+	if _, entry, ok := splitArchiveEntry(imagePath); ok {
+		return cleanRelativeDir(path.Dir(entry))
+	}
+	if isS3Path(imagePath) {
+		prefix := strings.TrimSuffix(root, "/") + "/"
+		if !isS3Path(root) || !strings.HasPrefix(imagePath, prefix) {
+			return ""
+		}
+		return cleanRelativeDir(path.Dir(strings.TrimPrefix(imagePath, prefix)))
+	}
+	if isURLInput(imagePath) {
+		return ""
+	}
+	if spillDir, ok := archiveSpillDirOf(imagePath); ok {
+		root = spillDir
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	absDir, err := filepath.Abs(filepath.Dir(imagePath))
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return cleanRelativeDir(filepath.ToSlash(rel))
+}
+
+// cleanRelativeDir 规范化以 / 分隔的相对目录：去掉 .. 和 .，各层目录名按 -name-replacement 做字符清理
+func cleanRelativeDir(dir string) string {
+	dir = strings.TrimPrefix(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return ""
+	}
+	segments := strings.Split(dir, "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeFileName(segment, *nameReplacement)
+	}
+	return filepath.Join(segments...)
+}
+
+// mirroredOutputDir 返回图像的输出目录：未开启 -preserve-structure 或 root 为空时为 outputDir，
+// 否则为 outputDir 加上图像相对于 root 的子目录。本地目录在写入时按需创建（writeFileAtomic）
+func mirroredOutputDir(outputDir, root, imagePath string) string {
+	if !*preserveStructure || root == "" {
+		return outputDir
+	}
+	rel := relativeOutputDir(root, imagePath)
+	if rel == "" {
+		return outputDir
+	}
+	if isS3Path(outputDir) {
+		return strings.TrimSuffix(outputDir, "/") + "/" + filepath.ToSlash(rel) + "/"
+	}
+	return filepath.Join(outputDir, rel)
+}
+
+// relativeImageName 导出标注时图像的名称：相对于输入根目录的路径（/ 分隔），与上传到标注工具的目录结构一致；
+// 压缩包条目取包内路径，URL 和不在根目录下的图像取文件名
+func relativeImageName(root, imagePath string) string {
+	if _, entry, ok := splitArchiveEntry(imagePath); ok {
+		return strings.TrimPrefix(path.Clean("/"+entry), "/")
+	}
+	if isRemoteInput(imagePath) {
+		prefix := strings.TrimSuffix(root, "/") + "/"
+		if isS3Path(root) && strings.HasPrefix(imagePath, prefix) {
+			return strings.TrimPrefix(imagePath, prefix)
+		}
+		return urlBaseName(imagePath)
+	}
+	rel, err := filepath.Rel(root, imagePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(imagePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// archiveSpillDirOf 判断图像是否位于某个 tar 包解出的临时目录中，返回该目录
+func archiveSpillDirOf(imagePath string) (string, bool) {
+	archiveSpillMutex.Lock()
+	defer archiveSpillMutex.Unlock()
+	for _, dir := range archiveSpillDirs {
+		if rel, err := filepath.Rel(dir, imagePath); err == nil && !strings.HasPrefix(rel, "..") {
+			return dir, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelativeOutputDir(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.NameReplacement = "_"
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		root      string
+		imagePath string
+		want      string // 以 / 分隔
+	}{
+		{"子目录", "camera", "camera/cam1/day1/0001.jpg", "cam1/day1"},
+		{"位于根目录本身", "camera", "camera/0001.jpg", ""},
+		{"根目录带末尾分隔符", "camera/", "camera/cam1/0001.jpg", "cam1"},
+		{"根目录含 ..", "camera/../camera", "camera/cam1/0001.jpg", "cam1"},
+		{"图像路径含 ..", "camera", "camera/cam1/../cam2/0001.jpg", "cam2"},
+		{"不在根目录下", "camera", "other/cam1/0001.jpg", ""},
+		{"前缀相同的兄弟目录", "camera", "camera2/cam1/0001.jpg", ""},
+		{"向上跳出根目录", "camera/cam1", "camera/0001.jpg", ""},
+		{"根目录为绝对路径，图像为相对路径", cwd, "camera/cam1/0001.jpg", "camera/cam1"},
+		{"根目录为当前目录", ".", "camera/cam1/0001.jpg", "camera/cam1"},
+		{"目录名中的无效字符", "camera", "camera/rtsp:cam1/0001.jpg", "rtsp_cam1"},
+		{"zip 条目", "frames.zip", "frames.zip" + archiveEntrySep + "cam1/day1/0001.jpg", "cam1/day1"},
+		{"zip 条目含 ..", "frames.zip", "frames.zip" + archiveEntrySep + "../../etc/0001.jpg", "etc"},
+		{"zip 根目录条目", "frames.zip", "frames.zip" + archiveEntrySep + "0001.jpg", ""},
+		{"s3 前缀下", "s3://bucket/frames", "s3://bucket/frames/cam1/0001.jpg", "cam1"},
+		{"s3 前缀带末尾分隔符", "s3://bucket/frames/", "s3://bucket/frames/cam1/day1/0001.jpg", "cam1/day1"},
+		{"s3 前缀相同的兄弟前缀", "s3://bucket/frames", "s3://bucket/frames2/cam1/0001.jpg", ""},
+		{"s3 对象但根目录为本地", ".", "s3://bucket/frames/cam1/0001.jpg", ""},
+		{"http URL", ".", "https://example.com/cam1/0001.jpg", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := relativeOutputDir(tt.root, tt.imagePath); got != filepath.FromSlash(tt.want) {
+				t.Errorf("relativeOutputDir(%q, %q) = %q，期望 %q", tt.root, tt.imagePath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructureRoot(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.txt")
+	if err := os.WriteFile(list, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"目录", dir, dir},
+		{"通配符", "frames/cam*/**/*.jpg", "frames"},
+		{"以通配符开头", "*/0001.jpg", "."},
+		{"s3 前缀", "s3://bucket/frames/", "s3://bucket/frames/"},
+		{"列表文件", list, "."},
+		{"标准输入", "-", "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := structureRoot(tt.input); got != tt.want {
+				t.Errorf("structureRoot(%q) = %q，期望 %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMirroredOutputDir(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	tests := []struct {
+		name      string
+		preserve  bool
+		outputDir string
+		root      string
+		imagePath string
+		want      string
+	}{
+		{"未开启 -preserve-structure", false, "out", "camera", "camera/cam1/0001.jpg", "out"},
+		{"本地输出目录", true, "out", "camera", "camera/cam1/day1/0001.jpg", filepath.Join("out", "cam1", "day1")},
+		{"没有输入根目录", true, "out", "", "camera/cam1/0001.jpg", "out"},
+		{"不在根目录下", true, "out", "camera", "other/0001.jpg", "out"},
+		{"s3 输出前缀", true, "s3://bucket/out/", "camera", "camera/cam1/day1/0001.jpg", "s3://bucket/out/cam1/day1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.PreserveStructure = tt.preserve
+			if got := mirroredOutputDir(tt.outputDir, tt.root, tt.imagePath); got != tt.want {
+				t.Errorf("mirroredOutputDir() = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputPathsForPreserveStructure(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.PreserveStructure = true
+	config.OutputTemplate = "{name}{ext}"
+	out := t.TempDir()
+
+	// 模板不含 {hash} 时，不同摄像头目录下的同名图像保存到各自的子目录中，不再重名
+	imagePaths := []string{"camera/cam1/0001.jpg", "camera/cam2/0001.jpg", "camera/0002.jpg"}
+	outputPaths := outputPathsFor(out, "camera", imagePaths, "yolo11x")
+	want := []string{filepath.Join(out, "cam1"), filepath.Join(out, "cam2"), out}
+	for i, outputPath := range outputPaths {
+		if dir := filepath.Dir(outputPath); dir != want[i] {
+			t.Errorf("%s 的输出目录 = %s，期望 %s", imagePaths[i], dir, want[i])
+		}
+	}
+	if filepath.Base(outputPaths[0]) != "0001.jpg" || filepath.Base(outputPaths[1]) != "0001.jpg" {
+		t.Errorf("保留目录结构时同名图像不应加重名后缀: %v", outputPaths)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputTemplate 生成的标注图像文件名模板
+var outputTemplate = &config.OutputTemplate
+
+// defaultOutputTemplate 默认的文件名模板，与引入 -output-template 之前的命名相同
+const defaultOutputTemplate = "{name}_{model}_{hash}{ext}"
+
+// outputNameFields 一张图像的文件名模板占位符取值
+type outputNameFields struct {
+	name  string // {name} 输入文件名（不含扩展名），URL 和 s3:// 输入取路径的最后一段
+	ext   string // {ext} 输入扩展名（含点）
+	model string // {model} 模型标识
+	hash  string // {hash} 输入路径哈希（outputNameHash），区分不同目录下的同名输入
+	conf  string // {conf} 置信度阈值（-conf）
+	date  string // {date} 生成文件名时的日期（YYYYMMDD）
+	index int    // {index} 图像在输入列表中的序号，从 1 开始
+	count int    // {count} 输入图像总数，总数未知（-img -）时为 0，展开为空
+}
+
+func newOutputNameFields(imagePath, modelIdentifier string, index, count int) outputNameFields {
+	base := filepath.Base(filepath.FromSlash(imagePath))
+	if isRemoteInput(imagePath) {
+		base = urlBaseName(imagePath)
+	}
+	ext := filepath.Ext(base)
+	return outputNameFields{
+		name:  strings.TrimSuffix(base, ext),
+		ext:   ext,
+		model: modelIdentifier,
+		hash:  outputNameHash(imagePath),
+		conf:  strconv.FormatFloat(*confidenceThreshold, 'f', -1, 64),
+		date:  time.Now().Format("20060102"),
+		index: index,
+		count: count,
+	}
+}
+
+// expand 展开模板中的占位符，suffix 依次以 _ 连接插入到扩展名之前（如 rect 对比图的 _rectdiff）
+func (f outputNameFields) expand(template string, suffix []string) string {
+	count := ""
+	if f.count > 0 {
+		count = strconv.Itoa(f.count)
+	}
+	name := strings.NewReplacer(
+		"{name}", f.name,
+		"{ext}", f.ext,
+		"{model}", f.model,
+		"{hash}", f.hash,
+		"{conf}", f.conf,
+		"{date}", f.date,
+		"{index}", strconv.Itoa(f.index),
+		"{count}", count,
+	).Replace(template)
+	if len(suffix) == 0 {
+		return name
+	}
+	tail := "_" + strings.Join(suffix, "_")
+	if f.ext != "" && strings.HasSuffix(name, f.ext) {
+		return strings.TrimSuffix(name, f.ext) + tail + f.ext
+	}
+	return name + tail
+}
+
+// fileName 按 -output-template 生成文件名：先做字符清理，过长时只截断 {name} 部分，保证整个文件名不超过 255 字节
+func (f outputNameFields) fileName(suffix []string) string {
+	f.name = sanitizeFileName(f.name, *nameReplacement)
+	render := func(name string) string {
+		g := f
+		g.name = name
+		return sanitizeFileName(g.expand(*outputTemplate, suffix), *nameReplacement)
+	}
+	fixed := len(render("")) // 模板中 {name} 以外部分的长度
+	if strings.Contains(*outputTemplate, "{name}") {
+		f.name = truncateUTF8(f.name, max(1, maxFileNameBytes-fixed))
+	}
+	return truncateUTF8(render(f.name), maxFileNameBytes)
+}
+
+// outputPathAt 生成输入列表中第 index 张（共 count 张）图像的输出路径，不处理重名
+// outputDir 为 s3:// 前缀时对象键按 -s3-key-template 生成
+func outputPathAt(outputDir, imagePath, modelIdentifier string, index, count int, suffix ...string) string {
+	fields := newOutputNameFields(imagePath, modelIdentifier, index, count)
+	if isS3Path(outputDir) {
+		return s3OutputPath(outputDir, fields, suffix)
+	}
+	return filepath.Join(outputDir, fields.fileName(suffix))
+}
+
+// outputNamer 按输入顺序为一批图像生成输出路径，并处理重名
+// 模板展开后与之前的图像重名时（如模板不含 {hash}，不同目录下有同名图像）依次加 -1、-2 后缀，
+// 同样的输入列表每次得到相同的输出路径；默认模式（collisionRename）下磁盘上已有的文件同样视为重名，
+// -overwrite、-no-clobber、-skip-existing 时不视为重名，由覆盖或跳过处理
+type outputNamer struct {
+	mutex     sync.Mutex
+	outputDir string
+	root      string // -preserve-structure 计算相对路径的起点（structureRoot）
+	model     string
+	count     int
+	index     int
+	used      map[string]bool // 已分配的路径（小写，兼容不区分大小写的文件系统）
+}
+
+// newOutputNamer 创建输出路径生成器，root 为输入的根目录（见 structureRoot），count 为输入图像总数，未知时为 0
+func newOutputNamer(outputDir, root, modelIdentifier string, count int) *outputNamer {
+	return &outputNamer{outputDir: outputDir, root: root, model: modelIdentifier, count: count, used: make(map[string]bool)}
+}
+
+// next 生成下一张图像的输出路径，可并发调用（序号按调用顺序分配）
+func (n *outputNamer) next(imagePath string) string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.index++
+	outputDir := mirroredOutputDir(n.outputDir, n.root, imagePath)
+	outputPath := outputPathAt(outputDir, imagePath, n.model, n.index, n.count)
+	if !n.taken(outputPath) {
+		n.used[strings.ToLower(outputPath)] = true
+		return outputPath
+	}
+	ext := filepath.Ext(outputPath)
+	stem := strings.TrimSuffix(outputPath, ext)
+	for i := 1; ; i++ {
+		candidate := stem + "-" + strconv.Itoa(i) + ext
+		if !n.taken(candidate) {
+			n.used[strings.ToLower(candidate)] = true
+			return candidate
+		}
+	}
+}
+
+// taken 判断输出路径是否已被本批次的图像占用，默认模式下已存在的文件同样算作占用
+func (n *outputNamer) taken(outputPath string) bool {
+	if n.used[strings.ToLower(outputPath)] {
+		return true
+	}
+	return outputCollisionMode() == collisionRename && outputExists(outputPath)
+}
+
+// outputPathsFor 为输入列表生成全部输出路径（目录、.txt 列表、压缩包等批量输入共用）
+func outputPathsFor(outputDir, root string, imagePaths []string, modelIdentifier string) []string {
+	namer := newOutputNamer(outputDir, root, modelIdentifier, len(imagePaths))
+	outputPaths := make([]string, len(imagePaths))
+	for i, imagePath := range imagePaths {
+		outputPaths[i] = namer.next(imagePath)
+	}
+	return outputPaths
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ONNX Runtime 共享库路径覆盖方式：-ort-lib 参数优先，其次为环境变量
+var ortLibPath = &config.ORTLibPath
+
+const ortLibEnv = "ONNXRUNTIME_LIB_PATH"
+
+// ortLibrary 支持的平台及对应的 ONNX Runtime 共享库文件
+type ortLibrary struct {
+	goos, goarch string
+	path         string
+}
+
+// supportedORTLibraries 平台支持矩阵
+// 库文件来自 ONNX Runtime 官方发布包，重命名后放在 third_party 目录：
+//   - windows/amd64: onnxruntime-win-x64 中的 onnxruntime.dll
+//   - windows/arm64: onnxruntime-win-arm64 中的 onnxruntime.dll
+//   - darwin/arm64、darwin/amd64: onnxruntime-osx-arm64 / onnxruntime-osx-x86_64 中的 libonnxruntime.dylib
+//   - linux/amd64、linux/arm64: onnxruntime-linux-x64 / onnxruntime-linux-aarch64 中的 libonnxruntime.so
+//
+// linux/riscv64 等平台没有官方发布包，自行编译后通过 -ort-lib 指定路径即可
+var supportedORTLibraries = []ortLibrary{
+	{"windows", "amd64", "./third_party/onnxruntime.dll"},
+	{"windows", "arm64", "./third_party/onnxruntime_arm64.dll"},
+	{"darwin", "arm64", "./third_party/onnxruntime_arm64.dylib"},
+	{"darwin", "amd64", "./third_party/onnxruntime_amd64.dylib"},
+	{"linux", "amd64", "./third_party/onnxruntime.so"},
+	{"linux", "arm64", "./third_party/onnxruntime_arm64.so"},
+}
+
+// UnsupportedPlatformError 当前平台没有内置的 ONNX Runtime 库路径
+type UnsupportedPlatformError struct {
+	GOOS, GOARCH string
+}
+
+func (e *UnsupportedPlatformError) Error() string {
+	supported := make([]string, len(supportedORTLibraries))
+	for i, lib := range supportedORTLibraries {
+		supported[i] = lib.goos + "/" + lib.goarch
+	}
+	return fmt.Sprintf("当前平台 %s/%s 没有内置的ONNX Runtime库路径（支持的平台: %s），请通过 -ort-lib 参数或环境变量 %s 指定库文件路径",
+		e.GOOS, e.GOARCH, strings.Join(supported, ", "), ortLibEnv)
+}
+
+// 获取ONNX Runtime共享库路径
+// 优先使用 -ort-lib 参数和环境变量，否则根据操作系统和架构返回相应的动态库文件路径
+func getSharedLibPath() (string, error) {
+	if *ortLibPath != "" {
+		return *ortLibPath, nil
+	}
+	if path := os.Getenv(ortLibEnv); path != "" {
+		return path, nil
+	}
+	for _, lib := range supportedORTLibraries {
+		if lib.goos == runtime.GOOS && lib.goarch == runtime.GOARCH {
+			return lib.path, nil
+		}
+	}
+	return "", &UnsupportedPlatformError{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+}
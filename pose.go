@@ -0,0 +1,139 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// 姿态估计参数
+var keypointConfThreshold = &config.KeypointConf
+
+// keypoint 姿态估计的单个关键点（原图坐标）
+type keypoint struct {
+	x, y float32
+	conf float32 // 关键点可见置信度，模型不输出置信度时为 1
+}
+
+// cocoSkeleton COCO 人体骨架连线（关键点索引从 0 开始）
+var cocoSkeleton = [][2]int{
+	{15, 13}, {13, 11}, {16, 14}, {14, 12}, {11, 12},
+	{5, 11}, {6, 12}, {5, 6}, {5, 7}, {6, 8}, {7, 9}, {8, 10},
+	{1, 2}, {0, 1}, {0, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6},
+}
+
+// cocoKeypointFlipIndex 水平翻转后左右关键点的对应关系
+var cocoKeypointFlipIndex = []int{0, 2, 1, 4, 3, 6, 5, 8, 7, 10, 9, 12, 11, 14, 13, 16, 15}
+
+// 关键点和骨架颜色
+var (
+	keypointColor = color.RGBA{0, 255, 0, 255}
+	skeletonColor = color.RGBA{255, 128, 0, 255}
+)
+
+// parseKeypoints 从模型输出中解析指定锚点的关键点，并映射回原图坐标
+func parseKeypoints(output []float32, layout outputLayout, idx int, scaleInfo ScaleInfo) []keypoint {
+	offset := layout.keypointOffset()
+	keypoints := make([]keypoint, layout.NumKeypoints)
+	for k := range keypoints {
+		base := offset + k*layout.KeypointDims
+		kp := keypoint{
+			x:    (layout.at(output, base, idx) - float32(scaleInfo.PadLeft)) / scaleInfo.ScaleX,
+			y:    (layout.at(output, base+1, idx) - float32(scaleInfo.PadTop)) / scaleInfo.ScaleY,
+			conf: 1,
+		}
+		if layout.KeypointDims >= 3 {
+			kp.conf = layout.at(output, base+2, idx)
+		}
+		keypoints[k] = kp
+	}
+	return keypoints
+}
+
+// flipKeypoints 水平翻转关键点，并按 COCO 规则交换左右关键点（用于TTA结果融合）
+func flipKeypoints(keypoints []keypoint, imageWidth int) []keypoint {
+	flipped := make([]keypoint, len(keypoints))
+	for i, kp := range keypoints {
+		j := i
+		if len(keypoints) == len(cocoKeypointFlipIndex) {
+			j = cocoKeypointFlipIndex[i]
+		}
+		kp.x = float32(imageWidth) - kp.x
+		flipped[j] = kp
+	}
+	return flipped
+}
+
+// drawKeypoints 绘制关键点和 COCO 骨架连线，跳过低置信度的关键点
+func drawKeypoints(img *image.RGBA, keypoints []keypoint) {
+	minConf := float32(*keypointConfThreshold)
+	visible := func(i int) bool {
+		return i < len(keypoints) && keypoints[i].conf >= minConf
+	}
+
+	if len(keypoints) == len(cocoKeypointFlipIndex) {
+		for _, bone := range cocoSkeleton {
+			if visible(bone[0]) && visible(bone[1]) {
+				a, b := keypoints[bone[0]], keypoints[bone[1]]
+				drawLine(img, int(a.x), int(a.y), int(b.x), int(b.y), skeletonColor)
+			}
+		}
+	}
+	for i, kp := range keypoints {
+		if visible(i) {
+			drawFilledCircle(img, int(kp.x), int(kp.y), 4, keypointColor)
+		}
+	}
+}
+
+// drawLine 使用 Bresenham 算法绘制直线（线宽 2 像素）
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	bounds := img.Bounds()
+	errTerm := dx + dy
+	for {
+		for _, p := range []image.Point{{x0, y0}, {x0 + 1, y0}, {x0, y0 + 1}} {
+			if p.In(bounds) {
+				img.SetRGBA(p.X, p.Y, c)
+			}
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * errTerm
+		if e2 >= dy {
+			errTerm += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			errTerm += dx
+			y0 += sy
+		}
+	}
+}
+
+// drawFilledCircle 绘制实心圆
+func drawFilledCircle(img *image.RGBA, cx, cy, radius int, c color.RGBA) {
+	bounds := img.Bounds()
+	for y := cy - radius; y <= cy+radius; y++ {
+		for x := cx - radius; x <= cx+radius; x++ {
+			if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= radius*radius && image.Pt(x, y).In(bounds) {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// abs 整数绝对值
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
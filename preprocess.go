@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// 预处理并行参数
+var preprocessWorkers = &config.PreprocessWorkers
+
+// 每个预处理协程至少分到的行数，行数太少时协程调度开销超过收益
+const minRowsPerWorker = 32
+
+// pixelScale 8 位通道值到 [0, 1] 浮点值的查找表，与 float32(v)/255.0 逐位相同
+var pixelScale = func() (table [256]float32) {
+	for v := range table {
+		table[v] = float32(v) / 255.0
+	}
+	return table
+}()
+
+// preprocessWorkerCount 填充 size 行输入张量使用的协程数量
+// -preprocess-workers 为 0 时取 GOMAXPROCS（最多 4 个，工作协程池中多张图像本身已在并行预处理）
+func preprocessWorkerCount(size int) int {
+	workers := *preprocessWorkers
+	if workers <= 0 {
+		workers = min(runtime.GOMAXPROCS(0), 4)
+	}
+	return max(1, min(workers, size/minRowsPerWorker))
+}
+
+// fillPlanes 将缩放后的图像按 CHW 排列写入红、绿、蓝三个平面（各 size*size）
+// *image.RGBA 直接按行跨度读取 Pix，其余图像类型回退到 At()；
+// 图像未覆盖的区域（-rect 时小于输入尺寸）写 0，与 At() 在边界外返回透明黑一致。
+// 行按协程数分段并行填充，各协程只写自己那几行对应的平面区间，互不重叠，无需同步
+func fillPlanes(img image.Image, red, green, blue []float32, size int) {
+	fillRows := func(y0, y1 int) { fillPlanesAt(img, red, green, blue, size, y0, y1) }
+	if rgba, ok := img.(*image.RGBA); ok {
+		fillRows = func(y0, y1 int) { fillPlanesRGBA(rgba, red, green, blue, size, y0, y1) }
+	}
+
+	workers := preprocessWorkerCount(size)
+	if workers == 1 {
+		fillRows(0, size)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		y0, y1 := size*i/workers, size*(i+1)/workers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fillRows(y0, y1)
+		}()
+	}
+	wg.Wait()
+}
+
+// fillPlanesRGBA 填充 [y0, y1) 行：直接读取 Pix
+func fillPlanesRGBA(img *image.RGBA, red, green, blue []float32, size, y0, y1 int) {
+	area := img.Rect.Intersect(image.Rect(0, y0, size, y1))
+	if area != image.Rect(0, y0, size, y1) {
+		clear(red[y0*size : y1*size])
+		clear(green[y0*size : y1*size])
+		clear(blue[y0*size : y1*size])
+	}
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		pix := img.Pix[img.PixOffset(area.Min.X, y):]
+		row := y * size
+		for x := area.Min.X; x < area.Max.X; x++ {
+			idx := row + x
+			red[idx] = pixelScale[pix[0]]
+			green[idx] = pixelScale[pix[1]]
+			blue[idx] = pixelScale[pix[2]]
+			pix = pix[4:]
+		}
+	}
+}
+
+// fillPlanesAt 填充 [y0, y1) 行：非 RGBA 图像的通用路径，逐像素经 At() 转换颜色
+func fillPlanesAt(img image.Image, red, green, blue []float32, size, y0, y1 int) {
+	for y := y0; y < y1; y++ {
+		for x := 0; x < size; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			idx := y*size + x
+			red[idx] = float32(r>>8) / 255.0
+			green[idx] = float32(g>>8) / 255.0
+			blue[idx] = float32(b>>8) / 255.0
+		}
+	}
+}
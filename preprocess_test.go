@@ -0,0 +1,183 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// randomRGBA 生成像素随机的 RGBA 图像
+func randomRGBA(rect image.Rectangle, seed uint64) *image.RGBA {
+	img := image.NewRGBA(rect)
+	r := rand.New(rand.NewPCG(seed, 0))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(r.IntN(256))
+	}
+	return img
+}
+
+// referencePlanes 用 At() 逐像素填充，作为比较基准
+func referencePlanes(img image.Image, size int) []float32 {
+	data := make([]float32, 3*size*size)
+	plane := size * size
+	fillPlanesAt(img, data[:plane], data[plane:2*plane], data[2*plane:], size, 0, size)
+	return data
+}
+
+func TestFillPlanesMatchesAt(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	const size = 96
+	nrgba := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := range nrgba.Pix {
+		nrgba.Pix[i] = uint8(i * 7)
+	}
+	gray := image.NewGray(image.Rect(0, 0, size, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"与输入尺寸相同", randomRGBA(image.Rect(0, 0, size, size), 1)},
+		{"-rect 时高度小于输入尺寸", randomRGBA(image.Rect(0, 0, size, 64), 2)},
+		{"宽度小于输入尺寸", randomRGBA(image.Rect(0, 0, 50, size), 3)},
+		{"大于输入尺寸", randomRGBA(image.Rect(0, 0, size+20, size+20), 4)},
+		{"边界不从原点开始", randomRGBA(image.Rect(10, 20, size+10, size+20), 5)},
+		{"子图像", randomRGBA(image.Rect(0, 0, 200, 200), 6).SubImage(image.Rect(0, 0, size, size))},
+		{"偏移的子图像", randomRGBA(image.Rect(0, 0, 200, 200), 7).SubImage(image.Rect(30, 5, 130, 105))},
+		{"NRGBA 回退到 At()", nrgba},
+		{"Gray 回退到 At()", gray},
+		{"纯色", image.NewUniform(color.RGBA{R: 1, G: 128, B: 255, A: 255})},
+	}
+	for _, workers := range []int{1, 3} {
+		config.PreprocessWorkers = workers
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				want := referencePlanes(tt.img, size)
+				// 先填入非零值，检查未覆盖的区域被清零
+				got := make([]float32, 3*size*size)
+				for i := range got {
+					got[i] = -1
+				}
+				plane := size * size
+				fillPlanes(tt.img, got[:plane], got[plane:2*plane], got[2*plane:], size)
+				if !slices.Equal(got, want) {
+					for i := range got {
+						if got[i] != want[i] {
+							t.Fatalf("%d 个协程: 第 %d 个值 = %v，At() 路径为 %v", workers, i, got[i], want[i])
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPixelScaleMatchesDivision(t *testing.T) {
+	for v := 0; v < 256; v++ {
+		if pixelScale[v] != float32(v)/255.0 {
+			t.Errorf("pixelScale[%d] = %v，期望 %v", v, pixelScale[v], float32(v)/255.0)
+		}
+	}
+}
+
+func TestPreprocessWorkerCount(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		workers, size, want int
+	}{
+		{1, 640, 1},
+		{8, 640, 8},
+		{8, 64, 2}, // 每个协程至少 minRowsPerWorker 行
+		{8, 16, 1},
+	}
+	for _, tt := range tests {
+		config.PreprocessWorkers = tt.workers
+		if got := preprocessWorkerCount(tt.size); got != tt.want {
+			t.Errorf("preprocessWorkerCount(%d)（-preprocess-workers %d）= %d，期望 %d", tt.size, tt.workers, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkFillPlanes 比较 640x640 输入直接读取 Pix 与逐像素 At() 的耗时
+func BenchmarkFillPlanes(b *testing.B) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.PreprocessWorkers = 1
+
+	const size = 640
+	img := randomRGBA(image.Rect(0, 0, size, size), 1)
+	data := make([]float32, 3*size*size)
+	plane := size * size
+	b.Run("Pix", func(b *testing.B) {
+		for b.Loop() {
+			fillPlanes(img, data[:plane], data[plane:2*plane], data[2*plane:], size)
+		}
+	})
+	b.Run("At", func(b *testing.B) {
+		for b.Loop() {
+			fillPlanesAt(img, data[:plane], data[plane:2*plane], data[2*plane:], size, 0, size)
+		}
+	})
+}
+
+func TestFillPlanesParallelMatchesSerial(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	// 行数不能被协程数整除时，各段的边界仍然首尾相接
+	const size = 333
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"RGBA", randomRGBA(image.Rect(0, 0, size, size), 11)},
+		{"-rect 时高度小于输入尺寸", randomRGBA(image.Rect(0, 0, size, 200), 12)},
+		{"At() 回退路径", image.NewUniform(color.RGBA{R: 9, G: 99, B: 199, A: 255})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plane := size * size
+			config.PreprocessWorkers = 1
+			if preprocessWorkerCount(size) != 1 {
+				t.Fatal("-preprocess-workers 1 时应串行填充")
+			}
+			serial := make([]float32, 3*plane)
+			fillPlanes(tt.img, serial[:plane], serial[plane:2*plane], serial[2*plane:], size)
+
+			for _, workers := range []int{2, 4, 7, 10} {
+				config.PreprocessWorkers = workers
+				parallel := make([]float32, 3*plane)
+				for i := range parallel {
+					parallel[i] = -1
+				}
+				fillPlanes(tt.img, parallel[:plane], parallel[plane:2*plane], parallel[2*plane:], size)
+				if !slices.Equal(parallel, serial) {
+					t.Errorf("%d 个协程（实际 %d 个）的结果与串行填充不同", workers, preprocessWorkerCount(size))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFillPlanesWorkers 比较 640x640 输入按行分段并行填充与串行填充的耗时
+func BenchmarkFillPlanesWorkers(b *testing.B) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	const size = 640
+	img := randomRGBA(image.Rect(0, 0, size, size), 1)
+	data := make([]float32, 3*size*size)
+	plane := size * size
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(strconv.Itoa(workers), func(b *testing.B) {
+			config.PreprocessWorkers = workers
+			for b.Loop() {
+				fillPlanes(img, data[:plane], data[plane:2*plane], data[2*plane:], size)
+			}
+		})
+	}
+}
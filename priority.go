@@ -0,0 +1,154 @@
+package main
+
+import "time"
+
+// TaskPriority 检测任务的优先级
+type TaskPriority int
+
+const (
+	PriorityNormal TaskPriority = iota // 默认优先级（如目录、列表中的图像和回填任务）
+	PriorityHigh                       // 高优先级（如实时摄像头画面），工作协程先领取
+)
+
+// String 返回优先级名称
+func (p TaskPriority) String() string {
+	if p == PriorityHigh {
+		return "high"
+	}
+	return "normal"
+}
+
+// queueFor 返回任务按优先级应进入的队列
+func (manager *VideoDetectorManager) queueFor(task *DetectionTask) chan *DetectionTask {
+	if task.Priority == PriorityHigh {
+		return manager.highQueue
+	}
+	return manager.taskQueue
+}
+
+// queuedTasks 两个队列中等待处理的任务总数
+func (manager *VideoDetectorManager) queuedTasks() int {
+	return len(manager.highQueue) + len(manager.taskQueue)
+}
+
+// maxHighStreak 连续领取高优先级任务的上限：达到后若普通队列中有任务，先领取一个普通任务，
+// 高优先级任务持续涌入时普通任务不会被无限期推迟
+const maxHighStreak = 8
+
+// taskSource 工作协程领取任务的两个队列，队列关闭后对应字段置为 nil
+type taskSource struct {
+	high, normal <-chan *DetectionTask
+	streak       int // 连续领取的高优先级任务数
+}
+
+func (s *taskSource) closed() bool {
+	return s.high == nil && s.normal == nil
+}
+
+// next 领取下一个任务，高优先级队列中有任务时先领取（连续 maxHighStreak 个后让出一次，见 tryStarved）
+// wait 为 nil 时一直等待；返回 nil 表示 wait 到期、shutdown 关闭或两个队列都已关闭
+func (s *taskSource) next(wait <-chan time.Time, shutdown <-chan struct{}) *DetectionTask {
+	for !s.closed() {
+		if task, ok := s.tryStarved(); ok {
+			if task != nil {
+				return task
+			}
+			continue
+		}
+		if task, ok := s.tryHigh(); ok {
+			if task != nil {
+				return task
+			}
+			continue
+		}
+		select {
+		case task, ok := <-s.high:
+			if !ok {
+				s.high = nil
+				continue
+			}
+			s.streak++
+			return task
+		case task, ok := <-s.normal:
+			if !ok {
+				s.normal = nil
+				continue
+			}
+			s.streak = 0
+			return task
+		case <-wait:
+			return nil
+		case <-shutdown:
+			return nil
+		}
+	}
+	return nil
+}
+
+// tryNext 不等待地领取下一个任务，两个队列都为空时返回 nil
+func (s *taskSource) tryNext() *DetectionTask {
+	for !s.closed() {
+		if task, ok := s.tryStarved(); ok {
+			if task != nil {
+				return task
+			}
+			continue
+		}
+		if task, ok := s.tryHigh(); ok {
+			if task != nil {
+				return task
+			}
+			continue
+		}
+		select {
+		case task, ok := <-s.normal:
+			if !ok {
+				s.normal = nil
+				continue
+			}
+			s.streak = 0
+			return task
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// tryHigh 不等待地检查高优先级队列：ok 为 false 表示队列为空；
+// 队列刚被发现已关闭时返回 (nil, true)，调用方应重新检查
+func (s *taskSource) tryHigh() (*DetectionTask, bool) {
+	if s.high == nil {
+		return nil, false
+	}
+	select {
+	case task, ok := <-s.high:
+		if !ok {
+			s.high = nil
+		} else {
+			s.streak++
+		}
+		return task, true
+	default:
+		return nil, false
+	}
+}
+
+// tryStarved 已连续领取 maxHighStreak 个高优先级任务时，不等待地检查普通队列：
+// ok 为 false 表示未达到上限或队列为空；与 tryHigh 相同，队列刚被发现已关闭时返回 (nil, true)
+func (s *taskSource) tryStarved() (*DetectionTask, bool) {
+	if s.streak < maxHighStreak || s.normal == nil {
+		return nil, false
+	}
+	select {
+	case task, ok := <-s.normal:
+		if !ok {
+			s.normal = nil
+		} else {
+			s.streak = 0
+		}
+		return task, true
+	default:
+		return nil, false
+	}
+}
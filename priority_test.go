@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// filledQueue 创建已放入 n 个任务并关闭的队列，任务的 ImagePath 为 <prefix><序号>
+func filledQueue(prefix string, n int) chan *DetectionTask {
+	queue := make(chan *DetectionTask, n)
+	for i := 0; i < n; i++ {
+		queue <- &DetectionTask{ImagePath: fmt.Sprintf("%s%d", prefix, i)}
+	}
+	close(queue)
+	return queue
+}
+
+func TestTaskSourceOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		high, normal int
+		want         string // 领取顺序的前若干个任务
+	}{
+		{"高优先级任务先领取", 2, 5, "h0 h1 n0 n1 n2 n3 n4"},
+		{"只有普通任务", 0, 3, "n0 n1 n2"},
+		{"普通任务不会被饿死", 20, 2, "h0 h1 h2 h3 h4 h5 h6 h7 n0 h8 h9 h10 h11 h12 h13 h14 h15 n1 h16"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []string{"next", "tryNext"} {
+				source := taskSource{high: filledQueue("h", tt.high), normal: filledQueue("n", tt.normal)}
+				var order []string
+				for {
+					var task *DetectionTask
+					if mode == "next" {
+						task = source.next(nil, nil)
+					} else {
+						task = source.tryNext()
+					}
+					if task == nil {
+						break
+					}
+					order = append(order, task.ImagePath)
+				}
+				if len(order) != tt.high+tt.normal {
+					t.Errorf("%s: 领取了 %d 个任务，期望 %d 个", mode, len(order), tt.high+tt.normal)
+				}
+				if got := strings.Join(order, " "); !strings.HasPrefix(got, tt.want) {
+					t.Errorf("%s: 领取顺序 = %s，期望以 %s 开头", mode, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTaskSourceQueuesClosedAfterHighStreak(t *testing.T) {
+	// 连续领取高优先级任务达到上限后两个队列都关闭：next 应返回 nil，而不是在两个 nil 通道上永远等待
+	source := taskSource{high: filledQueue("h", maxHighStreak), normal: filledQueue("n", 0)}
+	done := make(chan int)
+	go func() {
+		n := 0
+		for source.next(nil, nil) != nil {
+			n++
+		}
+		done <- n
+	}()
+	select {
+	case n := <-done:
+		if n != maxHighStreak {
+			t.Errorf("领取了 %d 个任务，期望 %d 个", n, maxHighStreak)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("队列关闭后 next 没有返回")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+	"time"
+)
+
+// 性能分析参数
+var (
+	pprofAddr  = &config.PprofAddr
+	cpuProfile = &config.CPUProfile
+	memProfile = &config.MemProfile
+)
+
+// profiler 命令行运行的 CPU/堆 profile：启动时开始 CPU 采样，stop 时停止采样并写入堆 profile
+// stop 既由 run 在所有处理（包括 ConcurrentBatchProcessImages）结束后调用，也由中断信号处理在退出前调用，只生效一次
+type profiler struct {
+	once    sync.Once
+	cpuFile *os.File
+}
+
+var profiles profiler
+
+// startProfiling 按 -cpuprofile 开始 CPU 采样；未指定 -cpuprofile 和 -memprofile 时不做任何事
+func startProfiling() error {
+	if *cpuProfile == "" {
+		return nil
+	}
+	file, err := os.Create(*cpuProfile)
+	if err != nil {
+		return fmt.Errorf("创建 CPU profile 文件失败: %w", err)
+	}
+	if err := runtimepprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("开始 CPU 采样失败: %w", err)
+	}
+	profiles.cpuFile = file
+	return nil
+}
+
+// stopProfiling 停止 CPU 采样并按 -memprofile 写入堆 profile，失败只打印提示
+func stopProfiling() {
+	profiles.once.Do(func() {
+		if profiles.cpuFile != nil {
+			runtimepprof.StopCPUProfile()
+			if err := profiles.cpuFile.Close(); err != nil {
+				fmt.Printf("写入 CPU profile 失败: %v\n", err)
+			} else {
+				fmt.Printf("CPU profile 已写入: %s\n", *cpuProfile)
+			}
+		}
+		if *memProfile != "" {
+			runtime.GC() // 让堆 profile 反映最近一次 GC 后仍存活的对象
+			err := writeFileAtomic(*memProfile, func(f *os.File) error {
+				return runtimepprof.Lookup("heap").WriteTo(f, 0)
+			})
+			if err != nil {
+				fmt.Printf("写入堆 profile 失败: %v\n", err)
+			} else {
+				fmt.Printf("堆 profile 已写入: %s\n", *memProfile)
+			}
+		}
+	})
+}
+
+// startPprofServer 在 addr 上提供 /debug/pprof/，用于长时间运行时按需采集 profile
+// 使用独立的 ServeMux（程序中没有服务使用 http.DefaultServeMux）；返回的服务器由调用方在退出前关闭
+func startPprofServer(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("监听性能分析地址 %s 失败: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// profile 和 trace 按 seconds 参数持续采样，不设置写超时
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			writeLogFile("ERROR", fmt.Sprintf("性能分析服务退出: %v", err))
+		}
+	}()
+	return server, nil
+}
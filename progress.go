@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// 进度显示参数
+var (
+	showProgress     = &config.Progress
+	progressInterval = &config.ProgressInterval
+)
+
+// Progress 批量处理的进度
+type Progress struct {
+	Done     int           // 已完成的图像数（含失败）
+	Total    int           // 图像总数，0 表示未知（流式输入）
+	Failures int           // 失败的图像数
+	Elapsed  time.Duration // 从开始提交到现在的时间
+	ETA      time.Duration // 按目前的平均速度估计的剩余时间，尚无完成的图像或总数未知时为 0
+}
+
+// ProgressFunc 进度回调，每完成一张图像调用一次
+type ProgressFunc func(p Progress)
+
+// progressTracker 统计批量处理的进度并调用 ProgressFunc
+// 可以在多个协程中同时调用 add；回调在锁内依次执行，回调本身不需要处理并发
+type progressTracker struct {
+	mutex    sync.Mutex
+	fn       ProgressFunc
+	start    time.Time
+	total    int
+	done     int
+	failures int
+}
+
+// newProgressTracker 创建进度统计，fn 为 nil 时返回 nil（add 不做任何事）
+func newProgressTracker(total int, fn ProgressFunc) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{fn: fn, start: time.Now(), total: total}
+}
+
+// add 记录一张图像处理完成
+func (t *progressTracker) add(failed bool) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.done++
+	if failed {
+		t.failures++
+	}
+	p := Progress{Done: t.done, Total: t.total, Failures: t.failures, Elapsed: time.Since(t.start)}
+	if t.done < t.total && t.total > 0 {
+		p.ETA = time.Duration(float64(p.Elapsed) / float64(t.done) * float64(t.total-t.done))
+	}
+	t.fn(p)
+}
+
+// String 输出一行进度，如 "进度: 1200/50000 (2.4%)，失败 3，已用 1m0s，剩余约 40m40s"
+func (p Progress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("进度: 已完成 %d，失败 %d，已用 %v", p.Done, p.Failures, roundProgress(p.Elapsed))
+	}
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Done) * 100 / float64(p.Total)
+	}
+	line := fmt.Sprintf("进度: %d/%d (%.1f%%)，失败 %d，已用 %v", p.Done, p.Total, percent, p.Failures, roundProgress(p.Elapsed))
+	if p.Done < p.Total && p.Done > 0 {
+		line += fmt.Sprintf("，剩余约 %v", roundProgress(p.ETA))
+	}
+	return line
+}
+
+// roundProgress 进度中显示的时间：一分钟以内精确到 0.1 秒，否则精确到秒
+func roundProgress(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// cliProgress 命令行进度显示：标准输出是终端时在同一行刷新（最多每 200ms 一次），
+// 否则（重定向到文件或日志）每隔 -progress-interval 打印一行
+// 处理过程中需要输出其他内容时使用 Printf，避免与终端上的进度行混在一起
+type cliProgress struct {
+	mutex    sync.Mutex
+	tty      bool
+	interval time.Duration
+	last     time.Time
+	line     string // 终端上当前显示的进度行
+	width    int    // 终端上一次输出的字符数，下次刷新时用空格覆盖多余部分
+}
+
+// newCLIProgress 按 -progress 创建命令行进度显示，关闭时返回 nil
+func newCLIProgress() *cliProgress {
+	if !*showProgress {
+		return nil
+	}
+	if stdoutIsTerminal() {
+		return &cliProgress{tty: true, interval: 200 * time.Millisecond}
+	}
+	return &cliProgress{interval: *progressInterval}
+}
+
+// Func 返回进度回调，显示关闭时返回 nil
+func (c *cliProgress) Func() ProgressFunc {
+	if c == nil {
+		return nil
+	}
+	return c.update
+}
+
+func (c *cliProgress) update(p Progress) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	if (p.Done < p.Total || p.Total <= 0) && now.Sub(c.last) < c.interval {
+		return
+	}
+	c.last = now
+	line := p.String()
+	if !c.tty {
+		fmt.Println(line)
+		return
+	}
+	c.draw(line)
+}
+
+// draw 在终端上用 line 覆盖当前的进度行，调用方需持有 mutex
+func (c *cliProgress) draw(line string) {
+	width := utf8.RuneCountInString(line)
+	fmt.Printf("\r%s%s", line, strings.Repeat(" ", max(0, c.width-width)))
+	c.line, c.width = line, width
+}
+
+// Printf 输出一行内容：终端上先清除进度行，输出后再重新显示；c 为 nil 时直接输出
+func (c *cliProgress) Printf(format string, args ...interface{}) {
+	if c == nil {
+		fmt.Printf(format, args...)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.tty || c.width == 0 {
+		fmt.Printf(format, args...)
+		return
+	}
+	fmt.Printf("\r%s\r", strings.Repeat(" ", c.width))
+	fmt.Printf(format, args...)
+	c.width = 0
+	c.draw(c.line)
+}
+
+// Finish 结束进度显示：终端上换行，避免后续输出接在进度行后面
+func (c *cliProgress) Finish() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.tty && c.width > 0 {
+		fmt.Println()
+		c.width = 0
+	}
+}
+
+// stdoutIsTerminal 判断标准输出是否连接到终端
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// batchSummary 批量处理的汇总：总耗时、平均每张的处理耗时和失败数量
+func batchSummary(results []DetectionResult, wall time.Duration, failures int) string {
+	var totals batchTotals
+	for _, result := range results {
+		totals.add(result)
+	}
+	totals.failures = failures
+	return totals.summary(wall)
+}
+
+// batchTotals 批量处理的累计统计，流式处理时不保留每张图像的结果
+type batchTotals struct {
+	count     int
+	failures  int
+	processed int           // 有处理耗时的图像数
+	latency   time.Duration // 处理耗时之和
+}
+
+// add 累计一张图像的结果（失败数由调用方单独统计，绘制保存失败也算失败）
+func (t *batchTotals) add(result DetectionResult) {
+	t.count++
+	if result.Elapsed > 0 {
+		t.latency += result.Elapsed
+		t.processed++
+	}
+}
+
+func (t *batchTotals) summary(wall time.Duration) string {
+	line := fmt.Sprintf("共 %d 张，失败 %d，总耗时 %v", t.count, t.failures, wall.Round(time.Millisecond))
+	if t.processed > 0 {
+		line += fmt.Sprintf("，平均每张处理耗时 %v", (t.latency / time.Duration(t.processed)).Round(time.Millisecond))
+	}
+	if wall > 0 {
+		line += fmt.Sprintf("，吞吐 %.1f 张/秒", float64(t.count)/wall.Seconds())
+	}
+	return line
+}
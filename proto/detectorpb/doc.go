@@ -0,0 +1,9 @@
+// Package detectorpb 是 proto/detector.proto 生成的 Go 绑定（消息类型和 Detector 服务的客户端、服务端接口）
+//
+// 生成的代码依赖 google.golang.org/grpc 和 google.golang.org/protobuf，只在以 -tags grpc 构建时使用。
+// 修改 detector.proto 后需要安装 protoc、protoc-gen-go 和 protoc-gen-go-grpc，然后执行：
+//
+//	go generate ./proto/detectorpb
+package detectorpb
+
+//go:generate protoc -I .. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ../detector.proto
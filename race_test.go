@@ -0,0 +1,6 @@
+//go:build race
+
+package main
+
+// raceEnabled 以 -race 运行测试：sync.Pool 会随机丢弃归还的对象，依赖对象池复用的断言需要放宽
+const raceEnabled = true
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// 提交限速参数
+var (
+	maxFPS        = &config.MaxFPS
+	rateLimitMode = &config.RateLimitMode
+)
+
+// 超出限速时的处理方式
+const (
+	rateLimitDelay  = "delay"  // 等待到有配额时再提交
+	rateLimitReject = "reject" // 立即返回 ErrRateLimited
+)
+
+// ErrRateLimited 提交速度超过 -max-fps，且 -rate-limit-mode 为 reject
+var ErrRateLimited = errors.New("提交速度超过 -max-fps 限制")
+
+// validateRateLimit 检查 -max-fps 和 -rate-limit-mode 参数
+func validateRateLimit() error {
+	if *maxFPS < 0 {
+		return fmt.Errorf("-max-fps 不能为负数")
+	}
+	switch *rateLimitMode {
+	case rateLimitDelay, rateLimitReject:
+		return nil
+	default:
+		return fmt.Errorf("不支持的限速方式: %s（支持 delay, reject）", *rateLimitMode)
+	}
+}
+
+// tokenBucket 令牌桶：每秒补充 rate 个令牌，最多积累 burst 个
+// 空闲一段时间后最多允许 burst 个任务立即提交，之后按 rate 匀速放行
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// refill 按经过的时间补充令牌，调用方需持有 mutex
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// tryTake 有令牌时取走一个并返回 true
+func (b *tokenBucket) tryTake(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve 预订一个令牌，返回需要等待的时间（0 表示立即可用）
+// 令牌可以透支，之后的预订依次排在后面；放弃等待时需调用 cancel 归还
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还 reserve 预订但未使用的令牌
+func (b *tokenBucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// throttle 按 -max-fps 限制提交速度：reject 模式超出时返回 ErrRateLimited，
+// delay 模式等待到有配额为止，等待期间 ctx 结束或管理器停止时放弃
+// 在 submitMutex 之外调用，等待不会阻塞 Stop
+func (manager *VideoDetectorManager) throttle(ctx context.Context) error {
+	limiter := manager.limiter
+	if limiter == nil {
+		return nil
+	}
+	now := time.Now()
+	if manager.rejectOverLimit {
+		if !limiter.tryTake(now) {
+			metrics.recordRateLimit(false, 0)
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	wait := limiter.reserve(now)
+	if wait <= 0 {
+		return nil
+	}
+	metrics.recordRateLimit(true, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		limiter.cancel()
+		return ctx.Err()
+	case <-manager.stopping:
+		limiter.cancel()
+		return ErrManagerStopped
+	}
+}
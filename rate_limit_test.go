@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	// 请求中的例子：-max-fps 10，100 个任务同时提交，最后一个约 10 秒后放行
+	start := time.Unix(0, 0)
+	bucket := newTokenBucket(10, 1, start)
+	var last time.Duration
+	for i := 0; i < 100; i++ {
+		wait := bucket.reserve(start)
+		if want := time.Duration(i) * 100 * time.Millisecond; (wait - want).Abs() > time.Millisecond {
+			t.Fatalf("第 %d 个任务等待 %v，期望 %v", i+1, wait, want)
+		}
+		last = wait
+	}
+	if last < 9*time.Second || last > 10*time.Second {
+		t.Errorf("100 个任务全部放行需要 %v，期望约 10 秒", last)
+	}
+
+	// 放弃等待的预订归还令牌，之后的预订不再排在它后面
+	bucket = newTokenBucket(10, 1, start)
+	bucket.reserve(start)
+	bucket.reserve(start)
+	bucket.cancel()
+	if wait := bucket.reserve(start); (wait - 100*time.Millisecond).Abs() > time.Millisecond {
+		t.Errorf("归还令牌后等待 %v，期望 100ms", wait)
+	}
+}
+
+func TestTokenBucketTryTake(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		at    []time.Duration // 相对 start 的提交时间
+		want  []bool
+	}{
+		{"同时提交只放行一个", 10, 1, []time.Duration{0, 0, 0}, []bool{true, false, false}},
+		{"按速率补充", 10, 1, []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond, 200 * time.Millisecond}, []bool{true, false, true, false, true}},
+		{"空闲后最多积累 burst 个", 10, 2, []time.Duration{0, 0, 0, 5 * time.Second, 5 * time.Second, 5 * time.Second}, []bool{true, true, false, true, true, false}},
+		{"时间倒退不补充", 10, 1, []time.Duration{time.Second, 0, 500 * time.Millisecond}, []bool{true, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := newTokenBucket(tt.rate, tt.burst, start)
+			for i, at := range tt.at {
+				if got := bucket.tryTake(start.Add(at)); got != tt.want[i] {
+					t.Errorf("第 %d 次（%v）tryTake() = %v，期望 %v", i+1, at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestManagerRateLimit(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	const fps, tasks = 50, 10
+	tests := []struct {
+		mode     string
+		accepted int
+		minTime  time.Duration // 全部提交完成的最短耗时
+	}{
+		{rateLimitDelay, tasks, (tasks - 1) * time.Second / fps},
+		{rateLimitReject, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config.MaxFPS, config.RateLimitMode = fps, tt.mode
+			manager := NewVideoDetectorManager(1, 100, time.Second)
+			defer manager.Stop()
+
+			before := metrics.Snapshot()
+			start := time.Now()
+			accepted := 0
+			for i := 0; i < tasks; i++ {
+				err := manager.SubmitTaskWait(context.Background(), &DetectionTask{ImagePath: missingImage(i)})
+				switch {
+				case err == nil:
+					accepted++
+				case !errors.Is(err, ErrRateLimited):
+					t.Fatal(err)
+				}
+			}
+			elapsed := time.Since(start)
+			after := metrics.Snapshot()
+
+			if accepted != tt.accepted {
+				t.Errorf("提交成功 %d 个，期望 %d 个", accepted, tt.accepted)
+			}
+			if elapsed < tt.minTime || elapsed > tt.minTime+time.Second {
+				t.Errorf("提交 %d 个任务耗时 %v，期望约 %v", tasks, elapsed, tt.minTime)
+			}
+			// 限速可以通过指标观察
+			delayed, rejected := after.RateLimitDelayed-before.RateLimitDelayed, after.RateLimitRejected-before.RateLimitRejected
+			if tt.mode == rateLimitDelay && (delayed != tasks-1 || after.RateLimitWait <= before.RateLimitWait) {
+				t.Errorf("延迟提交 %d 次（等待 %.3fs），期望 %d 次", delayed, after.RateLimitWait-before.RateLimitWait, tasks-1)
+			}
+			if tt.mode == rateLimitReject && rejected != tasks-1 {
+				t.Errorf("拒绝提交 %d 次，期望 %d 次", rejected, tasks-1)
+			}
+		})
+	}
+}
+
+func TestManagerRateLimitWaitCanceled(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+	config.MaxFPS, config.RateLimitMode = 1, rateLimitDelay
+
+	manager := NewVideoDetectorManager(1, 100, time.Second)
+	defer manager.Stop()
+	if err := manager.SubmitTask(&DetectionTask{ImagePath: missingImage(0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 等待配额期间上下文结束：立即返回，不占用之后的配额
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := manager.SubmitTaskWait(ctx, &DetectionTask{ImagePath: missingImage(1)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SubmitTaskWait() = %v，期望 context.DeadlineExceeded", err)
+	}
+	if wait := manager.limiter.reserve(time.Now()); wait > time.Second {
+		t.Errorf("放弃等待后下一次提交需等待 %v，取消的预订没有归还", wait)
+	}
+
+	// 管理器停止时等待中的提交返回 ErrManagerStopped
+	done := make(chan error, 1)
+	go func() {
+		done <- manager.SubmitTaskWait(context.Background(), &DetectionTask{ImagePath: missingImage(2)})
+	}()
+	time.Sleep(20 * time.Millisecond)
+	manager.Stop()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrManagerStopped) {
+			t.Errorf("停止后 SubmitTaskWait() = %v，期望 ErrManagerStopped", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("管理器停止后等待配额的提交没有返回")
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		fps  float64
+		mode string
+		ok   bool
+	}{
+		{0, rateLimitDelay, true},
+		{10, rateLimitReject, true},
+		{-1, rateLimitDelay, false},
+		{10, "drop", false},
+	}
+	for _, tt := range tests {
+		config.MaxFPS, config.RateLimitMode = tt.fps, tt.mode
+		if err := validateRateLimit(); (err == nil) != tt.ok {
+			t.Errorf("validateRateLimit(-max-fps %v -rate-limit-mode %s) = %v", tt.fps, tt.mode, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// 预处理差异对比参数
+var (
+	rectDiffOut = &config.RectDiffOut
+	rectDiffIOU = &config.RectDiffIOU
+)
+
+// boxMatch 两组检测结果中互相匹配的一对框
+type boxMatch struct {
+	A, B boundingBox
+	IOU  float32
+}
+
+// detectionMatching 两组检测结果的匹配情况
+type detectionMatching struct {
+	Matched []boxMatch
+	OnlyA   []boundingBox // 只在第一组中出现的框
+	OnlyB   []boundingBox // 只在第二组中出现的框
+}
+
+// matchDetections 按 IoU 从高到低贪心匹配两组检测结果：同类别且 IoU 不低于阈值的框视为同一目标
+// 与比较对象无关（预处理方式、模型、阈值），只比较两组框本身
+func matchDetections(a, b []boundingBox, minIOU float32) detectionMatching {
+	type candidate struct {
+		i, j int
+		iou  float32
+	}
+	var candidates []candidate
+	for i := range a {
+		for j := range b {
+			if a[i].label != b[j].label {
+				continue
+			}
+			if iou := a[i].iou(&b[j]); iou >= minIOU {
+				candidates = append(candidates, candidate{i, j, iou})
+			}
+		}
+	}
+	// IoU 高的优先配对，相同时按第一组的置信度
+	sort.Slice(candidates, func(x, y int) bool {
+		if candidates[x].iou != candidates[y].iou {
+			return candidates[x].iou > candidates[y].iou
+		}
+		return a[candidates[x].i].confidence > a[candidates[y].i].confidence
+	})
+
+	usedA, usedB := make([]bool, len(a)), make([]bool, len(b))
+	var result detectionMatching
+	for _, c := range candidates {
+		if usedA[c.i] || usedB[c.j] {
+			continue
+		}
+		usedA[c.i], usedB[c.j] = true, true
+		result.Matched = append(result.Matched, boxMatch{A: a[c.i], B: b[c.j], IOU: c.iou})
+	}
+	for i := range a {
+		if !usedA[i] {
+			result.OnlyA = append(result.OnlyA, a[i])
+		}
+	}
+	for j := range b {
+		if !usedB[j] {
+			result.OnlyB = append(result.OnlyB, b[j])
+		}
+	}
+	return result
+}
+
+// rectDiffHeader 差异报告 CSV 的表头
+var rectDiffHeader = []string{
+	"image", "status", "label", "conf_letterbox", "conf_rect", "conf_delta",
+	"dx1", "dy1", "dx2", "dy2", "iou",
+	"letterbox_x1", "letterbox_y1", "letterbox_x2", "letterbox_y2",
+	"rect_x1", "rect_y1", "rect_x2", "rect_y2",
+}
+
+// rectDiffRows 生成一张图像的差异报告行，delta 均为 rect 减 letterbox
+func rectDiffRows(imagePath string, m detectionMatching) [][]string {
+	f := func(v float32) string { return strconv.FormatFloat(float64(v), 'f', 2, 32) }
+	conf := func(v float32) string { return formatConfidence(v) }
+	empty := []string{"", "", "", ""}
+	coords := func(b boundingBox) []string { return []string{f(b.x1), f(b.y1), f(b.x2), f(b.y2)} }
+
+	var rows [][]string
+	for _, p := range m.Matched {
+		row := []string{imagePath, "matched", p.A.label, conf(p.A.confidence), conf(p.B.confidence),
+			strconv.FormatFloat(float64(p.B.confidence-p.A.confidence), 'f', *confidencePrecision, 32),
+			f(p.B.x1 - p.A.x1), f(p.B.y1 - p.A.y1), f(p.B.x2 - p.A.x2), f(p.B.y2 - p.A.y2),
+			strconv.FormatFloat(float64(p.IOU), 'f', 3, 32)}
+		rows = append(rows, append(append(row, coords(p.A)...), coords(p.B)...))
+	}
+	for _, b := range m.OnlyA {
+		row := []string{imagePath, "only_letterbox", b.label, conf(b.confidence), "", "", "", "", "", "", ""}
+		rows = append(rows, append(append(row, coords(b)...), empty...))
+	}
+	for _, b := range m.OnlyB {
+		row := []string{imagePath, "only_rect", b.label, "", conf(b.confidence), "", "", "", "", "", ""}
+		rows = append(rows, append(append(row, empty...), coords(b)...))
+	}
+	return rows
+}
+
+// rectDiffStats 全部图像的汇总统计
+type rectDiffStats struct {
+	images, matched, onlyLetterbox, onlyRect int
+	sumConfDelta, sumAbsConfDelta            float64
+	sumIOU                                   float64
+}
+
+func (s *rectDiffStats) add(m detectionMatching) {
+	s.images++
+	s.matched += len(m.Matched)
+	s.onlyLetterbox += len(m.OnlyA)
+	s.onlyRect += len(m.OnlyB)
+	for _, p := range m.Matched {
+		d := float64(p.B.confidence - p.A.confidence)
+		s.sumConfDelta += d
+		s.sumAbsConfDelta += math.Abs(d)
+		s.sumIOU += float64(p.IOU)
+	}
+}
+
+func (s *rectDiffStats) String() string {
+	text := fmt.Sprintf("对比 %d 张图像: 匹配 %d 个, 仅 letterbox %d 个, 仅 rect %d 个",
+		s.images, s.matched, s.onlyLetterbox, s.onlyRect)
+	if s.matched > 0 {
+		n := float64(s.matched)
+		text += fmt.Sprintf("\n匹配框: 平均置信度差(rect-letterbox) %+.4f, 平均绝对差 %.4f, 平均 IoU %.3f",
+			s.sumConfDelta/n, s.sumAbsConfDelta/n, s.sumIOU/n)
+	}
+	return text
+}
+
+// detectWithRect 按指定的预处理方式检测一张图像，结束后恢复 -rect 的原值
+// 两次检测共用同一个会话，差异只来自预处理
+func detectWithRect(session *ModelSession, imagePath string, img image.Image, rect bool) ([]boundingBox, error) {
+	saved := *useRectScaling
+	defer func() { *useRectScaling = saved }()
+	*useRectScaling = rect
+
+	record, err := runDetection(context.Background(), session, imagePath, img, newDetectionConfig())
+	if err != nil {
+		return nil, err
+	}
+	return record.Objects, nil
+}
+
+// saveSideBySide 将 letterbox（左）和 rect（右）的检测结果绘制后并排保存
+func saveSideBySide(img image.Image, letterbox, rect []boundingBox, outputPath string) error {
+	left := Annotate(img, letterbox)
+	defer PutImageToPool(left)
+	right := Annotate(img, rect)
+	defer PutImageToPool(right)
+
+	w, h := left.Bounds().Dx(), left.Bounds().Dy()
+	canvas := image.NewRGBA(image.Rect(0, 0, w*2, h))
+	draw.Draw(canvas, image.Rect(0, 0, w, h), left, left.Bounds().Min, draw.Src)
+	draw.Draw(canvas, image.Rect(w, 0, w*2, h), right, right.Bounds().Min, draw.Src)
+	return saveJPEG(canvas, outputPath)
+}
+
+// runRectDiff rectdiff 子命令：同一会话上分别用 letterbox 和 rect 预处理检测 -img 中的图像，
+// 匹配两次的检测结果，输出逐框的置信度/坐标差异（CSV）和左右并排的标注图
+// 返回 true 表示全部图像处理成功
+func runRectDiff() bool {
+	if *taskType == taskClassify {
+		fmt.Printf("rectdiff 只支持检测类任务\n")
+		return false
+	}
+	imagePaths, err := getImagePaths(*inputImagePath)
+	if err != nil {
+		fmt.Printf("获取图像路径失败: %v\n", err)
+		return false
+	}
+	imagePaths, videoPaths := splitVideoPaths(imagePaths)
+	if len(videoPaths) > 0 {
+		fmt.Printf("提示：rectdiff 不处理视频文件，已跳过 %d 个\n", len(videoPaths))
+	}
+	if err := os.MkdirAll(*rectDiffOut, 0755); err != nil {
+		fmt.Printf("创建输出目录失败: %v\n", err)
+		return false
+	}
+	if err := ensureChineseFont(); err != nil {
+		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
+	} else {
+		defer cleanupFont()
+	}
+
+	session, err := initSession()
+	if err != nil {
+		fmt.Printf("初始化会话失败: %v\n", err)
+		return false
+	}
+	defer session.Destroy()
+
+	csvPath := filepath.Join(*rectDiffOut, "rectdiff.csv")
+	file, err := os.Create(longPath(csvPath))
+	if err != nil {
+		fmt.Printf("创建差异报告失败: %v\n", err)
+		return false
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Write(rectDiffHeader)
+
+	modelIdentifier := getModelIdentifier(modelPaths()[0])
+	var stats rectDiffStats
+	ok := true
+	for _, imagePath := range imagePaths {
+		if err := rectDiffImage(session, imagePath, modelIdentifier, writer, &stats); err != nil {
+			fmt.Printf("处理图像 %s 时出错: %v\n", imagePath, err)
+			ok = false
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Printf("写入差异报告失败: %v\n", err)
+		return false
+	}
+	fmt.Printf("%s\n", stats.String())
+	fmt.Printf("差异报告已保存至: %s\n", csvPath)
+	return ok
+}
+
+// rectDiffImage 对比一张图像的两种预处理结果，写入报告行并保存并排标注图
+func rectDiffImage(session *ModelSession, imagePath, modelIdentifier string, writer *csv.Writer, stats *rectDiffStats) error {
+	img, err := loadImageFile(imagePath)
+	if err != nil {
+		return err
+	}
+	letterbox, err := detectWithRect(session, imagePath, img, false)
+	if err != nil {
+		return fmt.Errorf("letterbox 检测失败: %w", err)
+	}
+	rect, err := detectWithRect(session, imagePath, img, true)
+	if err != nil {
+		return fmt.Errorf("rect 检测失败: %w", err)
+	}
+
+	matching := matchDetections(letterbox, rect, float32(*rectDiffIOU))
+	stats.add(matching)
+	if err := writer.WriteAll(rectDiffRows(imagePath, matching)); err != nil {
+		return fmt.Errorf("写入差异报告失败: %w", err)
+	}
+
+	outputPath := generatedOutputPath(*rectDiffOut, imagePath, modelIdentifier, "rectdiff")
+	if err := saveSideBySide(img, letterbox, rect, outputPath); err != nil {
+		return fmt.Errorf("保存并排标注图失败: %w", err)
+	}
+	fmt.Printf("图像 %s: 匹配 %d 个, 仅 letterbox %d 个, 仅 rect %d 个 -> %s\n",
+		imagePath, len(matching.Matched), len(matching.OnlyA), len(matching.OnlyB), outputPath)
+	return nil
+}
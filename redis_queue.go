@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis 队列消费参数
+var (
+	redisAddr        = &config.RedisAddr
+	redisQueue       = &config.RedisQueue
+	redisResults     = &config.RedisResults
+	redisStream      = &config.RedisStream
+	redisDeadLetter  = &config.RedisDeadLetter
+	redisMaxAttempts = &config.RedisMaxAttempts
+)
+
+const (
+	redisPasswordEnv = "REDIS_PASSWORD" // 地址中没有密码时从该环境变量读取
+	redisPollTimeout = 1                // BRPOPLPUSH 的阻塞时间（秒），到时检查是否收到中断信号
+	redisIOTimeout   = 10 * time.Second
+	redisMaxBackoff  = 30 * time.Second // 连接断开后重连间隔上限，从 1 秒开始翻倍
+)
+
+// redisError Redis 返回的错误回复
+type redisError string
+
+func (e redisError) Error() string { return "Redis 错误: " + string(e) }
+
+// redisConsumer 从 -redis-queue 领取任务
+// 任务用 BRPOPLPUSH 原子地移到本实例的处理中列表（<队列>:processing:<主机名>），处理成功并写入结果后才从中删除（确认）；
+// 处理失败时放回队列重试，同一任务失败 -redis-max-attempts 次后移入死信列表。进程异常退出时处理中列表里的任务在下次启动时放回队列
+type redisConsumer struct {
+	pop         *redisConn // 只用于阻塞的 BRPOPLPUSH
+	cmdMutex    sync.Mutex
+	cmd         *redisConn // 确认、写结果等命令，各任务的协程通过 command 共用
+	dial        func() (*redisConn, error)
+	submit      func(context.Context, *DetectionTask) error
+	queue       string
+	processing  string
+	attempts    string // 记录各任务失败次数的 Hash
+	results     string
+	deadLetter  string
+	stream      bool
+	maxAttempts int
+	slots       chan struct{} // 同时处理中的任务数上限，满时暂停领取
+	inflight    sync.WaitGroup
+}
+
+// runRedisConsumer 以队列消费模式运行，直到收到中断信号
+// 第一次中断时停止领取新任务，等待处理中的任务完成（最多 -shutdown-timeout）；未完成的任务留在处理中列表，下次启动时放回队列
+func runRedisConsumer() int {
+	if *redisMaxAttempts < 1 {
+		fmt.Printf("-redis-max-attempts 必须大于 0\n")
+		return exitSetup
+	}
+	dial, err := redisDialer(*redisAddr)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return exitSetup
+	}
+	pop, err := dial()
+	if err != nil {
+		fmt.Printf("连接 Redis %s 失败: %v\n", *redisAddr, err)
+		return exitSetup
+	}
+	cmd, err := dial()
+	if err != nil {
+		pop.Close()
+		fmt.Printf("连接 Redis %s 失败: %v\n", *redisAddr, err)
+		return exitSetup
+	}
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+	c := newRedisConsumer(pop, cmd, dial, manager.SubmitTaskWait)
+	defer c.close()
+	if n, err := c.recover(); err != nil {
+		fmt.Printf("放回上次未完成的任务失败: %v\n", err)
+		return exitSetup
+	} else if n > 0 {
+		fmt.Printf("已把上次未完成的 %d 个任务放回队列 %s\n", n, c.queue)
+	}
+
+	ctx, release := interruptibleContext()
+	defer release()
+	fmt.Printf("正在从 Redis 队列 %s 领取任务，结果写入 %s，工作协程数量: %d\n", c.queue, c.results, *workerCount)
+	writeLogFile("INFO", fmt.Sprintf("开始消费 Redis 队列 %s", c.queue))
+	c.run(ctx)
+
+	fmt.Printf("已停止领取任务，等待处理中的任务完成（最多 %v）\n", *shutdownTimeout)
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(*shutdownTimeout):
+		fmt.Printf("等待处理中的任务超时，未完成的任务留在 %s，下次启动时放回队列\n", c.processing)
+	}
+	fmt.Printf("队列消费已停止\n")
+	writeLogFile("INFO", fmt.Sprintf("Redis 队列 %s 消费已停止", c.queue))
+	return exitOK
+}
+
+func newRedisConsumer(pop, cmd *redisConn, dial func() (*redisConn, error), submit func(context.Context, *DetectionTask) error) *redisConsumer {
+	hostname, _ := os.Hostname()
+	c := &redisConsumer{
+		pop:         pop,
+		cmd:         cmd,
+		dial:        dial,
+		submit:      submit,
+		queue:       *redisQueue,
+		processing:  *redisQueue + ":processing:" + hostname,
+		attempts:    *redisQueue + ":attempts",
+		results:     *redisResults,
+		deadLetter:  *redisDeadLetter,
+		stream:      *redisStream,
+		maxAttempts: *redisMaxAttempts,
+		slots:       make(chan struct{}, max(1, *workerCount)*2),
+	}
+	if c.results == "" {
+		c.results = c.queue + ":results"
+	}
+	if c.deadLetter == "" {
+		c.deadLetter = c.queue + ":dead"
+	}
+	return c
+}
+
+// recover 把处理中列表里上次未确认的任务放回队列，返回放回的数量
+func (c *redisConsumer) recover() (int, error) {
+	for n := 0; ; n++ {
+		job, err := c.command("RPOPLPUSH", c.processing, c.queue)
+		if err != nil || job == nil {
+			return n, err
+		}
+	}
+}
+
+// run 领取任务直到 ctx 结束；连接断开时重连（间隔从 1 秒翻倍到 30 秒）
+func (c *redisConsumer) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		reply, err := c.pop.Do("BRPOPLPUSH", c.queue, c.processing, strconv.Itoa(redisPollTimeout))
+		if err != nil {
+			<-c.slots
+			writeLogFile("WARN", fmt.Sprintf("领取 Redis 任务失败，%v 后重试: %v", backoff, err))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff *= 2; backoff > redisMaxBackoff {
+				backoff = redisMaxBackoff
+			}
+			if conn, err := c.dial(); err == nil {
+				c.pop.Close()
+				c.pop = conn
+			}
+			continue
+		}
+		backoff = time.Second
+		job, ok := reply.(string)
+		if !ok {
+			<-c.slots // 超时没有任务
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		c.inflight.Add(1)
+		go func() {
+			defer func() {
+				<-c.slots
+				c.inflight.Done()
+			}()
+			c.process(job)
+		}()
+	}
+}
+
+// process 检测一个任务并确认、重试或移入死信列表
+// 工作协程池停止导致的失败不计入失败次数，任务留在处理中列表
+func (c *redisConsumer) process(job string) {
+	callback := make(chan DetectionResult, 1)
+	task := &DetectionTask{ImagePath: strings.TrimSpace(job), Callback: callback}
+	var result DetectionResult
+	if err := c.submit(context.Background(), task); err != nil {
+		result = failedResult(task.ImagePath, err)
+	} else {
+		result = <-callback
+	}
+	if errors.Is(result.Error, ErrManagerStopped) || errors.Is(result.Error, context.Canceled) {
+		return
+	}
+	resultSinks.WriteResult(result)
+	runDetectHook(result, "")
+
+	if result.Error == nil {
+		payload, _ := json.Marshal(newResultRecord(result))
+		if err := c.writeResult(job, payload); err != nil {
+			writeLogFile("WARN", fmt.Sprintf("写入 Redis 结果 %s 失败，任务留在处理中列表: %v", job, err))
+			return
+		}
+		c.ack(job, "HDEL", c.attempts, job)
+		return
+	}
+
+	reply, err := c.command("HINCRBY", c.attempts, job, "1")
+	if err != nil {
+		writeLogFile("WARN", fmt.Sprintf("记录 Redis 任务 %s 失败次数失败: %v", job, err))
+		return
+	}
+	attempts, _ := reply.(int64)
+	if int(attempts) < c.maxAttempts {
+		writeLogFile("WARN", fmt.Sprintf("任务 %s 第 %d 次处理失败，放回队列: %v", job, attempts, result.Error))
+		c.ack(job, "LPUSH", c.queue, job)
+		return
+	}
+	writeLogFile("ERROR", fmt.Sprintf("任务 %s 已失败 %d 次，移入 %s: %v", job, attempts, c.deadLetter, result.Error))
+	if c.ack(job, "LPUSH", c.deadLetter, job) {
+		c.command("HDEL", c.attempts, job)
+	}
+}
+
+// command 在命令连接上执行一条命令
+// Redis 的错误回复之外的错误（连接断开、超时、回复无法解析）之后连接的状态未知，下一次读取可能拿到上一条命令的回复，
+// 因此关闭连接并重连；重连失败时下一条命令再次重连
+func (c *redisConsumer) command(args ...string) (any, error) {
+	c.cmdMutex.Lock()
+	defer c.cmdMutex.Unlock()
+	reply, err := c.cmd.Do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.cmd.Close()
+		if conn, dialErr := c.dial(); dialErr == nil {
+			c.cmd = conn
+		} else {
+			writeLogFile("WARN", fmt.Sprintf("重连 Redis 失败: %v", dialErr))
+		}
+	}
+	return reply, err
+}
+
+// close 关闭两个连接
+func (c *redisConsumer) close() {
+	c.pop.Close()
+	c.cmdMutex.Lock()
+	c.cmd.Close()
+	c.cmdMutex.Unlock()
+}
+
+// writeResult 把结果记录 LPUSH 到结果列表，或以 XADD 写入结果 Stream
+func (c *redisConsumer) writeResult(job string, payload []byte) error {
+	var err error
+	if c.stream {
+		_, err = c.command("XADD", c.results, "*", "job", job, "result", string(payload))
+	} else {
+		_, err = c.command("LPUSH", c.results, string(payload))
+	}
+	return err
+}
+
+// ack 先执行 move（放回队列或移入死信列表等），成功后把任务从处理中列表删除；
+// 两步之间进程退出时任务可能重复，但不会丢失
+func (c *redisConsumer) ack(job string, move ...string) bool {
+	if _, err := c.command(move...); err != nil {
+		writeLogFile("WARN", fmt.Sprintf("Redis 任务 %s 执行 %s 失败，任务留在处理中列表: %v", job, move[0], err))
+		return false
+	}
+	if _, err := c.command("LREM", c.processing, "1", job); err != nil {
+		writeLogFile("WARN", fmt.Sprintf("确认 Redis 任务 %s 失败: %v", job, err))
+		return false
+	}
+	return true
+}
+
+// redisDialer 解析 -redis-addr，返回建立已认证连接的函数
+func redisDialer(addr string) (func() (*redisConn, error), error) {
+	raw := addr
+	if !strings.Contains(raw, "://") {
+		raw = "redis://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Scheme != "redis" {
+		return nil, fmt.Errorf("无效的 Redis 地址 %q（格式为 host:port 或 redis://[:密码@]host:port[/db]）", addr)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	if password == "" {
+		password = os.Getenv(redisPasswordEnv)
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("无效的 Redis 数据库编号 %q", db)
+		}
+	}
+
+	return func() (*redisConn, error) {
+		nc, err := net.DialTimeout("tcp", host, redisIOTimeout)
+		if err != nil {
+			return nil, err
+		}
+		conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+		if password != "" {
+			args := []string{"AUTH", password}
+			if username != "" {
+				args = []string{"AUTH", username, password}
+			}
+			if _, err := conn.Do(args...); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("Redis 认证失败: %w", err)
+			}
+		}
+		if db != "" {
+			if _, err := conn.Do("SELECT", db); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}, nil
+}
+
+// redisConn 最小的 RESP2 客户端连接，Do 可以并发调用（逐个执行）
+type redisConn struct {
+	mutex sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+}
+
+// Do 执行一条命令，返回 string、int64、nil（空回复）或 []any；错误回复返回 redisError
+// BRPOPLPUSH 等阻塞命令的等待时间计入读取超时
+func (c *redisConn) Do(args ...string) (any, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.conn.SetDeadline(time.Now().Add(redisIOTimeout + redisPollTimeout*time.Second))
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("无效的 Redis 回复")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				var redisErr redisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("无效的 Redis 回复 %q", line)
+}
+
+func (c *redisConn) Close() error { return c.conn.Close() }
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis 进程内的 RESP2 服务器，实现队列消费用到的列表、Hash 和 Stream 命令
+type fakeRedis struct {
+	ln       net.Listener
+	mutex    sync.Mutex
+	lists    map[string][]string // 下标 0 为表头
+	hashes   map[string]map[string]int64
+	streams  map[string][]map[string]string
+	truncate map[string]int // 命令名 -> 剩余次数：只写出半条回复后断开连接，不执行命令
+	conns    int
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		ln:       ln,
+		lists:    map[string][]string{},
+		hashes:   map[string]map[string]int64{},
+		streams:  map[string][]map[string]string{},
+		truncate: map[string]int{},
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mutex.Lock()
+			s.conns++
+			s.mutex.Unlock()
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+	for {
+		request, err := conn.read()
+		if err != nil {
+			return
+		}
+		items, _ := request.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		reply, ok := s.handle(args)
+		if !ok {
+			nc.Write([]byte(reply[:len(reply)/2]))
+			return
+		}
+		if _, err := nc.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// handle 执行一条命令，返回 RESP 编码的回复；ok 为 false 时连接应在写出半条回复后断开
+func (s *fakeRedis) handle(args []string) (reply string, ok bool) {
+	name := strings.ToUpper(args[0])
+	if name == "BRPOPLPUSH" {
+		s.mutex.Lock()
+		empty := len(s.lists[args[1]]) == 0
+		s.mutex.Unlock()
+		if empty {
+			time.Sleep(10 * time.Millisecond) // 代替阻塞等待
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.commands = append(s.commands, strings.Join(args, " "))
+	if s.truncate[name] > 0 {
+		s.truncate[name]--
+		return "$11\r\nhalf-a-reply\r\n", false
+	}
+	switch name {
+	case "LPUSH":
+		s.lists[args[1]] = append(slices.Clone(args[2:]), s.lists[args[1]]...)
+		return fmt.Sprintf(":%d\r\n", len(s.lists[args[1]])), true
+	case "RPOPLPUSH", "BRPOPLPUSH":
+		src := s.lists[args[1]]
+		if len(src) == 0 {
+			return "$-1\r\n", true
+		}
+		item := src[len(src)-1]
+		s.lists[args[1]] = src[:len(src)-1]
+		s.lists[args[2]] = append([]string{item}, s.lists[args[2]]...)
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(item), item), true
+	case "LREM":
+		list := s.lists[args[1]]
+		if i := slices.Index(list, args[3]); i >= 0 {
+			s.lists[args[1]] = slices.Delete(list, i, i+1)
+			return ":1\r\n", true
+		}
+		return ":0\r\n", true
+	case "HINCRBY":
+		if s.hashes[args[1]] == nil {
+			s.hashes[args[1]] = map[string]int64{}
+		}
+		var n int64
+		fmt.Sscan(args[3], &n)
+		s.hashes[args[1]][args[2]] += n
+		return fmt.Sprintf(":%d\r\n", s.hashes[args[1]][args[2]]), true
+	case "HDEL":
+		_, found := s.hashes[args[1]][args[2]]
+		delete(s.hashes[args[1]], args[2])
+		if found {
+			return ":1\r\n", true
+		}
+		return ":0\r\n", true
+	case "XADD":
+		entry := map[string]string{}
+		for i := 3; i+1 < len(args); i += 2 {
+			entry[args[i]] = args[i+1]
+		}
+		s.streams[args[1]] = append(s.streams[args[1]], entry)
+		return fmt.Sprintf("+%d-0\r\n", len(s.streams[args[1]])), true
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0]), true
+}
+
+// list 返回列表的副本
+func (s *fakeRedis) list(key string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.lists[key])
+}
+
+// waitUntil 轮询直到 cond 成立，5 秒内不成立时测试失败
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// startRedisConsumer 连接 fakeRedis 运行消费循环，测试结束时停止领取并等待处理中的任务
+// submit 代替工作协程池：路径以 ok 开头的任务成功，其余失败
+func startRedisConsumer(t *testing.T, s *fakeRedis) (*redisConsumer, *[]string) {
+	t.Helper()
+	dial, err := redisDialer(s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pop, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	var submitted []string
+	submit := func(ctx context.Context, task *DetectionTask) error {
+		mutex.Lock()
+		submitted = append(submitted, task.ImagePath)
+		mutex.Unlock()
+		result := failedResult(task.ImagePath, errors.New("模拟检测失败"))
+		if strings.HasPrefix(task.ImagePath, "ok") {
+			result.Error = nil
+		}
+		task.Callback <- result
+		return nil
+	}
+	c := newRedisConsumer(pop, cmd, dial, submit)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		c.run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+		c.inflight.Wait()
+		c.close()
+	})
+	return c, &submitted
+}
+
+func TestRedisConsumer(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.RedisQueue = "jobs"
+	config.RedisMaxAttempts = 3
+	config.Workers = 2
+
+	tests := []struct {
+		name        string
+		stream      bool
+		job         string
+		results     int // 结果列表或 Stream 中的记录数
+		dead        []string
+		submissions int
+	}{
+		{"成功后写入结果列表并确认", false, "ok.jpg", 1, nil, 1},
+		{"成功后写入结果 Stream 并确认", true, "ok.jpg", 1, nil, 1},
+		{"失败时重试，达到次数后移入死信列表", false, "bad.jpg", 0, []string{"bad.jpg"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.RedisStream = tt.stream
+			s := newFakeRedis(t)
+			s.lists["jobs"] = []string{tt.job}
+			c, submitted := startRedisConsumer(t, s)
+
+			waitUntil(t, "任务确认", func() bool {
+				s.mutex.Lock()
+				defer s.mutex.Unlock()
+				done := len(s.lists["jobs:results"]) + len(s.streams["jobs:results"]) + len(s.lists["jobs:dead"])
+				_, counting := s.hashes["jobs:attempts"][tt.job]
+				return done > 0 && len(s.lists[c.processing]) == 0 && !counting
+			})
+
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			var records []string
+			if tt.stream {
+				for _, entry := range s.streams["jobs:results"] {
+					if entry["job"] != tt.job {
+						t.Errorf("Stream 记录的 job = %q，期望 %q", entry["job"], tt.job)
+					}
+					records = append(records, entry["result"])
+				}
+			} else {
+				records = s.lists["jobs:results"]
+			}
+			if len(records) != tt.results {
+				t.Fatalf("结果记录 %d 条，期望 %d 条", len(records), tt.results)
+			}
+			for _, raw := range records {
+				var record ResultRecord
+				if err := json.Unmarshal([]byte(raw), &record); err != nil || record.ImagePath != tt.job {
+					t.Errorf("结果记录 = %s，期望 %s 的 JSON 记录 (%v)", raw, tt.job, err)
+				}
+			}
+			if !slices.Equal(s.lists["jobs:dead"], tt.dead) {
+				t.Errorf("死信列表 = %v，期望 %v", s.lists["jobs:dead"], tt.dead)
+			}
+			if len(s.lists["jobs"]) != 0 {
+				t.Errorf("队列中还有 %v", s.lists["jobs"])
+			}
+			if len(*submitted) != tt.submissions {
+				t.Errorf("任务提交 %d 次，期望 %d 次", len(*submitted), tt.submissions)
+			}
+			// 最后一次确认（LREM）在写入结果或移入死信列表之后
+			written, acked := -1, -1
+			for i, command := range s.commands {
+				switch {
+				case strings.HasPrefix(command, "LPUSH jobs:results "), strings.HasPrefix(command, "XADD jobs:results "),
+					strings.HasPrefix(command, "LPUSH jobs:dead "):
+					written = i
+				case strings.HasPrefix(command, "LREM "+c.processing+" "):
+					acked = i
+				}
+			}
+			if written < 0 || acked < written {
+				t.Errorf("写入结果的命令在第 %d 条，确认在第 %d 条，期望先写入后确认: %v", written, acked, s.commands)
+			}
+		})
+	}
+}
+
+func TestRedisConsumerReconnectsCommandConnection(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.RedisQueue = "jobs"
+	config.RedisStream = false
+	config.Workers = 1
+
+	s := newFakeRedis(t)
+	s.truncate["LPUSH"] = 1 // 第一次写结果时回复到一半断开，连接上残留的状态不可再用
+	c, _ := startRedisConsumer(t, s)
+
+	s.mutex.Lock()
+	s.lists["jobs"] = []string{"ok-1.jpg"}
+	s.mutex.Unlock()
+	waitUntil(t, "第一次写结果失败", func() bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.truncate["LPUSH"] == 0 && s.conns == 3
+	})
+	// 写结果失败的任务留在处理中列表，下次启动时放回队列
+	waitUntil(t, "第一个任务处理完", func() bool { return slices.Equal(s.list(c.processing), []string{"ok-1.jpg"}) })
+
+	s.mutex.Lock()
+	s.lists["jobs"] = []string{"ok-2.jpg"}
+	s.mutex.Unlock()
+	waitUntil(t, "重连后确认第二个任务", func() bool {
+		return len(s.list("jobs:results")) == 1 && slices.Equal(s.list(c.processing), []string{"ok-1.jpg"})
+	})
+
+	var record ResultRecord
+	if err := json.Unmarshal([]byte(s.list("jobs:results")[0]), &record); err != nil || record.ImagePath != "ok-2.jpg" {
+		t.Errorf("结果记录 = %+v (%v)，期望 ok-2.jpg", record, err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conns != 3 {
+		t.Errorf("建立了 %d 个连接，期望 3 个（领取、命令、重连后的命令）", s.conns)
+	}
+}
+
+func TestRedisConsumerRecover(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.RedisQueue = "jobs"
+
+	s := newFakeRedis(t)
+	dial, err := redisDialer(s.ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newRedisConsumer(nil, cmd, dial, nil)
+	defer cmd.Close()
+	s.lists[c.processing] = []string{"b.jpg", "a.jpg"}
+	s.lists["jobs"] = []string{"c.jpg"}
+
+	n, err := c.recover()
+	if err != nil || n != 2 {
+		t.Fatalf("recover() = %d, %v，期望放回 2 个任务", n, err)
+	}
+	if got := s.list("jobs"); !slices.Equal(got, []string{"b.jpg", "a.jpg", "c.jpg"}) {
+		t.Errorf("队列 = %v", got)
+	}
+	if got := s.list(c.processing); len(got) != 0 {
+		t.Errorf("处理中列表 = %v，期望为空", got)
+	}
+}
+
+func TestRedisDialer(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{"localhost:6379", false},
+		{"redis://:secret@localhost/2", false},
+		{"redis://localhost/db", true},
+		{"http://localhost:6379", true},
+		{"redis://", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if _, err := redisDialer(tt.addr); (err != nil) != tt.wantErr {
+				t.Errorf("redisDialer(%q) 错误 = %v，期望出错 %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 绘制/编码协程数量
+var renderWorkers = &config.RenderWorkers
+
+// renderJob 一张已完成检测、等待绘制和编码的图像
+type renderJob struct {
+	index      int
+	result     DetectionResult
+	outputPath string
+}
+
+// renderPool 独立于推理工作协程的绘制/编码协程组
+// 推理结果通过有界通道交给绘制协程，JPEG/PNG 编码不再与 ONNX Runtime 抢占同一批推理协程
+type renderPool struct {
+	jobs    chan renderJob
+	wg      sync.WaitGroup
+	errs    []error         // 按输入下标记录的绘制/保存错误
+	elapsed []time.Duration // 按输入下标记录的绘制/保存耗时
+	// 每张图像绘制完成后在绘制协程中调用（按完成顺序）；流式处理时不知道图像总数，只调用 onDone 而不记录到 errs/elapsed
+	onDone func(job renderJob, err error, elapsed time.Duration)
+}
+
+// newRenderPool 启动 workers 个绘制协程，total 为本批次的图像数量，onDone 可以为 nil
+func newRenderPool(workers, total int, onDone func(job renderJob, err error, elapsed time.Duration)) *renderPool {
+	return (&renderPool{
+		errs:    make([]error, total),
+		elapsed: make([]time.Duration, total),
+		onDone:  onDone,
+	}).start(workers)
+}
+
+// newStreamingRenderPool 启动 workers 个绘制协程，每张图像完成后在绘制协程中调用 onDone（需自行处理并发）
+func newStreamingRenderPool(workers int, onDone func(job renderJob, err error, elapsed time.Duration)) *renderPool {
+	return (&renderPool{onDone: onDone}).start(workers)
+}
+
+func (pool *renderPool) start(workers int) *renderPool {
+	workers = max(1, workers)
+	pool.jobs = make(chan renderJob, workers*2)
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go pool.run()
+	}
+	return pool
+}
+
+// run 绘制协程主循环；每个下标只由一个协程写入，Wait 之后读取无需加锁
+func (pool *renderPool) run() {
+	defer pool.wg.Done()
+	for job := range pool.jobs {
+		start := time.Now()
+		err := renderResult(job.result, job.outputPath)
+		elapsed := time.Since(start)
+		if pool.errs != nil {
+			pool.errs[job.index] = err
+			pool.elapsed[job.index] = elapsed
+		}
+		if pool.onDone != nil {
+			pool.onDone(job, err, elapsed)
+		}
+	}
+}
+
+// Submit 提交一张图像，绘制协程都忙时阻塞调用方（不阻塞推理工作协程）
+func (pool *renderPool) Submit(job renderJob) {
+	pool.jobs <- job
+}
+
+// Wait 等待所有已提交的图像绘制完成
+func (pool *renderPool) Wait() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+// renderResult 重新加载原图，绘制检测框并编码保存
+func renderResult(result DetectionResult, outputPath string) error {
+	originalPic, err := loadImageFile(result.ImagePath)
+	if err != nil {
+		return fmt.Errorf("加载原图失败: %w", err)
+	}
+	annotated := Annotate(originalPic, result.Objects)
+	defer PutImageToPool(annotated)
+	if err := saveJPEG(annotated, outputPath); err != nil {
+		return fmt.Errorf("保存标注图像失败: %w", err)
+	}
+	if err := writeDetectionJSON(result.DetectionRecord, outputPath); err != nil {
+		return err
+	}
+	return writeYOLOLabels(result.DetectionRecord, outputPath)
+}
+
+// stageTimings 各处理阶段的耗时分布
+type stageTimings struct {
+	names   []string
+	samples map[string][]time.Duration
+}
+
+func newStageTimings(names ...string) *stageTimings {
+	return &stageTimings{names: names, samples: make(map[string][]time.Duration)}
+}
+
+// Add 记录某阶段的一次耗时，0 表示该阶段未执行
+func (t *stageTimings) Add(stage string, d time.Duration) {
+	if d > 0 {
+		t.samples[stage] = append(t.samples[stage], d)
+	}
+}
+
+// String 输出每个阶段的次数、p50、p99 和最大耗时
+func (t *stageTimings) String() string {
+	lines := []string{"阶段耗时:"}
+	for _, name := range t.names {
+		samples := t.samples[name]
+		if len(samples) == 0 {
+			continue
+		}
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		lines = append(lines, fmt.Sprintf("  %s: %d 次, p50 %v, p99 %v, 最大 %v", name, len(sorted),
+			durationPercentile(sorted, 50).Round(time.Millisecond),
+			durationPercentile(sorted, 99).Round(time.Millisecond),
+			sorted[len(sorted)-1].Round(time.Millisecond)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// durationPercentile 返回已排序耗时的第 p 百分位（最近秩法）
+func durationPercentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(0, min(len(sorted)-1, rank-1))]
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/nfnt/resize"
+)
+
+// 预处理缩放方式参数
+var resizeMode = &config.ResizeMode
+
+// 预处理缩放方式
+const (
+	resizeLetterbox = "letterbox" // 保持长宽比缩放后用灰色填充（-rect 时只填充到 stride 的整数倍）
+	resizeStretch   = "stretch"   // 直接拉伸到正方形输入，不填充（Ultralytics 的 scaleFill）
+	resizeCrop      = "crop"      // 按短边缩放后裁掉长边两侧，画面边缘的目标不会被检测
+)
+
+// validateResizeMode 检查 -resize-mode 参数
+func validateResizeMode() error {
+	switch *resizeMode {
+	case resizeLetterbox, resizeStretch, resizeCrop:
+		return nil
+	default:
+		return fmt.Errorf("不支持的缩放方式: %s（支持 letterbox, stretch, crop）", *resizeMode)
+	}
+}
+
+// resizeForInput 按任务和 -resize-mode 将图像缩放为模型输入
+// 分类模型始终使用中心裁剪（与 Ultralytics 分类预处理一致）
+// 返回的图像来自对象池，调用方填充完输入张量后需通过 PutImageToPool 归还
+func resizeForInput(pic image.Image, inputSize int) (*image.RGBA, ScaleInfo) {
+	switch {
+	case *taskType == taskClassify || *resizeMode == resizeCrop:
+		return resizeWithCrop(pic, inputSize)
+	case *resizeMode == resizeStretch:
+		return resizeWithStretch(pic, inputSize)
+	case *useRectScaling:
+		return resizeWithRectScaling(pic, inputSize, stride)
+	default:
+		return resizeWithLetterbox(pic, inputSize)
+	}
+}
+
+// resizeWithStretch 拉伸缩放：宽高分别缩放到目标尺寸，不保持长宽比也不填充
+// 两个方向的缩放比例不同，ScaleX/ScaleY 分别记录，坐标映射公式与 letterbox 相同（填充为 0）
+func resizeWithStretch(img image.Image, targetSize int) (*image.RGBA, ScaleInfo) {
+	bounds := img.Bounds()
+	originalWidth, originalHeight := bounds.Dx(), bounds.Dy()
+
+	resized := resize.Resize(uint(targetSize), uint(targetSize), img, resize.Bilinear)
+
+	// 从对象池获取指定尺寸的图像（随后整幅覆盖，不需要清零）
+	result := getImageUncleared(targetSize, targetSize)
+	draw.Draw(result, result.Bounds(), resized, resized.Bounds().Min, draw.Src)
+
+	return result, ScaleInfo{
+		ScaleX:    float32(targetSize) / float32(originalWidth),
+		ScaleY:    float32(targetSize) / float32(originalHeight),
+		NewWidth:  targetSize,
+		NewHeight: targetSize,
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// redBounds 返回图像中红色区域的外接矩形（letterbox 的灰色填充不算）
+func redBounds(img *image.RGBA) (x1, y1, x2, y2 float32) {
+	bounds := img.Bounds()
+	x1, y1 = float32(bounds.Max.X), float32(bounds.Max.Y)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c := img.RGBAAt(x, y); c.R < 128 || c.G > 64 {
+				continue
+			}
+			x1, y1 = min32(x1, float32(x)), min32(y1, float32(y))
+			x2, y2 = max32(x2, float32(x+1)), max32(y2, float32(y+1))
+		}
+	}
+	return x1, y1, x2, y2
+}
+
+func TestResizeModeCoordinateRoundTrip(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.Task = taskDetect
+
+	// 横向的原图，目标在中心裁剪后仍可见的区域内
+	const width, height, inputSize = 320, 200, 160
+	want := boundingBox{label: "person", x1: 120, y1: 60, x2: 200, y2: 140}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(120, 60, 200, 140), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name   string
+		mode   string
+		rect   bool
+		size   image.Point // 模型输入尺寸
+		scaleX float32
+		scaleY float32
+	}{
+		{"letterbox", resizeLetterbox, false, image.Pt(160, 160), 0.5, 0.5},
+		{"letterbox -rect", resizeLetterbox, true, image.Pt(160, 128), 0.5, 0.5}, // 高度 100 填充到 stride 的整数倍
+		{"stretch", resizeStretch, false, image.Pt(160, 160), 0.5, 0.8},
+		{"crop", resizeCrop, false, image.Pt(160, 160), 0.8, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.ResizeMode, config.RectScaling = tt.mode, tt.rect
+			input, scaleInfo := resizeForInput(img, inputSize)
+			defer PutImageToPool(input)
+
+			if size := input.Bounds().Size(); size != tt.size {
+				t.Errorf("输入尺寸 = %v，期望 %v", size, tt.size)
+			}
+			if scaleInfo.ScaleX != tt.scaleX || scaleInfo.ScaleY != tt.scaleY {
+				t.Errorf("缩放比例 = %v x %v，期望 %v x %v", scaleInfo.ScaleX, scaleInfo.ScaleY, tt.scaleX, tt.scaleY)
+			}
+			if err := scaleInfo.Validate(inputSize, stride); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+
+			// 模型在输入图像上检测到红色区域，经 processOutput 映射回原图
+			x1, y1, x2, y2 := redBounds(input)
+			output, layout := v8Output([]string{"person"}, []testAnchor{{cx: (x1 + x2) / 2, cy: (y1 + y2) / 2, w: x2 - x1, h: y2 - y1, conf: 0.9}})
+			boxes := processOutput(output, layout, width, height, 0.25, 0.45, 300, nil, scaleInfo)
+			if len(boxes) != 1 {
+				t.Fatalf("processOutput() 返回 %d 个框", len(boxes))
+			}
+			// 缩放插值使边缘最多模糊一个输入像素
+			tolerance := float64(1/min32(scaleInfo.ScaleX, scaleInfo.ScaleY)) + 0.5
+			got := boxes[0]
+			for _, c := range []struct {
+				name      string
+				got, want float32
+			}{{"x1", got.x1, want.x1}, {"y1", got.y1, want.y1}, {"x2", got.x2, want.x2}, {"y2", got.y2, want.y2}} {
+				if math.Abs(float64(c.got-c.want)) > tolerance {
+					t.Errorf("%s = %v，期望 %v（误差上限 %.2f）", c.name, c.got, c.want, tolerance)
+				}
+			}
+		})
+	}
+}
+
+func TestResizeWithCropNegativeOffsets(t *testing.T) {
+	tests := []struct {
+		name            string
+		width, height   int
+		padLeft, padTop int
+	}{
+		{"横向裁掉左右", 320, 200, -48, 0},
+		{"纵向裁掉上下", 200, 320, 0, -48},
+		{"正方形不裁剪", 200, 200, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, scaleInfo := resizeWithCrop(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), 160)
+			defer PutImageToPool(input)
+			if scaleInfo.PadLeft != tt.padLeft || scaleInfo.PadTop != tt.padTop {
+				t.Errorf("填充偏移 = (%d, %d)，期望 (%d, %d)", scaleInfo.PadLeft, scaleInfo.PadTop, tt.padLeft, tt.padTop)
+			}
+			if err := scaleInfo.Validate(160, stride); err != nil {
+				t.Errorf("Validate() = %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateResizeMode(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	for mode, ok := range map[string]bool{resizeLetterbox: true, resizeStretch: true, resizeCrop: true, "scaleFill": false, "": false} {
+		config.ResizeMode = mode
+		if err := validateResizeMode(); (err == nil) != ok {
+			t.Errorf("validateResizeMode(%q) = %v", mode, err)
+		}
+	}
+}
+
+// countingImagePool 为 width x height 的图像安装一个记录新分配次数的对象池，测试结束后恢复
+func countingImagePool(t *testing.T, width, height int) *atomic.Int64 {
+	t.Helper()
+	key := imageSizeKey{width: width, height: height}
+	var allocated atomic.Int64
+	imagePoolMutex.Lock()
+	saved, existed := imagePools[key]
+	imagePools[key] = &sync.Pool{New: func() any {
+		allocated.Add(1)
+		return image.NewRGBA(image.Rect(0, 0, width, height))
+	}}
+	imagePoolMutex.Unlock()
+	t.Cleanup(func() {
+		imagePoolMutex.Lock()
+		defer imagePoolMutex.Unlock()
+		if existed {
+			imagePools[key] = saved
+		} else {
+			delete(imagePools, key)
+		}
+	})
+	return &allocated
+}
+
+// steadyImagePool 测试期间固定 GOMAXPROCS=1 并关闭 GC，归还对象池的图像总能被下一次 Get 取回，新分配次数是确定的
+func steadyImagePool(t *testing.T) {
+	t.Helper()
+	procs := runtime.GOMAXPROCS(1)
+	gc := debug.SetGCPercent(-1)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetGCPercent(gc)
+	})
+}
+
+// maxPoolAllocs 图像每次用完都归还时，runs 次使用允许的新分配次数：只有第一次 Get 新分配
+// -race 时 sync.Pool 随机丢弃约 1/4 的归还对象，允许期望值加 4 个标准差
+func maxPoolAllocs(runs int) int64 {
+	if raceEnabled {
+		return int64(runs)/4 + int64(4*math.Sqrt(float64(runs)*3/16)) + 1
+	}
+	return 1
+}
+
+func TestFillInputDataReturnsCanvasToPool(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.Task = taskDetect
+	config.InputSize = 64
+	config.PreprocessWorkers = 1
+	steadyImagePool(t)
+
+	// 64x48 的原图：-rect 时高度 48 填充到 stride 的整数倍，各模式的画布都是 64x64
+	src := randomRGBA(image.Rect(0, 0, 64, 48), 1)
+	data := make([]float32, 3*64*64)
+	tests := []struct {
+		mode string
+		rect bool
+	}{
+		{resizeLetterbox, false},
+		{resizeLetterbox, true},
+		{resizeStretch, false},
+		{resizeCrop, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s rect=%v", tt.mode, tt.rect), func(t *testing.T) {
+			config.ResizeMode, config.RectScaling = tt.mode, tt.rect
+			allocated := countingImagePool(t, 64, 64)
+
+			const runs = 1000
+			testing.AllocsPerRun(runs, func() {
+				if _, err := fillInputData(src, data); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if n := allocated.Load(); n > maxPoolAllocs(runs) {
+				t.Errorf("%d 次预处理新分配了 %d 个画布，期望最多 %d 个，画布没有归还对象池", runs+1, n, maxPoolAllocs(runs))
+			}
+		})
+	}
+}
+
+func TestAugmentedPassesReturnImagesToPool(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.Task = taskDetect
+	config.InputSize = 64
+	config.PreprocessWorkers = 1
+	config.ResizeMode, config.RectScaling = resizeLetterbox, false
+	steadyImagePool(t)
+
+	src := randomRGBA(image.Rect(0, 0, 64, 48), 2)
+	session := newFakeSession(make([]float32, 6), outputLayout{Format: formatE2E, NumChannels: 6, NumAnchors: 1})
+	tests := []struct {
+		op        string
+		augmented image.Point // 增强后图像的尺寸
+	}{
+		{"flipH", image.Pt(64, 48)},
+		{"flipV", image.Pt(64, 48)},
+		{"rot90", image.Pt(48, 64)},
+		{"rot180", image.Pt(64, 48)},
+		{"rot270", image.Pt(48, 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			cfg := newDetectionConfig()
+			cfg.TTAOps = []string{tt.op}
+			augmented := countingImagePool(t, tt.augmented.X, tt.augmented.Y)
+			canvas := countingImagePool(t, 64, 64)
+
+			const runs = 200
+			testing.AllocsPerRun(runs, func() {
+				if _, err := augmentedPasses(context.Background(), session, src, cfg); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if n := augmented.Load(); n > maxPoolAllocs(runs) {
+				t.Errorf("%d 次 %s 增强推理新分配了 %d 个增强图像，期望最多 %d 个", runs+1, tt.op, n, maxPoolAllocs(runs))
+			}
+			if n := canvas.Load(); n > maxPoolAllocs(runs) {
+				t.Errorf("%d 次 %s 增强推理新分配了 %d 个画布，期望最多 %d 个", runs+1, tt.op, n, maxPoolAllocs(runs))
+			}
+		})
+	}
+}
+
+func TestDetectImageReturnsImagesToPool(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.Task = taskDetect
+	config.InputSize = 64
+	config.PreprocessWorkers = 1
+	config.ResizeMode, config.RectScaling = resizeLetterbox, false
+	steadyImagePool(t)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "frame.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, randomRGBA(image.Rect(0, 0, 64, 48), 3)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	session := newFakeSession(make([]float32, 6), outputLayout{Format: formatE2E, NumChannels: 6, NumAnchors: 1})
+
+	// 预处理的画布（64x64）和标注图像（原图尺寸 64x48）都在检测完成后归还
+	canvas := countingImagePool(t, 64, 64)
+	annotated := countingImagePool(t, 64, 48)
+	const runs = 100
+	for range runs {
+		if _, _, err := detectImageWithSession(session, input, filepath.Join(dir, "frame_detected.jpg")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := canvas.Load(); n > maxPoolAllocs(runs) {
+		t.Errorf("%d 次检测新分配了 %d 个画布，期望最多 %d 个", runs, n, maxPoolAllocs(runs))
+	}
+	if n := annotated.Load(); n > maxPoolAllocs(runs) {
+		t.Errorf("%d 次检测新分配了 %d 个标注图像，期望最多 %d 个", runs, n, maxPoolAllocs(runs))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// resultFormat 批量处理结果在标准输出上的格式
+var resultFormat = &config.ResultFormat
+
+// 结果输出格式
+const (
+	resultFormatText  = "text"  // 中文提示信息（默认）
+	resultFormatJSONL = "jsonl" // 每张图像一行 JSON，提示信息改为输出到标准错误
+)
+
+// JSONLRecord -result-format jsonl 时每张处理完的图像输出的一行
+type JSONLRecord struct {
+	TaskID     uint64            `json:"task_id"` // 按完成顺序输出，需要输入顺序时按 task_id 重排
+	ImagePath  string            `json:"path"`
+	Frame      *int              `json:"frame,omitempty"`  // 视频输入的帧序号
+	OutputPath string            `json:"output,omitempty"` // 标注图像的保存路径，检测或保存失败时为空
+	DurationMS float64           `json:"duration_ms"`      // 检测和绘制保存的耗时（毫秒）
+	Detections []DetectionObject `json:"detections"`       // 无检测结果或出错时为空数组
+	Error      string            `json:"error,omitempty"`
+}
+
+var (
+	// jsonlOut 结果行写入的原始标准输出；开启 jsonl 后 os.Stdout 指向标准错误，提示信息不会混入结果
+	jsonlOut   *os.File
+	jsonlMutex sync.Mutex
+)
+
+// setupResultFormat 校验 -result-format；jsonl 时把 os.Stdout 换成标准错误，
+// 此后所有 fmt.Printf 的提示信息都输出到标准错误，标准输出只有结果行，可以直接交给 jq 或日志采集
+func setupResultFormat() error {
+	switch *resultFormat {
+	case resultFormatText:
+		return nil
+	case resultFormatJSONL:
+		jsonlOut = os.Stdout
+		os.Stdout = os.Stderr
+		return nil
+	default:
+		return fmt.Errorf("不支持的结果输出格式: %s（可选 text、jsonl）", *resultFormat)
+	}
+}
+
+// jsonlEnabled 判断是否按 JSON Lines 输出结果
+func jsonlEnabled() bool {
+	return jsonlOut != nil
+}
+
+// emitJSONL 输出一张图像的结果行，未开启 jsonl 时不输出；可并发调用，每行完整写入
+// renderErr、renderElapsed 为绘制保存的错误和耗时，检测失败的图像没有这一步
+func emitJSONL(result DetectionResult, outputPath string, renderErr error, renderElapsed time.Duration) {
+	if !jsonlEnabled() {
+		return
+	}
+	record := JSONLRecord{
+		TaskID:     result.TaskID,
+		ImagePath:  result.ImagePath,
+		DurationMS: float64(result.Elapsed+renderElapsed) / float64(time.Millisecond),
+		Detections: []DetectionObject{},
+	}
+	if frame, ok := result.Metadata["frame_index"].(int); ok {
+		record.Frame = &frame
+	}
+	switch {
+	case result.Error != nil:
+		record.Error = result.Error.Error()
+	case renderErr != nil:
+		record.Error = fmt.Sprintf("保存图像失败: %v", renderErr)
+	default:
+		record.OutputPath = outputPath
+		for _, box := range result.Objects {
+			record.Detections = append(record.Detections, newDetectionObject(box))
+		}
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("序列化结果行失败: %v\n", err)
+		return
+	}
+	jsonlMutex.Lock()
+	defer jsonlMutex.Unlock()
+	jsonlOut.Write(append(line, '\n'))
+}
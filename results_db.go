@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// resultDBPath 检测结果写入的 SQLite 数据库路径，空表示不写入
+var resultDBPath = &config.ResultDB
+
+// resultDBDriver 结果数据库使用的 database/sql 驱动名
+// 默认构建不包含 SQLite 驱动（避免引入 cgo 或大体积依赖），以 -tags sqlite 构建时由 sqlite_driver.go 设置
+var resultDBDriver string
+
+// ErrNoSQLiteDriver 当前构建未包含 SQLite 驱动
+var ErrNoSQLiteDriver = errors.New("当前构建未包含 SQLite 驱动，请以 -tags sqlite 重新构建")
+
+const (
+	resultDBQueueSize = 4096 // 等待写入的记录数上限，写入跟不上时丢弃新记录而不阻塞检测
+	resultDBBatchSize = 256  // 每个事务最多写入的记录数
+	resultDBTimeFmt   = "2006-01-02 15:04:05.000"
+)
+
+// openResultDB 打开（必要时创建）结果数据库并迁移到最新结构
+// 开启 WAL，查询（query 子命令、外部工具）与写入互不阻塞；只使用一个连接，写入由 dbSink 的写入协程串行完成
+func openResultDB(path string) (*sql.DB, error) {
+	if resultDBDriver == "" {
+		return nil, ErrNoSQLiteDriver
+	}
+	db, err := sql.Open(resultDBDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{`PRAGMA journal_mode=WAL`, `PRAGMA busy_timeout=5000`, `PRAGMA synchronous=NORMAL`} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("设置 %s 失败: %w", pragma, err)
+		}
+	}
+	if err := applyMigrations(db, resultDBMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// dbSink 把检测结果写入 SQLite：每个检测目标一行 detections，每次运行一行 runs（模型、阈值、起止时间）
+// Write 只把记录放入队列，由写入协程按批在事务中插入，数据库变慢时不阻塞检测；
+// 队列满或写入失败的记录记入日志，不中断检测。没有检测目标或处理失败的图像不写入
+type dbSink struct {
+	mutex   sync.Mutex
+	name    string
+	db      *sql.DB
+	runID   int64
+	records chan ResultRecord
+	done    chan struct{}
+	closed  bool
+	dropped int // 队列满时丢弃的记录数
+	failed  int // 写入失败的记录数，只在写入协程中修改，Close 等待协程结束后读取
+}
+
+func newDBSink(path string) (*dbSink, error) {
+	db, err := openResultDB(path)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.Exec(`INSERT INTO runs (started_at, input, model, conf_threshold, iou_threshold) VALUES (?, ?, ?, ?, ?)`,
+		time.Now().UTC().Format(resultDBTimeFmt), *inputImagePath, config.ModelPath, *confidenceThreshold, *iouThreshold)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("写入运行记录失败: %w", err)
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("读取运行记录ID失败: %w", err)
+	}
+	s := &dbSink{
+		name:    "db:" + path,
+		db:      db,
+		runID:   runID,
+		records: make(chan ResultRecord, resultDBQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+func (s *dbSink) Name() string { return s.name }
+
+func (s *dbSink) Write(record ResultRecord) error {
+	if record.Error != "" || len(record.Detections) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	select {
+	case s.records <- record:
+		return nil
+	default:
+		s.dropped++
+		return fmt.Errorf("写入队列已满，记录 %s 未写入数据库", record.ImagePath)
+	}
+}
+
+// loop 写入协程：取出队列中已有的记录（最多 resultDBBatchSize 条）在一个事务中插入
+func (s *dbSink) loop() {
+	defer close(s.done)
+	batch := make([]ResultRecord, 0, resultDBBatchSize)
+	for record := range s.records {
+		batch = append(batch[:0], record)
+	drain:
+		for len(batch) < resultDBBatchSize {
+			select {
+			case r, ok := <-s.records:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		if err := s.insert(batch); err != nil {
+			s.failed += len(batch)
+			writeLogFile("ERROR", fmt.Sprintf("写入输出 %s 失败（%d 条记录）: %v", s.name, len(batch), err))
+		}
+	}
+}
+
+func (s *dbSink) insert(batch []ResultRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO detections
+		(schema_version, image_path, timestamp, label, confidence, x1, y1, x2, y2, task_id, run_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range batch {
+		ts := record.Timestamp.UTC().Format(resultDBTimeFmt)
+		for _, d := range record.Detections {
+			if _, err := stmt.Exec(ResultSchemaVersion, record.ImagePath, ts, d.Label, d.Confidence,
+				d.Box[0], d.Box[1], d.Box[2], d.Box[3], int64(record.TaskID), s.runID); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Flush 写入协程每取出一批记录就提交一次事务，没有需要额外刷新的缓冲
+func (s *dbSink) Flush() error { return nil }
+
+// Close 等待队列中的记录写完，记录运行结束时间后关闭数据库
+func (s *dbSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.records)
+	s.mutex.Unlock()
+	<-s.done
+
+	_, err := s.db.Exec(`UPDATE runs SET finished_at = ? WHERE id = ?`, time.Now().UTC().Format(resultDBTimeFmt), s.runID)
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && s.dropped+s.failed > 0 {
+		err = fmt.Errorf("%d 条记录因队列已满被丢弃，%d 条记录写入失败（详见日志）", s.dropped, s.failed)
+	}
+	return err
+}
+
+// runQueryCommand query 子命令：在 -db 指定的结果数据库上执行一条 SQL，以制表符对齐输出结果
+// 例如 query -db results.db "SELECT label, COUNT(*) FROM detections GROUP BY label"
+func runQueryCommand(args []string) bool {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	dbPath := fs.String("db", *resultDBPath, "结果数据库路径")
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if *dbPath == "" || query == "" {
+		fmt.Printf("用法: query -db results.db \"SELECT ...\"\n")
+		return false
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Printf("打开结果数据库失败: %v\n", err)
+		return false
+	}
+	db, err := openResultDB(*dbPath)
+	if err != nil {
+		fmt.Printf("打开结果数据库失败: %v\n", err)
+		return false
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		fmt.Printf("查询失败: %v\n", err)
+		return false
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		fmt.Printf("查询失败: %v\n", err)
+		return false
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			fmt.Printf("读取查询结果失败: %v\n", err)
+			return false
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				cells[i] = "NULL"
+			case []byte:
+				cells[i] = string(v)
+			default:
+				cells[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	if err := rows.Err(); err != nil {
+		fmt.Printf("读取查询结果失败: %v\n", err)
+		return false
+	}
+	return true
+}
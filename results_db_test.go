@@ -0,0 +1,106 @@
+//go:build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDBSinkWritesDetectionsAndRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	sink, err := newDBSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []ResultRecord{
+		{ImagePath: "a.jpg", Timestamp: time.Now(), TaskID: 1, Detections: []DetectionObject{
+			{Label: "person", Confidence: 0.9, Box: [4]float32{1, 2, 3, 4}},
+			{Label: "car", Confidence: 0.8, Box: [4]float32{5, 6, 7, 8}},
+		}},
+		{ImagePath: "b.jpg", Timestamp: time.Now(), TaskID: 2}, // 没有检测目标，不写入
+		{ImagePath: "c.jpg", Timestamp: time.Now(), Error: "解码失败"},
+	}
+	for _, r := range records {
+		if err := sink.Write(r); err != nil {
+			t.Fatalf("写入 %s 失败: %v", r.ImagePath, err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := sink.Write(records[0]); err == nil {
+		t.Error("关闭后写入应返回错误")
+	}
+
+	// 重新打开：迁移已应用，不应重复执行
+	db, err := openResultDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM detections WHERE run_id = ?`, sink.runID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("detections 共 %d 行，期望 2", count)
+	}
+	var label string
+	var x2 float64
+	if err := db.QueryRow(`SELECT label, x2 FROM detections WHERE image_path = 'a.jpg' ORDER BY confidence DESC LIMIT 1`).Scan(&label, &x2); err != nil {
+		t.Fatal(err)
+	}
+	if label != "person" || x2 != 3 {
+		t.Errorf("第一行 = (%s, %v)，期望 (person, 3)", label, x2)
+	}
+	var finished *string
+	if err := db.QueryRow(`SELECT finished_at FROM runs WHERE id = ?`, sink.runID).Scan(&finished); err != nil {
+		t.Fatal(err)
+	}
+	if finished == nil || *finished == "" {
+		t.Error("Close 后 runs.finished_at 未设置")
+	}
+}
+
+func TestApplyMigrationsOnExistingDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	// 只执行到版本 1 的旧数据库，已有检测记录
+	db, err := sql.Open(resultDBDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyMigrations(db, resultDBMigrations[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO detections (schema_version, image_path, timestamp, label, confidence, x1, y1, x2, y2)
+		VALUES (0, 'old.jpg', '2024-05-01 08:00:00.000', 'person', 0.9, 1, 2, 3, 4)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// 反复打开：第一次迁移到最新版本，之后不再执行
+	for i := 0; i < 3; i++ {
+		db, err := openResultDB(path)
+		if err != nil {
+			t.Fatalf("第 %d 次打开: %v", i+1, err)
+		}
+		var applied, latest, rows int
+		if err := db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&applied, &latest); err != nil {
+			t.Fatal(err)
+		}
+		if applied != len(resultDBMigrations) || latest != resultDBMigrations[len(resultDBMigrations)-1].version {
+			t.Errorf("第 %d 次打开后 schema_migrations 有 %d 条，最新版本 %d", i+1, applied, latest)
+		}
+		var runID *int64
+		if err := db.QueryRow(`SELECT COUNT(*), MAX(run_id) FROM detections WHERE image_path = 'old.jpg'`).Scan(&rows, &runID); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 1 || runID != nil {
+			t.Errorf("第 %d 次打开后旧记录 %d 行，run_id = %v，期望保留 1 行且 run_id 为空", i+1, rows, runID)
+		}
+		db.Close()
+	}
+}
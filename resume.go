@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+)
+
+// 断点续跑和输出文件已存在时的处理参数
+var (
+	skipExisting     = &config.SkipExisting
+	forceRerun       = &config.Force
+	overwriteOutputs = &config.Overwrite
+	noClobber        = &config.NoClobber
+)
+
+// collisionMode 生成的输出文件已存在时的处理方式
+type collisionMode int
+
+const (
+	collisionRename       collisionMode = iota // 默认：加 -1、-2 后缀，保留已有文件
+	collisionOverwrite                         // -overwrite，或 -skip-existing 同时指定 -force：替换已有文件
+	collisionNoClobber                         // -no-clobber：跳过该图像并提示
+	collisionSkipExisting                      // -skip-existing：跳过该图像，结束时汇总跳过的数量
+)
+
+// outputCollisionMode 返回本次运行的输出文件冲突处理方式
+func outputCollisionMode() collisionMode {
+	switch {
+	case *overwriteOutputs:
+		return collisionOverwrite
+	case *noClobber:
+		return collisionNoClobber
+	case *skipExisting && *forceRerun:
+		return collisionOverwrite
+	case *skipExisting:
+		return collisionSkipExisting
+	default:
+		return collisionRename
+	}
+}
+
+// skipOutput 判断是否因输出文件已存在而跳过该图像（-no-clobber、-skip-existing），-no-clobber 时打印提示
+func skipOutput(imagePath, outputPath string) bool {
+	mode := outputCollisionMode()
+	if mode != collisionNoClobber && mode != collisionSkipExisting {
+		return false
+	}
+	if !outputExists(outputPath) {
+		return false
+	}
+	if mode == collisionNoClobber {
+		fmt.Printf("输出文件 %s 已存在，跳过图像 %s（-no-clobber）\n", outputPath, imagePath)
+	}
+	return true
+}
+
+// outputNameHash 输出文件名中区分同名输入的部分：输入图像绝对路径的 FNV-1a 哈希（8 位十六进制）
+// 同一输入每次运行得到相同的输出文件名，重新运行时可以据此判断哪些图像已经处理过
+func outputNameHash(imagePath string) string {
+	path := imagePath
+	if !isRemoteInput(imagePath) {
+		path = filepath.Clean(imagePath)
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// pendingOutputs 按 -skip-existing / -no-clobber 过滤已有输出文件的图像，返回仍需处理的图像和对应的输出路径，以及跳过的数量
+// 其他模式下原样返回（默认模式的输出路径在生成时已避开已有文件）。输出文件先写入临时文件再重命名，
+// 存在即表示上次运行已完整写入
+func pendingOutputs(imagePaths, outputPaths []string) ([]string, []string, int) {
+	if mode := outputCollisionMode(); mode != collisionNoClobber && mode != collisionSkipExisting {
+		return imagePaths, outputPaths, 0
+	}
+	pendingImages := make([]string, 0, len(imagePaths))
+	pendingOutputs := make([]string, 0, len(outputPaths))
+	for i, outputPath := range outputPaths {
+		if skipOutput(imagePaths[i], outputPath) {
+			continue
+		}
+		pendingImages = append(pendingImages, imagePaths[i])
+		pendingOutputs = append(pendingOutputs, outputPath)
+	}
+	return pendingImages, pendingOutputs, len(imagePaths) - len(pendingImages)
+}
+
+// outputExists 判断输出文件是否已存在，s3:// 输出通过 HEAD 请求判断
+func outputExists(outputPath string) bool {
+	if isS3Path(outputPath) {
+		return s3ObjectExists(outputPath)
+	}
+	info, err := os.Stat(longPath(outputPath))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// writeFileAtomic 在 path 所在目录创建临时文件，由 write 写入后重命名为 path，目录不存在时先创建（-preserve-structure 的子目录）
+// 写入中途失败或进程被终止时不会留下不完整的输出文件（-skip-existing 依赖这一点）
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(longPath(dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(longPath(dir), "."+base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp 创建的文件权限为 0600，改为与 os.Create 相同的默认权限
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), longPath(path))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 重试参数
+var (
+	retryAttempts = &config.RetryAttempts
+	retryBackoff  = &config.RetryBackoff
+)
+
+// retryPolicy 对偶发失败（GPU 显存紧张时的推理失败、会话池暂时取不到会话）的重试策略
+type retryPolicy struct {
+	attempts int           // 最多尝试次数（含第一次），不足 1 时按 1 处理
+	backoff  time.Duration // 第一次重试前的等待时间，之后每次加倍
+}
+
+// currentRetryPolicy 返回 -retry-attempts 和 -retry-backoff 对应的重试策略
+func currentRetryPolicy() retryPolicy {
+	return retryPolicy{attempts: max(1, *retryAttempts), backoff: *retryBackoff}
+}
+
+// do 执行 fn，失败时按退避时间重试，返回实际尝试的次数
+// 每次重试前检查 ctx，等待期间 ctx 结束时立即返回；retryable 为 nil 时所有错误都重试。
+// 多次尝试都失败时返回的错误包含每一次的错误（errors.Is 对其中任一次都成立）
+func (p retryPolicy) do(ctx context.Context, retryable func(error) bool, fn func() error) (int, error) {
+	var errs []error
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return attempt, nil
+		}
+		errs = append(errs, err)
+		if attempt >= p.attempts || (retryable != nil && !retryable(err)) {
+			break
+		}
+		if err := p.wait(ctx, backoff); err != nil {
+			return attempt, fmt.Errorf("第 %d 次尝试失败后停止重试: %w", attempt, attemptErrors(append(errs, err)))
+		}
+		backoff *= 2
+	}
+	if len(errs) == 1 {
+		return 1, errs[0]
+	}
+	return len(errs), fmt.Errorf("共尝试 %d 次均失败: %w", len(errs), attemptErrors(errs))
+}
+
+// wait 等待 d 或直到 ctx 结束，ctx 结束时返回 ctx.Err()
+func (p retryPolicy) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// attemptErrors 每次尝试的错误，显示为一行（以分号分隔），errors.Is/As 对其中任一个都成立
+type attemptErrors []error
+
+func (e attemptErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e attemptErrors) Unwrap() []error {
+	return e
+}
+
+// runRetry 执行推理，失败时按 -retry-attempts 重试，调用方需已通过 acquire 取得会话的使用权
+// 尝试次数累加到 runAttempts，返回的错误为 ErrSessionRunFailed
+func (m *ModelSession) runRetry(ctx context.Context) error {
+	attempts, err := currentRetryPolicy().do(ctx, nil, m.run)
+	m.runAttempts += attempts
+	if err != nil {
+		return sessionRunError(err)
+	}
+	return nil
+}
+
+// getSession 从会话池取得会话，等待超时或创建失败时按 -retry-attempts 重试，返回尝试次数
+// 会话池已关闭或 ctx 已结束（任务取消、超时）时不重试
+func (worker *Worker) getSession(ctx context.Context) (*ModelSession, int, error) {
+	var session *ModelSession
+	attempts, err := currentRetryPolicy().do(ctx, func(err error) bool {
+		return !errors.Is(err, ErrSessionPoolClosed) && ctx.Err() == nil
+	}, func() error {
+		var err error
+		session, err = worker.manager.sessionPool.GetSession(ctx)
+		return err
+	})
+	return session, attempts, err
+}
+
+// batchContext 返回批次中所有任务的上下文都结束后才结束的上下文，用于整个批次共用的等待（如取得会话时的重试）
+// 和推理：任务各自的时限不同时，批次在最晚的时限到达时才放弃。调用方用完后需调用返回的 stop 释放资源
+func batchContext(ctxs []context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mutex sync.Mutex
+	remaining := len(ctxs)
+	stops := make([]func() bool, 0, len(ctxs))
+	for _, taskCtx := range ctxs {
+		stops = append(stops, context.AfterFunc(taskCtx, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if remaining--; remaining == 0 {
+				cancel()
+			}
+		}))
+	}
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
+}
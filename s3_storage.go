@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3 参数；访问密钥从环境变量 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY（可选 AWS_SESSION_TOKEN）读取，
+// 都未设置时匿名访问（公开读的存储桶）
+var (
+	s3Endpoint    = &config.S3Endpoint
+	s3Region      = &config.S3Region
+	s3PathStyle   = &config.S3PathStyle
+	s3KeyTemplate = &config.S3KeyTemplate
+	s3UploadJSON  = &config.S3UploadJSON
+)
+
+// s3Scheme S3 路径前缀，如 s3://bucket/frames/0001.jpg；以 / 结尾或不是图像文件的路径按前缀列出对象
+const s3Scheme = "s3://"
+
+// ErrS3 S3 请求失败（权限、对象不存在等），具体原因见 S3Error
+var ErrS3 = errors.New("S3 请求失败")
+
+// S3Error S3 返回的错误响应
+type S3Error struct {
+	Op         string // GET、PUT、HEAD、LIST
+	Bucket     string
+	Key        string
+	StatusCode int
+	Code       string // S3 错误码，如 NoSuchKey、AccessDenied、InvalidAccessKeyId、SignatureDoesNotMatch
+	Message    string
+}
+
+func (e *S3Error) Error() string {
+	msg := fmt.Sprintf("%v: %s s3://%s/%s: HTTP %d", ErrS3, e.Op, e.Bucket, e.Key, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *S3Error) Unwrap() error {
+	return ErrS3
+}
+
+// isS3Path 判断路径是否为 s3:// 路径
+func isS3Path(p string) bool {
+	return strings.HasPrefix(p, s3Scheme)
+}
+
+// splitS3Path 将 s3://bucket/key 拆分为存储桶和对象键
+func splitS3Path(p string) (bucket, key string, err error) {
+	rest := strings.TrimPrefix(p, s3Scheme)
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("S3 路径缺少存储桶: %s", p)
+	}
+	return bucket, key, nil
+}
+
+// s3Client 最小的 S3 兼容客户端（AWS S3、MinIO），使用 Signature V4 签名
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	pathStyle bool
+	accessKey string
+	secretKey string
+	token     string
+	http      *http.Client
+}
+
+var (
+	s3Default     *s3Client
+	s3DefaultErr  error
+	s3DefaultOnce sync.Once
+)
+
+// defaultS3Client 按参数和环境变量创建进程内共用的客户端
+// 终端地址依次取 -s3-endpoint、AWS_ENDPOINT_URL_S3、AWS_ENDPOINT_URL，都为空时使用 AWS 的区域终端地址；
+// 区域依次取 -s3-region、AWS_REGION、AWS_DEFAULT_REGION，默认 us-east-1
+func defaultS3Client() (*s3Client, error) {
+	s3DefaultOnce.Do(func() {
+		region := firstNonEmpty(*s3Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+		endpoint := firstNonEmpty(*s3Endpoint, os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"), "https://s3."+region+".amazonaws.com")
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			s3DefaultErr = fmt.Errorf("S3 终端地址无效: %s", endpoint)
+			return
+		}
+		s3Default = &s3Client{
+			endpoint:  u,
+			region:    region,
+			pathStyle: *s3PathStyle,
+			accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			token:     os.Getenv("AWS_SESSION_TOKEN"),
+			http:      &http.Client{Timeout: *downloadTimeout},
+		}
+		if (s3Default.accessKey == "") != (s3Default.secretKey == "") {
+			s3DefaultErr = errors.New("S3 凭证不完整: AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY 需要同时设置")
+		}
+	})
+	return s3Default, s3DefaultErr
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// do 发送签名后的请求，非 2xx 响应转换为 *S3Error；成功时调用方负责关闭响应体
+func (c *s3Client) do(op, method, bucket, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u := *c.endpoint
+	escapedPath := "/" + s3URIEncode(key, false)
+	if c.pathStyle {
+		escapedPath = "/" + s3URIEncode(bucket, false) + escapedPath
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	u.Path, _ = url.PathUnescape(escapedPath)
+	u.RawPath = escapedPath
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.sign(req, escapedPath, body, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s s3://%s/%s: %w", ErrS3, op, bucket, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	s3Err := &S3Error{Op: op, Bucket: bucket, Key: key, StatusCode: resp.StatusCode}
+	var payload struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && xml.Unmarshal(data, &payload) == nil {
+		s3Err.Code, s3Err.Message = payload.Code, payload.Message
+	}
+	if s3Err.Code == "" && resp.StatusCode == http.StatusNotFound {
+		s3Err.Code = "NoSuchKey" // HEAD 请求没有响应体
+	}
+	return nil, s3Err
+}
+
+// sign 按 AWS Signature Version 4 为请求签名，未配置凭证时不签名（匿名访问）
+func (c *s3Client) sign(req *http.Request, escapedPath string, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if c.accessKey == "" {
+		return
+	}
+	if c.token != "" {
+		req.Header.Set("x-amz-security-token", c.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, escapedPath, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := amzDate[:8] + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), amzDate[:8])
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3URIEncode 按 SigV4 的规则编码：只保留 A-Z a-z 0-9 - _ . ~，encodeSlash 为 false 时保留 /
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3CanonicalQuery 按键排序并编码查询参数
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// getObject 下载对象，超过 limit 字节（大于 0 时）返回 errDownloadTooLarge
+func (c *s3Client) getObject(bucket, key string, w io.Writer, limit int64) error {
+	resp, err := c.do("GET", http.MethodGet, bucket, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if limit > 0 && resp.ContentLength > limit {
+		return fmt.Errorf("%w（%d 字节）", errDownloadTooLarge, resp.ContentLength)
+	}
+	body := io.Reader(resp.Body)
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && n > limit {
+		return errDownloadTooLarge
+	}
+	return nil
+}
+
+// putObject 上传对象
+func (c *s3Client) putObject(bucket, key string, data []byte, contentType string) error {
+	resp, err := c.do("PUT", http.MethodPut, bucket, key, nil, data, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// headObject 判断对象是否存在
+func (c *s3Client) headObject(bucket, key string) (bool, error) {
+	resp, err := c.do("HEAD", http.MethodHead, bucket, key, nil, nil, nil)
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) && s3Err.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// listObjects 列出前缀下的所有对象键（ListObjectsV2，自动翻页）
+func (c *s3Client) listObjects(bucket, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do("LIST", http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析 S3 对象列表失败: %w", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// listS3Images 展开 s3:// 输入：指向图像对象时直接返回，否则按前缀列出其中的图像（含子前缀）
+func listS3Images(input string) ([]string, error) {
+	bucket, key, err := splitS3Path(input)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" && !strings.HasSuffix(key, "/") && supportedImageExts[strings.ToLower(path.Ext(key))] {
+		return []string{input}, nil
+	}
+	client, err := defaultS3Client()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := client.listObjects(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	var imagePaths []string
+	for _, k := range keys {
+		if supportedImageExts[strings.ToLower(path.Ext(k))] {
+			imagePaths = append(imagePaths, s3Scheme+bucket+"/"+k)
+		}
+	}
+	sort.Strings(imagePaths)
+	return imagePaths, nil
+}
+
+// fetchS3 下载 s3:// 对象到本地文件（供 downloadImage 使用），与 URL 输入共用 -download-max-mb 和下载目录
+func fetchS3(input string) (string, error) {
+	bucket, key, err := splitS3Path(input)
+	if err != nil {
+		return "", err
+	}
+	client, err := defaultS3Client()
+	if err != nil {
+		return "", err
+	}
+	localPath, err := downloadPath(input)
+	if err != nil {
+		return "", err
+	}
+	err = writeFileAtomic(localPath, func(f *os.File) error {
+		return client.getObject(bucket, key, f, int64(*downloadMaxMB)<<20)
+	})
+	if err != nil {
+		return "", fmt.Errorf("下载 %s 失败: %w", input, err)
+	}
+	return localPath, nil
+}
+
+// uploadS3 上传到 s3:// 路径
+func uploadS3(output string, data []byte, contentType string) error {
+	bucket, key, err := splitS3Path(output)
+	if err != nil {
+		return err
+	}
+	client, err := defaultS3Client()
+	if err != nil {
+		return err
+	}
+	return client.putObject(bucket, key, data, contentType)
+}
+
+// s3ObjectExists 判断 s3:// 输出是否已存在（-skip-existing）
+func s3ObjectExists(output string) bool {
+	bucket, key, err := splitS3Path(output)
+	if err != nil {
+		return false
+	}
+	client, err := defaultS3Client()
+	if err != nil {
+		return false
+	}
+	exists, err := client.headObject(bucket, key)
+	return err == nil && exists
+}
+
+// s3OutputPath 按 -s3-key-template 生成输出对象路径，prefix 为 -output 指定的 s3://bucket/prefix
+// 占位符与 -output-template 相同；对象键不做文件名字符清理，模板中的 / 表示子前缀
+func s3OutputPath(prefix string, fields outputNameFields, suffix []string) string {
+	key := fields.expand(*s3KeyTemplate, suffix)
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(key, "/")
+}
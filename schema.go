@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ResultSchemaVersion 导出记录的结构版本号
+// 字段只允许新增（且新增字段必须带 omitempty），不得删除或修改已有字段的含义；
+// 若必须做不兼容修改，需要递增版本号并在 upgradeResultRecord 中补充升级逻辑
+const ResultSchemaVersion = 1
+
+// ResultRecord 对外导出的单张图像检测记录（JSON/NDJSON/数据库共用）
+type ResultRecord struct {
+	SchemaVersion int               `json:"schema_version"`
+	ImagePath     string            `json:"image_path"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Width         int               `json:"width,omitempty"`
+	Height        int               `json:"height,omitempty"`
+	Detections    []DetectionObject `json:"detections"` // 无检测结果时输出空数组而不是 null
+	Error         string            `json:"error,omitempty"`
+	Metadata      map[string]any    `json:"metadata,omitempty"`
+	TaskID        uint64            `json:"task_id,omitempty"` // 对应任务的 TaskID，未经 SubmitTask 提交的结果为 0
+
+	Classifications []ClassPrediction `json:"classifications,omitempty"` // 分类模式的前K个类别
+}
+
+// DetectionObject 导出记录中的单个检测目标
+type DetectionObject struct {
+	Label      string       `json:"label"`
+	LabelZh    string       `json:"label_zh,omitempty"`
+	ClassID    *int         `json:"class_id,omitempty"` // 当前模型类别表中的类别ID，不在类别表中的标签省略
+	Confidence float32      `json:"confidence"`
+	Box        [4]float32   `json:"box"`                 // x1, y1, x2, y2（原图像素坐标）
+	Keypoints  [][3]float32 `json:"keypoints,omitempty"` // 姿态关键点 x, y, conf（原图像素坐标）
+	Model      string       `json:"model,omitempty"`     // 产生该检测的模型（多模型集成推理时，融合结果为 "a+b"）
+}
+
+// newResultRecord 将内部检测结果转换为带版本号的导出记录
+func newResultRecord(result DetectionResult) ResultRecord {
+	record := ResultRecord{
+		SchemaVersion: ResultSchemaVersion,
+		ImagePath:     result.ImagePath,
+		TaskID:        result.TaskID,
+		Timestamp:     time.Now(),
+		Width:         result.Width,
+		Height:        result.Height,
+		Detections:    make([]DetectionObject, 0, len(result.Objects)),
+	}
+	if ts, ok := result.Metadata["timestamp"].(time.Time); ok {
+		record.Timestamp = ts
+	}
+	if result.Error != nil {
+		record.Error = result.Error.Error()
+	}
+	for _, box := range result.Objects {
+		record.Detections = append(record.Detections, newDetectionObject(box))
+	}
+	record.Classifications = result.Classifications
+	if len(result.Metadata) > 0 {
+		record.Metadata = make(map[string]any, len(result.Metadata))
+		for k, v := range result.Metadata {
+			if k == "timestamp" {
+				continue
+			}
+			record.Metadata[k] = v
+		}
+	}
+	return record
+}
+
+// newDetectionObject 将内部边界框转换为导出结构
+func newDetectionObject(box boundingBox) DetectionObject {
+	obj := DetectionObject{
+		Label:      box.label,
+		LabelZh:    ChineseLabel(box.label),
+		Confidence: box.confidence,
+		Box:        [4]float32{box.x1, box.y1, box.x2, box.y2},
+		Model:      box.model,
+	}
+	if id, ok := ClassID(box.label); ok {
+		obj.ClassID = &id
+	}
+	for _, kp := range box.keypoints {
+		obj.Keypoints = append(obj.Keypoints, [3]float32{kp.x, kp.y, kp.conf})
+	}
+	return obj
+}
+
+// decodeResultRecord 解析任意历史版本的导出记录，并升级到当前版本
+func decodeResultRecord(data []byte) (ResultRecord, error) {
+	var record ResultRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return ResultRecord{}, fmt.Errorf("解析检测记录失败: %w", err)
+	}
+	return upgradeResultRecord(record)
+}
+
+// upgradeResultRecord 将旧版本记录升级到当前版本
+// 版本 0 表示引入 schema_version 字段之前的记录，其字段与版本 1 相同
+func upgradeResultRecord(record ResultRecord) (ResultRecord, error) {
+	if record.SchemaVersion > ResultSchemaVersion {
+		return record, fmt.Errorf("检测记录版本 %d 高于当前支持的版本 %d", record.SchemaVersion, ResultSchemaVersion)
+	}
+	if record.SchemaVersion < 1 {
+		record.SchemaVersion = 1
+	}
+	if record.Detections == nil {
+		record.Detections = []DetectionObject{}
+	}
+	return record, nil
+}
+
+// schemaMigration 数据库结构的一次前向迁移
+type schemaMigration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// resultDBMigrations 结果数据库的迁移列表，只能在末尾追加，不得修改已发布的条目
+var resultDBMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "创建检测记录表",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS detections (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				schema_version INTEGER NOT NULL,
+				image_path TEXT NOT NULL,
+				timestamp TEXT NOT NULL,
+				label TEXT NOT NULL,
+				confidence REAL NOT NULL,
+				x1 REAL NOT NULL, y1 REAL NOT NULL, x2 REAL NOT NULL, y2 REAL NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_detections_timestamp ON detections(timestamp)`,
+		},
+	},
+	{
+		version:     2,
+		description: "记录任务ID和运行参数",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS runs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				started_at TEXT NOT NULL,
+				finished_at TEXT,
+				input TEXT NOT NULL,
+				model TEXT NOT NULL,
+				conf_threshold REAL NOT NULL,
+				iou_threshold REAL NOT NULL
+			)`,
+			`ALTER TABLE detections ADD COLUMN task_id INTEGER`,
+			`ALTER TABLE detections ADD COLUMN run_id INTEGER REFERENCES runs(id)`,
+			`CREATE INDEX IF NOT EXISTS idx_detections_label_timestamp ON detections(label, timestamp)`,
+		},
+	},
+}
+
+// applyMigrations 在数据库上执行尚未应用的迁移
+// 已应用的版本记录在 schema_migrations 表中，每个迁移在独立事务中执行
+func applyMigrations(db *sql.DB, migrations []schemaMigration) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("创建迁移表失败: %w", err)
+	}
+
+	current := 0
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("查询当前数据库版本失败: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("开始迁移事务失败 (版本 %d): %w", m.version, err)
+		}
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("执行迁移失败 (版本 %d, %s): %w", m.version, m.description, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.description, time.Now().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("记录迁移版本失败 (版本 %d): %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("提交迁移失败 (版本 %d): %w", m.version, err)
+		}
+		current = m.version
+	}
+	return nil
+}
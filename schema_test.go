@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// readResultFixture 逐行解析 testdata/result_record 下的 NDJSON 检测记录
+func readResultFixture(t *testing.T, name string) []ResultRecord {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "result_record", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []ResultRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		record, err := decodeResultRecord(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("%s 第 %d 行: %v", name, len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestDecodeResultRecordFixtures(t *testing.T) {
+	current := readResultFixture(t, "v1.ndjson")
+
+	tests := []struct {
+		name    string
+		fixture string
+		strip   func(r *ResultRecord) // 清除旧版本文档中还不存在的可选字段后再比较
+	}{
+		{"引入 schema_version 之前", "v0.ndjson", func(r *ResultRecord) {
+			r.TaskID = 0
+			for i := range r.Detections {
+				r.Detections[i].ClassID = nil
+			}
+		}},
+		{"当前版本", "v1.ndjson", func(r *ResultRecord) {}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := readResultFixture(t, tt.fixture)
+			if len(records) != len(current) {
+				t.Fatalf("解析出 %d 条记录，期望 %d 条", len(records), len(current))
+			}
+			for i, record := range records {
+				want := current[i]
+				want.Detections = slices.Clone(want.Detections)
+				tt.strip(&want)
+				if !reflect.DeepEqual(record, want) {
+					t.Errorf("第 %d 条记录\n得到 %+v\n期望 %+v", i+1, record, want)
+				}
+				if record.SchemaVersion != ResultSchemaVersion || record.Detections == nil {
+					t.Errorf("第 %d 条记录未升级到当前版本: %+v", i+1, record)
+				}
+
+				// 升级后重新编码再解析结果不变
+				data, err := json.Marshal(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				again, err := decodeResultRecord(data)
+				if err != nil || !reflect.DeepEqual(again, record) {
+					t.Errorf("第 %d 条记录重新解析后 = %+v (%v)", i+1, again, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeResultRecordRejectsNewerVersion(t *testing.T) {
+	if _, err := decodeResultRecord([]byte(`{"schema_version":99,"image_path":"a.jpg"}`)); err == nil {
+		t.Error("高于当前支持版本的记录应解析失败")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// 掩码叠加的不透明度（0-255）
+const maskOverlayAlpha = 102
+
+// attachSessionMasks 为分割模型的检测结果计算实例掩码
+// slot 为批次槽位索引，非分割模型时不做任何处理
+func attachSessionMasks(session *ModelSession, slot int, boxes []boundingBox, scaleInfo ScaleInfo) {
+	layout := session.Layout
+	if layout.NumMaskCoeffs == 0 || len(session.Outputs) < 2 {
+		return
+	}
+	protoSize := layout.NumMaskCoeffs * layout.MaskHeight * layout.MaskWidth
+	proto := session.Outputs[1].GetData()
+	if (slot+1)*protoSize > len(proto) {
+		return
+	}
+	attachMasks(boxes, proto[slot*protoSize:(slot+1)*protoSize], layout, scaleInfo)
+}
+
+// attachMasks 根据掩码系数和原型掩码计算每个检测框的二值掩码
+// 掩码 = sigmoid(系数 · 原型)，并裁剪到检测框范围内，坐标为原图像素坐标
+func attachMasks(boxes []boundingBox, proto []float32, layout outputLayout, scaleInfo ScaleInfo) {
+	inputSize := float32(*modelInputSize)
+	ratioX := float32(layout.MaskWidth) / inputSize
+	ratioY := float32(layout.MaskHeight) / inputSize
+	planeSize := layout.MaskHeight * layout.MaskWidth
+
+	for i := range boxes {
+		box := &boxes[i]
+		if len(box.maskCoeffs) != layout.NumMaskCoeffs {
+			continue
+		}
+		rect := box.toRect()
+		if rect.Empty() {
+			continue
+		}
+
+		// 原图坐标 -> 模型输入坐标 -> 原型掩码坐标
+		toProtoX := func(x int) int {
+			px := int(((float32(x)+0.5)*scaleInfo.ScaleX + float32(scaleInfo.PadLeft)) * ratioX)
+			return min(max(px, 0), layout.MaskWidth-1)
+		}
+		toProtoY := func(y int) int {
+			py := int(((float32(y)+0.5)*scaleInfo.ScaleY + float32(scaleInfo.PadTop)) * ratioY)
+			return min(max(py, 0), layout.MaskHeight-1)
+		}
+
+		// 先在原型分辨率上计算检测框覆盖区域的掩码，再按最近邻采样到原图
+		pxMin, pxMax := toProtoX(rect.Min.X), toProtoX(rect.Max.X-1)
+		pyMin, pyMax := toProtoY(rect.Min.Y), toProtoY(rect.Max.Y-1)
+		gridW := pxMax - pxMin + 1
+		grid := make([]bool, gridW*(pyMax-pyMin+1))
+		for py := pyMin; py <= pyMax; py++ {
+			for px := pxMin; px <= pxMax; px++ {
+				var sum float32
+				offset := py*layout.MaskWidth + px
+				for k, coeff := range box.maskCoeffs {
+					sum += coeff * proto[k*planeSize+offset]
+				}
+				grid[(py-pyMin)*gridW+(px-pxMin)] = sigmoid(sum) > 0.5
+			}
+		}
+
+		mask := image.NewAlpha(rect)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			py := toProtoY(y) - pyMin
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				if grid[py*gridW+toProtoX(x)-pxMin] {
+					mask.SetAlpha(x, y, color.Alpha{A: 255})
+				}
+			}
+		}
+		box.mask = mask
+	}
+}
+
+// sigmoid 激活函数
+func sigmoid(x float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(x))))
+}
+
+// flipMask 水平翻转掩码（用于TTA结果融合）
+func flipMask(mask *image.Alpha, imageWidth int) *image.Alpha {
+	bounds := mask.Bounds()
+	flipped := image.NewAlpha(image.Rect(imageWidth-bounds.Max.X, bounds.Min.Y, imageWidth-bounds.Min.X, bounds.Max.Y))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			flipped.SetAlpha(imageWidth-x-1, y, mask.AlphaAt(x, y))
+		}
+	}
+	return flipped
+}
+
+// drawMask 在图像上叠加半透明的彩色实例掩码
+func drawMask(img *image.RGBA, mask *image.Alpha, maskColor color.RGBA) {
+	area := mask.Bounds().Intersect(img.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if mask.AlphaAt(x, y).A == 0 {
+				continue
+			}
+			i := img.PixOffset(x, y)
+			pix := img.Pix[i : i+3 : i+3]
+			pix[0] = blendChannel(pix[0], maskColor.R)
+			pix[1] = blendChannel(pix[1], maskColor.G)
+			pix[2] = blendChannel(pix[2], maskColor.B)
+		}
+	}
+}
+
+// blendChannel 按 maskOverlayAlpha 混合单个颜色通道
+func blendChannel(dst, src uint8) uint8 {
+	return uint8((uint32(dst)*(255-maskOverlayAlpha) + uint32(src)*maskOverlayAlpha) / 255)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// 自检子命令参数
+var (
+	selftestImage  = &config.SelftestImage
+	selftestExpect = &config.SelftestExpect
+)
+
+// 自检和金丝雀自检使用的固定检测参数，与期望结果对应
+const (
+	selftestConfThreshold = 0.25
+	selftestIOUThreshold  = 0.7
+)
+
+// selftestConfig 返回自检和金丝雀自检使用的检测参数：固定阈值，不过滤类别、不限制数量、不做测试时增强，
+// 命令行的 -conf、-iou、-classes、-max-det 和 -augment 只影响正常检测，不会让已知答案比对失败
+func selftestConfig() DetectionConfig {
+	return DetectionConfig{ConfThreshold: selftestConfThreshold, IOUThreshold: selftestIOUThreshold}
+}
+
+// knownAnswer 自检期望结果
+// 自定义模型可以通过 -selftest-expect 提供自己的期望文件
+type knownAnswer struct {
+	MinConfidence float32         `json:"min_confidence"` // 参与统计的最低置信度
+	BoxTolerance  float32         `json:"box_tolerance"`  // 边界框各坐标允许的偏差（像素）
+	Classes       []expectedClass `json:"classes"`
+}
+
+// expectedClass 某一类别的期望检测结果
+type expectedClass struct {
+	Label    string       `json:"label"`
+	MinCount int          `json:"min_count"`
+	MaxCount int          `json:"max_count,omitempty"` // 0 表示不限制上限
+	Boxes    [][4]float32 `json:"boxes,omitempty"`     // 每个期望框必须有一个检测框与之匹配
+}
+
+// defaultKnownAnswer 内置的 assets/bus.jpg 期望结果（YOLO11x/YOLOv8x，640 输入）
+var defaultKnownAnswer = knownAnswer{
+	MinConfidence: 0.5,
+	BoxTolerance:  40,
+	Classes: []expectedClass{
+		{
+			Label:    "person",
+			MinCount: 4,
+			Boxes: [][4]float32{
+				{48, 398, 245, 902},
+				{670, 380, 810, 876},
+				{221, 405, 344, 857},
+			},
+		},
+		{
+			Label:    "bus",
+			MinCount: 1,
+			MaxCount: 1,
+			Boxes: [][4]float32{
+				{22, 231, 805, 756},
+			},
+		},
+	},
+}
+
+// loadKnownAnswer 读取期望结果文件
+func loadKnownAnswer(path string) (knownAnswer, error) {
+	if path == "" {
+		return defaultKnownAnswer, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return knownAnswer{}, fmt.Errorf("读取期望结果文件失败: %w", err)
+	}
+	var answer knownAnswer
+	if err := json.Unmarshal(data, &answer); err != nil {
+		return knownAnswer{}, fmt.Errorf("解析期望结果文件失败: %w", err)
+	}
+	return answer, nil
+}
+
+// checkKnownAnswer 将检测结果与期望结果比对，返回所有不满足的项
+func checkKnownAnswer(boxes []boundingBox, answer knownAnswer) []string {
+	var failures []string
+	for _, expected := range answer.Classes {
+		var matched []boundingBox
+		for _, box := range boxes {
+			if box.label == expected.Label && box.confidence >= answer.MinConfidence {
+				matched = append(matched, box)
+			}
+		}
+		if len(matched) < expected.MinCount {
+			failures = append(failures, fmt.Sprintf("%s 数量 %d 少于期望的 %d", expected.Label, len(matched), expected.MinCount))
+		}
+		if expected.MaxCount > 0 && len(matched) > expected.MaxCount {
+			failures = append(failures, fmt.Sprintf("%s 数量 %d 多于期望的 %d", expected.Label, len(matched), expected.MaxCount))
+		}
+		for _, want := range expected.Boxes {
+			if !anyBoxWithin(matched, want, answer.BoxTolerance) {
+				failures = append(failures, fmt.Sprintf("%s 未找到与期望框 [%.0f %.0f %.0f %.0f] 匹配的检测框（容差 %.0f）",
+					expected.Label, want[0], want[1], want[2], want[3], answer.BoxTolerance))
+			}
+		}
+	}
+	return failures
+}
+
+// anyBoxWithin 判断是否存在各坐标偏差均在容差内的检测框
+func anyBoxWithin(boxes []boundingBox, want [4]float32, tolerance float32) bool {
+	for _, box := range boxes {
+		got := [4]float32{box.x1, box.y1, box.x2, box.y2}
+		ok := true
+		for i := range got {
+			if float32(math.Abs(float64(got[i]-want[i]))) > tolerance {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// runSelfTest 执行自检：在内置图像上跑完整检测流程并比对期望结果
+// 返回 true 表示通过
+func runSelfTest() bool {
+	fmt.Printf("自检: 模型=%s, 图像=%s\n", config.ModelPath, *selftestImage)
+
+	// 平台不受支持时优先给出明确提示
+	libPath, err := getSharedLibPath()
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return false
+	}
+	fmt.Printf("ONNX Runtime库: %s (%s/%s)\n", libPath, runtime.GOOS, runtime.GOARCH)
+
+	answer, err := loadKnownAnswer(*selftestExpect)
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return false
+	}
+
+	pic, err := loadImageFile(*selftestImage)
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return false
+	}
+
+	session, err := initSession()
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return false
+	}
+	defer session.Destroy()
+
+	record, err := runDetection(context.Background(), session, *selftestImage, pic, selftestConfig())
+	if err != nil {
+		fmt.Printf("FAIL: %v\n", err)
+		return false
+	}
+	boxes := record.Objects
+
+	fmt.Printf("实际检测结果 (%d 个):\n", len(boxes))
+	for i := range boxes {
+		fmt.Printf("  %s\n", boxes[i].String())
+	}
+
+	failures := checkKnownAnswer(boxes, answer)
+	if len(failures) > 0 {
+		fmt.Printf("FAIL:\n  %s\n", strings.Join(failures, "\n  "))
+		return false
+	}
+	fmt.Printf("PASS\n")
+	return true
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serveAddr HTTP 推理服务监听地址，为空时按命令行模式处理 -img
+var serveAddr = &config.Serve
+
+const (
+	serveMaxUpload     = 32 << 20 // 单个请求体的大小上限（字节）
+	serveUploadField   = "image"  // multipart 上传时图像所在的表单字段
+	serveHealthTimeout = 10 * time.Second
+)
+
+// detectServer HTTP 推理服务：POST /detect 提交到工作协程池检测，GET /healthz 用会话池中的会话试跑一次推理
+type detectServer struct {
+	manager *VideoDetectorManager
+	probe   image.Image // 健康检查使用的空白图像
+}
+
+// runServer 启动 -serve 指定的 HTTP 服务，直到收到中断信号
+// 第一次中断时停止接收新连接，等待进行中的请求完成（最多 -shutdown-timeout）后停止工作协程池
+func runServer(addr string) int {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("监听推理服务地址 %s 失败: %v\n", addr, err)
+		return exitSetup
+	}
+	if err := ensureChineseFont(); err != nil {
+		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
+	} else {
+		defer cleanupFont()
+	}
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+	probe := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	draw.Draw(probe, probe.Bounds(), image.NewUniform(color.Gray{Y: 114}), image.Point{}, draw.Src)
+	s := &detectServer{manager: manager, probe: probe}
+
+	server := &http.Server{Handler: s.routes(), ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, release := interruptibleContext()
+	defer release()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	fmt.Printf("推理服务已在 %s 启动（POST /detect, GET /healthz, POST /admin/alerts/reload），工作协程数量: %d, 队列大小: %d\n", listener.Addr(), *workerCount, *queueSize)
+	writeLogFile("INFO", fmt.Sprintf("推理服务已在 %s 启动", listener.Addr()))
+
+	select {
+	case err := <-serveErr:
+		fmt.Printf("推理服务退出: %v\n", err)
+		return exitFailed
+	case <-ctx.Done():
+	}
+
+	fmt.Printf("正在停止推理服务，等待进行中的请求完成（最多 %v）\n", *shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("等待进行中的请求超时: %v\n", err)
+		server.Close()
+	}
+	fmt.Printf("推理服务已停止\n")
+	writeLogFile("INFO", "推理服务已停止")
+	// 服务模式收到中断信号停止属于正常退出
+	return exitOK
+}
+
+// routes 返回推理服务的路由
+func (s *detectServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/detect", s.handleDetect)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/admin/alerts/reload", s.handleAlertReload)
+	return mux
+}
+
+// handleDetect POST /detect：请求体为图像数据，或 multipart/form-data 中名为 image 的文件
+// 查询参数 conf、iou、classes、exclude_classes、max_det 覆盖命令行检测参数；annotate=1 时返回标注后的 JPEG，
+// 否则返回 JSON 检测记录（与 -sink 输出的记录结构相同）。队列已满或超出限速时返回 429
+func (s *detectServer) handleDetect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("只支持 POST"))
+		return
+	}
+	params, annotate, err := parseDetectQuery(r)
+	if err == nil {
+		_, err = newDetectionConfig().withParams(params)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	name, img, err := readUploadedImage(w, r)
+	if err != nil {
+		writeJSONError(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	result, err := submitImage(r.Context(), s.manager, name, img, params)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // 客户端已断开，工作协程看到取消后停止处理
+		}
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrRateLimited) {
+			status = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", "1")
+		}
+		writeJSONError(w, status, err)
+		return
+	}
+	if result.Error != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(result.Error, ErrTaskTimeout):
+			status = http.StatusGatewayTimeout
+		case errors.Is(result.Error, ErrManagerStopped):
+			status = http.StatusServiceUnavailable
+		}
+		writeJSONError(w, status, result.Error)
+		return
+	}
+
+	if annotate {
+		annotated := Annotate(img, result.Objects)
+		defer PutImageToPool(annotated)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, annotated, &jpeg.Options{Quality: 90}); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("编码标注图像失败: %w", err))
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+		return
+	}
+	writeJSON(w, http.StatusOK, newResultRecord(result))
+}
+
+// submitImage 把已解码的图像作为一个任务提交到工作协程池并等待结果
+// 提交失败（ErrQueueFull、ErrRateLimited、ErrManagerStopped）时返回该错误，ctx 结束时返回 ctx.Err()；
+// 检测本身的错误在 result.Error 中。结果写入 -sink 等结果输出（取消的任务除外）
+func submitImage(ctx context.Context, manager *VideoDetectorManager, name string, img image.Image, params *DetectionParams) (DetectionResult, error) {
+	callback := make(chan DetectionResult, 1)
+	task := &DetectionTask{ImagePath: name, Image: img, Params: params, Ctx: ctx, Callback: callback}
+	if err := manager.SubmitTask(task); err != nil {
+		return DetectionResult{}, err
+	}
+	select {
+	case result := <-callback:
+		if !errors.Is(result.Error, context.Canceled) {
+			resultSinks.WriteResult(result)
+			runDetectHook(result, "")
+		}
+		return result, nil
+	case <-ctx.Done():
+		return DetectionResult{}, ctx.Err()
+	}
+}
+
+// handleHealth GET /healthz：从会话池借用一个会话对空白图像推理一次，成功返回 200，
+// 会话不可用、推理失败或金丝雀自检判定未就绪时返回 503
+func (s *detectServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !s.manager.Ready() {
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("金丝雀自检失败: %s", s.manager.GetStats().CanaryLastError))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), serveHealthTimeout)
+	defer cancel()
+
+	pool := s.manager.sessionPool
+	start := time.Now()
+	session, err := pool.GetSession(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("获取会话失败: %w", err))
+		return
+	}
+	if err = session.acquire(); err == nil {
+		_, err = inferBoxes(ctx, session, s.probe, newDetectionConfig())
+		session.release()
+	}
+	if errors.Is(err, ErrSessionRunFailed) {
+		pool.PutSessionFailed(session)
+	} else {
+		pool.PutSession(session)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":     "ok",
+		"elapsed_ms": time.Since(start).Milliseconds(),
+		"queued":     s.manager.queuedTasks(),
+	})
+}
+
+// parseDetectQuery 解析 /detect 的查询参数，未指定的参数沿用命令行参数
+func parseDetectQuery(r *http.Request) (*DetectionParams, bool, error) {
+	query := r.URL.Query()
+	params := &DetectionParams{}
+	for _, f := range []struct {
+		name string
+		dst  *float32
+	}{{"conf", &params.Conf}, {"iou", &params.IOU}} {
+		if v := query.Get(f.name); v != "" {
+			value, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return nil, false, fmt.Errorf("参数 %s 无效: %q", f.name, v)
+			}
+			*f.dst = float32(value)
+		}
+	}
+	if v := query.Get("max_det"); v != "" {
+		value, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("参数 max_det 无效: %q", v)
+		}
+		params.MaxDet = value
+	}
+	params.Classes = splitQueryList(query["classes"])
+	params.ExcludeClasses = splitQueryList(query["exclude_classes"])
+
+	annotate := false
+	if v := query.Get("annotate"); v != "" {
+		value, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("参数 annotate 无效: %q", v)
+		}
+		annotate = value
+	}
+	return params, annotate, nil
+}
+
+// splitQueryList 合并重复的查询参数并按逗号拆分（classes=person,car 与 classes=person&classes=car 等价）
+func splitQueryList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// readUploadedImage 读取并解码请求中的图像，返回用于结果记录的名称（上传的文件名，原始请求体为 "upload"）
+func readUploadedImage(w http.ResponseWriter, r *http.Request) (string, image.Image, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, serveMaxUpload)
+	body := io.Reader(r.Body)
+	name := "upload"
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(serveMaxUpload); err != nil {
+			return "", nil, fmt.Errorf("解析上传表单失败: %w", err)
+		}
+		file, header, err := r.FormFile(serveUploadField)
+		if err != nil {
+			return "", nil, fmt.Errorf("表单中没有 %s 文件: %w", serveUploadField, err)
+		}
+		defer file.Close()
+		body, name = file, filepath.Base(header.Filename)
+	}
+
+	// 先确认有数据，空请求体返回 ErrEmptyImage 而不是解码错误
+	var head [1]byte
+	n, err := io.ReadFull(body, head[:])
+	if n == 0 {
+		if err == nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", nil, ErrEmptyImage
+		}
+		return "", nil, fmt.Errorf("读取请求失败: %w", err)
+	}
+	img, err := decodeImage(io.MultiReader(bytes.NewReader(head[:n]), body))
+	if err != nil {
+		return "", nil, err
+	}
+	return name, img, nil
+}
+
+// handleAlertReload POST /admin/alerts/reload：重新加载 -alert-rules 文件，之后的检测结果按新规则告警
+// 未配置 -alert-rules 时返回 404；文件无法读取或校验失败时保留原有规则，返回 422 和失败原因
+func (s *detectServer) handleAlertReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("只支持 POST"))
+		return
+	}
+	if alerts == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("未配置 -alert-rules"))
+		return
+	}
+	if err := alerts.Reload(); err != nil {
+		writeLogFile("WARN", fmt.Sprintf("重新加载告警规则失败，继续使用原有规则: %v", err))
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	zones, rules := alerts.counts()
+	writeLogFile("INFO", fmt.Sprintf("已重新加载告警规则 %s：%d 个区域，%d 条规则", alerts.path, zones, rules))
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "zones": zones, "rules": rules})
+}
+
+// uploadErrorStatus 上传图像的错误对应的 HTTP 状态码
+func uploadErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge), errors.Is(err, ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlertReloadEndpoint(t *testing.T) {
+	defer func(saved *alertEngine) { alerts = saved }(alerts)
+	dir := t.TempDir()
+	path := writeAlertRules(t, dir, alertConfig{Rules: []alertRule{{Name: "old", Severity: "info"}}})
+	engine, err := newAlertEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := (&detectServer{}).routes()
+
+	tests := []struct {
+		name   string
+		method string
+		engine *alertEngine
+		rules  []alertRule // 请求前写入规则文件，nil 表示不修改
+		status int
+		rule   string // 请求后生效的第一条规则
+	}{
+		{"只支持 POST", http.MethodGet, engine, nil, http.StatusMethodNotAllowed, "old"},
+		{"未配置 -alert-rules", http.MethodPost, nil, nil, http.StatusNotFound, "old"},
+		{"重新加载", http.MethodPost, engine, []alertRule{{Name: "new", Severity: "critical"}, {Name: "second", Severity: "info"}}, http.StatusOK, "new"},
+		{"校验失败时保留原有规则", http.MethodPost, engine, []alertRule{{Name: "bad", Severity: "urgent"}}, http.StatusUnprocessableEntity, "new"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts = tt.engine
+			if tt.rules != nil {
+				writeAlertRules(t, dir, alertConfig{Rules: tt.rules})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/admin/alerts/reload", nil))
+			if rec.Code != tt.status {
+				t.Errorf("状态码 = %d，期望 %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			engine.mutex.RLock()
+			rule := engine.rules[0].Name
+			engine.mutex.RUnlock()
+			if rule != tt.rule {
+				t.Errorf("生效的规则 = %s，期望 %s", rule, tt.rule)
+			}
+		})
+	}
+}
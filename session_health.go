@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// 会话健康检查参数
+var sessionMaxFailures = &config.SessionMaxFailures
+
+// ErrSessionRunFailed 会话执行推理失败；连续失败的会话由会话池销毁并替换（见 PutSessionFailed）
+var ErrSessionRunFailed = errors.New("运行推理失败")
+
+// sessionRunError 将会话推理返回的错误包装为 ErrSessionRunFailed
+func sessionRunError(err error) error {
+	return fmt.Errorf("%w: %w", ErrSessionRunFailed, err)
+}
+
+// PutSessionFailed 归还刚刚推理失败的会话
+// 会话连续失败达到 -session-max-failures 次时认为其 ORT 状态已损坏：直接销毁，并在后台创建一个新会话补充到池中；
+// 未达到阈值时与 PutSession 相同。推理成功后通过 PutSession 归还会清零连续失败次数
+func (pool *ModelSessionPool) PutSessionFailed(session *ModelSession) {
+	if session == nil {
+		pool.PutSession(session)
+		return
+	}
+	session.failures++
+	if pool.maxFailures <= 0 || session.failures < pool.maxFailures {
+		pool.putSession(session)
+		return
+	}
+	pool.retire(session, fmt.Sprintf("会话 %s 连续推理失败 %d 次，已销毁并在后台创建新会话", session.Name, session.failures))
+}
+
+// retire 销毁借出的故障会话并记录 reason，在后台创建一个新会话补充到池中
+func (pool *ModelSessionPool) retire(session *ModelSession, reason string) {
+	atomic.AddInt32(&pool.activeSessions, -1)
+	pool.destroy(session)
+	writeLogFile("WARN", reason)
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		return
+	}
+	pool.replacing.Add(1)
+	go pool.replaceSession()
+}
+
+// replaceSession 创建一个新会话放入池中，替换被销毁的故障会话
+func (pool *ModelSessionPool) replaceSession() {
+	defer pool.replacing.Done()
+	session, err := pool.newSession()
+	if err != nil {
+		atomic.AddInt64(&pool.createFailures, 1)
+		writeLogFile("ERROR", fmt.Sprintf("创建替换会话失败: %v", err))
+		return
+	}
+	atomic.AddInt64(&pool.sessionsReplaced, 1)
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		pool.destroy(session)
+		return
+	}
+	select {
+	case pool.sessions <- session:
+	default:
+		pool.destroy(session)
+	}
+}
+
+// destroy 销毁会话并计数
+func (pool *ModelSessionPool) destroy(session *ModelSession) {
+	session.Destroy()
+	atomic.AddInt64(&pool.sessionsDestroyed, 1)
+}
+
+// GetSessionStats 获取会话生命周期统计：创建、销毁、因连续推理失败或任务超时被替换的会话数量
+func (pool *ModelSessionPool) GetSessionStats() (created, destroyed, replaced int64) {
+	return atomic.LoadInt64(&pool.sessionsCreated),
+		atomic.LoadInt64(&pool.sessionsDestroyed),
+		atomic.LoadInt64(&pool.sessionsReplaced)
+}
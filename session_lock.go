@@ -0,0 +1,23 @@
+package main
+
+import "errors"
+
+// ErrSessionBusy 会话正在被另一个协程使用
+// 一个 ModelSession 只有一组输入/输出张量，同时推理会互相覆盖输入和结果；
+// 需要并发推理时应使用 ModelSessionPool（或 VideoDetectorManager），每个协程从池中取得自己的会话
+var ErrSessionBusy = errors.New("会话正在被其他协程使用，并发推理请使用会话池")
+
+// acquire 取得会话的使用权，覆盖 填充输入→推理→读取输出 的完整过程
+// 会话已被占用时立即返回 ErrSessionBusy，而不是排队等待：同一会话被并发使用说明调用方缺少会话池，
+// 静默串行化只会掩盖问题。集成推理的成员会话随主会话一起使用，不单独加锁
+func (m *ModelSession) acquire() error {
+	if !m.busy.CompareAndSwap(false, true) {
+		return ErrSessionBusy
+	}
+	return nil
+}
+
+// release 归还 acquire 取得的使用权
+func (m *ModelSession) release() {
+	m.busy.Store(false)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRunDetectionSessionBusy(t *testing.T) {
+	output, layout := v8Output([]string{"person"}, []testAnchor{{cx: 50, cy: 50, w: 20, h: 40, conf: 0.9}})
+	cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45}
+	session := newFakeSession(output, layout)
+	running, proceed := make(chan struct{}), make(chan struct{})
+	session.onRun = func() {
+		close(running)
+		<-proceed
+	}
+
+	// 第一个协程停在推理中途，第二个协程使用同一会话立即得到 ErrSessionBusy
+	first := make(chan error, 1)
+	go func() {
+		_, err := runDetection(context.Background(), session, "a.jpg", inputImage(), cfg)
+		first <- err
+	}()
+	<-running
+	if _, err := runDetection(context.Background(), session, "b.jpg", inputImage(), cfg); !errors.Is(err, ErrSessionBusy) {
+		t.Errorf("会话被占用时 runDetection() = %v，期望 ErrSessionBusy", err)
+	}
+	close(proceed)
+	if err := <-first; err != nil {
+		t.Errorf("先取得会话的协程失败: %v", err)
+	}
+	if session.runs != 1 {
+		t.Errorf("推理 %d 次，期望 1 次（被拒绝的调用不应推理）", session.runs)
+	}
+}
+
+func TestRunDetectionConcurrentSameSession(t *testing.T) {
+	output, layout := v8Output([]string{"person"}, []testAnchor{{cx: 50, cy: 50, w: 20, h: 40, conf: 0.9}})
+	cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45}
+	session := newFakeSession(output, layout)
+	img := inputImage()
+
+	// 两个协程反复使用同一会话：每次调用要么得到完整正确的结果，要么得到 ErrSessionBusy（-race 下不应报告数据竞争）
+	const iterations = 20
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	succeeded, busy := 0, 0
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				record, err := runDetection(context.Background(), session, "a.jpg", img, cfg)
+				mutex.Lock()
+				switch {
+				case errors.Is(err, ErrSessionBusy):
+					busy++
+				case err != nil:
+					t.Errorf("runDetection() = %v", err)
+				case len(record.Objects) != 1 || record.Objects[0].x1 != 40:
+					t.Errorf("检测结果被另一个协程覆盖: %+v", record.Objects)
+				default:
+					succeeded++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if succeeded+busy != 2*iterations || session.runs != succeeded {
+		t.Errorf("成功 %d 次、ErrSessionBusy %d 次、推理 %d 次", succeeded, busy, session.runs)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// 会话内存分配参数
+// 长时间运行时 CPU arena 会按峰值保留内存，RSS 只增不减；低内存模式关闭 arena 和内存模式优化
+var (
+	cpuMemArena = &config.CPUArena
+	memPattern  = &config.MemPattern
+	lowMemMode  = &config.LowMem
+)
+
+// 会话线程和图优化参数
+// 多个工作协程并发推理时建议 -intra-threads 1，避免线程数超过 CPU 核数
+var (
+	intraOpThreads = &config.IntraThreads
+	interOpThreads = &config.InterThreads
+	execMode       = &config.ExecMode
+	graphOptLevel  = &config.GraphOpt
+)
+
+// graphOptLevels -graph-opt 可选值
+var graphOptLevels = map[string]ort.GraphOptimizationLevel{
+	"disable":  ort.GraphOptimizationLevelDisableAll,
+	"basic":    ort.GraphOptimizationLevelEnableBasic,
+	"extended": ort.GraphOptimizationLevelEnableExtended,
+	"all":      ort.GraphOptimizationLevelEnableAll,
+}
+
+// execModes -exec-mode 可选值
+var execModes = map[string]ort.ExecutionMode{
+	"sequential": ort.ExecutionModeSequential,
+	"parallel":   ort.ExecutionModeParallel,
+}
+
+// sessionOptionsSummary 返回生效的会话配置，用于启动时打印
+func sessionOptionsSummary() string {
+	threads := func(n int) string {
+		if n <= 0 {
+			return "默认"
+		}
+		return fmt.Sprint(n)
+	}
+	arena, pattern := *cpuMemArena, *memPattern
+	if *lowMemMode {
+		arena, pattern = false, false
+	}
+	return fmt.Sprintf("会话配置: intra-threads=%s, inter-threads=%s, exec-mode=%s, graph-opt=%s, cpu-arena=%t, mem-pattern=%t",
+		threads(*intraOpThreads), threads(*interOpThreads), *execMode, *graphOptLevel, arena, pattern)
+}
+
+// configureSessionOptions 将命令行中的会话参数应用到 SessionOptions
+// initSession 创建的所有会话（包括会话池中的会话）都经过这里
+func configureSessionOptions(options *ort.SessionOptions) error {
+	arena, pattern := *cpuMemArena, *memPattern
+	if *lowMemMode {
+		arena, pattern = false, false
+	}
+	if err := options.SetCpuMemArena(arena); err != nil {
+		return fmt.Errorf("设置CPU内存池失败: %w", err)
+	}
+	if err := options.SetMemPattern(pattern); err != nil {
+		return fmt.Errorf("设置内存模式优化失败: %w", err)
+	}
+
+	if *intraOpThreads > 0 {
+		if err := options.SetIntraOpNumThreads(*intraOpThreads); err != nil {
+			return fmt.Errorf("设置intra-op线程数失败: %w", err)
+		}
+	}
+	if *interOpThreads > 0 {
+		if err := options.SetInterOpNumThreads(*interOpThreads); err != nil {
+			return fmt.Errorf("设置inter-op线程数失败: %w", err)
+		}
+	}
+	mode, ok := execModes[*execMode]
+	if !ok {
+		return fmt.Errorf("不支持的执行模式: %s（支持 sequential, parallel）", *execMode)
+	}
+	if err := options.SetExecutionMode(mode); err != nil {
+		return fmt.Errorf("设置执行模式失败: %w", err)
+	}
+	level, ok := graphOptLevels[*graphOptLevel]
+	if !ok {
+		return fmt.Errorf("不支持的图优化级别: %s（支持 disable, basic, extended, all）", *graphOptLevel)
+	}
+	if err := options.SetGraphOptimizationLevel(level); err != nil {
+		return fmt.Errorf("设置图优化级别失败: %w", err)
+	}
+	return nil
+}
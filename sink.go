@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 结果输出参数
+var (
+	sinkSpecs       = &config.Sinks
+	sinkFlushEvery  = &config.SinkFlushEvery
+	durableSinks    = &config.Durable
+	shutdownTimeout = &config.ShutdownTimeout
+)
+
+// ResultSink 检测结果输出（CSV、NDJSON、数据库、消息队列等）
+//
+// 约定：
+//   - Write 可以缓冲，但面向行的输出每凑满 -sink-flush-every 条记录必须 Flush 一次；
+//     默认每条记录都立即交给操作系统，进程被强制终止时最多丢失正在写入的一条记录
+//   - Flush 将已缓冲的记录交给底层存储
+//   - Close 先 Flush 再释放资源（-durable 时文件输出在关闭前 fsync），可重复调用；
+//     Close 之后不得再调用 Write
+//   - 实现需要自行保证并发安全
+type ResultSink interface {
+	Name() string
+	Write(record ResultRecord) error
+	Flush() error
+	Close() error
+}
+
+// sinkFactories 按 -sink 中的类型前缀创建输出
+var sinkFactories = map[string]func(target string) (ResultSink, error){
+	"ndjson": newNDJSONSink,
+	"csv":    newCSVSink,
+}
+
+// sinkKinds 返回支持的输出类型（排序后用于错误提示）
+func sinkKinds() []string {
+	kinds := make([]string, 0, len(sinkFactories))
+	for kind := range sinkFactories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// SinkCloseStatus 关闭单个输出的结果
+type SinkCloseStatus struct {
+	Name     string
+	Err      error
+	Elapsed  time.Duration
+	TimedOut bool // 在截止时间内未完成关闭，缓冲中的记录可能丢失
+}
+
+// String 返回适合打印的关闭状态
+func (s SinkCloseStatus) String() string {
+	switch {
+	case s.TimedOut:
+		return fmt.Sprintf("%s: 超时未完成刷新", s.Name)
+	case s.Err != nil:
+		return fmt.Sprintf("%s: 刷新失败: %v", s.Name, s.Err)
+	}
+	return fmt.Sprintf("%s: 已刷新并关闭 (%v)", s.Name, s.Elapsed.Round(time.Millisecond))
+}
+
+// sinkSet 同时写入多个输出；单个输出失败不影响其他输出
+type sinkSet struct {
+	mutex  sync.Mutex
+	sinks  []ResultSink
+	closed bool
+	status []SinkCloseStatus
+}
+
+// resultSinks 命令行程序使用的全局输出集合，未配置 -sink 时为空集合
+var resultSinks = &sinkSet{}
+
+// openSinks 解析 -sink 参数（逗号分隔的 类型:路径，如 ndjson:./out.ndjson,csv:./out.csv）并打开所有输出
+// 任一输出打开失败时关闭已打开的输出并返回错误
+func openSinks(specs string) (*sinkSet, error) {
+	set := &sinkSet{}
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		kind, target, ok := strings.Cut(spec, ":")
+		factory, known := sinkFactories[strings.ToLower(kind)]
+		var err error
+		switch {
+		case !ok || target == "":
+			err = fmt.Errorf("无效的输出配置 %q，格式应为 类型:路径", spec)
+		case !known:
+			err = fmt.Errorf("不支持的输出类型 %q（支持: %v）", kind, sinkKinds())
+		}
+		if err == nil {
+			var sink ResultSink
+			if sink, err = factory(target); err == nil {
+				set.sinks = append(set.sinks, sink)
+				continue
+			}
+			err = fmt.Errorf("打开输出 %s 失败: %w", spec, err)
+		}
+		set.Close(*shutdownTimeout)
+		return nil, err
+	}
+	return set, nil
+}
+
+// Write 将记录写入所有输出，返回第一个错误（其余输出照常写入）
+func (s *sinkSet) Write(record ResultRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("结果输出已关闭，记录 %s 未写入", record.ImagePath)
+	}
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.Write(record); err != nil {
+			writeLogFile("ERROR", fmt.Sprintf("写入输出 %s 失败: %v", sink.Name(), err))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("写入输出 %s 失败: %w", sink.Name(), err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// WriteResult 将检测结果转换为导出记录后写入所有输出，错误只打印不中断处理
+func (s *sinkSet) WriteResult(result DetectionResult) {
+	if len(s.sinks) == 0 {
+		return
+	}
+	if err := s.Write(newResultRecord(result)); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+// Close 并行关闭所有输出，最多等待 timeout，返回每个输出的关闭状态
+// 可重复调用，之后的调用直接返回第一次关闭的状态
+func (s *sinkSet) Close(timeout time.Duration) []SinkCloseStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return s.status
+	}
+	s.closed = true
+
+	type closeResult struct {
+		index int
+		err   error
+	}
+	start := time.Now()
+	done := make(chan closeResult, len(s.sinks))
+	status := make([]SinkCloseStatus, len(s.sinks))
+	for i, sink := range s.sinks {
+		status[i] = SinkCloseStatus{Name: sink.Name(), TimedOut: true}
+		go func() {
+			done <- closeResult{index: i, err: sink.Close()}
+		}()
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+wait:
+	for remaining := len(s.sinks); remaining > 0; remaining-- {
+		select {
+		case r := <-done:
+			status[r.index] = SinkCloseStatus{Name: status[r.index].Name, Err: r.err, Elapsed: time.Since(start)}
+		case <-deadline.C:
+			break wait
+		}
+	}
+	s.status = status
+	return status
+}
+
+// closeResultSinks 关闭全局输出并打印每个输出的刷新状态，返回是否全部成功
+func closeResultSinks() bool {
+	status := resultSinks.Close(*shutdownTimeout)
+	ok := true
+	for _, st := range status {
+		fmt.Printf("结果输出 %s\n", st)
+		if st.Err != nil || st.TimedOut {
+			ok = false
+			writeLogFile("ERROR", "结果输出 "+st.String())
+		}
+	}
+	return ok
+}
+
+// handleShutdownSignals 收到 SIGINT/SIGTERM 时在截止时间内刷新并关闭所有输出后退出
+// 正在批量处理时第一次信号只取消批量处理（输出已完成部分的汇总后正常退出）；再次收到信号时不再等待，立即退出
+func handleShutdownSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		if cancelInterruptible() {
+			outcome.interrupted.Store(true)
+			fmt.Printf("收到信号 %v，正在取消批量处理（再次中断刷新结果输出后退出）\n", sig)
+			sig = <-signals
+		}
+		fmt.Printf("收到信号 %v，正在刷新结果输出（最多等待 %v，再次中断立即退出）\n", sig, *shutdownTimeout)
+		go func() {
+			<-signals
+			os.Exit(130)
+		}()
+		closeResultSinks()
+		cleanupArchives()
+		stopProfiling()
+		os.Exit(130)
+	}()
+}
+
+// fileSink 面向行的文件输出的公共部分：缓冲写入、按条数刷新、-durable 时关闭前 fsync
+type fileSink struct {
+	mutex   sync.Mutex
+	name    string
+	file    *os.File
+	writer  *bufio.Writer
+	pending int // 自上次刷新以来写入的记录数
+	closed  bool
+}
+
+// openFileSink 以追加方式打开输出文件，中断后重新运行时不会覆盖已有结果
+func openFileSink(kind, path string) (*fileSink, bool, error) {
+	file, err := os.OpenFile(longPath(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	return &fileSink{
+		name:   kind + ":" + path,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, info.Size() == 0, nil
+}
+
+func (f *fileSink) Name() string { return f.name }
+
+// writeLine 在锁内调用 encode 写入一条记录，凑满 -sink-flush-every 条后刷新
+func (f *fileSink) writeLine(encode func(w *bufio.Writer) error) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	if err := encode(f.writer); err != nil {
+		return err
+	}
+	f.pending++
+	if f.pending >= max(1, *sinkFlushEvery) {
+		return f.flushLocked()
+	}
+	return nil
+}
+
+func (f *fileSink) flushLocked() error {
+	f.pending = 0
+	return f.writer.Flush()
+}
+
+func (f *fileSink) Flush() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	return f.flushLocked()
+}
+
+func (f *fileSink) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.flushLocked()
+	if err == nil && *durableSinks {
+		if syncErr := f.file.Sync(); syncErr != nil {
+			err = fmt.Errorf("fsync 失败: %w", syncErr)
+		}
+	}
+	if closeErr := f.file.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ndjsonSink 每行一条 ResultRecord 的 JSON
+type ndjsonSink struct {
+	*fileSink
+}
+
+func newNDJSONSink(path string) (ResultSink, error) {
+	f, _, err := openFileSink("ndjson", path)
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonSink{f}, nil
+}
+
+func (s *ndjsonSink) Write(record ResultRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化检测记录失败: %w", err)
+	}
+	return s.writeLine(func(w *bufio.Writer) error {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+}
+
+// csvHeader CSV 输出的列，每个检测目标一行；无检测结果或出错的图像输出一行空目标，保证每张图像都有记录
+var csvHeader = []string{"image_path", "timestamp", "label", "label_zh", "confidence", "x1", "y1", "x2", "y2", "model", "error"}
+
+// csvSink 每个检测目标一行的 CSV
+type csvSink struct {
+	*fileSink
+}
+
+func newCSVSink(path string) (ResultSink, error) {
+	f, empty, err := openFileSink("csv", path)
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		// 新文件写入表头，追加到已有文件时不重复写入
+		w := csv.NewWriter(f.writer)
+		w.Write(csvHeader)
+		w.Flush()
+		err = w.Error()
+		if err == nil {
+			err = f.writer.Flush()
+		}
+		if err != nil {
+			f.file.Close()
+			return nil, fmt.Errorf("写入CSV表头失败: %w", err)
+		}
+	}
+	return &csvSink{f}, nil
+}
+
+func (s *csvSink) Write(record ResultRecord) error {
+	timestamp := formatTimestamp(record.Timestamp)
+	rows := make([][]string, 0, max(1, len(record.Detections)))
+	for _, d := range record.Detections {
+		rows = append(rows, []string{record.ImagePath, timestamp, d.Label, d.LabelZh, formatConfidence(d.Confidence),
+			formatCoord(d.Box[0]), formatCoord(d.Box[1]), formatCoord(d.Box[2]), formatCoord(d.Box[3]), d.Model, record.Error})
+	}
+	if len(rows) == 0 {
+		rows = append(rows, []string{record.ImagePath, timestamp, "", "", "", "", "", "", "", "", record.Error})
+	}
+	// 一张图像的所有行作为一条记录写入，刷新时不会只写出一半
+	return s.writeLine(func(w *bufio.Writer) error {
+		cw := csv.NewWriter(w)
+		cw.WriteAll(rows)
+		return cw.Error()
+	})
+}
+
+// formatCoord 坐标保留一位小数
+func formatCoord(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 1, 32)
+}
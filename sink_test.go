@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 崩溃注入：子进程写入 crashAfter 条记录后被强制终止，不执行任何刷新或关闭
+const crashAfter = 25
+
+func TestMain(m *testing.M) {
+	if spec := os.Getenv("YOLO_SINK_CRASH"); spec != "" {
+		crashWriter(spec)
+	}
+	if args, ok := os.LookupEnv("YOLO_MAIN_ARGS"); ok {
+		runMain(args)
+	}
+	if name := filepath.Base(os.Args[0]); name == "ffmpeg" || name == "ffprobe" {
+		fakeFFmpeg(name, os.Args[1:])
+	}
+	os.Exit(m.Run())
+}
+
+// crashWriter 在子进程中按 spec（类型:路径）打开输出，写入 crashAfter 条记录后杀死自己
+func crashWriter(spec string) {
+	set, err := openSinks(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for i := 0; i < crashAfter; i++ {
+		set.WriteResult(DetectionResult{DetectionRecord: DetectionRecord{
+			ImagePath: fmt.Sprintf("frame_%03d.jpg", i),
+			Objects:   []boundingBox{{label: "person", confidence: 0.9, x2: 10, y2: 10}},
+		}})
+	}
+	self, _ := os.FindProcess(os.Getpid())
+	self.Kill()
+	select {}
+}
+
+func TestLineSinksSurviveCrash(t *testing.T) {
+	tests := []struct {
+		kind  string
+		count func(t *testing.T, path string) int // 文件中完整的记录数
+	}{
+		{"ndjson", func(t *testing.T, path string) int {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			n := 0
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if _, err := decodeResultRecord(scanner.Bytes()); err != nil {
+					break // 最后一行可能只写出一半
+				}
+				n++
+			}
+			return n
+		}},
+		{"csv", func(t *testing.T, path string) int {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			rows, _ := csv.NewReader(f).ReadAll()
+			return max(0, len(rows)-1) // 去掉表头
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results."+tt.kind)
+			cmd := exec.Command(os.Args[0], "-test.run=^$")
+			cmd.Env = append(os.Environ(), "YOLO_SINK_CRASH="+tt.kind+":"+path)
+			err := cmd.Run()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.Success() {
+				t.Fatalf("子进程应被强制终止，得到 %v", err)
+			}
+			if n := tt.count(t, path); n < crashAfter-1 {
+				t.Errorf("强制终止后文件中有 %d 条完整记录，期望至少 %d 条（最多丢失一条）", n, crashAfter-1)
+			}
+		})
+	}
+}
+
+func TestFileSinkFlushEvery(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	for _, every := range []int{1, 3} {
+		t.Run("sink-flush-every="+strconv.Itoa(every), func(t *testing.T) {
+			config.SinkFlushEvery = every
+			path := filepath.Join(t.TempDir(), "results.ndjson")
+			sink, err := newNDJSONSink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= 4; i++ {
+				if err := sink.Write(ResultRecord{SchemaVersion: ResultSchemaVersion, ImagePath: strconv.Itoa(i)}); err != nil {
+					t.Fatal(err)
+				}
+				// 未刷新的记录只在缓冲区中：文件中的记录数为刷新间隔的整数倍
+				if lines := countLines(t, path); lines != i/every*every {
+					t.Errorf("写入 %d 条后文件中有 %d 条", i, lines)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if lines := countLines(t, path); lines != 4 {
+				t.Errorf("Close 后文件中有 %d 条，期望 4 条", lines)
+			}
+			if err := sink.Close(); err != nil {
+				t.Errorf("重复 Close 返回 %v", err)
+			}
+			if err := sink.Write(ResultRecord{}); err == nil {
+				t.Error("Close 后 Write 应返回错误")
+			}
+		})
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, b := range data {
+		if b == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+// blockingSink Close 一直阻塞到 release 关闭
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+}
+
+func (s *blockingSink) Name() string { return "blocking" }
+
+func (s *blockingSink) Close() error {
+	<-s.release
+	return nil
+}
+
+// failingSink Close 返回错误
+type failingSink struct{ recordingSink }
+
+func (s *failingSink) Name() string { return "failing" }
+func (s *failingSink) Close() error { return errors.New("磁盘已满") }
+
+func TestSinkSetCloseStatus(t *testing.T) {
+	blocking := &blockingSink{release: make(chan struct{})}
+	defer close(blocking.release)
+	set := &sinkSet{sinks: []ResultSink{&recordingSink{}, &failingSink{}, blocking}}
+
+	status := set.Close(50 * time.Millisecond)
+	want := []struct {
+		name     string
+		err      bool
+		timedOut bool
+	}{
+		{"recording", false, false},
+		{"failing", true, false},
+		{"blocking", false, true},
+	}
+	if len(status) != len(want) {
+		t.Fatalf("得到 %d 个状态，期望 %d 个", len(status), len(want))
+	}
+	for i, w := range want {
+		if status[i].Name != w.name || (status[i].Err != nil) != w.err || status[i].TimedOut != w.timedOut {
+			t.Errorf("第 %d 个输出的状态 = %+v，期望 %s 出错 %v 超时 %v", i, status[i], w.name, w.err, w.timedOut)
+		}
+	}
+	if again := set.Close(time.Second); len(again) != len(status) || again[2].TimedOut != true {
+		t.Errorf("重复 Close 应返回第一次的状态，得到 %+v", again)
+	}
+	if err := set.Write(ResultRecord{ImagePath: "a.jpg"}); err == nil {
+		t.Error("Close 后 Write 应返回错误")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// 抑制策略参数
+var (
+	nmsMethod      = &config.NMS
+	softNMSSigma   = &config.SoftNMSSigma
+	softNMSMinConf = &config.SoftNMSMinConf
+)
+
+// 抑制策略
+const (
+	nmsHard = "hard" // 重叠超过 -iou 的同类框直接删除
+	nmsSoft = "soft" // 高斯 Soft-NMS：按重叠程度衰减同类框的置信度
+	nmsDIoU = "diou" // DIoU-NMS：用 DIoU 代替 IoU 与 -iou 比较，中心相距较远的相邻目标不易被抑制
+)
+
+// validateNMSMethod 检查 -nms 参数
+func validateNMSMethod() error {
+	switch *nmsMethod {
+	case nmsHard, nmsSoft, nmsDIoU:
+	default:
+		return fmt.Errorf("不支持的抑制策略: %s（支持 hard, soft, diou）", *nmsMethod)
+	}
+	if *nmsMethod == nmsSoft && *softNMSSigma <= 0 {
+		return fmt.Errorf("-soft-nms-sigma 必须大于 0")
+	}
+	return nil
+}
+
+// suppressBoxes 按 -nms 选择的策略对边界框做抑制
+// boxes 需已按置信度降序排列；Soft-NMS 会就地修改 boxes，调用方之后不应再使用它
+func suppressBoxes(boxes []boundingBox, iouThreshold, confThreshold float32) []boundingBox {
+	if *nmsMethod == nmsSoft {
+		minConf := float32(*softNMSMinConf)
+		if minConf <= 0 {
+			minConf = confThreshold
+		}
+		return softNMS(boxes, float32(*softNMSSigma), minConf)
+	}
+	return nonMaxSuppressionSorted(boxes, iouThreshold)
+}
+
+// suppressionOverlap 返回 hard/diou 抑制时用于与 -iou 比较的重叠度
+func suppressionOverlap(a, b *boundingBox) float32 {
+	if *nmsMethod == nmsDIoU {
+		return a.diou(b)
+	}
+	return a.iou(b)
+}
+
+// softNMS 高斯 Soft-NMS（Bodla et al. 2017）
+// 每轮选出置信度最高的框，同类的其余框置信度乘以 exp(-iou²/sigma)，衰减后低于 minConf 的框丢弃。
+// 拥挤场景中互相遮挡的目标不会被直接删除，只是置信度降低。boxes 作为工作区被就地修改
+func softNMS(boxes []boundingBox, sigma, minConf float32) []boundingBox {
+	if len(boxes) == 0 {
+		return []boundingBox{}
+	}
+
+	remaining := boxes
+	selected := make([]boundingBox, 0, len(remaining))
+	for len(remaining) > 0 {
+		// 取出当前置信度最高的框
+		best := 0
+		for i := 1; i < len(remaining); i++ {
+			if remaining[i].confidence > remaining[best].confidence {
+				best = i
+			}
+		}
+		picked := remaining[best]
+		remaining[best] = remaining[len(remaining)-1]
+		remaining = remaining[:len(remaining)-1]
+		if picked.confidence < minConf {
+			break // 其余框的置信度都不高于它
+		}
+		selected = append(selected, picked)
+
+		// 衰减同类框的置信度，并移除低于阈值的框
+		kept := remaining[:0]
+		for _, box := range remaining {
+			if box.label == picked.label {
+				iou := picked.iou(&box)
+				box.confidence *= float32(math.Exp(float64(-iou * iou / sigma)))
+			}
+			if box.confidence >= minConf {
+				kept = append(kept, box)
+			}
+		}
+		remaining = kept
+	}
+	return selected
+}
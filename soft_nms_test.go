@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSuppressBoxesSoftNMS(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	// 两个严重重叠的 person（IoU = 9000/11000 ≈ 0.818）和一个与之重叠的 car
+	boxes := func() []boundingBox {
+		return []boundingBox{
+			{label: "person", confidence: 0.9, x1: 0, y1: 0, x2: 100, y2: 100},
+			{label: "person", confidence: 0.8, x1: 10, y1: 0, x2: 110, y2: 100},
+			{label: "car", confidence: 0.7, x1: 0, y1: 0, x2: 100, y2: 100},
+		}
+	}
+	iou := float32(9000.0 / 11000.0)
+
+	tests := []struct {
+		name    string
+		nms     string
+		sigma   float64
+		minConf float64
+		confs   []float32 // 保留的框的置信度，按选出的顺序
+	}{
+		{"hard 删除重叠的同类框", nmsHard, 0.5, 0, []float32{0.9, 0.7}},
+		{"soft 保留重叠的同类框并衰减置信度", nmsSoft, 0.5, 0, []float32{0.9, 0.7, 0.8 * float32(math.Exp(float64(-iou*iou/0.5)))}},
+		{"sigma 越大衰减越少", nmsSoft, 2, 0, []float32{0.9, 0.7, 0.8 * float32(math.Exp(float64(-iou*iou/2)))}},
+		{"衰减后低于 -soft-nms-conf 的框丢弃", nmsSoft, 0.5, 0.3, []float32{0.9, 0.7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.NMS, config.SoftNMSSigma, config.SoftNMSMinConf = tt.nms, tt.sigma, tt.minConf
+			if err := validateNMSMethod(); err != nil {
+				t.Fatal(err)
+			}
+			kept := suppressBoxes(boxes(), 0.45, 0.1)
+			if len(kept) != len(tt.confs) {
+				t.Fatalf("保留了 %d 个框，期望 %d 个: %+v", len(kept), len(tt.confs), kept)
+			}
+			for i, conf := range tt.confs {
+				if math.Abs(float64(kept[i].confidence-conf)) > 1e-5 {
+					t.Errorf("第 %d 个框 %s 的置信度 = %.4f，期望 %.4f", i, kept[i].label, kept[i].confidence, conf)
+				}
+			}
+			for _, box := range kept {
+				if box.label == "car" && box.confidence != 0.7 {
+					t.Errorf("不同类别的框被衰减: %.4f", box.confidence)
+				}
+			}
+		})
+	}
+}
+
+func TestSoftNMSEdgeCases(t *testing.T) {
+	if kept := softNMS(nil, 0.5, 0.25); kept == nil || len(kept) != 0 {
+		t.Errorf("没有输入时 softNMS() = %#v，期望空切片", kept)
+	}
+	// 不重叠的框不衰减，低于 minConf 的框在开始时就被丢弃
+	boxes := []boundingBox{
+		{label: "person", confidence: 0.2, x1: 300, y1: 300, x2: 310, y2: 310},
+		{label: "person", confidence: 0.6, x1: 0, y1: 0, x2: 10, y2: 10},
+		{label: "person", confidence: 0.9, x1: 100, y1: 100, x2: 110, y2: 110},
+	}
+	kept := softNMS(boxes, 0.5, 0.25)
+	if len(kept) != 2 || kept[0].confidence != 0.9 || kept[1].confidence != 0.6 {
+		t.Errorf("softNMS() = %+v，期望按置信度保留 0.9 和 0.6", kept)
+	}
+}
+
+func TestValidateNMSMethod(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		nms   string
+		sigma float64
+		ok    bool
+	}{
+		{nmsHard, 0, true},
+		{nmsDIoU, 0, true},
+		{nmsSoft, 0.5, true},
+		{nmsSoft, 0, false},
+		{"gaussian", 0.5, false},
+	}
+	for _, tt := range tests {
+		config.NMS, config.SoftNMSSigma = tt.nms, tt.sigma
+		if err := validateNMSMethod(); (err == nil) != tt.ok {
+			t.Errorf("validateNMSMethod(-nms %s -soft-nms-sigma %v) = %v", tt.nms, tt.sigma, err)
+		}
+	}
+}
+
+func TestBoundingBoxDIoU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b boundingBox
+		want float32
+	}{
+		{"完全重合", boundingBox{x2: 100, y2: 100}, boundingBox{x2: 100, y2: 100}, 1},
+		{"中心相同时等于 IoU", boundingBox{x2: 100, y2: 100}, boundingBox{x1: 25, y1: 25, x2: 75, y2: 75}, 0.25},
+		// IoU = 6400/13600，中心距离² = 800，外接矩形对角线² = 28800
+		{"对角错开", boundingBox{x2: 100, y2: 100}, boundingBox{x1: 20, y1: 20, x2: 120, y2: 120}, 6400.0/13600 - 800.0/28800},
+		// 不重叠时为负：IoU = 0，中心距离² = 100²，对角线² = 150² + 50²
+		{"不重叠", boundingBox{x2: 50, y2: 50}, boundingBox{x1: 100, x2: 150, y2: 50}, -10000.0 / 25000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.diou(&tt.b); math.Abs(float64(got-tt.want)) > 1e-5 {
+				t.Errorf("diou() = %.5f，期望 %.5f", got, tt.want)
+			}
+			if got, rev := tt.a.diou(&tt.b), tt.b.diou(&tt.a); got != rev {
+				t.Errorf("diou 不对称: %.5f / %.5f", got, rev)
+			}
+		})
+	}
+}
+
+func TestSuppressBoxesDIoU(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+
+	car := boundingBox{label: "car", confidence: 0.9, x2: 100, y2: 100}
+	tests := []struct {
+		name      string
+		other     boundingBox
+		threshold float32
+		hard      int // -nms hard 保留的框数
+		diou      int // -nms diou 保留的框数
+	}{
+		// IoU ≈ 0.471，DIoU ≈ 0.443：相邻车位的车辆只有 DIoU 能同时保留
+		{"相邻目标", boundingBox{label: "car", confidence: 0.8, x1: 20, y1: 20, x2: 120, y2: 120}, 0.45, 1, 2},
+		{"阈值更低时都抑制", boundingBox{label: "car", confidence: 0.8, x1: 20, y1: 20, x2: 120, y2: 120}, 0.4, 1, 1},
+		{"中心相同的重复框", boundingBox{label: "car", confidence: 0.8, x1: 5, y1: 5, x2: 95, y2: 95}, 0.45, 1, 1},
+		{"不重叠", boundingBox{label: "car", confidence: 0.8, x1: 200, x2: 300, y2: 100}, 0.45, 2, 2},
+		{"不同类别", boundingBox{label: "truck", confidence: 0.8, x1: 5, y1: 5, x2: 95, y2: 95}, 0.45, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, mode := range []struct {
+				nms  string
+				want int
+			}{{nmsHard, tt.hard}, {nmsDIoU, tt.diou}} {
+				config.NMS = mode.nms
+				kept := suppressBoxes([]boundingBox{car, tt.other}, tt.threshold, 0.25)
+				if len(kept) != mode.want {
+					t.Errorf("-nms %s 保留了 %d 个框，期望 %d 个", mode.nms, len(kept), mode.want)
+				}
+				if len(kept) > 0 && kept[0].confidence != car.confidence {
+					t.Errorf("-nms %s 应保留置信度最高的框，得到 %+v", mode.nms, kept[0])
+				}
+			}
+		})
+	}
+}
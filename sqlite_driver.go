@@ -0,0 +1,10 @@
+//go:build sqlite
+
+package main
+
+// 以 -tags sqlite 构建时注册纯 Go 的 SQLite 驱动（无需 cgo），启用 -db 和 query 子命令
+import _ "modernc.org/sqlite"
+
+func init() {
+	resultDBDriver = "sqlite"
+}
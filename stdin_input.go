@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stdinInput -img 取该值时从标准输入逐行读取图像路径（如 find ./frames -name '*.jpg' | yolo -img -）
+const stdinInput = "-"
+
+// scanImageList 逐行读取图像路径列表，对每个存在的路径调用 emit，emit 返回 false 时停止读取
+// 空行和以 # 开头的注释行忽略，不存在的路径提示后跳过（http(s) URL 和 s3:// 路径在处理时下载，不做检查）；source 用于提示信息（文本文件、标准输入）
+// 使用 bufio.Scanner 读取行，兼容不同系统换行符（\n/\r\n）
+func scanImageList(r io.Reader, source string, emit func(path string) bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := os.Stat(line); err != nil && !isRemoteInput(line) {
+			fmt.Printf("警告：%s中的路径 %s 不存在，已跳过\n", source, line)
+			continue
+		}
+		if !emit(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// readStdinImagePaths 读取标准输入中的全部图像路径，用于不支持流式处理的模式（-task classify）
+func readStdinImagePaths() ([]string, error) {
+	var imagePaths []string
+	err := scanImageList(os.Stdin, "标准输入", func(path string) bool {
+		imagePaths = append(imagePaths, path)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取标准输入失败: %w", err)
+	}
+	return imagePaths, nil
+}
+
+// ConcurrentStreamProcessImages 从标准输入边读取图像路径边检测，标注图像保存到 outputDir
+// 路径读取后立即提交给工作协程池（ProcessImageStream），不需要先读完整个列表；
+// 每张图像完成后立即输出结果，标准输入结束后输出与批量处理相同的汇总
+func ConcurrentStreamProcessImages(outputDir string) error {
+	if err := ensureChineseFont(); err != nil {
+		fmt.Printf("警告: 中文字体初始化失败: %v\n", err)
+	}
+	fmt.Printf("从标准输入读取图像路径，工作协程数量: %d, 队列大小: %d\n", *workerCount, *queueSize)
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+	ctx, release := interruptibleContext()
+	defer release()
+
+	// 输出路径按读取顺序生成（{index} 为读取序号，{count} 为空），提交的图像按相同顺序编号，
+	// 回调的序号 i 即为 outputPaths 的下标
+	namer := newOutputNamer(outputDir, structureRoot(stdinInput), getModelIdentifier(modelPaths()[0]), 0)
+	var outputMutex sync.Mutex
+	var outputPaths []string
+	outputFor := func(i int) string {
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		return outputPaths[i]
+	}
+
+	// 读取标准输入；-skip-existing 时已有输出的图像不提交
+	// 中断后读取协程可能仍阻塞在标准输入上，不等待它退出
+	paths := make(chan string)
+	readErr := make(chan error, 1)
+	var skipped atomic.Int64
+	go func() {
+		defer close(paths)
+		readErr <- scanImageList(os.Stdin, "标准输入", func(path string) bool {
+			outputPath := namer.next(path)
+			if skipOutput(path, outputPath) {
+				skipped.Add(1)
+				return true
+			}
+			outputMutex.Lock()
+			outputPaths = append(outputPaths, outputPath)
+			outputMutex.Unlock()
+			select {
+			case paths <- path:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	progress := newCLIProgress()
+	var mutex sync.Mutex
+	var totals batchTotals
+	renderFailures := 0
+	renders := newStreamingRenderPool(*renderWorkers, func(job renderJob, err error, elapsed time.Duration) {
+		emitJSONL(job.result, job.outputPath, err, elapsed)
+		outcome.record(job.result, err)
+		if err != nil {
+			mutex.Lock()
+			totals.failures++
+			renderFailures++
+			mutex.Unlock()
+			progress.Printf("保存图像 %s 失败: %v\n", job.result.ImagePath, err)
+			return
+		}
+		progress.Printf("图像 %s 检测完成: %d 个对象 - %s，已保存至 %s\n", job.result.ImagePath, len(job.result.Objects), job.result.Summary, job.outputPath)
+		runDetectHook(job.result, job.outputPath)
+	})
+
+	start := time.Now()
+	canceled := 0
+	count := manager.ProcessImageStream(ctx, paths, progress.Func(), func(i int, result DetectionResult) {
+		if errors.Is(result.Error, context.Canceled) {
+			canceled++
+			return // 未处理的图像不写入结果输出，重新运行时可以补上
+		}
+		resultSinks.WriteResult(result)
+		mutex.Lock()
+		totals.add(result)
+		if result.Error != nil {
+			totals.failures++
+		}
+		mutex.Unlock()
+		if result.Error != nil {
+			outcome.record(result, nil)
+			emitJSONL(result, "", nil, 0)
+			progress.Printf("处理图像 %s 时出错: %v\n", result.ImagePath, result.Error)
+			return
+		}
+		renders.Submit(renderJob{index: i, result: result, outputPath: outputFor(i)})
+	})
+	renders.Wait()
+	wall := time.Since(start)
+	progress.Finish()
+
+	fmt.Printf("批量处理完成: %s\n", totals.summary(wall))
+	if n := skipped.Load(); n > 0 {
+		fmt.Printf("跳过 %d，处理 %d\n", n, totals.count)
+	}
+	printManagerStats(manager)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("批量处理已取消: 已读取 %d 个图像，已处理 %d 个，未处理 %d 个", count, count-canceled, canceled)
+	}
+	if err := <-readErr; err != nil {
+		return fmt.Errorf("读取标准输入失败: %w", err)
+	}
+	if renderFailures > 0 {
+		return fmt.Errorf("%d 个图像绘制或保存失败", renderFailures)
+	}
+	return nil
+}
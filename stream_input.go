@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 视频流输入参数
+var (
+	streamFPS     = &config.StreamFPS
+	rtspTransport = &config.RTSPTransport
+	streamTimeout = &config.StreamTimeout
+)
+
+const (
+	streamMinBackoff = time.Second      // 断流后第一次重连前的等待时间，连续失败时翻倍
+	streamMaxBackoff = 30 * time.Second // 重连等待时间上限
+)
+
+// isStreamInput 判断输入是否为视频流地址（rtsp:// 或 rtsps://）
+func isStreamInput(input string) bool {
+	lower := strings.ToLower(input)
+	return strings.HasPrefix(lower, "rtsp://") || strings.HasPrefix(lower, "rtsps://")
+}
+
+// redactStreamURL 隐藏地址中的密码，用于日志和检测结果
+func redactStreamURL(streamURL string) string {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return streamURL
+	}
+	return u.Redacted()
+}
+
+// validateStreamOptions 校验 -stream-fps、-rtsp-transport、-stream-timeout、-adaptive-drop
+func validateStreamOptions() error {
+	if *vidStride < 1 {
+		return fmt.Errorf("-vid-stride 必须大于等于 1")
+	}
+	if *streamFPS < 0 {
+		return fmt.Errorf("-stream-fps 不能为负数")
+	}
+	if *rtspTransport != "tcp" && *rtspTransport != "udp" {
+		return fmt.Errorf("不支持的 -rtsp-transport: %s（可选 tcp、udp）", *rtspTransport)
+	}
+	if *streamTimeout <= 0 {
+		return fmt.Errorf("-stream-timeout 必须大于 0")
+	}
+	if *adaptiveDrop < 0 {
+		return fmt.Errorf("-adaptive-drop 不能为负数")
+	}
+	return nil
+}
+
+// streamSource 持续读取视频流的帧：断流、超过 -stream-timeout 没有新帧或 ffmpeg 退出时，
+// 按从 1 秒翻倍（最多 30 秒）的间隔重连，直到 ctx 取消；帧序号跨重连累计
+// 同一时刻只有一个 ffmpeg 进程和一帧的读取缓冲，长时间运行内存占用不增长
+type streamSource struct {
+	ctx        context.Context
+	url        string
+	name       string // 隐藏密码的地址
+	reader     *videoFrameReader
+	frames     int // 已读取的帧数
+	backoff    time.Duration
+	reconnects int
+	after      func(time.Duration) <-chan time.Time // 等待退避间隔，默认为 time.After
+}
+
+func newStreamSource(ctx context.Context, streamURL string) *streamSource {
+	return &streamSource{ctx: ctx, url: streamURL, name: redactStreamURL(streamURL), backoff: streamMinBackoff, after: time.After}
+}
+
+// connect 探测视频流并启动 ffmpeg；探测同样受 -stream-timeout 限制，避免连接无响应的摄像头时一直等待
+func (s *streamSource) connect() error {
+	inputArgs := []string{"-rtsp_transport", *rtspTransport}
+	probeCtx, cancel := context.WithTimeout(s.ctx, *streamTimeout)
+	info, err := probeVideo(probeCtx, s.url, inputArgs...)
+	cancel()
+	if err != nil {
+		return err
+	}
+	var outputArgs []string
+	if *streamFPS > 0 {
+		outputArgs = append(outputArgs, "-vf", "fps="+strconv.FormatFloat(*streamFPS, 'f', -1, 64))
+	}
+	reader, err := startFrameReader(s.ctx, s.url, info, inputArgs, outputArgs)
+	if err != nil {
+		return err
+	}
+	reader.stride = max(1, *vidStride)
+	reader.readTimeout = *streamTimeout
+	s.reader = reader
+	fmt.Printf("已连接视频流 %s: %dx%d，%.2f fps\n", s.name, info.width, info.height, info.fps)
+	return nil
+}
+
+// Next 返回下一帧，断流时自动重连；只在 ctx 取消后返回错误
+func (s *streamSource) Next() (videoFrame, error) {
+	for {
+		if err := s.ctx.Err(); err != nil {
+			return videoFrame{}, err
+		}
+		if s.reader == nil {
+			if err := s.connect(); err != nil {
+				if s.ctx.Err() == nil {
+					s.lost(fmt.Errorf("连接失败: %w", err))
+				}
+				continue
+			}
+		}
+		frame, err := s.reader.Next()
+		if err == nil {
+			s.backoff = streamMinBackoff
+			frame.index = s.frames
+			frame.timed = false
+			s.frames++
+			return frame, nil
+		}
+		closeErr := s.reader.Close()
+		s.reader = nil
+		if s.ctx.Err() != nil {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("视频流已结束")
+			if closeErr != nil {
+				err = closeErr
+			}
+		}
+		s.lost(err)
+	}
+}
+
+// lost 记录一次断流或连接失败，等待退避间隔后返回
+func (s *streamSource) lost(err error) {
+	s.reconnects++
+	atomic.AddInt64(&metrics.streamReconnects, 1)
+	message := fmt.Sprintf("视频流 %s 中断: %v，%v 后第 %d 次重连", s.name, err, s.backoff, s.reconnects)
+	fmt.Printf("%s\n", message)
+	writeLogFile("WARN", message)
+	select {
+	case <-s.after(s.backoff):
+	case <-s.ctx.Done():
+	}
+	if s.backoff *= 2; s.backoff > streamMaxBackoff {
+		s.backoff = streamMaxBackoff
+	}
+}
+
+// Close 结束当前的 ffmpeg 进程
+func (s *streamSource) Close() {
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+// ProcessStream 持续检测视频流的帧，结果写入结果输出（-sink、-webhook-url、-mqtt-broker 等），直到收到中断信号
+func ProcessStream(streamURL string) error {
+	if err := validateStreamOptions(); err != nil {
+		return err
+	}
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	fmt.Printf("从视频流 %s 读取帧，工作协程数量: %d\n", redactStreamURL(streamURL), *workerCount)
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+	ctx, release := interruptibleContext()
+	defer release()
+
+	source := newStreamSource(ctx, streamURL)
+	defer source.Close()
+	var frames frameSource = source
+	var latest *latestFrameSource
+	if *adaptiveDrop > 0 {
+		latest = newLatestFrameSource(source, manager, *adaptiveDrop, nil)
+		frames = latest
+	}
+	progress := newCLIProgress()
+	start := time.Now()
+	stats, _ := detectFrames(ctx, manager, source.name, frames, nil, progress, nil)
+	wall := time.Since(start)
+	progress.Finish()
+
+	summary := fmt.Sprintf("视频流处理结束: %s，共检测到 %d 个对象，重连 %d 次", stats.summary(wall), stats.objects, source.reconnects)
+	if latest != nil {
+		latest.Close()
+		summary += fmt.Sprintf("，自适应丢帧 %d 帧", latest.Dropped())
+	}
+	fmt.Printf("%s\n", summary)
+	printManagerStats(manager)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidTaskParams 任务参数（DetectionParams）无效
+var ErrInvalidTaskParams = errors.New("任务参数无效")
+
+// DetectionParams 单个任务的检测参数，设置的字段覆盖对应的命令行参数（-conf, -iou, -classes, -exclude-classes, -max-det）
+// 零值字段沿用命令行参数；模型输入尺寸（-size）由会话池在创建会话时确定，暂时不能按任务修改
+type DetectionParams struct {
+	Conf           float32  // 置信度阈值，0 表示沿用 -conf
+	IOU            float32  // NMS 的 IOU 阈值，0 表示沿用 -iou
+	Classes        []string // 只保留的类别（类别名、中文名或类别ID），为空时沿用 -classes
+	ExcludeClasses []string // 排除的类别，为空时沿用 -exclude-classes
+	MaxDet         int      // 每张图像最多保留的检测框数量，0 表示沿用 -max-det
+}
+
+// withParams 用任务参数覆盖检测参数，params 为 nil 时原样返回
+func (cfg DetectionConfig) withParams(params *DetectionParams) (DetectionConfig, error) {
+	if params == nil {
+		return cfg, nil
+	}
+	if params.Conf < 0 || params.Conf > 1 {
+		return cfg, fmt.Errorf("%w: 置信度阈值 %v 不在 [0, 1] 内", ErrInvalidTaskParams, params.Conf)
+	}
+	if params.IOU < 0 || params.IOU > 1 {
+		return cfg, fmt.Errorf("%w: IOU 阈值 %v 不在 [0, 1] 内", ErrInvalidTaskParams, params.IOU)
+	}
+	if params.MaxDet < 0 {
+		return cfg, fmt.Errorf("%w: 最大检测框数量 %d 不能为负数", ErrInvalidTaskParams, params.MaxDet)
+	}
+
+	if params.Conf > 0 {
+		cfg.ConfThreshold = params.Conf
+		cfg.DecodeConf = ttaDecodeThreshold(params.Conf, cfg.Augment)
+	}
+	if params.IOU > 0 {
+		cfg.IOUThreshold = params.IOU
+	}
+	if params.MaxDet > 0 {
+		cfg.MaxDet = params.MaxDet
+	}
+	if len(params.Classes) > 0 || len(params.ExcludeClasses) > 0 {
+		include, exclude := *includeClasses, *excludeClasses
+		if len(params.Classes) > 0 {
+			include = strings.Join(params.Classes, ",")
+		}
+		if len(params.ExcludeClasses) > 0 {
+			exclude = strings.Join(params.ExcludeClasses, ",")
+		}
+		filter, err := parseClassFilter(include, exclude)
+		if err != nil {
+			return cfg, fmt.Errorf("%w: %w", ErrInvalidTaskParams, err)
+		}
+		cfg.Classes = filter
+	}
+	return cfg, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTaskTimeout 任务处理超过时限（DetectionTask.Timeout，为 0 时为 -timeout）
+// 超时的推理结果被丢弃，正在使用的会话不再放回池中
+var ErrTaskTimeout = errors.New("任务处理超时")
+
+// taskContext 返回带任务处理时限的上下文：DetectionTask.Timeout 为 0 时使用管理器的 -timeout，
+// 两者都不大于 0 时不限时。时限到达时 context.Cause 为 ErrTaskTimeout
+func (worker *Worker) taskContext(task *DetectionTask) (context.Context, context.CancelFunc) {
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = worker.manager.timeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(task.context())
+	}
+	return context.WithTimeoutCause(task.context(), timeout, fmt.Errorf("%w（%v）", ErrTaskTimeout, timeout))
+}
+
+// taskError 将 ctx 因任务时限结束导致的错误标记为 ErrTaskTimeout，其他错误原样返回
+// 调用方自己的 Ctx 超时或取消时 context.Cause 不是 ErrTaskTimeout，不受影响
+func taskError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || !errors.Is(err, ctx.Err()) {
+		return err
+	}
+	cause := context.Cause(ctx)
+	switch {
+	case !errors.Is(cause, ErrTaskTimeout):
+		return err
+	case err == ctx.Err():
+		return cause
+	default:
+		// 保留原错误（如重试等待中超时的 ErrSessionRunFailed）
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+}
+
+// 持有会话的处理阶段的状态
+const (
+	stageRunning int32 = iota
+	stageFinished
+	stageAbandoned
+)
+
+// runAbandonable 在单独的协程中执行持有会话的处理阶段 fn（预处理、推理、后处理）
+// ctx 先结束时不等待 fn 返回，立即返回 taskError(ctx, ctx.Err()) 和 abandoned = true，工作协程可以继续领取任务：
+// 卡住的 session.Run 无法中断，fn 最终返回后调用 abandon 处理仍被占用的会话，fn 的结果被丢弃。
+// fn 中的 panic 在其所在协程中恢复并转换为 ErrTaskPanic
+func (worker *Worker) runAbandonable(ctx context.Context, fn func() error, abandon func()) (err error, abandoned bool) {
+	var state atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = worker.panicError(newTaskPanic(r))
+				}
+			}()
+			return fn()
+		}()
+		if !state.CompareAndSwap(stageRunning, stageFinished) {
+			abandon()
+			return
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err, false
+	case <-ctx.Done():
+		if state.CompareAndSwap(stageRunning, stageAbandoned) {
+			return taskError(ctx, ctx.Err()), true
+		}
+		// fn 恰好已经返回
+		return <-done, false
+	}
+}
+
+// retireAbandoned 处理超时后才返回的会话：会话在超时期间一直被占用，状态不可信，
+// 按推理故障处理，销毁并在后台创建新会话补充到池中
+func (pool *ModelSessionPool) retireAbandoned(session *ModelSession, elapsed time.Duration) {
+	pool.retire(session, fmt.Sprintf("会话 %s 的任务超时后推理才结束（耗时 %v），已销毁并在后台创建新会话", session.Name, elapsed.Round(time.Millisecond)))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingImage 读取尺寸时阻塞到 release 关闭，模拟卡住的预处理或推理阶段
+type blockingImage struct {
+	image.Image
+	release chan struct{}
+}
+
+func (b blockingImage) Bounds() image.Rectangle {
+	<-b.release
+	return image.Rect(0, 0, 1, 1)
+}
+
+func TestTaskContextTimeout(t *testing.T) {
+	manager := &VideoDetectorManager{timeout: 40 * time.Millisecond}
+	worker := &Worker{manager: manager}
+
+	tests := []struct {
+		name     string
+		task     *DetectionTask
+		manager  time.Duration
+		deadline time.Duration // 0 表示不限时
+	}{
+		{"使用任务自己的时限", &DetectionTask{Timeout: 10 * time.Millisecond}, 40 * time.Millisecond, 10 * time.Millisecond},
+		{"任务未设置时使用 -timeout", &DetectionTask{}, 40 * time.Millisecond, 40 * time.Millisecond},
+		{"都未设置时不限时", &DetectionTask{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager.timeout = tt.manager
+			ctx, cancel := worker.taskContext(tt.task)
+			defer cancel()
+			deadline, ok := ctx.Deadline()
+			if tt.deadline == 0 {
+				if ok {
+					t.Errorf("不应设置时限，得到 %v", time.Until(deadline))
+				}
+				return
+			}
+			if !ok || time.Until(deadline) > tt.deadline {
+				t.Fatalf("时限 = %v，期望不超过 %v", time.Until(deadline), tt.deadline)
+			}
+			<-ctx.Done()
+			if err := taskError(ctx, ctx.Err()); !errors.Is(err, ErrTaskTimeout) {
+				t.Errorf("taskError() = %v，期望 ErrTaskTimeout", err)
+			}
+		})
+	}
+}
+
+func TestTaskError(t *testing.T) {
+	timedOut, cancel := context.WithTimeoutCause(context.Background(), 0, fmt.Errorf("%w（1s）", ErrTaskTimeout))
+	defer cancel()
+	<-timedOut.Done()
+	callerDeadline, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-callerDeadline.Done()
+	other := errors.New("加载图像失败")
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		err     error
+		timeout bool
+		keeps   error // 结果中仍能用 errors.Is 识别的原错误
+	}{
+		{"没有错误", timedOut, nil, false, nil},
+		{"与上下文无关的错误", timedOut, other, false, other},
+		{"任务时限", timedOut, timedOut.Err(), true, nil},
+		{"包装了时限错误的推理错误", timedOut, fmt.Errorf("%w: %w", ErrSessionRunFailed, timedOut.Err()), true, ErrSessionRunFailed},
+		{"调用方自己的 Ctx 超时", callerDeadline, callerDeadline.Err(), false, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := taskError(tt.ctx, tt.err)
+			if errors.Is(err, ErrTaskTimeout) != tt.timeout {
+				t.Errorf("taskError() = %v，ErrTaskTimeout: %v，期望 %v", err, errors.Is(err, ErrTaskTimeout), tt.timeout)
+			}
+			if tt.keeps != nil && !errors.Is(err, tt.keeps) {
+				t.Errorf("taskError() = %v，丢失了原错误 %v", err, tt.keeps)
+			}
+			if tt.err == nil && err != nil {
+				t.Errorf("taskError(nil) = %v", err)
+			}
+		})
+	}
+}
+
+func TestRunAbandonable(t *testing.T) {
+	worker := &Worker{manager: &VideoDetectorManager{}}
+	tests := []struct {
+		name      string
+		fn        func(release <-chan struct{}) error
+		abandoned bool
+		want      error
+	}{
+		{"按时完成", func(<-chan struct{}) error { return nil }, false, nil},
+		{"按时失败", func(<-chan struct{}) error { return ErrQueueFull }, false, ErrQueueFull},
+		{"panic", func(<-chan struct{}) error { panic("解码失败") }, false, ErrTaskPanic},
+		{"超时后放弃", func(release <-chan struct{}) error { <-release; return nil }, true, ErrTaskTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeoutCause(context.Background(), 30*time.Millisecond, ErrTaskTimeout)
+			defer cancel()
+			release := make(chan struct{})
+			abandonedCalls := make(chan struct{}, 1)
+
+			start := time.Now()
+			err, abandoned := worker.runAbandonable(ctx, func() error { return tt.fn(release) }, func() { abandonedCalls <- struct{}{} })
+			if abandoned != tt.abandoned || !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("runAbandonable() = %v, %v，期望 %v, %v", err, abandoned, tt.want, tt.abandoned)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("runAbandonable() 耗时 %v，卡住的阶段没有被放弃", elapsed)
+			}
+
+			// 被放弃的阶段最终返回后才调用 abandon；按时完成的阶段不调用
+			close(release)
+			select {
+			case <-abandonedCalls:
+				if !tt.abandoned {
+					t.Error("按时完成的阶段调用了 abandon")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.abandoned {
+					t.Error("被放弃的阶段返回后没有调用 abandon")
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerFreedAfterTaskTimeout(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+	config.BatchSize, config.BatchCollect = 1, 1
+
+	// 一个工作协程、两个会话：卡住的任务超时后，工作协程必须能用另一个会话继续处理下一个任务
+	manager := NewVideoDetectorManager(1, 4, time.Hour)
+	defer manager.Stop()
+	manager.sessionPool.Close()
+	manager.sessionPool = NewModelSessionPool(2, "fake.onnx")
+	replacedBefore := atomic.LoadInt64(&manager.sessionPool.sessionsReplaced)
+
+	release := make(chan struct{})
+	defer func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	}()
+	submit := func(task *DetectionTask) <-chan DetectionResult {
+		callback := make(chan DetectionResult, 1)
+		task.Callback = callback
+		if err := manager.SubmitTaskWait(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+		return callback
+	}
+
+	start := time.Now()
+	hung := submit(&DetectionTask{ImagePath: "hung.jpg", Image: blockingImage{release: release}, Timeout: 50 * time.Millisecond})
+	select {
+	case result := <-hung:
+		if !errors.Is(result.Error, ErrTaskTimeout) {
+			t.Errorf("卡住的任务结果 = %v，期望 ErrTaskTimeout", result.Error)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("超时结果在 %v 后才返回", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("卡住的任务没有按时限返回")
+	}
+
+	select {
+	case result := <-submit(&DetectionTask{ImagePath: missingImage(0)}):
+		if result.Error == nil || errors.Is(result.Error, ErrTaskTimeout) {
+			t.Errorf("下一个任务的结果 = %v，期望正常的加载失败", result.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("任务超时后工作协程没有继续处理下一个任务")
+	}
+
+	// 卡住的阶段最终返回后，被占用的会话销毁并在后台替换
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&manager.sessionPool.sessionsReplaced) == replacedBefore {
+		if time.Now().After(deadline) {
+			t.Fatal("超时任务占用的会话没有被替换")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
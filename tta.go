@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// 测试时增强参数
+var (
+	ttaMerge      = &config.TTAMerge
+	ttaDecodeConf = &config.TTADecodeConf
+	ttaOps        = &config.TTAOps
+)
+
+// 测试时增强各次推理结果的合并方式
+const (
+	ttaMergeNMS = "nms" // 每个目标使用置信度最高的一次结果的坐标
+	ttaMergeWBF = "wbf" // 加权框融合，坐标在各次推理之间按置信度加权平均
+)
+
+// ttaOp 一种测试时增强变换：apply 生成增强后的图像，invert 将增强图像上的检测框变换回原图坐标
+type ttaOp struct {
+	apply  func(img image.Image) image.Image
+	invert func(box boundingBox, width, height int) boundingBox // width/height 为原图尺寸
+}
+
+// ttaOperations -tta-ops 支持的增强变换
+var ttaOperations = map[string]ttaOp{
+	"flipH": {
+		apply:  flipHorizontal,
+		invert: func(box boundingBox, width, _ int) boundingBox { return flipBoundingBox(box, width) },
+	},
+	"flipV": {
+		apply:  flipVertical,
+		invert: flipBoundingBoxVertical,
+	},
+	"rot90": {
+		apply:  func(img image.Image) image.Image { return rotateImage(img, 90) },
+		invert: func(box boundingBox, width, height int) boundingBox { return rotateBoundingBox(box, 90, width, height) },
+	},
+	"rot180": {
+		apply: func(img image.Image) image.Image { return rotateImage(img, 180) },
+		invert: func(box boundingBox, width, height int) boundingBox {
+			return rotateBoundingBox(box, 180, width, height)
+		},
+	},
+	"rot270": {
+		apply: func(img image.Image) image.Image { return rotateImage(img, 270) },
+		invert: func(box boundingBox, width, height int) boundingBox {
+			return rotateBoundingBox(box, 270, width, height)
+		},
+	},
+}
+
+// parseTTAOps 解析 -tta-ops（逗号分隔，按顺序执行，重复的变换只执行一次）
+func parseTTAOps(list string) ([]string, error) {
+	var ops []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || checkStrIsInArray(name, ops) {
+			continue
+		}
+		if _, ok := ttaOperations[name]; !ok {
+			return nil, fmt.Errorf("不支持的测试时增强变换: %s（支持 flipH, flipV, rot90, rot180, rot270）", name)
+		}
+		ops = append(ops, name)
+	}
+	return ops, nil
+}
+
+// validateTTAOptions 检查 -tta-merge 和 -tta-ops 参数
+func validateTTAOptions() error {
+	switch *ttaMerge {
+	case ttaMergeNMS, ttaMergeWBF:
+	default:
+		return fmt.Errorf("不支持的测试时增强合并方式: %s（支持 nms, wbf）", *ttaMerge)
+	}
+	if _, err := parseTTAOps(*ttaOps); err != nil {
+		return err
+	}
+	return nil
+}
+
+// activeTTAOps 返回 -tta-ops 中的变换，参数无效时只做水平翻转（命令行程序在启动时已校验）
+func activeTTAOps() []string {
+	ops, err := parseTTAOps(*ttaOps)
+	if err != nil {
+		return []string{"flipH"}
+	}
+	return ops
+}
+
+// augmentedPasses 依次执行 ops 中的增强推理，返回已变换回原图坐标的各次检测结果
+func augmentedPasses(ctx context.Context, session inferenceSession, img image.Image, cfg DetectionConfig) ([][]boundingBox, error) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	passes := make([][]boundingBox, 0, len(cfg.TTAOps))
+	for _, name := range cfg.TTAOps {
+		op, ok := ttaOperations[name]
+		if !ok {
+			continue
+		}
+		augmented := op.apply(img)
+		boxes, err := inferBoxes(ctx, session, augmented, cfg)
+		// 增强图像来自对象池，预处理完成后即可归还
+		if rgba, ok := augmented.(*image.RGBA); ok && augmented != img {
+			PutImageToPool(rgba)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s 增强推理失败: %w", name, err)
+		}
+		for i := range boxes {
+			boxes[i] = op.invert(boxes[i], width, height)
+		}
+		passes = append(passes, boxes)
+	}
+	return passes, nil
+}
+
+// flipVertical 垂直翻转图像，返回的图像来自对象池，推理后需归还
+func flipVertical(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// 从对象池获取指定尺寸的图像（随后逐像素覆盖，不需要清零）
+	result := getImageUncleared(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			result.Set(x, h-y-1, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return result
+}
+
+// flipBoundingBoxVertical 将垂直翻转图像上的检测框变换回原图坐标
+// 垂直翻转同样是镜像，姿态关键点需要交换左右
+func flipBoundingBoxVertical(box boundingBox, width, height int) boundingBox {
+	h := float32(height)
+	return transformBoundingBox(box, width, height, true, func(x, y float32) (float32, float32) {
+		return x, h - y
+	})
+}
+
+// rotateBoundingBox 将 rotateImage(img, degrees) 得到的图像上的检测框变换回原图坐标
+// width/height 为原图尺寸；rotateImage 的 90 度将原图点 (x, y) 映射到 (y, width-x)，270 度映射到 (height-y, x)
+func rotateBoundingBox(box boundingBox, degrees, width, height int) boundingBox {
+	w, h := float32(width), float32(height)
+	var inverse func(x, y float32) (float32, float32)
+	switch degrees {
+	case 90:
+		inverse = func(x, y float32) (float32, float32) { return w - y, x }
+	case 180:
+		inverse = func(x, y float32) (float32, float32) { return w - x, h - y }
+	case 270:
+		inverse = func(x, y float32) (float32, float32) { return y, h - x }
+	default:
+		return box
+	}
+	return transformBoundingBox(box, width, height, false, inverse)
+}
+
+// transformBoundingBox 按点变换 inverse（增强图像坐标 → 原图坐标）变换检测框、掩码和关键点
+// mirrored 表示该变换是镜像，需要按 COCO 规则交换左右关键点
+func transformBoundingBox(box boundingBox, width, height int, mirrored bool, inverse func(x, y float32) (float32, float32)) boundingBox {
+	ax, ay := inverse(box.x1, box.y1)
+	bx, by := inverse(box.x2, box.y2)
+	box.x1, box.x2 = min32(ax, bx), max32(ax, bx)
+	box.y1, box.y2 = min32(ay, by), max32(ay, by)
+
+	if box.mask != nil {
+		box.mask = transformMask(box.mask, width, height, inverse)
+	}
+	if box.keypoints != nil {
+		keypoints := make([]keypoint, len(box.keypoints))
+		for i, kp := range box.keypoints {
+			j := i
+			if mirrored && len(box.keypoints) == len(cocoKeypointFlipIndex) {
+				j = cocoKeypointFlipIndex[i]
+			}
+			kp.x, kp.y = inverse(kp.x, kp.y)
+			keypoints[j] = kp
+		}
+		box.keypoints = keypoints
+	}
+	return box
+}
+
+// transformMask 按像素中心变换实例掩码（翻转和 90 度倍数旋转下逐像素一一对应）
+func transformMask(mask *image.Alpha, width, height int, inverse func(x, y float32) (float32, float32)) *image.Alpha {
+	bounds := mask.Bounds()
+	ax, ay := inverse(float32(bounds.Min.X), float32(bounds.Min.Y))
+	bx, by := inverse(float32(bounds.Max.X), float32(bounds.Max.Y))
+	rect := image.Rect(int(min32(ax, bx)), int(min32(ay, by)), int(max32(ax, bx)), int(max32(ay, by)))
+	result := image.NewAlpha(rect.Intersect(image.Rect(0, 0, width, height)))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ox, oy := inverse(float32(x)+0.5, float32(y)+0.5)
+			result.SetAlpha(int(ox), int(oy), mask.AlphaAt(x, y))
+		}
+	}
+	return result
+}
+
+// ttaDecodeThreshold 返回测试时增强每次推理的解码阈值
+// 每次推理都按 -conf 过滤会丢掉两次分别为 0.22、0.24 的目标，
+// 所以先用较低的阈值（默认 -conf 的一半）解码，按 ttaVoteConfidence 合并各次推理的置信度之后再按 -conf 过滤
+func ttaDecodeThreshold(conf float32, augment bool) float32 {
+	if !augment {
+		return conf
+	}
+	if *ttaDecodeConf > 0 {
+		return min32(float32(*ttaDecodeConf), conf)
+	}
+	return conf / 2
+}
+
+// ttaVoteConfidence 合并同一目标在各次推理中的置信度（每次推理取最高的一个）：1 - Π(1 - pᵢ)
+// 结果不低于其中任何一次的置信度，较低置信度的推理结果不会拉低已经超过 -conf 的目标；
+// 多次推理都检测到的目标置信度提高，如 0.22、0.24 合并为 0.41，只在一次推理中以低置信度出现的框仍低于 -conf
+func ttaVoteConfidence(passConfs []float32) float32 {
+	miss := float32(1)
+	for _, p := range passConfs {
+		miss *= 1 - p
+	}
+	return 1 - miss
+}
+
+// mergeTTABoxes 合并测试时增强各次推理（已变换回原图坐标）的检测结果，再按 -conf 过滤合并后的置信度
+// 同类别且 IOU 超过阈值的框归为同一目标；坐标按 -tta-merge 取置信度最高的框（nms）或按置信度加权平均（wbf），
+// 置信度由 ttaVoteConfidence 按各次推理合并
+func mergeTTABoxes(passes [][]boundingBox, cfg DetectionConfig) []boundingBox {
+	type ttaBox struct {
+		boundingBox
+		pass int
+	}
+	var boxes []ttaBox
+	for i, pass := range passes {
+		for _, box := range pass {
+			boxes = append(boxes, ttaBox{box, i})
+		}
+	}
+	sort.SliceStable(boxes, func(i, j int) bool {
+		return boxes[i].confidence > boxes[j].confidence
+	})
+
+	// 按置信度从高到低，与各簇置信度最高的框比较 IOU
+	type cluster struct {
+		members   []boundingBox
+		passConfs map[int]float32 // 每次推理中该目标的最高置信度
+	}
+	var clusters []*cluster
+	for _, box := range boxes {
+		var target *cluster
+		for _, c := range clusters {
+			if c.members[0].label == box.label && c.members[0].iou(&box.boundingBox) > cfg.IOUThreshold {
+				target = c
+				break
+			}
+		}
+		if target == nil {
+			target = &cluster{passConfs: make(map[int]float32)}
+			clusters = append(clusters, target)
+		}
+		target.members = append(target.members, box.boundingBox)
+		if box.confidence > target.passConfs[box.pass] {
+			target.passConfs[box.pass] = box.confidence
+		}
+	}
+
+	kept := make([]boundingBox, 0, len(clusters))
+	for _, c := range clusters {
+		merged := c.members[0]
+		if cfg.TTAMerge == ttaMergeWBF {
+			merged = fuseCluster(c.members, 1)
+		}
+		passConfs := make([]float32, 0, len(c.passConfs))
+		for _, conf := range c.passConfs {
+			passConfs = append(passConfs, conf)
+		}
+		sort.Slice(passConfs, func(i, j int) bool { return passConfs[i] > passConfs[j] }) // 固定相乘顺序，结果不随 map 遍历顺序变化
+		merged.confidence = ttaVoteConfidence(passConfs)
+		if merged.confidence >= cfg.ConfThreshold {
+			kept = append(kept, merged)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].confidence > kept[j].confidence
+	})
+	return kept
+}
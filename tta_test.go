@@ -0,0 +1,224 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeTTABoxesVoteConfidence(t *testing.T) {
+	box := func(conf, offset float32) boundingBox {
+		return boundingBox{label: "person", confidence: conf, x1: 100 + offset, y1: 100 + offset, x2: 200 + offset, y2: 300 + offset}
+	}
+	tests := []struct {
+		name   string
+		passes [][]boundingBox
+		kept   bool
+		min    float32 // 合并后的置信度下限
+	}{
+		// 请求中的例子：两次推理分别为 0.22、0.24，都低于 -conf 0.25，合并后超过
+		{"两次都略低于阈值", [][]boundingBox{{box(0.22, 0)}, {box(0.24, 2)}}, true, 0.40},
+		// 已超过阈值的目标不会被另一次推理的低置信度结果拉低
+		{"高置信度与低置信度合并", [][]boundingBox{{box(0.30, 0)}, {box(0.14, 2)}}, true, 0.30},
+		// 只在一次推理中以低置信度出现的框不应通过
+		{"单次低置信度", [][]boundingBox{{box(0.14, 0)}, nil}, false, 0},
+		{"两次都远低于阈值", [][]boundingBox{{box(0.13, 0)}, {box(0.12, 2)}}, false, 0},
+	}
+	for _, merge := range []string{ttaMergeNMS, ttaMergeWBF} {
+		for _, tt := range tests {
+			t.Run(merge+"/"+tt.name, func(t *testing.T) {
+				cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45, TTAMerge: merge}
+				merged := mergeTTABoxes(tt.passes, cfg)
+				if !tt.kept {
+					if len(merged) != 0 {
+						t.Errorf("合并结果 %+v，期望被 -conf 过滤", merged)
+					}
+					return
+				}
+				if len(merged) != 1 {
+					t.Fatalf("合并结果 %d 个框，期望 1 个", len(merged))
+				}
+				if merged[0].confidence < tt.min {
+					t.Errorf("合并后的置信度 %v 低于 %v", merged[0].confidence, tt.min)
+				}
+			})
+		}
+	}
+}
+
+func TestMergeTTABoxesCountsEachPassOnce(t *testing.T) {
+	// 同一次推理中重叠的两个框不能互相提高置信度
+	pass := []boundingBox{
+		{label: "car", confidence: 0.2, x1: 0, y1: 0, x2: 100, y2: 100},
+		{label: "car", confidence: 0.2, x1: 1, y1: 1, x2: 101, y2: 101},
+	}
+	cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45, TTAMerge: ttaMergeNMS}
+	if merged := mergeTTABoxes([][]boundingBox{pass}, cfg); len(merged) != 0 {
+		t.Errorf("合并结果 %+v，同一次推理的重复框不应提高置信度", merged)
+	}
+}
+
+func TestTTAVoteConfidenceNeverBelowMax(t *testing.T) {
+	for _, confs := range [][]float32{{0.9}, {0.9, 0.1}, {0.3, 0.14, 0.2}, {0.5, 0.5, 0.5, 0.5}} {
+		got := ttaVoteConfidence(confs)
+		for _, c := range confs {
+			if got < c {
+				t.Errorf("ttaVoteConfidence(%v) = %v，低于其中的 %v", confs, got, c)
+			}
+		}
+		if got > 1 {
+			t.Errorf("ttaVoteConfidence(%v) = %v，超过 1", confs, got)
+		}
+	}
+}
+
+func TestMergeTTABoxesCoordinates(t *testing.T) {
+	// 原图与翻转后的推理结果略有偏移
+	original := boundingBox{label: "car", confidence: 0.6, x1: 100, y1: 50, x2: 200, y2: 150}
+	flipped := boundingBox{label: "car", confidence: 0.3, x1: 106, y1: 56, x2: 206, y2: 156}
+	tests := []struct {
+		merge string
+		x1    float32 // 合并后的左上角（x1 与 y1 偏移相同）
+		y1    float32
+	}{
+		{ttaMergeNMS, 100, 50},
+		// 按置信度加权：(100*0.6 + 106*0.3) / 0.9
+		{ttaMergeWBF, 102, 52},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merge, func(t *testing.T) {
+			cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45, TTAMerge: tt.merge}
+			merged := mergeTTABoxes([][]boundingBox{{original}, {flipped}}, cfg)
+			if len(merged) != 1 {
+				t.Fatalf("合并结果 %d 个框，期望 1 个", len(merged))
+			}
+			got := merged[0]
+			if !approxEqual(got.x1, tt.x1) || !approxEqual(got.y1, tt.y1) || !approxEqual(got.x2, tt.x1+100) || !approxEqual(got.y2, tt.y1+100) {
+				t.Errorf("合并框 = (%v, %v, %v, %v)，期望左上角 (%v, %v)", got.x1, got.y1, got.x2, got.y2, tt.x1, tt.y1)
+			}
+			// 两种方式的置信度都按各次推理合并：1 - 0.4*0.7
+			if !approxEqual(got.confidence, 0.72) {
+				t.Errorf("合并置信度 = %v，期望 0.72", got.confidence)
+			}
+		})
+	}
+}
+
+func TestMergeTTABoxesKeepsDistinctObjects(t *testing.T) {
+	passes := [][]boundingBox{
+		{{label: "car", confidence: 0.8, x1: 0, y1: 0, x2: 100, y2: 100}, {label: "car", confidence: 0.7, x1: 300, y1: 0, x2: 400, y2: 100}},
+		{{label: "car", confidence: 0.8, x1: 2, y1: 2, x2: 102, y2: 102}, {label: "person", confidence: 0.7, x1: 0, y1: 0, x2: 100, y2: 100}},
+	}
+	cfg := DetectionConfig{ConfThreshold: 0.25, IOUThreshold: 0.45, TTAMerge: ttaMergeWBF}
+	merged := mergeTTABoxes(passes, cfg)
+	if len(merged) != 3 {
+		t.Fatalf("合并结果 %+v，期望 3 个框（不重叠或不同类别的框不融合）", merged)
+	}
+	for i := 1; i < len(merged); i++ {
+		if merged[i].confidence > merged[i-1].confidence {
+			t.Errorf("合并结果未按置信度降序排列: %+v", merged)
+		}
+	}
+}
+
+// coloredBounds 返回图像中非黑色像素的外接矩形，模拟在增强图像上检测到的框
+func coloredBounds(img image.Image) boundingBox {
+	bounds := img.Bounds()
+	box := boundingBox{x1: float32(bounds.Max.X), y1: float32(bounds.Max.Y)}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r == 0 {
+				continue
+			}
+			box.x1, box.y1 = min32(box.x1, float32(x)), min32(box.y1, float32(y))
+			box.x2, box.y2 = max32(box.x2, float32(x+1)), max32(box.y2, float32(y+1))
+		}
+	}
+	return box
+}
+
+func TestTTAOpsInvertToOriginalLocation(t *testing.T) {
+	// 非正方形的原图，目标不在中心，旋转方向错误时坐标会明显不同
+	const width, height = 64, 48
+	want := boundingBox{label: "car", confidence: 0.9, x1: 5, y1: 10, x2: 25, y2: 18}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, image.Rect(5, 10, 25, 18), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+
+	for _, name := range []string{"flipH", "flipV", "rot90", "rot180", "rot270"} {
+		t.Run(name, func(t *testing.T) {
+			op := ttaOperations[name]
+			augmented := op.apply(img)
+			if rgba, ok := augmented.(*image.RGBA); ok {
+				defer PutImageToPool(rgba)
+			}
+			size := augmented.Bounds().Size()
+			rotated := strings.HasPrefix(name, "rot") && name != "rot180"
+			if rotated && (size.X != height || size.Y != width) || !rotated && (size.X != width || size.Y != height) {
+				t.Fatalf("增强图像尺寸 %v", size)
+			}
+
+			detected := coloredBounds(augmented)
+			detected.label, detected.confidence = want.label, want.confidence
+			got := op.invert(detected, width, height)
+			if got.x1 != want.x1 || got.y1 != want.y1 || got.x2 != want.x2 || got.y2 != want.y2 {
+				t.Errorf("增强图像上的框 (%v, %v, %v, %v) 变换回原图为 (%v, %v, %v, %v)，期望 (%v, %v, %v, %v)",
+					detected.x1, detected.y1, detected.x2, detected.y2, got.x1, got.y1, got.x2, got.y2, want.x1, want.y1, want.x2, want.y2)
+			}
+			if got.label != want.label || got.confidence != want.confidence {
+				t.Errorf("变换后标签或置信度改变: %+v", got)
+			}
+		})
+	}
+}
+
+func TestTTAOpsInvertMask(t *testing.T) {
+	const width, height = 8, 6
+	for _, name := range []string{"flipH", "flipV", "rot90", "rot180", "rot270"} {
+		t.Run(name, func(t *testing.T) {
+			// 原图上一个像素的目标，在增强图像上找到对应像素作为掩码
+			img := image.NewRGBA(image.Rect(0, 0, width, height))
+			img.Set(1, 2, color.RGBA{R: 255, A: 255})
+			op := ttaOperations[name]
+			augmented := op.apply(img)
+			if rgba, ok := augmented.(*image.RGBA); ok {
+				defer PutImageToPool(rgba)
+			}
+			detected := coloredBounds(augmented)
+			mask := image.NewAlpha(augmented.Bounds())
+			mask.SetAlpha(int(detected.x1), int(detected.y1), color.Alpha{A: 255})
+			detected.mask = mask
+
+			got := op.invert(detected, width, height).mask
+			if got == nil || got.AlphaAt(1, 2).A != 255 {
+				t.Fatalf("掩码未变换回原图的 (1, 2)")
+			}
+			if !got.Bounds().In(image.Rect(0, 0, width, height)) {
+				t.Errorf("掩码范围 %v 超出原图", got.Bounds())
+			}
+		})
+	}
+}
+
+func TestParseTTAOps(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"flipH", []string{"flipH"}, false},
+		{"flipH, flipV,rot90", []string{"flipH", "flipV", "rot90"}, false},
+		{"rot90,flipH,rot90", []string{"rot90", "flipH"}, false},
+		{"", nil, false},
+		{"flipH,rot45", nil, true},
+		{"fliph", nil, true}, // 区分大小写
+	}
+	for _, tt := range tests {
+		got, err := parseTTAOps(tt.list)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("parseTTAOps(%q) = %v, %v，期望 %v", tt.list, got, err, tt.want)
+		}
+	}
+}
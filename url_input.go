@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// URL 输入参数
+var (
+	downloadTimeout = &config.DownloadTimeout
+	downloadMaxMB   = &config.DownloadMaxMB
+	downloadDir     = &config.DownloadDir
+)
+
+// errDownloadTooLarge 下载的图像超过 -download-max-mb
+var errDownloadTooLarge = errors.New("超过 -download-max-mb 大小限制")
+
+// download 一个 URL 的下载结果，同一 URL 只下载一次（检测和绘制都会加载原图）
+type download struct {
+	once sync.Once
+	path string // 本地文件路径
+	err  error
+}
+
+var (
+	downloads     = make(map[string]*download)
+	downloadMutex sync.Mutex
+
+	// 未指定 -download-dir 时下载到的临时目录，程序退出前清理
+	downloadTempDir string
+)
+
+// isURLInput 判断输入是否为 http(s) URL
+func isURLInput(input string) bool {
+	lower := strings.ToLower(input)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// isRemoteInput 判断输入是否需要先下载：http(s) URL 或 s3:// 路径
+func isRemoteInput(input string) bool {
+	return isURLInput(input) || isS3Path(input)
+}
+
+// urlBaseName 返回 URL 路径的最后一段（不含查询参数），没有时返回 "image"
+func urlBaseName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			return base
+		}
+	}
+	return "image"
+}
+
+// downloadImage 下载 URL 或 s3:// 路径指向的图像，返回本地文件路径；同一 URL 在进程内只下载一次
+// 下载到 -download-dir（保留），未指定时下载到临时目录（退出前清理）
+func downloadImage(rawURL string) (string, error) {
+	downloadMutex.Lock()
+	d, ok := downloads[rawURL]
+	if !ok {
+		d = &download{}
+		downloads[rawURL] = d
+	}
+	downloadMutex.Unlock()
+
+	d.once.Do(func() {
+		if isS3Path(rawURL) {
+			d.path, d.err = fetchS3(rawURL)
+		} else {
+			d.path, d.err = fetchURL(rawURL)
+		}
+	})
+	return d.path, d.err
+}
+
+// fetchURL 按 -download-timeout 和 -download-max-mb 下载 URL 并写入本地文件
+func fetchURL(rawURL string) (string, error) {
+	localPath, err := downloadPath(rawURL)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: *downloadTimeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("下载 %s 失败: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载 %s 失败: HTTP %s", rawURL, resp.Status)
+	}
+	limit := int64(*downloadMaxMB) << 20
+	if limit > 0 && resp.ContentLength > limit {
+		return "", fmt.Errorf("下载 %s 失败: %w（%d 字节）", rawURL, errDownloadTooLarge, resp.ContentLength)
+	}
+
+	err = writeFileAtomic(localPath, func(f *os.File) error {
+		body := io.Reader(resp.Body)
+		if limit > 0 {
+			body = io.LimitReader(resp.Body, limit+1)
+		}
+		n, err := io.Copy(f, body)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && n > limit {
+			return errDownloadTooLarge
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("下载 %s 失败: %w", rawURL, err)
+	}
+	return localPath, nil
+}
+
+// downloadPath 返回 URL 下载到的本地文件路径
+// 文件名带上 URL 的哈希，不同 URL 的同名文件不会互相覆盖
+func downloadPath(rawURL string) (string, error) {
+	dir, err := downloadTarget()
+	if err != nil {
+		return "", err
+	}
+	name := sanitizeFileName(outputNameHash(rawURL)+"_"+urlBaseName(rawURL), *nameReplacement)
+	return filepath.Join(dir, truncateUTF8(name, maxFileNameBytes)), nil
+}
+
+// downloadTarget 返回下载目录：-download-dir，未指定时为进程内共用的临时目录
+func downloadTarget() (string, error) {
+	if *downloadDir != "" {
+		if err := os.MkdirAll(*downloadDir, 0755); err != nil {
+			return "", fmt.Errorf("创建下载目录失败: %w", err)
+		}
+		return *downloadDir, nil
+	}
+	downloadMutex.Lock()
+	defer downloadMutex.Unlock()
+	if downloadTempDir == "" {
+		dir, err := os.MkdirTemp("", "yolo-download-")
+		if err != nil {
+			return "", fmt.Errorf("创建下载临时目录失败: %w", err)
+		}
+		downloadTempDir = dir
+	}
+	return downloadTempDir, nil
+}
+
+// cleanupDownloads 删除下载到临时目录的图像（-download-dir 中的文件保留）
+func cleanupDownloads() {
+	downloadMutex.Lock()
+	defer downloadMutex.Unlock()
+	if downloadTempDir != "" {
+		os.RemoveAll(downloadTempDir)
+		downloadTempDir = ""
+	}
+	downloads = make(map[string]*download)
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 视频输入参数
+var (
+	vidStride  = &config.VidStride
+	videoStart = &config.VideoStart
+	videoEnd   = &config.VideoEnd
+)
+
+// ErrNoFFmpeg 处理视频文件需要的 ffmpeg/ffprobe 不在 PATH 中
+var ErrNoFFmpeg = errors.New("未找到 ffmpeg 或 ffprobe，处理视频文件需要安装 ffmpeg 并加入 PATH")
+
+const videoStderrLimit = 4096 // 保留的 ffmpeg 错误输出长度上限（字节），失败时附在错误信息中
+
+// splitVideoPaths 将输入路径分为图像和视频文件（按扩展名），各自保持原有顺序
+func splitVideoPaths(paths []string) (imagePaths, videoPaths []string) {
+	for _, path := range paths {
+		if isVideoPath(path) {
+			videoPaths = append(videoPaths, path)
+		} else {
+			imagePaths = append(imagePaths, path)
+		}
+	}
+	return imagePaths, videoPaths
+}
+
+// isVideoPath 判断路径是否为支持的视频文件
+func isVideoPath(path string) bool {
+	return supportedVideoExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// videoInfo ffprobe 读取的视频流信息
+type videoInfo struct {
+	width  int
+	height int
+	fps    float64 // 平均帧率，无法读取时为 0（帧时间未知）
+}
+
+// checkFFmpeg 确认 ffmpeg 和 ffprobe 可用
+func checkFFmpeg() error {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return ErrNoFFmpeg
+		}
+	}
+	return nil
+}
+
+// probeVideo 用 ffprobe 读取第一个视频流的尺寸和帧率，inputArgs 为放在输入之前的参数（如 -rtsp_transport tcp）
+func probeVideo(ctx context.Context, path string, inputArgs ...string) (videoInfo, error) {
+	args := append([]string{"-v", "error"}, inputArgs...)
+	args = append(args, "-select_streams", "v:0",
+		"-show_entries", "stream=width,height,avg_frame_rate,r_frame_rate", "-of", "json", path)
+	cmd := exec.CommandContext(ctx, "ffprobe", args...)
+	cmd.Env = childProcessEnv()
+	stderr := &tailBuffer{limit: videoStderrLimit}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return videoInfo{}, ffmpegError("ffprobe", err, stderr)
+	}
+	var probe struct {
+		Streams []struct {
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+			RFrameRate   string `json:"r_frame_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return videoInfo{}, fmt.Errorf("解析 ffprobe 输出失败: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return videoInfo{}, fmt.Errorf("文件中没有视频流")
+	}
+	stream := probe.Streams[0]
+	if stream.Width <= 0 || stream.Height <= 0 {
+		return videoInfo{}, fmt.Errorf("无法读取视频尺寸")
+	}
+	info := videoInfo{width: stream.Width, height: stream.Height, fps: parseFrameRate(stream.AvgFrameRate)}
+	if info.fps == 0 {
+		info.fps = parseFrameRate(stream.RFrameRate)
+	}
+	return info, nil
+}
+
+// parseFrameRate 解析 ffprobe 的帧率（如 30000/1001），无效时返回 0
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return n / d
+}
+
+// videoFrame 解码出的一帧
+type videoFrame struct {
+	index     int           // 在整个视频中的帧序号，从 0 开始
+	timestamp time.Duration // 在视频中的时间（帧序号 / 帧率）
+	timed     bool          // timestamp 有效（帧率已知）
+	image     *image.RGBA   // 从图像池获取，检测完成后由调用方放回
+}
+
+// videoFrameReader 从 ffmpeg 输出的 rgb24 原始帧中逐帧读取，按 stride 跳过不检测的帧
+// 同一时刻只有一帧的读取缓冲，内存占用与视频长度无关
+type videoFrameReader struct {
+	info   videoInfo
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr *tailBuffer
+	buf    []byte
+	stride int
+	first  int           // 起始时间对应的帧序号
+	start  time.Duration // 起始时间
+	next   int           // 下一帧相对起始帧的序号
+	done   bool          // 已读到结尾
+	closed bool
+	// 等待一帧的最长时间，超过时终止 ffmpeg（按读到结尾处理），0 表示不限制；用于检测卡住的视频流
+	readTimeout time.Duration
+}
+
+// openVideo 探测视频信息并启动 ffmpeg 解码 [start, end) 区间（end 为 0 时到结尾）
+// 关闭自动旋转，解码出的帧尺寸与 ffprobe 报告的一致
+func openVideo(ctx context.Context, path string, start, end time.Duration, stride int) (*videoFrameReader, error) {
+	info, err := probeVideo(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var inputArgs, outputArgs []string
+	if start > 0 {
+		inputArgs = append(inputArgs, "-ss", formatSeconds(start))
+	}
+	if end > 0 {
+		outputArgs = append(outputArgs, "-t", formatSeconds(end-start))
+	}
+	r, err := startFrameReader(ctx, path, info, inputArgs, outputArgs)
+	if err != nil {
+		return nil, err
+	}
+	r.stride = max(1, stride)
+	r.start = start
+	if info.fps > 0 {
+		r.first = int(math.Round(start.Seconds() * info.fps))
+	}
+	return r, nil
+}
+
+// startFrameReader 启动 ffmpeg 将 path 的第一个视频流解码为 rgb24 原始帧，
+// inputArgs、outputArgs 分别放在输入之前和之后（输出格式之前）
+func startFrameReader(ctx context.Context, path string, info videoInfo, inputArgs, outputArgs []string) (*videoFrameReader, error) {
+	args := append([]string{"-nostdin", "-v", "error", "-noautorotate"}, inputArgs...)
+	args = append(args, "-i", path)
+	args = append(args, outputArgs...)
+	args = append(args, "-map", "0:v:0", "-f", "rawvideo", "-pix_fmt", "rgb24", "-")
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Env = childProcessEnv()
+	cmd.WaitDelay = time.Second // 终止后不等待仍持有输出管道的子进程
+	stderr := &tailBuffer{limit: videoStderrLimit}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动 ffmpeg 失败: %w", err)
+	}
+	return &videoFrameReader{
+		info:   info,
+		cmd:    cmd,
+		stdout: stdout,
+		stderr: stderr,
+		buf:    make([]byte, info.width*info.height*3),
+		stride: 1,
+	}, nil
+}
+
+// formatSeconds 以秒为单位格式化时长，作为 ffmpeg 的时间参数
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// Next 返回下一个需要检测的帧，视频结束时返回 io.EOF
+func (r *videoFrameReader) Next() (videoFrame, error) {
+	for {
+		if err := r.readFrame(); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				r.done = true
+				return videoFrame{}, io.EOF
+			}
+			return videoFrame{}, fmt.Errorf("读取 ffmpeg 输出失败: %w", err)
+		}
+		offset := r.next
+		r.next++
+		if offset%r.stride != 0 {
+			continue
+		}
+		frame := videoFrame{index: r.first + offset, image: rgb24ToRGBA(r.buf, r.info.width, r.info.height)}
+		if r.info.fps > 0 {
+			frame.timestamp = r.start + time.Duration(float64(offset)/r.info.fps*float64(time.Second))
+			frame.timed = true
+		}
+		return frame, nil
+	}
+}
+
+// readFrame 读取一帧原始像素到 buf，超过 readTimeout 没有读完时终止 ffmpeg
+func (r *videoFrameReader) readFrame() error {
+	if r.readTimeout <= 0 {
+		_, err := io.ReadFull(r.stdout, r.buf)
+		return err
+	}
+	var expired atomic.Bool
+	timer := time.AfterFunc(r.readTimeout, func() {
+		expired.Store(true)
+		r.cmd.Process.Kill()
+		r.stdout.Close() // ffmpeg 的子进程仍持有管道时也能结束读取
+	})
+	_, err := io.ReadFull(r.stdout, r.buf)
+	if !timer.Stop() && expired.Load() {
+		return fmt.Errorf("超过 %v 没有收到新帧", r.readTimeout)
+	}
+	return err
+}
+
+// rgb24ToRGBA 将 rgb24 原始像素转换为图像池中的 RGBA 图像
+func rgb24ToRGBA(pix []byte, width, height int) *image.RGBA {
+	img := getImageUncleared(width, height)
+	for y := 0; y < height; y++ {
+		src := pix[y*width*3 : (y+1)*width*3]
+		dst := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		for x := 0; x < width; x++ {
+			dst[x*4] = src[x*3]
+			dst[x*4+1] = src[x*3+1]
+			dst[x*4+2] = src[x*3+2]
+			dst[x*4+3] = 0xff
+		}
+	}
+	return img
+}
+
+// Close 结束 ffmpeg 进程；未读到结尾时直接终止，读到结尾时返回 ffmpeg 的解码错误
+func (r *videoFrameReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if !r.done {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+		return nil
+	}
+	if err := r.cmd.Wait(); err != nil {
+		return ffmpegError("ffmpeg", err, r.stderr)
+	}
+	return nil
+}
+
+// ffmpegError 附上 ffmpeg/ffprobe 的错误输出
+func ffmpegError(name string, err error, stderr *tailBuffer) error {
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		return fmt.Errorf("%s 执行失败: %w: %s", name, err, out)
+	}
+	return fmt.Errorf("%s 执行失败: %w", name, err)
+}
+
+// tailBuffer 只保留最后 limit 字节的输出
+type tailBuffer struct {
+	mutex sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return string(b.data)
+}
+
+// validateVideoOptions 校验 -vid-stride、-video-start、-video-end
+func validateVideoOptions() error {
+	if *vidStride < 1 {
+		return fmt.Errorf("-vid-stride 必须大于等于 1")
+	}
+	if *videoStart < 0 || *videoEnd < 0 {
+		return fmt.Errorf("-video-start 和 -video-end 不能为负数")
+	}
+	if *videoEnd > 0 && *videoEnd <= *videoStart {
+		return fmt.Errorf("-video-end 必须晚于 -video-start")
+	}
+	return nil
+}
+
+// frameWindow 视频流式处理时最多同时未回调的帧数
+// 视频帧在内存中是解码后的整幅图像，不按 streamWindow 填满任务队列，只保证每个工作协程各有一组在处理、一组在排队
+func (manager *VideoDetectorManager) frameWindow() int {
+	return 2 * manager.workerCount * max(1, manager.collectSize)
+}
+
+// ProcessVideoFiles 逐个解码视频文件并检测，每帧的结果写入结果输出（-sink、-result-format jsonl 等），
+// 帧序号和帧时间记录在结果的 Metadata（frame_index、frame_time）中；-save-video 时标注视频保存到 outputDir
+func ProcessVideoFiles(videoPaths []string, outputDir string) error {
+	if err := validateVideoOptions(); err != nil {
+		return err
+	}
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	fmt.Printf("找到 %d 个视频文件，工作协程数量: %d\n", len(videoPaths), *workerCount)
+
+	manager := NewVideoDetectorManager(*workerCount, *queueSize, *taskTimeout)
+	defer manager.Stop()
+	ctx, release := interruptibleContext()
+	defer release()
+
+	var outputPaths []string
+	if *saveVideo {
+		outputPaths = annotatedVideoPaths(outputDir, videoPaths)
+	}
+	failures := 0
+	for i, path := range videoPaths {
+		outputPath := ""
+		if outputPaths != nil {
+			outputPath = outputPaths[i]
+		}
+		if err := processVideo(ctx, manager, path, outputPath); err != nil {
+			failures++
+			fmt.Printf("处理视频 %s 时出错: %v\n", path, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	printManagerStats(manager)
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("视频处理已取消")
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d 个视频处理失败", failures)
+	}
+	return nil
+}
+
+// processVideo 解码一个视频文件，按帧顺序提交检测并回调结果；outputPath 不为空时写出标注视频
+func processVideo(ctx context.Context, manager *VideoDetectorManager, path, outputPath string) (err error) {
+	reader, err := openVideo(ctx, path, *videoStart, *videoEnd, *vidStride)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	fmt.Printf("视频 %s: %dx%d，%.2f fps，每 %d 帧检测一帧\n", path, reader.info.width, reader.info.height, reader.info.fps, reader.stride)
+
+	var writer *videoWriter
+	if outputPath != "" {
+		writer, err = newVideoWriter(outputPath, path, reader.info, reader.stride, *videoStart, *videoEnd)
+		if err != nil {
+			return fmt.Errorf("创建标注视频失败: %w", err)
+		}
+		defer func() {
+			if closeErr := writer.Close(); closeErr != nil {
+				err = errors.Join(err, fmt.Errorf("保存标注视频失败: %w", closeErr))
+			} else {
+				fmt.Printf("标注视频已保存至 %s（%d 帧）\n", outputPath, writer.frames)
+			}
+		}()
+	}
+
+	progress := newCLIProgress()
+	start := time.Now()
+	stats, readErr := detectFrames(ctx, manager, path, reader, writer, progress, nil)
+	wall := time.Since(start)
+	progress.Finish()
+
+	fmt.Printf("视频 %s 处理完成: %s，共检测到 %d 个对象\n", path, stats.summary(wall), stats.objects)
+	if ctx.Err() != nil {
+		fmt.Printf("已中断，%d 帧未处理\n", stats.canceled)
+		return nil
+	}
+	if readErr != nil {
+		return readErr
+	}
+	return reader.Close()
+}
+
+// frameSource 逐帧读取的视频来源（视频文件、视频流），读完时返回 io.EOF
+type frameSource interface {
+	Next() (videoFrame, error)
+}
+
+// frameStats 逐帧检测的统计
+type frameStats struct {
+	batchTotals
+	objects  int // 检测到的对象总数
+	canceled int // 中断时未处理的帧数
+}
+
+// detectFrames 从 source 逐帧读取，按帧顺序提交检测并回调，直到读完或 ctx 取消，返回统计和读取错误（读完不算错误）
+// 每帧的结果写入结果输出并触发检测钩子，帧序号和帧时间记录在 Metadata 中；writer 不为 nil 时同时写入标注视频，
+// observe 不为 nil 时按帧顺序对每个结果调用一次（中断时未处理的帧除外）
+func detectFrames(ctx context.Context, manager *VideoDetectorManager, path string, source frameSource, writer *videoWriter, progress *cliProgress, observe func(DetectionResult)) (frameStats, error) {
+	// 已提交、尚未回调的帧，按提交序号（即回调的 i）保存，检测成功后放回图像池
+	var framesMutex sync.Mutex
+	frames := make(map[int]*image.RGBA)
+	submitted := 0
+	var readErr error
+	next := func() (*DetectionTask, bool) {
+		frame, err := source.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				readErr = err
+			}
+			return nil, false
+		}
+		framesMutex.Lock()
+		frames[submitted] = frame.image
+		framesMutex.Unlock()
+		submitted++
+		metadata := map[string]interface{}{"frame_index": frame.index}
+		if frame.timed {
+			metadata["frame_time"] = frame.timestamp.Seconds()
+		}
+		return &DetectionTask{ImagePath: path, Image: frame.image, Metadata: metadata}, true
+	}
+
+	var stats frameStats
+	written := 0
+	manager.processTaskStream(ctx, manager.frameWindow(), next, progress.Func(), func(i int, result DetectionResult) {
+		framesMutex.Lock()
+		frame := frames[i]
+		delete(frames, i)
+		framesMutex.Unlock()
+		if errors.Is(result.Error, context.Canceled) {
+			stats.canceled++
+			return
+		}
+		resultSinks.WriteResult(result)
+		emitJSONL(result, "", nil, 0)
+		outcome.record(result, nil)
+		stats.add(result)
+		if observe != nil {
+			observe(result)
+		}
+		if result.Error != nil {
+			stats.failures++
+			progress.Printf("处理 %s 第 %v 帧时出错: %v\n", path, result.Metadata["frame_index"], result.Error)
+		} else {
+			stats.objects += len(result.Objects)
+			runDetectHook(result, "")
+		}
+
+		// 回调按帧顺序进行，写入标注视频的序号连续；超时的帧可能仍在被工作协程使用，不放回图像池
+		switch {
+		case writer != nil:
+			writer.Write(written, frame, result)
+			written++
+		case result.Error == nil:
+			PutImageToPool(frame)
+		}
+	})
+	return stats, readErr
+}
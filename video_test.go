@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrames 读取 r 的所有帧直到 io.EOF，返回帧序号、时间戳和每帧左上角的像素
+func readFrames(t *testing.T, r *videoFrameReader) (indexes []int, timestamps []time.Duration, pixels [][3]byte) {
+	t.Helper()
+	for {
+		frame, err := r.Next()
+		if err == io.EOF {
+			return indexes, timestamps, pixels
+		}
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if !frame.timed {
+			t.Errorf("第 %d 帧没有时间戳", frame.index)
+		}
+		if b := frame.image.Bounds(); b.Dx() != fakeVideoWidth || b.Dy() != fakeVideoHeight {
+			t.Errorf("第 %d 帧尺寸 = %v，期望 %dx%d", frame.index, b, fakeVideoWidth, fakeVideoHeight)
+		}
+		if frame.image.Pix[3] != 255 {
+			t.Errorf("第 %d 帧不透明度 = %d，期望 255", frame.index, frame.image.Pix[3])
+		}
+		indexes = append(indexes, frame.index)
+		timestamps = append(timestamps, frame.timestamp)
+		pixels = append(pixels, [3]byte(frame.image.Pix[:3]))
+		PutImageToPool(frame.image)
+	}
+}
+
+// fakeFFmpegArgs 让假 ffmpeg 记录参数，返回读取参数的函数
+func fakeFFmpegArgs(t *testing.T) func() []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "args")
+	t.Setenv("FAKE_FFMPEG_ARGS", path)
+	return func() []string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("假 ffmpeg 没有记录参数: %v", err)
+		}
+		return strings.Split(string(data), "\n")
+	}
+}
+
+func TestOpenVideoFrameStepAndRange(t *testing.T) {
+	useFakeFFmpeg(t)
+
+	// 假 ffmpeg 不处理 -ss/-t，输出的 fakeVideoFrames 帧代表截取后的片段
+	tests := []struct {
+		name       string
+		start, end time.Duration
+		stride     int
+		wantArgs   []string // 期望的 ffmpeg 参数，-ss 在 -i 之前（输入定位），-t 在之后
+		wantFirst  int      // 第一帧在整段视频中的序号
+		wantOffset []int    // 返回的帧在片段中的位置
+	}{
+		{"全部帧", 0, 0, 1, []string{"-i", "clip.mp4", "-map"}, 0, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"每 2 帧取 1 帧", 0, 0, 2, []string{"-i", "clip.mp4", "-map"}, 0, []int{0, 2, 4, 6}},
+		{"每 3 帧取 1 帧", 0, 0, 3, []string{"-i", "clip.mp4", "-map"}, 0, []int{0, 3, 6}},
+		{"stride 为 0 时不跳帧", 0, 0, 0, []string{"-i", "clip.mp4", "-map"}, 0, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"从第 1 秒开始", time.Second, 0, 1, []string{"-ss", "1", "-i", "clip.mp4", "-map"}, 30, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"只截止到 0.5 秒", 0, 500 * time.Millisecond, 1, []string{"-i", "clip.mp4", "-t", "0.5", "-map"}, 0, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"1.5 秒到 2 秒每 3 帧取 1 帧", 1500 * time.Millisecond, 2 * time.Second, 3, []string{"-ss", "1.5", "-i", "clip.mp4", "-t", "0.5", "-map"}, 45, []int{0, 3, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := fakeFFmpegArgs(t)
+			r, err := openVideo(context.Background(), "clip.mp4", tt.start, tt.end, tt.stride)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexes, timestamps, pixels := readFrames(t, r)
+			if err := r.Close(); err != nil {
+				t.Errorf("读完后 Close() = %v", err)
+			}
+
+			got := args()
+			if i := slices.Index(got, "-noautorotate"); i < 0 || !slices.Equal(got[i+1:i+1+len(tt.wantArgs)], tt.wantArgs) {
+				t.Errorf("ffmpeg 参数 = %q，期望 -noautorotate 之后为 %q", got, tt.wantArgs)
+			}
+			if !slices.Equal(got[len(got)-7:], []string{"-map", "0:v:0", "-f", "rawvideo", "-pix_fmt", "rgb24", "-"}) {
+				t.Errorf("ffmpeg 参数 = %q，期望输出 rgb24 原始帧到标准输出", got)
+			}
+
+			var wantIndexes []int
+			var wantPixels [][3]byte
+			for _, offset := range tt.wantOffset {
+				wantIndexes = append(wantIndexes, tt.wantFirst+offset)
+				wantPixels = append(wantPixels, fakeFramePixel(offset))
+			}
+			if !slices.Equal(indexes, wantIndexes) {
+				t.Errorf("帧序号 = %v，期望 %v", indexes, wantIndexes)
+			}
+			if !slices.Equal(pixels, wantPixels) {
+				t.Errorf("帧像素 = %v，期望 %v", pixels, wantPixels)
+			}
+			// 时间戳从 -video-start 算起，按 30 fps 递增
+			for i, offset := range tt.wantOffset {
+				want := tt.start + time.Duration(offset)*time.Second/30
+				if diff := timestamps[i] - want; diff < -time.Microsecond || diff > time.Microsecond {
+					t.Errorf("第 %d 帧时间戳 = %v，期望 %v", indexes[i], timestamps[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestVideoFrameReaderErrors(t *testing.T) {
+	useFakeFFmpeg(t)
+
+	t.Run("ffmpeg 中途出错", func(t *testing.T) {
+		// 末尾的半帧不返回，ffmpeg 的错误输出在 Close 时返回
+		t.Setenv("FAKE_FFMPEG_KILL", "1")
+		r, err := openVideo(context.Background(), "clip.mp4", 0, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexes, _, _ := readFrames(t, r); len(indexes) != fakeVideoFrames {
+			t.Errorf("读到 %d 帧，期望 %d 帧", len(indexes), fakeVideoFrames)
+		}
+		err = r.Close()
+		if err == nil || !strings.Contains(err.Error(), "Connection reset by peer") {
+			t.Errorf("Close() = %v，期望包含 ffmpeg 的错误输出", err)
+		}
+	})
+
+	t.Run("没有读完时关闭", func(t *testing.T) {
+		t.Setenv("FAKE_FFMPEG_KILL", "1")
+		r, err := openVideo(context.Background(), "clip.mp4", 0, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		PutImageToPool(frame.image)
+		if err := r.Close(); err != nil {
+			t.Errorf("提前关闭时 Close() = %v，期望不报告被终止的 ffmpeg", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("再次 Close() = %v", err)
+		}
+	})
+
+	t.Run("超时没有新帧", func(t *testing.T) {
+		t.Setenv("FAKE_FFMPEG_HANG", "1")
+		info := videoInfo{width: fakeVideoWidth, height: fakeVideoHeight, fps: 30}
+		r, err := startFrameReader(context.Background(), "rtsp://camera.local/stream1", info, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		r.readTimeout = 200 * time.Millisecond
+		for i := range fakeVideoFrames {
+			frame, err := r.Next()
+			if err != nil {
+				t.Fatalf("第 %d 帧: %v", i, err)
+			}
+			PutImageToPool(frame.image)
+		}
+		begin := time.Now()
+		_, err = r.Next()
+		if err == nil || !strings.Contains(err.Error(), "没有收到新帧") {
+			t.Errorf("ffmpeg 卡住时 Next() = %v，期望超时错误", err)
+		}
+		if elapsed := time.Since(begin); elapsed > 10*time.Second {
+			t.Errorf("超时后 %v 才返回", elapsed)
+		}
+	})
+}
+
+func TestProbeVideo(t *testing.T) {
+	useFakeFFmpeg(t)
+
+	tests := []struct {
+		name    string
+		output  string
+		want    videoInfo
+		wantErr string
+	}{
+		{"平均帧率", `{"streams":[{"width":1920,"height":1080,"avg_frame_rate":"30000/1001","r_frame_rate":"30/1"}]}`, videoInfo{width: 1920, height: 1080, fps: 30000.0 / 1001}, ""},
+		{"没有平均帧率时用 r_frame_rate", `{"streams":[{"width":640,"height":480,"avg_frame_rate":"0/0","r_frame_rate":"25/1"}]}`, videoInfo{width: 640, height: 480, fps: 25}, ""},
+		{"没有帧率", `{"streams":[{"width":640,"height":480}]}`, videoInfo{width: 640, height: 480}, ""},
+		{"没有视频流", `{"streams":[]}`, videoInfo{}, "没有视频流"},
+		{"没有尺寸", `{"streams":[{"width":0,"height":0,"avg_frame_rate":"25/1"}]}`, videoInfo{}, "无法读取视频尺寸"},
+		{"输出不是 JSON", `Invalid data`, videoInfo{}, "解析 ffprobe 输出失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_FFPROBE_OUTPUT", tt.output)
+			info, err := probeVideo(context.Background(), "clip.mp4")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("probeVideo() = %v，期望错误包含 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || info != tt.want {
+				t.Errorf("probeVideo() = %+v, %v，期望 %+v", info, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("ffprobe 失败", func(t *testing.T) {
+		failures := filepath.Join(t.TempDir(), "failures")
+		if err := os.WriteFile(failures, []byte("1"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("FAKE_FFPROBE_FAILURES", failures)
+		_, err := probeVideo(context.Background(), "clip.mp4")
+		if err == nil || !strings.Contains(err.Error(), "ffprobe 执行失败") || !strings.Contains(err.Error(), "Connection refused") {
+			t.Errorf("probeVideo() = %v，期望包含 ffprobe 的错误输出", err)
+		}
+	})
+}
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want float64
+	}{
+		{"30/1", 30},
+		{"30000/1001", 30000.0 / 1001},
+		{"25", 25},
+		{"0/0", 0},
+		{"30/0", 0},
+		{"-30/1", 0},
+		{"", 0},
+		{"N/A", 0},
+	}
+	for _, tt := range tests {
+		if got := parseFrameRate(tt.rate); got != tt.want {
+			t.Errorf("parseFrameRate(%q) = %v，期望 %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestValidateVideoOptions(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	tests := []struct {
+		name    string
+		modify  func(c *DetectorConfig)
+		wantErr bool
+	}{
+		{"默认值", func(c *DetectorConfig) {}, false},
+		{"每 5 帧取 1 帧", func(c *DetectorConfig) { c.VidStride = 5 }, false},
+		{"起止时间", func(c *DetectorConfig) { c.VideoStart, c.VideoEnd = time.Second, 2*time.Second }, false},
+		{"只有开始时间", func(c *DetectorConfig) { c.VideoStart = time.Minute }, false},
+		{"-vid-stride 为 0", func(c *DetectorConfig) { c.VidStride = 0 }, true},
+		{"-video-start 为负数", func(c *DetectorConfig) { c.VideoStart = -time.Second }, true},
+		{"-video-end 为负数", func(c *DetectorConfig) { c.VideoEnd = -time.Second }, true},
+		{"结束等于开始", func(c *DetectorConfig) { c.VideoStart, c.VideoEnd = time.Second, time.Second }, true},
+		{"结束早于开始", func(c *DetectorConfig) { c.VideoStart, c.VideoEnd = 2*time.Second, time.Second }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config = DefaultDetectorConfig()
+			tt.modify(&config)
+			if err := validateVideoOptions(); (err != nil) != tt.wantErr {
+				t.Errorf("validateVideoOptions() = %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSplitVideoPaths(t *testing.T) {
+	images, videos := splitVideoPaths([]string{"a.jpg", "b.MP4", "c.png", "d.mkv", "e", "f.avi"})
+	if !slices.Equal(images, []string{"a.jpg", "c.png", "e"}) {
+		t.Errorf("图像 = %q", images)
+	}
+	if !slices.Equal(videos, []string{"b.MP4", "d.mkv", "f.avi"}) {
+		t.Errorf("视频 = %q", videos)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 8}
+	for _, s := range []string{"abc", "defgh", "ijklmnopqrstuvwxyz"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if got := b.String(); got != "stuvwxyz" {
+		t.Errorf("String() = %q，期望只保留最后 8 字节", got)
+	}
+	if err := ffmpegError("ffmpeg", errors.New("exit status 1"), &tailBuffer{limit: 8}); err.Error() != "ffmpeg 执行失败: exit status 1" {
+		t.Errorf("没有错误输出时 ffmpegError() = %q", err)
+	}
+}
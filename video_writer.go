@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 标注视频输出参数
+var saveVideo = &config.SaveVideo
+
+// encodedFrame 已绘制、等待编码的一帧
+type encodedFrame struct {
+	index   int
+	image   *image.RGBA
+	recycle bool // 编码后放回图像池（检测失败的帧可能仍被超时的工作协程读取，不放回）
+}
+
+// videoFrameJob 等待绘制的一帧及其检测结果
+type videoFrameJob struct {
+	index  int
+	frame  *image.RGBA
+	result DetectionResult
+}
+
+// videoWriter 将标注后的帧经 ffmpeg 的标准输入编码为 H.264 mp4
+// 绘制由 -render-workers 个协程并行完成，完成顺序不固定，编码协程按帧序号缓存并依次写入，
+// 输出视频的帧顺序与源视频一致；帧序号必须从 0 开始连续提交
+type videoWriter struct {
+	path     string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stderr   *tailBuffer
+	width    int
+	height   int
+	jobs     chan videoFrameJob
+	rendered chan encodedFrame
+	renderWG sync.WaitGroup
+	done     chan struct{}
+	frames   int   // 已写入的帧数
+	err      error // 第一次写入失败的原因，只由编码协程写入
+}
+
+// annotatedVideoPaths 标注视频的输出路径：按 -output-template 生成后扩展名换为 .mp4
+// 输出目录为 s3:// 前缀时保存到本地 ./assets（视频由 ffmpeg 直接写入文件，不上传）
+func annotatedVideoPaths(outputDir string, videoPaths []string) []string {
+	if isS3Path(outputDir) {
+		outputDir = "./assets"
+	}
+	paths := outputPathsFor(outputDir, structureRoot(*inputImagePath), videoPaths, getModelIdentifier(modelPaths()[0]))
+	for i, path := range paths {
+		paths[i] = strings.TrimSuffix(path, filepath.Ext(path)) + ".mp4"
+	}
+	return paths
+}
+
+// newVideoWriter 启动 ffmpeg 编码进程，输出与源视频相同的分辨率和帧率
+// 每隔 stride 帧检测一帧时按 fps/stride 输入、以源帧率输出，ffmpeg 重复帧补齐，视频时长不变；
+// source 不为空时源视频的音轨（如有）按相同的时间区间一并写入。使用 H.264 + yuv420p + faststart，常见播放器和浏览器都能直接播放
+func newVideoWriter(outputPath, source string, info videoInfo, stride int, start, end time.Duration) (*videoWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return nil, fmt.Errorf("创建输出目录失败: %w", err)
+	}
+	fps := info.fps
+	if fps <= 0 {
+		fps = 25 // 帧率未知时按 25 fps 输出
+	}
+	inputRate := strconv.FormatFloat(fps/float64(max(1, stride)), 'f', -1, 64)
+	args := []string{"-y", "-v", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgb24", "-s", fmt.Sprintf("%dx%d", info.width, info.height), "-r", inputRate, "-i", "-"}
+	if source != "" {
+		if start > 0 {
+			args = append(args, "-ss", formatSeconds(start))
+		}
+		args = append(args, "-i", source, "-map", "0:v:0", "-map", "1:a:0?")
+		if end > 0 {
+			args = append(args, "-t", formatSeconds(end-start))
+		}
+	}
+	args = append(args,
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2", // yuv420p 要求宽高为偶数
+		"-r", strconv.FormatFloat(fps, 'f', -1, 64),
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-shortest",
+		"-movflags", "+faststart", outputPath)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Env = childProcessEnv()
+	ignoreTerminalInterrupt(cmd)
+	stderr := &tailBuffer{limit: videoStderrLimit}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动 ffmpeg 失败: %w", err)
+	}
+	workers := max(1, *renderWorkers)
+	w := &videoWriter{
+		path:     outputPath,
+		cmd:      cmd,
+		stdin:    stdin,
+		stderr:   stderr,
+		width:    info.width,
+		height:   info.height,
+		jobs:     make(chan videoFrameJob, workers*2),
+		rendered: make(chan encodedFrame, workers*2),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		w.renderWG.Add(1)
+		go w.render()
+	}
+	go w.encode()
+	return w, nil
+}
+
+// Write 提交第 index 帧（从 0 开始）及其检测结果，绘制协程都忙时阻塞
+// 检测失败的帧不绘制检测框，原样写入，保持视频连续
+func (w *videoWriter) Write(index int, frame *image.RGBA, result DetectionResult) {
+	w.jobs <- videoFrameJob{index: index, frame: frame, result: result}
+}
+
+// render 绘制协程：在帧上绘制检测框
+func (w *videoWriter) render() {
+	defer w.renderWG.Done()
+	for job := range w.jobs {
+		if job.result.Error != nil {
+			w.rendered <- encodedFrame{index: job.index, image: job.frame}
+			continue
+		}
+		annotated := Annotate(job.frame, job.result.Objects)
+		PutImageToPool(job.frame)
+		w.rendered <- encodedFrame{index: job.index, image: annotated, recycle: true}
+	}
+}
+
+// encode 编码协程：按帧序号缓存先绘制完成的帧，依次写入 ffmpeg
+func (w *videoWriter) encode() {
+	defer close(w.done)
+	pending := make(map[int]encodedFrame)
+	next := 0
+	buf := make([]byte, w.width*w.height*3)
+	for frame := range w.rendered {
+		pending[frame.index] = frame
+		for {
+			head, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if w.err == nil {
+				rgbaToRGB24(head.image, buf)
+				if _, err := w.stdin.Write(buf); err != nil {
+					w.err = fmt.Errorf("写入 ffmpeg 失败: %w", err)
+				} else {
+					w.frames++
+				}
+			}
+			if head.recycle {
+				PutImageToPool(head.image)
+			}
+		}
+	}
+}
+
+// rgbaToRGB24 将 RGBA 图像转换为 rgb24 原始像素
+func rgbaToRGB24(img *image.RGBA, dst []byte) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		src := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		row := dst[y*width*3 : (y+1)*width*3]
+		for x := 0; x < width; x++ {
+			row[x*3] = src[x*4]
+			row[x*3+1] = src[x*4+1]
+			row[x*3+2] = src[x*4+2]
+		}
+	}
+}
+
+// Close 等待已提交的帧编码完成，关闭 ffmpeg 的输入并等待其写完文件
+// 中断时已提交的帧同样写入，得到的是截至中断位置、可以正常播放的视频
+func (w *videoWriter) Close() error {
+	close(w.jobs)
+	w.renderWG.Wait()
+	close(w.rendered)
+	<-w.done
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return ffmpegError("ffmpeg", err, w.stderr)
+	}
+	return w.err
+}
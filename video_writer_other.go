@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ignoreTerminalInterrupt 让编码进程在单独的进程组中运行：终端的 Ctrl+C 只发给本程序，
+// 由本程序关闭 ffmpeg 的输入，ffmpeg 正常写完文件尾，中断后得到的视频仍可播放
+func ignoreTerminalInterrupt(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 假视频：fakeVideoFrames 帧 fakeVideoWidth×fakeVideoHeight，30 fps，第 i 帧所有像素为 fakeFramePixel(i)
+const (
+	fakeVideoWidth  = 8
+	fakeVideoHeight = 6
+	fakeVideoFrames = 7
+)
+
+func fakeFramePixel(i int) [3]byte {
+	return [3]byte{byte(10 * i), byte(200 - 10*i), byte(i)}
+}
+
+// fakeFFmpeg 以 ffmpeg/ffprobe 的名称运行测试程序时代替它们：
+// ffprobe 输出假视频的信息；ffmpeg 从 "-" 读取时把标准输入原样写入输出文件并在 <输出>.args 中记录参数，
+// 否则将假视频的原始帧写到标准输出
+// 环境变量 FAKE_FFPROBE_FAILURES 为计数文件时，ffprobe 在计数减到 0 之前失败，
+// 错误输出为 FAKE_FFPROBE_ERROR（默认 Connection refused）；
+// FAKE_FFPROBE_OUTPUT 非空时 ffprobe 输出它代替假视频的信息；
+// FAKE_FFMPEG_ARGS 非空时 ffmpeg 解码前把参数逐行写入该文件；
+// FAKE_FFMPEG_KILL 非空时 ffmpeg 写完帧后再写半帧并以状态 1 退出，模拟断流；
+// FAKE_FFMPEG_HANG 非空时 ffmpeg 写完帧后不退出，模拟卡住的视频流
+func fakeFFmpeg(name string, args []string) {
+	switch {
+	case name == "ffprobe":
+		if path := os.Getenv("FAKE_FFPROBE_FAILURES"); path != "" {
+			var n int
+			data, _ := os.ReadFile(path)
+			fmt.Sscan(string(data), &n)
+			if n > 0 {
+				os.WriteFile(path, []byte(fmt.Sprint(n-1)), 0o644)
+				message := cmp.Or(os.Getenv("FAKE_FFPROBE_ERROR"), "Connection refused")
+				fmt.Fprintln(os.Stderr, message)
+				os.Exit(1)
+			}
+		}
+		if output := os.Getenv("FAKE_FFPROBE_OUTPUT"); output != "" {
+			fmt.Print(output)
+			break
+		}
+		fmt.Printf(`{"streams":[{"width":%d,"height":%d,"avg_frame_rate":"30/1"}]}`, fakeVideoWidth, fakeVideoHeight)
+	case slices.Contains(args, "-") && args[len(args)-1] != "-":
+		output := args[len(args)-1]
+		data, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = os.WriteFile(output, data, 0o644)
+		}
+		if err == nil {
+			err = os.WriteFile(output+".args", []byte(strings.Join(args, "\n")), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		if path := os.Getenv("FAKE_FFMPEG_ARGS"); path != "" {
+			os.WriteFile(path, []byte(strings.Join(args, "\n")), 0o644)
+		}
+		for i := range fakeVideoFrames {
+			pixel := fakeFramePixel(i)
+			os.Stdout.Write(bytes.Repeat(pixel[:], fakeVideoWidth*fakeVideoHeight))
+		}
+		if os.Getenv("FAKE_FFMPEG_KILL") != "" {
+			os.Stdout.Write(make([]byte, fakeVideoWidth*fakeVideoHeight*3/2))
+			fmt.Fprintln(os.Stderr, "Connection reset by peer")
+			os.Exit(1)
+		}
+		if os.Getenv("FAKE_FFMPEG_HANG") != "" {
+			time.Sleep(time.Minute)
+		}
+	}
+	os.Exit(0)
+}
+
+// useFakeFFmpeg 把测试程序以 ffmpeg、ffprobe 的名称放到 PATH 最前面
+func useFakeFFmpeg(t *testing.T) {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if err := os.Symlink(self, filepath.Join(dir, name)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// encodedFrames 按 rgb24 帧拆分编码输入，返回每帧左上角的像素
+func encodedFrames(t *testing.T, data []byte) [][3]byte {
+	t.Helper()
+	size := fakeVideoWidth * fakeVideoHeight * 3
+	if len(data)%size != 0 {
+		t.Fatalf("编码输入 %d 字节，不是整数帧", len(data))
+	}
+	var pixels [][3]byte
+	for offset := 0; offset < len(data); offset += size {
+		pixels = append(pixels, [3]byte(data[offset:offset+3]))
+	}
+	return pixels
+}
+
+func TestVideoWriterOrdersFrames(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeFFmpeg(t)
+
+	tests := []struct {
+		name    string
+		workers int
+		failed  bool // 检测失败的帧原样写入
+	}{
+		{"单个绘制协程", 1, false},
+		{"多个绘制协程乱序完成", 4, false},
+		{"检测失败的帧", 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.RenderWorkers = tt.workers
+			output := filepath.Join(t.TempDir(), "out", "video.mp4")
+			info := videoInfo{width: fakeVideoWidth, height: fakeVideoHeight, fps: 30}
+			writer, err := newVideoWriter(output, "", info, 1, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 按任意顺序提交，写入顺序与帧序号一致
+			const frames = 40
+			order := rand.New(rand.NewSource(1)).Perm(frames)
+			for _, i := range order {
+				frame := image.NewRGBA(image.Rect(0, 0, fakeVideoWidth, fakeVideoHeight))
+				pixel := fakeFramePixel(i % fakeVideoFrames)
+				for p := 0; p < len(frame.Pix); p += 4 {
+					copy(frame.Pix[p:], []byte{pixel[0], pixel[1], pixel[2], 255})
+				}
+				var result DetectionResult
+				if tt.failed {
+					result.Error = ErrTaskTimeout
+				}
+				writer.Write(i, frame, result)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if writer.frames != frames {
+				t.Errorf("写入 %d 帧，期望 %d 帧", writer.frames, frames)
+			}
+
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, pixel := range encodedFrames(t, data) {
+				if want := fakeFramePixel(i % fakeVideoFrames); pixel != want {
+					t.Fatalf("第 %d 帧的像素 = %v，期望 %v（帧顺序错误）", i, pixel, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveVideoEndToEnd(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeFFmpeg(t)
+	useFakeSessions(t)
+	config.SaveVideo = true
+	config.RenderWorkers = 3
+	config.Workers = 2
+
+	tests := []struct {
+		name      string
+		stride    int
+		frames    int
+		inputRate string
+	}{
+		{"检测每一帧", 1, fakeVideoFrames, "30"},
+		{"-vid-stride 2", 2, (fakeVideoFrames + 1) / 2, "15"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.VidStride = tt.stride
+			dir := t.TempDir()
+			video := filepath.Join(dir, "clip.mov")
+			if err := os.WriteFile(video, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			outputDir := filepath.Join(dir, "assets")
+			ProcessVideoFiles([]string{video}, outputDir) // 假会话推理失败，失败的帧原样写入标注视频
+
+			outputs, _ := filepath.Glob(filepath.Join(outputDir, "*.mp4"))
+			if len(outputs) != 1 || !strings.HasPrefix(filepath.Base(outputs[0]), "clip_") {
+				t.Fatalf("输出 = %v，期望一个 clip_*.mp4", outputs)
+			}
+			data, err := os.ReadFile(outputs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			pixels := encodedFrames(t, data)
+			if len(pixels) != tt.frames {
+				t.Fatalf("编码 %d 帧，期望 %d 帧", len(pixels), tt.frames)
+			}
+			for i, pixel := range pixels {
+				if want := fakeFramePixel(i * tt.stride); pixel != want {
+					t.Errorf("第 %d 帧的像素 = %v，期望源视频第 %d 帧 %v", i, pixel, i*tt.stride, want)
+				}
+			}
+
+			// 保持源视频的分辨率和帧率，音轨取自源视频，输出常见播放器可以播放的 H.264/yuv420p
+			argsData, err := os.ReadFile(outputs[0] + ".args")
+			if err != nil {
+				t.Fatal(err)
+			}
+			args := strings.Split(string(argsData), "\n")
+			want := [][]string{
+				{"-s", fmt.Sprintf("%dx%d", fakeVideoWidth, fakeVideoHeight)},
+				{"-r", tt.inputRate, "-i", "-"},
+				{"-i", video, "-map", "0:v:0", "-map", "1:a:0?"},
+				{"-r", "30", "-c:v", "libx264", "-pix_fmt", "yuv420p"},
+				{"-movflags", "+faststart"},
+			}
+			joined := "\n" + string(argsData) + "\n"
+			for _, w := range want {
+				if !strings.Contains(joined, "\n"+strings.Join(w, "\n")+"\n") {
+					t.Errorf("ffmpeg 参数中没有 %v: %v", w, args)
+				}
+			}
+		})
+	}
+}
+
+func TestRGBAToRGB24(t *testing.T) {
+	img := randomRGBA(image.Rect(0, 0, 5, 3), 2)
+	dst := make([]byte, 5*3*3)
+	rgbaToRGB24(img, dst)
+	if back := rgb24ToRGBA(dst, 5, 3); !bytes.Equal(stripAlpha(back.Pix), stripAlpha(img.Pix)) {
+		t.Error("rgb24 与 RGBA 互相转换后像素不一致")
+	}
+}
+
+// stripAlpha 去掉 RGBA 像素中的透明度
+func stripAlpha(pix []byte) []byte {
+	out := make([]byte, 0, len(pix)/4*3)
+	for i := 0; i < len(pix); i += 4 {
+		out = append(out, pix[i:i+3]...)
+	}
+	return out
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ignoreTerminalInterrupt 让编码进程在新的进程组中运行，不接收控制台的 Ctrl+C，
+// 由本程序关闭 ffmpeg 的输入，ffmpeg 正常写完文件尾，中断后得到的视频仍可播放
+func ignoreTerminalInterrupt(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
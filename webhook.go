@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 危险对象 Webhook 参数
+var (
+	webhookURL       = &config.WebhookURL
+	webhookRetries   = &config.WebhookRetries
+	webhookThumbnail = &config.WebhookThumbnail
+)
+
+const (
+	webhookQueueSize  = 256              // 等待发送的通知数上限，超出的通知丢弃
+	webhookTimeout    = 10 * time.Second // 单次 POST 的超时时间
+	webhookMaxBackoff = 30 * time.Second
+)
+
+// WebhookPayload 检测到危险对象时 POST 到 -webhook-url 的 JSON
+type WebhookPayload struct {
+	Source     string            `json:"source"`
+	Timestamp  time.Time         `json:"timestamp"`
+	TaskID     uint64            `json:"task_id,omitempty"`
+	Counts     map[string]int    `json:"counts"` // 按危险类别统计的对象数
+	Detections []DetectionObject `json:"detections"`
+	ImageURL   string            `json:"image_url,omitempty"` // 输入为 http(s) URL 时为原图地址
+	Thumbnail  string            `json:"thumbnail,omitempty"` // 原图缩略图（JPEG base64）
+}
+
+// webhookSink 检测到 -danger-classes 中的对象时通知 -webhook-url，同一目录的同一类别在 -alert-cooldown 内只通知一次；
+// Write 只判断是否需要通知并放入队列，由发送协程生成缩略图并 POST，失败时最多重试 -webhook-retries 次
+type webhookSink struct {
+	mutex     sync.Mutex
+	url       string
+	filter    *classFilter // 为 nil 时所有类别都是危险类别
+	debounce  *alertDebouncer
+	retries   int
+	thumbnail uint
+	client    *http.Client
+	queue     chan WebhookPayload
+	done      chan struct{}
+	closed    bool
+	sent      atomic.Int64
+	dropped   atomic.Int64 // 队列已满丢弃的通知数
+	failed    atomic.Int64 // 重试后仍失败的通知数
+}
+
+// newWebhookSink 按 -webhook-* 参数创建通知输出
+func newWebhookSink() (*webhookSink, error) {
+	filter, err := parseDangerClasses()
+	if err != nil {
+		return nil, err
+	}
+	if *webhookRetries < 0 {
+		return nil, fmt.Errorf("-webhook-retries 不能小于 0")
+	}
+	s := &webhookSink{
+		url:       *webhookURL,
+		filter:    filter,
+		debounce:  newAlertDebouncer(*alertCooldown),
+		retries:   *webhookRetries,
+		thumbnail: uint(max(0, *webhookThumbnail)),
+		client:    &http.Client{Timeout: webhookTimeout},
+		queue:     make(chan WebhookPayload, webhookQueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+func (s *webhookSink) Name() string { return "webhook:" + s.url }
+
+// Write 结果中有不在冷却期内的危险类别时通知；通知包含该结果中所有危险类别的对象
+func (s *webhookSink) Write(record ResultRecord) error {
+	if record.Error != "" {
+		return nil
+	}
+	payload := WebhookPayload{Source: record.ImagePath, Timestamp: record.Timestamp, TaskID: record.TaskID}
+	payload.Detections, payload.Counts = dangerObjects(s.filter, record.Detections)
+	if len(payload.Detections) == 0 || !s.debounce.due(record.ImagePath, payload.Counts, time.Now()) {
+		return nil
+	}
+	if isURLInput(record.ImagePath) {
+		payload.ImageURL = record.ImagePath
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return fmt.Errorf("输出已关闭")
+	}
+	select {
+	case s.queue <- payload:
+	default:
+		if s.dropped.Add(1) == 1 {
+			writeLogFile("WARN", fmt.Sprintf("%s 通知队列已满，开始丢弃通知", s.Name()))
+		}
+	}
+	return nil
+}
+
+// loop 发送协程：逐条生成缩略图并发送
+func (s *webhookSink) loop() {
+	defer close(s.done)
+	for payload := range s.queue {
+		if s.thumbnail > 0 {
+			payload.Thumbnail = fileThumbnail(payload.Source, s.thumbnail)
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			s.failed.Add(1)
+			continue
+		}
+		s.send(payload.Source, body)
+	}
+}
+
+// send POST 一条通知，网络错误、5xx 和 429 时间隔从 1 秒翻倍重试，其他 4xx 不重试
+func (s *webhookSink) send(source string, body []byte) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			s.sent.Add(1)
+			return
+		}
+		if !retry || attempt >= s.retries {
+			s.failed.Add(1)
+			writeLogFile("WARN", fmt.Sprintf("%s 通知 %s 失败（已尝试 %d 次）: %v", s.Name(), source, attempt+1, err))
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+// post 发送一次请求，返回失败时是否值得重试
+func (s *webhookSink) post(body []byte) (bool, error) {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("HTTP %s", resp.Status)
+}
+
+// Flush 发送协程逐条发送，没有需要额外刷新的缓冲
+func (s *webhookSink) Flush() error { return nil }
+
+// Close 发送队列中剩余的通知后返回
+func (s *webhookSink) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mutex.Unlock()
+	<-s.done
+
+	if dropped, failed := s.dropped.Load(), s.failed.Load(); dropped+failed > 0 {
+		return fmt.Errorf("已发送 %d 条通知，%d 条因队列已满被丢弃，%d 条发送失败（详见日志）", s.sent.Load(), dropped, failed)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver 记录收到的通知，statuses 依次作为响应状态码，用完后返回 200
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	payloads []WebhookPayload
+	statuses []int
+	requests int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests++
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var payload WebhookPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.payloads = append(r.payloads, payload)
+}
+
+// newTestWebhookSink 创建通知 receiver 的 webhookSink
+func newTestWebhookSink(t *testing.T, receiver *webhookReceiver, cooldown time.Duration) *webhookSink {
+	t.Helper()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+	config.WebhookURL = server.URL
+	config.AlertCooldown = cooldown
+	sink, err := newWebhookSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func dangerRecord(imagePath string, labels ...string) ResultRecord {
+	record := ResultRecord{ImagePath: imagePath, TaskID: 3, Timestamp: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+	for _, label := range labels {
+		record.Detections = append(record.Detections, DetectionObject{Label: label, Confidence: 0.9, Box: [4]float32{1, 2, 3, 4}})
+	}
+	return record
+}
+
+func TestWebhookPayload(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.DangerClasses = "person,truck"
+	config.WebhookRetries = 0
+	config.WebhookThumbnail = 32
+	dir := t.TempDir()
+	img := filepath.Join(dir, "frame.png")
+	if err := os.WriteFile(img, encodeTestImage(t, "png", 128, 64), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := &webhookReceiver{}
+	sink := newTestWebhookSink(t, receiver, time.Minute)
+	sink.Write(dangerRecord(img, "person", "dog", "truck", "person"))
+	sink.Write(dangerRecord(filepath.Join(dir, "cam2", "a.jpg"), "dog"))     // 没有危险类别
+	sink.Write(ResultRecord{ImagePath: "bad.jpg", Error: "解码失败"})            // 处理失败
+	sink.Write(dangerRecord("https://example.com/cam3/latest.jpg", "truck")) // URL 输入
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(receiver.payloads) != 2 {
+		t.Fatalf("收到 %d 条通知，期望 2 条: %+v", len(receiver.payloads), receiver.payloads)
+	}
+	got := receiver.payloads[0]
+	var labels []string
+	for _, d := range got.Detections {
+		labels = append(labels, d.Label)
+	}
+	if got.Source != img || got.TaskID != 3 || !got.Timestamp.Equal(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)) ||
+		len(got.Counts) != 2 || got.Counts["person"] != 2 || got.Counts["truck"] != 1 ||
+		!slices.Equal(labels, []string{"person", "truck", "person"}) || got.ImageURL != "" {
+		t.Errorf("通知 = %+v", got)
+	}
+	thumbnail, err := base64.StdEncoding.DecodeString(got.Thumbnail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil || cfg.Width != 32 || cfg.Height != 16 {
+		t.Errorf("缩略图 = %dx%d (%v)，期望 32x16 的 JPEG", cfg.Width, cfg.Height, err)
+	}
+
+	// URL 输入带原图地址，无法读取原图时不附带缩略图
+	if url := receiver.payloads[1]; url.ImageURL != "https://example.com/cam3/latest.jpg" || url.Counts["truck"] != 1 {
+		t.Errorf("URL 输入的通知 = %+v", url)
+	}
+}
+
+func TestWebhookCooldown(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.DangerClasses = "person,truck"
+	config.WebhookRetries, config.WebhookThumbnail = 0, 0
+
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		records  []ResultRecord
+		want     []string // 依次收到通知的图像
+	}{
+		{"停着的车辆每个冷却期只通知一次", time.Minute, []ResultRecord{
+			dangerRecord("cam1/0001.jpg", "truck"), dangerRecord("cam1/0002.jpg", "truck"), dangerRecord("cam1/0003.jpg", "truck"),
+		}, []string{"cam1/0001.jpg"}},
+		{"其他摄像头单独计算冷却期", time.Minute, []ResultRecord{
+			dangerRecord("cam1/0001.jpg", "truck"), dangerRecord("cam2/0001.jpg", "truck"), dangerRecord("cam2/0002.jpg", "truck"),
+		}, []string{"cam1/0001.jpg", "cam2/0001.jpg"}},
+		{"新出现的类别立即通知", time.Minute, []ResultRecord{
+			dangerRecord("cam1/0001.jpg", "truck"), dangerRecord("cam1/0002.jpg", "truck", "person"), dangerRecord("cam1/0003.jpg", "person", "truck"),
+		}, []string{"cam1/0001.jpg", "cam1/0002.jpg"}},
+		{"-alert-cooldown 0 每帧通知", 0, []ResultRecord{
+			dangerRecord("cam1/0001.jpg", "truck"), dangerRecord("cam1/0002.jpg", "truck"),
+		}, []string{"cam1/0001.jpg", "cam1/0002.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := &webhookReceiver{}
+			sink := newTestWebhookSink(t, receiver, tt.cooldown)
+			for _, record := range tt.records {
+				sink.Write(record)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+			var sources []string
+			for _, p := range receiver.payloads {
+				sources = append(sources, p.Source)
+			}
+			if !slices.Equal(sources, tt.want) {
+				t.Errorf("通知 = %v，期望 %v", sources, tt.want)
+			}
+		})
+	}
+
+	// 冷却期过后再次通知
+	receiver := &webhookReceiver{}
+	sink := newTestWebhookSink(t, receiver, 50*time.Millisecond)
+	sink.Write(dangerRecord("cam1/0001.jpg", "truck"))
+	sink.Write(dangerRecord("cam1/0002.jpg", "truck"))
+	time.Sleep(60 * time.Millisecond)
+	sink.Write(dangerRecord("cam1/0003.jpg", "truck"))
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.payloads) != 2 || receiver.payloads[1].Source != "cam1/0003.jpg" {
+		t.Errorf("冷却期过后的通知 = %+v", receiver.payloads)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.DangerClasses = "truck"
+	config.WebhookThumbnail = 0
+
+	tests := []struct {
+		name     string
+		retries  int
+		statuses []int
+		requests int
+		sent     bool
+	}{
+		{"503 后重试成功", 3, []int{http.StatusServiceUnavailable}, 2, true},
+		{"429 后重试成功", 3, []int{http.StatusTooManyRequests}, 2, true},
+		{"400 不重试", 3, []int{http.StatusBadRequest}, 1, false},
+		{"重试次数用完", 1, []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.WebhookRetries = tt.retries
+			receiver := &webhookReceiver{statuses: tt.statuses}
+			sink := newTestWebhookSink(t, receiver, 0)
+
+			// 发送在后台进行，写入不等待重试
+			start := time.Now()
+			sink.Write(dangerRecord("cam1/0001.jpg", "truck"))
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Errorf("写入耗时 %v", elapsed)
+			}
+			err := sink.Close()
+			if receiver.requests != tt.requests || (err == nil) != tt.sent || (len(receiver.payloads) == 1) != tt.sent {
+				t.Errorf("请求 %d 次，收到 %d 条，Close() = %v；期望请求 %d 次，发送成功 %v", receiver.requests, len(receiver.payloads), err, tt.requests, tt.sent)
+			}
+		})
+	}
+}
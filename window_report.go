@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分时段报告参数
+var (
+	reportInterval = &config.ReportInterval
+	reportFile     = &config.ReportFile
+)
+
+// WindowReport 一个统计时段的汇总；长时间运行时每隔 -report-interval 输出一次，输出后时段计数清零
+type WindowReport struct {
+	Type       string         `json:"type"` // 固定为 window_report，便于与检测记录混在同一个 NDJSON 输出中区分
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Frames     int64          `json:"frames"`                // 本时段处理完成的图像/帧数（含失败）
+	Failures   int64          `json:"failures"`              // 本时段处理失败的数量
+	Drops      int64          `json:"drops"`                 // 本时段因队列已满被拒绝或结果未能送出的数量
+	FrameDrops int64          `json:"frame_drops,omitempty"` // 本时段视频流、摄像头自适应丢帧（-adaptive-drop）丢弃的帧数
+	Alerts     int64          `json:"alerts"`                // 本时段触发的告警事件数
+	Classes    map[string]int `json:"classes"`               // 本时段各类别的检测框数量
+	LatencyP50 time.Duration  `json:"latency_p50_ns"`
+	LatencyP95 time.Duration  `json:"latency_p95_ns"`
+	LatencyP99 time.Duration  `json:"latency_p99_ns"`
+	LatencyMax time.Duration  `json:"latency_max_ns"`
+	Cumulative WindowTotals   `json:"cumulative"` // 自启动以来的累计值，不随时段清零
+}
+
+// WindowTotals 自启动以来的累计计数
+type WindowTotals struct {
+	Frames     int64          `json:"frames"`
+	Failures   int64          `json:"failures"`
+	Drops      int64          `json:"drops"`
+	FrameDrops int64          `json:"frame_drops,omitempty"`
+	Alerts     int64          `json:"alerts"`
+	Classes    map[string]int `json:"classes"`
+}
+
+// String 返回适合打印和写入日志的一行摘要
+func (r WindowReport) String() string {
+	classes := make([]string, 0, len(r.Classes))
+	for label, n := range r.Classes {
+		classes = append(classes, fmt.Sprintf("%s=%d", label, n))
+	}
+	sort.Strings(classes)
+	line := fmt.Sprintf("时段报告 %s ~ %s: 帧 %d, 失败 %d, 丢弃 %d, 告警 %d, 类别 [%s], 耗时 p50 %v p95 %v p99 %v 最大 %v（累计: 帧 %d, 失败 %d, 丢弃 %d, 告警 %d）",
+		formatTimestamp(r.Start), formatTimestamp(r.End), r.Frames, r.Failures, r.Drops, r.Alerts, strings.Join(classes, ", "),
+		r.LatencyP50.Round(time.Millisecond), r.LatencyP95.Round(time.Millisecond),
+		r.LatencyP99.Round(time.Millisecond), r.LatencyMax.Round(time.Millisecond),
+		r.Cumulative.Frames, r.Cumulative.Failures, r.Cumulative.Drops, r.Cumulative.Alerts)
+	if r.Cumulative.FrameDrops > 0 {
+		line += fmt.Sprintf(", 跳过旧帧 %d（累计 %d）", r.FrameDrops, r.Cumulative.FrameDrops)
+	}
+	return line
+}
+
+// windowStats 分时段统计：Record/Drop 累加当前时段，Roll 生成报告并清零当前时段，累计值一直保留
+type windowStats struct {
+	mutex      sync.Mutex
+	start      time.Time
+	frames     int64
+	failures   int64
+	drops      int64
+	frameDrops int64
+	alerts     int64
+	classes    map[string]int
+	latencies  []time.Duration
+	totals     WindowTotals
+}
+
+func newWindowStats(start time.Time) *windowStats {
+	return &windowStats{
+		start:   start,
+		classes: make(map[string]int),
+		totals:  WindowTotals{Classes: make(map[string]int)},
+	}
+}
+
+// Record 记录一个处理完成的结果
+func (w *windowStats) Record(result DetectionResult) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.frames++
+	if result.Error != nil {
+		w.failures++
+	}
+	w.alerts += int64(len(result.Alerts))
+	for _, box := range result.Objects {
+		w.classes[box.label]++
+	}
+	if result.Elapsed > 0 {
+		w.latencies = append(w.latencies, result.Elapsed)
+	}
+}
+
+// Drop 记录一个被丢弃的任务或结果
+func (w *windowStats) Drop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.drops++
+}
+
+// DropFrame 记录一帧自适应丢帧丢弃的视频帧
+func (w *windowStats) DropFrame() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.frameDrops++
+}
+
+// Roll 结束当前时段：返回截至 now 的时段报告，把时段计数并入累计值后清零，下一时段从 now 开始
+func (w *windowStats) Roll(now time.Time) WindowReport {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.totals.Frames += w.frames
+	w.totals.Failures += w.failures
+	w.totals.Drops += w.drops
+	w.totals.FrameDrops += w.frameDrops
+	w.totals.Alerts += w.alerts
+	for label, n := range w.classes {
+		w.totals.Classes[label] += n
+	}
+
+	report := WindowReport{
+		Type:       "window_report",
+		Start:      w.start,
+		End:        now,
+		Frames:     w.frames,
+		Failures:   w.failures,
+		Drops:      w.drops,
+		FrameDrops: w.frameDrops,
+		Alerts:     w.alerts,
+		Classes:    w.classes,
+		Cumulative: WindowTotals{
+			Frames:     w.totals.Frames,
+			Failures:   w.totals.Failures,
+			Drops:      w.totals.Drops,
+			FrameDrops: w.totals.FrameDrops,
+			Alerts:     w.totals.Alerts,
+			Classes:    make(map[string]int, len(w.totals.Classes)),
+		},
+	}
+	for label, n := range w.totals.Classes {
+		report.Cumulative.Classes[label] = n
+	}
+	if len(w.latencies) > 0 {
+		sort.Slice(w.latencies, func(i, j int) bool { return w.latencies[i] < w.latencies[j] })
+		report.LatencyP50 = durationPercentile(w.latencies, 50)
+		report.LatencyP95 = durationPercentile(w.latencies, 95)
+		report.LatencyP99 = durationPercentile(w.latencies, 99)
+		report.LatencyMax = w.latencies[len(w.latencies)-1]
+	}
+
+	w.start = now
+	w.frames, w.failures, w.drops, w.frameDrops, w.alerts = 0, 0, 0, 0, 0
+	w.classes = make(map[string]int)
+	w.latencies = nil
+	return report
+}
+
+// runWindowReports 每隔 interval 输出一次时段报告；管理器停止时输出最后一个不完整的时段
+func (manager *VideoDetectorManager) runWindowReports(interval time.Duration) {
+	defer manager.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			emitWindowReport(manager.window.Roll(now))
+		case <-manager.shutdown:
+			if report := manager.window.Roll(time.Now()); report.Frames > 0 || report.Drops > 0 || report.FrameDrops > 0 {
+				emitWindowReport(report)
+			}
+			return
+		}
+	}
+}
+
+// emitWindowReport 将时段报告打印到控制台并写入日志、支持报告的结果输出（ndjson）和 -report-file
+func emitWindowReport(report WindowReport) {
+	fmt.Printf("%s\n", report.String())
+	writeLogFile("INFO", report.String())
+	resultSinks.WriteReport(report)
+	if *reportFile != "" {
+		if err := appendWindowReport(*reportFile, report); err != nil {
+			fmt.Printf("写入时段报告失败: %v\n", err)
+		}
+	}
+}
+
+// appendWindowReport 以 JSON Lines 格式追加一条时段报告
+func appendWindowReport(path string, report WindowReport) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化时段报告失败: %w", err)
+	}
+	file, err := os.OpenFile(longPath(path), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// reportSink 可以写入时段报告的结果输出（可选接口）
+type reportSink interface {
+	WriteReport(report WindowReport) error
+}
+
+// WriteReport 将时段报告写入所有支持报告的输出，错误只记录日志
+func (s *sinkSet) WriteReport(report WindowReport) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	for _, sink := range s.sinks {
+		if rs, ok := sink.(reportSink); ok {
+			if err := rs.WriteReport(report); err != nil {
+				writeLogFile("ERROR", fmt.Sprintf("写入输出 %s 的时段报告失败: %v", sink.Name(), err))
+			}
+		}
+	}
+}
+
+// WriteReport ndjson 输出中时段报告与检测记录写在同一个文件，用 type 字段区分
+func (s *ndjsonSink) WriteReport(report WindowReport) error {
+	line, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("序列化时段报告失败: %w", err)
+	}
+	return s.writeLine(func(w *bufio.Writer) error {
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+}
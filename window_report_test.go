@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWindowStatsRoll(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	result := func(elapsed time.Duration, labels ...string) DetectionResult {
+		r := DetectionResult{Elapsed: elapsed}
+		for _, label := range labels {
+			r.Objects = append(r.Objects, boundingBox{label: label})
+		}
+		return r
+	}
+
+	// 每个时段的事件和该时段结束时期望的报告
+	type window struct {
+		results    []DetectionResult
+		drops      int
+		frameDrops int
+		report     WindowReport // 只比较计数、类别和耗时，Start/End/Cumulative 单独检查
+		cumulative WindowTotals
+	}
+	windows := []window{
+		{
+			results: []DetectionResult{
+				result(10*time.Millisecond, "person", "car"),
+				result(30*time.Millisecond, "person"),
+				{Error: errors.New("加载失败")},
+				{Elapsed: 20 * time.Millisecond, DetectionRecord: DetectionRecord{Alerts: make([]AlertEvent, 2)}},
+			},
+			drops:      1,
+			report:     WindowReport{Frames: 4, Failures: 1, Drops: 1, Alerts: 2, Classes: map[string]int{"person": 2, "car": 1}, LatencyP50: 20 * time.Millisecond, LatencyP95: 30 * time.Millisecond, LatencyP99: 30 * time.Millisecond, LatencyMax: 30 * time.Millisecond},
+			cumulative: WindowTotals{Frames: 4, Failures: 1, Drops: 1, Alerts: 2, Classes: map[string]int{"person": 2, "car": 1}},
+		},
+		// 空时段：计数为零，上一时段的耗时不会带入
+		{
+			report:     WindowReport{Classes: map[string]int{}},
+			cumulative: WindowTotals{Frames: 4, Failures: 1, Drops: 1, Alerts: 2, Classes: map[string]int{"person": 2, "car": 1}},
+		},
+		{
+			results:    []DetectionResult{result(5*time.Millisecond, "dog")},
+			frameDrops: 3,
+			report:     WindowReport{Frames: 1, FrameDrops: 3, Classes: map[string]int{"dog": 1}, LatencyP50: 5 * time.Millisecond, LatencyP95: 5 * time.Millisecond, LatencyP99: 5 * time.Millisecond, LatencyMax: 5 * time.Millisecond},
+			cumulative: WindowTotals{Frames: 5, Failures: 1, Drops: 1, FrameDrops: 3, Alerts: 2, Classes: map[string]int{"person": 2, "car": 1, "dog": 1}},
+		},
+	}
+
+	stats := newWindowStats(start)
+	for i, w := range windows {
+		for _, r := range w.results {
+			stats.Record(r)
+		}
+		for j := 0; j < w.drops; j++ {
+			stats.Drop()
+		}
+		for j := 0; j < w.frameDrops; j++ {
+			stats.DropFrame()
+		}
+		end := start.Add(time.Duration(i+1) * time.Minute)
+		report := stats.Roll(end)
+
+		if report.Type != "window_report" {
+			t.Errorf("时段 %d: Type = %q", i, report.Type)
+		}
+		// 时段首尾相接：每个时段从上一次 Roll 的时间开始
+		if wantStart := start.Add(time.Duration(i) * time.Minute); !report.Start.Equal(wantStart) || !report.End.Equal(end) {
+			t.Errorf("时段 %d: %v ~ %v，期望 %v ~ %v", i, report.Start, report.End, wantStart, end)
+		}
+		if !reflect.DeepEqual(report.Cumulative, w.cumulative) {
+			t.Errorf("时段 %d 累计值 = %+v，期望 %+v", i, report.Cumulative, w.cumulative)
+		}
+		cumulative := report.Cumulative
+		report.Type, report.Start, report.End, report.Cumulative = "", time.Time{}, time.Time{}, WindowTotals{}
+		if !reflect.DeepEqual(report, w.report) {
+			t.Errorf("时段 %d 报告 = %+v\n期望 %+v", i, report, w.report)
+		}
+
+		// 修改已输出的报告不影响后续时段和累计值（由后续时段的比较检查）
+		report.Classes["person"] += 100
+		cumulative.Classes["person"] += 100
+	}
+}
+
+func TestWindowStatsConcurrentRecord(t *testing.T) {
+	stats := newWindowStats(time.Now())
+	var wg sync.WaitGroup
+	var rolled []WindowReport
+	var rolledMutex sync.Mutex
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.Record(DetectionResult{Elapsed: time.Millisecond, DetectionRecord: DetectionRecord{Objects: []boundingBox{{label: "car"}}}})
+				stats.Drop()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			report := stats.Roll(time.Now())
+			rolledMutex.Lock()
+			rolled = append(rolled, report)
+			rolledMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	final := stats.Roll(time.Now())
+
+	// 并发 Roll 时每个事件只计入一个时段
+	var frames, drops int64
+	var cars int
+	for _, report := range append(rolled, final) {
+		frames += report.Frames
+		drops += report.Drops
+		cars += report.Classes["car"]
+	}
+	if frames != 800 || drops != 800 || cars != 800 {
+		t.Errorf("各时段合计 帧 %d, 丢弃 %d, car %d，期望均为 800", frames, drops, cars)
+	}
+	if final.Cumulative.Frames != 800 || final.Cumulative.Classes["car"] != 800 {
+		t.Errorf("累计值 = %+v", final.Cumulative)
+	}
+}
+
+func TestAppendWindowReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports.jsonl")
+	stats := newWindowStats(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC))
+	for i := 0; i < 2; i++ {
+		stats.Record(DetectionResult{Elapsed: time.Second, DetectionRecord: DetectionRecord{Objects: []boundingBox{{label: "person"}}}})
+		if err := appendWindowReport(path, stats.Roll(time.Date(2024, 6, 1, 0, i+1, 0, 0, time.UTC))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var reports []WindowReport
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var report WindowReport
+		if err := json.Unmarshal(scanner.Bytes(), &report); err != nil {
+			t.Fatalf("第 %d 行: %v", len(reports)+1, err)
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("报告文件有 %d 行，期望 2 行（追加写入）", len(reports))
+	}
+	if reports[1].Frames != 1 || reports[1].Cumulative.Frames != 2 || reports[1].LatencyMax != time.Second {
+		t.Errorf("第二条报告 = %+v", reports[1])
+	}
+}
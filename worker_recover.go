@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrTaskPanic 处理任务时发生 panic（图像解码、推理等），任务以该错误失败，工作协程继续运行
+var ErrTaskPanic = errors.New("处理任务时发生 panic")
+
+// taskPanic panic 的值和发生时的调用栈
+// 归还会话的 defer 捕获 panic 后重新抛出，包装成 taskPanic 以保留最初的调用栈
+type taskPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func newTaskPanic(r interface{}) *taskPanic {
+	if p, ok := r.(*taskPanic); ok {
+		return p
+	}
+	return &taskPanic{value: r, stack: debug.Stack()}
+}
+
+// sessionLease 任务借出的会话及其使用结果，决定会话如何归还
+type sessionLease struct {
+	session   *ModelSession
+	err       error // 持有会话的处理阶段返回的错误
+	abandoned bool  // 任务超时时处理阶段仍在运行，会话由 runAbandonable 在其返回后处理
+}
+
+// putSession 归还任务使用的会话，必须直接 defer 调用
+// 任务 panic 时会话的状态不可信（可能停在推理中途），销毁而不放回池中，然后继续向上抛出；
+// 处理阶段 panic（ErrTaskPanic）时同样销毁；推理失败（ErrSessionRunFailed）时通过 PutSessionFailed 归还，
+// 连续失败的会话会被替换；超时被放弃的会话仍在使用中，这里不做处理
+func (worker *Worker) putSession(lease *sessionLease) {
+	pool := worker.manager.sessionPool
+	if r := recover(); r != nil {
+		if !lease.abandoned {
+			pool.discardSession(lease.session)
+		}
+		panic(newTaskPanic(r))
+	}
+	switch {
+	case lease.abandoned:
+	case errors.Is(lease.err, ErrTaskPanic):
+		pool.discardSession(lease.session)
+	case errors.Is(lease.err, ErrSessionRunFailed):
+		pool.PutSessionFailed(lease.session)
+	default:
+		pool.PutSession(lease.session)
+	}
+}
+
+// panicError 记录 panic 的值和调用栈，返回对应的 ErrTaskPanic 错误
+func (worker *Worker) panicError(p *taskPanic) error {
+	writeLogFile("ERROR", fmt.Sprintf("工作协程 %d 处理任务时发生 panic: %v\n%s", worker.id, p.value, p.stack))
+	return fmt.Errorf("%w: %v", ErrTaskPanic, p.value)
+}
+
+// processGroup 处理一组任务，返回与 group 一一对应的结果
+// 处理过程中的 panic 被转换为 ErrTaskPanic 结果并写入日志（含调用栈），工作协程不会因此退出；
+// 批次推理时一个任务 panic 会使同组的所有任务失败，逐张推理时只影响该任务
+func (worker *Worker) processGroup(group []*DetectionTask) (results []DetectionResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := worker.panicError(newTaskPanic(r))
+			results = make([]DetectionResult, len(group))
+			for i, task := range group {
+				results[i] = failedResult(task.ImagePath, err)
+			}
+		}
+	}()
+
+	switch {
+	case len(group) == 1:
+		return []DetectionResult{worker.processTask(group[0])}
+	case *useAugment || ensembleEnabled():
+		// 测试时增强和多模型集成需要对每张图像分别推理，不走批次推理
+		results = make([]DetectionResult, len(group))
+		for i := range group {
+			results[i] = worker.processGroup(group[i : i+1])[0]
+		}
+		return results
+	default:
+		return worker.processTaskBatch(group)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+// panickingImage 读取尺寸时 panic 的图像，模拟解码器或推理过程中的崩溃
+type panickingImage struct{ image.Image }
+
+func (panickingImage) Bounds() image.Rectangle { panic("图像已损坏") }
+
+func TestWorkerSurvivesTaskPanic(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	useFakeSessions(t)
+
+	tests := []struct {
+		name  string
+		batch int
+	}{
+		{"逐张处理", 1},
+		{"批次推理", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.BatchSize, config.BatchCollect, config.BatchFlush = tt.batch, tt.batch, 10*time.Millisecond
+			// 只有一个工作协程：panic 后工作协程退出的话，后续任务不会有结果
+			manager := NewVideoDetectorManager(1, 4, time.Second)
+			defer manager.Stop()
+
+			submit := func(task *DetectionTask) DetectionResult {
+				t.Helper()
+				callback := make(chan DetectionResult, 1)
+				task.Callback = callback
+				if err := manager.SubmitTaskWait(context.Background(), task); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case result := <-callback:
+					return result
+				case <-time.After(5 * time.Second):
+					t.Fatalf("任务 %s 没有结果，工作协程可能已退出", task.ImagePath)
+					return DetectionResult{}
+				}
+			}
+
+			result := submit(&DetectionTask{ImagePath: "corrupt.jpg", Image: panickingImage{}})
+			if !errors.Is(result.Error, ErrTaskPanic) || result.ImagePath != "corrupt.jpg" {
+				t.Fatalf("panic 的任务结果 = %+v，期望 ErrTaskPanic", result)
+			}
+
+			for i := 0; i < 3; i++ {
+				result := submit(&DetectionTask{ImagePath: missingImage(i)})
+				if result.Error == nil || errors.Is(result.Error, ErrTaskPanic) {
+					t.Errorf("后续任务 %d 的结果 = %v，期望正常的加载失败", i, result.Error)
+				}
+			}
+
+			// panic 时使用的会话被销毁而不是放回池中，活跃会话计数不泄漏
+			if active, _ := manager.sessionPool.GetStats(); active != 0 {
+				t.Errorf("所有任务完成后仍有 %d 个活跃会话", active)
+			}
+		})
+	}
+}
+
+func TestProcessGroupRecoversPanic(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.Augment = true // 逐张推理：panic 只影响发生 panic 的任务
+	pool := fakeSessionPool(t, 1)
+	worker := &Worker{manager: &VideoDetectorManager{sessionPool: pool, timeout: time.Second}}
+
+	group := []*DetectionTask{
+		{ImagePath: missingImage(0)},
+		{ImagePath: "corrupt.jpg", Image: panickingImage{}},
+		{ImagePath: missingImage(1)},
+	}
+	results := worker.processGroup(group)
+	if len(results) != len(group) {
+		t.Fatalf("得到 %d 个结果，期望 %d 个", len(results), len(group))
+	}
+	for i, result := range results {
+		if result.ImagePath != group[i].ImagePath {
+			t.Errorf("第 %d 个结果属于 %s，期望 %s", i, result.ImagePath, group[i].ImagePath)
+		}
+		if panicked := errors.Is(result.Error, ErrTaskPanic); panicked != (i == 1) || result.Error == nil {
+			t.Errorf("第 %d 个结果的错误 = %v", i, result.Error)
+		}
+	}
+}
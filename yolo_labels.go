@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// YOLO 标签导出参数（与 Ultralytics 的 save_txt、save_conf 相同）
+var (
+	saveTxt      = &config.SaveTxt
+	saveConf     = &config.SaveConf
+	saveEmptyTxt = &config.SaveEmptyTxt
+)
+
+// yoloLabelPath 标签文件的路径：标注图像所在目录下的 labels/<输入文件名>.txt
+// 文件名取输入图像（而不是生成的标注图像）的文件名，与原图放在一起即可作为训练数据集
+func yoloLabelPath(imagePath, outputPath string) string {
+	base := filepath.Base(filepath.FromSlash(imagePath))
+	if _, entry, ok := splitArchiveEntry(imagePath); ok {
+		base = path.Base(entry)
+	} else if isRemoteInput(imagePath) {
+		base = urlBaseName(imagePath)
+	}
+	name := sanitizeFileName(strings.TrimSuffix(base, filepath.Ext(base)), *nameReplacement) + ".txt"
+	if isS3Path(outputPath) {
+		return outputPath[:strings.LastIndex(outputPath, "/")] + "/labels/" + name
+	}
+	return filepath.Join(filepath.Dir(outputPath), "labels", name)
+}
+
+// formatYOLOLabels 生成 YOLO 标签文本：每个检测目标一行 class_id cx cy w h [conf]，坐标按原图宽高归一化
+// 数值格式与 Ultralytics 相同（Python 的 %g，6 位有效数字，去掉末尾的 0），同一批结果的文件可以直接 diff
+// 类别ID取当前模型的类别表（ClassID），不在类别表中的标签跳过
+func formatYOLOLabels(record DetectionRecord, withConf bool) []byte {
+	if record.Width <= 0 || record.Height <= 0 {
+		return nil
+	}
+	g := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+	w, h := float64(record.Width), float64(record.Height)
+	var buf bytes.Buffer
+	for _, box := range record.Objects {
+		classID, ok := ClassID(box.label)
+		if !ok {
+			continue
+		}
+		x1, y1, x2, y2 := float64(box.x1), float64(box.y1), float64(box.x2), float64(box.y2)
+		fields := []string{strconv.Itoa(classID),
+			g((x1 + x2) / 2 / w), g((y1 + y2) / 2 / h), g((x2 - x1) / w), g((y2 - y1) / h)}
+		if withConf {
+			fields = append(fields, g(float64(box.confidence)))
+		}
+		buf.WriteString(strings.Join(fields, " "))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// writeYOLOLabels 开启 -save-txt 时保存一张图像的 YOLO 标签文件，s3:// 输出上传到同名对象
+// 与 Ultralytics 相同，没有检测目标的图像不生成标签文件；开启 -save-empty-txt 时生成空文件
+func writeYOLOLabels(record DetectionRecord, outputPath string) error {
+	if !*saveTxt {
+		return nil
+	}
+	data := formatYOLOLabels(record, *saveConf)
+	if len(data) == 0 && !*saveEmptyTxt {
+		return nil
+	}
+	labelPath := yoloLabelPath(record.ImagePath, outputPath)
+	var err error
+	if isS3Path(labelPath) {
+		err = uploadS3(labelPath, data, "text/plain")
+	} else {
+		err = writeFileAtomic(labelPath, func(f *os.File) error {
+			_, err := f.Write(data)
+			return err
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("保存 YOLO 标签失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteYOLOLabelsEmptyImages(t *testing.T) {
+	defer func(saved DetectorConfig) { config = saved }(config)
+	config.SaveTxt = true
+
+	person := boundingBox{label: "person", confidence: 0.9, x1: 0, y1: 0, x2: 320, y2: 240}
+	tests := []struct {
+		name      string
+		objects   []boundingBox
+		saveEmpty bool
+		want      *string // nil 表示不生成标签文件
+	}{
+		{"没有检测目标", nil, false, nil},
+		{"没有检测目标 -save-empty-txt", nil, true, new(string)},
+		{"只有类别表外的标签", []boundingBox{{label: "class_99", confidence: 0.9, x2: 1, y2: 1}}, false, nil},
+		{"只有类别表外的标签 -save-empty-txt", []boundingBox{{label: "class_99", confidence: 0.9, x2: 1, y2: 1}}, true, new(string)},
+		{"有检测目标", []boundingBox{person}, false, ptr("0 0.25 0.25 0.5 0.5\n")},
+		{"有检测目标 -save-empty-txt", []boundingBox{person}, true, ptr("0 0.25 0.25 0.5 0.5\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.SaveEmptyTxt = tt.saveEmpty
+			dir := t.TempDir()
+			record := DetectionRecord{ImagePath: "cam1/0001.jpg", Width: 640, Height: 480, Objects: tt.objects}
+			if err := writeYOLOLabels(record, filepath.Join(dir, "0001_detected.jpg")); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "labels", "0001.txt"))
+			if tt.want == nil {
+				if !os.IsNotExist(err) {
+					t.Errorf("不应生成标签文件: %q (%v)", data, err)
+				}
+				if _, err := os.Stat(filepath.Join(dir, "labels")); !os.IsNotExist(err) {
+					t.Error("不应创建空的 labels 目录")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != *tt.want {
+				t.Errorf("标签文件内容 = %q，期望 %q", data, *tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}